@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/synctv-org/synctv/internal/bootstrap"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/db/backup"
+)
+
+var BackupCmd = &cobra.Command{
+	Use:   "backup [file]",
+	Short: "back up the database",
+	Long:  `Write the rooms, users, playlists and settings to a zip archive that restore loads into any database type, the server may keep running. Uploaded subtitles and avatars are not included, copy the storage path separately`,
+	Args:  cobra.MaximumNArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return bootstrap.New(bootstrap.WithContext(cmd.Context())).Add(
+			bootstrap.InitConfig,
+			bootstrap.InitLog,
+			bootstrap.OpenDatabase,
+		).Run()
+	},
+	RunE: Backup,
+}
+
+func Backup(cmd *cobra.Command, args []string) error {
+	name := fmt.Sprintf("synctv-backup-%s.zip", time.Now().Format("20060102-150405"))
+	if len(args) != 0 {
+		name = args[0]
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	m, err := backup.Backup(cmd.Context(), db.DB(), f)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(name)
+		return err
+	}
+	fmt.Printf("backed up schema version %d to %s\n", m.SchemaVersion, name)
+	return nil
+}
+
+var RestoreCmd = &cobra.Command{
+	Use:   "restore <file>",
+	Short: "restore a backup",
+	Long:  `Load a backup into the database, stop the server first or use POST /api/admin/restore. The database must have no users unless --replace is given`,
+	Args:  cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return bootstrap.New(bootstrap.WithContext(cmd.Context())).Add(
+			bootstrap.InitConfig,
+			bootstrap.InitLog,
+			bootstrap.InitDatabase,
+		).Run()
+	},
+	RunE: Restore,
+}
+
+var restoreReplace bool
+
+func Restore(cmd *cobra.Command, args []string) error {
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	m, err := backup.Restore(cmd.Context(), db.DB(), f, info.Size(), restoreReplace)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored the backup of %s made by synctv %s\n", m.CreatedAt.Format(time.RFC3339), m.ServerVersion)
+	return nil
+}
+
+func init() {
+	RestoreCmd.Flags().BoolVar(&restoreReplace, "replace", false, "delete every row of the database before restoring")
+	RootCmd.AddCommand(BackupCmd, RestoreCmd)
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/synctv-org/synctv/cmd/flags"
+	"github.com/synctv-org/synctv/internal/bootstrap"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/db/migrations"
+)
+
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "manage the database schema",
+	Long:  `Show and change the schema version of the database, the server applies the pending migrations when it starts`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return bootstrap.New(bootstrap.WithContext(cmd.Context())).Add(
+			bootstrap.InitConfig,
+			bootstrap.InitLog,
+			bootstrap.OpenDatabase,
+		).Run()
+	},
+}
+
+var MigrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show the applied migrations",
+	Args:  cobra.NoArgs,
+	RunE:  MigrateStatus,
+}
+
+func MigrateStatus(cmd *cobra.Command, args []string) error {
+	applied, err := migrations.Status(db.DB())
+	if err != nil {
+		return err
+	}
+	for _, m := range applied {
+		fmt.Printf("%d\t%s\t%s\n", m.Version, m.Name, m.AppliedAt.Format("2006-01-02 15:04:05"))
+	}
+	var current uint
+	if len(applied) != 0 {
+		current = applied[len(applied)-1].Version
+	}
+	fmt.Printf("database version %d, server version %d\n", current, migrations.Latest())
+	return nil
+}
+
+var MigrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "apply the pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return db.Migrate()
+	},
+}
+
+var MigrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "revert migrations",
+	Long:  `Revert the migrations above a version, newest first. It drops data and is only available in dev mode`,
+	Args:  cobra.NoArgs,
+	RunE:  MigrateDown,
+}
+
+var migrateDownTo uint
+
+func MigrateDown(cmd *cobra.Command, args []string) error {
+	if !flags.Dev {
+		return errors.New("down migrations drop data, run with --dev to use them")
+	}
+	return migrations.Down(db.DB(), migrateDownTo)
+}
+
+func init() {
+	MigrateDownCmd.Flags().UintVar(&migrateDownTo, "to", 0, "the version to revert to, 0 drops every table")
+	MigrateCmd.AddCommand(MigrateStatusCmd, MigrateUpCmd, MigrateDownCmd)
+	RootCmd.AddCommand(MigrateCmd)
+}
@@ -3,15 +3,15 @@ package cmd
 import (
 	"fmt"
 	"net"
-	"net/http"
+	"time"
 
-	"github.com/quic-go/quic-go/http3"
 	log "github.com/sirupsen/logrus"
 	"github.com/soheilhy/cmux"
 	"github.com/spf13/cobra"
 	"github.com/synctv-org/synctv/cmd/flags"
 	"github.com/synctv-org/synctv/internal/bootstrap"
 	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/health"
 	"github.com/synctv-org/synctv/internal/rtmp"
 	sysnotify "github.com/synctv-org/synctv/internal/sysNotify"
 	"github.com/synctv-org/synctv/server"
@@ -27,11 +27,19 @@ var ServerCmd = &cobra.Command{
 			bootstrap.InitSysNotify,
 			bootstrap.InitConfig,
 			bootstrap.InitLog,
+			bootstrap.InitTracing,
 			bootstrap.InitGinMode,
 			bootstrap.InitDatabase,
+			bootstrap.InitSettings,
 			bootstrap.InitProvider,
 			bootstrap.InitOp,
+			bootstrap.InitCluster,
 			bootstrap.InitRtmp,
+			bootstrap.InitFFmpeg,
+			bootstrap.InitProxy,
+			bootstrap.InitSubtitle,
+			bootstrap.InitStorage,
+			bootstrap.InitEmail,
 			bootstrap.InitRoom,
 		)
 		if !flags.DisableUpdateCheck {
@@ -43,11 +51,11 @@ var ServerCmd = &cobra.Command{
 }
 
 func Server(cmd *cobra.Command, args []string) {
-	tcpServerAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", conf.Conf.Server.Listen, conf.Conf.Server.Port))
+	tcpServerAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", conf.Conf().Server.Listen, conf.Conf().Server.Port))
 	if err != nil {
 		log.Panic(err)
 	}
-	udpServerAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", conf.Conf.Server.Listen, conf.Conf.Server.Port))
+	udpServerAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", conf.Conf().Server.Listen, conf.Conf().Server.Port))
 	if err != nil {
 		log.Panic(err)
 	}
@@ -56,46 +64,52 @@ func Server(cmd *cobra.Command, args []string) {
 		log.Panic(err)
 	}
 	var useMux bool
-	if conf.Conf.Rtmp.Port == 0 || conf.Conf.Rtmp.Port == conf.Conf.Server.Port {
+	if conf.Conf().Rtmp.Port == 0 || conf.Conf().Rtmp.Port == conf.Conf().Server.Port {
 		useMux = true
-		conf.Conf.Rtmp.Port = conf.Conf.Server.Port
+		conf.Conf().Rtmp.Port = conf.Conf().Server.Port
 	}
-	tcpRtmpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", conf.Conf.Server.Listen, conf.Conf.Rtmp.Port))
+	tcpRtmpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", conf.Conf().Server.Listen, conf.Conf().Rtmp.Port))
 	if err != nil {
 		log.Fatal(err)
 	}
-	utils.OptFilePath(&conf.Conf.Server.CertPath)
-	utils.OptFilePath(&conf.Conf.Server.KeyPath)
-	if conf.Conf.Rtmp.Enable {
+	utils.OptFilePath(&conf.Conf().Server.CertPath)
+	utils.OptFilePath(&conf.Conf().Server.KeyPath)
+	shutdownTimeout, err := time.ParseDuration(conf.Conf().Server.ShutdownTimeout)
+	if err != nil {
+		log.Panicf("invalid shutdown timeout: %v", err)
+	}
+	servers := &httpServers{}
+	if conf.Conf().Rtmp.Enable {
 		if useMux {
 			muxer := cmux.New(serverListener)
 			e := server.NewAndInit()
 			switch {
-			case conf.Conf.Server.CertPath != "" && conf.Conf.Server.KeyPath != "":
+			case conf.Conf().Server.CertPath != "" && conf.Conf().Server.KeyPath != "":
 				httpl := muxer.Match(cmux.HTTP2(), cmux.TLS())
-				go http.ServeTLS(httpl, e.Handler(), conf.Conf.Server.CertPath, conf.Conf.Server.KeyPath)
-				if conf.Conf.Server.Quic {
-					go http3.ListenAndServeQUIC(udpServerAddr.String(), conf.Conf.Server.CertPath, conf.Conf.Server.KeyPath, e.Handler())
+				servers.serveTLS(httpl, e.Handler(), conf.Conf().Server.CertPath, conf.Conf().Server.KeyPath)
+				if conf.Conf().Server.Quic {
+					servers.serveQuic(udpServerAddr.String(), e.Handler(), conf.Conf().Server.CertPath, conf.Conf().Server.KeyPath)
 				}
-			case conf.Conf.Server.CertPath == "" && conf.Conf.Server.KeyPath == "":
+			case conf.Conf().Server.CertPath == "" && conf.Conf().Server.KeyPath == "":
 				httpl := muxer.Match(cmux.HTTP1Fast())
-				go e.RunListener(httpl)
+				servers.serve(httpl, e.Handler())
 			default:
 				log.Panic("cert and key must be both set")
 			}
 			tcp := muxer.Match(cmux.Any())
 			go rtmp.RtmpServer().Serve(tcp)
+			health.SetReady("rtmp")
 			go muxer.Serve()
 		} else {
 			e := server.NewAndInit()
 			switch {
-			case conf.Conf.Server.CertPath != "" && conf.Conf.Server.KeyPath != "":
-				go http.ServeTLS(serverListener, e.Handler(), conf.Conf.Server.CertPath, conf.Conf.Server.KeyPath)
-				if conf.Conf.Server.Quic {
-					go http3.ListenAndServeQUIC(udpServerAddr.String(), conf.Conf.Server.CertPath, conf.Conf.Server.KeyPath, e.Handler())
+			case conf.Conf().Server.CertPath != "" && conf.Conf().Server.KeyPath != "":
+				servers.serveTLS(serverListener, e.Handler(), conf.Conf().Server.CertPath, conf.Conf().Server.KeyPath)
+				if conf.Conf().Server.Quic {
+					servers.serveQuic(udpServerAddr.String(), e.Handler(), conf.Conf().Server.CertPath, conf.Conf().Server.KeyPath)
 				}
-			case conf.Conf.Server.CertPath == "" && conf.Conf.Server.KeyPath == "":
-				go e.RunListener(serverListener)
+			case conf.Conf().Server.CertPath == "" && conf.Conf().Server.KeyPath == "":
+				servers.serve(serverListener, e.Handler())
 			default:
 				log.Panic("cert and key must be both set")
 			}
@@ -104,32 +118,42 @@ func Server(cmd *cobra.Command, args []string) {
 				log.Fatal(err)
 			}
 			go rtmp.RtmpServer().Serve(rtmpListener)
+			health.SetReady("rtmp")
 		}
 	} else {
 		e := server.NewAndInit()
 		switch {
-		case conf.Conf.Server.CertPath != "" && conf.Conf.Server.KeyPath != "":
-			go http.ServeTLS(serverListener, e.Handler(), conf.Conf.Server.CertPath, conf.Conf.Server.KeyPath)
-			if conf.Conf.Server.Quic {
-				go http3.ListenAndServeQUIC(udpServerAddr.String(), conf.Conf.Server.CertPath, conf.Conf.Server.KeyPath, e.Handler())
+		case conf.Conf().Server.CertPath != "" && conf.Conf().Server.KeyPath != "":
+			servers.serveTLS(serverListener, e.Handler(), conf.Conf().Server.CertPath, conf.Conf().Server.KeyPath)
+			if conf.Conf().Server.Quic {
+				servers.serveQuic(udpServerAddr.String(), e.Handler(), conf.Conf().Server.CertPath, conf.Conf().Server.KeyPath)
 			}
-		case conf.Conf.Server.CertPath == "" && conf.Conf.Server.KeyPath == "":
-			go e.RunListener(serverListener)
+		case conf.Conf().Server.CertPath == "" && conf.Conf().Server.KeyPath == "":
+			servers.serve(serverListener, e.Handler())
 		default:
 			log.Panic("cert and key must be both set")
 		}
 	}
-	if conf.Conf.Rtmp.Enable {
+	if conf.Conf().Rtmp.Enable {
 		log.Infof("rtmp run on tcp://%s:%d", tcpServerAddr.IP, tcpRtmpAddr.Port)
 	}
-	if conf.Conf.Server.CertPath != "" && conf.Conf.Server.KeyPath != "" {
-		if conf.Conf.Server.Quic {
+	if conf.Conf().Server.CertPath != "" && conf.Conf().Server.KeyPath != "" {
+		if conf.Conf().Server.Quic {
 			log.Infof("quic run on udp://%s:%d", udpServerAddr.IP, udpServerAddr.Port)
 		}
 		log.Infof("website run on https://%s:%d", tcpServerAddr.IP, tcpServerAddr.Port)
 	} else {
 		log.Infof("website run on http://%s:%d", tcpServerAddr.IP, tcpServerAddr.Port)
 	}
+	if err := sysnotify.RegisterSysNotifyTask(-1, sysnotify.NewSysNotifyTask(
+		"graceful-shutdown",
+		sysnotify.NotifyTypeEXIT,
+		func() error {
+			return servers.shutdown(shutdownTimeout)
+		},
+	)); err != nil {
+		log.Panic(err)
+	}
 	sysnotify.WaitCbk()
 }
 
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/health"
+	"github.com/synctv-org/synctv/internal/op"
+)
+
+// httpServers are the http servers started by Server, shut down together on exit
+type httpServers struct {
+	servers []*http.Server
+	quic    []*http3.Server
+}
+
+func (s *httpServers) serve(l net.Listener, handler http.Handler) {
+	srv := &http.Server{Handler: handler}
+	s.servers = append(s.servers, srv)
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("http server: %v", err)
+		}
+	}()
+}
+
+func (s *httpServers) serveTLS(l net.Listener, handler http.Handler, certFile, keyFile string) {
+	srv := &http.Server{Handler: handler}
+	s.servers = append(s.servers, srv)
+	go func() {
+		if err := srv.ServeTLS(l, certFile, keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("https server: %v", err)
+		}
+	}()
+}
+
+func (s *httpServers) serveQuic(addr string, handler http.Handler, certFile, keyFile string) {
+	srv := &http3.Server{Addr: addr, Handler: handler}
+	s.quic = append(s.quic, srv)
+	go func() {
+		if err := srv.ListenAndServeTLS(certFile, keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("quic server: %v", err)
+		}
+	}()
+}
+
+// shutdown stops accepting connections, tells the websocket clients the
+// server restarts and gives them and the running requests timeout to finish,
+// whatever is left is cut. The room states are saved by the next exit task.
+func (s *httpServers) shutdown(timeout time.Duration) error {
+	health.Register("server", func(context.Context) error {
+		return op.ErrServerShuttingDown
+	})
+	closeAt := time.Now().Add(timeout)
+	log.Infof("shutting down, notified %d clients, waiting up to %s for them to disconnect", op.NotifyRestart(closeAt), timeout)
+	ctx, cancel := context.WithDeadline(context.Background(), closeAt)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, srv := range s.servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Warnf("http server: %v, cutting the running requests", err)
+				srv.Close()
+			}
+		}(srv)
+	}
+	if err := op.WaitClients(ctx); err != nil {
+		log.Warnf("%d clients still connected, closing them", op.ClientsNum())
+	}
+	op.CloseRooms()
+	wg.Wait()
+	// http3 of quic-go can not shut down gracefully yet
+	for _, srv := range s.quic {
+		srv.Close()
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/synctv-org/synctv/internal/bootstrap"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+var UserCmd = &cobra.Command{
+	Use:   "user",
+	Short: "manage users",
+	Long:  `Manage the users of the instance`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return bootstrap.New(bootstrap.WithContext(cmd.Context())).Add(
+			bootstrap.InitConfig,
+			bootstrap.InitLog,
+			bootstrap.InitDatabase,
+		).Run()
+	},
+}
+
+var UserRoleCmd = &cobra.Command{
+	Use:   "role <username> <root|admin|user|banned>",
+	Short: "set the role of a user",
+	Long:  `Set the instance role of a user, use it to create the first root user`,
+	Args:  cobra.ExactArgs(2),
+	RunE:  UserRole,
+}
+
+func UserRole(cmd *cobra.Command, args []string) error {
+	role, err := model.ParseRole(args[1])
+	if err != nil {
+		return err
+	}
+	u, err := db.GetUserByUsername(args[0])
+	if err != nil {
+		return err
+	}
+	if err := db.SetUserInstanceRole(u.ID, role); err != nil {
+		return err
+	}
+	if role == model.RoleBanned {
+		if err := db.RevokeUserTokens(u.ID); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("user %s is now %s\n", u.Username, role)
+	return nil
+}
+
+func init() {
+	UserCmd.AddCommand(UserRoleCmd)
+	RootCmd.AddCommand(UserCmd)
+}
@@ -0,0 +1,52 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/cluster"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/health"
+	"github.com/synctv-org/synctv/internal/op"
+	sysnotify "github.com/synctv-org/synctv/internal/sysNotify"
+)
+
+// InitCluster shares the rooms with the other instances when cluster.redis
+// is set, it must run before the rooms are loaded
+func InitCluster(ctx context.Context) error {
+	c := conf.Conf().Cluster
+	if c.Redis == "" {
+		return nil
+	}
+	opt, err := redis.ParseURL(c.Redis)
+	if err != nil {
+		return fmt.Errorf("cluster redis: %w", err)
+	}
+	b := cluster.NewRedis(redis.NewClient(opt))
+	if err := b.Ping(ctx); err != nil {
+		b.Close()
+		return fmt.Errorf("cluster redis: %w", err)
+	}
+	instance := c.Instance
+	if instance == "" {
+		instance = uuid.NewString()
+	}
+	if err := op.SetBroker(b, instance); err != nil {
+		b.Close()
+		return fmt.Errorf("cluster redis: %w", err)
+	}
+	health.Register("cluster", b.Ping)
+	log.Infof("cluster: joined as instance %s", instance)
+	// after the room states are saved
+	return sysnotify.RegisterSysNotifyTask(1, sysnotify.NewSysNotifyTask(
+		"close-cluster",
+		sysnotify.NotifyTypeEXIT,
+		func() error {
+			op.SetBroker(nil, "")
+			return b.Close()
+		},
+	))
+}
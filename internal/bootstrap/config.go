@@ -3,6 +3,7 @@ package bootstrap
 import (
 	"context"
 	"errors"
+	"fmt"
 	"path/filepath"
 
 	"github.com/caarlos0/env/v9"
@@ -10,11 +11,12 @@ import (
 
 	"github.com/synctv-org/synctv/cmd/flags"
 	"github.com/synctv-org/synctv/internal/conf"
+	sysnotify "github.com/synctv-org/synctv/internal/sysNotify"
 	"github.com/synctv-org/synctv/utils"
 )
 
 func InitDefaultConfig(ctx context.Context) error {
-	conf.Conf = conf.DefaultConfig()
+	conf.Set(conf.DefaultConfig())
 	return nil
 }
 
@@ -23,22 +25,42 @@ func InitConfig(ctx context.Context) error {
 		log.Fatal("skip config and skip env at the same time")
 		return errors.New("skip config and skip env at the same time")
 	}
-	conf.Conf = conf.DefaultConfig()
+	c, err := loadConfig(true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	conf.Set(c)
+	conf.SetLoader(func() (*conf.Config, error) {
+		return loadConfig(false)
+	})
+	return sysnotify.RegisterSysNotifyTask(0, sysnotify.NewSysNotifyTask(
+		"reload-config",
+		sysnotify.NotifyTypeRELOAD,
+		conf.Reload,
+	))
+}
+
+// loadConfig reads the config file then the env over the defaults, restore
+// writes the file back with the options it misses, only done at startup
+func loadConfig(restore bool) (*conf.Config, error) {
+	c := conf.DefaultConfig()
 	if !flags.SkipConfig {
 		if flags.ConfigFile == "" {
 			flags.ConfigFile = filepath.Join(flags.DataDir, "config.yaml")
 		} else {
 			utils.OptFilePath(&flags.ConfigFile)
 		}
-		err := confFromConfig(flags.ConfigFile, conf.Conf)
+		err := confFromConfig(flags.ConfigFile, c)
 		if err != nil {
-			log.Fatalf("load config from file error: %v", err)
+			return nil, fmt.Errorf("load config from file error: %w", err)
 		}
 		log.Infof("load config success from file: %s", flags.ConfigFile)
-		if err = restoreConfig(flags.ConfigFile, conf.Conf); err != nil {
-			log.Warnf("restore config error: %v", err)
-		} else {
-			log.Info("restore config success")
+		if restore {
+			if err = restoreConfig(flags.ConfigFile, c); err != nil {
+				log.Warnf("restore config error: %v", err)
+			} else {
+				log.Info("restore config success")
+			}
 		}
 	}
 	if !flags.SkipEnv {
@@ -49,13 +71,13 @@ func InitConfig(ctx context.Context) error {
 		} else {
 			log.Infof("load config from env with prefix: %s", prefix)
 		}
-		err := confFromEnv(prefix, conf.Conf)
+		err := confFromEnv(prefix, c)
 		if err != nil {
-			log.Fatalf("load config from env error: %v", err)
+			return nil, fmt.Errorf("load config from env error: %w", err)
 		}
 		log.Info("load config success from env")
 	}
-	return nil
+	return c, nil
 }
 
 func confFromConfig(filePath string, conf *conf.Config) error {
@@ -12,6 +12,8 @@ import (
 	"github.com/synctv-org/synctv/cmd/flags"
 	"github.com/synctv-org/synctv/internal/conf"
 	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/health"
+	sysnotify "github.com/synctv-org/synctv/internal/sysNotify"
 	"github.com/synctv-org/synctv/utils"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
@@ -19,33 +21,44 @@ import (
 	"gorm.io/gorm/logger"
 )
 
+// InitDatabase connects to the database and applies the pending migrations
 func InitDatabase(ctx context.Context) error {
+	if err := OpenDatabase(ctx); err != nil {
+		return err
+	}
+	health.Register("database", db.Ready)
+	return db.Migrate()
+}
+
+// OpenDatabase connects to the database without migrating it
+func OpenDatabase(ctx context.Context) error {
 	var dialector gorm.Dialector
 	var opts []gorm.Option
-	switch conf.Conf.Database.Type {
+	memory := false
+	switch conf.Conf().Database.Type {
 	case conf.DatabaseTypeMysql:
 		var dsn string
-		if conf.Conf.Database.CustomDSN != "" {
-			dsn = conf.Conf.Database.CustomDSN
-		} else if conf.Conf.Database.Port == 0 {
+		if conf.Conf().Database.CustomDSN != "" {
+			dsn = conf.Conf().Database.CustomDSN
+		} else if conf.Conf().Database.Port == 0 {
 			dsn = fmt.Sprintf("%s:%s@unix(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local&tls=%s&interpolateParams=true",
-				conf.Conf.Database.User,
-				conf.Conf.Database.Password,
-				conf.Conf.Database.Host,
-				conf.Conf.Database.DBName,
-				conf.Conf.Database.SslMode,
+				conf.Conf().Database.User,
+				conf.Conf().Database.Password,
+				conf.Conf().Database.Host,
+				conf.Conf().Database.DBName,
+				mysqlTLS(conf.Conf().Database.SslMode),
 			)
-			log.Infof("mysql database unix socket: %s", conf.Conf.Database.Host)
+			log.Infof("mysql database unix socket: %s", conf.Conf().Database.Host)
 		} else {
 			dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local&tls=%s&interpolateParams=true",
-				conf.Conf.Database.User,
-				conf.Conf.Database.Password,
-				conf.Conf.Database.Host,
-				conf.Conf.Database.Port,
-				conf.Conf.Database.DBName,
-				conf.Conf.Database.SslMode,
+				conf.Conf().Database.User,
+				conf.Conf().Database.Password,
+				conf.Conf().Database.Host,
+				conf.Conf().Database.Port,
+				conf.Conf().Database.DBName,
+				mysqlTLS(conf.Conf().Database.SslMode),
 			)
-			log.Infof("mysql database tcp: %s:%d", conf.Conf.Database.Host, conf.Conf.Database.Port)
+			log.Infof("mysql database tcp: %s:%d", conf.Conf().Database.Host, conf.Conf().Database.Port)
 		}
 		dialector = mysql.New(mysql.Config{
 			DSN:                       dsn,
@@ -58,44 +71,45 @@ func InitDatabase(ctx context.Context) error {
 		// opts = append(opts, &gorm.Config{})
 	case conf.DatabaseTypeSqlite3:
 		var dsn string
-		if conf.Conf.Database.CustomDSN != "" {
-			dsn = conf.Conf.Database.CustomDSN
-		} else if conf.Conf.Database.DBName == "memory" || strings.HasPrefix(conf.Conf.Database.DBName, ":memory:") {
+		if conf.Conf().Database.CustomDSN != "" {
+			dsn = conf.Conf().Database.CustomDSN
+		} else if conf.Conf().Database.DBName == "memory" || strings.HasPrefix(conf.Conf().Database.DBName, ":memory:") {
 			dsn = "file::memory:?cache=shared&_journal_mode=WAL&_vacuum=incremental&_pragma=foreign_keys(1)"
+			memory = true
 			log.Infof("sqlite3 database memory")
 		} else {
-			if !strings.HasSuffix(conf.Conf.Database.DBName, ".db") {
-				conf.Conf.Database.DBName = conf.Conf.Database.DBName + ".db"
+			if !strings.HasSuffix(conf.Conf().Database.DBName, ".db") {
+				conf.Conf().Database.DBName = conf.Conf().Database.DBName + ".db"
 			}
-			utils.OptFilePath(&conf.Conf.Database.DBName)
-			dsn = fmt.Sprintf("%s?_journal_mode=WAL&_vacuum=incremental&_pragma=foreign_keys(1)", conf.Conf.Database.DBName)
-			log.Infof("sqlite3 database file: %s", conf.Conf.Database.DBName)
+			utils.OptFilePath(&conf.Conf().Database.DBName)
+			dsn = fmt.Sprintf("%s?_journal_mode=WAL&_vacuum=incremental&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", conf.Conf().Database.DBName)
+			log.Infof("sqlite3 database file: %s", conf.Conf().Database.DBName)
 		}
 		dialector = sqlite.Open(dsn)
 		// opts = append(opts, &gorm.Config{})
 	case conf.DatabaseTypePostgres:
 		var dsn string
-		if conf.Conf.Database.CustomDSN != "" {
-			dsn = conf.Conf.Database.CustomDSN
-		} else if conf.Conf.Database.Port == 0 {
+		if conf.Conf().Database.CustomDSN != "" {
+			dsn = conf.Conf().Database.CustomDSN
+		} else if conf.Conf().Database.Port == 0 {
 			dsn = fmt.Sprintf("host=%s user=%s password=%s dbname=%s sslmode=%s",
-				conf.Conf.Database.Host,
-				conf.Conf.Database.User,
-				conf.Conf.Database.Password,
-				conf.Conf.Database.DBName,
-				conf.Conf.Database.SslMode,
+				conf.Conf().Database.Host,
+				conf.Conf().Database.User,
+				conf.Conf().Database.Password,
+				conf.Conf().Database.DBName,
+				conf.Conf().Database.SslMode,
 			)
-			log.Infof("postgres database unix socket: %s", conf.Conf.Database.Host)
+			log.Infof("postgres database unix socket: %s", conf.Conf().Database.Host)
 		} else {
 			dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-				conf.Conf.Database.Host,
-				conf.Conf.Database.Port,
-				conf.Conf.Database.User,
-				conf.Conf.Database.Password,
-				conf.Conf.Database.DBName,
-				conf.Conf.Database.SslMode,
+				conf.Conf().Database.Host,
+				conf.Conf().Database.Port,
+				conf.Conf().Database.User,
+				conf.Conf().Database.Password,
+				conf.Conf().Database.DBName,
+				conf.Conf().Database.SslMode,
 			)
-			log.Infof("postgres database tcp: %s:%d", conf.Conf.Database.Host, conf.Conf.Database.Port)
+			log.Infof("postgres database tcp: %s:%d", conf.Conf().Database.Host, conf.Conf().Database.Port)
 		}
 		dialector = postgres.New(postgres.Config{
 			DSN:                  dsn,
@@ -103,7 +117,7 @@ func InitDatabase(ctx context.Context) error {
 		})
 		// opts = append(opts, &gorm.Config{})
 	default:
-		log.Fatalf("unknown database type: %s", conf.Conf.Database.Type)
+		log.Fatalf("unknown database type: %s", conf.Conf().Database.Type)
 	}
 	opts = append(opts, &gorm.Config{
 		TranslateError: true,
@@ -118,8 +132,21 @@ func InitDatabase(ctx context.Context) error {
 	if err != nil {
 		log.Fatalf("failed to get sqlDB: %s", err.Error())
 	}
-	initRawDB(sqlDB)
-	return db.Init(d)
+	if err := initRawDB(sqlDB, memory); err != nil {
+		return err
+	}
+	if err := db.Open(d); err != nil {
+		return err
+	}
+	// after the room states are saved
+	return sysnotify.RegisterSysNotifyTask(2, sysnotify.NewSysNotifyTask(
+		"close-db",
+		sysnotify.NotifyTypeEXIT,
+		func() error {
+			db.Close()
+			return nil
+		},
+	))
 }
 
 func newDBLogger() logger.Interface {
@@ -129,24 +156,56 @@ func newDBLogger() logger.Interface {
 	} else {
 		logLevel = logger.Warn
 	}
-	return logger.New(
-		log.StandardLogger(),
-		logger.Config{
-			SlowThreshold:             time.Second,
-			LogLevel:                  logLevel,
-			IgnoreRecordNotFoundError: true,
-			ParameterizedQueries:      true,
-			Colorful:                  false,
-		},
-	)
+	return db.NewLogger(logLevel, time.Second)
 }
 
-func initRawDB(db *sql.DB) {
-	db.SetMaxOpenConns(conf.Conf.Database.MaxOpenConns)
-	db.SetMaxIdleConns(conf.Conf.Database.MaxIdleConns)
-	d, err := time.ParseDuration(conf.Conf.Database.ConnMaxLifetime)
+// initRawDB tunes the connection pool, a shared memory sqlite database is
+// dropped with its last connection so its connections are never closed
+func initRawDB(db *sql.DB, memory bool) error {
+	c := conf.Conf().Database
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	if memory {
+		if c.MaxIdleConns < 1 {
+			c.MaxIdleConns = 1
+		}
+		db.SetMaxIdleConns(c.MaxIdleConns)
+		return nil
+	}
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	lifetime, err := parsePoolDuration(c.ConnMaxLifetime)
 	if err != nil {
-		log.Fatalf("failed to parse conn_max_lifetime: %s", err.Error())
+		return fmt.Errorf("database conn_max_lifetime: %w", err)
+	}
+	db.SetConnMaxLifetime(lifetime)
+	idleTime, err := parsePoolDuration(c.ConnMaxIdleTime)
+	if err != nil {
+		return fmt.Errorf("database conn_max_idle_time: %w", err)
+	}
+	db.SetConnMaxIdleTime(idleTime)
+	return nil
+}
+
+// parsePoolDuration parses a duration of the pool, empty means no limit
+func parsePoolDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// mysqlTLS maps the postgres sslmode to the tls option of the mysql driver,
+// other values are mysql options or tls config names and are kept
+func mysqlTLS(sslMode string) string {
+	switch sslMode {
+	case "", "disable":
+		return "false"
+	case "allow", "prefer":
+		return "preferred"
+	case "require":
+		return "skip-verify"
+	case "verify-ca", "verify-full":
+		return "true"
+	default:
+		return sslMode
 	}
-	db.SetConnMaxLifetime(d)
 }
@@ -0,0 +1,44 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/email"
+)
+
+func InitEmail(ctx context.Context) error {
+	c := conf.Conf().Email
+	if !c.Enable {
+		if c.RequireVerification {
+			return errors.New("email.require_verification needs email.enable")
+		}
+		return nil
+	}
+	if c.Host == "" {
+		return errors.New("email.host is empty")
+	}
+	if c.BaseURL == "" {
+		return errors.New("email.base_url is empty")
+	}
+	if _, err := time.ParseDuration(c.TokenExpire); err != nil {
+		return fmt.Errorf("failed to parse email.token_expire: %w", err)
+	}
+	from := c.From
+	if from == "" {
+		from = c.Username
+	}
+	q := email.NewQueue(&email.SMTPSender{
+		Host:     c.Host,
+		Port:     int(c.Port),
+		Username: c.Username,
+		Password: c.Password,
+		From:     from,
+	}, 100)
+	go q.Run(ctx)
+	email.Init(q)
+	return nil
+}
@@ -0,0 +1,23 @@
+package bootstrap
+
+import (
+	"context"
+	"os/exec"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/proxy"
+)
+
+func InitFFmpeg(ctx context.Context) error {
+	path := conf.Conf().FFmpeg.Path
+	if path == "" {
+		var err error
+		if path, err = exec.LookPath("ffmpeg"); err != nil {
+			log.Info("ffmpeg not found, thumbnails and remuxing are disabled")
+			return nil
+		}
+	}
+	proxy.Init(path, conf.Conf().Proxy.Remux, conf.Conf().Proxy.MaxRemux)
+	return nil
+}
@@ -24,16 +24,40 @@ func setLog(l *logrus.Logger) {
 	}
 }
 
+// logFile is the file written by the log, nil when it is disabled
+var logFile *lumberjack.Logger
+
 func InitLog(ctx context.Context) error {
 	setLog(logrus.StandardLogger())
-	if conf.Conf.Log.Enable {
-		utils.OptFilePath(&conf.Conf.Log.FilePath)
+	applyLog(conf.Conf().Log)
+	log.SetOutput(logrus.StandardLogger().Writer())
+	conf.OnReload("log", func(old, new *conf.Config) error {
+		if new.Log != old.Log {
+			applyLog(new.Log)
+		}
+		return nil
+	})
+	return nil
+}
+
+// applyLog sets the level, the output and the format of the log from c
+func applyLog(c conf.LogConfig) {
+	if !flags.Dev {
+		level, err := logrus.ParseLevel(c.Level)
+		if err != nil {
+			logrus.Warnf("log: unknown level: %s, use default: info", c.Level)
+			level = logrus.InfoLevel
+		}
+		logrus.SetLevel(level)
+	}
+	if c.Enable {
+		utils.OptFilePath(&c.FilePath)
 		var l = &lumberjack.Logger{
-			Filename:   conf.Conf.Log.FilePath,
-			MaxSize:    conf.Conf.Log.MaxSize,
-			MaxBackups: conf.Conf.Log.MaxBackups,
-			MaxAge:     conf.Conf.Log.MaxAge,
-			Compress:   conf.Conf.Log.Compress,
+			Filename:   c.FilePath,
+			MaxSize:    c.MaxSize,
+			MaxBackups: c.MaxBackups,
+			MaxAge:     c.MaxAge,
+			Compress:   c.Compress,
 		}
 		if err := l.Rotate(); err != nil {
 			logrus.Fatalf("log: rotate log file error: %v", err)
@@ -41,18 +65,23 @@ func InitLog(ctx context.Context) error {
 		var w io.Writer = colorable.NewNonColorableWriter(l)
 		if flags.Dev || flags.LogStd {
 			logrus.SetOutput(io.MultiWriter(os.Stdout, w))
-			logrus.Infof("log: enable log to stdout and file: %s", conf.Conf.Log.FilePath)
+			logrus.Infof("log: enable log to stdout and file: %s", c.FilePath)
 		} else {
 			logrus.SetOutput(w)
-			logrus.Infof("log: disable log to stdout, only log to file: %s", conf.Conf.Log.FilePath)
+			logrus.Infof("log: disable log to stdout, only log to file: %s", c.FilePath)
 		}
+		closeLogFile()
+		logFile = l
+	} else if logFile != nil {
+		logrus.SetOutput(os.Stdout)
+		closeLogFile()
 	}
-	switch conf.Conf.Log.LogFormat {
+	switch c.LogFormat {
 	case "json":
 		logrus.SetFormatter(&logrus.JSONFormatter{})
 	default:
-		if conf.Conf.Log.LogFormat != "text" {
-			logrus.Warnf("unknown log format: %s, use default: text", conf.Conf.Log.LogFormat)
+		if c.LogFormat != "text" {
+			logrus.Warnf("unknown log format: %s, use default: text", c.LogFormat)
 		}
 		if colorable.IsTerminal(os.Stdout.Fd()) {
 			logrus.SetFormatter(&logrus.TextFormatter{
@@ -62,8 +91,13 @@ func InitLog(ctx context.Context) error {
 			logrus.SetFormatter(&logrus.TextFormatter{})
 		}
 	}
-	log.SetOutput(logrus.StandardLogger().Writer())
-	return nil
+}
+
+func closeLogFile() {
+	if logFile != nil {
+		logFile.Close()
+		logFile = nil
+	}
 }
 
 func InitStdLog(ctx context.Context) error {
@@ -8,5 +8,6 @@ import (
 
 func InitOp(ctx context.Context) error {
 	op.Init(4096)
-	return nil
+	op.StartUserJanitor(ctx)
+	return op.LoadRevokedTokens()
 }
@@ -2,17 +2,38 @@ package bootstrap
 
 import (
 	"context"
+	"reflect"
 
 	"github.com/synctv-org/synctv/internal/conf"
 	"github.com/synctv-org/synctv/internal/provider"
 )
 
 func InitProvider(ctx context.Context) error {
-	for op, v := range conf.Conf.OAuth2 {
-		err := provider.InitProvider(op, v.ClientID, v.ClientSecret)
-		if err != nil {
+	if err := initProviders(conf.Conf().OAuth2); err != nil {
+		return err
+	}
+	conf.OnReload("oauth2", func(old, new *conf.Config) error {
+		if reflect.DeepEqual(old.OAuth2, new.OAuth2) {
+			return nil
+		}
+		if err := initProviders(new.OAuth2); err != nil {
+			new.OAuth2 = old.OAuth2
 			return err
 		}
-	}
+		return nil
+	})
 	return nil
 }
+
+func initProviders(c conf.OAuth2Config) error {
+	opts := make(map[provider.OAuth2Provider]provider.InitOption, len(c))
+	for op, v := range c {
+		opts[op] = provider.InitOption{
+			ClientID:     v.ClientID,
+			ClientSecret: v.ClientSecret,
+			RedirectURL:  v.RedirectURL,
+			Issuer:       v.Issuer,
+		}
+	}
+	return provider.InitProviders(opts)
+}
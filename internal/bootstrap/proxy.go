@@ -0,0 +1,42 @@
+package bootstrap
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/health"
+	"github.com/synctv-org/synctv/internal/proxy"
+	"github.com/synctv-org/synctv/utils"
+)
+
+func InitProxy(ctx context.Context) error {
+	health.SetPending("proxy")
+	proxy.InitBandwidth(conf.Conf().Proxy.ConnectionBandwidth<<10, conf.Conf().Proxy.RoomBandwidth<<10)
+	if conf.Conf().Proxy.CachePath != "" {
+		utils.OptFilePath(&conf.Conf().Proxy.CachePath)
+		if err := proxy.InitCache(conf.Conf().Proxy.CachePath, conf.Conf().Proxy.CacheSize<<20); err != nil {
+			return err
+		}
+		log.Infof("caching proxied movies in %s", conf.Conf().Proxy.CachePath)
+	}
+	conf.OnReload("proxy", reloadProxy)
+	health.SetReady("proxy")
+	return nil
+}
+
+func reloadProxy(old, new *conf.Config) error {
+	proxy.InitBandwidth(new.Proxy.ConnectionBandwidth<<10, new.Proxy.RoomBandwidth<<10)
+	if new.Proxy.CachePath != "" {
+		utils.OptFilePath(&new.Proxy.CachePath)
+	}
+	if new.Proxy.CachePath != old.Proxy.CachePath {
+		log.Warn("config: proxy.cache_path changed, restart to apply it")
+		new.Proxy.CachePath = old.Proxy.CachePath
+	}
+	if c := proxy.Cache(); c != nil && new.Proxy.CacheSize != old.Proxy.CacheSize {
+		c.SetMax(new.Proxy.CacheSize << 20)
+		log.Infof("proxy cache size set to %d MiB", new.Proxy.CacheSize)
+	}
+	return nil
+}
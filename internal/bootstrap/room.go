@@ -2,10 +2,16 @@ package bootstrap
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/conf"
 	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
 	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/proxy"
+	sysnotify "github.com/synctv-org/synctv/internal/sysNotify"
 )
 
 func InitRoom(ctx context.Context) error {
@@ -20,5 +26,68 @@ func InitRoom(ctx context.Context) error {
 			return err
 		}
 	}
+
+	hibernateAfter, err := time.ParseDuration(conf.Conf().Room.HibernateAfter)
+	if err != nil {
+		return err
+	}
+	ttl, err := time.ParseDuration(conf.Conf().Room.TTL)
+	if err != nil {
+		return err
+	}
+	retention, err := time.ParseDuration(conf.Conf().Room.DeletedRetention)
+	if err != nil {
+		return err
+	}
+	op.StartRoomJanitor(ctx, hibernateAfter, ttl, retention)
+
+	saveStateEvery, err := time.ParseDuration(conf.Conf().Room.SaveStateEvery)
+	if err != nil {
+		return err
+	}
+	op.StartRoomStateSaver(ctx, saveStateEvery)
+
+	chatMaxAge, err := time.ParseDuration(conf.Conf().Room.ChatMaxAge)
+	if err != nil {
+		return err
+	}
+	op.StartChatJanitor(ctx, chatMaxAge, conf.Conf().Room.ChatMaxMessages)
+
+	if err := initChatFilter(); err != nil {
+		return err
+	}
+
+	op.StartEventWriter(ctx)
+
+	if conf.Conf().Probe.Enable {
+		op.StartMovieProber(ctx, conf.Conf().Probe.Workers, proxy.FFmpeg())
+	}
+	return sysnotify.RegisterSysNotifyTask(0, sysnotify.NewSysNotifyTask(
+		"save-room-states",
+		sysnotify.NotifyTypeEXIT,
+		func() error {
+			log.Infof("saved %d room states", op.SaveRoomStates())
+			return nil
+		},
+	))
+}
+
+func initChatFilter() error {
+	c := conf.Conf().ChatFilter
+	action := model.ChatFilterAction(c.Action)
+	if action != "" && !action.Valid() {
+		return fmt.Errorf("invalid chat filter action: %s", c.Action)
+	}
+	muteFor, err := time.ParseDuration(c.MuteFor)
+	if err != nil {
+		return err
+	}
+	op.SetChatFilter(op.NewChatFilter(model.ChatFilter{
+		BlockedWords: c.BlockedWords,
+		BlockLinks:   c.BlockLinks,
+		RepeatLimit:  c.RepeatLimit,
+		Action:       action,
+		MuteSeconds:  int64(muteFor / time.Second),
+	}))
 	return nil
 }
@@ -3,10 +3,10 @@ package bootstrap
 import (
 	"context"
 	"fmt"
-	"strconv"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/health"
 	"github.com/synctv-org/synctv/internal/op"
 	"github.com/synctv-org/synctv/internal/rtmp"
 	rtmps "github.com/zijiren233/livelib/server"
@@ -15,6 +15,10 @@ import (
 func InitRtmp(ctx context.Context) error {
 	s := rtmps.NewRtmpServer(auth)
 	rtmp.Init(s)
+	if conf.Conf().Rtmp.Enable {
+		// ready once cmd serves it
+		health.SetPending("rtmp")
+	}
 
 	return nil
 }
@@ -27,12 +31,7 @@ func auth(ReqAppName, ReqChannelName string, IsPublisher bool) (*rtmps.Channel,
 			return nil, err
 		}
 		log.Infof("rtmp: publisher login success: %s/%s", ReqAppName, channelName)
-		id, err := strconv.Atoi(ReqAppName)
-		if err != nil {
-			log.Errorf("rtmp: parse channel name to id error: %v", err)
-			return nil, err
-		}
-		r, err := op.GetRoomByID(uint(id))
+		r, err := op.GetRoomByID(ReqAppName)
 		if err != nil {
 			log.Errorf("rtmp: get room by id error: %v", err)
 			return nil, err
@@ -40,16 +39,11 @@ func auth(ReqAppName, ReqChannelName string, IsPublisher bool) (*rtmps.Channel,
 		return r.GetChannel(channelName)
 	}
 
-	if !conf.Conf.Rtmp.RtmpPlayer {
+	if !conf.Conf().Rtmp.RtmpPlayer {
 		log.Warnf("rtmp: dial to %s/%s error: %s", ReqAppName, ReqChannelName, "rtmp player is not enabled")
 		return nil, fmt.Errorf("rtmp: dial to %s/%s error: %s", ReqAppName, ReqChannelName, "rtmp player is not enabled")
 	}
-	id, err := strconv.Atoi(ReqAppName)
-	if err != nil {
-		log.Errorf("rtmp: parse channel name to id error: %v", err)
-		return nil, err
-	}
-	r, err := op.GetRoomByID(uint(id))
+	r, err := op.GetRoomByID(ReqAppName)
 	if err != nil {
 		log.Errorf("rtmp: get room by id error: %v", err)
 		return nil, err
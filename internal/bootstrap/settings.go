@@ -0,0 +1,11 @@
+package bootstrap
+
+import (
+	"context"
+
+	"github.com/synctv-org/synctv/internal/settings"
+)
+
+func InitSettings(ctx context.Context) error {
+	return settings.Init()
+}
@@ -0,0 +1,22 @@
+package bootstrap
+
+import (
+	"context"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/storage"
+	"github.com/synctv-org/synctv/utils"
+)
+
+func InitStorage(ctx context.Context) error {
+	if conf.Conf().Storage.Path == "" {
+		return nil
+	}
+	utils.OptFilePath(&conf.Conf().Storage.Path)
+	s, err := storage.NewDiskStorage(conf.Conf().Storage.Path)
+	if err != nil {
+		return err
+	}
+	storage.Init(s)
+	return nil
+}
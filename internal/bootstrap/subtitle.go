@@ -0,0 +1,23 @@
+package bootstrap
+
+import (
+	"context"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/storage"
+	"github.com/synctv-org/synctv/internal/subtitle"
+	"github.com/synctv-org/synctv/utils"
+)
+
+func InitSubtitle(ctx context.Context) error {
+	if conf.Conf().Subtitle.Path == "" {
+		return nil
+	}
+	utils.OptFilePath(&conf.Conf().Subtitle.Path)
+	s, err := storage.NewDiskStorage(conf.Conf().Subtitle.Path)
+	if err != nil {
+		return err
+	}
+	subtitle.Init(s)
+	return nil
+}
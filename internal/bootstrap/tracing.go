@@ -0,0 +1,25 @@
+package bootstrap
+
+import (
+	"context"
+	"time"
+
+	sysnotify "github.com/synctv-org/synctv/internal/sysNotify"
+	"github.com/synctv-org/synctv/internal/tracing"
+)
+
+func InitTracing(ctx context.Context) error {
+	shutdown, err := tracing.Init(ctx)
+	if err != nil {
+		return err
+	}
+	return sysnotify.RegisterSysNotifyTask(1, sysnotify.NewSysNotifyTask(
+		"flush-traces",
+		sysnotify.NotifyTypeEXIT,
+		func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return shutdown(ctx)
+		},
+	))
+}
@@ -0,0 +1,167 @@
+// Package cluster implements op.Broker with redis, for synctv instances
+// serving the same rooms behind a load balancer.
+package cluster
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	json "github.com/json-iterator/go"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/op"
+)
+
+const (
+	keyPrefix = "synctv:"
+	// stateTTL keeps the state of rooms nobody changed for a day, the
+	// instances fall back to the state saved in the database
+	stateTTL = 24 * time.Hour
+)
+
+// eventsChannel prefixes the channels of the rooms, the instance events go
+// to eventsChannel itself
+const eventsChannel = keyPrefix + "events:"
+
+func channelKey(roomID string) string {
+	return eventsChannel + roomID
+}
+
+func stateKey(roomID string) string {
+	return keyPrefix + "room:" + roomID + ":state"
+}
+
+func presenceKey(roomID string) string {
+	return keyPrefix + "presence:" + roomID
+}
+
+// Redis shares the rooms through redis pub/sub, with one pattern
+// subscription for every room. The presence of a room is a hash of the users
+// by instance, each entry expiring on its own.
+type Redis struct {
+	client *redis.Client
+	ps     *redis.PubSub
+}
+
+var _ op.Broker = (*Redis)(nil)
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+// Ping checks the connection, for the readiness probe
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *Redis) Publish(ctx context.Context, roomID string, e *op.BrokerEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if e.Kind == op.BrokerState {
+			p.Set(ctx, stateKey(roomID), b, stateTTL)
+		}
+		p.Publish(ctx, channelKey(roomID), b)
+		return nil
+	})
+	return err
+}
+
+func (r *Redis) Subscribe(handle func(roomID string, e *op.BrokerEvent)) error {
+	ctx := context.Background()
+	ps := r.client.PSubscribe(ctx, eventsChannel+"*")
+	// wait for the subscription so no event published after it is missed
+	if _, err := ps.Receive(ctx); err != nil {
+		ps.Close()
+		return err
+	}
+	r.ps = ps
+	go func() {
+		for msg := range ps.Channel() {
+			roomID := strings.TrimPrefix(msg.Channel, eventsChannel)
+			e := &op.BrokerEvent{}
+			if err := json.UnmarshalFromString(msg.Payload, e); err != nil {
+				log.Errorf("cluster: decode room %s event failed: %s", roomID, err.Error())
+				continue
+			}
+			handle(roomID, e)
+		}
+	}()
+	return nil
+}
+
+func (r *Redis) State(ctx context.Context, roomID string) (*op.BrokerEvent, error) {
+	b, err := r.client.Get(ctx, stateKey(roomID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	e := &op.BrokerEvent{}
+	return e, json.Unmarshal(b, e)
+}
+
+// presence is the entry of an instance in the presence hash of a room
+type presence struct {
+	Users []uint `json:"users"`
+	// Expires is in unix milli
+	Expires int64 `json:"expires"`
+}
+
+func (r *Redis) SetPresence(ctx context.Context, roomID, instance string, userIDs []uint, ttl time.Duration) error {
+	key := presenceKey(roomID)
+	if len(userIDs) == 0 {
+		return r.client.HDel(ctx, key, instance).Err()
+	}
+	b, err := json.Marshal(&presence{Users: userIDs, Expires: time.Now().Add(ttl).UnixMilli()})
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, key, instance, b)
+		// the hash outlives its longest entry
+		p.Expire(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
+
+func (r *Redis) Presence(ctx context.Context, roomID string) ([]uint, error) {
+	key := presenceKey(roomID)
+	all, err := r.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	users, expired := parsePresence(all, time.Now())
+	if len(expired) != 0 {
+		if err := r.client.HDel(ctx, key, expired...).Err(); err != nil {
+			log.Errorf("cluster: delete room %s expired presence failed: %s", roomID, err.Error())
+		}
+	}
+	return users, nil
+}
+
+// parsePresence returns the users of the entries alive at now and the
+// instances of the expired or invalid ones
+func parsePresence(all map[string]string, now time.Time) (users []uint, expired []string) {
+	for instance, v := range all {
+		var p presence
+		if err := json.UnmarshalFromString(v, &p); err != nil || p.Expires <= now.UnixMilli() {
+			expired = append(expired, instance)
+			continue
+		}
+		users = append(users, p.Users...)
+	}
+	return users, expired
+}
+
+func (r *Redis) Close() error {
+	if r.ps != nil {
+		r.ps.Close()
+	}
+	return r.client.Close()
+}
@@ -0,0 +1,25 @@
+package cluster
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParsePresence(t *testing.T) {
+	now := time.UnixMilli(10_000)
+	users, expired := parsePresence(map[string]string{
+		"a":       `{"users":[1,2],"expires":20000}`,
+		"b":       `{"users":[2,3],"expires":15000}`,
+		"crashed": `{"users":[4],"expires":9000}`,
+		"invalid": `not json`,
+	}, now)
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	if len(users) != 4 || users[0] != 1 || users[1] != 2 || users[2] != 2 || users[3] != 3 {
+		t.Fatalf("users = %v, want the users of the live instances", users)
+	}
+	sort.Strings(expired)
+	if len(expired) != 2 || expired[0] != "crashed" || expired[1] != "invalid" {
+		t.Fatalf("expired = %v", expired)
+	}
+}
@@ -0,0 +1,14 @@
+package conf
+
+// CaptchaConfig holds the secret of the captcha provider, the provider and
+// the endpoints are instance settings. The secret is kept out of the database
+// so admins can not read it back and backups do not carry it.
+type CaptchaConfig struct {
+	Secret string `yaml:"secret" hc:"sent to the captcha provider chosen in the instance settings to verify the captcha" env:"CAPTCHA_SECRET"`
+}
+
+func DefaultCaptchaConfig() CaptchaConfig {
+	return CaptchaConfig{
+		Secret: "",
+	}
+}
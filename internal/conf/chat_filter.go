@@ -0,0 +1,19 @@
+package conf
+
+type ChatFilterConfig struct {
+	BlockedWords []string `yaml:"blocked_words" hc:"drop or mask chat messages containing these words, matched case insensitively" env:"CHAT_FILTER_BLOCKED_WORDS"`
+	BlockLinks   bool     `yaml:"block_links" lc:"default: false" hc:"drop or mask links in chat messages" env:"CHAT_FILTER_BLOCK_LINKS"`
+	RepeatLimit  int64    `yaml:"repeat_limit" hc:"how many times in a row a user may send the same message, 0 for unlimited" env:"CHAT_FILTER_REPEAT_LIMIT"`
+	Action       string   `yaml:"action" lc:"default: drop" hc:"what to do with matching messages, can be set: drop | replace | mute" env:"CHAT_FILTER_ACTION"`
+	MuteFor      string   `yaml:"mute_for" hc:"how long the mute action mutes the sender, e.g. 10m" env:"CHAT_FILTER_MUTE_FOR"`
+}
+
+func DefaultChatFilterConfig() ChatFilterConfig {
+	return ChatFilterConfig{
+		BlockedWords: nil,
+		BlockLinks:   false,
+		RepeatLimit:  0,
+		Action:       "drop",
+		MuteFor:      "10m",
+	}
+}
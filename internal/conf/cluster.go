@@ -0,0 +1,13 @@
+package conf
+
+type ClusterConfig struct {
+	Redis    string `yaml:"redis" hc:"redis url such as redis://:password@localhost:6379/0 shared by the instances serving the same rooms behind a load balancer, empty runs a single instance" env:"CLUSTER_REDIS"`
+	Instance string `yaml:"instance" hc:"unique name of this instance in the cluster, random when empty" env:"CLUSTER_INSTANCE"`
+}
+
+func DefaultClusterConfig() ClusterConfig {
+	return ClusterConfig{
+		Redis:    "",
+		Instance: "",
+	}
+}
@@ -6,11 +6,14 @@ import (
 
 type Config struct {
 	// Log
-	Log LogConfig `yaml:"log"`
+	Log LogConfig `yaml:"log" reload:""`
 
 	// Server
 	Server ServerConfig `yaml:"server"`
 
+	// Cors
+	Cors CorsConfig `yaml:"cors"`
+
 	// Jwt
 	Jwt JwtConfig `yaml:"jwt"`
 
@@ -18,19 +21,58 @@ type Config struct {
 	Rtmp RtmpConfig `yaml:"rtmp" hc:"you can use rtmp to publish live"`
 
 	// Proxy
-	Proxy ProxyConfig `yaml:"proxy" hc:"you can use proxy to proxy movie and live when custom headers or network is slow to connect to origin server"`
+	Proxy ProxyConfig `yaml:"proxy" reload:"" hc:"you can use proxy to proxy movie and live when custom headers or network is slow to connect to origin server"`
+
+	// User
+	User UserConfig `yaml:"user"`
+
+	// Email
+	Email EmailConfig `yaml:"email"`
 
 	// Room
 	Room RoomConfig `yaml:"room"`
 
+	// Probe
+	Probe ProbeConfig `yaml:"probe"`
+
+	// FFmpeg
+	FFmpeg FFmpegConfig `yaml:"ffmpeg"`
+
+	// Subtitle
+	Subtitle SubtitleConfig `yaml:"subtitle"`
+
+	// Storage
+	Storage StorageConfig `yaml:"storage"`
+
+	// ChatFilter
+	ChatFilter ChatFilterConfig `yaml:"chat_filter" hc:"filters the chat of every room, before the filters of the room"`
+
 	// Database
 	Database DatabaseConfig `yaml:"database"`
 
 	// OAuth2
-	OAuth2 OAuth2Config `yaml:"oauth2"`
+	OAuth2 OAuth2Config `yaml:"oauth2" reload:""`
 
 	// RateLimit
-	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" reload:""`
+
+	// Terms
+	Terms TermsConfig `yaml:"terms"`
+
+	// Captcha
+	Captcha CaptchaConfig `yaml:"captcha" reload:""`
+
+	// Metrics
+	Metrics MetricsConfig `yaml:"metrics"`
+
+	// Tracing
+	Tracing TracingConfig `yaml:"tracing"`
+
+	// Cluster
+	Cluster ClusterConfig `yaml:"cluster" hc:"run several instances sharing the rooms"`
+
+	// Voice
+	Voice VoiceConfig `yaml:"voice" hc:"the voice channels of the rooms, their audio goes through the server"`
 }
 
 func (c *Config) Save(file string) error {
@@ -45,6 +87,9 @@ func DefaultConfig() *Config {
 		// Server
 		Server: DefaultServerConfig(),
 
+		// Cors
+		Cors: DefaultCorsConfig(),
+
 		// Jwt
 		Jwt: DefaultJwtConfig(),
 
@@ -54,9 +99,30 @@ func DefaultConfig() *Config {
 		// Proxy
 		Proxy: DefaultProxyConfig(),
 
+		// User
+		User: DefaultUserConfig(),
+
+		// Email
+		Email: DefaultEmailConfig(),
+
 		// Room
 		Room: DefaultRoomConfig(),
 
+		// Probe
+		Probe: DefaultProbeConfig(),
+
+		// FFmpeg
+		FFmpeg: DefaultFFmpegConfig(),
+
+		// Subtitle
+		Subtitle: DefaultSubtitleConfig(),
+
+		// Storage
+		Storage: DefaultStorageConfig(),
+
+		// ChatFilter
+		ChatFilter: DefaultChatFilterConfig(),
+
 		// Database
 		Database: DefaultDatabaseConfig(),
 
@@ -65,5 +131,23 @@ func DefaultConfig() *Config {
 
 		// RateLimit
 		RateLimit: DefaultRateLimitConfig(),
+
+		// Terms
+		Terms: DefaultTermsConfig(),
+
+		// Captcha
+		Captcha: DefaultCaptchaConfig(),
+
+		// Metrics
+		Metrics: DefaultMetricsConfig(),
+
+		// Tracing
+		Tracing: DefaultTracingConfig(),
+
+		// Cluster
+		Cluster: DefaultClusterConfig(),
+
+		// Voice
+		Voice: DefaultVoiceConfig(),
 	}
 }
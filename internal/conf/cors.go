@@ -0,0 +1,15 @@
+package conf
+
+type CorsConfig struct {
+	AllowOrigins     []string `yaml:"allow_origins" hc:"origins allowed to call the api from another site, such as https://example.com, * allows any, empty allows none but the instance itself" env:"CORS_ALLOW_ORIGINS"`
+	AllowCredentials bool     `yaml:"allow_credentials" hc:"let the allowed origins send cookies, can not be used with *" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           string   `yaml:"max_age" lc:"default: 12h" hc:"how long browsers cache a preflight" env:"CORS_MAX_AGE"`
+}
+
+func DefaultCorsConfig() CorsConfig {
+	return CorsConfig{
+		AllowOrigins:     []string{},
+		AllowCredentials: false,
+		MaxAge:           "12h",
+	}
+}
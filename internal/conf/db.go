@@ -15,13 +15,14 @@ type DatabaseConfig struct {
 	User     string       `yaml:"user" env:"DATABASE_USER"`
 	Password string       `yaml:"password" env:"DATABASE_PASSWORD"`
 	DBName   string       `yaml:"db_name" lc:"default: synctv" hc:"when type is sqlite3, it will use sqlite db file or memory" env:"DATABASE_DB_NAME"`
-	SslMode  string       `yaml:"ssl_mode" env:"DATABASE_SSL_MODE"`
+	SslMode  string       `yaml:"ssl_mode" lc:"default: disable" hc:"postgres sslmode, mapped to the tls option of mysql" env:"DATABASE_SSL_MODE"`
 
 	CustomDSN string `yaml:"custom_dsn" hc:"when not empty, it will ignore other config" env:"DATABASE_CUSTOM_DSN"`
 
 	MaxIdleConns    int    `yaml:"max_idle_conns" lc:"default: 4" hc:"the maximum number of connections in the idle connection pool." env:"DATABASE_MAX_IDLE_CONNS"`
 	MaxOpenConns    int    `yaml:"max_open_conns" lc:"default: 64" hc:"the maximum number of open connections to the database." env:"DATABASE_MAX_OPEN_CONNS"`
 	ConnMaxLifetime string `yaml:"conn_max_lifetime" lc:"default: 1h" hc:"maximum amount of time a connection may be reused." env:"DATABASE_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime string `yaml:"conn_max_idle_time" lc:"default: 10m" hc:"maximum amount of time a connection may be idle, 0 keeps idle connections open." env:"DATABASE_CONN_MAX_IDLE_TIME"`
 }
 
 func DefaultDatabaseConfig() DatabaseConfig {
@@ -34,5 +35,6 @@ func DefaultDatabaseConfig() DatabaseConfig {
 		MaxIdleConns:    4,
 		MaxOpenConns:    64,
 		ConnMaxLifetime: "1h",
+		ConnMaxIdleTime: "10m",
 	}
 }
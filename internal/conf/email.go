@@ -0,0 +1,23 @@
+package conf
+
+type EmailConfig struct {
+	Enable   bool   `yaml:"enable" lc:"default: false" hc:"send verification and password reset emails over smtp" env:"EMAIL_ENABLE"`
+	Host     string `yaml:"host" env:"EMAIL_HOST"`
+	Port     uint16 `yaml:"port" lc:"default: 587" hc:"port 465 uses implicit tls, other ports use starttls when the server offers it" env:"EMAIL_PORT"`
+	Username string `yaml:"username" env:"EMAIL_USERNAME"`
+	Password string `yaml:"password" env:"EMAIL_PASSWORD"`
+	From     string `yaml:"from" hc:"the sender address, defaults to username" env:"EMAIL_FROM"`
+	BaseURL  string `yaml:"base_url" hc:"the public url of synctv, links in emails start with it" env:"EMAIL_BASE_URL"`
+
+	RequireVerification bool   `yaml:"require_verification" lc:"default: false" hc:"password users must verify their email before they can log in" env:"EMAIL_REQUIRE_VERIFICATION"`
+	TokenExpire         string `yaml:"token_expire" lc:"default: 24h" env:"EMAIL_TOKEN_EXPIRE"`
+}
+
+func DefaultEmailConfig() EmailConfig {
+	return EmailConfig{
+		Enable:              false,
+		Port:                587,
+		RequireVerification: false,
+		TokenExpire:         "24h",
+	}
+}
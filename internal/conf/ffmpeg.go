@@ -0,0 +1,11 @@
+package conf
+
+type FFmpegConfig struct {
+	Path string `yaml:"path" hc:"ffmpeg binary for thumbnails and remuxing, empty to look it up in PATH, both are disabled without it" env:"FFMPEG_PATH"`
+}
+
+func DefaultFFmpegConfig() FFmpegConfig {
+	return FFmpegConfig{
+		Path: "",
+	}
+}
@@ -6,12 +6,17 @@ import (
 
 type JwtConfig struct {
 	Secret string `yaml:"secret" env:"JWT_SECRET"`
-	Expire string `yaml:"expire" env:"JWT_EXPIRE"`
+	Expire string `yaml:"expire" hc:"lifetime of room tokens" env:"JWT_EXPIRE"`
+	// AccessExpire is short, clients renew user tokens with their refresh token
+	AccessExpire  string `yaml:"access_expire" lc:"default: 15m" hc:"lifetime of user tokens" env:"JWT_ACCESS_EXPIRE"`
+	RefreshExpire string `yaml:"refresh_expire" lc:"default: 720h" hc:"lifetime of refresh tokens, a refresh token is replaced each time it is used" env:"JWT_REFRESH_EXPIRE"`
 }
 
 func DefaultJwtConfig() JwtConfig {
 	return JwtConfig{
-		Secret: utils.RandString(32),
-		Expire: "12h",
+		Secret:        utils.RandString(32),
+		Expire:        "12h",
+		AccessExpire:  "15m",
+		RefreshExpire: "720h",
 	}
 }
@@ -2,6 +2,7 @@ package conf
 
 type LogConfig struct {
 	Enable     bool   `yaml:"enable" env:"LOG_ENABLE"`
+	Level      string `yaml:"level" lc:"default: info" hc:"can be set: debug | info | warn | error, dev mode always logs debug" env:"LOG_LEVEL"`
 	LogFormat  string `yaml:"log_format" hc:"can be set: text | json" env:"LOG_FORMAT"`
 	FilePath   string `yaml:"file_path" hc:"if it is a relative path, the data-dir directory will be used." env:"LOG_FILE_PATH"`
 	MaxSize    int    `yaml:"max_size" cm:"mb" hc:"max size per log file" env:"LOG_MAX_SIZE"`
@@ -13,6 +14,7 @@ type LogConfig struct {
 func DefaultLogConfig() LogConfig {
 	return LogConfig{
 		Enable:     true,
+		Level:      "info",
 		LogFormat:  "text",
 		FilePath:   "log/log.log",
 		MaxSize:    10,
@@ -0,0 +1,13 @@
+package conf
+
+type MetricsConfig struct {
+	Enable bool   `yaml:"enable" lc:"default: false" hc:"serve prometheus metrics on /metrics" env:"METRICS_ENABLE"`
+	Token  string `yaml:"token" hc:"bearer token scrapers must send, empty leaves /metrics open to anyone reaching the server" env:"METRICS_TOKEN"`
+}
+
+func DefaultMetricsConfig() MetricsConfig {
+	return MetricsConfig{
+		Enable: false,
+		Token:  "",
+	}
+}
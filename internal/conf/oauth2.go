@@ -7,15 +7,22 @@ import (
 type OAuth2Config map[provider.OAuth2Provider]OAuth2ProviderConfig
 
 type OAuth2ProviderConfig struct {
-	ClientID     string `yaml:"client_id"`
-	ClientSecret string `yaml:"client_secret"`
+	ClientID         string                    `yaml:"client_id"`
+	ClientSecret     string                    `yaml:"client_secret"`
+	RedirectURL      string                    `yaml:"redirect_url" hc:"the callback registered with the provider, e.g. https://example.com/oauth2/callback/github, empty for the one registered as default"`
+	Issuer           string                    `yaml:"issuer" hc:"the OpenID Connect issuer url, only used by the oidc provider, e.g. https://accounts.example.com"`
+	UsernameFallback provider.UsernameFallback `yaml:"username_fallback" lc:"default: provider" hc:"used when the provider returns no usable username, can be set: email | provider | random"`
+	// Linking by email lets anyone controlling the email take over the account,
+	// so only enable it for providers that verify emails.
+	MergeByVerifiedEmail bool `yaml:"merge_by_verified_email" lc:"default: false" hc:"link this provider to an existing account with the same verified email"`
 }
 
 func DefaultOAuth2Config() OAuth2Config {
 	return OAuth2Config{
 		(&provider.GithubProvider{}).Provider(): {
-			ClientID:     "github_client_id",
-			ClientSecret: "github_client_secret",
+			ClientID:         "github_client_id",
+			ClientSecret:     "github_client_secret",
+			UsernameFallback: provider.UsernameFallbackProvider,
 		},
 	}
 }
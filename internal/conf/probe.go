@@ -0,0 +1,13 @@
+package conf
+
+type ProbeConfig struct {
+	Enable  bool `yaml:"enable" hc:"probe pushed movies for their duration, resolution, codec and a thumbnail" env:"PROBE_ENABLE"`
+	Workers int  `yaml:"workers" hc:"movies probed at the same time" env:"PROBE_WORKERS"`
+}
+
+func DefaultProbeConfig() ProbeConfig {
+	return ProbeConfig{
+		Enable:  true,
+		Workers: 2,
+	}
+}
@@ -1,13 +1,31 @@
 package conf
 
 type ProxyConfig struct {
-	MovieProxy bool `yaml:"movie_proxy" env:"PROXY_MOVIE"`
-	LiveProxy  bool `yaml:"live_proxy" env:"PROXY_LIVE"`
+	MovieProxy bool   `yaml:"movie_proxy" env:"PROXY_MOVIE"`
+	LiveProxy  bool   `yaml:"live_proxy" env:"PROXY_LIVE"`
+	Remux      bool   `yaml:"remux" hc:"remux proxied sources browsers can't play, such as rtsp and mkv, with ffmpeg" env:"PROXY_REMUX"`
+	MaxRemux   int    `yaml:"max_remux" hc:"max movies remuxed for viewers at once, each one is an ffmpeg process, 0 is unlimited" env:"PROXY_MAX_REMUX"`
+	CachePath  string `yaml:"cache_path" hc:"cache proxied movies on disk in this directory so viewers share the bytes fetched from the origin, empty disables the cache" env:"PROXY_CACHE_PATH"`
+	CacheSize  int64  `yaml:"cache_size" hc:"max size of the cache in MiB, the least recently used chunks are evicted" env:"PROXY_CACHE_SIZE"`
+
+	ConnectionBandwidth int64 `yaml:"connection_bandwidth" hc:"max KiB per second sent to a single proxied connection, 0 is unlimited" env:"PROXY_CONNECTION_BANDWIDTH"`
+	RoomBandwidth       int64 `yaml:"room_bandwidth" hc:"max KiB per second sent to all proxied connections of a room, 0 is unlimited" env:"PROXY_ROOM_BANDWIDTH"`
+
+	SignedURLExpire string `yaml:"signed_url_expire" lc:"default: 0" hc:"lifetime of the signed urls of proxied movies, a url also stops working with the room token it was issued to or when its user logs out, 0 serves proxied movies to anyone knowing their pull key. Only enable it with clients loading the proxied movies from /api/movie/proxyUrl" env:"PROXY_SIGNED_URL_EXPIRE"`
 }
 
 func DefaultProxyConfig() ProxyConfig {
 	return ProxyConfig{
 		MovieProxy: true,
 		LiveProxy:  true,
+		Remux:      true,
+		MaxRemux:   8,
+		CachePath:  "",
+		CacheSize:  1024,
+
+		ConnectionBandwidth: 0,
+		RoomBandwidth:       0,
+
+		SignedURLExpire: "0",
 	}
 }
@@ -4,8 +4,13 @@ type RateLimitConfig struct {
 	Enable                bool   `yaml:"enable" lc:"default: false" env:"SERVER_RATE_LIMIT_ENABLE"`
 	Period                string `yaml:"period" env:"SERVER_RATE_LIMIT_PERIOD"`
 	Limit                 int64  `yaml:"limit" env:"SERVER_RATE_LIMIT_LIMIT"`
-	TrustForwardHeader    bool   `yaml:"trust_forward_header" lc:"default: false" hc:"configure the limiter to trust X-Real-IP and X-Forwarded-For headers. Please be advised that using this option could be insecure (ie: spoofed) if your reverse proxy is not configured properly to forward a trustworthy client IP." env:"SERVER_TRUST_FORWARD_HEADER"`
-	TrustedClientIPHeader string `yaml:"trusted_client_ip_header" hc:"configure the limiter to use a custom header to obtain user IP. Please be advised that using this option could be insecure (ie: spoofed) if your reverse proxy is not configured properly to forward a trustworthy client IP." env:"SERVER_TRUSTED_CLIENT_IP_HEADER"`
+	LoginPeriod           string `yaml:"login_period" env:"SERVER_RATE_LIMIT_LOGIN_PERIOD"`
+	LoginLimit            int64  `yaml:"login_limit" hc:"requests of each ip per login period to the login, signup and password endpoints, 0 for no limit" env:"SERVER_RATE_LIMIT_LOGIN_LIMIT"`
+	UserPeriod            string `yaml:"user_period" env:"SERVER_RATE_LIMIT_USER_PERIOD"`
+	UserLimit             int64  `yaml:"user_limit" hc:"requests of each signed in user per user period, 0 for no limit" env:"SERVER_RATE_LIMIT_USER_LIMIT"`
+	Redis                 string `yaml:"redis" hc:"redis url such as redis://:password@localhost:6379/0 to share the limits between instances, empty keeps them in memory" env:"SERVER_RATE_LIMIT_REDIS"`
+	TrustForwardHeader    bool   `yaml:"trust_forward_header" lc:"default: false" hc:"deprecated, use server.trusted_proxies, when no proxy is set there it trusts the X-Real-IP and X-Forwarded-For headers of every request, which anyone can spoof" env:"SERVER_TRUST_FORWARD_HEADER"`
+	TrustedClientIPHeader string `yaml:"trusted_client_ip_header" hc:"deprecated, use server.trusted_proxies, reads the client ip from this header of every request, only set it when the server can not be reached but through a proxy setting it, such as CF-Connecting-IP" env:"SERVER_TRUSTED_CLIENT_IP_HEADER"`
 }
 
 func DefaultRateLimitConfig() RateLimitConfig {
@@ -13,6 +18,11 @@ func DefaultRateLimitConfig() RateLimitConfig {
 		Enable:                false,
 		Period:                "1m",
 		Limit:                 300,
+		LoginPeriod:           "1m",
+		LoginLimit:            10,
+		UserPeriod:            "1m",
+		UserLimit:             600,
+		Redis:                 "",
 		TrustForwardHeader:    false,
 		TrustedClientIPHeader: "",
 	}
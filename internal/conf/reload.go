@@ -0,0 +1,84 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrReloadUnsupported = errors.New("config reload is not set up")
+
+// ReloadFunc applies the changes from old to new to a running subsystem, it
+// may set back in new the values it can not apply
+type ReloadFunc func(old, new *Config) error
+
+var (
+	reloadLock sync.Mutex
+	loader     func() (*Config, error)
+	reloaders  = map[string]ReloadFunc{}
+)
+
+// SetLoader sets how Reload reads the config, the bootstrap sets the one
+// reading the config file and the env
+func SetLoader(load func() (*Config, error)) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	loader = load
+}
+
+// OnReload registers f as the reloader of name, replacing any previous one
+func OnReload(name string, f ReloadFunc) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	reloaders[name] = f
+}
+
+// Reload reads the config again and sets it as the running config. The
+// sections of Config tagged reload are applied by the reloaders, changes to
+// the others need a restart and keep their running values. It returns the errors of the
+// reloaders, the sections they failed to apply may be partly applied.
+func Reload() error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	if loader == nil {
+		return ErrReloadUnsupported
+	}
+	next, err := loader()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	old := Conf()
+	for _, section := range keepStatic(old, next) {
+		log.Warnf("config: %s changed, restart to apply it", section)
+	}
+	var errs []error
+	for name, f := range reloaders {
+		if err := f(old, next); err != nil {
+			errs = append(errs, fmt.Errorf("reload %s: %w", name, err))
+		}
+	}
+	Set(next)
+	log.Info("config reloaded")
+	return errors.Join(errs...)
+}
+
+// keepStatic copies the sections of old not tagged reload into next, and
+// returns the yaml names of the ones that differed
+func keepStatic(old, next *Config) []string {
+	var changed []string
+	ov, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem()
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := t.Field(i).Tag.Lookup("reload"); ok {
+			continue
+		}
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, t.Field(i).Tag.Get("yaml"))
+			nv.Field(i).Set(ov.Field(i))
+		}
+	}
+	return changed
+}
@@ -0,0 +1,52 @@
+package conf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	Set(DefaultConfig())
+	defer func() {
+		Set(DefaultConfig())
+		SetLoader(nil)
+		reloaders = map[string]ReloadFunc{}
+	}()
+	if err := Reload(); !errors.Is(err, ErrReloadUnsupported) {
+		t.Fatalf("Reload() without loader = %v, want ErrReloadUnsupported", err)
+	}
+
+	SetLoader(func() (*Config, error) {
+		c := DefaultConfig()
+		c.Log.Level = "debug"
+		c.RateLimit.Limit = 1
+		c.Server.Port = 9090
+		return c, nil
+	})
+	var seen string
+	OnReload("log", func(old, new *Config) error {
+		seen = old.Log.Level + "->" + new.Log.Level
+		return nil
+	})
+	failed := errors.New("rate limit failed")
+	OnReload("rate_limit", func(old, new *Config) error {
+		new.RateLimit = old.RateLimit
+		return failed
+	})
+
+	if err := Reload(); !errors.Is(err, failed) {
+		t.Fatalf("Reload() = %v, want the error of the reloader", err)
+	}
+	if seen != "info->debug" {
+		t.Errorf("log reloader saw %q", seen)
+	}
+	if Conf().Log.Level != "debug" {
+		t.Errorf("log level = %s, want the reloaded debug", Conf().Log.Level)
+	}
+	if Conf().RateLimit.Limit != DefaultRateLimitConfig().Limit {
+		t.Errorf("rate limit = %d, want the running one kept by its reloader", Conf().RateLimit.Limit)
+	}
+	if Conf().Server.Port != DefaultServerConfig().Port {
+		t.Errorf("port = %d, changes to static sections need a restart", Conf().Server.Port)
+	}
+}
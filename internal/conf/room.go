@@ -1,11 +1,25 @@
 package conf
 
 type RoomConfig struct {
-	MustPassword bool `yaml:"must_password" hc:"must input password to create room" env:"ROOM_MUST_PASSWORD"`
+	MustPassword     bool   `yaml:"must_password" hc:"must input password to create room" env:"ROOM_MUST_PASSWORD"`
+	MinAccountAge    string `yaml:"min_account_age" hc:"minimum account age to create room, e.g. 24h, 0 to disable" env:"ROOM_MIN_ACCOUNT_AGE"`
+	HibernateAfter   string `yaml:"hibernate_after" hc:"unload rooms without clients from memory after this long, e.g. 30m, 0 to disable" env:"ROOM_HIBERNATE_AFTER"`
+	TTL              string `yaml:"ttl" hc:"delete rooms without clients for this long, e.g. 720h, 0 to disable" env:"ROOM_TTL"`
+	DeletedRetention string `yaml:"deleted_retention" hc:"purge soft deleted rooms after this long, e.g. 168h, 0 to keep forever" env:"ROOM_DELETED_RETENTION"`
+	SaveStateEvery   string `yaml:"save_state_every" hc:"save the playback position of rooms this often to resume after restart, e.g. 30s, 0 to save only on hibernate and exit" env:"ROOM_SAVE_STATE_EVERY"`
+	ChatMaxMessages  int    `yaml:"chat_max_messages" hc:"keep the newest chat messages of each room up to this many, 0 to keep all" env:"ROOM_CHAT_MAX_MESSAGES"`
+	ChatMaxAge       string `yaml:"chat_max_age" hc:"delete chat messages older than this, e.g. 720h, 0 to keep forever" env:"ROOM_CHAT_MAX_AGE"`
 }
 
 func DefaultRoomConfig() RoomConfig {
 	return RoomConfig{
-		MustPassword: false,
+		MustPassword:     false,
+		MinAccountAge:    "0",
+		HibernateAfter:   "0",
+		TTL:              "0",
+		DeletedRetention: "168h",
+		SaveStateEvery:   "30s",
+		ChatMaxMessages:  1000,
+		ChatMaxAge:       "0",
 	}
 }
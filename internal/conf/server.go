@@ -7,6 +7,13 @@ type ServerConfig struct {
 
 	CertPath string `yaml:"cert_path" env:"SERVER_CERT_PATH"`
 	KeyPath  string `yaml:"key_path" env:"SERVER_KEY_PATH"`
+
+	TrustedProxies  []string `yaml:"trusted_proxies" hc:"ips or cidrs of the reverse proxies in front of the server, such as 127.0.0.1 or 10.0.0.0/8, the client ip is read from the headers below only when the request comes from one of them" env:"SERVER_TRUSTED_PROXIES"`
+	RemoteIPHeaders []string `yaml:"remote_ip_headers" hc:"headers the trusted proxies put the client ip in, the first one set wins" env:"SERVER_REMOTE_IP_HEADERS"`
+	AllowIPs        []string `yaml:"allow_ips" hc:"ips or cidrs of the clients allowed to connect, empty allows everyone" env:"SERVER_ALLOW_IPS"`
+	DenyIPs         []string `yaml:"deny_ips" hc:"ips or cidrs of the clients refused, even when allowed above" env:"SERVER_DENY_IPS"`
+
+	ShutdownTimeout string `yaml:"shutdown_timeout" lc:"default: 30s" hc:"on exit, time given to the clients to disconnect and to the requests to finish before they are cut" env:"SERVER_SHUTDOWN_TIMEOUT"`
 }
 
 func DefaultServerConfig() ServerConfig {
@@ -16,5 +23,12 @@ func DefaultServerConfig() ServerConfig {
 		Quic:     true,
 		CertPath: "",
 		KeyPath:  "",
+
+		TrustedProxies:  []string{},
+		RemoteIPHeaders: []string{"X-Forwarded-For", "X-Real-IP"},
+		AllowIPs:        []string{},
+		DenyIPs:         []string{},
+
+		ShutdownTimeout: "30s",
 	}
 }
@@ -0,0 +1,11 @@
+package conf
+
+type StorageConfig struct {
+	Path string `yaml:"path" hc:"directory user uploads such as avatars are kept in, empty disables uploads" env:"STORAGE_PATH"`
+}
+
+func DefaultStorageConfig() StorageConfig {
+	return StorageConfig{
+		Path: "storage",
+	}
+}
@@ -0,0 +1,13 @@
+package conf
+
+type SubtitleConfig struct {
+	Path    string `yaml:"path" hc:"directory uploaded subtitles are kept in, empty disables subtitle uploads" env:"SUBTITLE_PATH"`
+	MaxSize int64  `yaml:"max_size" hc:"max size of an uploaded subtitle in KiB" env:"SUBTITLE_MAX_SIZE"`
+}
+
+func DefaultSubtitleConfig() SubtitleConfig {
+	return SubtitleConfig{
+		Path:    "subtitles",
+		MaxSize: 2048,
+	}
+}
@@ -0,0 +1,15 @@
+package conf
+
+type TermsConfig struct {
+	Enable  bool   `yaml:"enable" lc:"default: false" hc:"users must accept the terms before creating or joining a room" env:"TERMS_ENABLE"`
+	Version string `yaml:"version" hc:"change it to ask every user to accept the terms again" env:"TERMS_VERSION"`
+	Url     string `yaml:"url" hc:"where users can read the terms" env:"TERMS_URL"`
+}
+
+func DefaultTermsConfig() TermsConfig {
+	return TermsConfig{
+		Enable:  false,
+		Version: "1",
+		Url:     "",
+	}
+}
@@ -0,0 +1,19 @@
+package conf
+
+type TracingConfig struct {
+	Enable      bool    `yaml:"enable" lc:"default: false" hc:"export opentelemetry traces of requests, room operations and database queries" env:"TRACING_ENABLE"`
+	Endpoint    string  `yaml:"endpoint" lc:"default: localhost:4318" hc:"otlp http endpoint of the collector, host:port" env:"TRACING_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" lc:"default: false" hc:"send traces over http instead of https" env:"TRACING_INSECURE"`
+	ServiceName string  `yaml:"service_name" lc:"default: synctv" env:"TRACING_SERVICE_NAME"`
+	SampleRatio float64 `yaml:"sample_ratio" lc:"default: 1" hc:"ratio of the traces started here that are sampled, from 0 to 1" env:"TRACING_SAMPLE_RATIO"`
+}
+
+func DefaultTracingConfig() TracingConfig {
+	return TracingConfig{
+		Enable:      false,
+		Endpoint:    "localhost:4318",
+		Insecure:    false,
+		ServiceName: "synctv",
+		SampleRatio: 1,
+	}
+}
@@ -0,0 +1,30 @@
+package conf
+
+type UserConfig struct {
+	DisableSignup     bool `yaml:"disable_signup" lc:"default: false" hc:"reject new accounts with a username and password, oauth2 logins still create accounts" env:"USER_DISABLE_SIGNUP"`
+	MinPasswordLength int  `yaml:"min_password_length" lc:"default: 8" env:"USER_MIN_PASSWORD_LENGTH"`
+	// AdminRequireTwoFactor is recommended on public instances
+	AdminRequireTwoFactor bool   `yaml:"admin_require_two_factor" lc:"default: false" hc:"admins must enable two factor authentication before they can use the admin api" env:"USER_ADMIN_REQUIRE_TWO_FACTOR"`
+	AvatarMaxSize         int64  `yaml:"avatar_max_size" lc:"default: 512" hc:"max size of an uploaded avatar in KiB" env:"USER_AVATAR_MAX_SIZE"`
+	RenameCooldown        string `yaml:"rename_cooldown" lc:"default: 720h" hc:"time a user must wait between two username changes, 0 for no limit" env:"USER_RENAME_COOLDOWN"`
+	DeletionDelay         string `yaml:"deletion_delay" lc:"default: 168h" hc:"time before a deleted account is purged, it can be restored until then, 0 purges at once" env:"USER_DELETION_DELAY"`
+	RequireApproval       bool   `yaml:"require_approval" lc:"default: false" hc:"new accounts can't create or join rooms until an admin approves them" env:"USER_REQUIRE_APPROVAL"`
+	LockoutThreshold      int64  `yaml:"lockout_threshold" lc:"default: 5" hc:"failed logins of an ip or account before it is locked out, 0 disables the lockout" env:"USER_LOCKOUT_THRESHOLD"`
+	LockoutDuration       string `yaml:"lockout_duration" lc:"default: 1m" hc:"first lockout, each further failed login doubles it" env:"USER_LOCKOUT_DURATION"`
+	LockoutMaxDuration    string `yaml:"lockout_max_duration" lc:"default: 1h" env:"USER_LOCKOUT_MAX_DURATION"`
+}
+
+func DefaultUserConfig() UserConfig {
+	return UserConfig{
+		DisableSignup:         false,
+		MinPasswordLength:     8,
+		AdminRequireTwoFactor: false,
+		AvatarMaxSize:         512,
+		RenameCooldown:        "720h",
+		DeletionDelay:         "168h",
+		RequireApproval:       false,
+		LockoutThreshold:      5,
+		LockoutDuration:       "1m",
+		LockoutMaxDuration:    "1h",
+	}
+}
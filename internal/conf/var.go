@@ -1,5 +1,16 @@
 package conf
 
-var (
-	Conf *Config
-)
+import "sync/atomic"
+
+var current atomic.Pointer[Config]
+
+// Conf returns the running config. Reload replaces it with a new one
+// instead of changing it, so a config read once stays consistent.
+func Conf() *Config {
+	return current.Load()
+}
+
+// Set makes c the running config
+func Set(c *Config) {
+	current.Store(c)
+}
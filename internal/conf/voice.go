@@ -0,0 +1,19 @@
+package conf
+
+type VoiceConfig struct {
+	MaxParticipants int      `yaml:"max_participants" hc:"max users in the voice channel of a room, the server forwards the audio of each one to every other one" env:"VOICE_MAX_PARTICIPANTS"`
+	ICEServers      []string `yaml:"ice_servers" hc:"stun or turn urls the server gathers its candidates with, such as stun:stun.l.google.com:19302" env:"VOICE_ICE_SERVERS"`
+	PublicIPs       []string `yaml:"public_ips" hc:"public ips of the server behind a 1:1 nat, announced to the clients instead of the local ones" env:"VOICE_PUBLIC_IPS"`
+	UDPPortMin      uint16   `yaml:"udp_port_min" hc:"first udp port of the voice media, 0 picks any port" env:"VOICE_UDP_PORT_MIN"`
+	UDPPortMax      uint16   `yaml:"udp_port_max" hc:"last udp port of the voice media" env:"VOICE_UDP_PORT_MAX"`
+}
+
+func DefaultVoiceConfig() VoiceConfig {
+	return VoiceConfig{
+		MaxParticipants: 16,
+		ICEServers:      []string{},
+		PublicIPs:       []string{},
+		UDPPortMin:      0,
+		UDPPortMax:      0,
+	}
+}
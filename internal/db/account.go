@@ -0,0 +1,198 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+)
+
+// ScheduleUserDeletion marks the user to be purged at t, see PurgeUser
+func ScheduleUserDeletion(userID uint, t time.Time) error {
+	res := db.Model(&model.User{}).Where("id = ?", userID).Update("deletion_scheduled_at", t)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+func CancelUserDeletion(userID uint) error {
+	res := db.Model(&model.User{}).Where("id = ? AND deletion_scheduled_at IS NOT NULL", userID).Update("deletion_scheduled_at", nil)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("user deletion is not scheduled")
+	}
+	return nil
+}
+
+// GetUserIDsDueForDeletion returns the users whose deletion is scheduled before t
+func GetUserIDsDueForDeletion(t time.Time) ([]uint, error) {
+	var ids []uint
+	err := db.Model(&model.User{}).Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", t).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// GetAllRoomIDsByUserID returns the rooms created by the user, soft deleted ones included
+func GetAllRoomIDsByUserID(userID uint) ([]string, error) {
+	var ids []string
+	err := db.Unscoped().Model(&model.Room{}).Where("creator_id = ?", userID).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// GetMovieRoomIDsByCreator returns the rooms the user added movies to
+func GetMovieRoomIDsByCreator(userID uint) ([]string, error) {
+	var ids []string
+	err := db.Model(&model.Movie{}).Distinct("room_id").Where("creator_id = ?", userID).Pluck("room_id", &ids).Error
+	return ids, err
+}
+
+// PurgeUser deletes the user and everything of it in one transaction.
+// Rows that only reference the user without a foreign key are deleted
+// explicitly, so the purge does not depend on the constraints of old tables.
+// The rooms created by the user are deleted with their contents, movies and
+// subtitles the user added to other rooms are kept and given to the creator
+// of the room. It returns the deleted subtitles, whose files have to be
+// deleted after the transaction.
+func PurgeUser(userID uint) ([]*model.Subtitle, error) {
+	subtitles := []*model.Subtitle{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var roomIDs []string
+		if err := tx.Unscoped().Model(&model.Room{}).Where("creator_id = ?", userID).Pluck("id", &roomIDs).Error; err != nil {
+			return err
+		}
+		if len(roomIDs) != 0 {
+			if err := deleteReturning(tx.Unscoped().Where("room_id IN ?", roomIDs), &subtitles); err != nil {
+				return err
+			}
+			for _, m := range []any{
+				&model.ChatMessage{},
+				&model.ChatReadState{},
+				&model.Danmaku{},
+				&model.Movie{},
+				&model.RoomUserRelation{},
+				&model.RoomState{},
+				&model.RoomInvite{},
+				&model.RoomEvent{},
+				&model.PermissionAudit{},
+				&model.UserFavoriteRoom{},
+			} {
+				if err := tx.Unscoped().Where("room_id IN ?", roomIDs).Delete(m).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Exec("DELETE FROM room_tags WHERE room_id IN ?", roomIDs).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("id IN ?", roomIDs).Delete(&model.Room{}).Error; err != nil {
+				return err
+			}
+		}
+
+		roomCreator := tx.Unscoped().Model(&model.Room{}).Select("creator_id").Where("rooms.id = room_id")
+		for _, m := range []any{&model.Movie{}, &model.Subtitle{}} {
+			if err := tx.Unscoped().Model(m).Where("creator_id = ?", userID).Update("creator_id", roomCreator).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, m := range []any{
+			&model.ChatMessage{},
+			&model.ChatReadState{},
+			&model.Danmaku{},
+			&model.RoomEvent{},
+			&model.UserFavoriteRoom{},
+			&model.RoomUserRelation{},
+			&model.UserProvider{},
+			&model.RecoveryCode{},
+			&model.UserSession{},
+			&model.APIKey{},
+			&model.UsernameChange{},
+		} {
+			if err := tx.Unscoped().Where("user_id = ?", userID).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Where("creator_id = ?", userID).Delete(&model.RoomInvite{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("sender_id = ? OR recipient_id = ?", userID, userID).Delete(&model.DirectMessage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("actor_id = ? OR target_id = ?", userID, userID).Delete(&model.PermissionAudit{}).Error; err != nil {
+			return err
+		}
+
+		res := tx.Unscoped().Delete(&model.User{}, userID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("user not found")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subtitles, nil
+}
+
+// UserExport is every record kept about a user
+type UserExport struct {
+	User            *model.User
+	Providers       []*model.UserProvider
+	Sessions        []*model.UserSession
+	APIKeys         []*model.APIKey
+	UsernameChanges []*model.UsernameChange
+	Rooms           []*model.Room
+	Memberships     []*model.RoomUserRelation
+	Favorites       []*model.UserFavoriteRoom
+	ChatMessages    []*model.ChatMessage
+	DirectMessages  []*model.DirectMessage
+	Danmakus        []*model.Danmaku
+	Movies          []*model.Movie
+	Subtitles       []*model.Subtitle
+}
+
+// ExportUser reads the records of the user in one transaction, soft deleted rooms included
+func ExportUser(userID uint) (*UserExport, error) {
+	e := &UserExport{User: &model.User{}}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(e.User, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("user not found")
+			}
+			return err
+		}
+		for _, q := range []struct {
+			dst   any
+			query string
+		}{
+			{&e.Providers, "user_id = @id"},
+			{&e.Sessions, "user_id = @id"},
+			{&e.APIKeys, "user_id = @id"},
+			{&e.UsernameChanges, "user_id = @id"},
+			{&e.Rooms, "creator_id = @id"},
+			{&e.Memberships, "user_id = @id"},
+			{&e.Favorites, "user_id = @id"},
+			{&e.ChatMessages, "user_id = @id"},
+			{&e.DirectMessages, "sender_id = @id OR recipient_id = @id"},
+			{&e.Danmakus, "user_id = @id"},
+			{&e.Movies, "creator_id = @id"},
+			{&e.Subtitles, "creator_id = @id"},
+		} {
+			if err := tx.Unscoped().Where(q.query, sql.Named("id", userID)).Order("created_at").Find(q.dst).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return e, err
+}
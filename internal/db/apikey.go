@@ -0,0 +1,49 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+)
+
+func CreateAPIKey(k *model.APIKey) error {
+	return db.Create(k).Error
+}
+
+func GetAPIKeysByUserID(userID uint) ([]model.APIKey, error) {
+	keys := []model.APIKey{}
+	err := db.Where("user_id = ?", userID).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+func CountAPIKeys(userID uint) (int64, error) {
+	var n int64
+	err := db.Model(&model.APIKey{}).Where("user_id = ?", userID).Count(&n).Error
+	return n, err
+}
+
+func GetAPIKeyByHash(hashedKey string) (*model.APIKey, error) {
+	k := &model.APIKey{}
+	err := db.Where("hashed_key = ?", hashedKey).First(k).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return k, errors.New("api key not found")
+	}
+	return k, err
+}
+
+func DeleteAPIKey(userID, id uint) error {
+	res := db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.APIKey{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("api key not found")
+	}
+	return nil
+}
+
+func SetAPIKeyLastUsed(id uint, t time.Time) error {
+	return db.Model(&model.APIKey{}).Where("id = ?", id).Update("last_used_at", t).Error
+}
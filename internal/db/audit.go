@@ -0,0 +1,21 @@
+package db
+
+import "github.com/synctv-org/synctv/internal/model"
+
+func CreatePermissionAudit(audit *model.PermissionAudit) error {
+	return db.Create(audit).Error
+}
+
+// GetPermissionAudits returns the newest permission changes of the room first, and the total count
+func GetPermissionAudits(roomID string, offset, limit int) ([]*model.PermissionAudit, int64, error) {
+	var (
+		audits []*model.PermissionAudit
+		total  int64
+	)
+	tx := db.Model(&model.PermissionAudit{}).Where("room_id = ?", roomID)
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Order("id DESC").Offset(offset).Limit(limit).Find(&audits).Error
+	return audits, total, err
+}
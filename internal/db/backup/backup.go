@@ -0,0 +1,293 @@
+// Package backup dumps the database to a portable archive and restores it,
+// the archive does not depend on the database type so it also moves an
+// instance from one type to another.
+//
+// The archive is a zip of manifest.json and a file of json lines per table,
+// a line holds the columns of a row by name. Uploaded files such as
+// subtitles and avatars are kept in the storage, not in the database, and
+// are not part of the archive; back up the storage path separately.
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db/migrations"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/version"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	formatVersion = 1
+	manifestName  = "manifest.json"
+	batchSize     = 500
+)
+
+var (
+	ErrInvalidArchive = errors.New("not a synctv backup")
+	ErrNewerSchema    = errors.New("backup is from a newer database schema")
+	ErrNotEmpty       = errors.New("database is not empty")
+)
+
+// Manifest describes a backup, Tables are the row counts by table
+type Manifest struct {
+	Format        int            `json:"format"`
+	SchemaVersion uint           `json:"schemaVersion"`
+	ServerVersion string         `json:"serverVersion"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	Tables        map[string]int `json:"tables"`
+}
+
+func tableFile(table string) string {
+	return "tables/" + table + ".jsonl"
+}
+
+func parse(d *gorm.DB, value any) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: d}
+	if err := stmt.Parse(value); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// snapshot is a read transaction seeing the database at one point in time,
+// sqlite transactions always do
+func snapshot(d *gorm.DB) []*sql.TxOptions {
+	if d.Dialector.Name() == "sqlite" {
+		return nil
+	}
+	return []*sql.TxOptions{{Isolation: sql.LevelRepeatableRead, ReadOnly: true}}
+}
+
+// Backup writes every table to w from a single snapshot of the database
+func Backup(ctx context.Context, d *gorm.DB, w io.Writer) (*Manifest, error) {
+	applied, err := migrations.Status(d.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) == 0 {
+		return nil, errors.New("database is not migrated")
+	}
+	m := &Manifest{
+		Format:        formatVersion,
+		SchemaVersion: applied[len(applied)-1].Version,
+		ServerVersion: version.Version,
+		CreatedAt:     time.Now(),
+		Tables:        make(map[string]int),
+	}
+	zw := zip.NewWriter(w)
+	err = d.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, t := range migrations.Tables() {
+			s, err := parse(tx, t)
+			if err != nil {
+				return err
+			}
+			f, err := create(zw, tableFile(s.Table), m.CreatedAt)
+			if err != nil {
+				return err
+			}
+			n, err := dumpTable(ctx, tx, s, f)
+			if err != nil {
+				return fmt.Errorf("backup %s: %w", s.Table, err)
+			}
+			m.Tables[s.Table] = n
+		}
+		return nil
+	}, snapshot(d)...)
+	if err != nil {
+		return nil, err
+	}
+	f, err := create(zw, manifestName, m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(f).Encode(m); err != nil {
+		return nil, err
+	}
+	return m, zw.Close()
+}
+
+func create(zw *zip.Writer, name string, modified time.Time) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+}
+
+func dumpTable(ctx context.Context, tx *gorm.DB, s *schema.Schema, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	rows := reflect.New(reflect.SliceOf(reflect.PointerTo(s.ModelType)))
+	n := 0
+	write := func(*gorm.DB, int) error {
+		list := rows.Elem()
+		for i := 0; i < list.Len(); i++ {
+			row := make(map[string]any, len(s.DBNames))
+			for _, name := range s.DBNames {
+				// the value of the struct field, ValueOf wraps serialized fields
+				row[name] = s.FieldsByDBName[name].ReflectValueOf(ctx, list.Index(i)).Interface()
+			}
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	}
+	q := tx.Unscoped().Model(reflect.New(s.ModelType).Interface())
+	if s.PrioritizedPrimaryField == nil {
+		// join tables have no single primary key to page with, they are small
+		if err := q.Find(rows.Interface()).Error; err != nil {
+			return 0, err
+		}
+		return n, write(nil, 0)
+	}
+	return n, q.FindInBatches(rows.Interface(), batchSize, write).Error
+}
+
+// ReadManifest reads the manifest of a backup
+func ReadManifest(r io.ReaderAt, size int64) (*Manifest, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	return readManifest(zr)
+}
+
+func readManifest(zr *zip.Reader) (*Manifest, error) {
+	f, err := zr.Open(manifestName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer f.Close()
+	m := &Manifest{}
+	if err := json.NewDecoder(f).Decode(m); err != nil || m.Format == 0 {
+		return nil, fmt.Errorf("%w: invalid manifest", ErrInvalidArchive)
+	}
+	if m.Format > formatVersion {
+		return nil, fmt.Errorf("%w: format %d", ErrInvalidArchive, m.Format)
+	}
+	return m, nil
+}
+
+// Restore loads a backup into a migrated database, all of it or nothing.
+// It refuses a database holding users unless replace is set, then every
+// table is emptied first.
+func Restore(ctx context.Context, d *gorm.DB, r io.ReaderAt, size int64, replace bool) (*Manifest, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	m, err := readManifest(zr)
+	if err != nil {
+		return nil, err
+	}
+	if m.SchemaVersion > migrations.Latest() {
+		return nil, fmt.Errorf("%w: version %d, this server knows up to %d", ErrNewerSchema, m.SchemaVersion, migrations.Latest())
+	}
+	tables := migrations.Tables()
+	schemas := make([]*schema.Schema, len(tables))
+	for i, t := range tables {
+		if schemas[i], err = parse(d, t); err != nil {
+			return nil, err
+		}
+	}
+	return m, d.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if replace {
+			for i := len(schemas) - 1; i >= 0; i-- {
+				if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(reflect.New(schemas[i].ModelType).Interface()).Error; err != nil {
+					return err
+				}
+			}
+		} else {
+			var users int64
+			if err := tx.Unscoped().Model(&model.User{}).Count(&users).Error; err != nil {
+				return err
+			}
+			if users != 0 {
+				return ErrNotEmpty
+			}
+		}
+		for _, s := range schemas {
+			f, err := zr.Open(tableFile(s.Table))
+			if err != nil {
+				// tables added after the backup was made stay empty
+				continue
+			}
+			err = loadTable(ctx, tx, s, f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("restore %s: %w", s.Table, err)
+			}
+		}
+		if d.Dialector.Name() == "postgres" {
+			return resetSequences(tx, schemas)
+		}
+		return nil
+	})
+}
+
+func loadTable(ctx context.Context, tx *gorm.DB, s *schema.Schema, r io.Reader) error {
+	tx = tx.Session(&gorm.Session{SkipHooks: true}).Omit(clause.Associations)
+	dec := json.NewDecoder(r)
+	rows := reflect.MakeSlice(reflect.SliceOf(reflect.PointerTo(s.ModelType)), 0, batchSize)
+	flush := func() error {
+		if rows.Len() == 0 {
+			return nil
+		}
+		err := tx.Create(rows.Interface()).Error
+		rows = rows.Slice(0, 0)
+		return err
+	}
+	for {
+		row := map[string]json.RawMessage{}
+		if err := dec.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		v := reflect.New(s.ModelType)
+		for name, raw := range row {
+			// columns dropped since the backup was made are left out
+			field, ok := s.FieldsByDBName[name]
+			if !ok {
+				continue
+			}
+			value := reflect.New(field.FieldType)
+			if err := json.Unmarshal(raw, value.Interface()); err != nil {
+				return fmt.Errorf("column %s: %w", name, err)
+			}
+			field.ReflectValueOf(ctx, v.Elem()).Set(value.Elem())
+		}
+		rows = reflect.Append(rows, v)
+		if rows.Len() == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// resetSequences moves the sequences of the auto increment ids of postgres
+// past the restored ids, it does not see the ids inserted explicitly
+func resetSequences(tx *gorm.DB, schemas []*schema.Schema) error {
+	for _, s := range schemas {
+		f := s.PrioritizedPrimaryField
+		if f == nil || !f.AutoIncrement {
+			continue
+		}
+		err := tx.Exec("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE((SELECT MAX(?) FROM ?), 0) + 1, false)",
+			s.Table, f.DBName, clause.Column{Name: f.DBName}, clause.Table{Name: s.Table}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
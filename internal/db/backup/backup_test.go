@@ -0,0 +1,113 @@
+package backup_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/synctv-org/synctv/internal/db/backup"
+	"github.com/synctv-org/synctv/internal/db/migrations"
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T, name string) *gorm.DB {
+	d, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared&_pragma=foreign_keys(1)"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrations.Up(d); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	src := openTestDB(t, "backup-src")
+	email := "owner@example.com"
+	user := &model.User{Username: "owner", Email: &email, HashedPassword: []byte("hash\x00\xff")}
+	if err := src.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	room := &model.Room{
+		Name:           "room",
+		CreatorID:      user.ID,
+		HashedPassword: []byte("room-hash"),
+		Tags:           []model.Tag{{Name: "anime"}},
+		Movies:         []model.Movie{{CreatorID: user.ID, MovieInfo: model.MovieInfo{BaseMovieInfo: model.BaseMovieInfo{Name: "movie"}}}},
+	}
+	if err := src.Create(room).Error; err != nil {
+		t.Fatal(err)
+	}
+	deleted := &model.Room{Name: "deleted", CreatorID: user.ID}
+	if err := src.Create(deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Delete(deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Create(&model.InstanceSetting{Name: "signup", Value: "false"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	m, err := backup.Backup(ctx, src, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Tables["rooms"] != 2 || m.Tables["room_tags"] != 1 || m.Tables["settings"] != 1 {
+		t.Fatalf("manifest tables = %v", m.Tables)
+	}
+	r := bytes.NewReader(archive.Bytes())
+	if _, err := backup.ReadManifest(r, r.Size()); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := openTestDB(t, "backup-dst")
+	if _, err := backup.Restore(ctx, dst, r, r.Size(), false); err != nil {
+		t.Fatal(err)
+	}
+	u := &model.User{}
+	if err := dst.First(u, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "owner" || *u.Email != email || !bytes.Equal(u.HashedPassword, user.HashedPassword) {
+		t.Fatalf("restored user = %s %v %q", u.Username, u.Email, u.HashedPassword)
+	}
+	restored := &model.Room{}
+	if err := dst.Preload("Tags").Preload("Movies").First(restored, "id = ?", room.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Tags) != 1 || len(restored.Movies) != 1 || restored.Movies[0].Name != "movie" {
+		t.Fatalf("restored room tags = %v, movies = %v", restored.Tags, restored.Movies)
+	}
+	if err := dst.Unscoped().First(&model.Room{}, "id = ? AND deleted_at IS NOT NULL", deleted.ID).Error; err != nil {
+		t.Fatalf("deleted room not restored: %v", err)
+	}
+	next := &model.User{Username: "next"}
+	if err := dst.Create(next).Error; err != nil || next.ID <= user.ID {
+		t.Fatalf("new user id = %d, %v", next.ID, err)
+	}
+
+	if _, err := backup.Restore(ctx, dst, r, r.Size(), false); !errors.Is(err, backup.ErrNotEmpty) {
+		t.Fatalf("restore into a used database = %v, want ErrNotEmpty", err)
+	}
+	if _, err := backup.Restore(ctx, dst, r, r.Size(), true); err != nil {
+		t.Fatal(err)
+	}
+	var users int64
+	if err := dst.Model(&model.User{}).Count(&users).Error; err != nil || users != 1 {
+		t.Fatalf("users after replace = %d, %v", users, err)
+	}
+
+	if _, err := backup.ReadManifest(bytes.NewReader([]byte("not a zip")), 9); !errors.Is(err, backup.ErrInvalidArchive) {
+		t.Fatalf("read manifest of garbage = %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+)
+
+// withCreatedRooms runs f in a transaction, failing unless every room in ids was created by userID
+func withCreatedRooms(userID uint, ids []string, f func(tx *gorm.DB) error) error {
+	unique := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&model.Room{}).Where("id IN ? AND creator_id = ?", ids, userID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count != int64(len(unique)) {
+			return errors.New("room not found or not created by user")
+		}
+		return f(tx)
+	})
+}
+
+func DeleteCreatedRooms(userID uint, ids []string) error {
+	return withCreatedRooms(userID, ids, func(tx *gorm.DB) error {
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&model.Room{}).Error
+	})
+}
+
+func SetCreatedRoomsHidden(userID uint, ids []string, hidden bool) error {
+	return withCreatedRooms(userID, ids, func(tx *gorm.DB) error {
+		return tx.Model(&model.Room{}).Where("id IN ?", ids).Update("hidden", hidden).Error
+	})
+}
+
+func SetCreatedRoomsHashedPassword(userID uint, ids []string, hashedPassword []byte) error {
+	return withCreatedRooms(userID, ids, func(tx *gorm.DB) error {
+		return tx.Model(&model.Room{}).Where("id IN ?", ids).Update("hashed_password", hashedPassword).Error
+	})
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func CreateChatMessage(msg *model.ChatMessage) error {
+	return db.Create(msg).Error
+}
+
+func GetChatMessage(roomID string, id uint) (*model.ChatMessage, error) {
+	msg := &model.ChatMessage{}
+	err := db.Where("room_id = ? AND id = ?", roomID, id).First(msg).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return msg, errors.New("chat message not found")
+	}
+	return msg, err
+}
+
+func DeleteChatMessage(roomID string, id uint) error {
+	result := db.Where("room_id = ? AND id = ?", roomID, id).Delete(&model.ChatMessage{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return errors.New("chat message not found")
+	}
+	return result.Error
+}
+
+// GetChatMessages returns the newest limit messages of the room sent before the message
+// with id before, 0 for the newest messages, oldest first
+func GetChatMessages(roomID string, before uint, limit int) ([]*model.ChatMessage, error) {
+	messages := []*model.ChatMessage{}
+	tx := db.Where("room_id = ?", roomID)
+	if before > 0 {
+		tx = tx.Where("id < ?", before)
+	}
+	if err := tx.Order("id DESC").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// DeleteChatMessagesBefore deletes the messages sent before t and returns the number deleted
+func DeleteChatMessagesBefore(t time.Time) (int64, error) {
+	result := db.Where("created_at < ?", t).Delete(&model.ChatMessage{})
+	return result.RowsAffected, result.Error
+}
+
+// TrimChatMessages keeps the newest max messages of every room and returns the number deleted
+func TrimChatMessages(max int) (int64, error) {
+	var roomIDs []string
+	err := db.Model(&model.ChatMessage{}).
+		Group("room_id").
+		Having("COUNT(*) > ?", max).
+		Pluck("room_id", &roomIDs).Error
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, id := range roomIDs {
+		var last []uint
+		err := db.Model(&model.ChatMessage{}).
+			Where("room_id = ?", id).
+			Order("id DESC").
+			Offset(max).
+			Limit(1).
+			Pluck("id", &last).Error
+		if err != nil {
+			return n, err
+		}
+		if len(last) == 0 {
+			continue
+		}
+		result := db.Where("room_id = ? AND id <= ?", id, last[0]).Delete(&model.ChatMessage{})
+		if result.Error != nil {
+			return n, result.Error
+		}
+		n += result.RowsAffected
+	}
+	return n, nil
+}
+
+// SetChatRead moves the last chat message of the room the user read forward to id
+func SetChatRead(roomID string, userID, id uint) error {
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "room_id"}, {Name: "user_id"}},
+		DoUpdates: clause.Set{
+			{
+				Column: clause.Column{Name: "last_read_id"},
+				Value:  gorm.Expr("CASE WHEN chat_read_states.last_read_id < ? THEN ? ELSE chat_read_states.last_read_id END", id, id),
+			},
+			{Column: clause.Column{Name: "updated_at"}, Value: time.Now()},
+		},
+	}).Create(&model.ChatReadState{RoomID: roomID, UserID: userID, LastReadID: id}).Error
+}
+
+// GetChatUnread returns the last chat message of the room the user read, the number
+// of messages of others after it, and the contents of those containing mention.
+// LIKE can not tell where a name ends, the caller checks the contents.
+func GetChatUnread(roomID string, userID uint, mention string) (uint, int64, []string, error) {
+	state := &model.ChatReadState{}
+	err := db.Where("room_id = ? AND user_id = ?", roomID, userID).First(state).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, 0, nil, err
+	}
+	tx := db.Model(&model.ChatMessage{}).Where("room_id = ? AND id > ? AND user_id <> ?", roomID, state.LastReadID, userID)
+	var (
+		unread   int64
+		contents []string
+	)
+	if err := tx.Session(&gorm.Session{}).Count(&unread).Error; err != nil {
+		return 0, 0, nil, err
+	}
+	if unread > 0 {
+		if err := tx.Where("content LIKE ? ESCAPE '!'", "%"+likeEscaper.Replace(mention)+"%").Pluck("content", &contents).Error; err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	return state.LastReadID, unread, contents, nil
+}
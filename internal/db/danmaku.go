@@ -0,0 +1,19 @@
+package db
+
+import (
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func CreateDanmaku(d *model.Danmaku) error {
+	return db.Create(d).Error
+}
+
+// GetDanmakus returns at most limit danmaku of a movie shown from from to to seconds, ordered by time
+func GetDanmakus(roomID string, movieID uint, from, to float64, limit int) ([]*model.Danmaku, error) {
+	danmakus := []*model.Danmaku{}
+	err := db.Where("room_id = ? AND movie_id = ? AND time >= ? AND time < ?", roomID, movieID, from, to).
+		Order("time ASC").Order("id ASC").
+		Limit(limit).
+		Find(&danmakus).Error
+	return danmakus, err
+}
@@ -1,31 +1,59 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"sync/atomic"
+
 	log "github.com/sirupsen/logrus"
-	"github.com/synctv-org/synctv/internal/conf"
-	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/db/migrations"
 	_ "github.com/synctv-org/synctv/utils/fastJSONSerializer"
 	"gorm.io/gorm"
 )
 
 var db *gorm.DB
 
+// Init opens the database and applies the pending migrations
 func Init(d *gorm.DB) error {
+	if err := Open(d); err != nil {
+		return err
+	}
+	return Migrate()
+}
+
+// Open uses d as the database without migrating it
+func Open(d *gorm.DB) error {
+	if err := d.Use(TracingPlugin{}); err != nil {
+		return err
+	}
 	db = d
-	return AutoMigrate(new(model.Movie), new(model.Room), new(model.User), new(model.RoomUserRelation), new(model.UserProvider))
+	return nil
 }
 
-func AutoMigrate(dst ...any) error {
-	var err error
-	switch conf.Conf.Database.Type {
-	case conf.DatabaseTypeMysql:
-		err = db.Set("gorm:table_options", "ENGINE=InnoDB CHARSET=utf8mb4").AutoMigrate(dst...)
-	case conf.DatabaseTypeSqlite3, conf.DatabaseTypePostgres:
-		err = db.AutoMigrate(dst...)
-	default:
-		log.Fatalf("unknown database type: %s", conf.Conf.Database.Type)
+// Migrate applies the pending migrations, see package migrations
+func Migrate() error {
+	if err := migrations.Up(db); err != nil {
+		return err
+	}
+	migrated.Store(true)
+	return nil
+}
+
+var ErrNotMigrated = errors.New("database migrations not applied")
+
+var migrated atomic.Bool
+
+// Ready returns nil once the migrations are applied and while the database
+// answers, it is the database check of the readiness probe
+func Ready(ctx context.Context) error {
+	if !migrated.Load() {
+		return ErrNotMigrated
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
 	}
-	return err
+	return sqlDB.PingContext(ctx)
 }
 
 func DB() *gorm.DB {
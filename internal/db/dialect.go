@@ -0,0 +1,27 @@
+package db
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/utils"
+)
+
+// supportsReturning reports whether the database of tx returns the deleted
+// rows, sqlite and postgres do but mysql ignores RETURNING
+func supportsReturning(tx *gorm.DB) bool {
+	return utils.Contains(tx.Callback().Delete().Clauses, "RETURNING")
+}
+
+// deleteReturning deletes the rows matched by tx and scans them into dest,
+// they are loaded and locked first where RETURNING is not supported
+func deleteReturning(tx *gorm.DB, dest any, columns ...clause.Column) error {
+	if supportsReturning(tx) {
+		return tx.Clauses(clause.Returning{Columns: columns}).Delete(dest).Error
+	}
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Find(dest).Error; err != nil {
+			return err
+		}
+		return tx.Delete(dest).Error
+	})
+}
@@ -0,0 +1,80 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestDeleteWithoutReturning deletes rows through a sqlite database that
+// builds its deletes like mysql, without RETURNING
+func TestDeleteWithoutReturning(t *testing.T) {
+	conf.Set(conf.DefaultConfig())
+	d, err := gorm.Open(sqlite.Open("file:no-returning?mode=memory&cache=shared&_pragma=foreign_keys(1)"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Callback().Delete().Clauses = []string{"DELETE", "FROM", "WHERE"}
+	if err := db.Init(d); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := db.CreateUser("no-returning", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.CreateRoom("no-returning", "", db.WithCreator(u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	movie := &model.Movie{RoomID: r.ID, CreatorID: u.ID, MovieInfo: model.MovieInfo{BaseMovieInfo: model.BaseMovieInfo{Name: "movie"}}}
+	if err := db.CreateMovie(movie); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"first", "second"} {
+		if err := db.CreateSubtitle(&model.Subtitle{RoomID: r.ID, MovieID: movie.ID, CreatorID: u.ID, Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	subtitles, err := db.GetSubtitlesByMovieID(movie.ID)
+	if err != nil || len(subtitles) != 2 {
+		t.Fatalf("subtitles = %d, %v", len(subtitles), err)
+	}
+	s, err := db.LoadAndDeleteSubtitle(r.ID, subtitles[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "first" {
+		t.Fatalf("deleted subtitle = %q, want first", s.Name)
+	}
+	if _, err := db.LoadAndDeleteSubtitle(r.ID, subtitles[0].ID); err == nil {
+		t.Fatal("deleted a subtitle twice")
+	}
+	deleted, err := db.LoadAndDeleteSubtitlesByMovieID(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0].Name != "second" {
+		t.Fatalf("deleted subtitles = %+v, want second", deleted)
+	}
+
+	m, err := db.LoadAndDeleteMovieByID(r.ID, movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "movie" {
+		t.Fatalf("deleted movie = %q, want movie", m.Name)
+	}
+	if movies, err := db.GetAllMoviesByRoomID(r.ID); err != nil || len(movies) != 0 {
+		t.Fatalf("movies = %d, %v, want none", len(movies), err)
+	}
+}
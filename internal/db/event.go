@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func CreateRoomEvent(ctx context.Context, event *model.RoomEvent) error {
+	return db.WithContext(ctx).Create(event).Error
+}
+
+// CreateRoomEvents inserts the events of any rooms at once
+func CreateRoomEvents(events []*model.RoomEvent) error {
+	return db.Create(events).Error
+}
+
+// GetRoomEvents returns the newest events of the room first, and the total count
+func GetRoomEvents(roomID string, offset, limit int) ([]*model.RoomEvent, int64, error) {
+	var (
+		events []*model.RoomEvent
+		total  int64
+	)
+	tx := db.Model(&model.RoomEvent{}).Where("room_id = ?", roomID)
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Order("id DESC").Offset(offset).Limit(limit).Find(&events).Error
+	return events, total, err
+}
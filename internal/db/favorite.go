@@ -0,0 +1,29 @@
+package db
+
+import (
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm/clause"
+)
+
+func AddFavoriteRoom(userID uint, roomID string) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.UserFavoriteRoom{
+		UserID: userID,
+		RoomID: roomID,
+	}).Error
+}
+
+func RemoveFavoriteRoom(userID uint, roomID string) error {
+	return db.Where("user_id = ? AND room_id = ?", userID, roomID).Delete(&model.UserFavoriteRoom{}).Error
+}
+
+// GetFavoriteRooms returns the favorite rooms of the user matching conf, the latest added first
+func GetFavoriteRooms(userID uint, conf ...GetRoomsConfig) ([]*model.Room, error) {
+	tx := db.Model(&model.Room{}).
+		Joins("JOIN user_favorite_rooms ON user_favorite_rooms.room_id = rooms.id AND user_favorite_rooms.user_id = ?", userID)
+	for _, c := range conf {
+		tx = c(tx)
+	}
+	rooms := []*model.Room{}
+	err := tx.Select("rooms.*").Preload("Tags").Order("user_favorite_rooms.created_at DESC").Find(&rooms).Error
+	return rooms, err
+}
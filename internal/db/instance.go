@@ -0,0 +1,28 @@
+package db
+
+import (
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func GetInstanceSettings() ([]*model.InstanceSetting, error) {
+	settings := []*model.InstanceSetting{}
+	return settings, db.Find(&settings).Error
+}
+
+// SaveInstanceSettings saves the values by setting name, all of them or none
+func SaveInstanceSettings(values map[string]string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for name, value := range values {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "name"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+			}).Create(&model.InstanceSetting{Name: name, Value: value}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
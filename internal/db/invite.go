@@ -0,0 +1,50 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+)
+
+var ErrInviteNotFound = errors.New("invite not found")
+
+func CreateRoomInvite(invite *model.RoomInvite) error {
+	return db.Create(invite).Error
+}
+
+func GetRoomInvite(id uint) (*model.RoomInvite, error) {
+	i := &model.RoomInvite{}
+	err := db.Where("id = ?", id).First(i).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return i, ErrInviteNotFound
+	}
+	return i, err
+}
+
+// UseRoomInvite counts one use of the invite, failing if it is expired or used up
+func UseRoomInvite(id uint) error {
+	result := db.Model(&model.RoomInvite{}).
+		Where("id = ? AND expires_at > ? AND (max_uses = 0 OR uses < max_uses)", id, time.Now()).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("invite expired or used up")
+	}
+	return nil
+}
+
+// DeleteRoomInvite revokes the invite of the room, tokens of it can no longer be used
+func DeleteRoomInvite(roomID string, id uint) error {
+	result := db.Where("room_id = ?", roomID).Delete(&model.RoomInvite{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
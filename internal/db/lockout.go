@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func GetLoginAttempts(ctx context.Context, keys ...string) ([]*model.LoginAttempt, error) {
+	attempts := []*model.LoginAttempt{}
+	return attempts, db.WithContext(ctx).Where("login_key IN ?", keys).Find(&attempts).Error
+}
+
+// RecordLoginFailure loads the attempts of key, or a new one, applies update
+// to it and saves it in one transaction
+func RecordLoginFailure(ctx context.Context, key string, update func(*model.LoginAttempt)) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		a := &model.LoginAttempt{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("login_key = ?", key).First(a).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		a.Key = key
+		update(a)
+		return tx.Save(a).Error
+	})
+}
+
+func DeleteLoginAttempts(ctx context.Context, keys ...string) error {
+	return db.WithContext(ctx).Where("login_key IN ?", keys).Delete(&model.LoginAttempt{}).Error
+}
+
+// GetLockedLoginAttempts returns the keys locked at now, the longest locked
+// first, and the total count
+func GetLockedLoginAttempts(now time.Time, offset, limit int) ([]*model.LoginAttempt, int64, error) {
+	var (
+		attempts []*model.LoginAttempt
+		total    int64
+	)
+	tx := db.Model(&model.LoginAttempt{}).Where("locked_until > ?", now)
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Order("locked_until DESC").Offset(offset).Limit(limit).Find(&attempts).Error
+	return attempts, total, err
+}
+
+// PurgeLoginAttempts deletes the attempts whose last failure is before t
+func PurgeLoginAttempts(t time.Time) (int64, error) {
+	result := db.Where("last_failure < ?", t).Delete(&model.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/metrics"
+	"github.com/synctv-org/synctv/internal/requestid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var queryDuration = metrics.NewHistogram("db_query_duration_seconds", "Latency of database queries.", nil)
+
+// Logger writes the logs of gorm to logrus as structured fields, with the
+// request id of the context of the query when it has one
+type Logger struct {
+	Level         logger.LogLevel
+	SlowThreshold time.Duration
+}
+
+func NewLogger(level logger.LogLevel, slowThreshold time.Duration) *Logger {
+	return &Logger{
+		Level:         level,
+		SlowThreshold: slowThreshold,
+	}
+}
+
+func (l *Logger) LogMode(level logger.LogLevel) logger.Interface {
+	nl := *l
+	nl.Level = level
+	return &nl
+}
+
+func (l *Logger) Info(ctx context.Context, msg string, data ...any) {
+	if l.Level >= logger.Info {
+		requestid.Log(ctx).Infof(msg, data...)
+	}
+}
+
+func (l *Logger) Warn(ctx context.Context, msg string, data ...any) {
+	if l.Level >= logger.Warn {
+		requestid.Log(ctx).Warnf(msg, data...)
+	}
+}
+
+func (l *Logger) Error(ctx context.Context, msg string, data ...any) {
+	if l.Level >= logger.Error {
+		requestid.Log(ctx).Errorf(msg, data...)
+	}
+}
+
+// ParamsFilter keeps the values out of the logged queries, they can be passwords or tokens
+func (l *Logger) ParamsFilter(ctx context.Context, sql string, params ...any) (string, []any) {
+	return sql, nil
+}
+
+func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	queryDuration.Observe(elapsed.Seconds())
+	if l.Level <= logger.Silent {
+		return
+	}
+	entry := func() *log.Entry {
+		sql, rows := fc()
+		return requestid.Log(ctx).WithFields(log.Fields{
+			"sql":        sql,
+			"rows":       rows,
+			"elapsed_ms": elapsed.Milliseconds(),
+		})
+	}
+	switch {
+	case err != nil && l.Level >= logger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		entry().WithError(err).Error("sql")
+	case l.SlowThreshold != 0 && elapsed > l.SlowThreshold && l.Level >= logger.Warn:
+		entry().Warn("slow sql")
+	case l.Level >= logger.Info:
+		entry().Debug("sql")
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func CreateDirectMessage(msg *model.DirectMessage) error {
+	return db.Create(msg).Error
+}
+
+// GetDirectMessages returns the newest limit messages between the users sent before
+// the message with id before, 0 for the newest messages, oldest first
+func GetDirectMessages(userID, peerID uint, before uint, limit int) ([]*model.DirectMessage, error) {
+	messages := []*model.DirectMessage{}
+	tx := db.Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)", userID, peerID, peerID, userID)
+	if before > 0 {
+		tx = tx.Where("id < ?", before)
+	}
+	if err := tx.Order("id DESC").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// MarkDirectMessagesRead marks the messages from peer to the user read
+func MarkDirectMessagesRead(userID, peerID uint) error {
+	return db.Model(&model.DirectMessage{}).
+		Where("recipient_id = ? AND sender_id = ? AND seen = ?", userID, peerID, false).
+		Update("seen", true).Error
+}
+
+// GetUnreadDirectMessageCounts returns the number of unread messages to the user by sender
+func GetUnreadDirectMessageCounts(userID uint) (map[uint]int64, error) {
+	var rows []struct {
+		SenderID uint
+		Count    int64
+	}
+	err := db.Model(&model.DirectMessage{}).
+		Select("sender_id, COUNT(*) AS count").
+		Where("recipient_id = ? AND seen = ?", userID, false).
+		Group("sender_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int64, len(rows))
+	for _, r := range rows {
+		counts[r.SenderID] = r.Count
+	}
+	return counts, nil
+}
+
+// ShareRoom reports whether both users are members of a room neither is banned from
+func ShareRoom(userID, peerID uint) (bool, error) {
+	var n int64
+	err := db.Model(&model.RoomUserRelation{}).
+		Joins("JOIN room_user_relations peer ON peer.room_id = room_user_relations.room_id AND peer.user_id = ? AND peer.role <> ? AND peer.deleted_at IS NULL", peerID, model.RoomRoleBanned).
+		Where("room_user_relations.user_id = ? AND room_user_relations.role <> ?", userID, model.RoomRoleBanned).
+		Limit(1).
+		Count(&n).Error
+	return n > 0, err
+}
@@ -0,0 +1,140 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/provider"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type legacyRoom struct {
+	gorm.Model
+	Name      string        `gorm:"not null;uniqueIndex"`
+	CreatorID uint          `gorm:"index"`
+	Movies    []legacyMovie `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (legacyRoom) TableName() string { return "rooms" }
+
+type legacyMovie struct {
+	gorm.Model
+	Position  uint `gorm:"not null"`
+	RoomID    uint `gorm:"not null;index"`
+	CreatorID uint `gorm:"not null;index"`
+	model.MovieInfo
+}
+
+func (legacyMovie) TableName() string { return "movies" }
+
+func TestMigrateRoomIDs(t *testing.T) {
+	conf.Set(conf.DefaultConfig())
+	d, err := gorm.Open(sqlite.Open("file:migrate?mode=memory&cache=shared&_pragma=foreign_keys(1)"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AutoMigrate(new(model.User), new(legacyRoom), new(legacyMovie)); err != nil {
+		t.Fatal(err)
+	}
+	user := model.User{Username: "legacy"}
+	if err := d.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	legacy := legacyRoom{
+		Name:      "legacy",
+		CreatorID: user.ID,
+		Movies: []legacyMovie{{
+			CreatorID: user.ID,
+			MovieInfo: model.MovieInfo{BaseMovieInfo: model.BaseMovieInfo{Name: "movie"}},
+		}},
+	}
+	if err := d.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Init(d); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := db.GetRoomByID("1")
+	if err != nil {
+		t.Fatalf("legacy room not found: %v", err)
+	}
+	if r.Name != "legacy" {
+		t.Fatalf("room 1 = %q, want legacy", r.Name)
+	}
+	movies, err := db.GetAllMoviesByRoomID(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movies) != 1 || movies[0].Name != "movie" {
+		t.Fatalf("legacy room movies = %+v, want the migrated movie", movies)
+	}
+
+	created, err := db.CreateRoom("new", "", db.WithCreator(&user))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created.ID) != 32 {
+		t.Fatalf("new room id = %q, want a uuid", created.ID)
+	}
+
+	if err := db.DeleteRoomByID(r.ID); err != nil {
+		t.Fatal(err)
+	}
+	if movies, err := db.GetAllMoviesByRoomID(r.ID); err != nil || len(movies) != 0 {
+		t.Fatalf("movies of deleted room = %d, %v, want cascade delete", len(movies), err)
+	}
+}
+
+type legacyUserProvider struct {
+	gorm.Model
+	UserID         uint                    `gorm:"not null"`
+	Provider       provider.OAuth2Provider `gorm:"not null;uniqueIndex:provider_user_id"`
+	ProviderUserID uint                    `gorm:"not null;uniqueIndex:provider_user_id"`
+}
+
+func (legacyUserProvider) TableName() string { return "user_providers" }
+
+func TestMigrateProviderUserIDs(t *testing.T) {
+	conf.Set(conf.DefaultConfig())
+	d, err := gorm.Open(sqlite.Open("file:migrate-providers?mode=memory&cache=shared&_pragma=foreign_keys(1)"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AutoMigrate(new(model.User), new(legacyUserProvider)); err != nil {
+		t.Fatal(err)
+	}
+	user := model.User{Username: "legacy-provider"}
+	if err := d.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Create(&legacyUserProvider{UserID: user.ID, Provider: "github", ProviderUserID: 12345}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Init(d); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := db.GetUserByProvider("github", "12345")
+	if err != nil {
+		t.Fatalf("legacy provider account not found: %v", err)
+	}
+	if u.ID != user.ID {
+		t.Fatalf("user = %d, want %d", u.ID, user.ID)
+	}
+	if err := db.AddUserProvider(user.ID, "github", "12345", ""); err == nil {
+		t.Fatal("the unique index of provider accounts was lost")
+	}
+}
@@ -0,0 +1,210 @@
+package migrations
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/model"
+	_ "github.com/synctv-org/synctv/utils/fastJSONSerializer"
+	"gorm.io/gorm"
+)
+
+// roomTag is the join table of model.Room and model.Tag, declared only to alter its room id column
+type roomTag struct {
+	RoomID string `gorm:"primarykey;type:varchar(32)"`
+	TagID  uint   `gorm:"primarykey"`
+}
+
+func (roomTag) TableName() string {
+	return "room_tags"
+}
+
+// roomRelations are the relations of model.Room whose foreign key references the room id
+var roomRelations = []string{"GroupUserRelations", "Movies", "State", "Invites", "Events", "Favorites", "ChatMessages", "ChatReadStates", "PermissionAudits"}
+
+// migrateRoomIDs converts the auto increment room ids of databases created
+// before room ids were random strings. Existing rooms keep their id as a
+// decimal string, so links and tokens issued before stay valid.
+func migrateRoomIDs(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if !m.HasTable(&model.Room{}) {
+		return nil
+	}
+	columns, err := m.ColumnTypes(&model.Room{})
+	if err != nil {
+		return err
+	}
+	legacy := false
+	for _, c := range columns {
+		if c.Name() == "id" {
+			legacy = strings.Contains(strings.ToLower(c.DatabaseTypeName()), "int")
+			break
+		}
+	}
+	if !legacy {
+		return nil
+	}
+	log.Info("migrating room ids to string")
+
+	// foreign keys must match the type of the room id, they are dropped here
+	// and created again by AutoMigrate
+	for _, name := range roomRelations {
+		if m.HasConstraint(&model.Room{}, name) {
+			if err := m.DropConstraint(&model.Room{}, name); err != nil {
+				return err
+			}
+		}
+	}
+	if m.HasTable(&roomTag{}) && m.HasConstraint(&roomTag{}, "fk_room_tags_room") {
+		if err := m.DropConstraint(&roomTag{}, "fk_room_tags_room"); err != nil {
+			return err
+		}
+	}
+
+	if err := m.AlterColumn(&model.Room{}, "ID"); err != nil {
+		return err
+	}
+	for _, v := range []any{new(model.RoomUserRelation), new(model.Movie), new(model.RoomState), new(model.RoomInvite), new(model.RoomEvent), new(model.UserFavoriteRoom), new(model.ChatMessage), new(model.ChatReadState), new(model.PermissionAudit), new(roomTag)} {
+		if !m.HasTable(v) {
+			continue
+		}
+		if err := m.AlterColumn(v, "RoomID"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// models are the tables of the current schema, parents before the tables
+// referencing them
+func models() []any {
+	return []any{new(model.User), new(model.Room), new(model.Tag), new(model.Movie), new(model.Subtitle), new(model.Danmaku), new(model.RoomUserRelation), new(model.UserProvider), new(model.RoomState), new(model.RoomInvite), new(model.RoomEvent), new(model.ChatMessage), new(model.ChatReadState), new(model.UserFavoriteRoom), new(model.DirectMessage), new(model.RecoveryCode), new(model.UserSession), new(model.RevokedToken), new(model.APIKey), new(model.UsernameChange), new(model.InstanceSetting), new(model.PermissionAudit), new(model.LoginAttempt)}
+}
+
+// legacyTables were dropped from the schema before it was versioned
+var legacyTables = []string{
+	// replaced by the user sessions
+	"refresh_tokens",
+}
+
+// initialUp creates the schema of the current models, databases created
+// before the schema was versioned are converted to it
+func initialUp(tx *gorm.DB) error {
+	if err := migrateRoomIDs(tx); err != nil {
+		return err
+	}
+	for _, t := range legacyTables {
+		if err := tx.Migrator().DropTable(t); err != nil {
+			return err
+		}
+	}
+	if err := autoMigrate(tx, models()...); err != nil {
+		return err
+	}
+	if err := backfillRoomLastActive(tx); err != nil {
+		return err
+	}
+	if err := dropCaptchaSecret(tx); err != nil {
+		return err
+	}
+	if err := convertDefaultRole(tx); err != nil {
+		return err
+	}
+	return renameDeletedRooms(tx)
+}
+
+// backfillRoomLastActive sets the last activity of the rooms never marked
+// active, added before the column or created without it, to their last
+// update, so the inactive room janitor doesn't take them for long inactive
+func backfillRoomLastActive(tx *gorm.DB) error {
+	return tx.Table("rooms").
+		Where("last_active_at IS NULL OR last_active_at <= ?", time.Time{}).
+		Update("last_active_at", gorm.Expr("updated_at")).Error
+}
+
+// dropCaptchaSecret deletes the captcha secret saved as an instance setting,
+// it moved to the config so admins can not read it back and backups do not
+// carry it
+func dropCaptchaSecret(tx *gorm.DB) error {
+	result := tx.Exec("DELETE FROM settings WHERE name = ?", "captcha_secret")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 0 {
+		log.Warn("the captcha secret setting was removed, set captcha.secret in the config")
+	}
+	return nil
+}
+
+// defaultRolePermissions are the permissions of the role presets when rooms
+// saved a default role, the member preset is the nil default
+var defaultRolePermissions = map[string]model.Permission{
+	"admin":      model.RolePresetAdmin.Permissions(),
+	"moderator":  model.RolePresetModerator.Permissions(),
+	"restricted": model.RolePresetRestricted.Permissions(),
+}
+
+// convertDefaultRole moves the default role of rooms to their default
+// permissions, which replaced it, and drops its column
+func convertDefaultRole(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn("rooms", "default_role") {
+		return nil
+	}
+	for role, p := range defaultRolePermissions {
+		err := tx.Table("rooms").
+			Where("default_role = ? AND default_permissions IS NULL", role).
+			Update("default_permissions", p).Error
+		if err != nil {
+			return err
+		}
+	}
+	// the sqlite migrator drops a column by copying the table, which would
+	// cascade to the rows referencing the rooms
+	return tx.Exec("ALTER TABLE rooms DROP COLUMN default_role").Error
+}
+
+// renameDeletedRooms renames the rooms soft deleted while they kept their
+// name, which the unique index held so no new room could take it
+func renameDeletedRooms(tx *gorm.DB) error {
+	var rooms []struct {
+		ID   string
+		Name string
+	}
+	if err := tx.Table("rooms").Select("id", "name").Where("deleted_at IS NOT NULL").Find(&rooms).Error; err != nil {
+		return err
+	}
+	for _, r := range rooms {
+		suffix := "#deleted-" + r.ID
+		if strings.HasSuffix(r.Name, suffix) {
+			continue
+		}
+		if err := tx.Table("rooms").Where("id = ?", r.ID).Update("name", r.Name+suffix).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepData reverts a migration that only filled in data, the data stays valid
+func keepData(tx *gorm.DB) error {
+	return nil
+}
+
+// Tables are the tables of the latest schema but the versions, parents
+// before the tables referencing them
+func Tables() []any {
+	return append(models(), new(roomTag))
+}
+
+// initialDown drops every table but the versions, one at a time since gorm
+// does not see the references of rooms to users
+func initialDown(tx *gorm.DB) error {
+	tables := Tables()
+	for i := len(tables) - 1; i >= 0; i-- {
+		if err := tx.Migrator().DropTable(tables[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
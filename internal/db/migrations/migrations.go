@@ -0,0 +1,162 @@
+// Package migrations versions the database schema. Every change of the
+// schema is a Migration appended to all, the versions applied to a database
+// are recorded in the schema_migrations table.
+//
+// The first migration creates the schema of the current models, so a
+// database without recorded versions is brought to the latest version by
+// it alone and every migration is recorded as applied. Later migrations
+// only run on databases created before them, they must not use the current
+// models but copies of the structs as they were.
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownVersion = errors.New("database schema is newer than this server")
+	ErrIrreversible   = errors.New("migration can not be reverted")
+)
+
+// Migration changes the schema from the previous version to Version, Down
+// reverts it and is only used in development
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   uint `gorm:"primarykey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// all are the migrations in version order, versions are never reused
+var all = []*Migration{
+	{Version: 1, Name: "initial", Up: initialUp, Down: initialDown},
+	{Version: 2, Name: "backfill room last active", Up: backfillRoomLastActive, Down: keepData},
+	{Version: 3, Name: "drop captcha secret setting", Up: dropCaptchaSecret, Down: keepData},
+	{Version: 4, Name: "convert room default role", Up: convertDefaultRole, Down: keepData},
+	{Version: 5, Name: "rename deleted rooms", Up: renameDeletedRooms, Down: keepData},
+}
+
+// Latest is the schema version of this server
+func Latest() uint {
+	return all[len(all)-1].Version
+}
+
+// Status returns the applied migrations in version order
+func Status(d *gorm.DB) ([]*SchemaMigration, error) {
+	if err := d.AutoMigrate(new(SchemaMigration)); err != nil {
+		return nil, err
+	}
+	applied := []*SchemaMigration{}
+	return applied, d.Order("version").Find(&applied).Error
+}
+
+// Up applies the pending migrations, it refuses a database migrated by a
+// newer server since this one does not know its schema
+func Up(d *gorm.DB) error {
+	return up(d, all)
+}
+
+// Down reverts the applied migrations above version to, newest first
+func Down(d *gorm.DB, to uint) error {
+	return down(d, all, to)
+}
+
+func up(d *gorm.DB, migrations []*Migration) error {
+	applied, err := Status(d)
+	if err != nil {
+		return err
+	}
+	latest := migrations[len(migrations)-1].Version
+	if len(applied) == 0 {
+		log.Infof("migrating database to version %d", latest)
+		return d.Transaction(func(tx *gorm.DB) error {
+			if err := migrations[0].Up(tx); err != nil {
+				return fmt.Errorf("migration %d %s: %w", migrations[0].Version, migrations[0].Name, err)
+			}
+			for _, m := range migrations {
+				if err := record(tx, m); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if current := applied[len(applied)-1].Version; current > latest {
+		return fmt.Errorf("%w: version %d, this server knows up to %d", ErrUnknownVersion, current, latest)
+	}
+	done := make(map[uint]bool, len(applied))
+	for _, a := range applied {
+		done[a.Version] = true
+	}
+	for _, m := range migrations {
+		if done[m.Version] {
+			continue
+		}
+		log.Infof("applying migration %d %s", m.Version, m.Name)
+		err := d.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return record(tx, m)
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func down(d *gorm.DB, migrations []*Migration, to uint) error {
+	applied, err := Status(d)
+	if err != nil {
+		return err
+	}
+	byVersion := make(map[uint]*Migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+	for i := len(applied) - 1; i >= 0 && applied[i].Version > to; i-- {
+		m, ok := byVersion[applied[i].Version]
+		if !ok {
+			return fmt.Errorf("%w: version %d", ErrUnknownVersion, applied[i].Version)
+		}
+		if m.Down == nil {
+			return fmt.Errorf("%w: %d %s", ErrIrreversible, m.Version, m.Name)
+		}
+		log.Infof("reverting migration %d %s", m.Version, m.Name)
+		err := d.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func record(tx *gorm.DB, m *Migration) error {
+	return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+}
+
+// autoMigrate migrates the tables with the table options of the dialect
+func autoMigrate(tx *gorm.DB, dst ...any) error {
+	if tx.Dialector.Name() == "mysql" {
+		tx = tx.Set("gorm:table_options", "ENGINE=InnoDB CHARSET=utf8mb4")
+	}
+	return tx.AutoMigrate(dst...)
+}
@@ -0,0 +1,221 @@
+package migrations
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T, name string) *gorm.DB {
+	d, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared&_pragma=foreign_keys(1)"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func versions(t *testing.T, d *gorm.DB) []uint {
+	applied, err := Status(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs := make([]uint, 0, len(applied))
+	for _, a := range applied {
+		vs = append(vs, a.Version)
+	}
+	return vs
+}
+
+func TestUpDown(t *testing.T) {
+	d := openTestDB(t, "up-down")
+	if err := Up(d); err != nil {
+		t.Fatal(err)
+	}
+	if vs := versions(t, d); len(vs) != len(all) || vs[len(vs)-1] != Latest() {
+		t.Fatalf("versions = %v, want every migration", vs)
+	}
+	if !d.Migrator().HasTable(new(model.Room)) {
+		t.Fatal("rooms table not created")
+	}
+	if err := Up(d); err != nil {
+		t.Fatalf("up twice: %v", err)
+	}
+
+	if err := Down(d, 0); err != nil {
+		t.Fatal(err)
+	}
+	if vs := versions(t, d); len(vs) != 0 {
+		t.Fatalf("versions = %v after down, want none", vs)
+	}
+	if d.Migrator().HasTable(new(model.Room)) {
+		t.Fatal("rooms table not dropped")
+	}
+}
+
+func TestUnknownVersion(t *testing.T) {
+	d := openTestDB(t, "unknown-version")
+	if err := Up(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Create(&SchemaMigration{Version: Latest() + 1, Name: "future"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(d); !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("up = %v, want ErrUnknownVersion", err)
+	}
+}
+
+type renamedNote struct {
+	ID   uint
+	Body string
+}
+
+func (renamedNote) TableName() string { return "notes" }
+
+func TestPendingMigrations(t *testing.T) {
+	type note struct {
+		ID   uint
+		Text string
+	}
+	ran := 0
+	first := &Migration{Version: 1, Name: "notes", Up: func(tx *gorm.DB) error {
+		return tx.Table("notes").AutoMigrate(new(note))
+	}}
+	second := &Migration{Version: 2, Name: "rename note text", Up: func(tx *gorm.DB) error {
+		ran++
+		return tx.Migrator().RenameColumn(new(renamedNote), "text", "body")
+	}}
+
+	fresh := openTestDB(t, "pending-fresh")
+	if err := up(fresh, []*Migration{first, second}); err != nil {
+		t.Fatal(err)
+	}
+	if ran != 0 {
+		t.Fatal("a later migration ran on a new database")
+	}
+	if vs := versions(t, fresh); len(vs) != 2 {
+		t.Fatalf("versions = %v, want both recorded", vs)
+	}
+
+	d := openTestDB(t, "pending")
+	if err := up(d, []*Migration{first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := up(d, []*Migration{first, second}); err != nil {
+		t.Fatal(err)
+	}
+	if ran != 1 || !d.Migrator().HasColumn(new(renamedNote), "body") {
+		t.Fatalf("pending migration ran %d times", ran)
+	}
+	if err := down(d, []*Migration{first, second}, 1); !errors.Is(err, ErrIrreversible) {
+		t.Fatalf("down = %v, want ErrIrreversible", err)
+	}
+}
+
+func TestDropLegacyTables(t *testing.T) {
+	d := openTestDB(t, "legacy-tables")
+	if err := d.Exec("CREATE TABLE refresh_tokens (id integer PRIMARY KEY, hashed_token text)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := Up(d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Migrator().HasTable("refresh_tokens") {
+		t.Fatal("refresh_tokens not dropped")
+	}
+}
+
+func TestConvertDefaultRole(t *testing.T) {
+	d := openTestDB(t, "default-role")
+	if err := Up(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Exec("ALTER TABLE rooms ADD COLUMN default_role text").Error; err != nil {
+		t.Fatal(err)
+	}
+	creator := model.User{Username: "default-role"}
+	if err := d.Create(&creator).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []struct{ id, role string }{{"moderator", "moderator"}, {"member", "member"}, {"none", ""}} {
+		if err := d.Create(&model.Room{ID: r.id, Name: r.id, CreatorID: creator.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Exec("UPDATE rooms SET default_role = ? WHERE id = ?", r.role, r.id).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Create(&model.Movie{RoomID: "moderator", CreatorID: creator.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := convertDefaultRole(d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Migrator().HasColumn("rooms", "default_role") {
+		t.Fatal("default_role not dropped")
+	}
+	want := map[string]model.Permission{"moderator": model.RolePresetModerator.Permissions(), "member": model.DefaultPermissions, "none": model.DefaultPermissions}
+	for id, p := range want {
+		r := model.Room{}
+		if err := d.First(&r, "id = ?", id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got := r.MemberPermissions(); got != p {
+			t.Fatalf("room %s permissions = %d, want %d", id, got, p)
+		}
+	}
+	var movies int64
+	if err := d.Model(&model.Movie{}).Count(&movies).Error; err != nil {
+		t.Fatal(err)
+	}
+	if movies != 1 {
+		t.Fatal("the movies of the rooms were deleted")
+	}
+	if err := convertDefaultRole(d); err != nil {
+		t.Fatalf("convert twice: %v", err)
+	}
+}
+
+func TestRenameDeletedRooms(t *testing.T) {
+	d := openTestDB(t, "deleted-rooms")
+	if err := Up(d); err != nil {
+		t.Fatal(err)
+	}
+	creator := model.User{Username: "deleted-rooms"}
+	if err := d.Create(&creator).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"live", "deleted", "renamed"} {
+		if err := d.Create(&model.Room{ID: id, Name: id, CreatorID: creator.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Exec("UPDATE rooms SET name = ? WHERE id = ?", "renamed#deleted-renamed", "renamed").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Where("id IN ?", []string{"deleted", "renamed"}).Delete(&model.Room{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := renameDeletedRooms(d); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"live": "live", "deleted": "deleted#deleted-deleted", "renamed": "renamed#deleted-renamed"}
+	for id, name := range want {
+		r := model.Room{}
+		if err := d.Unscoped().First(&r, "id = ?", id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if r.Name != name {
+			t.Fatalf("room %s name = %q, want %q", id, r.Name, name)
+		}
+	}
+}
@@ -9,11 +9,37 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+// CreateMovie appends movie to the end of the playlist of its room
 func CreateMovie(movie *model.Movie) error {
-	return db.Create(movie).Error
+	return db.Transaction(func(tx *gorm.DB) error {
+		var last uint
+		err := tx.Model(&model.Movie{}).Where("room_id = ?", movie.RoomID).Select("COALESCE(MAX(position), 0)").Scan(&last).Error
+		if err != nil {
+			return err
+		}
+		movie.Position = last + 1
+		return tx.Create(movie).Error
+	})
+}
+
+// CreateMovies appends the movies to the playlist of the room roomID in order,
+// all of them or none
+func CreateMovies(roomID string, movies []*model.Movie) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var last uint
+		err := tx.Model(&model.Movie{}).Where("room_id = ?", roomID).Select("COALESCE(MAX(position), 0)").Scan(&last).Error
+		if err != nil {
+			return err
+		}
+		for i, m := range movies {
+			m.RoomID = roomID
+			m.Position = last + uint(i) + 1
+		}
+		return tx.Create(movies).Error
+	})
 }
 
-func GetAllMoviesByRoomID(roomID uint) ([]*model.Movie, error) {
+func GetAllMoviesByRoomID(roomID string) ([]*model.Movie, error) {
 	movies := []*model.Movie{}
 	err := db.Where("room_id = ?", roomID).Order("position ASC").Find(&movies).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
@@ -22,7 +48,7 @@ func GetAllMoviesByRoomID(roomID uint) ([]*model.Movie, error) {
 	return movies, err
 }
 
-func DeleteMovieByID(roomID, id uint) error {
+func DeleteMovieByID(roomID string, id uint) error {
 	err := db.Unscoped().Where("room_id = ? AND id = ?", roomID, id).Delete(&model.Movie{}).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return errors.New("room or movie not found")
@@ -30,16 +56,16 @@ func DeleteMovieByID(roomID, id uint) error {
 	return err
 }
 
-func LoadAndDeleteMovieByID(roomID, id uint, columns ...clause.Column) (*model.Movie, error) {
+func LoadAndDeleteMovieByID(roomID string, id uint, columns ...clause.Column) (*model.Movie, error) {
 	movie := &model.Movie{}
-	err := db.Unscoped().Clauses(clause.Returning{Columns: columns}).Where("room_id = ? AND id = ?", roomID, id).Delete(movie).Error
+	err := deleteReturning(db.Unscoped().Where("room_id = ? AND id = ?", roomID, id), movie, columns...)
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return movie, errors.New("room or movie not found")
 	}
 	return movie, err
 }
 
-func DeleteMoviesByRoomID(roomID uint) error {
+func DeleteMoviesByRoomID(roomID string) error {
 	err := db.Unscoped().Where("room_id = ?", roomID).Delete(&model.Movie{}).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return errors.New("room not found")
@@ -47,9 +73,9 @@ func DeleteMoviesByRoomID(roomID uint) error {
 	return err
 }
 
-func LoadAndDeleteMoviesByRoomID(roomID uint, columns ...clause.Column) ([]*model.Movie, error) {
+func LoadAndDeleteMoviesByRoomID(roomID string, columns ...clause.Column) ([]*model.Movie, error) {
 	movies := []*model.Movie{}
-	err := db.Unscoped().Clauses(clause.Returning{Columns: columns}).Where("room_id = ?", roomID).Delete(&movies).Error
+	err := deleteReturning(db.Unscoped().Where("room_id = ?", roomID), &movies, columns...)
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, errors.New("room not found")
 	}
@@ -72,38 +98,68 @@ func SaveMovie(movie *model.Movie, columns ...clause.Column) error {
 	return err
 }
 
-func SwapMoviePositions(roomID uint, movie1ID uint, movie2ID uint) (err error) {
-	tx := db.Begin()
-	defer func() {
+// SetMovieMeta stores the probed metadata of a movie
+func SetMovieMeta(roomID string, id uint, meta model.MovieMeta) error {
+	err := db.Model(&model.Movie{}).Where("room_id = ? AND id = ?", roomID, id).Updates(map[string]any{
+		"meta_duration":  meta.Duration,
+		"meta_width":     meta.Width,
+		"meta_height":    meta.Height,
+		"meta_codec":     meta.Codec,
+		"meta_thumbnail": meta.Thumbnail,
+	}).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("room or movie not found")
+	}
+	return err
+}
+
+// MoveMovie moves a movie to the end of the folder parentID
+func MoveMovie(roomID string, id, parentID uint) (position uint, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var last uint
+		err := tx.Model(&model.Movie{}).Where("room_id = ?", roomID).Select("COALESCE(MAX(position), 0)").Scan(&last).Error
 		if err != nil {
-			tx.Rollback()
-		} else {
-			tx.Commit()
+			return err
 		}
-	}()
-	movie1 := &model.Movie{}
-	movie2 := &model.Movie{}
-	err = tx.Select("position").Where("room_id = ? AND id = ?", roomID, movie1ID).First(movie1).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			err = fmt.Errorf("movie with id %d not found", movie1ID)
+		position = last + 1
+		result := tx.Model(&model.Movie{}).Where("room_id = ? AND id = ?", roomID, id).Updates(map[string]any{
+			"parent_id": parentID,
+			"position":  position,
+		})
+		if result.Error != nil {
+			return result.Error
 		}
-		return
-	}
-	err = tx.Select("position").Where("room_id = ? AND id = ?", roomID, movie2ID).First(movie2).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			err = fmt.Errorf("movie with id %d not found", movie2ID)
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("movie with id %d not found", id)
 		}
-		return
-	}
-	err = tx.Model(&model.Movie{}).Where("room_id = ? AND id = ?", roomID, movie1ID).Update("position", movie2.Position).Error
-	if err != nil {
-		return
-	}
-	err = tx.Model(&model.Movie{}).Where("room_id = ? AND id = ?", roomID, movie2ID).Update("position", movie1.Position).Error
-	if err != nil {
-		return
-	}
+		return nil
+	})
 	return
 }
+
+// SwapMoviePositions swaps the positions of two movies in one transaction
+func SwapMoviePositions(roomID string, movie1ID uint, movie2ID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		movie1 := &model.Movie{}
+		movie2 := &model.Movie{}
+		err := tx.Select("position").Where("room_id = ? AND id = ?", roomID, movie1ID).First(movie1).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("movie with id %d not found", movie1ID)
+			}
+			return err
+		}
+		err = tx.Select("position").Where("room_id = ? AND id = ?", roomID, movie2ID).First(movie2).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("movie with id %d not found", movie2ID)
+			}
+			return err
+		}
+		err = tx.Model(&model.Movie{}).Where("room_id = ? AND id = ?", roomID, movie1ID).Update("position", movie2.Position).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&model.Movie{}).Where("room_id = ? AND id = ?", roomID, movie2ID).Update("position", movie1.Position).Error
+	})
+}
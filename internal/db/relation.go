@@ -7,13 +7,15 @@ import (
 	"gorm.io/gorm"
 )
 
-func GetRoomUserRelation(roomID, userID uint) (*model.RoomUserRelation, error) {
+// GetRoomUserRelation returns the relation of the user, or an unsaved one with
+// the permissions of new members if the user is not a member
+func GetRoomUserRelation(roomID string, userID uint, defaultPermissions model.Permission) (*model.RoomUserRelation, error) {
 	roomUserRelation := &model.RoomUserRelation{}
 	err := db.Where("room_id = ? AND user_id = ?", roomID, userID).Attrs(&model.RoomUserRelation{
 		RoomID:      roomID,
 		UserID:      userID,
 		Role:        model.RoomRoleUser,
-		Permissions: model.DefaultPermissions,
+		Permissions: defaultPermissions,
 	}).FirstOrInit(roomUserRelation).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return roomUserRelation, errors.New("room or user not found")
@@ -21,7 +23,24 @@ func GetRoomUserRelation(roomID, userID uint) (*model.RoomUserRelation, error) {
 	return roomUserRelation, err
 }
 
-func CreateRoomUserRelation(roomID, userID uint, role model.RoomRole, permissions model.Permission) (*model.RoomUserRelation, error) {
+func FirstOrCreateRoomUserRelation(roomID string, userID uint, defaultPermissions model.Permission) (*model.RoomUserRelation, error) {
+	roomUserRelation := &model.RoomUserRelation{}
+	err := db.Where("room_id = ? AND user_id = ?", roomID, userID).Attrs(&model.RoomUserRelation{
+		RoomID:      roomID,
+		UserID:      userID,
+		Role:        model.RoomRoleUser,
+		Permissions: defaultPermissions,
+	}).FirstOrCreate(roomUserRelation).Error
+	return roomUserRelation, err
+}
+
+func GetRoomUserRelations(roomID string) ([]*model.RoomUserRelation, error) {
+	relations := []*model.RoomUserRelation{}
+	err := db.Where("room_id = ?", roomID).Order("id").Find(&relations).Error
+	return relations, err
+}
+
+func CreateRoomUserRelation(roomID string, userID uint, role model.RoomRole, permissions model.Permission) (*model.RoomUserRelation, error) {
 	roomUserRelation := &model.RoomUserRelation{
 		RoomID:      roomID,
 		UserID:      userID,
@@ -32,7 +51,7 @@ func CreateRoomUserRelation(roomID, userID uint, role model.RoomRole, permission
 	return roomUserRelation, err
 }
 
-func SetUserRole(roomID uint, userID uint, role model.RoomRole) error {
+func SetUserRole(roomID string, userID uint, role model.RoomRole) error {
 	err := db.Model(&model.RoomUserRelation{}).Where("room_id = ? AND user_id = ?", roomID, userID).Update("role", role).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return errors.New("room or user not found")
@@ -40,7 +59,7 @@ func SetUserRole(roomID uint, userID uint, role model.RoomRole) error {
 	return err
 }
 
-func SetUserPermission(roomID uint, userID uint, permission model.Permission) error {
+func SetUserPermission(roomID string, userID uint, permission model.Permission) error {
 	err := db.Model(&model.RoomUserRelation{}).Where("room_id = ? AND user_id = ?", roomID, userID).Update("permissions", permission).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return errors.New("room or user not found")
@@ -48,7 +67,7 @@ func SetUserPermission(roomID uint, userID uint, permission model.Permission) er
 	return err
 }
 
-func AddUserPermission(roomID uint, userID uint, permission model.Permission) error {
+func AddUserPermission(roomID string, userID uint, permission model.Permission) error {
 	err := db.Model(&model.RoomUserRelation{}).Where("room_id = ? AND user_id = ?", roomID, userID).Update("permissions", db.Raw("permissions | ?", permission)).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return errors.New("room or user not found")
@@ -56,7 +75,7 @@ func AddUserPermission(roomID uint, userID uint, permission model.Permission) er
 	return err
 }
 
-func RemoveUserPermission(roomID uint, userID uint, permission model.Permission) error {
+func RemoveUserPermission(roomID string, userID uint, permission model.Permission) error {
 	err := db.Model(&model.RoomUserRelation{}).Where("room_id = ? AND user_id = ?", roomID, userID).Update("permissions", db.Raw("permissions & ?", ^permission)).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return errors.New("room or user not found")
@@ -64,7 +83,7 @@ func RemoveUserPermission(roomID uint, userID uint, permission model.Permission)
 	return err
 }
 
-func DeleteUserPermission(roomID uint, userID uint) error {
+func DeleteUserPermission(roomID string, userID uint) error {
 	err := db.Unscoped().Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&model.RoomUserRelation{}).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return errors.New("room or user not found")
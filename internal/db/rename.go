@@ -0,0 +1,57 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+)
+
+// RenameUser changes the username and records the change in one transaction
+func RenameUser(userID uint, oldName, newName string) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&model.User{}).Where("username = ? AND id <> ?", newName, userID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrUsernameTaken
+		}
+		res := tx.Model(&model.User{}).Where("id = ? AND username = ?", userID, oldName).Update("username", newName)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("user not found")
+		}
+		return tx.Create(&model.UsernameChange{
+			UserID:  userID,
+			OldName: oldName,
+			NewName: newName,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+// GetLastUsernameChange returns the latest rename of the user, gorm.ErrRecordNotFound if never renamed
+func GetLastUsernameChange(userID uint) (*model.UsernameChange, error) {
+	c := &model.UsernameChange{}
+	err := db.Where("user_id = ?", userID).Order("id DESC").First(c).Error
+	return c, err
+}
+
+func GetUsernameChanges(userID uint) ([]*model.UsernameChange, error) {
+	changes := []*model.UsernameChange{}
+	err := db.Where("user_id = ?", userID).Order("id DESC").Find(&changes).Error
+	return changes, err
+}
+
+// GetUsernameChangesByName returns the renames from or to the username, newest first
+func GetUsernameChangesByName(username string) ([]*model.UsernameChange, error) {
+	changes := []*model.UsernameChange{}
+	err := db.Where("old_name = ? OR new_name = ?", username, username).Order("id DESC").Find(&changes).Error
+	return changes, err
+}
@@ -1,12 +1,19 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/synctv-org/synctv/internal/model"
 	"github.com/zijiren233/stream"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 type CreateRoomConfig func(r *model.Room)
@@ -36,7 +43,21 @@ func WithRelations(relations []model.RoomUserRelation) CreateRoomConfig {
 	}
 }
 
-func CreateRoom(name, password string, conf ...CreateRoomConfig) (*model.Room, error) {
+func WithScheduledAt(t time.Time) CreateRoomConfig {
+	return func(r *model.Room) {
+		r.ScheduledAt = t
+	}
+}
+
+func WithMovies(movies []model.Movie) CreateRoomConfig {
+	return func(r *model.Room) {
+		r.Movies = append(r.Movies, movies...)
+	}
+}
+
+var ErrTooManyRooms = errors.New("too many rooms")
+
+func newRoom(name, password string, conf ...CreateRoomConfig) (*model.Room, error) {
 	var hashedPassword []byte
 	if password != "" {
 		var err error
@@ -48,27 +69,78 @@ func CreateRoom(name, password string, conf ...CreateRoomConfig) (*model.Room, e
 	r := &model.Room{
 		Name:           name,
 		HashedPassword: hashedPassword,
+		LastActiveAt:   time.Now(),
 	}
 	for _, c := range conf {
 		c(r)
 	}
-	err := db.Create(r).Error
+	return r, nil
+}
+
+func CreateRoom(name, password string, conf ...CreateRoomConfig) (*model.Room, error) {
+	return CreateRoomWithQuota(0, name, password, conf...)
+}
+
+// CreateRoomWithQuota is CreateRoom failing with ErrTooManyRooms when the creator
+// already has max rooms, 0 for no limit. The creator is locked while its rooms
+// are counted, so concurrent requests can't exceed the quota.
+func CreateRoomWithQuota(max int64, name, password string, conf ...CreateRoomConfig) (*model.Room, error) {
+	return CreateRoomWithQuotaContext(context.Background(), max, name, password, conf...)
+}
+
+// CreateRoomWithQuotaContext is CreateRoomWithQuota with the queries made in ctx
+func CreateRoomWithQuotaContext(ctx context.Context, max int64, name, password string, conf ...CreateRoomConfig) (*model.Room, error) {
+	r, err := newRoom(name, password, conf...)
+	if err != nil {
+		return nil, err
+	}
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if max > 0 && r.CreatorID != 0 {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&model.User{}, r.CreatorID).Error; err != nil {
+				return err
+			}
+			var n int64
+			if err := tx.Model(&model.Room{}).Where("creator_id = ?", r.CreatorID).Count(&n).Error; err != nil {
+				return err
+			}
+			if n >= max {
+				return ErrTooManyRooms
+			}
+		}
+		if len(r.Tags) != 0 {
+			names := make([]string, len(r.Tags))
+			for i, t := range r.Tags {
+				names[i] = t.Name
+			}
+			tags, err := firstOrCreateTags(tx, names)
+			if err != nil {
+				return err
+			}
+			r.Tags = tags
+		}
+		return tx.Create(r).Error
+	})
 	if err != nil && errors.Is(err, gorm.ErrDuplicatedKey) {
 		return r, errors.New("room already exists")
 	}
 	return r, err
 }
 
-func GetRoomByID(id uint) (*model.Room, error) {
+func GetRoomByID(id string) (*model.Room, error) {
+	return GetRoomByIDContext(context.Background(), id)
+}
+
+// GetRoomByIDContext is GetRoomByID with the queries made in ctx
+func GetRoomByIDContext(ctx context.Context, id string) (*model.Room, error) {
 	r := &model.Room{}
-	err := db.Where("id = ?", id).First(r).Error
+	err := db.WithContext(ctx).Preload("Tags").Where("id = ?", id).First(r).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return r, errors.New("room not found")
 	}
 	return r, err
 }
 
-func GetRoomAndCreatorByID(id uint) (*model.Room, error) {
+func GetRoomAndCreatorByID(id string) (*model.Room, error) {
 	r := &model.Room{}
 	err := db.Preload("Creator").Where("id = ?", id).First(r).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
@@ -77,23 +149,74 @@ func GetRoomAndCreatorByID(id uint) (*model.Room, error) {
 	return r, err
 }
 
-func ChangeRoomSetting(roomID uint, setting model.Setting) error {
-	err := db.Model(&model.Room{}).Where("id = ?", roomID).Update("setting", setting).Error
-	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+// settingColumns are the room columns of the embedded setting
+func settingColumns() ([]string, error) {
+	s, err := schema.Parse(&model.Setting{}, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		return nil, err
+	}
+	return s.DBNames, nil
+}
+
+func ChangeRoomSetting(roomID string, setting model.Setting) error {
+	columns, err := settingColumns()
+	if err != nil {
+		return err
+	}
+	// select the columns so false and zero values are written too
+	result := db.Model(&model.Room{}).Where("id = ?", roomID).Select(columns).Updates(&model.Room{Setting: setting})
+	if result.Error == nil && result.RowsAffected == 0 {
 		return errors.New("room not found")
 	}
-	return err
+	return result.Error
 }
 
-func ChangeUserPermission(roomID uint, userID uint, permission model.Permission) error {
-	err := db.Model(&model.RoomUserRelation{}).Where("room_id = ? AND user_id = ?", roomID, userID).Update("permissions", permission).Error
-	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-		return errors.New("room or user not found")
+// ChangeUserPermission adds and removes permissions of the member audit.TargetID
+// of the room audit.RoomID, and records audit with the permissions before and after
+func ChangeUserPermission(audit *model.PermissionAudit, add, remove model.Permission) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return changeUserPermission(tx, audit, add, remove)
+	})
+}
+
+// ChangeUsersPermission applies the changes of actorID to the members of the
+// room in one transaction, nothing is changed if one of them fails
+func ChangeUsersPermission(roomID string, actorID uint, changes []model.PermissionChange) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, c := range changes {
+			err := changeUserPermission(tx, &model.PermissionAudit{
+				RoomID:   roomID,
+				ActorID:  actorID,
+				TargetID: c.UserID,
+			}, c.Add, c.Remove)
+			if err != nil {
+				return fmt.Errorf("user %d: %w", c.UserID, err)
+			}
+		}
+		return nil
+	})
+}
+
+func changeUserPermission(tx *gorm.DB, audit *model.PermissionAudit, add, remove model.Permission) error {
+	ur := &model.RoomUserRelation{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("room_id = ? AND user_id = ?", audit.RoomID, audit.TargetID).
+		First(ur).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = errors.New("room or user not found")
+		}
+		return err
 	}
-	return err
+	audit.Before = ur.Permissions
+	audit.After = (ur.Permissions | add) &^ remove
+	if err := tx.Model(ur).Update("permissions", audit.After).Error; err != nil {
+		return err
+	}
+	return tx.Create(audit).Error
 }
 
-func HasPermission(roomID uint, userID uint, permission model.Permission) (bool, error) {
+func HasPermission(roomID string, userID uint, permission model.Permission) (bool, error) {
 	ur := &model.RoomUserRelation{}
 	err := db.Where("room_id = ? AND user_id = ?", roomID, userID).First(ur).Error
 	if err != nil {
@@ -105,15 +228,168 @@ func HasPermission(roomID uint, userID uint, permission model.Permission) (bool,
 	return ur.Permissions.Has(permission), nil
 }
 
-func DeleteRoomByID(roomID uint) error {
-	err := db.Unscoped().Delete(&model.Room{}, roomID).Error
+func DeleteRoomByID(roomID string) error {
+	err := db.Unscoped().Where("id = ?", roomID).Delete(&model.Room{}).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return errors.New("room not found")
 	}
 	return err
 }
 
-func HasRoom(roomID uint) (bool, error) {
+// deletedRoomName is the name of a soft deleted room, so that its name is
+// free for new rooms while the unique index still covers every row
+func deletedRoomName(name, roomID string) string {
+	return name + "#deleted-" + roomID
+}
+
+// SoftDeleteRoomByID marks the room as deleted, it can be restored until purged
+func SoftDeleteRoomByID(roomID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		r := &model.Room{}
+		if err := tx.Select("id", "name").Where("id = ?", roomID).First(r).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("room not found")
+			}
+			return err
+		}
+		return tx.Model(&model.Room{}).Where("id = ?", roomID).Updates(map[string]any{
+			"name":       deletedRoomName(r.Name, r.ID),
+			"deleted_at": time.Now(),
+		}).Error
+	})
+}
+
+// RestoreRoom restores a soft deleted room with its name, or with the name it
+// was deleted under when a room has taken the name since
+func RestoreRoom(roomID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		r := &model.Room{}
+		err := tx.Unscoped().Select("id", "name").Where("id = ? AND deleted_at IS NOT NULL", roomID).First(r).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("deleted room not found")
+			}
+			return err
+		}
+		updates := map[string]any{"deleted_at": nil}
+		if name, ok := strings.CutSuffix(r.Name, deletedRoomName("", r.ID)); ok {
+			var taken int64
+			if err := tx.Unscoped().Model(&model.Room{}).Where("name = ?", name).Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken == 0 {
+				updates["name"] = name
+			}
+		}
+		return tx.Unscoped().Model(&model.Room{}).Where("id = ?", roomID).Updates(updates).Error
+	})
+}
+
+// PurgeDeletedRooms hard deletes rooms soft deleted before t, it returns the
+// keys of their subtitle files
+func PurgeDeletedRooms(t time.Time) (int64, []string, error) {
+	var (
+		n    int64
+		keys []string
+	)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		if err := tx.Unscoped().Model(&model.Room{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", t).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.Model(&model.Subtitle{}).Where("room_id IN ?", ids).Pluck("key", &keys).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("id IN ?", ids).Delete(&model.Room{})
+		n = result.RowsAffected
+		return result.Error
+	})
+	return n, keys, err
+}
+
+func SaveRoomState(state *model.RoomState) error {
+	return db.Clauses(clause.OnConflict{UpdateAll: true}).Create(state).Error
+}
+
+func GetRoomState(roomID string) (*model.RoomState, error) {
+	s := &model.RoomState{}
+	err := db.Where("room_id = ?", roomID).First(s).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return s, errors.New("room state not found")
+	}
+	return s, err
+}
+
+// TransferRoom makes the member to the creator of the room, the previous
+// creator from becomes a member with memberPermissions, both changes are
+// recorded in the permission audit as made by actorID
+func TransferRoom(roomID string, actorID, from, to uint, memberPermissions model.Permission) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		ur := &model.RoomUserRelation{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("room_id = ? AND user_id = ? AND role <> ?", roomID, to, model.RoomRoleBanned).
+			First(ur).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = errors.New("user is not a member of the room")
+			}
+			return err
+		}
+		if err := setRoleAndPermissions(tx, ur, actorID, model.RoomRoleCreator, model.AllPermissions); err != nil {
+			return err
+		}
+		ur = &model.RoomUserRelation{}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("room_id = ? AND user_id = ?", roomID, from).
+			First(ur).Error
+		switch {
+		case err == nil:
+			if err := setRoleAndPermissions(tx, ur, actorID, model.RoomRoleUser, memberPermissions); err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+		return tx.Model(&model.Room{}).Where("id = ?", roomID).Update("creator_id", to).Error
+	})
+}
+
+func setRoleAndPermissions(tx *gorm.DB, ur *model.RoomUserRelation, actorID uint, role model.RoomRole, permissions model.Permission) error {
+	before := ur.Permissions
+	err := tx.Model(ur).Updates(map[string]any{"role": role, "permissions": permissions}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.PermissionAudit{
+		RoomID:   ur.RoomID,
+		ActorID:  actorID,
+		TargetID: ur.UserID,
+		Before:   before,
+		After:    permissions,
+	}).Error
+}
+
+func SetRoomLastActive(roomID string, t time.Time) error {
+	return db.Model(&model.Room{}).Where("id = ?", roomID).Update("last_active_at", t).Error
+}
+
+// GetInactiveRoomIDs returns the rooms created and last active before t, except permanent rooms.
+// Rooms never marked active, whose last_active_at is zero or null, count as
+// last active when they were last updated.
+func GetInactiveRoomIDs(t time.Time) ([]string, error) {
+	var ids []string
+	zero := time.Time{}
+	err := db.Model(&model.Room{}).
+		Where("permanent = ? AND created_at < ?", false, t).
+		Where("(last_active_at > ? AND last_active_at < ?) OR ((last_active_at IS NULL OR last_active_at <= ?) AND updated_at < ?)", zero, t, zero, t).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+func HasRoom(roomID string) (bool, error) {
 	r := &model.Room{}
 	err := db.Where("id = ?", roomID).First(r).Error
 	if err != nil {
@@ -137,7 +413,7 @@ func HasRoomByName(name string) (bool, error) {
 	return true, nil
 }
 
-func SetRoomPassword(roomID uint, password string) error {
+func SetRoomPassword(roomID string, password string) error {
 	var hashedPassword []byte
 	if password != "" {
 		var err error
@@ -149,7 +425,7 @@ func SetRoomPassword(roomID uint, password string) error {
 	return SetRoomHashedPassword(roomID, hashedPassword)
 }
 
-func SetRoomHashedPassword(roomID uint, hashedPassword []byte) error {
+func SetRoomHashedPassword(roomID string, hashedPassword []byte) error {
 	err := db.Model(&model.Room{}).Where("id = ?", roomID).Update("hashed_password", hashedPassword).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return errors.New("room not found")
@@ -159,7 +435,7 @@ func SetRoomHashedPassword(roomID uint, hashedPassword []byte) error {
 
 func GetAllRooms() ([]*model.Room, error) {
 	rooms := []*model.Room{}
-	err := db.Find(&rooms).Error
+	err := db.Preload("Tags").Find(&rooms).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return rooms, nil
 	}
@@ -175,6 +451,112 @@ func GetAllRoomsAndCreator() ([]*model.Room, error) {
 	return rooms, err
 }
 
+type RoomsSort string
+
+const (
+	RoomsSortID           RoomsSort = "roomId"
+	RoomsSortName         RoomsSort = "roomName"
+	RoomsSortCreatedAt    RoomsSort = "createdAt"
+	RoomsSortCreator      RoomsSort = "creator"
+	RoomsSortNeedPassword RoomsSort = "needPassword"
+)
+
+type GetRoomsConfig func(tx *gorm.DB) *gorm.DB
+
+func WithoutHidden() GetRoomsConfig {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("rooms.hidden = ?", false)
+	}
+}
+
+// WithDeletedRooms matches the soft deleted rooms instead of the others
+func WithDeletedRooms() GetRoomsConfig {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Unscoped().Where("rooms.deleted_at IS NOT NULL")
+	}
+}
+
+func WithoutRoomIDs(ids ...string) GetRoomsConfig {
+	return func(tx *gorm.DB) *gorm.DB {
+		if len(ids) == 0 {
+			return tx
+		}
+		return tx.Where("rooms.id NOT IN ?", ids)
+	}
+}
+
+// WithKeyword matches rooms whose name or creator's username contains keyword, case-insensitively
+func WithKeyword(keyword string) GetRoomsConfig {
+	return func(tx *gorm.DB) *gorm.DB {
+		like := "%" + likeEscaper.Replace(strings.ToLower(keyword)) + "%"
+		return tx.Where(
+			"LOWER(rooms.name) LIKE ? ESCAPE '!' OR rooms.creator_id IN (?)",
+			like,
+			db.Model(&model.User{}).Select("id").Where("LOWER(username) LIKE ? ESCAPE '!'", like),
+		)
+	}
+}
+
+// likeEscaper escapes LIKE wildcards with '!', which needs no quoting in any supported database
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func WithRoomsOrder(sort RoomsSort, desc bool) GetRoomsConfig {
+	return func(tx *gorm.DB) *gorm.DB {
+		switch sort {
+		case RoomsSortName:
+			tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Table: "rooms", Name: "name"}, Desc: desc})
+		case RoomsSortCreatedAt:
+			tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Table: "rooms", Name: "created_at"}, Desc: desc})
+		case RoomsSortCreator:
+			tx = tx.Joins("LEFT JOIN users ON users.id = rooms.creator_id").
+				Order(clause.OrderByColumn{Column: clause.Column{Table: "users", Name: "username"}, Desc: desc})
+		case RoomsSortNeedPassword:
+			sql := "CASE WHEN rooms.hashed_password IS NULL OR LENGTH(rooms.hashed_password) = 0 THEN 0 ELSE 1 END"
+			if desc {
+				sql += " DESC"
+			}
+			tx = tx.Order(sql)
+		}
+		// room id is unique, so pages are stable when the sort column has ties
+		return tx.Order(clause.OrderByColumn{Column: clause.Column{Table: "rooms", Name: "id"}, Desc: desc})
+	}
+}
+
+// GetRoomsPaginated returns at most limit rooms starting at offset,
+// and the total number of rooms matching the filters
+func GetRoomsPaginated(offset, limit int, conf ...GetRoomsConfig) ([]*model.Room, int64, error) {
+	query := func() *gorm.DB {
+		tx := db.Model(&model.Room{})
+		for _, c := range conf {
+			tx = c(tx)
+		}
+		return tx
+	}
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	rooms := []*model.Room{}
+	err := query().Select("rooms.*").Preload("Tags").Offset(offset).Limit(limit).Find(&rooms).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return rooms, total, nil
+	}
+	return rooms, total, err
+}
+
+// FilterRoomIDs returns the ids among ids of the rooms matching conf
+func FilterRoomIDs(ids []string, conf ...GetRoomsConfig) ([]string, error) {
+	matched := []string{}
+	if len(ids) == 0 {
+		return matched, nil
+	}
+	tx := db.Model(&model.Room{}).Where("rooms.id IN ?", ids)
+	for _, c := range conf {
+		tx = c(tx)
+	}
+	return matched, tx.Pluck("rooms.id", &matched).Error
+}
+
 func GetAllRoomsByUserID(userID uint) ([]*model.Room, error) {
 	rooms := []*model.Room{}
 	err := db.Where("creator_id = ?", userID).Find(&rooms).Error
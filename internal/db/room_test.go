@@ -0,0 +1,148 @@
+package db_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// initTestDB uses a new in memory database named name
+func initTestDB(t *testing.T, name string) {
+	t.Helper()
+	conf.Set(conf.DefaultConfig())
+	d, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared&_pragma=foreign_keys(1)"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Init(d); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetRoomsPaginated(t *testing.T) {
+	initTestDB(t, "rooms-paginated")
+
+	alice, err := db.CreateUser("alice", "github", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := db.CreateUser("bob", "github", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []struct {
+		name, password string
+		creator        *model.User
+		hidden         bool
+	}{
+		{"b-room", "secret", bob, false},
+		{"a-room", "", alice, false},
+		{"c_room", "", alice, true},
+	} {
+		if _, err := db.CreateRoom(r.name, r.password, db.WithCreator(r.creator), db.WithSetting(model.Setting{Hidden: r.hidden})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(offset, limit int, conf ...db.GetRoomsConfig) (string, int64) {
+		t.Helper()
+		rooms, total, err := db.GetRoomsPaginated(offset, limit, conf...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, len(rooms))
+		for i, r := range rooms {
+			names[i] = r.Name
+		}
+		return strings.Join(names, ","), total
+	}
+
+	for _, c := range []struct {
+		sort db.RoomsSort
+		desc bool
+		want string
+	}{
+		{db.RoomsSortName, false, "a-room,b-room,c_room"},
+		{db.RoomsSortName, true, "c_room,b-room,a-room"},
+		{db.RoomsSortNeedPassword, true, "b-room"},
+		{db.RoomsSortCreator, true, "b-room"},
+	} {
+		names, total := list(0, 10, db.WithRoomsOrder(c.sort, c.desc))
+		if total != 3 || !strings.HasPrefix(names, c.want) {
+			t.Errorf("sort %s desc %v = %s (total %d), want %s first", c.sort, c.desc, names, total, c.want)
+		}
+	}
+
+	var paged []string
+	for offset := 0; offset < 3; offset += 2 {
+		names, total := list(offset, 2, db.WithRoomsOrder(db.RoomsSortName, false))
+		if total != 3 {
+			t.Fatalf("offset %d: total = %d, want 3", offset, total)
+		}
+		paged = append(paged, names)
+	}
+	if got := strings.Join(paged, ","); got != "a-room,b-room,c_room" {
+		t.Fatalf("pages = %s", got)
+	}
+	if names, total := list(10, 2); names != "" || total != 3 {
+		t.Fatalf("page past the end = %s (total %d), want none of 3", names, total)
+	}
+
+	for _, c := range []struct {
+		conf []db.GetRoomsConfig
+		want string
+	}{
+		{[]db.GetRoomsConfig{db.WithoutHidden()}, "a-room,b-room"},
+		// the creator's username matches too
+		{[]db.GetRoomsConfig{db.WithKeyword("BOB")}, "b-room"},
+		// _ is not a wildcard
+		{[]db.GetRoomsConfig{db.WithKeyword("_")}, "c_room"},
+		{[]db.GetRoomsConfig{db.WithKeyword("room"), db.WithoutHidden()}, "a-room,b-room"},
+	} {
+		names, total := list(0, 10, append(c.conf, db.WithRoomsOrder(db.RoomsSortName, false))...)
+		if names != c.want || total != int64(strings.Count(c.want, ",")+1) {
+			t.Errorf("filtered rooms = %s (total %d), want %s", names, total, c.want)
+		}
+	}
+}
+
+func TestCreateRoomTags(t *testing.T) {
+	initTestDB(t, "room-tags")
+
+	u, err := db.CreateUser("tagger", "github", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FirstOrCreateTags([]string{"anime"}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.CreateRoom("tagged", "", db.WithCreator(u), db.WithTagNames([]string{"anime", "music"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = db.GetRoomByID(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Tags) != 2 {
+		t.Fatalf("tags = %+v, want anime and music", r.Tags)
+	}
+
+	// the tags of a room that fails to be created are not created either
+	if _, err := db.CreateRoom("tagged", "", db.WithCreator(u), db.WithTagNames([]string{"movies"})); err == nil {
+		t.Fatal("created a room with a duplicated name")
+	}
+	var n int64
+	if err := db.DB().Model(&model.Tag{}).Where("name = ?", "movies").Count(&n).Error; err != nil || n != 0 {
+		t.Fatalf("tags of the failed room = %d, %v, want none", n, err)
+	}
+}
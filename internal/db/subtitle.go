@@ -0,0 +1,72 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+)
+
+func CreateSubtitle(s *model.Subtitle) error {
+	return db.Create(s).Error
+}
+
+func GetSubtitlesByMovieID(movieID uint) ([]*model.Subtitle, error) {
+	subtitles := []*model.Subtitle{}
+	err := db.Where("movie_id = ?", movieID).Order("id ASC").Find(&subtitles).Error
+	return subtitles, err
+}
+
+func GetSubtitle(roomID string, id uint) (*model.Subtitle, error) {
+	s := &model.Subtitle{}
+	err := db.Where("room_id = ? AND id = ?", roomID, id).First(s).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return s, errors.New("subtitle not found")
+	}
+	return s, err
+}
+
+// GetSubtitleByKey returns the subtitle of the room stored under key
+func GetSubtitleByKey(roomID, key string) (*model.Subtitle, error) {
+	s := &model.Subtitle{}
+	err := db.Where(&model.Subtitle{RoomID: roomID, Key: key}).First(s).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return s, errors.New("subtitle not found")
+	}
+	return s, err
+}
+
+// GetSubtitleKeysByRoomIDs returns the file keys of the subtitles of the rooms,
+// the rows go with the rooms but the files have to be deleted after them
+func GetSubtitleKeysByRoomIDs(roomIDs []string) ([]string, error) {
+	keys := []string{}
+	if len(roomIDs) == 0 {
+		return keys, nil
+	}
+	err := db.Model(&model.Subtitle{}).Where("room_id IN ?", roomIDs).Pluck("key", &keys).Error
+	return keys, err
+}
+
+func LoadAndDeleteSubtitle(roomID string, id uint) (*model.Subtitle, error) {
+	s := &model.Subtitle{}
+	err := deleteReturning(db.Unscoped().Where("room_id = ? AND id = ?", roomID, id), s)
+	if err == nil && s.ID == 0 {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return s, errors.New("subtitle not found")
+	}
+	return s, err
+}
+
+func LoadAndDeleteSubtitlesByMovieID(movieID uint) ([]*model.Subtitle, error) {
+	subtitles := []*model.Subtitle{}
+	err := deleteReturning(db.Unscoped().Where("movie_id = ?", movieID), &subtitles)
+	return subtitles, err
+}
+
+func LoadAndDeleteSubtitlesByRoomID(roomID string) ([]*model.Subtitle, error) {
+	subtitles := []*model.Subtitle{}
+	err := deleteReturning(db.Unscoped().Where("room_id = ?", roomID), &subtitles)
+	return subtitles, err
+}
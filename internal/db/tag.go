@@ -0,0 +1,63 @@
+package db
+
+import (
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FirstOrCreateTags returns the tags with the given names, creating the missing ones
+func FirstOrCreateTags(names []string) ([]model.Tag, error) {
+	tags := make([]model.Tag, 0, len(names))
+	if len(names) == 0 {
+		return tags, nil
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		tags, err = firstOrCreateTags(tx, names)
+		return err
+	})
+	return tags, err
+}
+
+func firstOrCreateTags(tx *gorm.DB, names []string) ([]model.Tag, error) {
+	create := make([]model.Tag, len(names))
+	for i, name := range names {
+		create[i].Name = name
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&create).Error; err != nil {
+		return nil, err
+	}
+	tags := make([]model.Tag, 0, len(names))
+	return tags, tx.Where("name IN ?", names).Find(&tags).Error
+}
+
+func SetRoomTags(roomID string, tags []model.Tag) error {
+	return db.Model(&model.Room{ID: roomID}).Association("Tags").Replace(tags)
+}
+
+func WithTags(tags []model.Tag) CreateRoomConfig {
+	return func(r *model.Room) {
+		r.Tags = append(r.Tags, tags...)
+	}
+}
+
+// WithTagNames tags the room with names, the missing tags are created with the room
+func WithTagNames(names []string) CreateRoomConfig {
+	return func(r *model.Room) {
+		for _, name := range names {
+			r.Tags = append(r.Tags, model.Tag{Name: name})
+		}
+	}
+}
+
+// WithTag matches rooms tagged with name
+func WithTag(name string) GetRoomsConfig {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("rooms.id IN (?)",
+			db.Table("room_tags").Select("room_tags.room_id").
+				Joins("JOIN tags ON tags.id = room_tags.tag_id").
+				Where("tags.name = ?", name),
+		)
+	}
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+)
+
+func CreateUserSession(s *model.UserSession) error {
+	return db.Create(s).Error
+}
+
+func GetUserSessionByToken(hashedToken string) (*model.UserSession, error) {
+	s := &model.UserSession{}
+	err := db.Where("hashed_token = ?", hashedToken).First(s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s, errors.New("session not found")
+	}
+	return s, err
+}
+
+// RotateUserSessionToken replaces the refresh token of the session, it fails
+// when the old token was already replaced, so a refresh token works once
+func RotateUserSessionToken(s *model.UserSession, hashedToken string) error {
+	res := db.Model(&model.UserSession{}).Where("id = ? AND hashed_token = ?", s.ID, s.HashedToken).Updates(map[string]any{
+		"hashed_token": hashedToken,
+		"user_agent":   s.UserAgent,
+		"ip":           s.IP,
+		"last_used_at": s.LastUsedAt,
+		"expires_at":   s.ExpiresAt,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("session not found")
+	}
+	s.HashedToken = hashedToken
+	return nil
+}
+
+func GetUserSessions(userID uint) ([]model.UserSession, error) {
+	sessions := []model.UserSession{}
+	err := db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).Order("last_used_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// DeleteUserSession deletes a session of the user
+func DeleteUserSession(userID, id uint) error {
+	res := db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.UserSession{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("session not found")
+	}
+	return nil
+}
+
+// RevokeUserTokens raises the token version of the user and deletes its sessions
+func RevokeUserTokens(userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", userID).Update("token_version", gorm.Expr("token_version + 1")).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.UserSession{}).Error
+	})
+}
+
+func CreateRevokedToken(t *model.RevokedToken) error {
+	return db.Create(t).Error
+}
+
+func GetRevokedTokens() ([]model.RevokedToken, error) {
+	tokens := []model.RevokedToken{}
+	err := db.Where("expires_at > ?", time.Now()).Find(&tokens).Error
+	return tokens, err
+}
+
+// DeleteExpiredTokens drops the sessions and revoked tokens past their expiry
+func DeleteExpiredTokens() error {
+	now := time.Now()
+	if err := db.Where("expires_at <= ?", now).Delete(&model.UserSession{}).Error; err != nil {
+		return err
+	}
+	return db.Where("expires_at <= ?", now).Delete(&model.RevokedToken{}).Error
+}
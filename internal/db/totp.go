@@ -0,0 +1,88 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+)
+
+// SetUserTOTPSecret stores a pending secret, two factor authentication stays off until EnableUserTOTP
+func SetUserTOTPSecret(userID uint, secret string) error {
+	res := db.Model(&model.User{}).Where("id = ? AND totp_enabled = ?", userID, false).Update("totp_secret", secret)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("user not found or two factor authentication already enabled")
+	}
+	return nil
+}
+
+// EnableUserTOTP turns on two factor authentication with the pending secret
+// and replaces the recovery codes of the user
+func EnableUserTOTP(userID uint, step int64, hashedCodes []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.User{}).Where("id = ? AND totp_enabled = ?", userID, false).Updates(map[string]any{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("user not found or two factor authentication already enabled")
+		}
+		return replaceRecoveryCodes(tx, userID, hashedCodes)
+	})
+}
+
+func DisableUserTOTP(userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]any{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+// SetUserTOTPLastStep records the step of an accepted code, it returns false
+// when a code of the same or a later step was accepted in the meantime
+func SetUserTOTPLastStep(userID uint, step int64) (bool, error) {
+	res := db.Model(&model.User{}).Where("id = ? AND totp_last_step < ?", userID, step).Update("totp_last_step", step)
+	return res.RowsAffected == 1, res.Error
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, hashedCodes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]model.RecoveryCode, len(hashedCodes))
+	for i, c := range hashedCodes {
+		codes[i] = model.RecoveryCode{UserID: userID, HashedCode: c}
+	}
+	return tx.Create(&codes).Error
+}
+
+func SetRecoveryCodes(userID uint, hashedCodes []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, hashedCodes)
+	})
+}
+
+// UseRecoveryCode deletes the code and reports whether the user had it
+func UseRecoveryCode(userID uint, hashedCode string) (bool, error) {
+	res := db.Where("user_id = ? AND hashed_code = ?", userID, hashedCode).Delete(&model.RecoveryCode{})
+	return res.RowsAffected == 1, res.Error
+}
+
+func CountRecoveryCodes(userID uint) (int64, error) {
+	var n int64
+	err := db.Model(&model.RecoveryCode{}).Where("user_id = ?", userID).Count(&n).Error
+	return n, err
+}
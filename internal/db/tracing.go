@@ -0,0 +1,80 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/synctv-org/synctv/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracingSpanKey = "synctv:tracing_span"
+
+// TracingPlugin starts a span for each query made with the context of a
+// traced operation, queries without one are not traced so the background
+// jobs do not start a trace per query
+type TracingPlugin struct{}
+
+func (TracingPlugin) Name() string {
+	return "synctv:tracing"
+}
+
+func (TracingPlugin) Initialize(d *gorm.DB) error {
+	cb := d.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("tracing:before_create", before("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", endSpan),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", before("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", endSpan),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", before("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", endSpan),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", before("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", endSpan),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", before("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", endSpan),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", before("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", endSpan),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func before(op string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		startSpan(tx, op)
+	}
+}
+
+func startSpan(tx *gorm.DB, op string) {
+	ctx := tx.Statement.Context
+	if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	_, span := tracing.StartKind(ctx, "db."+op, trace.SpanKindClient,
+		attribute.String("db.system", tx.Dialector.Name()),
+		attribute.String("db.operation", op),
+	)
+	tx.InstanceSet(tracingSpanKey, span)
+}
+
+func endSpan(tx *gorm.DB) {
+	v, ok := tx.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+	span.SetAttributes(
+		attribute.String("db.sql.table", tx.Statement.Table),
+		attribute.String("db.statement", tx.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	err := tx.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
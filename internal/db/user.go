@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"strings"
 
 	"github.com/synctv-org/synctv/internal/model"
 	"github.com/synctv-org/synctv/internal/provider"
@@ -11,6 +13,15 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+var (
+	ErrUsernameTaken = errors.New("username already taken")
+	ErrEmailTaken    = errors.New("email already registered")
+	ErrProviderBound = errors.New("provider already bound")
+	// ErrUserNotFound is returned by the lookups whose callers create or
+	// link a user when there is none, to tell it from a failed query
+	ErrUserNotFound = errors.New("user not found")
+)
+
 type CreateUserConfig func(u *model.User)
 
 func WithRole(role model.Role) CreateUserConfig {
@@ -19,7 +30,21 @@ func WithRole(role model.Role) CreateUserConfig {
 	}
 }
 
-func CreateUser(username string, p provider.OAuth2Provider, puid uint, conf ...CreateUserConfig) (*model.User, error) {
+func WithPending(pending bool) CreateUserConfig {
+	return func(u *model.User) {
+		u.Pending = pending
+	}
+}
+
+func WithVerifiedEmail(email string) CreateUserConfig {
+	return func(u *model.User) {
+		for i := range u.Providers {
+			u.Providers[i].VerifiedEmail = email
+		}
+	}
+}
+
+func CreateUser(username string, p provider.OAuth2Provider, puid string, conf ...CreateUserConfig) (*model.User, error) {
 	u := &model.User{
 		Username: username,
 		Role:     model.RoleUser,
@@ -40,7 +65,71 @@ func CreateUser(username string, p provider.OAuth2Provider, puid uint, conf ...C
 	return u, err
 }
 
-func CreateOrLoadUser(username string, p provider.OAuth2Provider, puid uint, conf ...CreateUserConfig) (*model.User, error) {
+// CreateUserWithPassword creates a user who logs in with a password instead of an oauth2 provider,
+// email may be empty
+func CreateUserWithPassword(username, email, password string, conf ...CreateUserConfig) (*model.User, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword(stream.StringToBytes(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	u := &model.User{
+		Username:       username,
+		Role:           model.RoleUser,
+		HashedPassword: hashedPassword,
+	}
+	if email != "" {
+		u.Email = &email
+	}
+	for _, c := range conf {
+		c(u)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&model.User{}).Where("username = ?", username).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrUsernameTaken
+		}
+		if email != "" {
+			if err := tx.Model(&model.User{}).Where("email = ?", email).Count(&n).Error; err != nil {
+				return err
+			}
+			if n > 0 {
+				return ErrEmailTaken
+			}
+		}
+		return tx.Create(u).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return u, errors.New("username or email already taken")
+	}
+	return u, err
+}
+
+// GetUserByLogin returns the user with the email when login looks like one, else the user with the username
+func GetUserByLogin(login string) (*model.User, error) {
+	return GetUserByLoginContext(context.Background(), login)
+}
+
+// GetUserByLoginContext is GetUserByLogin with the queries made in ctx
+func GetUserByLoginContext(ctx context.Context, login string) (*model.User, error) {
+	tx := db.WithContext(ctx)
+	u := &model.User{}
+	if strings.Contains(login, "@") {
+		err := tx.Where("email = ?", strings.ToLower(login)).First(u).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return u, err
+		}
+	}
+	err := tx.Where("username = ?", login).First(u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return u, errors.New("user not found")
+	}
+	return u, err
+}
+
+func CreateOrLoadUser(username string, p provider.OAuth2Provider, puid string, conf ...CreateUserConfig) (*model.User, error) {
 	u := &model.User{
 		Username: username,
 		Role:     model.RoleUser,
@@ -59,16 +148,16 @@ func CreateOrLoadUser(username string, p provider.OAuth2Provider, puid uint, con
 		Error
 }
 
-func GetUserByProvider(p provider.OAuth2Provider, puid uint) (*model.User, error) {
+func GetUserByProvider(p provider.OAuth2Provider, puid string) (*model.User, error) {
 	u := &model.User{}
-	err := db.Preload("Providers", "provider = ? AND provider_user_id = ?", p, puid).First(u).Error
+	err := db.Where("id = (?)", db.Model(&model.UserProvider{}).Select("user_id").Where("provider = ? AND provider_user_id = ?", p, puid)).First(u).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return u, errors.New("user not found")
+		return u, ErrUserNotFound
 	}
 	return u, err
 }
 
-func AddUserToRoom(userID uint, roomID uint, role model.RoomRole, permission model.Permission) error {
+func AddUserToRoom(userID uint, roomID string, role model.RoomRole, permission model.Permission) error {
 	ur := &model.RoomUserRelation{
 		UserID:      userID,
 		RoomID:      roomID,
@@ -91,6 +180,72 @@ func GetUserByUsername(username string) (*model.User, error) {
 	return u, err
 }
 
+func GetUserByEmail(email string) (*model.User, error) {
+	u := &model.User{}
+	err := db.Where("email = ?", strings.ToLower(email)).First(u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return u, errors.New("user not found")
+	}
+	return u, err
+}
+
+func GetUserByVerifiedEmail(email string) (*model.User, error) {
+	u := &model.User{}
+	err := db.Where("id = (?)", db.Model(&model.UserProvider{}).Select("user_id").Where("verified_email = ?", email).Limit(1)).First(u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return u, ErrUserNotFound
+	}
+	return u, err
+}
+
+func AddUserProvider(userID uint, p provider.OAuth2Provider, puid string, verifiedEmail string) error {
+	up := &model.UserProvider{
+		UserID:         userID,
+		Provider:       p,
+		ProviderUserID: puid,
+		VerifiedEmail:  verifiedEmail,
+	}
+	err := db.Create(up).Error
+	if err != nil && errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrProviderBound
+	}
+	return err
+}
+
+func GetUserProviders(userID uint) ([]model.UserProvider, error) {
+	providers := []model.UserProvider{}
+	err := db.Where("user_id = ?", userID).Order("id").Find(&providers).Error
+	return providers, err
+}
+
+// DeleteUserProvider unlinks the accounts at the provider from the user
+func DeleteUserProvider(userID uint, p provider.OAuth2Provider) error {
+	res := db.Unscoped().Where("user_id = ? AND provider = ?", userID, p).Delete(&model.UserProvider{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("provider not linked")
+	}
+	return nil
+}
+
+func SetUserProviderVerifiedEmail(p provider.OAuth2Provider, puid string, verifiedEmail string) error {
+	return db.Model(&model.UserProvider{}).Where("provider = ? AND provider_user_id = ?", p, puid).Update("verified_email", verifiedEmail).Error
+}
+
+func HasUserByUsername(username string) (bool, error) {
+	u := &model.User{}
+	err := db.Where("username = ?", username).First(u).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 func GetUserByID(id uint) (*model.User, error) {
 	u := &model.User{}
 	err := db.Where("id = ?", id).First(u).Error
@@ -100,7 +255,7 @@ func GetUserByID(id uint) (*model.User, error) {
 	return u, err
 }
 
-func GetUsersByRoomID(roomID uint) ([]model.User, error) {
+func GetUsersByRoomID(roomID string) ([]model.User, error) {
 	users := []model.User{}
 	err := db.Model(&model.RoomUserRelation{}).Where("room_id = ?", roomID).Find(&users).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
@@ -119,10 +274,7 @@ func DeleteUserByID(userID uint) error {
 
 func LoadAndDeleteUserByID(userID uint, columns ...clause.Column) (*model.User, error) {
 	u := &model.User{}
-	err := db.Unscoped().
-		Clauses(clause.Returning{Columns: columns}).
-		Delete(u, userID).
-		Error
+	err := deleteReturning(db.Unscoped().Where("id = ?", userID), u, columns...)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return u, errors.New("user not found")
 	}
@@ -139,7 +291,7 @@ func DeleteUserByUsername(username string) error {
 
 func LoadAndDeleteUserByUsername(username string, columns ...clause.Column) (*model.User, error) {
 	u := &model.User{}
-	err := db.Unscoped().Clauses(clause.Returning{Columns: columns}).Where("username = ?", username).Delete(u).Error
+	err := deleteReturning(db.Unscoped().Where("username = ?", username), u, columns...)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return u, errors.New("user not found")
 	}
@@ -166,6 +318,121 @@ func SetUserHashedPassword(userID uint, hashedPassword []byte) error {
 	return err
 }
 
+// SetUserEmailVerified marks email verified if it is still the email of the user
+func SetUserEmailVerified(userID uint, email string) error {
+	res := db.Model(&model.User{}).Where("id = ? AND email = ?", userID, email).Update("email_verified", true)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+func SetUserTermsVersion(userID uint, version string) error {
+	err := db.Model(&model.User{}).Where("id = ?", userID).Update("terms_version", version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("user not found")
+	}
+	return err
+}
+
 func SaveUser(u *model.User) error {
 	return db.Save(u).Error
 }
+
+func SetUserProfile(userID uint, displayName, avatar, bio string) error {
+	res := db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"display_name": displayName,
+		"avatar":       avatar,
+		"bio":          bio,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+// SetUserInstanceRole sets the instance role of the user, not its role in a room
+func SetUserInstanceRole(userID uint, role model.Role) error {
+	res := db.Model(&model.User{}).Where("id = ?", userID).Update("role", role)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+type GetUsersConfig func(tx *gorm.DB) *gorm.DB
+
+// WithUserKeyword matches the username, display name or email
+func WithUserKeyword(keyword string) GetUsersConfig {
+	return func(tx *gorm.DB) *gorm.DB {
+		like := "%" + likeEscaper.Replace(strings.ToLower(keyword)) + "%"
+		return tx.Where(
+			"LOWER(username) LIKE ? ESCAPE '!' OR LOWER(display_name) LIKE ? ESCAPE '!' OR LOWER(email) LIKE ? ESCAPE '!'",
+			like, like, like,
+		)
+	}
+}
+
+func WithUserRole(role model.Role) GetUsersConfig {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("role = ?", role)
+	}
+}
+
+// SetUserRoomQuota sets the room quota of the user, nil for the instance default
+func SetUserRoomQuota(userID uint, quota *int64) error {
+	res := db.Model(&model.User{}).Where("id = ?", userID).Update("room_quota", quota)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+func WithUserPending() GetUsersConfig {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("pending = ?", true)
+	}
+}
+
+// ApproveUser clears the pending state of the user
+func ApproveUser(userID uint) error {
+	res := db.Model(&model.User{}).Where("id = ? AND pending = ?", userID, true).Update("pending", false)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("user not found or not pending")
+	}
+	return nil
+}
+
+// GetUsersPaginated returns at most limit users starting at offset ordered by id,
+// and the number of users matching conf
+func GetUsersPaginated(offset, limit int, conf ...GetUsersConfig) ([]*model.User, int64, error) {
+	query := func() *gorm.DB {
+		tx := db.Model(&model.User{})
+		for _, c := range conf {
+			tx = c(tx)
+		}
+		return tx
+	}
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	users := []*model.User{}
+	err := query().Order("id").Offset(offset).Limit(limit).Find(&users).Error
+	return users, total, err
+}
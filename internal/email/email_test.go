@@ -0,0 +1,100 @@
+package email_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/email"
+)
+
+func TestToken(t *testing.T) {
+	key := []byte("key")
+	token, err := email.NewToken(key, email.PurposeReset, 7, "fp", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, fp, err := email.ParseToken(key, email.PurposeReset, token)
+	if err != nil || id != 7 || fp != "fp" {
+		t.Fatalf("ParseToken = %d, %q, %v, want 7, fp", id, fp, err)
+	}
+	if _, _, err := email.ParseToken(key, email.PurposeVerify, token); !errors.Is(err, email.ErrInvalidToken) {
+		t.Fatalf("token of another purpose: %v, want ErrInvalidToken", err)
+	}
+	if _, _, err := email.ParseToken([]byte("other"), email.PurposeReset, token); !errors.Is(err, email.ErrInvalidToken) {
+		t.Fatalf("token of another key: %v, want ErrInvalidToken", err)
+	}
+
+	expired, err := email.NewToken(key, email.PurposeReset, 7, "fp", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := email.ParseToken(key, email.PurposeReset, expired); !errors.Is(err, email.ErrInvalidToken) {
+		t.Fatalf("expired token: %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	for _, name := range []string{email.TemplateVerify, email.TemplateReset} {
+		msg, err := email.Render(name, map[string]string{"Username": "alice", "Link": "https://synctv.example/x?token=t", "Expire": "24h0m0s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Subject == "" || strings.Contains(msg.Subject, "\n") {
+			t.Fatalf("%s: subject = %q", name, msg.Subject)
+		}
+		if !strings.Contains(msg.Body, "alice") || !strings.Contains(msg.Body, "https://synctv.example/x?token=t") {
+			t.Fatalf("%s: body = %q", name, msg.Body)
+		}
+	}
+	if _, err := email.Render("missing.txt", nil); err == nil {
+		t.Fatal("rendered a missing template")
+	}
+}
+
+type flakySender struct {
+	fails int
+	sent  chan *email.Message
+}
+
+func (s *flakySender) Send(msg *email.Message) error {
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("temporary failure")
+	}
+	s.sent <- msg
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	s := &flakySender{fails: 1, sent: make(chan *email.Message, 1)}
+	q := email.NewQueue(s, 1)
+	if err := q.Push(&email.Message{To: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&email.Message{To: "b@example.com"}); !errors.Is(err, email.ErrQueueFull) {
+		t.Fatalf("push to a full queue: %v, want ErrQueueFull", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+	select {
+	case msg := <-s.sent:
+		if msg.To != "a@example.com" {
+			t.Fatalf("sent to %s, want a@example.com", msg.To)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the failed email was not retried")
+	}
+}
+
+func TestSMTPSenderRejectsHeaderInjection(t *testing.T) {
+	s := &email.SMTPSender{Host: "127.0.0.1", Port: 1, From: "synctv@example.com"}
+	err := s.Send(&email.Message{To: "a@example.com\r\nBcc: b@example.com", Subject: "hi"})
+	if !errors.Is(err, email.ErrInvalidHeader) {
+		t.Fatalf("Send = %v, want ErrInvalidHeader", err)
+	}
+}
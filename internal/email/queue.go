@@ -0,0 +1,96 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrDisabled  = errors.New("email is not configured")
+	ErrQueueFull = errors.New("email queue is full")
+)
+
+// a message is tried sendAttempts times, waiting retryDelay longer after each failure
+const (
+	sendAttempts = 3
+	retryDelay   = 2 * time.Second
+)
+
+// Queue sends emails in the background so requests don't wait on the SMTP server
+type Queue struct {
+	sender Sender
+	ch     chan *Message
+}
+
+func NewQueue(sender Sender, size int) *Queue {
+	return &Queue{
+		sender: sender,
+		ch:     make(chan *Message, size),
+	}
+}
+
+// Push queues msg, it fails instead of blocking when the queue is full
+func (q *Queue) Push(msg *Message) error {
+	select {
+	case q.ch <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Run sends the queued emails until ctx is done
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-q.ch:
+			q.send(ctx, msg)
+		}
+	}
+}
+
+func (q *Queue) send(ctx context.Context, msg *Message) {
+	var err error
+	for i := 0; i < sendAttempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryDelay * time.Duration(i)):
+			}
+		}
+		if err = q.sender.Send(msg); err == nil {
+			return
+		}
+	}
+	log.Errorf("send email to %s failed: %v", msg.To, err)
+}
+
+var queue *Queue
+
+func Init(q *Queue) {
+	queue = q
+}
+
+// Enabled reports whether emails can be sent
+func Enabled() bool {
+	return queue != nil
+}
+
+// Send renders the template name with data and queues it to to
+func Send(to, name string, data any) error {
+	if queue == nil {
+		return ErrDisabled
+	}
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+	return queue.Push(msg)
+}
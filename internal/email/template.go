@@ -0,0 +1,44 @@
+package email
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// The templates define a "subject" and a "body" each
+const (
+	TemplateVerify = "verify.txt"
+	TemplateReset  = "reset.txt"
+)
+
+//go:embed templates/*.txt
+var templateFS embed.FS
+
+var templates = map[string]*template.Template{}
+
+func init() {
+	for _, name := range []string{TemplateVerify, TemplateReset} {
+		templates[name] = template.Must(template.ParseFS(templateFS, "templates/"+name))
+	}
+}
+
+// Render executes the subject and the body of the template name with data
+func Render(name string, data any) (*Message, error) {
+	t, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("email template %s not found", name)
+	}
+	subject, body := strings.Builder{}, strings.Builder{}
+	if err := t.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := t.ExecuteTemplate(&body, "body", data); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    strings.TrimLeft(body.String(), "\n"),
+	}, nil
+}
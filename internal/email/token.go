@@ -0,0 +1,57 @@
+package email
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Purpose is what a token of an email link is for
+type Purpose string
+
+const (
+	PurposeVerify Purpose = "verify"
+	PurposeReset  Purpose = "reset"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+type tokenClaims struct {
+	UserID  uint    `json:"u"`
+	Purpose Purpose `json:"p"`
+	// Fingerprint ties the token to the state of the user it was issued for,
+	// it no longer matches once the token was used
+	Fingerprint string `json:"f"`
+	jwt.RegisteredClaims
+}
+
+// NewToken signs a token for the user valid for ttl. The key must differ from
+// the key of the login tokens, otherwise an email token would log in.
+func NewToken(key []byte, purpose Purpose, userID uint, fingerprint string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, &tokenClaims{
+		UserID:      userID,
+		Purpose:     purpose,
+		Fingerprint: fingerprint,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}).SignedString(key)
+}
+
+// ParseToken returns the user and the fingerprint of a valid token for purpose
+func ParseToken(key []byte, purpose Purpose, token string) (uint, string, error) {
+	t, err := jwt.ParseWithClaims(token, &tokenClaims{}, func(t *jwt.Token) (any, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return 0, "", ErrInvalidToken
+	}
+	claims, ok := t.Claims.(*tokenClaims)
+	if !ok || !t.Valid || claims.Purpose != purpose || claims.UserID == 0 {
+		return 0, "", ErrInvalidToken
+	}
+	return claims.UserID, claims.Fingerprint, nil
+}
@@ -0,0 +1,72 @@
+// Package health tracks whether the subsystems of synctv can serve, for the
+// readiness probe of orchestrators
+package health
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var ErrNotStarted = errors.New("not started")
+
+// Check returns nil when its subsystem can serve
+type Check func(ctx context.Context) error
+
+var (
+	lock   sync.RWMutex
+	checks = map[string]Check{}
+)
+
+// Register adds the check of the subsystem name, replacing any previous one
+func Register(name string, check Check) {
+	lock.Lock()
+	defer lock.Unlock()
+	checks[name] = check
+}
+
+// SetPending makes name not ready until SetReady is called, for subsystems
+// started after the bootstrap such as the listeners
+func SetPending(name string) {
+	Register(name, func(context.Context) error {
+		return ErrNotStarted
+	})
+}
+
+// SetReady makes name ready
+func SetReady(name string) {
+	Register(name, func(context.Context) error {
+		return nil
+	})
+}
+
+// Result is the outcome of a check, Error is empty when it passed
+type Result struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// Ready runs every check in ctx, it returns false if one of them failed
+func Ready(ctx context.Context) ([]Result, bool) {
+	lock.RLock()
+	current := make(map[string]Check, len(checks))
+	for name, check := range checks {
+		current[name] = check
+	}
+	lock.RUnlock()
+	results := make([]Result, 0, len(current))
+	ready := true
+	for name, check := range current {
+		r := Result{Name: name}
+		if err := check(ctx); err != nil {
+			r.Error = err.Error()
+			ready = false
+		}
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results, ready
+}
@@ -0,0 +1,86 @@
+// Package metrics holds the prometheus registry of synctv, subsystems create
+// their metrics with the helpers here so they are exposed on /metrics
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes the name of every metric of synctv
+const Namespace = "synctv"
+
+// Registry holds every metric exposed by Handler
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// AuthFailures counts the failed logins and rejected tokens by kind
+var AuthFailures = NewCounterVec("auth_failures_total", "Failed logins and rejected credentials.", "kind")
+
+// MustRegister registers collectors of other subsystems, it panics when one
+// is registered twice
+func MustRegister(cs ...prometheus.Collector) {
+	Registry.MustRegister(cs...)
+}
+
+func NewCounter(name, help string) prometheus.Counter {
+	c := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+	})
+	MustRegister(c)
+	return c
+}
+
+func NewCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+	}, labels)
+	MustRegister(c)
+	return c
+}
+
+// NewGaugeFunc registers a gauge whose value is read from f on each scrape
+func NewGaugeFunc(name, help string, f func() float64) prometheus.GaugeFunc {
+	g := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+	}, f)
+	MustRegister(g)
+	return g
+}
+
+// NewHistogram registers a histogram with the default buckets when buckets is nil
+func NewHistogram(name, help string, buckets []float64) prometheus.Histogram {
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	})
+	MustRegister(h)
+	return h
+}
+
+// NewDesc returns the description of a metric of a custom collector
+func NewDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", name), help, labels, nil)
+}
+
+// Handler serves the metrics in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
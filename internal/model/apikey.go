@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// APIKeyScope is what an api key may do, keys get no access beyond their scopes
+type APIKeyScope string
+
+const (
+	ScopeUserRead   APIKeyScope = "user:read"
+	ScopeRoomRead   APIKeyScope = "room:read"
+	ScopeMovieRead  APIKeyScope = "movie:read"
+	ScopeMovieWrite APIKeyScope = "movie:write"
+)
+
+var APIKeyScopes = []APIKeyScope{ScopeUserRead, ScopeRoomRead, ScopeMovieRead, ScopeMovieWrite}
+
+func (s APIKeyScope) Valid() bool {
+	for _, v := range APIKeyScopes {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey is a long lived credential for bots and scripts, it is stored as its sha256
+type APIKey struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	Name      string    `gorm:"not null;size:64" json:"name"`
+	// Prefix is the start of the key, shown so users can tell their keys apart
+	Prefix     string        `gorm:"not null;size:16" json:"prefix"`
+	HashedKey  string        `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	Scopes     []APIKeyScope `gorm:"serializer:fastjson" json:"scopes"`
+	ExpiresAt  *time.Time    `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time    `json:"lastUsedAt,omitempty"`
+}
+
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
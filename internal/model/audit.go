@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// PermissionChange adds and removes permissions of a room member
+type PermissionChange struct {
+	UserID uint
+	Add    Permission
+	Remove Permission
+}
+
+// PermissionAudit records a change of the permissions of a room member
+type PermissionAudit struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	RoomID    string    `gorm:"not null;index;type:varchar(32)"`
+	// ActorID is the user who changed the permissions
+	ActorID uint `gorm:"not null"`
+	// TargetID is the member whose permissions changed, 0 for the default
+	// permissions of new members
+	TargetID uint `gorm:"not null;index"`
+	// Role is the assigned role preset, empty for a change of single permissions
+	Role   RolePreset
+	Before Permission `gorm:"not null"`
+	After  Permission `gorm:"not null"`
+}
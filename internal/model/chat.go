@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// ChatMessage is a chat message sent in a room, kept as its history
+type ChatMessage struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	RoomID    string    `gorm:"not null;index;type:varchar(32)"`
+	UserID    uint      `gorm:"not null"`
+	Content   string    `gorm:"not null"`
+}
+
+// ChatReadState is the last chat message of a room a user read
+type ChatReadState struct {
+	RoomID     string `gorm:"primarykey;type:varchar(32)"`
+	UserID     uint   `gorm:"primarykey"`
+	LastReadID uint
+	UpdatedAt  time.Time
+}
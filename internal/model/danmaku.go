@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Danmaku is a comment scrolled over a movie when its playback reaches Time seconds
+type Danmaku struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	RoomID    string    `gorm:"not null;index;type:varchar(32)" json:"-"`
+	MovieID   uint      `gorm:"not null;index:idx_danmaku_movie_time" json:"movieId"`
+	Time      float64   `gorm:"not null;index:idx_danmaku_movie_time" json:"time"`
+	UserID    uint      `gorm:"not null" json:"-"`
+	Content   string    `gorm:"not null" json:"content"`
+	// Color is a #rrggbb color, empty for the player default
+	Color string `json:"color"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+type RoomEventType string
+
+const (
+	RoomEventPlaylistChanged RoomEventType = "playlistChanged"
+	RoomEventUserJoined      RoomEventType = "userJoined"
+	RoomEventUserKicked      RoomEventType = "userKicked"
+	RoomEventSettingsChanged RoomEventType = "settingsChanged"
+	RoomEventPlaybackSeeked  RoomEventType = "playbackSeeked"
+	RoomEventUserMuted       RoomEventType = "userMuted"
+	RoomEventChatDeleted     RoomEventType = "chatDeleted"
+	// RoomEventPermissionsChanged is a change of the permissions of members
+	RoomEventPermissionsChanged RoomEventType = "permissionsChanged"
+)
+
+// RoomEvent is an entry of the room activity feed
+type RoomEvent struct {
+	ID        uint          `gorm:"primarykey"`
+	CreatedAt time.Time     `gorm:"index"`
+	RoomID    string        `gorm:"not null;index;type:varchar(32)"`
+	UserID    uint          `gorm:"not null"`
+	Type      RoomEventType `gorm:"not null"`
+	Detail    string
+}
@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+type UserFavoriteRoom struct {
+	UserID    uint   `gorm:"primarykey"`
+	RoomID    string `gorm:"primarykey;index;type:varchar(32)"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// InstanceSetting is the value of an instance setting changed at runtime,
+// settings never changed keep their default and have no row
+type InstanceSetting struct {
+	Name      string `gorm:"primarykey;size:64"`
+	Value     string `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+func (InstanceSetting) TableName() string {
+	return "settings"
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RoomInvite struct {
+	gorm.Model
+	RoomID    string `gorm:"not null;index;type:varchar(32)"`
+	CreatorID uint   `gorm:"not null"`
+	// Permissions are granted to the user joining with the invite
+	Permissions Permission
+	ExpiresAt   time.Time `gorm:"not null"`
+	// MaxUses of 0 means unlimited
+	MaxUses uint
+	Uses    uint
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// LoginAttempt counts the failed logins of a key, such as an ip or an account
+type LoginAttempt struct {
+	Key         string    `gorm:"column:login_key;primarykey;type:varchar(191)"`
+	Failures    int64     `gorm:"not null"`
+	LastFailure time.Time `gorm:"index"`
+	LockedUntil time.Time `gorm:"index"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// DirectMessage is a private message from one user to another
+type DirectMessage struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	SenderID    uint   `gorm:"not null;index"`
+	RecipientID uint   `gorm:"not null;index:idx_direct_messages_recipient_seen"`
+	Content     string `gorm:"not null"`
+	Seen        bool   `gorm:"not null;default:false;index:idx_direct_messages_recipient_seen"`
+}
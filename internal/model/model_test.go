@@ -5,6 +5,7 @@ import (
 
 	"github.com/glebarez/sqlite"
 	"github.com/synctv-org/synctv/internal/model"
+	_ "github.com/synctv-org/synctv/utils/fastJSONSerializer"
 	"gorm.io/gorm"
 )
 
@@ -57,7 +58,7 @@ func TestAddUserToRoom(t *testing.T) {
 	}
 	ur := model.RoomUserRelation{
 		UserID:      1,
-		RoomID:      1,
+		RoomID:      "1",
 		Role:        model.RoomRoleUser,
 		Permissions: model.DefaultPermissions,
 	}
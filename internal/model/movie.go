@@ -6,10 +6,27 @@ import (
 
 type Movie struct {
 	gorm.Model
-	Position  uint `gorm:"not null"`
-	RoomID    uint `gorm:"not null;index"`
-	CreatorID uint `gorm:"not null;index" json:"creatorId"`
+	Position  uint   `gorm:"not null"`
+	RoomID    string `gorm:"not null;index;type:varchar(32)"`
+	CreatorID uint   `gorm:"not null;index" json:"creatorId"`
+	// ParentID is the folder containing the movie, 0 for the top level
+	ParentID uint `gorm:"index" json:"parentId"`
 	MovieInfo
+	Meta      MovieMeta  `gorm:"embedded;embeddedPrefix:meta_" json:"meta"`
+	Subtitles []Subtitle `gorm:"foreignKey:MovieID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	Danmakus  []Danmaku  `gorm:"foreignKey:MovieID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+}
+
+// MovieMeta is probed from the media of a movie after it is pushed,
+// zero values are unknown
+type MovieMeta struct {
+	// Duration in seconds
+	Duration float64 `json:"duration"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	Codec    string  `json:"codec"`
+	// Thumbnail is a data url
+	Thumbnail string `json:"thumbnail"`
 }
 
 type MovieInfo struct {
@@ -18,11 +35,13 @@ type MovieInfo struct {
 }
 
 type BaseMovieInfo struct {
-	Url        string            `json:"url"`
-	Name       string            `gorm:"not null" json:"name"`
-	Live       bool              `json:"live"`
-	Proxy      bool              `json:"proxy"`
-	RtmpSource bool              `json:"rtmpSource"`
-	Type       string            `json:"type"`
-	Headers    map[string]string `gorm:"serializer:fastjson" json:"headers"`
+	Url        string `json:"url"`
+	Name       string `gorm:"not null" json:"name"`
+	Live       bool   `json:"live"`
+	Proxy      bool   `json:"proxy"`
+	RtmpSource bool   `json:"rtmpSource"`
+	Type       string `json:"type"`
+	// Folder movies have no media, they hold the movies whose ParentID they are
+	Folder  bool              `json:"folder"`
+	Headers map[string]string `gorm:"serializer:fastjson" json:"headers"`
 }
@@ -7,7 +7,11 @@ import (
 
 type UserProvider struct {
 	gorm.Model
-	UserID         uint                    `gorm:"not null"`
-	Provider       provider.OAuth2Provider `gorm:"not null;uniqueIndex:provider_user_id"`
-	ProviderUserID uint                    `gorm:"not null;uniqueIndex:provider_user_id"`
+	UserID   uint                    `gorm:"not null;index"`
+	Provider provider.OAuth2Provider `gorm:"not null;uniqueIndex:provider_user_id"`
+	// ProviderUserID is the id of the account at the provider, numeric ids
+	// of databases created before are converted to strings by AutoMigrate
+	ProviderUserID string `gorm:"not null;uniqueIndex:provider_user_id;size:191"`
+	// VerifiedEmail is only set when the provider verified it and is trusted to link accounts by email
+	VerifiedEmail string `gorm:"index"`
 }
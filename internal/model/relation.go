@@ -16,31 +16,147 @@ const (
 	CanRenameRoom Permission = 1 << iota
 	CanSetAdmin
 	CanSetRoomPassword
-	CanSetRoomSetting
+	CanChangeRoomSetting
 	CanSetUserPermission
 	CanSetUserPassword
 	CanCreateUserPublishKey
+	// CanEditUserMovies allows editing and moving the playlist entries of others
 	CanEditUserMovies
+	// CanDeleteUserMovies allows deleting the playlist entries of others and clearing the playlist
 	CanDeleteUserMovies
+	// CanCreateMovie allows pushing movies and subtitles to the playlist,
+	// everyone can edit and delete the entries they pushed
 	CanCreateMovie
 	CanChangeCurrentMovie
+	// CanChangeMovieStatus allows playing, pausing, seeking and switching subtitles
 	CanChangeMovieStatus
 	CanDeleteRoom
+	CanInviteUser
+	// CanTransferRoom is not enough to transfer a room, only its creator and
+	// admins can
+	CanTransferRoom
+	CanViewRoomEvents
+	CanSetAnnouncement
+	CanChangeRate
+	CanControlPlayback
+	// CanPublishLive allows adding rtmp source movies and publishing to them
+	CanPublishLive
+	CanDeleteChatMessage
+	CanMuteUser
+	// CanUseVoice allows joining the voice channel of rooms with voice enabled
+	CanUseVoice
+	// CanSetDefaultPermission allows changing the permissions new members get
+	CanSetDefaultPermission
+	// CanKickUser allows disconnecting users from the room, they can join again
+	CanKickUser
 	AllPermissions Permission = 0xffffffff
 )
 
 const (
-	DefaultPermissions = CanCreateMovie | CanChangeCurrentMovie | CanChangeMovieStatus
+	DefaultPermissions = CanCreateMovie | CanChangeCurrentMovie | CanChangeMovieStatus | CanChangeRate
 )
 
+// knownPermissions has the bits of every permission above
+const knownPermissions = CanKickUser<<1 - 1
+
+// PermissionName names a permission bit for clients
+type PermissionName struct {
+	Permission Permission `json:"permission"`
+	Name       string     `json:"name"`
+}
+
+// PermissionNames lists every permission in bit order
+var PermissionNames = []PermissionName{
+	{CanRenameRoom, "renameRoom"},
+	{CanSetAdmin, "setAdmin"},
+	{CanSetRoomPassword, "setRoomPassword"},
+	{CanChangeRoomSetting, "changeRoomSetting"},
+	{CanSetUserPermission, "setUserPermission"},
+	{CanSetUserPassword, "setUserPassword"},
+	{CanCreateUserPublishKey, "createUserPublishKey"},
+	{CanEditUserMovies, "editUserMovies"},
+	{CanDeleteUserMovies, "deleteUserMovies"},
+	{CanCreateMovie, "createMovie"},
+	{CanChangeCurrentMovie, "changeCurrentMovie"},
+	{CanChangeMovieStatus, "changeMovieStatus"},
+	{CanDeleteRoom, "deleteRoom"},
+	{CanInviteUser, "inviteUser"},
+	{CanTransferRoom, "transferRoom"},
+	{CanViewRoomEvents, "viewRoomEvents"},
+	{CanSetAnnouncement, "setAnnouncement"},
+	{CanChangeRate, "changeRate"},
+	{CanControlPlayback, "controlPlayback"},
+	{CanPublishLive, "publishLive"},
+	{CanDeleteChatMessage, "deleteChatMessage"},
+	{CanMuteUser, "muteUser"},
+	{CanUseVoice, "useVoice"},
+	{CanSetDefaultPermission, "setDefaultPermission"},
+	{CanKickUser, "kickUser"},
+}
+
+// RolePreset names a common set of permissions, to give a member at once
+type RolePreset string
+
+const (
+	// RolePresetAdmin can do anything but delete or transfer the room
+	RolePresetAdmin RolePreset = "admin"
+	// RolePresetModerator also manages the chat, the members and the playlist of others
+	RolePresetModerator RolePreset = "moderator"
+	// RolePresetMember has the permissions members had before presets existed
+	RolePresetMember RolePreset = "member"
+	// RolePresetRestricted can only watch and chat
+	RolePresetRestricted RolePreset = "restricted"
+)
+
+// RolePresets lists the presets from the most to the least privileged
+var RolePresets = []RolePreset{RolePresetAdmin, RolePresetModerator, RolePresetMember, RolePresetRestricted}
+
+// Permissions returns the permissions of the preset, empty is RolePresetMember
+func (r RolePreset) Permissions() Permission {
+	switch r {
+	case RolePresetAdmin:
+		return knownPermissions &^ (CanDeleteRoom | CanTransferRoom)
+	case RolePresetModerator:
+		return DefaultPermissions | CanControlPlayback | CanEditUserMovies | CanDeleteUserMovies |
+			CanInviteUser | CanViewRoomEvents | CanSetAnnouncement | CanDeleteChatMessage | CanMuteUser | CanUseVoice | CanKickUser
+	case RolePresetRestricted:
+		return 0
+	default:
+		return DefaultPermissions
+	}
+}
+
+// RolePresetOf returns the preset with exactly the permissions p, empty if none has them
+func RolePresetOf(p Permission) RolePreset {
+	for _, r := range RolePresets {
+		if r.Permissions() == p {
+			return r
+		}
+	}
+	return ""
+}
+
+func (r RolePreset) Valid() bool {
+	switch r {
+	case RolePresetAdmin, RolePresetModerator, RolePresetMember, RolePresetRestricted:
+		return true
+	}
+	return false
+}
+
 func (p Permission) Has(permission Permission) bool {
 	return p&permission == permission
 }
 
+// Valid reports whether p only has known permission bits
+func (p Permission) Valid() bool {
+	return p&^knownPermissions == 0
+}
+
 type RoomUserRelation struct {
 	gorm.Model
 	UserID      uint     `gorm:"not null;uniqueIndex:idx_user_room"`
-	RoomID      uint     `gorm:"not null;uniqueIndex:idx_user_room"`
+	RoomID      string   `gorm:"not null;uniqueIndex:idx_user_room;type:varchar(32)"`
 	Role        RoomRole `gorm:"not null"`
 	Permissions Permission
 }
@@ -55,3 +171,11 @@ func (r *RoomUserRelation) HasPermission(permission Permission) bool {
 		return false
 	}
 }
+
+func (r *RoomUserRelation) HasPermissions(permissions ...Permission) map[Permission]bool {
+	m := make(map[Permission]bool, len(permissions))
+	for _, p := range permissions {
+		m[p] = r.HasPermission(p)
+	}
+	return m
+}
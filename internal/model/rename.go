@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// UsernameChange records a rename, so admins can trace who used a username before
+type UsernameChange struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	UserID    uint      `gorm:"not null;index"`
+	OldName   string    `gorm:"not null;index;size:64"`
+	NewName   string    `gorm:"not null;index;size:64"`
+}
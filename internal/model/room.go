@@ -1,19 +1,58 @@
 package model
 
 import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 	"github.com/zijiren233/stream"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type Room struct {
-	gorm.Model
-	Name string `gorm:"not null;uniqueIndex"`
+	// ID is a random uuid so that rooms can not be enumerated,
+	// rooms created before the migration keep their numeric id as a string
+	ID        string `gorm:"primarykey;type:varchar(32)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Name      string         `gorm:"not null;uniqueIndex"`
 	Setting
-	CreatorID          uint `gorm:"index"`
-	HashedPassword     []byte
+	CreatorID      uint `gorm:"index"`
+	HashedPassword []byte
+	LastActiveAt   time.Time `gorm:"index"`
+	// ScheduledAt is the start time of a scheduled room, playback is locked until then
+	ScheduledAt        time.Time
 	GroupUserRelations []RoomUserRelation `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	Movies             []Movie            `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	State              *RoomState         `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Invites            []RoomInvite       `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Events             []RoomEvent        `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Tags               []Tag              `gorm:"many2many:room_tags;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Favorites          []UserFavoriteRoom `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	ChatMessages       []ChatMessage      `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	ChatReadStates     []ChatReadState    `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	PermissionAudits   []PermissionAudit  `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func NewRoomID() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+func (r *Room) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = NewRoomID()
+	}
+	return nil
+}
+
+func (r *Room) TagNames() []string {
+	names := make([]string, len(r.Tags))
+	for i, t := range r.Tags {
+		names[i] = t.Name
+	}
+	return names
 }
 
 func (r *Room) CheckPassword(password string) bool {
@@ -1,5 +1,91 @@
 package model
 
+// PlayMode is the order a room advances through its playlist
+type PlayMode string
+
+const (
+	PlayModeOrder     PlayMode = "order"
+	PlayModeShuffle   PlayMode = "shuffle"
+	PlayModeRepeatOne PlayMode = "repeat-one"
+	PlayModeRepeatAll PlayMode = "repeat-all"
+)
+
+func (p PlayMode) Valid() bool {
+	switch p {
+	case PlayModeOrder, PlayModeShuffle, PlayModeRepeatOne, PlayModeRepeatAll:
+		return true
+	}
+	return false
+}
+
 type Setting struct {
 	Hidden bool
+	// Permanent rooms are never deleted for inactivity
+	Permanent bool
+	// MaxClients limits the connected clients, 0 means unlimited
+	MaxClients  int64
+	DisableChat bool
+	// Announcement is shown to everyone in the room, empty for none
+	Announcement string
+	// WhitelistOnly rooms can only be joined by their members
+	WhitelistOnly bool
+	// AllowGuest lets visitors without an account watch the room
+	AllowGuest bool
+	// HostOnly rooms only accept playback control from users with CanControlPlayback
+	HostOnly bool
+	// VoteThreshold is the percentage of connected clients that must vote
+	// to pause, play or skip, 0 disables voting
+	VoteThreshold int64
+	// AutoNext plays the next movie of the playlist when the current one ends
+	AutoNext bool
+	// PlayMode steers AutoNext and skipping, empty is PlayModeOrder
+	PlayMode PlayMode
+	// DisableDanmaku rejects new danmaku, the saved ones can still be loaded
+	DisableDanmaku bool
+	// EnableVoice opens the voice channel of the room to users with CanUseVoice
+	EnableVoice bool
+	// DefaultPermissions are given to users when they join the room, nil is
+	// the package DefaultPermissions
+	DefaultPermissions *Permission
+	// ChatFilter is applied to the chat after the instance wide filter
+	ChatFilter ChatFilter `gorm:"embedded;embeddedPrefix:chat_filter_"`
+}
+
+// MemberPermissions returns the permissions of new members of the room
+func (s Setting) MemberPermissions() Permission {
+	if s.DefaultPermissions == nil {
+		return DefaultPermissions
+	}
+	return *s.DefaultPermissions
+}
+
+// ChatFilterAction is what a chat filter does with a matching message
+type ChatFilterAction string
+
+const (
+	ChatFilterDrop ChatFilterAction = "drop"
+	// ChatFilterReplace masks the matches, messages that can't be masked are dropped
+	ChatFilterReplace ChatFilterAction = "replace"
+	// ChatFilterMute drops the message and mutes the sender
+	ChatFilterMute ChatFilterAction = "mute"
+)
+
+func (a ChatFilterAction) Valid() bool {
+	switch a {
+	case ChatFilterDrop, ChatFilterReplace, ChatFilterMute:
+		return true
+	}
+	return false
+}
+
+type ChatFilter struct {
+	// BlockedWords are matched case insensitively
+	BlockedWords []string `gorm:"serializer:fastjson" json:"blockedWords"`
+	BlockLinks   bool     `json:"blockLinks"`
+	// RepeatLimit is how many times in a row a user may send the same message, 0 for unlimited
+	RepeatLimit int64 `json:"repeatLimit"`
+	// Action is taken on matching messages, empty is ChatFilterDrop
+	Action ChatFilterAction `json:"action"`
+	// MuteSeconds is how long ChatFilterMute mutes the sender
+	MuteSeconds int64 `json:"muteSeconds"`
 }
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// RoomState is the playback state of a room, saved when the room is unloaded from memory
+type RoomState struct {
+	RoomID         string `gorm:"primarykey;type:varchar(32)"`
+	UpdatedAt      time.Time
+	CurrentMovieID uint
+	Seek           float64
+	Rate           float64
+	Playing        bool
+	// Subtitle is the track of the current movie shown, 0 for none
+	Subtitle uint
+}
@@ -0,0 +1,14 @@
+package model
+
+import "gorm.io/gorm"
+
+// Subtitle is a subtitle track of a movie, its file is kept in the subtitle storage under Key
+type Subtitle struct {
+	gorm.Model
+	RoomID    string `gorm:"not null;index;type:varchar(32)" json:"-"`
+	MovieID   uint   `gorm:"not null;index" json:"movieId"`
+	CreatorID uint   `gorm:"not null" json:"creatorId"`
+	Name      string `gorm:"not null" json:"name"`
+	Format    string `gorm:"not null" json:"format"`
+	Key       string `gorm:"not null" json:"-"`
+}
@@ -0,0 +1,6 @@
+package model
+
+type Tag struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"not null;uniqueIndex;size:32"`
+}
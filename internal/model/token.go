@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// UserSession is a login of a user on a device, it lasts as long as its
+// refresh token, which is stored as its sha256
+type UserSession struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UserID      uint      `gorm:"not null;index" json:"-"`
+	HashedToken string    `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	UserAgent   string    `gorm:"size:255" json:"userAgent"`
+	IP          string    `gorm:"size:64" json:"ip"`
+	// LastUsedAt is when the refresh token was last used, or the login
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `gorm:"not null;index" json:"expiresAt"`
+}
+
+// RevokedToken is a jwt rejected before it expires, kept until then
+type RevokedToken struct {
+	ID        string    `gorm:"primarykey;size:32"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
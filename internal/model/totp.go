@@ -0,0 +1,8 @@
+package model
+
+// RecoveryCode logs in once in place of a two factor code, it is stored as its sha256
+type RecoveryCode struct {
+	ID         uint   `gorm:"primarykey"`
+	UserID     uint   `gorm:"not null;uniqueIndex:idx_recovery_codes_user_code"`
+	HashedCode string `gorm:"not null;size:64;uniqueIndex:idx_recovery_codes_user_code"`
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"math/rand"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -18,12 +19,47 @@ const (
 
 type User struct {
 	gorm.Model
-	Providers          []UserProvider     `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	Username           string             `gorm:"not null;uniqueIndex"`
+	Providers []UserProvider `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Username  string         `gorm:"not null;uniqueIndex"`
+	// DisplayName is shown instead of the username when set
+	DisplayName string `gorm:"size:64"`
+	// Avatar is the url of the avatar, uploaded avatars are served by /api/user/avatar/:key
+	Avatar string `gorm:"size:512"`
+	Bio    string `gorm:"size:512"`
+	// Email is unique when set, nil for users who never gave one
+	Email *string `gorm:"uniqueIndex;size:191"`
+	// EmailVerified is set once the user opened the link of a verification email
+	EmailVerified bool `gorm:"not null;default:false"`
+	// HashedPassword is the bcrypt hash of the password, empty for users who only log in with oauth2
+	HashedPassword []byte
+	// TOTPSecret is the secret of two factor authentication, it is pending
+	// until the user confirms it with a code and TOTPEnabled is set
+	TOTPSecret  string `gorm:"size:64"`
+	TOTPEnabled bool   `gorm:"not null;default:false"`
+	// TOTPLastStep is the step of the last accepted code, so a code works once
+	TOTPLastStep    int64
+	RecoveryCodes   []RecoveryCode   `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Sessions        []UserSession    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	APIKeys         []APIKey         `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UsernameChanges []UsernameChange `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	// TokenVersion is part of every token of the user, raising it logs out all sessions
+	TokenVersion uint32 `gorm:"not null;default:0"`
+	// Pending users signed up while approval was required and wait for an admin,
+	// they can't create or join rooms until approved
+	Pending            bool               `gorm:"not null;default:false;index"`
 	Role               Role               `gorm:"not null"`
 	GroupUserRelations []RoomUserRelation `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	Rooms              []Room             `gorm:"foreignKey:CreatorID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	Movies             []Movie            `gorm:"foreignKey:CreatorID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	FavoriteRooms      []UserFavoriteRoom `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	SentMessages       []DirectMessage    `gorm:"foreignKey:SenderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	ReceivedMessages   []DirectMessage    `gorm:"foreignKey:RecipientID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	TermsVersion       string
+	// RoomQuota overrides the instance max_rooms_per_user for the user, 0 for
+	// unlimited, nil for the instance default
+	RoomQuota *int64
+	// DeletionScheduledAt is when the user and all its data are purged, nil if not scheduled
+	DeletionScheduledAt *time.Time `gorm:"index"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) error {
@@ -34,3 +70,44 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+func (r Role) String() string {
+	switch r {
+	case RoleBanned:
+		return "banned"
+	case RoleUser:
+		return "user"
+	case RoleAdmin:
+		return "admin"
+	case RoleRoot:
+		return "root"
+	default:
+		return fmt.Sprintf("role(%d)", uint8(r))
+	}
+}
+
+// ParseRole returns the role named by String
+func ParseRole(s string) (Role, error) {
+	for r := RoleBanned; r <= RoleRoot; r++ {
+		if r.String() == s {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role: %s", s)
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role >= RoleAdmin
+}
+
+func (u *User) IsRoot() bool {
+	return u.Role == RoleRoot
+}
+
+func (u *User) IsBanned() bool {
+	return u.Role == RoleBanned
+}
+
+func (u *User) HasAcceptedTerms(version string) bool {
+	return u.TermsVersion == version
+}
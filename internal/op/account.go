@@ -0,0 +1,140 @@
+package op
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/storage"
+	"github.com/zijiren233/stream"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrDeletionScheduled    = errors.New("account deletion is already scheduled")
+	ErrDeletionNotScheduled = errors.New("account deletion is not scheduled")
+	ErrWrongPassword        = errors.New("wrong password")
+	ErrDeleteRoot           = errors.New("root users can't be deleted")
+)
+
+// ScheduleDeletion schedules the purge of the user and all its data after
+// the deletion delay, or purges it at once without a delay. Users with a
+// password must give it, and a code when two factor authentication is on.
+func (u *User) ScheduleDeletion(password, code string) (time.Time, error) {
+	if u.Role == model.RoleRoot {
+		return time.Time{}, ErrDeleteRoot
+	}
+	if u.DeletionScheduledAt != nil {
+		return time.Time{}, ErrDeletionScheduled
+	}
+	if len(u.HashedPassword) != 0 && bcrypt.CompareHashAndPassword(u.HashedPassword, stream.StringToBytes(password)) != nil {
+		return time.Time{}, ErrWrongPassword
+	}
+	if u.TOTPEnabled {
+		if err := u.CheckTwoFactor(code); err != nil {
+			return time.Time{}, err
+		}
+	}
+	delay := time.Duration(0)
+	if conf.Conf().User.DeletionDelay != "" {
+		var err error
+		delay, err = time.ParseDuration(conf.Conf().User.DeletionDelay)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	at := time.Now().Add(delay)
+	if delay <= 0 {
+		return at, PurgeUser(u.ID)
+	}
+	if err := db.ScheduleUserDeletion(u.ID, at); err != nil {
+		return time.Time{}, err
+	}
+	updateCachedUser(u, func(u *User) {
+		u.DeletionScheduledAt = &at
+	})
+	userChanged(u.ID)
+	return at, nil
+}
+
+func (u *User) CancelDeletion() error {
+	if u.DeletionScheduledAt == nil {
+		return ErrDeletionNotScheduled
+	}
+	if err := db.CancelUserDeletion(u.ID); err != nil {
+		return err
+	}
+	updateCachedUser(u, func(u *User) {
+		u.DeletionScheduledAt = nil
+	})
+	userChanged(u.ID)
+	return nil
+}
+
+// PurgeUser unloads the rooms of the user and deletes the user with all its data
+func PurgeUser(userID uint) error {
+	u, err := GetUserById(userID)
+	if err != nil {
+		return err
+	}
+	roomIDs, err := db.GetAllRoomIDsByUserID(userID)
+	if err != nil {
+		return err
+	}
+	movieRoomIDs, err := db.GetMovieRoomIDsByCreator(userID)
+	if err != nil {
+		return err
+	}
+	for _, id := range roomIDs {
+		if r, ok := roomCache.LoadAndDelete(id); ok {
+			r.close()
+		}
+	}
+	if err := deleteSubtitles(db.PurgeUser(userID)); err != nil {
+		return err
+	}
+	removeUserCache(userID)
+	removeUserRelationsCache(userID)
+	for _, id := range roomIDs {
+		removeRoomRelationsCache(id)
+		roomChanged(id)
+	}
+	// the movies added to other rooms now belong to their creators
+	for _, id := range movieRoomIDs {
+		movieCache.Remove(id)
+		moviesChanged(id)
+	}
+	if key, ok := avatarKey(u.Avatar); ok {
+		if s := storage.Default(); s != nil {
+			if err := s.Delete(key); err != nil {
+				log.Errorf("delete avatar %s failed: %s", key, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// PurgeDueUsers purges the users whose deletion is due and returns how many were purged
+func PurgeDueUsers() (int, error) {
+	ids, err := db.GetUserIDsDueForDeletion(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, id := range ids {
+		if err := PurgeUser(id); err != nil {
+			log.Errorf("purge user %d failed: %s", id, err.Error())
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Export returns every record kept about the user
+func (u *User) Export() (*db.UserExport, error) {
+	return db.ExportUser(u.ID)
+}
@@ -0,0 +1,107 @@
+package op
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+// APIKeyPrefix starts every api key, so the middleware tells them from jwts
+const APIKeyPrefix = "stv_"
+
+const (
+	MaxAPIKeys = 20
+	// apiKeyTouchInterval limits how often the last use of a key is written
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	ErrTooManyAPIKeys = errors.New("too many api keys")
+	ErrInvalidAPIKey  = errors.New("invalid or expired api key")
+	ErrNoAPIKeyScope  = errors.New("api key needs at least one scope")
+)
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+func hashAPIKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// CreateAPIKey returns a new key of the user limited to scopes, the key
+// itself is only returned here. A zero ttl never expires.
+func (u *User) CreateAPIKey(name string, scopes []model.APIKeyScope, ttl time.Duration) (*model.APIKey, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", ErrNoAPIKeyScope
+	}
+	n, err := db.CountAPIKeys(u.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	if n >= MaxAPIKeys {
+		return nil, "", ErrTooManyAPIKeys
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	k := &model.APIKey{
+		UserID:    u.ID,
+		Name:      name,
+		Prefix:    key[:len(APIKeyPrefix)+6],
+		HashedKey: hashAPIKey(key),
+		Scopes:    scopes,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		k.ExpiresAt = &expiresAt
+	}
+	if err := db.CreateAPIKey(k); err != nil {
+		return nil, "", err
+	}
+	return k, key, nil
+}
+
+func (u *User) APIKeys() ([]model.APIKey, error) {
+	return db.GetAPIKeysByUserID(u.ID)
+}
+
+func (u *User) DeleteAPIKey(id uint) error {
+	return db.DeleteAPIKey(u.ID, id)
+}
+
+// AuthAPIKey returns the key and its user
+func AuthAPIKey(key string) (*User, *model.APIKey, error) {
+	k, err := db.GetAPIKeyByHash(hashAPIKey(key))
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if k.ExpiresAt != nil && !k.ExpiresAt.After(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	u, err := GetUserById(k.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err := u.CheckBanned(); err != nil {
+		return nil, nil, err
+	}
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) > apiKeyTouchInterval {
+		if err := db.SetAPIKeyLastUsed(k.ID, now); err != nil {
+			return nil, nil, err
+		}
+		k.LastUsedAt = &now
+	}
+	return u, k, nil
+}
@@ -0,0 +1,60 @@
+package op
+
+import (
+	"errors"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+var (
+	ErrUserPending    = errors.New("user is waiting for approval")
+	ErrUserNotPending = errors.New("user is not waiting for approval")
+)
+
+// withApproval makes new users pending when approval is required
+func withApproval() db.CreateUserConfig {
+	return db.WithPending(conf.Conf().User.RequireApproval)
+}
+
+// CheckApproved returns ErrUserPending for users waiting for approval,
+// admins need no approval
+func (u *User) CheckApproved() error {
+	if u.Pending && !u.IsAdmin() {
+		return ErrUserPending
+	}
+	return nil
+}
+
+// ApproveUser approves the pending target on behalf of u
+func (u *User) ApproveUser(target *User) error {
+	if !u.CanManage(target) {
+		return ErrCannotManage
+	}
+	if !target.Pending {
+		return ErrUserNotPending
+	}
+	if err := db.ApproveUser(target.ID); err != nil {
+		return err
+	}
+	target.Pending = false
+	userChanged(target.ID)
+	return nil
+}
+
+// RejectUser deletes the pending target and all its data on behalf of u
+func (u *User) RejectUser(target *User) error {
+	if !u.CanManage(target) {
+		return ErrCannotManage
+	}
+	if !target.Pending {
+		return ErrUserNotPending
+	}
+	return PurgeUser(target.ID)
+}
+
+// GetPendingUsers returns a page of the users waiting for approval, oldest first
+func GetPendingUsers(offset, limit int) ([]*model.User, int64, error) {
+	return db.GetUsersPaginated(offset, limit, db.WithUserPending())
+}
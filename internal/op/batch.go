@@ -0,0 +1,68 @@
+package op
+
+import (
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/zijiren233/stream"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DeleteRooms deletes rooms created by u, either all of them or none
+func (u *User) DeleteRooms(ids []string) error {
+	keys, err := db.GetSubtitleKeysByRoomIDs(ids)
+	if err != nil {
+		return err
+	}
+	if err := db.DeleteCreatedRooms(u.ID, ids); err != nil {
+		return err
+	}
+	deleteSubtitleFiles(keys)
+	for _, id := range ids {
+		if r, ok := roomCache.LoadAndDelete(id); ok {
+			r.close()
+		}
+		removeRoomRelationsCache(id)
+		roomChanged(id)
+	}
+	return nil
+}
+
+// SetRoomsHidden hides or shows rooms created by u, either all of them or none
+func (u *User) SetRoomsHidden(ids []string, hidden bool) error {
+	if err := db.SetCreatedRoomsHidden(u.ID, ids, hidden); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if r, ok := roomCache.Load(id); ok {
+			r.settingUpdate.Lock()
+			s := r.Settings()
+			s.Hidden = hidden
+			r.setSetting(s)
+			r.settingUpdate.Unlock()
+		}
+		roomChanged(id)
+	}
+	return nil
+}
+
+// SetRoomsPassword sets the password of rooms created by u, either all of them or none,
+// an empty password removes it
+func (u *User) SetRoomsPassword(ids []string, password string) error {
+	var hashedPassword []byte
+	if password != "" {
+		var err error
+		hashedPassword, err = bcrypt.GenerateFromPassword(stream.StringToBytes(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+	}
+	if err := db.SetCreatedRoomsHashedPassword(u.ID, ids, hashedPassword); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if r, ok := roomCache.Load(id); ok {
+			r.setHashedPassword(hashedPassword)
+		}
+		roomChanged(id)
+	}
+	return nil
+}
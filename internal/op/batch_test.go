@@ -0,0 +1,59 @@
+package op_test
+
+import (
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/op"
+)
+
+func TestBatchRooms(t *testing.T) {
+	owner := newTestUser(t, "batch-owner")
+	other := newTestUser(t, "batch-other")
+	a := newTestRoom(t, owner, "batch-a")
+	b := newTestRoom(t, owner, "batch-b")
+	foreign := newTestRoom(t, other, "batch-foreign")
+	own := []string{a.ID, b.ID}
+
+	if err := owner.SetRoomsHidden(append(own, foreign.ID), true); err == nil {
+		t.Fatal("batch including a foreign room should fail")
+	}
+	for _, id := range own {
+		if r, err := db.GetRoomByID(id); err != nil {
+			t.Fatal(err)
+		} else if r.Hidden {
+			t.Fatal("a failed batch must not change any room")
+		}
+	}
+
+	if err := owner.SetRoomsHidden(own, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := owner.SetRoomsPassword(own, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*op.Room{a, b} {
+		if !r.Setting.Hidden || !r.NeedPassword() || !r.CheckPassword("secret") {
+			t.Fatalf("room %s not updated in memory", r.Name)
+		}
+		stored, err := db.GetRoomByID(r.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !stored.Hidden || !stored.CheckPassword("secret") || stored.CheckPassword("") {
+			t.Fatalf("room %s not updated in database", r.Name)
+		}
+	}
+
+	if err := owner.DeleteRooms(own); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range own {
+		if op.HasRoom(id) {
+			t.Fatalf("room %s should be deleted", id)
+		}
+	}
+	if !op.HasRoom(foreign.ID) {
+		t.Fatal("foreign room should be kept")
+	}
+}
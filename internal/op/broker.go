@@ -0,0 +1,276 @@
+package op
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Broker connects the instances serving the same rooms, so the clients of a
+// room see the same broadcasts, people number and playback whichever
+// instance they are connected to. Without a broker the instance is alone.
+//
+// Only this is shared, votes, mutes, voice and the chat tail of a room stay
+// on the instance of their clients. The instances also tell each other which
+// cached users, rooms, relations, movies, revoked tokens and settings changed.
+type Broker interface {
+	// Publish sends the event of the room to every instance, an empty roomID
+	// is an event of the whole instance. State events are also kept for the
+	// instances loading the room later.
+	Publish(ctx context.Context, roomID string, e *BrokerEvent) error
+	// Subscribe calls handle with the events of every room and of the
+	// instance, including the ones of this instance, until Close
+	Subscribe(handle func(roomID string, e *BrokerEvent)) error
+	// State returns the last state event of the room, nil if there is none
+	State(ctx context.Context, roomID string) (*BrokerEvent, error)
+	// SetPresence records the users connected to the room on instance for ttl
+	SetPresence(ctx context.Context, roomID, instance string, userIDs []uint, ttl time.Duration) error
+	// Presence returns the users connected to the room on every instance
+	Presence(ctx context.Context, roomID string) ([]uint, error)
+	Close() error
+}
+
+type BrokerEventKind uint8
+
+const (
+	// BrokerBroadcast is a message for the clients of the room
+	BrokerBroadcast BrokerEventKind = iota + 1
+	// BrokerState is the playback state after a change
+	BrokerState
+	// BrokerInvalidate drops cached entries changed by another instance
+	BrokerInvalidate
+)
+
+// BrokerEvent is what the instances of a room tell each other
+type BrokerEvent struct {
+	Kind     BrokerEventKind `json:"kind"`
+	Instance string          `json:"instance"`
+	// Time is when the event was published in unix milli
+	Time int64 `json:"time"`
+
+	// Message is the encoded pb.ElementMessage of a broadcast
+	Message    []byte   `json:"message,omitempty"`
+	Sender     string   `json:"sender,omitempty"`
+	SendToSelf bool     `json:"sendToSelf,omitempty"`
+	IgnoreID   []string `json:"ignoreId,omitempty"`
+
+	State *BrokerRoomState `json:"state,omitempty"`
+
+	Invalidate *BrokerInvalidation `json:"invalidate,omitempty"`
+}
+
+// BrokerRoomState is the playback state of a room, Seq orders the changes
+// made on different instances
+type BrokerRoomState struct {
+	MovieID  uint    `json:"movieId"`
+	Subtitle uint    `json:"subtitle"`
+	Seek     float64 `json:"seek"`
+	Rate     float64 `json:"rate"`
+	Playing  bool    `json:"playing"`
+	Seq      uint64  `json:"seq"`
+}
+
+type cluster struct {
+	Broker
+	instance string
+}
+
+var clusterBroker atomic.Pointer[cluster]
+
+// SetBroker makes this instance, named instance, share the rooms loaded after
+// through b, nil runs the instance alone
+func SetBroker(b Broker, instance string) error {
+	if b == nil {
+		clusterBroker.Store(nil)
+		return nil
+	}
+	c := &cluster{Broker: b, instance: instance}
+	if err := b.Subscribe(c.handle); err != nil {
+		return err
+	}
+	clusterBroker.Store(c)
+	return nil
+}
+
+// handle dispatches the events of the other instances, the events of rooms
+// not loaded here are dropped
+func (c *cluster) handle(roomID string, e *BrokerEvent) {
+	if e.Instance == c.instance || clusterBroker.Load() != c {
+		return
+	}
+	if roomID == "" {
+		if e.Kind == BrokerInvalidate && e.Invalidate != nil {
+			invalidate(e.Invalidate)
+		}
+		return
+	}
+	r, ok := roomCache.Load(roomID)
+	if !ok || !r.initOnce.Done() || r.hub.cluster != c {
+		return
+	}
+	r.handleEvent(e)
+}
+
+const (
+	brokerTimeout = 2 * time.Second
+	// presenceTTL outlives a few pings, the users of a crashed instance
+	// leave the people number when it expires
+	presenceTTL = 3 * pingInterval
+)
+
+// localMessageTypes are made by every instance for its own clients and are
+// never published
+var localMessageTypes = map[pb.ElementMessageType]struct{}{
+	pb.ElementMessageType_TICK:          {},
+	pb.ElementMessageType_COUNTDOWN:     {},
+	pb.ElementMessageType_PING:          {},
+	pb.ElementMessageType_PONG:          {},
+	pb.ElementMessageType_CHANGE_PEOPLE: {},
+}
+
+func (c *cluster) publish(roomID string, e *BrokerEvent) {
+	e.Instance = c.instance
+	e.Time = time.Now().UnixMilli()
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+	if err := c.Publish(ctx, roomID, e); err != nil {
+		log.Errorf("broker: publish room %s event failed: %s", roomID, err.Error())
+	}
+}
+
+// publishBroadcast shares a broadcast with the other instances
+func (c *cluster) publishBroadcast(roomID string, m *broadcastMessage) {
+	em, ok := m.data.(*ElementMessage)
+	if !ok {
+		return
+	}
+	if _, ok := localMessageTypes[em.Type]; ok {
+		return
+	}
+	b, err := proto.Marshal(em.ElementMessage)
+	if err != nil {
+		log.Errorf("broker: encode room %s message failed: %s", roomID, err.Error())
+		return
+	}
+	c.publish(roomID, &BrokerEvent{
+		Kind:       BrokerBroadcast,
+		Message:    b,
+		Sender:     m.sender,
+		SendToSelf: m.sendToSelf,
+		IgnoreID:   m.ignoreId,
+	})
+}
+
+// presence records the local clients and returns the number of users of the
+// room on every instance
+func (c *cluster) presence(roomID string, local []uint) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+	if err := c.SetPresence(ctx, roomID, c.instance, local, presenceTTL); err != nil {
+		return 0, err
+	}
+	return c.peopleNum(ctx, roomID)
+}
+
+// peopleNum returns the number of users of the room on every instance
+func (c *cluster) peopleNum(ctx context.Context, roomID string) (int64, error) {
+	ids, err := c.Presence(ctx, roomID)
+	if err != nil {
+		return 0, err
+	}
+	unique := make(map[uint]struct{}, len(ids))
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	return int64(len(unique)), nil
+}
+
+// joinCluster shares the playback state of the room with the other
+// instances and takes theirs, it returns false when the room is alone
+func (r *Room) joinCluster() bool {
+	c := clusterBroker.Load()
+	if c == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+	shared := false
+	if e, err := c.State(ctx, r.ID); err != nil {
+		log.Errorf("broker: load room %s state failed: %s", r.ID, err.Error())
+	} else if e != nil && e.State != nil {
+		r.applyState(e)
+		shared = true
+	}
+	r.hub.cluster = c
+	r.current.onChange = func(cur Current) {
+		c.publish(r.ID, &BrokerEvent{
+			Kind: BrokerState,
+			State: &BrokerRoomState{
+				MovieID:  cur.Movie.ID,
+				Subtitle: cur.Subtitle,
+				Seek:     cur.Status.Seek,
+				Rate:     cur.Status.Rate,
+				Playing:  cur.Status.Playing,
+				Seq:      cur.Status.Seq,
+			},
+		})
+	}
+	return shared
+}
+
+func (r *Room) handleEvent(e *BrokerEvent) {
+	switch e.Kind {
+	case BrokerBroadcast:
+		em := &pb.ElementMessage{}
+		if err := proto.Unmarshal(e.Message, em); err != nil {
+			log.Errorf("broker: decode room %s message failed: %s", r.ID, err.Error())
+			return
+		}
+		if em.Type == pb.ElementMessageType_CHAT_MESSAGE {
+			r.chats.add(em)
+		}
+		msg := &broadcastMessage{
+			data:       &ElementMessage{ElementMessage: em},
+			sender:     e.Sender,
+			sendToSelf: e.SendToSelf,
+			ignoreId:   e.IgnoreID,
+		}
+		if err := r.hub.broadcastLocal(msg); err != nil {
+			log.Debugf("broker: room %s broadcast failed: %s", r.ID, err.Error())
+		}
+	case BrokerState:
+		if e.State != nil {
+			r.applyState(e)
+		}
+	}
+}
+
+// applyState takes the playback state of another instance unless a newer
+// change was made here, equal changes are settled by the instance names so
+// every instance keeps the same one
+func (r *Room) applyState(e *BrokerEvent) {
+	s := e.State
+	var movie model.Movie
+	if s.MovieID != 0 {
+		if r.current.Movie().ID == s.MovieID {
+			movie = r.current.Movie()
+		} else {
+			m, err := GetMovieByID(r.ID, s.MovieID)
+			if err != nil {
+				log.Errorf("broker: room %s movie %d of the shared state: %s", r.ID, s.MovieID, err.Error())
+				return
+			}
+			movie = *m
+		}
+	}
+	c := clusterBroker.Load()
+	wins := func(local uint64) bool {
+		return s.Seq > local || (s.Seq == local && c != nil && e.Instance > c.instance)
+	}
+	r.current.apply(movie, s, time.Since(time.UnixMilli(e.Time)), wins)
+}
@@ -1,12 +1,16 @@
 package op
 
 import (
+	"errors"
 	"io"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/synctv-org/synctv/internal/proxy"
+	pb "github.com/synctv-org/synctv/proto"
 )
 
 type Client struct {
@@ -17,8 +21,36 @@ type Client struct {
 	conn    *websocket.Conn
 	timeOut time.Duration
 	closed  uint32
+
+	protocol   atomic.Pointer[protocol]
+	negotiated uint32
+	// rtt is the smoothed round trip time in milliseconds, 0 until measured
+	rtt int64
+	// reactions limits the reactions the client sends
+	reactions *proxy.Limiter
+	// danmaku limits the danmaku the client sends
+	danmaku *proxy.Limiter
+	// messages limits every message the client sends
+	messages *proxy.Limiter
+	// warnedAt is when the client was last warned for going over the message
+	// limit, only the reader goroutine uses it
+	warnedAt time.Time
 }
 
+// a client can send messageBurst messages at once, then one every messageInterval
+const (
+	messageBurst    = 60
+	messageInterval = 50 * time.Millisecond
+	// messageWarnPeriod is how long a warning lasts, a client going over the
+	// limit again within it is disconnected
+	messageWarnPeriod = 10 * time.Second
+)
+
+var (
+	ErrMessageRateLimited = errors.New("too many messages, slow down or you will be disconnected")
+	ErrMessageFlood       = errors.New("disconnected for sending too many messages")
+)
+
 func newClient(user *User, room *Room, conn *websocket.Conn) *Client {
 	return &Client{
 		r:       room,
@@ -26,9 +58,29 @@ func newClient(user *User, room *Room, conn *websocket.Conn) *Client {
 		c:       make(chan Message, 128),
 		conn:    conn,
 		timeOut: 10 * time.Second,
+
+		reactions: proxy.NewBurstLimiter(reactionBurst, reactionInterval),
+		danmaku:   proxy.NewBurstLimiter(danmakuBurst, danmakuInterval),
+		messages:  proxy.NewBurstLimiter(messageBurst, messageInterval),
 	}
 }
 
+// AllowMessage takes a token for a message received from the client. Going
+// over the limit returns ErrMessageRateLimited, the message should be dropped
+// and the client warned, and ErrMessageFlood when it happens again within
+// messageWarnPeriod of the warning, the client should be disconnected.
+func (c *Client) AllowMessage() error {
+	if c.messages.Allow() {
+		return nil
+	}
+	now := time.Now()
+	if !c.warnedAt.IsZero() && now.Sub(c.warnedAt) < messageWarnPeriod {
+		return ErrMessageFlood
+	}
+	c.warnedAt = now
+	return ErrMessageRateLimited
+}
+
 func (c *Client) User() *User {
 	return c.u
 }
@@ -37,6 +89,65 @@ func (c *Client) Room() *Room {
 	return c.r
 }
 
+// Negotiate sets the protocol of the connection from the client's HELLO,
+// and returns the version and capabilities in use, it can be done only once
+func (c *Client) Negotiate(version uint32, capabilities []string) (uint32, []string, error) {
+	if !atomic.CompareAndSwapUint32(&c.negotiated, 0, 1) {
+		return 0, nil, ErrAlreadyNegotiated
+	}
+	p := negotiate(version, capabilities)
+	c.protocol.Store(p)
+	caps := make([]string, 0, len(p.capabilities))
+	for c := range p.capabilities {
+		caps = append(caps, c)
+	}
+	sort.Strings(caps)
+	return p.version, caps, nil
+}
+
+func (c *Client) getProtocol() *protocol {
+	if p := c.protocol.Load(); p != nil {
+		return p
+	}
+	return legacyProtocol
+}
+
+func (c *Client) ProtocolVersion() uint32 {
+	return c.getProtocol().version
+}
+
+func (c *Client) HasCapability(capability string) bool {
+	return c.getProtocol().has(capability)
+}
+
+// UpdateRTT measures the round trip of a PING sent at sentAt unix milli,
+// samples are smoothed so a single slow frame does not move the estimate
+func (c *Client) UpdateRTT(sentAt int64) {
+	sample := time.Now().UnixMilli() - sentAt
+	if sample < 0 || sample > maxRTT.Milliseconds() {
+		return
+	}
+	for {
+		old := atomic.LoadInt64(&c.rtt)
+		rtt := sample
+		if old != 0 {
+			rtt = (old*7 + sample) / 8
+		}
+		if atomic.CompareAndSwapInt64(&c.rtt, old, rtt) {
+			return
+		}
+	}
+}
+
+func (c *Client) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.rtt)) * time.Millisecond
+}
+
+// Delay is the estimated one-way delay to the client in milliseconds
+func (c *Client) Delay() int64 {
+	return atomic.LoadInt64(&c.rtt) / 2
+}
+
 func (c *Client) Broadcast(msg Message, conf ...BroadcastConf) error {
 	return c.r.hub.Broadcast(msg, conf...)
 }
@@ -47,6 +158,13 @@ func (c *Client) Send(msg Message) error {
 	if c.Closed() {
 		return ErrAlreadyClosed
 	}
+	// message types the client did not negotiate are dropped
+	if em, ok := msg.(interface{ GetType() pb.ElementMessageType }); ok && !c.getProtocol().accepts(em.GetType()) {
+		return nil
+	}
+	if delay := c.Delay(); delay > 0 {
+		msg = withDelay(msg, delay)
+	}
 	c.c <- msg
 	return nil
 }
@@ -64,6 +182,11 @@ func (c *Client) Closed() bool {
 	return atomic.LoadUint32(&c.closed) == 1
 }
 
+// QueueLen is the number of messages waiting to be written to the client
+func (c *Client) QueueLen() int {
+	return len(c.c)
+}
+
 func (c *Client) GetReadChan() <-chan Message {
 	return c.c
 }
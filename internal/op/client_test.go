@@ -0,0 +1,32 @@
+package op_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/op"
+)
+
+func TestClientMessageLimit(t *testing.T) {
+	creator := newTestUser(t, "flood-creator")
+	room := newTestRoom(t, creator, "flood-room")
+	c, err := room.RegClient(creator, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(creator)
+
+	allowed := 0
+	for ; err == nil; allowed++ {
+		if allowed > 1000 {
+			t.Fatal("the message limit is never reached")
+		}
+		err = c.AllowMessage()
+	}
+	if allowed == 1 || !errors.Is(err, op.ErrMessageRateLimited) {
+		t.Fatalf("after %d messages: err = %v, want %v", allowed-1, err, op.ErrMessageRateLimited)
+	}
+	if err := c.AllowMessage(); !errors.Is(err, op.ErrMessageFlood) {
+		t.Fatalf("message after the warning: err = %v, want %v", err, op.ErrMessageFlood)
+	}
+}
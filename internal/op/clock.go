@@ -0,0 +1,95 @@
+package op
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+const (
+	// tickInterval is how often the playback clock is broadcast to the room
+	tickInterval = 3 * time.Second
+	// seekDebounce is how long a burst of seeks is collected before the result is broadcast
+	seekDebounce = 300 * time.Millisecond
+	// maxRTT is the longest round trip taken as a measurement, longer ones are stale pongs
+	maxRTT = 10 * time.Second
+)
+
+// MaxDrift is how many seconds a client may be off the playback clock before it is corrected
+const MaxDrift = 3.0
+
+type seekDebouncer struct {
+	lock  sync.Mutex
+	timer *time.Timer
+}
+
+// tickMessage is the playback clock of the room. The server advances the
+// position itself from a monotonic clock between client events, so late
+// joiners and drifting clients converge on the same status.
+func (r *Room) tickMessage() *ElementMessage {
+	c := r.current.Current()
+	return &ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type: pb.ElementMessageType_TICK,
+			Current: &pb.Current{
+				Movie: &pb.MovieInfo{Id: uint64(c.Movie.ID)},
+				Status: &pb.Status{
+					Seek:    c.Status.Seek,
+					Rate:    c.Status.Rate,
+					Playing: c.Status.Playing,
+				},
+			},
+			Time: time.Now().UnixMilli(),
+			Seq:  c.Status.Seq,
+		},
+	}
+}
+
+// Drift returns how many seconds a client that reported seek timeDiff seconds
+// ago is ahead of the playback clock, negative when it is behind.
+// Live movies have no position and never drift.
+func (r *Room) Drift(seek, timeDiff float64) (Status, float64) {
+	c := r.Current()
+	if c.Movie.BaseMovieInfo.Live {
+		return c.Status, 0
+	}
+	if c.Status.Playing {
+		seek += timeDiff * c.Status.Rate
+	}
+	return c.Status, seek - c.Status.Seek
+}
+
+// Seek applies a seek at once, concurrent seeks are resolved by the order the
+// server receives them. flush is called with the resulting status once no
+// other seek arrived for seekDebounce, only the flush of the last seek of a
+// burst is called.
+func (r *Room) Seek(seek, rate, timeDiff float64, flush func(Status)) Status {
+	status := r.SetSeekRate(seek, rate, timeDiff)
+	r.seek.lock.Lock()
+	defer r.seek.lock.Unlock()
+	if r.seek.timer != nil {
+		r.seek.timer.Stop()
+	}
+	r.seek.timer = time.AfterFunc(seekDebounce, func() {
+		flush(r.current.Status())
+	})
+	return status
+}
+
+// tick broadcasts the playback clock while the room has clients and a current movie
+func (r *Room) tick() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if r.ClientNum() == 0 || r.current.Movie().ID == 0 {
+				continue
+			}
+			r.Broadcast(r.tickMessage())
+		case <-r.hub.exit:
+			return
+		}
+	}
+}
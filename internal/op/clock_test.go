@@ -0,0 +1,137 @@
+package op_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+func TestPlaybackClock(t *testing.T) {
+	creator := newTestUser(t, "clock-creator")
+	room := newTestRoom(t, creator, "clock-room")
+
+	if err := room.AddMovie(creator.NewMovie(model.MovieInfo{
+		BaseMovieInfo: model.BaseMovieInfo{
+			Url:  "https://example.com/movie.mp4",
+			Name: "movie",
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := room.ChangeCurrentMovie(ms[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	room.SetStatus(true, 10, 2, 0)
+
+	c, err := room.RegClient(creator, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(creator)
+	if _, _, err := c.Negotiate(op.ProtocolVersion, []string{op.CapabilityTick}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	room.Greet(c)
+	em := nextElementMessage(t, c)
+	if em.Type != pb.ElementMessageType_TICK {
+		t.Fatalf("late joiner got %v, want a tick", em)
+	}
+	if em.Current.Movie.Id != uint64(ms[0].ID) {
+		t.Fatalf("tick movie = %d, want %d", em.Current.Movie.Id, ms[0].ID)
+	}
+	// the server advanced the position at twice the speed without client events
+	if s := em.Current.Status; !s.Playing || s.Rate != 2 || s.Seek < 10.2 {
+		t.Fatalf("tick status = %v, want playing at rate 2 past 10.2", s)
+	}
+}
+
+func TestClientDelay(t *testing.T) {
+	creator := newTestUser(t, "delay-creator")
+	room := newTestRoom(t, creator, "delay-room")
+
+	c, err := room.RegClient(creator, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(creator)
+	if _, _, err := c.Negotiate(op.ProtocolVersion, []string{op.CapabilityRTT}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.UpdateRTT(time.Now().Add(-100 * time.Millisecond).UnixMilli())
+	if rtt := c.RTT(); rtt < 100*time.Millisecond || rtt > 200*time.Millisecond {
+		t.Fatalf("RTT() = %s, want about 100ms", rtt)
+	}
+	// a stale pong does not count
+	c.UpdateRTT(time.Now().Add(-time.Minute).UnixMilli())
+	if rtt := c.RTT(); rtt > 200*time.Millisecond {
+		t.Fatalf("RTT() = %s after a stale pong, want about 100ms", rtt)
+	}
+
+	play := &pb.ElementMessage{Type: pb.ElementMessageType_PLAY, Seek: 1, Rate: 1}
+	if err := room.Broadcast(&op.ElementMessage{ElementMessage: play}); err != nil {
+		t.Fatal(err)
+	}
+	em := nextElementMessage(t, c)
+	for em.Type != pb.ElementMessageType_PLAY {
+		em = nextElementMessage(t, c)
+	}
+	if em.Delay != c.Delay() || em.Delay < 50 {
+		t.Fatalf("play delay = %d, want %d", em.Delay, c.Delay())
+	}
+	if play.Delay != 0 {
+		t.Fatal("the broadcast message was changed")
+	}
+}
+
+func TestSaveRoomStates(t *testing.T) {
+	creator := newTestUser(t, "save-state-creator")
+	room := newTestRoom(t, creator, "save-state-room")
+
+	if err := room.AddMovie(creator.NewMovie(model.MovieInfo{
+		BaseMovieInfo: model.BaseMovieInfo{
+			Url:  "https://example.com/movie.mp4",
+			Name: "movie",
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := room.ChangeCurrentMovie(ms[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	room.SetStatus(false, 1234, 1.25, 0)
+
+	if n := op.SaveRoomStates(); n == 0 {
+		t.Fatal("SaveRoomStates() saved no room")
+	}
+	s, err := db.GetRoomState(room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CurrentMovieID != ms[0].ID || s.Seek != 1234 || s.Rate != 1.25 || s.Playing {
+		t.Fatalf("saved state = %+v, want movie %d paused at 1234", s, ms[0].ID)
+	}
+
+	// an unchanged paused room is not written again
+	if err := db.SaveRoomState(&model.RoomState{RoomID: room.ID}); err != nil {
+		t.Fatal(err)
+	}
+	op.SaveRoomStates()
+	if s, err := db.GetRoomState(room.ID); err != nil || s.Seek != 0 {
+		t.Fatalf("unchanged room state was saved again: %+v, %v", s, err)
+	}
+}
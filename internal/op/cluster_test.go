@@ -0,0 +1,327 @@
+package op_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	pb "github.com/synctv-org/synctv/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// memoryBroker keeps the published events and lets the tests play other
+// instances by calling the handlers directly
+type memoryBroker struct {
+	lock      sync.Mutex
+	published []*op.BrokerEvent
+	handle    func(string, *op.BrokerEvent)
+	state     map[string]*op.BrokerEvent
+	// presence is the users of each room by instance
+	presence map[string]map[string][]uint
+}
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{
+		state:    map[string]*op.BrokerEvent{},
+		presence: map[string]map[string][]uint{},
+	}
+}
+
+func (b *memoryBroker) Publish(_ context.Context, roomID string, e *op.BrokerEvent) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.published = append(b.published, e)
+	if e.Kind == op.BrokerState {
+		b.state[roomID] = e
+	}
+	return nil
+}
+
+func (b *memoryBroker) Subscribe(handle func(string, *op.BrokerEvent)) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.handle = handle
+	return nil
+}
+
+func (b *memoryBroker) State(_ context.Context, roomID string) (*op.BrokerEvent, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state[roomID], nil
+}
+
+func (b *memoryBroker) SetPresence(_ context.Context, roomID, instance string, userIDs []uint, _ time.Duration) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.presence[roomID] == nil {
+		b.presence[roomID] = map[string][]uint{}
+	}
+	b.presence[roomID][instance] = userIDs
+	return nil
+}
+
+func (b *memoryBroker) Presence(_ context.Context, roomID string) ([]uint, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var ids []uint
+	for _, userIDs := range b.presence[roomID] {
+		ids = append(ids, userIDs...)
+	}
+	return ids, nil
+}
+
+func (b *memoryBroker) Close() error {
+	return nil
+}
+
+// inject delivers e to the room, or the instance when roomID is empty, as
+// if another instance published it
+func (b *memoryBroker) inject(t *testing.T, roomID string, e *op.BrokerEvent) {
+	t.Helper()
+	b.lock.Lock()
+	handle := b.handle
+	b.lock.Unlock()
+	if handle == nil {
+		t.Fatal("broker is not subscribed")
+	}
+	e.Time = time.Now().UnixMilli()
+	handle(roomID, e)
+}
+
+func (b *memoryBroker) events(kind op.BrokerEventKind) []*op.BrokerEvent {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var es []*op.BrokerEvent
+	for _, e := range b.published {
+		if e.Kind == kind {
+			es = append(es, e)
+		}
+	}
+	return es
+}
+
+func TestCluster(t *testing.T) {
+	b := newMemoryBroker()
+	if err := op.SetBroker(b, "instance-b"); err != nil {
+		t.Fatal(err)
+	}
+	defer op.SetBroker(nil, "")
+
+	creator := newTestUser(t, "cluster-creator")
+	room := newTestRoom(t, creator, "cluster-room")
+	c, err := room.RegClient(creator, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(creator)
+
+	room.Broadcast(&op.ElementMessage{ElementMessage: &pb.ElementMessage{
+		Type: pb.ElementMessageType_TICK,
+	}})
+	room.Broadcast(&op.ElementMessage{ElementMessage: &pb.ElementMessage{
+		Type:    pb.ElementMessageType_CHAT_MESSAGE,
+		Message: "from b",
+	}})
+	if em := nextElementMessage(t, c); em.Message != "from b" {
+		t.Fatalf("local client got %v, want the chat message", em)
+	}
+	es := b.events(op.BrokerBroadcast)
+	var chats int
+	for _, e := range es {
+		em := &pb.ElementMessage{}
+		if err := proto.Unmarshal(e.Message, em); err != nil {
+			t.Fatal(err)
+		}
+		if e.Instance != "instance-b" {
+			t.Fatalf("published from %s, want instance-b", e.Instance)
+		}
+		switch em.Type {
+		case pb.ElementMessageType_TICK:
+			t.Fatal("tick of this instance was published")
+		case pb.ElementMessageType_CHAT_MESSAGE:
+			if em.Message == "from b" {
+				chats++
+			}
+		}
+	}
+	if chats != 1 {
+		t.Fatalf("published the chat message %d times", chats)
+	}
+
+	msg, err := proto.Marshal(&pb.ElementMessage{
+		Type:    pb.ElementMessageType_CHAT_MESSAGE,
+		Message: "from a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.inject(t, room.ID, &op.BrokerEvent{Kind: op.BrokerBroadcast, Instance: "instance-a", Message: msg})
+	if em := nextElementMessage(t, c); em.Message != "from a" {
+		t.Fatalf("local client got %v, want the remote chat message", em)
+	}
+	if n := len(b.events(op.BrokerBroadcast)); n != len(es) {
+		t.Fatalf("remote broadcast was published again, %d broadcasts", n)
+	}
+
+	if err := room.AddMovie(creator.NewMovie(model.MovieInfo{
+		BaseMovieInfo: model.BaseMovieInfo{
+			Url:  "https://example.com/movie.mp4",
+			Name: "movie",
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := room.ChangeCurrentMovie(ms[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	room.SetStatus(false, 10, 1, 0)
+	states := b.events(op.BrokerState)
+	if len(states) == 0 {
+		t.Fatal("state changes were not published")
+	}
+	last := states[len(states)-1].State
+	if last.MovieID != ms[0].ID || last.Seek != 10 || last.Playing {
+		t.Fatalf("published state %+v", last)
+	}
+
+	seq := room.Current().Status.Seq
+	b.inject(t, room.ID, &op.BrokerEvent{Kind: op.BrokerState, Instance: "instance-a", State: &op.BrokerRoomState{
+		MovieID: ms[0].ID, Seek: 42, Rate: 1, Seq: seq + 1,
+	}})
+	if s := room.Current().Status; s.Seek != 42 || s.Seq != seq+1 {
+		t.Fatalf("newer remote state not applied: %+v", s)
+	}
+	// equal changes go to the greater instance name on every instance
+	b.inject(t, room.ID, &op.BrokerEvent{Kind: op.BrokerState, Instance: "instance-a", State: &op.BrokerRoomState{
+		MovieID: ms[0].ID, Seek: 50, Rate: 1, Seq: seq + 1,
+	}})
+	if s := room.Current().Status; s.Seek != 42 {
+		t.Fatalf("tied state of a lesser instance applied: %+v", s)
+	}
+	b.inject(t, room.ID, &op.BrokerEvent{Kind: op.BrokerState, Instance: "instance-c", State: &op.BrokerRoomState{
+		MovieID: ms[0].ID, Seek: 60, Rate: 1, Seq: seq + 1,
+	}})
+	if s := room.Current().Status; s.Seek != 60 {
+		t.Fatalf("tied state of a greater instance not applied: %+v", s)
+	}
+	if n := len(b.events(op.BrokerState)); n != len(states) {
+		t.Fatalf("applied states were published again, %d states", n)
+	}
+}
+
+func TestClusterInvalidation(t *testing.T) {
+	b := newMemoryBroker()
+	if err := op.SetBroker(b, "instance-b"); err != nil {
+		t.Fatal(err)
+	}
+	defer op.SetBroker(nil, "")
+
+	u := newTestUser(t, "cluster-invalidate")
+	if _, err := u.UpdateProfile("local", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	var published bool
+	for _, e := range b.events(op.BrokerInvalidate) {
+		if e.Invalidate.Cache == "user" && e.Invalidate.UserID == u.ID {
+			published = true
+		}
+	}
+	if !published {
+		t.Fatal("profile change was not published")
+	}
+
+	// another instance changes the user
+	if err := db.SetUserProfile(u.ID, "remote", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	b.inject(t, "", &op.BrokerEvent{Kind: op.BrokerInvalidate, Instance: "instance-a", Invalidate: &op.BrokerInvalidation{
+		Cache: "user", UserID: u.ID,
+	}})
+	if got, err := op.GetUserById(u.ID); err != nil {
+		t.Fatal(err)
+	} else if got.DisplayName != "remote" {
+		t.Fatalf("display name %q, want the remote change", got.DisplayName)
+	}
+
+	room := newTestRoom(t, u, "cluster-invalidate")
+	setting := room.Setting
+	setting.Hidden = true
+	if err := db.ChangeRoomSetting(room.ID, setting); err != nil {
+		t.Fatal(err)
+	}
+	b.inject(t, "", &op.BrokerEvent{Kind: op.BrokerInvalidate, Instance: "instance-a", Invalidate: &op.BrokerInvalidation{
+		Cache: "room", RoomID: room.ID,
+	}})
+	if !room.Setting.Hidden {
+		t.Fatal("remote setting change not reloaded")
+	}
+	if err := db.DeleteRoomByID(room.ID); err != nil {
+		t.Fatal(err)
+	}
+	b.inject(t, "", &op.BrokerEvent{Kind: op.BrokerInvalidate, Instance: "instance-a", Invalidate: &op.BrokerInvalidation{
+		Cache: "room", RoomID: room.ID,
+	}})
+	if _, err := op.GetRoomByID(room.ID); err == nil {
+		t.Fatal("room deleted on another instance is still loaded")
+	}
+
+	b.inject(t, "", &op.BrokerEvent{Kind: op.BrokerInvalidate, Instance: "instance-a", Invalidate: &op.BrokerInvalidation{
+		Cache: "token", Token: "cluster-token", Expires: time.Now().Add(time.Hour).UnixMilli(),
+	}})
+	if !op.IsTokenRevoked("cluster-token") {
+		t.Fatal("token revoked on another instance is accepted")
+	}
+}
+
+func TestClusterPeopleNum(t *testing.T) {
+	b := newMemoryBroker()
+	if err := op.SetBroker(b, "instance-b"); err != nil {
+		t.Fatal(err)
+	}
+	defer op.SetBroker(nil, "")
+
+	creator := newTestUser(t, "cluster-people")
+	room := newTestRoom(t, creator, "cluster-people")
+	if err := op.HibernateRoom(room); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := db.DB().Model(&model.Room{}).Where("id = ?", room.ID).Updates(map[string]any{
+		"created_at":     old,
+		"last_active_at": old,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// the users are connected to another instance only
+	if err := b.SetPresence(context.Background(), room.ID, "instance-a", []uint{creator.ID, creator.ID}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if n := op.PeopleNum(room.ID); n != 1 {
+		t.Fatalf("people num = %d, want the user on the other instance", n)
+	}
+	if _, err := op.DeleteInactiveRooms(24 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if !op.HasRoom(room.ID) {
+		t.Fatal("room with users on another instance was deleted")
+	}
+
+	if err := b.SetPresence(context.Background(), room.ID, "instance-a", nil, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := op.DeleteInactiveRooms(24 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if op.HasRoom(room.ID) {
+		t.Fatal("room without users on any instance should be deleted")
+	}
+}
@@ -11,11 +11,15 @@ import (
 type current struct {
 	current Current
 	lock    sync.RWMutex
+	// onChange is called with the state after every change, see Broker
+	onChange func(Current)
 }
 
 type Current struct {
 	Movie  model.Movie `json:"movie"`
 	Status Status      `json:"status"`
+	// Subtitle is the track of the movie shown, 0 for none
+	Subtitle uint `json:"subtitle"`
 }
 
 func newCurrent() *current {
@@ -27,9 +31,11 @@ func newCurrent() *current {
 }
 
 type Status struct {
-	Seek       float64 `json:"seek"`
-	Rate       float64 `json:"rate"`
-	Playing    bool    `json:"playing"`
+	Seek    float64 `json:"seek"`
+	Rate    float64 `json:"rate"`
+	Playing bool    `json:"playing"`
+	// Seq is increased on every change, the last writer wins
+	Seq        uint64 `json:"seq"`
 	lastUpdate time.Time
 }
 
@@ -57,11 +63,40 @@ func (c *current) Movie() model.Movie {
 
 func (c *current) SetMovie(movie model.Movie) {
 	c.lock.Lock()
-	defer c.lock.Unlock()
-
 	c.current.Movie = movie
+	c.current.Subtitle = 0
 	c.current.SetSeek(0, 0)
 	c.current.Status.Playing = true
+	c.current.Status.Seq++
+	c.unlockChanged()
+}
+
+// unlockChanged unlocks the state and tells onChange about it
+func (c *current) unlockChanged() {
+	cur := c.current
+	c.lock.Unlock()
+	if c.onChange != nil {
+		c.onChange(cur)
+	}
+}
+
+func (c *current) Subtitle() uint {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.current.Subtitle
+}
+
+// SetSubtitle shows the subtitle track id if movieID is still the current movie
+func (c *current) SetSubtitle(movieID, id uint) bool {
+	c.lock.Lock()
+	if c.current.Movie.ID != movieID {
+		c.lock.Unlock()
+		return false
+	}
+	c.current.Subtitle = id
+	c.current.Status.Seq++
+	c.unlockChanged()
+	return true
 }
 
 func (c *current) Status() Status {
@@ -73,16 +108,47 @@ func (c *current) Status() Status {
 
 func (c *current) SetStatus(playing bool, seek, rate, timeDiff float64) Status {
 	c.lock.Lock()
-	defer c.lock.Unlock()
-
-	return c.current.SetStatus(playing, seek, rate, timeDiff)
+	c.current.Status.Seq++
+	s := c.current.SetStatus(playing, seek, rate, timeDiff)
+	c.unlockChanged()
+	return s
 }
 
 func (c *current) SetSeekRate(seek, rate, timeDiff float64) Status {
 	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.current.Status.Seq++
+	s := c.current.SetSeekRate(seek, rate, timeDiff)
+	c.unlockChanged()
+	return s
+}
 
-	return c.current.SetSeekRate(seek, rate, timeDiff)
+func (c *current) SetRate(rate float64) Status {
+	c.lock.Lock()
+	c.current.Status.Seq++
+	s := c.current.SetRate(rate)
+	c.unlockChanged()
+	return s
+}
+
+// apply takes the state of another instance published age ago if wins
+// reports it is newer than the local seq, onChange is not called
+func (c *current) apply(movie model.Movie, s *BrokerRoomState, age time.Duration, wins func(local uint64) bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !wins(c.current.Status.Seq) {
+		return
+	}
+	if age < 0 {
+		age = 0
+	}
+	c.current.Movie = movie
+	c.current.Subtitle = s.Subtitle
+	c.current.Status.Seek = s.Seek
+	c.current.Status.Rate = s.Rate
+	c.current.Status.Playing = s.Playing
+	c.current.Status.Seq = s.Seq
+	// the seek runs on from when it was published
+	c.current.Status.lastUpdate = time.Now().Add(-age)
 }
 
 func (c *Current) Proto() *pb.Current {
@@ -107,6 +173,7 @@ func (c *Current) Proto() *pb.Current {
 			Rate:    c.Status.Rate,
 			Playing: c.Status.Playing,
 		},
+		Subtitle: uint64(c.Subtitle),
 	}
 }
 
@@ -170,3 +237,13 @@ func (c *Current) SetSeek(seek, timeDiff float64) Status {
 	c.Status.lastUpdate = time.Now()
 	return c.Status
 }
+
+// SetRate changes the rate from the current position of the clock
+func (c *Current) SetRate(rate float64) Status {
+	if c.Movie.BaseMovieInfo.Live {
+		return c.setLiveStatus()
+	}
+	c.updateSeek()
+	c.Status.Rate = rate
+	return c.Status
+}
@@ -0,0 +1,111 @@
+package op
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+const (
+	maxDanmakuLength = 100
+	// MaxDanmakus is the most danmaku loaded at once
+	MaxDanmakus = 5000
+	// a client can send danmakuBurst danmaku at once, then one every danmakuInterval
+	danmakuBurst    = 3
+	danmakuInterval = time.Second
+)
+
+var (
+	ErrDanmakuDisabled = errors.New("danmaku is disabled")
+	ErrInvalidDanmaku  = errors.New("danmaku must be 1 to 100 characters")
+	ErrInvalidColor    = errors.New("color must be #rrggbb")
+	ErrNoCurrentMovie  = errors.New("no movie is playing")
+	ErrTooManyDanmaku  = errors.New("too many danmaku")
+)
+
+var colorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// SendDanmaku saves a danmaku shown at time seconds of the current movie,
+// live movies have no timeline so their danmaku are saved at 0. Danmaku are
+// chat shown over the movie, so they go through the chat filter and are
+// refused while the chat is disabled.
+func (r *Room) SendDanmaku(userID uint, content, color string, time float64) (*model.Danmaku, error) {
+	setting := r.Settings()
+	if setting.DisableDanmaku {
+		return nil, ErrDanmakuDisabled
+	}
+	if setting.DisableChat {
+		return nil, ErrChatDisabled
+	}
+	if content == "" || utf8.RuneCountInString(content) > maxDanmakuLength {
+		return nil, ErrInvalidDanmaku
+	}
+	if color != "" && !colorRegexp.MatchString(color) {
+		return nil, ErrInvalidColor
+	}
+	if err := r.allowDanmaku(userID); err != nil {
+		return nil, err
+	}
+	content, err := r.FilterChat(userID, content)
+	if err != nil {
+		return nil, err
+	}
+	m := r.current.Movie()
+	if m.ID == 0 {
+		return nil, ErrNoCurrentMovie
+	}
+	if m.Live || time < 0 || math.IsNaN(time) || math.IsInf(time, 0) {
+		time = 0
+	}
+	d := &model.Danmaku{
+		RoomID:  r.ID,
+		MovieID: m.ID,
+		Time:    time,
+		UserID:  userID,
+		Content: content,
+		Color:   color,
+	}
+	if err := db.CreateDanmaku(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// allowDanmaku takes a token of the danmaku limit of the client of the user
+func (r *Room) allowDanmaku(userID uint) error {
+	if r.hub == nil {
+		return ErrClientNotConnected
+	}
+	c, ok := r.hub.clients.Load(userID)
+	if !ok {
+		return ErrClientNotConnected
+	}
+	if !c.danmaku.Allow() {
+		return ErrTooManyDanmaku
+	}
+	return nil
+}
+
+// GetDanmakus returns the danmaku of a movie shown from from to to seconds
+func (r *Room) GetDanmakus(movieID uint, from, to float64) ([]*model.Danmaku, error) {
+	if _, err := GetMovieByID(r.ID, movieID); err != nil {
+		return nil, err
+	}
+	return db.GetDanmakus(r.ID, movieID, from, to, MaxDanmakus)
+}
+
+func DanmakuProto(d *model.Danmaku) *pb.Danmaku {
+	return &pb.Danmaku{
+		Id:      uint64(d.ID),
+		MovieId: uint64(d.MovieID),
+		Time:    d.Time,
+		Content: d.Content,
+		Color:   d.Color,
+	}
+}
@@ -0,0 +1,38 @@
+package op
+
+import "sort"
+
+// RoomStats is the load of a room loaded in memory, for diagnosing the
+// rooms that leak or fall behind
+type RoomStats struct {
+	RoomID         string
+	Clients        int64
+	Channels       int64
+	BroadcastQueue int
+	MaxClientQueue int
+}
+
+// LoadedRoomStats returns the stats of the loaded rooms, the busiest first
+func LoadedRoomStats() []RoomStats {
+	stats := make([]RoomStats, 0, roomCache.Len())
+	roomCache.Range(func(id string, r *Room) bool {
+		s := RoomStats{
+			RoomID:   id,
+			Channels: r.channles.Len(),
+		}
+		if h := r.hub; h != nil {
+			s.Clients = h.ClientNum()
+			s.BroadcastQueue = h.QueueLen()
+			s.MaxClientQueue = h.MaxClientQueueLen()
+		}
+		stats = append(stats, s)
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Clients != stats[j].Clients {
+			return stats[i].Clients > stats[j].Clients
+		}
+		return stats[i].RoomID < stats[j].RoomID
+	})
+	return stats
+}
@@ -0,0 +1,98 @@
+package op
+
+import (
+	"errors"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/proxy"
+	pb "github.com/synctv-org/synctv/proto"
+	"github.com/zijiren233/gencontainer/rwmap"
+)
+
+// a user can send directBurst direct messages at once, then one every directInterval
+const (
+	directBurst    = 10
+	directInterval = time.Second
+)
+
+var (
+	ErrMessageSelf        = errors.New("can't message yourself")
+	ErrNoSharedRoom       = errors.New("you can only message members of your rooms")
+	ErrTooManyMessages    = errors.New("too many messages")
+	ErrEmptyDirectMessage = errors.New("empty message")
+)
+
+var directLimiters rwmap.RWMap[uint, *proxy.Limiter]
+
+// SendDirectMessage saves a message from u to the recipient and delivers it to
+// the rooms the recipient is connected to. Users can message the members of
+// the rooms they are in, admins can message anyone.
+func (u *User) SendDirectMessage(recipient *User, content string) (*model.DirectMessage, error) {
+	if recipient.ID == u.ID {
+		return nil, ErrMessageSelf
+	}
+	if content == "" {
+		return nil, ErrEmptyDirectMessage
+	}
+	if !u.IsAdmin() {
+		ok, err := db.ShareRoom(u.ID, recipient.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrNoSharedRoom
+		}
+	}
+	l, _ := directLimiters.LoadOrStore(u.ID, proxy.NewBurstLimiter(directBurst, directInterval))
+	if !l.Allow() {
+		return nil, ErrTooManyMessages
+	}
+	msg := &model.DirectMessage{
+		SenderID:    u.ID,
+		RecipientID: recipient.ID,
+		Content:     content,
+	}
+	if err := db.CreateDirectMessage(msg); err != nil {
+		return nil, err
+	}
+	sendToUser(recipient.ID, &ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type:      pb.ElementMessageType_DIRECT_MESSAGE,
+			Sender:    u.Username,
+			Message:   content,
+			MessageId: uint64(msg.ID),
+			Time:      msg.CreatedAt.UnixMilli(),
+		},
+	})
+	return msg, nil
+}
+
+// sendToUser sends msg to the clients of the user in every loaded room
+func sendToUser(userID uint, msg Message) {
+	roomCache.Range(func(_ string, r *Room) bool {
+		if r.hub == nil {
+			return true
+		}
+		if c, ok := r.hub.clients.Load(userID); ok {
+			c.Send(msg)
+		}
+		return true
+	})
+}
+
+// DirectMessages returns the conversation of u and peer, see db.GetDirectMessages
+func (u *User) DirectMessages(peerID uint, before uint, limit int) ([]*model.DirectMessage, error) {
+	return db.GetDirectMessages(u.ID, peerID, before, limit)
+}
+
+// ReadDirectMessages marks the messages from peer read
+func (u *User) ReadDirectMessages(peerID uint) error {
+	return db.MarkDirectMessagesRead(u.ID, peerID)
+}
+
+// UnreadDirectMessages returns the number of unread messages by sender
+func (u *User) UnreadDirectMessages() (map[uint]int64, error) {
+	return db.GetUnreadDirectMessageCounts(u.ID)
+}
@@ -0,0 +1,157 @@
+package op
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/email"
+	"github.com/synctv-org/synctv/internal/proxy"
+	"github.com/zijiren233/gencontainer/rwmap"
+)
+
+var (
+	ErrEmailRequired     = errors.New("email is required")
+	ErrNoEmail           = errors.New("user has no email")
+	ErrEmailVerified     = errors.New("email is already verified")
+	ErrEmailNotVerified  = errors.New("email is not verified")
+	ErrInvalidEmailToken = email.ErrInvalidToken
+	ErrTooManyEmails     = errors.New("too many emails to this address, try again later")
+)
+
+const (
+	emailBurst    = 3
+	emailInterval = 10 * time.Minute
+)
+
+// emailLimiters limit the verify and reset emails to each address, so the
+// endpoints can't be used to flood an inbox
+var emailLimiters rwmap.RWMap[string, *proxy.Limiter]
+
+func allowEmail(addr string) bool {
+	l, _ := emailLimiters.LoadOrStore(strings.ToLower(addr), proxy.NewBurstLimiter(emailBurst, emailInterval))
+	return l.Allow()
+}
+
+// emailTokenKey signs the tokens of email links, it is derived from the jwt
+// secret but differs from it so email tokens never pass as login tokens
+func emailTokenKey() []byte {
+	h := sha256.Sum256([]byte(conf.Conf().Jwt.Secret + "\x00email-token"))
+	return h[:]
+}
+
+// passwordFingerprint changes whenever the password does, so a reset token works once
+func passwordFingerprint(hashedPassword []byte) string {
+	h := sha256.Sum256(hashedPassword)
+	return hex.EncodeToString(h[:8])
+}
+
+func emailLink(path, token string) string {
+	return strings.TrimRight(conf.Conf().Email.BaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+type emailData struct {
+	Username string
+	Link     string
+	Expire   string
+}
+
+func sendEmailToken(to, username, template, path string, purpose email.Purpose, userID uint, fingerprint string) error {
+	if !email.Enabled() {
+		return email.ErrDisabled
+	}
+	ttl, err := time.ParseDuration(conf.Conf().Email.TokenExpire)
+	if err != nil {
+		return err
+	}
+	if !allowEmail(to) {
+		return ErrTooManyEmails
+	}
+	token, err := email.NewToken(emailTokenKey(), purpose, userID, fingerprint, ttl)
+	if err != nil {
+		return err
+	}
+	return email.Send(to, template, &emailData{
+		Username: username,
+		Link:     emailLink(path, token),
+		Expire:   ttl.String(),
+	})
+}
+
+// SendVerifyEmail queues an email with a link that verifies the email of the user
+func (u *User) SendVerifyEmail() error {
+	if u.Email == nil {
+		return ErrNoEmail
+	}
+	if u.EmailVerified {
+		return ErrEmailVerified
+	}
+	return sendEmailToken(*u.Email, u.Username, email.TemplateVerify, "/web/user/verify", email.PurposeVerify, u.ID, *u.Email)
+}
+
+// VerifyEmail marks the email of the token verified, the token is bound to
+// the email so it is void once the user changes it
+func VerifyEmail(token string) error {
+	userID, addr, err := email.ParseToken(emailTokenKey(), email.PurposeVerify, token)
+	if err != nil {
+		return err
+	}
+	if err := db.SetUserEmailVerified(userID, addr); err != nil {
+		return ErrInvalidEmailToken
+	}
+	removeUserCache(userID)
+	return nil
+}
+
+// RequestPasswordReset queues a reset link to the user with the email. It
+// does nothing when no user has the email, callers answer the same either way
+// so the endpoint does not tell which emails are registered.
+func RequestPasswordReset(addr string) error {
+	if !email.Enabled() {
+		return email.ErrDisabled
+	}
+	u, err := db.GetUserByEmail(addr)
+	if err != nil {
+		return nil
+	}
+	return sendEmailToken(*u.Email, u.Username, email.TemplateReset, "/web/user/reset", email.PurposeReset, u.ID, passwordFingerprint(u.HashedPassword))
+}
+
+// ResetPassword sets the password of the user of a reset token. Opening the
+// link proves the user owns the email, so it is marked verified too. The
+// tokens and sessions of the user are revoked like on a logout everywhere,
+// whoever knew the old password is logged out.
+func ResetPassword(token, password string) error {
+	userID, fingerprint, err := email.ParseToken(emailTokenKey(), email.PurposeReset, token)
+	if err != nil {
+		return err
+	}
+	u, err := db.GetUserByID(userID)
+	if err != nil {
+		return ErrInvalidEmailToken
+	}
+	if subtle.ConstantTimeCompare([]byte(passwordFingerprint(u.HashedPassword)), []byte(fingerprint)) != 1 {
+		return ErrInvalidEmailToken
+	}
+	if err := db.SetUserPassword(userID, password); err != nil {
+		return err
+	}
+	if u.Email != nil && !u.EmailVerified {
+		if err := db.SetUserEmailVerified(userID, *u.Email); err != nil {
+			return err
+		}
+	}
+	if err := db.RevokeUserTokens(userID); err != nil {
+		return err
+	}
+	userCache.Remove(userID)
+	disconnectUser(userID)
+	publishInvalidation(&BrokerInvalidation{Cache: invalidUser, UserID: userID, Disconnect: true})
+	return nil
+}
@@ -0,0 +1,88 @@
+package op
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/requestid"
+)
+
+const (
+	// eventQueueSize is how many events wait for the writer, more are dropped
+	eventQueueSize = 1024
+	// eventBatchSize is the most events written in one insert
+	eventBatchSize = 100
+)
+
+var eventQueue chan *model.RoomEvent
+
+// StartEventWriter starts writing the recorded events in the background, in
+// batches, so recording never waits for the database. Until it is started
+// the events are written when they are recorded. The queued events are
+// written when ctx is done.
+func StartEventWriter(ctx context.Context) {
+	eventQueue = make(chan *model.RoomEvent, eventQueueSize)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				for len(eventQueue) != 0 {
+					writeEvents(<-eventQueue)
+				}
+				return
+			case e := <-eventQueue:
+				writeEvents(e)
+			}
+		}
+	}()
+}
+
+// writeEvents writes first and the events queued after it
+func writeEvents(first *model.RoomEvent) {
+	batch := []*model.RoomEvent{first}
+fill:
+	for len(batch) < eventBatchSize {
+		select {
+		case e := <-eventQueue:
+			batch = append(batch, e)
+		default:
+			break fill
+		}
+	}
+	if err := db.CreateRoomEvents(batch); err != nil {
+		log.Errorf("record %d room events failed: %s", len(batch), err.Error())
+	}
+}
+
+// RecordEvent adds an entry to the activity feed of the room,
+// a failure is only logged so it never fails the recorded action
+func (r *Room) RecordEvent(ctx context.Context, userID uint, typ model.RoomEventType, detail string) {
+	e := &model.RoomEvent{
+		RoomID: r.ID,
+		UserID: userID,
+		Type:   typ,
+		Detail: detail,
+	}
+	if eventQueue == nil {
+		if err := db.CreateRoomEvent(ctx, e); err != nil {
+			requestid.Log(ctx).Errorf("record room %s event %s failed: %s", r.ID, typ, err.Error())
+		}
+		return
+	}
+	select {
+	case eventQueue <- e:
+	default:
+		requestid.Log(ctx).Warnf("event queue full, skip room %s event %s", r.ID, typ)
+	}
+}
+
+func (r *Room) Events(offset, limit int) ([]*model.RoomEvent, int64, error) {
+	return db.GetRoomEvents(r.ID, offset, limit)
+}
+
+// PermissionAudits returns the permission changes of the room, newest first
+func (r *Room) PermissionAudits(offset, limit int) ([]*model.PermissionAudit, int64, error) {
+	return db.GetPermissionAudits(r.ID, offset, limit)
+}
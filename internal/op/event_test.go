@@ -0,0 +1,38 @@
+package op_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestRoomEvents(t *testing.T) {
+	creator := newTestUser(t, "events-creator")
+	room := newTestRoom(t, creator, "events-room")
+	other := newTestRoom(t, creator, "events-other")
+
+	room.RecordEvent(context.Background(), creator.ID, model.RoomEventUserJoined, "")
+	room.RecordEvent(context.Background(), creator.ID, model.RoomEventPlaylistChanged, "add movie a")
+	room.RecordEvent(context.Background(), creator.ID, model.RoomEventPlaybackSeeked, "seek to 1.00")
+	other.RecordEvent(context.Background(), creator.ID, model.RoomEventUserJoined, "")
+
+	events, total, err := room.Events(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 {
+		t.Fatalf("total = %d, want 3", total)
+	}
+	if len(events) != 2 || events[0].Type != model.RoomEventPlaybackSeeked || events[1].Type != model.RoomEventPlaylistChanged {
+		t.Fatalf("events not newest first: %+v", events)
+	}
+
+	events, _, err = room.Events(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != model.RoomEventUserJoined {
+		t.Fatalf("second page = %+v, want the join event", events)
+	}
+}
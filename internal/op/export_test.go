@@ -0,0 +1,6 @@
+package op
+
+// ResetShutdown undoes NotifyRestart for the tests that run after
+func ResetShutdown() {
+	shuttingDown.Store(false)
+}
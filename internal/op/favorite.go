@@ -0,0 +1,23 @@
+package op
+
+import (
+	"errors"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func (u *User) AddFavoriteRoom(roomID string) error {
+	if !HasRoom(roomID) {
+		return errors.New("room not found")
+	}
+	return db.AddFavoriteRoom(u.ID, roomID)
+}
+
+func (u *User) RemoveFavoriteRoom(roomID string) error {
+	return db.RemoveFavoriteRoom(u.ID, roomID)
+}
+
+func (u *User) FavoriteRooms(conf ...db.GetRoomsConfig) ([]*model.Room, error) {
+	return db.GetFavoriteRooms(u.ID, conf...)
+}
@@ -0,0 +1,186 @@
+package op
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+var (
+	ErrChatFiltered = errors.New("message blocked by the chat filter")
+	ErrChatDisabled = errors.New("chat is disabled")
+)
+
+// ChatContext is the sender of a chat message passed to the chat filter rules
+type ChatContext struct {
+	Room   *Room
+	UserID uint
+	// Repeats is how many times in a row the user sent the message before
+	Repeats int
+}
+
+// ChatFilterRule is a rule of a chat filter
+type ChatFilterRule interface {
+	// Match returns the message with the matches masked and whether anything matched,
+	// rules that can't mask a match return the message unchanged
+	Match(c *ChatContext, message string) (string, bool)
+}
+
+// WordRule matches blocked words case insensitively
+type WordRule struct {
+	re *regexp.Regexp
+}
+
+func NewWordRule(words []string) *WordRule {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	return &WordRule{re: regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))}
+}
+
+func (w *WordRule) Match(_ *ChatContext, message string) (string, bool) {
+	matched := false
+	message = w.re.ReplaceAllStringFunc(message, func(s string) string {
+		matched = true
+		return strings.Repeat("*", utf8.RuneCountInString(s))
+	})
+	return message, matched
+}
+
+var linkRe = regexp.MustCompile(`(?i)(?:\b[a-z][a-z0-9+.-]*://|\bwww\.)\S+`)
+
+// LinkRule matches urls and www. addresses
+type LinkRule struct{}
+
+func (LinkRule) Match(_ *ChatContext, message string) (string, bool) {
+	matched := false
+	message = linkRe.ReplaceAllStringFunc(message, func(string) string {
+		matched = true
+		return "[link]"
+	})
+	return message, matched
+}
+
+// RepeatRule matches a message sent more than Limit times in a row
+type RepeatRule struct {
+	Limit int
+}
+
+func (r RepeatRule) Match(c *ChatContext, message string) (string, bool) {
+	return message, c.Repeats >= r.Limit
+}
+
+// ChatFilter runs chat messages through its rules in order
+type ChatFilter struct {
+	Rules   []ChatFilterRule
+	Action  model.ChatFilterAction
+	MuteFor time.Duration
+}
+
+// NewChatFilter returns the filter of the setting, nil if it has no rules
+func NewChatFilter(setting model.ChatFilter) *ChatFilter {
+	f := &ChatFilter{
+		Action:  setting.Action,
+		MuteFor: time.Duration(setting.MuteSeconds) * time.Second,
+	}
+	if f.Action == "" {
+		f.Action = model.ChatFilterDrop
+	}
+	if w := NewWordRule(setting.BlockedWords); w != nil {
+		f.Rules = append(f.Rules, w)
+	}
+	if setting.BlockLinks {
+		f.Rules = append(f.Rules, LinkRule{})
+	}
+	if setting.RepeatLimit > 0 {
+		f.Rules = append(f.Rules, RepeatRule{Limit: int(setting.RepeatLimit)})
+	}
+	if len(f.Rules) == 0 {
+		return nil
+	}
+	return f
+}
+
+// Apply returns the message to send or ErrChatFiltered if it is dropped
+func (f *ChatFilter) Apply(c *ChatContext, message string) (string, error) {
+	if f == nil {
+		return message, nil
+	}
+	for _, rule := range f.Rules {
+		masked, matched := rule.Match(c, message)
+		if !matched {
+			continue
+		}
+		switch f.Action {
+		case model.ChatFilterReplace:
+			if masked != message {
+				message = masked
+				continue
+			}
+		case model.ChatFilterMute:
+			// the creator can't be muted, the message is still dropped
+			_ = c.Room.Mute(c.UserID, f.MuteFor)
+		}
+		return "", ErrChatFiltered
+	}
+	return message, nil
+}
+
+var instanceChatFilter atomic.Pointer[ChatFilter]
+
+// SetChatFilter sets the filter applied to the chat of every room before the filter of the room
+func SetChatFilter(f *ChatFilter) {
+	instanceChatFilter.Store(f)
+}
+
+type repeatedChat struct {
+	message string
+	n       int
+}
+
+// countRepeat returns how many times in a row the user sent the message before
+func (r *Room) countRepeat(userID uint, message string) int {
+	message = strings.ToLower(strings.TrimSpace(message))
+	n := 0
+	if last, ok := r.repeats.Load(userID); ok && last.message == message {
+		n = last.n
+	}
+	r.repeats.Store(userID, repeatedChat{message: message, n: n + 1})
+	return n
+}
+
+// FilterChat runs a chat message of the user through the instance wide chat filter and
+// the one of the room, it returns the message to send or ErrChatFiltered
+func (r *Room) FilterChat(userID uint, message string) (string, error) {
+	c := &ChatContext{
+		Room:    r,
+		UserID:  userID,
+		Repeats: r.countRepeat(userID, message),
+	}
+	message, err := instanceChatFilter.Load().Apply(c, message)
+	if err != nil {
+		return "", err
+	}
+	f := r.chatFilter.Load()
+	if f == nil {
+		f = &roomChatFilter{filter: NewChatFilter(r.Settings().ChatFilter)}
+		r.chatFilter.Store(f)
+	}
+	return f.filter.Apply(c, message)
+}
+
+// roomChatFilter caches the filter of the room setting, a nil filter has no rules
+type roomChatFilter struct {
+	filter *ChatFilter
+}
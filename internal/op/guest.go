@@ -0,0 +1,61 @@
+package op
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/settings"
+	"gorm.io/gorm"
+)
+
+var ErrGuestNotAllowed = errors.New("room does not allow guests")
+
+// guestIDBase is far above the ids of stored users, guest ids count down from it
+const guestIDBase uint = math.MaxUint32
+
+func NewGuestID() uint {
+	return guestIDBase - uint(rand.Int31n(1<<30))
+}
+
+// NewGuest returns a view only user that is never stored
+func NewGuest(id uint, username string) *User {
+	return &User{
+		User: model.User{
+			Model:    gorm.Model{ID: id},
+			Username: username,
+			Role:     model.RoleUser,
+		},
+		guest: true,
+	}
+}
+
+// disconnectGuests closes the connections of the guests in every room
+func disconnectGuests() {
+	roomCache.Range(func(_ string, r *Room) bool {
+		if r.hub == nil {
+			return true
+		}
+		r.hub.clients.Range(func(_ uint, c *Client) bool {
+			if c.u.IsGuest() {
+				c.Close()
+			}
+			return true
+		})
+		return true
+	})
+}
+
+func (u *User) IsGuest() bool {
+	return u.guest
+}
+
+// CheckGuest returns ErrGuestNotAllowed unless the room lets guests watch,
+// a whitelist only room never does, nor any room while guests are disabled
+func (r *Room) CheckGuest() error {
+	if s := r.Settings(); !s.AllowGuest || s.WhitelistOnly || settings.DisableGuest.Get() {
+		return ErrGuestNotAllowed
+	}
+	return nil
+}
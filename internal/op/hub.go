@@ -1,6 +1,7 @@
 package op
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -15,7 +16,7 @@ import (
 )
 
 type Hub struct {
-	id        uint
+	id        string
 	clients   rwmap.RWMap[uint, *Client]
 	broadcast chan *broadcastMessage
 	exit      chan struct{}
@@ -23,8 +24,16 @@ type Hub struct {
 	wg        sync.WaitGroup
 
 	once utils.Once
+	// cluster shares the broadcasts with the other instances, nil when alone
+	cluster *cluster
+	// people is the last number of users of the room on every instance
+	people atomic.Int64
+	// reg serializes the registrations, see RegClient
+	reg sync.Mutex
 }
 
+const pingInterval = 5 * time.Second
+
 type broadcastMessage struct {
 	data       Message
 	sender     string
@@ -52,7 +61,7 @@ func WithIgnoreId(id ...string) BroadcastConf {
 	}
 }
 
-func newHub(id uint) *Hub {
+func newHub(id string) *Hub {
 	return &Hub{
 		id:        id,
 		broadcast: make(chan *broadcastMessage, 128),
@@ -83,51 +92,83 @@ func (h *Hub) serve() error {
 					return true
 				}
 				if err := cli.Send(message.data); err != nil {
-					log.Debugf("hub: %d, write to client err: %s\nmessage: %+v", h.id, err, message)
+					log.Debugf("hub: %s, write to client err: %s\nmessage: %+v", h.id, err, message)
 					cli.Close()
 				}
 				return true
 			})
 		case <-h.exit:
-			log.Debugf("hub: %d, closed", h.id)
+			log.Debugf("hub: %s, closed", h.id)
 			return nil
 		}
 	}
 }
 
 func (h *Hub) ping() {
-	ticker := time.NewTicker(time.Second * 5)
+	ticker := time.NewTicker(pingInterval)
 	defer ticker.Stop()
 	var pre int64 = 0
 	for {
 		select {
 		case <-ticker.C:
-			current := h.ClientNum()
+			current := h.countPeople()
 			if current != pre {
-				if err := h.Broadcast(&ElementMessage{
+				if err := h.broadcastLocal(&broadcastMessage{data: &ElementMessage{
 					ElementMessage: &pb.ElementMessage{
 						Type:      pb.ElementMessageType_CHANGE_PEOPLE,
 						PeopleNum: current,
 					},
-				}); err != nil {
+				}}); err != nil {
 					continue
 				}
 				pre = current
 			} else {
-				if err := h.Broadcast(&PingMessage{}); err != nil {
+				if err := h.broadcastLocal(&broadcastMessage{data: &PingMessage{}}); err != nil {
 					continue
 				}
 			}
+			h.broadcastLocal(&broadcastMessage{data: &ElementMessage{
+				ElementMessage: &pb.ElementMessage{
+					Type: pb.ElementMessageType_PING,
+					Time: time.Now().UnixMilli(),
+				},
+			}})
 		case <-h.exit:
 			return
 		}
 	}
 }
 
+// countPeople records the clients of the hub with the cluster and returns
+// the users of the room on every instance, only the local ones when alone
+func (h *Hub) countPeople() int64 {
+	if h.cluster == nil {
+		return h.ClientNum()
+	}
+	n, err := h.cluster.presence(h.id, h.ClientIDs())
+	if err != nil {
+		log.Errorf("hub: %s, count people failed: %s", h.id, err.Error())
+		return h.ClientNum()
+	}
+	h.people.Store(n)
+	return n
+}
+
+// PeopleNum is the number of users of the room on every instance as of the
+// last ping, ClientNum when the instance is alone
+func (h *Hub) PeopleNum() int64 {
+	if h.cluster != nil {
+		if n := h.people.Load(); n > 0 {
+			return n
+		}
+	}
+	return h.ClientNum()
+}
+
 func (h *Hub) devMessage(msg Message) {
 	switch msg.MessageType() {
 	case websocket.TextMessage:
-		log.Debugf("hub: %d, broadcast:\nmessage: %+v", h.id, msg.String())
+		log.Debugf("hub: %s, broadcast:\nmessage: %+v", h.id, msg.String())
 	}
 }
 
@@ -149,8 +190,16 @@ func (h *Hub) Close() error {
 		client.Close()
 		return true
 	})
+	// the broadcast channel stays open, serve could take a nil message
+	// from it before it sees exit
 	h.wg.Wait()
-	close(h.broadcast)
+	if h.cluster != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+		defer cancel()
+		if err := h.cluster.SetPresence(ctx, h.id, h.cluster.instance, nil, presenceTTL); err != nil {
+			log.Errorf("hub: %s, clear presence failed: %s", h.id, err.Error())
+		}
+	}
 	return nil
 }
 
@@ -165,6 +214,26 @@ func (h *Hub) Broadcast(data Message, conf ...BroadcastConf) error {
 	for _, c := range conf {
 		c(msg)
 	}
+	if err := h.send(msg); err != nil {
+		return err
+	}
+	if h.cluster != nil {
+		h.cluster.publishBroadcast(h.id, msg)
+	}
+	return nil
+}
+
+// broadcastLocal sends the message to the clients of this instance only
+func (h *Hub) broadcastLocal(msg *broadcastMessage) error {
+	h.wg.Add(1)
+	defer h.wg.Done()
+	if h.Closed() {
+		return ErrAlreadyClosed
+	}
+	return h.send(msg)
+}
+
+func (h *Hub) send(msg *broadcastMessage) error {
 	select {
 	case h.broadcast <- msg:
 		return nil
@@ -173,7 +242,29 @@ func (h *Hub) Broadcast(data Message, conf ...BroadcastConf) error {
 	}
 }
 
-func (h *Hub) RegClient(cli *Client) (*Client, error) {
+func (h *Hub) ClientIDs() []uint {
+	ids := make([]uint, 0, h.clients.Len())
+	h.clients.Range(func(id uint, _ *Client) bool {
+		ids = append(ids, id)
+		return true
+	})
+	return ids
+}
+
+// ClientNames returns the usernames of the connected clients
+func (h *Hub) ClientNames() []string {
+	names := make([]string, 0, h.clients.Len())
+	h.clients.Range(func(_ uint, c *Client) bool {
+		names = append(names, c.u.Username)
+		return true
+	})
+	return names
+}
+
+// RegClient registers cli if admit returns nil. admit runs under the
+// registration lock, so no other client registers between the check and
+// the registration.
+func (h *Hub) RegClient(cli *Client, admit func() error) (*Client, error) {
 	if h.Closed() {
 		return nil, ErrAlreadyClosed
 	}
@@ -181,6 +272,13 @@ func (h *Hub) RegClient(cli *Client) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	h.reg.Lock()
+	defer h.reg.Unlock()
+	if admit != nil {
+		if err := admit(); err != nil {
+			return nil, err
+		}
+	}
 	c, loaded := h.clients.LoadOrStore(cli.u.ID, cli)
 	if loaded {
 		return nil, errors.New("client already registered")
@@ -205,3 +303,21 @@ func (h *Hub) UnRegClient(user *User) error {
 func (h *Hub) ClientNum() int64 {
 	return h.clients.Len()
 }
+
+// QueueLen is the number of broadcasts waiting to be sent to the clients
+func (h *Hub) QueueLen() int {
+	return len(h.broadcast)
+}
+
+// MaxClientQueueLen is the longest send queue of the clients, a full one
+// means a client does not read its messages
+func (h *Hub) MaxClientQueueLen() int {
+	var n int
+	h.clients.Range(func(_ uint, c *Client) bool {
+		if l := c.QueueLen(); l > n {
+			n = l
+		}
+		return true
+	})
+	return n
+}
@@ -0,0 +1,111 @@
+package op
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/settings"
+)
+
+// The caches named by a BrokerInvalidation
+const (
+	invalidUser     = "user"
+	invalidRelation = "relation"
+	invalidMovies   = "movies"
+	invalidRoom     = "room"
+	invalidToken    = "token"
+	invalidSettings = "settings"
+)
+
+// BrokerInvalidation names the cached entries an instance changed, the
+// other instances drop them and load them again from the database
+type BrokerInvalidation struct {
+	Cache string `json:"cache"`
+	// RoomID and UserID select the relations, an empty one matches any
+	RoomID string `json:"roomId,omitempty"`
+	UserID uint   `json:"userId,omitempty"`
+	// Disconnect closes the clients of the user, who was banned or logged out
+	Disconnect bool `json:"disconnect,omitempty"`
+	// Token is a revoked token id and Expires when it expires in unix milli
+	Token   string `json:"token,omitempty"`
+	Expires int64  `json:"expires,omitempty"`
+}
+
+// publishInvalidation tells the other instances, if any, to drop the entries
+func publishInvalidation(inv *BrokerInvalidation) {
+	if c := clusterBroker.Load(); c != nil {
+		c.publish("", &BrokerEvent{Kind: BrokerInvalidate, Invalidate: inv})
+	}
+}
+
+// userChanged drops the user from the caches of the other instances,
+// callers update or drop their own copy
+func userChanged(userID uint) {
+	publishInvalidation(&BrokerInvalidation{Cache: invalidUser, UserID: userID})
+}
+
+// removeUserCache drops the user from the cache of every instance
+func removeUserCache(userID uint) {
+	userCache.Remove(userID)
+	userChanged(userID)
+}
+
+// moviesChanged drops the playlist of the room from the caches of the
+// other instances
+func moviesChanged(roomID string) {
+	publishInvalidation(&BrokerInvalidation{Cache: invalidMovies, RoomID: roomID})
+}
+
+// roomChanged makes the other instances reload the settings, password and
+// tags of the room, or unload it when it was deleted
+func roomChanged(roomID string) {
+	publishInvalidation(&BrokerInvalidation{Cache: invalidRoom, RoomID: roomID})
+}
+
+func invalidate(inv *BrokerInvalidation) {
+	switch inv.Cache {
+	case invalidUser:
+		userCache.Remove(inv.UserID)
+		if inv.Disconnect {
+			disconnectUser(inv.UserID)
+		}
+	case invalidRelation:
+		dropRelationsCache(inv.RoomID, inv.UserID)
+	case invalidMovies:
+		movieCache.Remove(inv.RoomID)
+	case invalidRoom:
+		reloadRoom(inv.RoomID)
+	case invalidToken:
+		revokedTokens.Store(inv.Token, time.UnixMilli(inv.Expires))
+	case invalidSettings:
+		if err := settings.Init(); err != nil {
+			log.Errorf("broker: reload settings failed: %s", err.Error())
+		}
+	}
+}
+
+// reloadRoom takes the changes another instance made to a loaded room
+func reloadRoom(roomID string) {
+	r, ok := roomCache.Load(roomID)
+	if !ok {
+		return
+	}
+	m, err := db.GetRoomByID(roomID)
+	if err != nil {
+		if exists, err := db.HasRoom(roomID); err == nil && !exists {
+			if roomCache.CompareAndDelete(roomID, r) {
+				r.close()
+			}
+			movieCache.Remove(roomID)
+			dropRelationsCache(roomID, 0)
+			return
+		}
+		log.Errorf("broker: reload room %s failed: %s", roomID, err.Error())
+		return
+	}
+	r.setHashedPassword(m.HashedPassword)
+	r.setSetting(m.Setting)
+	r.Tags = m.Tags
+	r.CreatorID = m.CreatorID
+}
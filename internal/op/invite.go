@@ -0,0 +1,67 @@
+package op
+
+import (
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+// CreateInvite creates an invite to the room. The granted permissions can not
+// exceed the permissions of the user creating it.
+func (u *User) CreateInvite(room *Room, permissions model.Permission, expire time.Duration, maxUses uint) (*model.RoomInvite, error) {
+	if !u.HasPermission(room, model.CanInviteUser) {
+		return nil, ErrNoPermission
+	}
+	if permissions != 0 && !u.HasPermission(room, permissions) {
+		return nil, ErrGrantPermission
+	}
+	invite := &model.RoomInvite{
+		RoomID:      room.ID,
+		CreatorID:   u.ID,
+		Permissions: permissions,
+		ExpiresAt:   time.Now().Add(expire),
+		MaxUses:     maxUses,
+	}
+	return invite, db.CreateRoomInvite(invite)
+}
+
+// DeleteInvite revokes the invite id of the room. Users other than its
+// creator need CanInviteUser and every permission the invite grants.
+func (u *User) DeleteInvite(room *Room, id uint) error {
+	invite, err := db.GetRoomInvite(id)
+	if err != nil {
+		return err
+	}
+	if invite.RoomID != room.ID {
+		return db.ErrInviteNotFound
+	}
+	if invite.CreatorID != u.ID && !u.HasPermission(room, model.CanInviteUser|invite.Permissions) {
+		return ErrNoPermission
+	}
+	return db.DeleteRoomInvite(room.ID, id)
+}
+
+// JoinWithInvite uses the invite and adds the user to the room with the invite's permissions
+func (u *User) JoinWithInvite(inviteID uint) (*Room, error) {
+	invite, err := db.GetRoomInvite(inviteID)
+	if err != nil {
+		return nil, err
+	}
+	room, err := GetRoomByID(invite.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.UseRoomInvite(invite.ID); err != nil {
+		return nil, err
+	}
+	if err := room.AddMember(u.ID); err != nil {
+		return nil, err
+	}
+	if invite.Permissions != 0 {
+		if err := room.ChangeUserPermission(invite.CreatorID, u.ID, "", invite.Permissions, 0); err != nil {
+			return nil, err
+		}
+	}
+	return room, nil
+}
@@ -0,0 +1,121 @@
+package op_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+)
+
+func TestInvite(t *testing.T) {
+	creator := newTestUser(t, "invite-creator")
+	room := newTestRoom(t, creator, "invite-room")
+
+	invite, err := creator.CreateInvite(room, model.CanRenameRoom, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guest := newTestUser(t, "invite-guest")
+	r, err := guest.JoinWithInvite(invite.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != room.ID {
+		t.Fatalf("joined room %s, want %s", r.ID, room.ID)
+	}
+	if !guest.HasPermission(room, model.CanRenameRoom) {
+		t.Fatal("invite should grant its permissions")
+	}
+	if guest.HasPermission(room, model.CanInviteUser) {
+		t.Fatal("invite should not grant other permissions")
+	}
+	audits, _, err := room.PermissionAudits(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audits) != 1 || audits[0].ActorID != creator.ID || audits[0].TargetID != guest.ID ||
+		audits[0].After&model.CanRenameRoom == 0 {
+		t.Fatalf("invite join audits = %+v", audits)
+	}
+
+	if err := creator.SetDefaultPermissions(room, model.CanCreateMovie); err != nil {
+		t.Fatal(err)
+	}
+	audits, _, err = room.PermissionAudits(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audits) != 1 || audits[0].TargetID != 0 || audits[0].After != model.CanCreateMovie {
+		t.Fatalf("default permissions audits = %+v", audits)
+	}
+
+	if _, err := newTestUser(t, "invite-late").JoinWithInvite(invite.ID); err == nil {
+		t.Fatal("used up invite should be rejected")
+	}
+
+	if _, err := guest.CreateInvite(room, 0, time.Hour, 0); err == nil {
+		t.Fatal("user without CanInviteUser should not create invites")
+	}
+	if err := room.AddUserPermission(guest.ID, model.CanInviteUser); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := guest.CreateInvite(room, model.CanDeleteRoom, time.Hour, 0); err == nil {
+		t.Fatal("invite should not grant permissions its creator lacks")
+	}
+
+	expired, err := creator.CreateInvite(room, 0, -time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestUser(t, "invite-expired").JoinWithInvite(expired.ID); err == nil {
+		t.Fatal("expired invite should be rejected")
+	}
+}
+
+func TestDeleteInvite(t *testing.T) {
+	creator := newTestUser(t, "revoke-creator")
+	member := newTestUser(t, "revoke-member")
+	room := newTestRoom(t, creator, "revoke-room")
+	other := newTestRoom(t, creator, "revoke-other")
+	if err := room.AddMember(member.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	invite, err := creator.CreateInvite(room, model.CanRenameRoom, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := member.DeleteInvite(room, invite.ID); !errors.Is(err, op.ErrNoPermission) {
+		t.Fatalf("revoke without CanInviteUser = %v, want %v", err, op.ErrNoPermission)
+	}
+	if err := room.AddUserPermission(member.ID, model.CanInviteUser); err != nil {
+		t.Fatal(err)
+	}
+	if err := member.DeleteInvite(room, invite.ID); !errors.Is(err, op.ErrNoPermission) {
+		t.Fatalf("revoke an invite granting more than the member has = %v, want %v", err, op.ErrNoPermission)
+	}
+	if err := creator.DeleteInvite(other, invite.ID); !errors.Is(err, db.ErrInviteNotFound) {
+		t.Fatalf("revoke through another room = %v, want %v", err, db.ErrInviteNotFound)
+	}
+	if err := creator.DeleteInvite(room, invite.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestUser(t, "revoke-late").JoinWithInvite(invite.ID); !errors.Is(err, db.ErrInviteNotFound) {
+		t.Fatalf("join with a revoked invite = %v, want %v", err, db.ErrInviteNotFound)
+	}
+
+	own, err := member.CreateInvite(room, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := member.DeleteInvite(room, own.ID); err != nil {
+		t.Fatalf("revoke an own invite: %v", err)
+	}
+	if err := member.DeleteInvite(room, own.ID); !errors.Is(err, db.ErrInviteNotFound) {
+		t.Fatalf("revoke twice = %v, want %v", err, db.ErrInviteNotFound)
+	}
+}
@@ -0,0 +1,162 @@
+package op
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+)
+
+// StartRoomStateSaver saves the changed playback states every interval
+func StartRoomStateSaver(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if n := SaveRoomStates(); n > 0 {
+					log.Debugf("saved %d room states", n)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// StartRoomJanitor checks rooms every minute, hibernating rooms idle for
+// hibernateAfter, deleting rooms inactive for ttl and purging rooms soft
+// deleted for retention. Zero disables each of them.
+func StartRoomJanitor(ctx context.Context, hibernateAfter, ttl, retention time.Duration) {
+	if hibernateAfter <= 0 && ttl <= 0 && retention <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(time.Minute)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if ttl > 0 {
+					n, err := DeleteInactiveRooms(ttl)
+					if err != nil {
+						log.Errorf("delete inactive rooms failed: %s", err.Error())
+					} else if n > 0 {
+						log.Infof("deleted %d inactive rooms", n)
+					}
+				}
+				if retention > 0 {
+					n, keys, err := db.PurgeDeletedRooms(time.Now().Add(-retention))
+					if err != nil {
+						log.Errorf("purge deleted rooms failed: %s", err.Error())
+					} else if n > 0 {
+						deleteSubtitleFiles(keys)
+						log.Infof("purged %d deleted rooms", n)
+					}
+				}
+				if hibernateAfter > 0 {
+					if n := HibernateIdleRooms(hibernateAfter); n > 0 {
+						log.Debugf("hibernated %d idle rooms", n)
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// StartChatJanitor deletes chat messages older than maxAge and those past the
+// newest maxMessages of each room every ten minutes. Zero disables each of them.
+func StartChatJanitor(ctx context.Context, maxAge time.Duration, maxMessages int) {
+	if maxAge <= 0 && maxMessages <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(10 * time.Minute)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				CleanChatMessages(maxAge, maxMessages)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// CleanChatMessages enforces the chat retention once, see StartChatJanitor
+func CleanChatMessages(maxAge time.Duration, maxMessages int) {
+	if maxAge > 0 {
+		n, err := db.DeleteChatMessagesBefore(time.Now().Add(-maxAge))
+		if err != nil {
+			log.Errorf("delete old chat messages failed: %s", err.Error())
+		} else if n > 0 {
+			log.Debugf("deleted %d old chat messages", n)
+		}
+	}
+	if maxMessages > 0 {
+		n, err := db.TrimChatMessages(maxMessages)
+		if err != nil {
+			log.Errorf("trim chat messages failed: %s", err.Error())
+		} else if n > 0 {
+			log.Debugf("trimmed %d chat messages", n)
+		}
+	}
+}
+
+// DeleteInactiveRooms deletes rooms without clients for at least ttl, except permanent rooms,
+// and returns the number of rooms deleted
+func DeleteInactiveRooms(ttl time.Duration) (int, error) {
+	ids, err := db.GetInactiveRoomIDs(time.Now().Add(-ttl))
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, id := range ids {
+		// the users may all be connected to another instance
+		if n, err := peopleNum(id); err != nil || n > 0 {
+			if err != nil {
+				log.Errorf("count people of inactive room %s failed: %s", id, err.Error())
+			}
+			continue
+		}
+		if err := DeleteRoomByID(id); err != nil {
+			log.Errorf("delete inactive room %s failed: %s", id, err.Error())
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+// StartUserJanitor purges the users whose deletion is due and the stale failed
+// logins every ten minutes
+func StartUserJanitor(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(10 * time.Minute)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				n, err := PurgeDueUsers()
+				if err != nil {
+					log.Errorf("purge deleted users failed: %s", err.Error())
+				} else if n > 0 {
+					log.Infof("purged %d deleted users", n)
+				}
+				if _, err := PurgeLoginAttempts(); err != nil {
+					log.Errorf("purge login attempts failed: %s", err.Error())
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,113 @@
+package op_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+)
+
+func TestDeleteInactiveRooms(t *testing.T) {
+	creator := newTestUser(t, "inactive-creator")
+	inactive := newTestRoom(t, creator, "inactive-room")
+	permanent := newTestRoom(t, creator, "inactive-permanent")
+	active := newTestRoom(t, creator, "inactive-active")
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, r := range []*op.Room{inactive, permanent, active} {
+		if err := db.DB().Model(&model.Room{}).Where("id = ?", r.ID).Updates(map[string]any{
+			"created_at":     old,
+			"last_active_at": old,
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.DB().Model(&model.Room{}).Where("id = ?", permanent.ID).Update("permanent", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetRoomLastActive(active.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	// rooms never marked active fall back to their last update
+	legacy := newTestRoom(t, creator, "inactive-legacy")
+	stale := newTestRoom(t, creator, "inactive-legacy-stale")
+	for r, updated := range map[*op.Room]time.Time{legacy: time.Now(), stale: old} {
+		if err := db.DB().Model(&model.Room{}).Where("id = ?", r.ID).UpdateColumns(map[string]any{
+			"created_at":     old,
+			"updated_at":     updated,
+			"last_active_at": time.Time{},
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := op.DeleteInactiveRooms(24 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if op.HasRoom(inactive.ID) {
+		t.Fatal("inactive room should be deleted")
+	}
+	if !op.HasRoom(permanent.ID) {
+		t.Fatal("permanent room should not be deleted")
+	}
+	if !op.HasRoom(active.ID) {
+		t.Fatal("recently active room should not be deleted")
+	}
+	if !op.HasRoom(legacy.ID) {
+		t.Fatal("room without last activity but recently updated should not be deleted")
+	}
+	if op.HasRoom(stale.ID) {
+		t.Fatal("room without last activity and not updated since should be deleted")
+	}
+}
+
+func TestChatHistory(t *testing.T) {
+	creator := newTestUser(t, "chat-creator")
+	room := newTestRoom(t, creator, "chat-room")
+	other := newTestRoom(t, creator, "chat-other")
+	for i := 0; i < 5; i++ {
+		room.RecordChat(creator, fmt.Sprintf("message %d", i))
+	}
+	other.RecordChat(creator, "other")
+
+	contents := func(ms []*model.ChatMessage) []string {
+		s := make([]string, len(ms))
+		for i, m := range ms {
+			s[i] = m.Content
+		}
+		return s
+	}
+	newest, err := room.ChatHistory(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(newest); len(got) != 2 || got[0] != "message 3" || got[1] != "message 4" {
+		t.Fatalf("newest messages = %v, want messages 3 and 4", got)
+	}
+	older, err := room.ChatHistory(newest[0].ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(older); len(got) != 3 || got[0] != "message 0" {
+		t.Fatalf("older messages = %v, want messages 0 to 2", got)
+	}
+
+	op.CleanChatMessages(0, 3)
+	if ms, _ := room.ChatHistory(0, 10); len(ms) != 3 || ms[0].Content != "message 2" {
+		t.Fatalf("messages after trim = %v, want the newest 3", contents(ms))
+	}
+	if err := db.DB().Model(&model.ChatMessage{}).Where("room_id = ?", room.ID).Update("created_at", time.Now().Add(-48*time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	op.CleanChatMessages(24*time.Hour, 0)
+	if ms, _ := room.ChatHistory(0, 10); len(ms) != 0 {
+		t.Fatalf("messages after expiry = %v, want none", contents(ms))
+	}
+	if ms, _ := other.ChatHistory(0, 10); len(ms) != 1 {
+		t.Fatalf("other room messages = %v, want its message kept", contents(ms))
+	}
+}
@@ -0,0 +1,126 @@
+package op
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/requestid"
+)
+
+// loginAttemptTTL is how long failed logins are remembered after the last one
+const loginAttemptTTL = 24 * time.Hour
+
+var ErrLoginLocked = errors.New("too many failed attempts, try again later")
+
+// LoginKeys returns the lockout keys of a login to the account login, a
+// username or an email, from ip. The account is keyed by its id together with
+// ip, so both logins share one counter and failures from elsewhere can not lock
+// the owner out. A login to an unknown account only counts against ip.
+func LoginKeys(ctx context.Context, ip, login string) []string {
+	keys := []string{"ip:" + ip}
+	if u, err := db.GetUserByLoginContext(ctx, login); err == nil {
+		keys = append(keys, fmt.Sprintf("ip:%s:user:%d", ip, u.ID))
+	}
+	return keys
+}
+
+// RoomLoginKeys returns the lockout keys of a password login of userID to the room from ip
+func RoomLoginKeys(ip, roomID string, userID uint) []string {
+	return append(RoomGuestLoginKeys(ip, roomID), fmt.Sprintf("room:%s:user:%d", roomID, userID))
+}
+
+// RoomGuestLoginKeys returns the lockout keys of a guest login to the room
+// from ip, a guest has no account so only the ip is counted
+func RoomGuestLoginKeys(ip, roomID string) []string {
+	return []string{fmt.Sprintf("room:%s:ip:%s", roomID, ip)}
+}
+
+// CheckLoginLock returns ErrLoginLocked and how long until the login may be
+// tried again when one of the keys is locked
+func CheckLoginLock(ctx context.Context, keys ...string) (time.Duration, error) {
+	if conf.Conf().User.LockoutThreshold <= 0 {
+		return 0, nil
+	}
+	attempts, err := db.GetLoginAttempts(ctx, keys...)
+	if err != nil {
+		return 0, err
+	}
+	var wait time.Duration
+	for _, a := range attempts {
+		if d := time.Until(a.LockedUntil); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return wait, ErrLoginLocked
+	}
+	return 0, nil
+}
+
+// RecordLoginFailure counts a failed login for the keys. Once a key reaches
+// the lockout threshold, every further failure locks it for twice as long as
+// the previous one, up to the max lockout duration.
+func RecordLoginFailure(ctx context.Context, keys ...string) {
+	threshold := conf.Conf().User.LockoutThreshold
+	if threshold <= 0 {
+		return
+	}
+	base, err := time.ParseDuration(conf.Conf().User.LockoutDuration)
+	if err != nil {
+		requestid.Log(ctx).Errorf("parse lockout duration failed: %s", err.Error())
+		return
+	}
+	max, err := time.ParseDuration(conf.Conf().User.LockoutMaxDuration)
+	if err != nil {
+		requestid.Log(ctx).Errorf("parse lockout max duration failed: %s", err.Error())
+		return
+	}
+	now := time.Now()
+	for _, key := range keys {
+		err := db.RecordLoginFailure(ctx, key, func(a *model.LoginAttempt) {
+			if now.Sub(a.LastFailure) > loginAttemptTTL {
+				a.Failures = 0
+			}
+			a.Failures++
+			a.LastFailure = now
+			if a.Failures >= threshold {
+				a.LockedUntil = now.Add(lockoutDuration(a.Failures-threshold, base, max))
+			}
+		})
+		if err != nil {
+			requestid.Log(ctx).Errorf("record login failure of %s failed: %s", key, err.Error())
+		}
+	}
+}
+
+// lockoutDuration returns base doubled n times, at most max
+func lockoutDuration(n int64, base, max time.Duration) time.Duration {
+	d := base
+	for ; n > 0 && d < max; n-- {
+		d *= 2
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// ResetLoginFailures forgets the failed logins of the keys, a successful login
+// resets the key of the account but not the one of the ip
+func ResetLoginFailures(ctx context.Context, keys ...string) error {
+	return db.DeleteLoginAttempts(ctx, keys...)
+}
+
+func GetLockedLogins(offset, limit int) ([]*model.LoginAttempt, int64, error) {
+	return db.GetLockedLoginAttempts(time.Now(), offset, limit)
+}
+
+// PurgeLoginAttempts deletes the failed logins older than loginAttemptTTL
+func PurgeLoginAttempts() (int64, error) {
+	return db.PurgeLoginAttempts(time.Now().Add(-loginAttemptTTL))
+}
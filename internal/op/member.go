@@ -0,0 +1,82 @@
+package op
+
+import (
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+type Member struct {
+	model.RoomUserRelation
+	Username    string
+	DisplayName string
+	Avatar      string
+	Online      bool
+}
+
+func newMember(rel *model.RoomUserRelation, online bool) *Member {
+	m := &Member{
+		RoomUserRelation: *rel,
+		Online:           online,
+	}
+	if u, err := GetUserById(rel.UserID); err == nil {
+		m.Username = u.Username
+		m.DisplayName = u.DisplayName
+		m.Avatar = u.Avatar
+	}
+	return m
+}
+
+// AddMember records the user as a member of the room, keeping the existing relation if any
+func (r *Room) AddMember(userID uint) error {
+	defer removeRoomUserRelationCache(r.ID, userID)
+	_, err := db.FirstOrCreateRoomUserRelation(r.ID, userID, r.Settings().MemberPermissions())
+	return err
+}
+
+// Members returns the registered members and the connected users of the room
+func (r *Room) Members() ([]*Member, error) {
+	relations, err := db.GetRoomUserRelations(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	online := make(map[uint]bool)
+	if r.hub != nil {
+		for _, id := range r.hub.ClientIDs() {
+			online[id] = true
+		}
+	}
+	members := make([]*Member, 0, len(relations)+len(online))
+	for _, rel := range relations {
+		members = append(members, newMember(rel, online[rel.UserID]))
+		delete(online, rel.UserID)
+	}
+	// connected users who joined before membership was recorded
+	for id := range online {
+		rel, err := GetRoomUserRelation(r.ID, id)
+		if err != nil {
+			continue
+		}
+		members = append(members, newMember(rel, true))
+	}
+	return members, nil
+}
+
+// Kick disconnects the user userID from the room, u needs CanKickUser and
+// every permission of userID. The user can join again.
+func (u *User) Kick(room *Room, userID uint) error {
+	if !u.HasPermission(room, model.CanKickUser) || userID == u.ID || userID == room.CreatorID {
+		return ErrNoPermission
+	}
+	if err := u.checkTargetPermission(room, userID); err != nil {
+		return err
+	}
+	if room.hub == nil {
+		return ErrUserNotConnected
+	}
+	c, ok := room.hub.clients.Load(userID)
+	if !ok {
+		return ErrUserNotConnected
+	}
+	c.Close()
+	return nil
+}
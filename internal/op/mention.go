@@ -0,0 +1,72 @@
+package op
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/synctv-org/synctv/internal/db"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+// Mentions reports whether message mentions username with @username,
+// the name must not go on with a letter, digit or underscore
+func Mentions(message, username string) bool {
+	if username == "" {
+		return false
+	}
+	mention := "@" + username
+	for i := 0; ; {
+		j := strings.Index(message[i:], mention)
+		if j < 0 {
+			return false
+		}
+		end := i + j + len(mention)
+		r, _ := utf8.DecodeRuneInString(message[end:])
+		if end == len(message) || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			return true
+		}
+		i = i + j + 1
+	}
+}
+
+// NotifyMentions sends a MENTION to the connected users a chat message of sender mentions
+func (r *Room) NotifyMentions(sender *User, message string, messageID uint64) {
+	if r.hub == nil || !strings.Contains(message, "@") {
+		return
+	}
+	r.hub.clients.Range(func(_ uint, c *Client) bool {
+		if c.u.ID != sender.ID && Mentions(message, c.u.Username) {
+			c.Send(&ElementMessage{
+				ElementMessage: &pb.ElementMessage{
+					Type:      pb.ElementMessageType_MENTION,
+					Sender:    sender.Username,
+					Message:   message,
+					MessageId: messageID,
+				},
+			})
+		}
+		return true
+	})
+}
+
+// MarkChatRead records that the user read the chat of the room up to the message id
+func (r *Room) MarkChatRead(userID, id uint) error {
+	return db.SetChatRead(r.ID, userID, id)
+}
+
+// ChatUnread returns the last chat message the user read, the number of
+// messages of others after it and how many of them mention the user
+func (r *Room) ChatUnread(user *User) (uint, int64, int64, error) {
+	lastRead, unread, contents, err := db.GetChatUnread(r.ID, user.ID, "@"+user.Username)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var mentions int64
+	for _, c := range contents {
+		if Mentions(c, user.Username) {
+			mentions++
+		}
+	}
+	return lastRead, unread, mentions, nil
+}
@@ -53,6 +53,41 @@ func (em *ElementMessage) Encode(w io.Writer) error {
 	return err
 }
 
+// delayedMessageTypes are the status messages players offset by the delay
+var delayedMessageTypes = map[pb.ElementMessageType]struct{}{
+	pb.ElementMessageType_PLAY:        {},
+	pb.ElementMessageType_PAUSE:       {},
+	pb.ElementMessageType_CHANGE_SEEK: {},
+	pb.ElementMessageType_CHANGE_RATE: {},
+	pb.ElementMessageType_TICK:        {},
+	pb.ElementMessageType_SNAPSHOT:    {},
+	pb.ElementMessageType_TOO_FAST:    {},
+	pb.ElementMessageType_TOO_SLOW:    {},
+}
+
+// withDelay returns a copy of a status message with the delay of one client,
+// broadcast messages are shared between the clients and must not be changed
+func withDelay(msg Message, delay int64) Message {
+	var em *pb.ElementMessage
+	switch m := msg.(type) {
+	case *ElementMessage:
+		em = m.ElementMessage
+	case *ElementJsonMessage:
+		em = m.ElementMessage
+	default:
+		return msg
+	}
+	if _, ok := delayedMessageTypes[em.Type]; !ok {
+		return msg
+	}
+	em = proto.Clone(em).(*pb.ElementMessage)
+	em.Delay = delay
+	if _, ok := msg.(*ElementJsonMessage); ok {
+		return &ElementJsonMessage{ElementMessage: em}
+	}
+	return &ElementMessage{ElementMessage: em}
+}
+
 type PingMessage struct{}
 
 func (pm *PingMessage) MessageType() int {
@@ -0,0 +1,32 @@
+package op
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/synctv-org/synctv/internal/metrics"
+)
+
+func init() {
+	metrics.NewGaugeFunc("rooms_loaded", "Rooms loaded in memory.", func() float64 {
+		return float64(roomCache.Len())
+	})
+	metrics.MustRegister(roomClientsCollector{})
+}
+
+var roomClientsDesc = metrics.NewDesc("room_clients", "Clients connected to each room with at least one.", "room")
+
+// roomClientsCollector reports the clients of each loaded room, idle rooms
+// are left out to keep the series down to the active rooms
+type roomClientsCollector struct{}
+
+func (roomClientsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- roomClientsDesc
+}
+
+func (roomClientsCollector) Collect(ch chan<- prometheus.Metric) {
+	roomCache.Range(func(id string, r *Room) bool {
+		if n := r.ClientNum(); n > 0 {
+			ch <- prometheus.MustNewConstMetric(roomClientsDesc, prometheus.GaugeValue, float64(n), id)
+		}
+		return true
+	})
+}
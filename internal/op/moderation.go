@@ -0,0 +1,64 @@
+package op
+
+import (
+	"errors"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+var ErrMuteCreator = errors.New("the room creator can't be muted")
+
+// MutedError rejects the chat of a muted user
+type MutedError time.Time
+
+func (e MutedError) Error() string {
+	return "you are muted until " + time.Time(e).Format(time.RFC3339)
+}
+
+// Mute rejects the chat messages and danmaku of the user for d, d <= 0 unmutes.
+// Mutes are kept in memory and end when the room is unloaded.
+func (r *Room) Mute(userID uint, d time.Duration) error {
+	if userID == r.CreatorID {
+		return ErrMuteCreator
+	}
+	if d <= 0 {
+		r.mutes.Delete(userID)
+		return nil
+	}
+	r.mutes.Store(userID, time.Now().Add(d))
+	return nil
+}
+
+// CheckMuted returns a MutedError while the user is muted
+func (r *Room) CheckMuted(userID uint) error {
+	until, ok := r.mutes.Load(userID)
+	if !ok {
+		return nil
+	}
+	if time.Now().After(until) {
+		r.mutes.CompareAndDelete(userID, until)
+		return nil
+	}
+	return MutedError(until)
+}
+
+func (r *Room) GetChatMessage(id uint) (*model.ChatMessage, error) {
+	return db.GetChatMessage(r.ID, id)
+}
+
+// DeleteChatMessage removes a chat message from the history and retracts it from the clients
+func (r *Room) DeleteChatMessage(id uint) error {
+	if err := db.DeleteChatMessage(r.ID, id); err != nil {
+		return err
+	}
+	r.chats.remove(uint64(id))
+	return r.Broadcast(&ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type:      pb.ElementMessageType_CHAT_RETRACTED,
+			MessageId: uint64(id),
+		},
+	})
+}
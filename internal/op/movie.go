@@ -12,7 +12,7 @@ import (
 
 var movieCache gcache.Cache
 
-func GetAllMoviesByRoomID(roomID uint) (*dllist.Dllist[*model.Movie], error) {
+func GetAllMoviesByRoomID(roomID string) (*dllist.Dllist[*model.Movie], error) {
 	i, err := movieCache.Get(roomID)
 	if err == nil {
 		return i.(*dllist.Dllist[*model.Movie]), nil
@@ -28,7 +28,7 @@ func GetAllMoviesByRoomID(roomID uint) (*dllist.Dllist[*model.Movie], error) {
 	return d, movieCache.SetWithExpire(roomID, d, time.Hour)
 }
 
-func GetMoviesByRoomIDWithPage(roomID uint, page, max int) ([]*model.Movie, error) {
+func GetMoviesByRoomIDWithPage(roomID string, page, max int) ([]*model.Movie, error) {
 	ms, err := GetAllMoviesByRoomID(roomID)
 	if err != nil {
 		return nil, err
@@ -52,7 +52,7 @@ func GetMoviesByRoomIDWithPage(roomID uint, page, max int) ([]*model.Movie, erro
 	return m, nil
 }
 
-func GetMovieByID(roomID, id uint) (*model.Movie, error) {
+func GetMovieByID(roomID string, id uint) (*model.Movie, error) {
 	ms, err := GetAllMoviesByRoomID(roomID)
 	if err != nil {
 		return nil, err
@@ -65,7 +65,7 @@ func GetMovieByID(roomID, id uint) (*model.Movie, error) {
 	return nil, errors.New("movie not found")
 }
 
-func GetMoviesCountByRoomID(roomID uint) (int, error) {
+func GetMoviesCountByRoomID(roomID string) (int, error) {
 	ms, err := GetAllMoviesByRoomID(roomID)
 	if err != nil {
 		return 0, err
@@ -73,7 +73,7 @@ func GetMoviesCountByRoomID(roomID uint) (int, error) {
 	return ms.Len(), nil
 }
 
-func DeleteMovieByID(roomID, id uint) error {
+func DeleteMovieByID(roomID string, id uint) error {
 	ms, err := GetAllMoviesByRoomID(roomID)
 	if err != nil {
 		return err
@@ -81,7 +81,11 @@ func DeleteMovieByID(roomID, id uint) error {
 	for i := ms.Front(); i != nil; i = i.Next() {
 		if i.Value.ID == id {
 			ms.Remove(i)
-			return db.DeleteMovieByID(roomID, id)
+			if err := db.DeleteMovieByID(roomID, id); err != nil {
+				return err
+			}
+			moviesChanged(roomID)
+			return nil
 		}
 	}
 	return errors.New("movie not found")
@@ -92,6 +96,7 @@ func UpdateMovie(movie *model.Movie) error {
 	if err != nil {
 		return err
 	}
+	moviesChanged(movie.RoomID)
 	m, err := GetMovieByID(movie.RoomID, movie.ID)
 	if err != nil {
 		return err
@@ -105,6 +110,7 @@ func SaveMovie(movie *model.Movie) error {
 	if err != nil {
 		return err
 	}
+	moviesChanged(movie.RoomID)
 	m, err := GetMovieByID(movie.RoomID, movie.ID)
 	if err != nil {
 		return err
@@ -113,12 +119,16 @@ func SaveMovie(movie *model.Movie) error {
 	return nil
 }
 
-func DeleteMoviesByRoomID(roomID uint) error {
+func DeleteMoviesByRoomID(roomID string) error {
 	movieCache.Remove(roomID)
-	return db.DeleteMoviesByRoomID(roomID)
+	if err := db.DeleteMoviesByRoomID(roomID); err != nil {
+		return err
+	}
+	moviesChanged(roomID)
+	return nil
 }
 
-func LoadAndDeleteMovieByID(roomID, id uint) (*model.Movie, error) {
+func LoadAndDeleteMovieByID(roomID string, id uint) (*model.Movie, error) {
 	ms, err := GetAllMoviesByRoomID(roomID)
 	if err != nil {
 		return nil, err
@@ -126,13 +136,19 @@ func LoadAndDeleteMovieByID(roomID, id uint) (*model.Movie, error) {
 	for i := ms.Front(); i != nil; i = i.Next() {
 		if i.Value.ID == id {
 			ms.Remove(i)
-			return db.LoadAndDeleteMovieByID(roomID, id)
+			m, err := db.LoadAndDeleteMovieByID(roomID, id)
+			if err != nil {
+				return nil, err
+			}
+			moviesChanged(roomID)
+			return m, nil
 		}
 	}
 	return nil, errors.New("movie not found")
 }
 
-// data race
+// CreateMovie appends movie to the playlist of its room,
+// callers serialize playlist writes of a room, see Room.movies
 func CreateMovie(movie *model.Movie) error {
 	ms, err := GetAllMoviesByRoomID(movie.RoomID)
 	if err != nil {
@@ -143,10 +159,27 @@ func CreateMovie(movie *model.Movie) error {
 		return err
 	}
 	ms.PushBack(movie)
+	moviesChanged(movie.RoomID)
+	return nil
+}
+
+// CreateMovies appends the movies to the playlist of the room, all of them or none
+func CreateMovies(roomID string, movies []*model.Movie) error {
+	ms, err := GetAllMoviesByRoomID(roomID)
+	if err != nil {
+		return err
+	}
+	if err := db.CreateMovies(roomID, movies); err != nil {
+		return err
+	}
+	for _, m := range movies {
+		ms.PushBack(m)
+	}
+	moviesChanged(roomID)
 	return nil
 }
 
-func GetMovieWithPullKey(roomID uint, pullKey string) (*model.Movie, error) {
+func GetMovieWithPullKey(roomID string, pullKey string) (*model.Movie, error) {
 	ms, err := GetAllMoviesByRoomID(roomID)
 	if err != nil {
 		return nil, err
@@ -159,23 +192,51 @@ func GetMovieWithPullKey(roomID uint, pullKey string) (*model.Movie, error) {
 	return nil, errors.New("movie not found")
 }
 
-func SwapMoviePositions(roomID uint, movie1ID uint, movie2ID uint) error {
+// MoveMovie moves a movie to the end of the folder parentID
+func MoveMovie(roomID string, id, parentID uint) error {
 	ms, err := GetAllMoviesByRoomID(roomID)
 	if err != nil {
 		return err
 	}
-	var m1, m2 *model.Movie
+	for i := ms.Front(); i != nil; i = i.Next() {
+		if i.Value.ID == id {
+			position, err := db.MoveMovie(roomID, id, parentID)
+			if err != nil {
+				return err
+			}
+			i.Value.ParentID = parentID
+			i.Value.Position = position
+			ms.MoveToBack(i)
+			moviesChanged(roomID)
+			return nil
+		}
+	}
+	return errors.New("movie not found")
+}
+
+func SwapMoviePositions(roomID string, movie1ID uint, movie2ID uint) error {
+	ms, err := GetAllMoviesByRoomID(roomID)
+	if err != nil {
+		return err
+	}
+	var e1, e2 *dllist.Element[*model.Movie]
 	for i := ms.Front(); i != nil; i = i.Next() {
 		if i.Value.ID == movie1ID {
-			m1 = i.Value
+			e1 = i
 		}
 		if i.Value.ID == movie2ID {
-			m2 = i.Value
+			e2 = i
 		}
 	}
-	if m1 == nil || m2 == nil {
+	if e1 == nil || e2 == nil {
 		return errors.New("movie not found")
 	}
-	m1.Position, m2.Position = m2.Position, m1.Position
-	return db.SwapMoviePositions(roomID, movie1ID, movie2ID)
+	if err := db.SwapMoviePositions(roomID, movie1ID, movie2ID); err != nil {
+		return err
+	}
+	// keep the cached playlist ordered by position
+	e1.Value.Position, e2.Value.Position = e2.Value.Position, e1.Value.Position
+	ms.Swap(e1, e2)
+	moviesChanged(roomID)
+	return nil
 }
@@ -2,6 +2,7 @@ package op
 
 import (
 	"github.com/bluele/gcache"
+	"github.com/synctv-org/synctv/internal/settings"
 )
 
 func Init(size int) error {
@@ -13,5 +14,29 @@ func Init(size int) error {
 		LRU().
 		Build()
 
+	relationCache = gcache.New(size).
+		LRU().
+		Build()
+
+	settings.DisableGuest.OnChange(func(disabled bool) {
+		if disabled {
+			disconnectGuests()
+		}
+	})
+
 	return nil
 }
+
+// Reset unloads every room, disconnecting its clients, and empties the
+// caches, so the rows restored to the database are read again
+func Reset() {
+	roomCache.Range(func(id string, r *Room) bool {
+		if roomCache.CompareAndDelete(id, r) {
+			r.close()
+		}
+		return true
+	})
+	userCache.Purge()
+	movieCache.Purge()
+	relationCache.Purge()
+}
@@ -0,0 +1,74 @@
+package op_test
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/op"
+	_ "github.com/synctv-org/synctv/utils/fastJSONSerializer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	conf.Set(conf.DefaultConfig())
+	d, err := gorm.Open(sqlite.Open("file::memory:?cache=shared&_pragma=foreign_keys(1)"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Discard,
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.Init(d); err != nil {
+		panic(err)
+	}
+	if err := d.Callback().Query().Before("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		atomic.AddInt64(&queries, 1)
+	}); err != nil {
+		panic(err)
+	}
+	if err := d.Callback().Query().Before("gorm:query").Register("test:fail_queries", func(tx *gorm.DB) {
+		if atomic.LoadInt32(&failing) != 0 {
+			_ = tx.AddError(errors.New("query failed"))
+		}
+	}); err != nil {
+		panic(err)
+	}
+	op.Init(1024)
+	os.Exit(m.Run())
+}
+
+var (
+	providerUserID uint32
+	queries        int64
+	failing        int32
+)
+
+// countQueries returns the number of select queries issued while running f.
+func countQueries(f func()) int64 {
+	before := atomic.LoadInt64(&queries)
+	f()
+	return atomic.LoadInt64(&queries) - before
+}
+
+// failQueries runs f with every select query failing.
+func failQueries(f func()) {
+	atomic.StoreInt32(&failing, 1)
+	defer atomic.StoreInt32(&failing, 0)
+	f()
+}
+
+func newTestUser(t *testing.T, username string) *op.User {
+	t.Helper()
+	u, err := op.CreateUser(username, "github", strconv.FormatUint(uint64(atomic.AddUint32(&providerUserID, 1)), 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,77 @@
+package op
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/zijiren233/stream"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrSignupDisabled  = errors.New("signup is disabled")
+	ErrInvalidUsername = errors.New("invalid username")
+	ErrInvalidLogin    = errors.New("invalid username or password")
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummyHash spends the time of a password check on logins of unknown
+// users, so their response time does not tell which usernames exist
+func compareDummyHash(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("synctv"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, stream.StringToBytes(password))
+}
+
+// SignupUser creates a user who logs in with a password, email may be empty
+func SignupUser(username, email, password string) (*User, error) {
+	if conf.Conf().User.DisableSignup {
+		return nil, ErrSignupDisabled
+	}
+	if !validUsername(username) {
+		return nil, ErrInvalidUsername
+	}
+	if email == "" && conf.Conf().Email.RequireVerification {
+		return nil, ErrEmailRequired
+	}
+	u, err := db.CreateUserWithPassword(username, strings.ToLower(email), password, withApproval())
+	if err != nil {
+		return nil, err
+	}
+	return cacheUser(u)
+}
+
+// LoginUser checks the password of the user with the username or email,
+// users without a password only log in with oauth2. When verification is
+// required, users whose email is not verified are refused after the password check.
+func LoginUser(login, password string) (*User, error) {
+	return LoginUserContext(context.Background(), login, password)
+}
+
+// LoginUserContext is LoginUser with the queries made in ctx
+func LoginUserContext(ctx context.Context, login, password string) (*User, error) {
+	u, err := db.GetUserByLoginContext(ctx, login)
+	if err != nil || len(u.HashedPassword) == 0 {
+		compareDummyHash(password)
+		return nil, ErrInvalidLogin
+	}
+	if bcrypt.CompareHashAndPassword(u.HashedPassword, stream.StringToBytes(password)) != nil {
+		return nil, ErrInvalidLogin
+	}
+	if u.IsBanned() {
+		return nil, ErrUserBanned
+	}
+	if conf.Conf().Email.RequireVerification && !u.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	return cacheUser(u)
+}
@@ -0,0 +1,217 @@
+package op
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+var (
+	ErrNotFolder       = errors.New("parent is not a folder")
+	ErrFolderCycle     = errors.New("can't move a folder into itself")
+	ErrEmptyFolder     = errors.New("folder is empty")
+	ErrFolderNotEmpty  = errors.New("folder is not empty")
+	ErrNoNextMovie     = errors.New("no next movie")
+	ErrMovieNotEnded   = errors.New("movie has not ended")
+	ErrInvalidPlayMode = errors.New("invalid play mode")
+)
+
+// children returns the movies directly in the folder parentID in position order,
+// 0 is the top level of the playlist
+func children(ms []*model.Movie, parentID uint) []*model.Movie {
+	var c []*model.Movie
+	for _, m := range ms {
+		if m.ParentID == parentID {
+			c = append(c, m)
+		}
+	}
+	return c
+}
+
+// playOrder flattens the folder parentID depth first, the order its movies play in
+func playOrder(ms []*model.Movie, parentID uint) []*model.Movie {
+	var order []*model.Movie
+	for _, m := range children(ms, parentID) {
+		if m.Folder {
+			order = append(order, playOrder(ms, m.ID)...)
+		} else {
+			order = append(order, m)
+		}
+	}
+	return order
+}
+
+// descendants returns the ids of all movies below the folder id, deepest first
+func descendants(ms []*model.Movie, id uint) []uint {
+	var ids []uint
+	for _, m := range children(ms, id) {
+		if m.Folder {
+			ids = append(ids, descendants(ms, m.ID)...)
+		}
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+// GetChildMovies returns the movies in the folder parentID, 0 is the top level
+func (r *Room) GetChildMovies(parentID uint) ([]*model.Movie, error) {
+	ms, err := r.GetAllMoviesByRoomID()
+	if err != nil {
+		return nil, err
+	}
+	return children(ms, parentID), nil
+}
+
+// PlayOrder returns the movies of the playlist without folders in the order they play
+func (r *Room) PlayOrder() ([]*model.Movie, error) {
+	ms, err := r.GetAllMoviesByRoomID()
+	if err != nil {
+		return nil, err
+	}
+	return playOrder(ms, 0), nil
+}
+
+// MoveMovie moves a movie or folder to the end of the folder parentID
+func (r *Room) MoveMovie(id, parentID uint) error {
+	r.LazyInit()
+	r.movies.Lock()
+	defer r.movies.Unlock()
+
+	if parentID != 0 {
+		ms, err := r.GetAllMoviesByRoomID()
+		if err != nil {
+			return err
+		}
+		byID := make(map[uint]*model.Movie, len(ms))
+		for _, m := range ms {
+			byID[m.ID] = m
+		}
+		parent, ok := byID[parentID]
+		if !ok {
+			return errors.New("folder not found")
+		}
+		if !parent.Folder {
+			return ErrNotFolder
+		}
+		for p := parent; p != nil; p = byID[p.ParentID] {
+			if p.ID == id {
+				return ErrFolderCycle
+			}
+		}
+	}
+	return MoveMovie(r.ID, id, parentID)
+}
+
+// PlayMode returns the play mode of the room
+func (r *Room) PlayMode() model.PlayMode {
+	if mode := r.Settings().PlayMode; mode != "" {
+		return mode
+	}
+	return model.PlayModeOrder
+}
+
+// SetPlayMode persists the play mode and broadcasts it to the room
+func (r *Room) SetPlayMode(mode model.PlayMode) error {
+	if !mode.Valid() {
+		return ErrInvalidPlayMode
+	}
+	err := r.UpdateSetting(func(s *model.Setting) error {
+		s.PlayMode = mode
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.Broadcast(r.playModeMessage())
+}
+
+func (r *Room) playModeMessage() *ElementMessage {
+	return &ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type:     pb.ElementMessageType_PLAY_MODE,
+			PlayMode: string(r.PlayMode()),
+		},
+	}
+}
+
+// nextMovieID returns the movie to play after the current one in mode,
+// the movies of a folder play one after another before the movies after it
+func (r *Room) nextMovieID(mode model.PlayMode) (uint, error) {
+	ms, err := r.PlayOrder()
+	if err != nil {
+		return 0, err
+	}
+	current := r.current.Movie().ID
+	switch mode {
+	case model.PlayModeRepeatOne:
+		if current != 0 {
+			return current, nil
+		}
+	case model.PlayModeShuffle:
+		others := make([]*model.Movie, 0, len(ms))
+		for _, m := range ms {
+			if m.ID != current {
+				others = append(others, m)
+			}
+		}
+		if len(others) != 0 {
+			return others[rand.Intn(len(others))].ID, nil
+		}
+		return 0, ErrNoNextMovie
+	}
+	for i, m := range ms {
+		if m.ID == current && i+1 < len(ms) {
+			return ms[i+1].ID, nil
+		}
+	}
+	if mode == model.PlayModeRepeatAll && len(ms) != 0 {
+		return ms[0].ID, nil
+	}
+	return 0, ErrNoNextMovie
+}
+
+// advanceDebounce is how long end reports are ignored after advancing,
+// with repeat-one the current movie stays the same
+const advanceDebounce = 3 * time.Second
+
+// endTolerance is how many seconds before the end of a movie the clock of
+// the room may be when its end is reported
+const endTolerance = 5.0
+
+// Ended advances a room with AutoNext to the movie after movieID in the play
+// mode of the room. Every client reports the end of a movie, only a report
+// naming the current movie advances and reports right after advancing are
+// ignored, so the reports coming in after the first one don't skip again.
+// A report long before the end of a movie of known duration is
+// ErrMovieNotEnded, so it can't be used to skip the movie.
+func (r *Room) Ended(movieID uint) (advanced bool, err error) {
+	if !r.Settings().AutoNext {
+		return false, nil
+	}
+	r.LazyInit()
+	r.advance.Lock()
+	defer r.advance.Unlock()
+
+	cur := r.current.Current()
+	if cur.Movie.ID != movieID || time.Since(r.lastAdvance) < advanceDebounce {
+		return false, nil
+	}
+	if m, err := GetMovieByID(r.ID, movieID); err == nil && m.Meta.Duration > 0 && cur.Status.Seek < m.Meta.Duration-endTolerance {
+		return false, ErrMovieNotEnded
+	}
+	id, err := r.nextMovieID(r.PlayMode())
+	if err != nil {
+		if errors.Is(err, ErrNoNextMovie) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := r.ChangeCurrentMovie(id); err != nil {
+		return false, err
+	}
+	r.lastAdvance = time.Now()
+	return true, nil
+}
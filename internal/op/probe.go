@@ -0,0 +1,108 @@
+package op
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/probe"
+	pb "github.com/synctv-org/synctv/proto"
+	"github.com/synctv-org/synctv/utils"
+)
+
+const (
+	// probeTimeout bounds probing a single movie, thumbnail included
+	probeTimeout = time.Minute
+	// probeQueueSize is how many movies wait for a worker, more are not probed
+	probeQueueSize = 256
+)
+
+type probeJob struct {
+	room  *Room
+	movie model.Movie
+}
+
+var probeQueue chan probeJob
+
+// StartMovieProber starts workers attaching metadata to pushed movies,
+// ffmpeg is used for thumbnails and may be empty
+func StartMovieProber(ctx context.Context, workers int, ffmpeg string) {
+	if workers <= 0 {
+		return
+	}
+	probeQueue = make(chan probeJob, probeQueueSize)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-probeQueue:
+					job.room.probeMovie(ctx, job.movie, ffmpeg)
+				}
+			}
+		}()
+	}
+}
+
+// probable reports whether the media of movie can be probed
+func probable(movie *model.Movie) bool {
+	if movie.Folder || movie.Live || movie.RtmpSource {
+		return false
+	}
+	u, err := url.Parse(movie.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return !utils.IsLocalIP(u.Host)
+}
+
+// enqueueProbe queues movie for probing without blocking, it is skipped when the queue is full
+func (r *Room) enqueueProbe(movie model.Movie) {
+	if probeQueue == nil || !probable(&movie) {
+		return
+	}
+	select {
+	case probeQueue <- probeJob{room: r, movie: movie}:
+	default:
+		log.Warnf("probe queue full, skip movie %d of room %s", movie.ID, r.ID)
+	}
+}
+
+func (r *Room) probeMovie(ctx context.Context, movie model.Movie, ffmpeg string) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	p := &probe.Prober{Headers: movie.Headers, FFmpeg: ffmpeg}
+	meta, err := p.Probe(ctx, movie.Url)
+	if err != nil {
+		log.Debugf("probe movie %d of room %s failed: %s", movie.ID, r.ID, err.Error())
+		if meta == (model.MovieMeta{}) {
+			return
+		}
+	}
+	if err := SetMovieMeta(r.ID, movie.ID, meta); err != nil {
+		log.Errorf("save meta of movie %d of room %s failed: %s", movie.ID, r.ID, err.Error())
+		return
+	}
+	r.Broadcast(&ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type: pb.ElementMessageType_CHANGE_MOVIES,
+		},
+	})
+}
+
+// SetMovieMeta stores the metadata of a movie, in the cache too
+func SetMovieMeta(roomID string, id uint, meta model.MovieMeta) error {
+	if err := db.SetMovieMeta(roomID, id, meta); err != nil {
+		return err
+	}
+	m, err := GetMovieByID(roomID, id)
+	if err != nil {
+		return err
+	}
+	m.Meta = meta
+	return nil
+}
@@ -0,0 +1,117 @@
+package op
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/storage"
+	"github.com/synctv-org/synctv/utils"
+)
+
+// AvatarURLPrefix is the path uploaded avatars are served under, followed by the storage key
+const AvatarURLPrefix = "/api/user/avatar/"
+
+var (
+	ErrAvatarStorage = errors.New("avatar uploads are not enabled")
+	ErrInvalidAvatar = errors.New("avatar must be a png, jpeg, gif or webp image")
+)
+
+var avatarTypes = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpg",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// ShownName is the name to show for the user, the display name if set
+func (u *User) ShownName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Username
+}
+
+func avatarKey(avatar string) (string, bool) {
+	return strings.CutPrefix(avatar, AvatarURLPrefix)
+}
+
+// UpdateProfile sets the profile of the user and returns the updated user,
+// avatar is an url or the current uploaded avatar, a replaced uploaded avatar
+// is deleted
+func (u *User) UpdateProfile(displayName, avatar, bio string) (*User, error) {
+	if _, ok := avatarKey(avatar); ok && avatar != u.Avatar {
+		return nil, errors.New("avatar can only be uploaded")
+	}
+	return u.setProfile(displayName, avatar, bio)
+}
+
+func (u *User) setProfile(displayName, avatar, bio string) (*User, error) {
+	if err := db.SetUserProfile(u.ID, displayName, avatar, bio); err != nil {
+		return nil, err
+	}
+	u2 := updateCachedUser(u, func(u *User) {
+		u.DisplayName = displayName
+		u.Avatar = avatar
+		u.Bio = bio
+	})
+	userChanged(u.ID)
+	if key, ok := avatarKey(u.Avatar); ok && u.Avatar != avatar {
+		if s := storage.Default(); s != nil {
+			if err := s.Delete(key); err != nil {
+				log.Errorf("delete avatar %s failed: %s", key, err.Error())
+			}
+		}
+	}
+	return u2, nil
+}
+
+// UploadAvatar stores the image as the avatar of the user and returns the updated user
+func (u *User) UploadAvatar(data []byte) (*User, error) {
+	s := storage.Default()
+	if s == nil {
+		return nil, ErrAvatarStorage
+	}
+	ext, ok := avatarTypes[http.DetectContentType(data)]
+	if !ok {
+		return nil, ErrInvalidAvatar
+	}
+	key := fmt.Sprintf("avatar-%d-%s.%s", u.ID, utils.RandString(16), ext)
+	if err := s.Put(key, data); err != nil {
+		return nil, err
+	}
+	u2, err := u.setProfile(u.DisplayName, AvatarURLPrefix+key, u.Bio)
+	if err != nil {
+		s.Delete(key)
+		return nil, err
+	}
+	return u2, nil
+}
+
+// GetAvatar returns an uploaded avatar and its content type
+func GetAvatar(key string) ([]byte, string, error) {
+	s := storage.Default()
+	if s == nil {
+		return nil, "", ErrAvatarStorage
+	}
+	if !strings.HasPrefix(key, "avatar-") {
+		return nil, "", storage.ErrInvalidKey
+	}
+	data, err := s.Get(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, http.DetectContentType(data), nil
+}
+
+// GetUserProfile returns the shown name and avatar of a user, empty for unknown users
+func GetUserProfile(userID uint) (name, avatar string) {
+	u, err := GetUserById(userID)
+	if err != nil {
+		return "", ""
+	}
+	return u.ShownName(), u.Avatar
+}
@@ -0,0 +1,126 @@
+package op
+
+import (
+	"errors"
+
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+// Versions of the sync protocol. A client announces the highest version it
+// speaks in a HELLO message and the server answers with the version in use,
+// clients that never say hello are served ProtocolVersionLegacy. New message
+// types are only sent to clients that negotiated them, so they can roll out
+// without breaking deployed clients.
+const (
+	ProtocolVersionLegacy uint32 = 1
+	// ProtocolVersion2 adds HELLO and capability negotiation
+	ProtocolVersion2 uint32 = 2
+
+	ProtocolVersion = ProtocolVersion2
+)
+
+// Capabilities are optional features negotiated on top of the protocol version
+const (
+	CapabilityCountdown    = "countdown"
+	CapabilityAnnouncement = "announcement"
+	CapabilityTick         = "tick"
+	CapabilitySnapshot     = "snapshot"
+	CapabilityRTT          = "rtt"
+	CapabilityVote         = "vote"
+	CapabilityPlayMode     = "playmode"
+	CapabilitySubtitle     = "subtitle"
+	CapabilityDanmaku      = "danmaku"
+	CapabilityModeration   = "moderation"
+	CapabilityReaction     = "reaction"
+	CapabilityPresence     = "presence"
+	CapabilityMention      = "mention"
+	CapabilityVoice        = "voice"
+	CapabilityDirect       = "direct"
+	CapabilityRestart      = "restart"
+)
+
+// capabilityVersions are the capabilities the server supports and the version introducing them
+var capabilityVersions = map[string]uint32{
+	CapabilityCountdown:    ProtocolVersion2,
+	CapabilityAnnouncement: ProtocolVersion2,
+	CapabilityTick:         ProtocolVersion2,
+	CapabilitySnapshot:     ProtocolVersion2,
+	CapabilityRTT:          ProtocolVersion2,
+	CapabilityVote:         ProtocolVersion2,
+	CapabilityPlayMode:     ProtocolVersion2,
+	CapabilitySubtitle:     ProtocolVersion2,
+	CapabilityDanmaku:      ProtocolVersion2,
+	CapabilityModeration:   ProtocolVersion2,
+	CapabilityReaction:     ProtocolVersion2,
+	CapabilityPresence:     ProtocolVersion2,
+	CapabilityMention:      ProtocolVersion2,
+	CapabilityVoice:        ProtocolVersion2,
+	CapabilityDirect:       ProtocolVersion2,
+	CapabilityRestart:      ProtocolVersion2,
+}
+
+// messageCapabilities are the capabilities a client needs to receive a message type,
+// types not listed here are understood by every client
+var messageCapabilities = map[pb.ElementMessageType]string{
+	pb.ElementMessageType_COUNTDOWN:         CapabilityCountdown,
+	pb.ElementMessageType_ANNOUNCEMENT:      CapabilityAnnouncement,
+	pb.ElementMessageType_TICK:              CapabilityTick,
+	pb.ElementMessageType_SNAPSHOT:          CapabilitySnapshot,
+	pb.ElementMessageType_PING:              CapabilityRTT,
+	pb.ElementMessageType_PONG:              CapabilityRTT,
+	pb.ElementMessageType_VOTE:              CapabilityVote,
+	pb.ElementMessageType_PLAY_MODE:         CapabilityPlayMode,
+	pb.ElementMessageType_SUBTITLE:          CapabilitySubtitle,
+	pb.ElementMessageType_DANMAKU:           CapabilityDanmaku,
+	pb.ElementMessageType_CHAT_RETRACTED:    CapabilityModeration,
+	pb.ElementMessageType_REACTION:          CapabilityReaction,
+	pb.ElementMessageType_USER_JOINED:       CapabilityPresence,
+	pb.ElementMessageType_USER_LEFT:         CapabilityPresence,
+	pb.ElementMessageType_MENTION:           CapabilityMention,
+	pb.ElementMessageType_VOICE_JOIN:        CapabilityVoice,
+	pb.ElementMessageType_VOICE_LEAVE:       CapabilityVoice,
+	pb.ElementMessageType_VOICE_SIGNAL:      CapabilityVoice,
+	pb.ElementMessageType_VOICE_SPEAKING:    CapabilityVoice,
+	pb.ElementMessageType_DIRECT_MESSAGE:    CapabilityDirect,
+	pb.ElementMessageType_SERVER_RESTARTING: CapabilityRestart,
+}
+
+var ErrAlreadyNegotiated = errors.New("protocol already negotiated")
+
+type protocol struct {
+	version      uint32
+	capabilities map[string]struct{}
+}
+
+var legacyProtocol = &protocol{version: ProtocolVersionLegacy}
+
+// negotiate returns the protocol both sides speak, the highest common version
+// and the requested capabilities the server supports at that version
+func negotiate(version uint32, capabilities []string) *protocol {
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+	if version <= ProtocolVersionLegacy {
+		return legacyProtocol
+	}
+	p := &protocol{
+		version:      version,
+		capabilities: make(map[string]struct{}, len(capabilities)),
+	}
+	for _, c := range capabilities {
+		if v, ok := capabilityVersions[c]; ok && v <= version {
+			p.capabilities[c] = struct{}{}
+		}
+	}
+	return p
+}
+
+func (p *protocol) has(capability string) bool {
+	_, ok := p.capabilities[capability]
+	return ok
+}
+
+func (p *protocol) accepts(t pb.ElementMessageType) bool {
+	c, ok := messageCapabilities[t]
+	return !ok || p.has(c)
+}
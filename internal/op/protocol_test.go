@@ -0,0 +1,59 @@
+package op_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/op"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+func TestProtocolNegotiation(t *testing.T) {
+	creator := newTestUser(t, "protocol-creator")
+	member := newTestUser(t, "protocol-member")
+	room := newTestRoom(t, creator, "protocol-room")
+
+	legacy, err := room.RegClient(creator, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(creator)
+	if v := legacy.ProtocolVersion(); v != op.ProtocolVersionLegacy {
+		t.Fatalf("version without hello = %d, want %d", v, op.ProtocolVersionLegacy)
+	}
+
+	modern, err := room.RegClient(member, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(member)
+	version, caps, err := modern.Negotiate(op.ProtocolVersion+1, []string{op.CapabilityAnnouncement, "unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != op.ProtocolVersion {
+		t.Fatalf("negotiated version = %d, want %d", version, op.ProtocolVersion)
+	}
+	if !reflect.DeepEqual(caps, []string{op.CapabilityAnnouncement}) {
+		t.Fatalf("negotiated capabilities = %v, want only %s", caps, op.CapabilityAnnouncement)
+	}
+	if _, _, err := modern.Negotiate(op.ProtocolVersion, nil); !errors.Is(err, op.ErrAlreadyNegotiated) {
+		t.Fatalf("second hello = %v, want %v", err, op.ErrAlreadyNegotiated)
+	}
+
+	if err := room.SetAnnouncement("new message type"); err != nil {
+		t.Fatal(err)
+	}
+	if em := nextElementMessage(t, modern); em.Type != pb.ElementMessageType_ANNOUNCEMENT {
+		t.Fatalf("negotiated client got %v, want the announcement", em)
+	}
+	select {
+	case m := <-legacy.GetReadChan():
+		if em, ok := m.(*op.ElementMessage); ok && em.Type == pb.ElementMessageType_ANNOUNCEMENT {
+			t.Fatal("legacy client received a message type it did not negotiate")
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,73 @@
+package op
+
+import (
+	"errors"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/provider"
+)
+
+var (
+	ErrProviderLinkedToOther = errors.New("this provider account is linked to another user")
+	ErrProviderAlreadyLinked = errors.New("an account of this provider is already linked")
+	ErrProviderNotLinked     = errors.New("provider not linked")
+	ErrLastLoginMethod       = errors.New("can't unlink the only way to log in, set a password first")
+)
+
+func (u *User) Providers() ([]model.UserProvider, error) {
+	return db.GetUserProviders(u.ID)
+}
+
+// LinkProvider adds the provider account of ui to the user, so either logs
+// in. A user has at most one account per provider and a provider account
+// belongs to one user.
+func (u *User) LinkProvider(p provider.OAuth2Provider, ui *provider.UserInfo) error {
+	owner, err := db.GetUserByProvider(p, ui.ProviderUserID)
+	switch {
+	case err == nil:
+		if owner.ID == u.ID {
+			return nil
+		}
+		return ErrProviderLinkedToOther
+	case !errors.Is(err, db.ErrUserNotFound):
+		return err
+	}
+	providers, err := u.Providers()
+	if err != nil {
+		return err
+	}
+	for _, up := range providers {
+		if up.Provider == p {
+			return ErrProviderAlreadyLinked
+		}
+	}
+	err = db.AddUserProvider(u.ID, p, ui.ProviderUserID, trustedVerifiedEmail(p, ui))
+	if errors.Is(err, db.ErrProviderBound) {
+		return ErrProviderLinkedToOther
+	}
+	return err
+}
+
+// UnlinkProvider removes the provider account from the user, unless it is
+// the only way the user logs in
+func (u *User) UnlinkProvider(p provider.OAuth2Provider) error {
+	providers, err := u.Providers()
+	if err != nil {
+		return err
+	}
+	linked := false
+	for _, up := range providers {
+		if up.Provider == p {
+			linked = true
+			break
+		}
+	}
+	if !linked {
+		return ErrProviderNotLinked
+	}
+	if len(providers) == 1 && len(u.HashedPassword) == 0 {
+		return ErrLastLoginMethod
+	}
+	return db.DeleteUserProvider(u.ID, p)
+}
@@ -0,0 +1,56 @@
+package op
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+// Reactions are the emoji clients can react with
+var Reactions = map[string]struct{}{
+	"👍": {}, "👎": {}, "😂": {}, "😮": {}, "😢": {},
+	"❤️": {}, "🔥": {}, "👏": {}, "🎉": {},
+}
+
+// a client can send reactionBurst reactions at once, then one every reactionInterval
+const (
+	reactionBurst    = 5
+	reactionInterval = 500 * time.Millisecond
+)
+
+var (
+	ErrUnknownReaction    = errors.New("unknown reaction")
+	ErrTooManyReactions   = errors.New("too many reactions")
+	ErrClientNotConnected = errors.New("client not connected")
+)
+
+// React checks a reaction of a connected user against the known reactions and
+// the rate limit of its client, the caller broadcasts it
+func (r *Room) React(userID uint, reaction string) error {
+	if _, ok := Reactions[reaction]; !ok {
+		return ErrUnknownReaction
+	}
+	if r.hub == nil {
+		return ErrClientNotConnected
+	}
+	c, ok := r.hub.clients.Load(userID)
+	if !ok {
+		return ErrClientNotConnected
+	}
+	if !c.reactions.Allow() {
+		return ErrTooManyReactions
+	}
+	return nil
+}
+
+// broadcastPresence tells the other clients that user joined or left the room
+func (r *Room) broadcastPresence(user *User, t pb.ElementMessageType) {
+	r.Broadcast(&ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type:   t,
+			Sender: user.Username,
+			Time:   time.Now().UnixMilli(),
+		},
+	}, WithSender(user.Username))
+}
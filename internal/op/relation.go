@@ -0,0 +1,72 @@
+package op
+
+import (
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+var relationCache gcache.Cache
+
+type relationKey struct {
+	roomID string
+	userID uint
+}
+
+func GetRoomUserRelation(roomID string, userID uint) (*model.RoomUserRelation, error) {
+	i, err := relationCache.Get(relationKey{roomID, userID})
+	if err == nil {
+		return i.(*model.RoomUserRelation), nil
+	}
+	ur, err := db.GetRoomUserRelation(roomID, userID, defaultPermissions(roomID))
+	if err != nil {
+		return nil, err
+	}
+	return ur, relationCache.SetWithExpire(relationKey{roomID, userID}, ur, time.Hour)
+}
+
+// defaultPermissions returns the permissions of new members of the room
+func defaultPermissions(roomID string) model.Permission {
+	if r, ok := roomCache.Load(roomID); ok {
+		return r.Settings().MemberPermissions()
+	}
+	r, err := db.GetRoomByID(roomID)
+	if err != nil {
+		return model.DefaultPermissions
+	}
+	return r.Setting.MemberPermissions()
+}
+
+// The remove functions drop the relations from the cache of every instance
+
+func removeRoomUserRelationCache(roomID string, userID uint) {
+	relationCache.Remove(relationKey{roomID, userID})
+	publishInvalidation(&BrokerInvalidation{Cache: invalidRelation, RoomID: roomID, UserID: userID})
+}
+
+func removeRoomRelationsCache(roomID string) {
+	dropRelationsCache(roomID, 0)
+	publishInvalidation(&BrokerInvalidation{Cache: invalidRelation, RoomID: roomID})
+}
+
+func removeUserRelationsCache(userID uint) {
+	dropRelationsCache("", userID)
+	publishInvalidation(&BrokerInvalidation{Cache: invalidRelation, UserID: userID})
+}
+
+// dropRelationsCache drops the cached relations of the room and the user,
+// an empty roomID or zero userID matches any
+func dropRelationsCache(roomID string, userID uint) {
+	if roomID != "" && userID != 0 {
+		relationCache.Remove(relationKey{roomID, userID})
+		return
+	}
+	for _, k := range relationCache.Keys(false) {
+		key := k.(relationKey)
+		if (roomID == "" || key.roomID == roomID) && (userID == 0 || key.userID == userID) {
+			relationCache.Remove(k)
+		}
+	}
+}
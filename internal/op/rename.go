@@ -0,0 +1,72 @@
+package op
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRenameCooldown    = errors.New("username was changed recently")
+	ErrUsernameUnchanged = errors.New("username is unchanged")
+)
+
+// Rename changes the username of the user, at most once per rename
+// cooldown, and returns the updated user
+func (u *User) Rename(username string) (*User, error) {
+	if !validUsername(username) {
+		return nil, ErrInvalidUsername
+	}
+	if username == u.Username {
+		return nil, ErrUsernameUnchanged
+	}
+	if next, err := u.NextRenameAt(); err != nil {
+		return nil, err
+	} else if time.Now().Before(next) {
+		return nil, fmt.Errorf("%w, try again after %s", ErrRenameCooldown, next.Format(time.RFC3339))
+	}
+	if err := db.RenameUser(u.ID, u.Username, username); err != nil {
+		return nil, err
+	}
+	u2 := updateCachedUser(u, func(u *User) {
+		u.Username = username
+	})
+	userChanged(u.ID)
+	return u2, nil
+}
+
+// NextRenameAt returns when the user may change the username again, zero if now
+func (u *User) NextRenameAt() (time.Time, error) {
+	cooldown := time.Duration(0)
+	if conf.Conf().User.RenameCooldown != "" {
+		var err error
+		cooldown, err = time.ParseDuration(conf.Conf().User.RenameCooldown)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	if cooldown <= 0 {
+		return time.Time{}, nil
+	}
+	last, err := db.GetLastUsernameChange(u.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return last.CreatedAt.Add(cooldown), nil
+}
+
+func (u *User) UsernameChanges() ([]*model.UsernameChange, error) {
+	return db.GetUsernameChanges(u.ID)
+}
+
+// UsernameChangesByName returns the renames from or to the username, to trace who used it
+func UsernameChangesByName(username string) ([]*model.UsernameChange, error) {
+	return db.GetUsernameChangesByName(username)
+}
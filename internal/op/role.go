@@ -0,0 +1,89 @@
+package op
+
+import (
+	"errors"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+var (
+	ErrUserBanned   = errors.New("user is banned")
+	ErrCannotManage = errors.New("users can only be managed by users with a higher role")
+)
+
+// CheckBanned returns ErrUserBanned for banned users, they can't log in or use their tokens
+func (u *User) CheckBanned() error {
+	if u.IsBanned() {
+		return ErrUserBanned
+	}
+	return nil
+}
+
+// SetRole sets the instance role of the user, banning logs it out of every
+// session and disconnects it from every room
+func (u *User) SetRole(role model.Role) error {
+	if err := db.SetUserInstanceRole(u.ID, role); err != nil {
+		return err
+	}
+	u2 := updateCachedUser(u, func(u *User) {
+		u.Role = role
+	})
+	if role != model.RoleBanned {
+		userChanged(u.ID)
+		return nil
+	}
+	if err := u2.LogoutAll(); err != nil {
+		return err
+	}
+	disconnectUser(u.ID)
+	publishInvalidation(&BrokerInvalidation{Cache: invalidUser, UserID: u.ID, Disconnect: true})
+	return nil
+}
+
+// disconnectUser closes the clients of the user in every loaded room
+func disconnectUser(userID uint) {
+	roomCache.Range(func(_ string, r *Room) bool {
+		if r.hub == nil {
+			return true
+		}
+		if c, ok := r.hub.clients.Load(userID); ok {
+			c.Close()
+		}
+		return true
+	})
+}
+
+// CanManage reports whether u may change the role of target or log it out,
+// which needs a higher role than the one of target
+func (u *User) CanManage(target *User) bool {
+	return u.ID != target.ID && u.Role > target.Role
+}
+
+// SetUserRole sets the role of target on behalf of u, who can only grant
+// roles below its own. Admins can ban users and root users can also make
+// admins, root users are only made from the command line.
+func (u *User) SetUserRole(target *User, role model.Role) error {
+	if !u.CanManage(target) || role >= u.Role {
+		return ErrCannotManage
+	}
+	return target.SetRole(role)
+}
+
+// ForceLogout logs target out of every session and room on behalf of u
+func (u *User) ForceLogout(target *User) error {
+	if !u.CanManage(target) {
+		return ErrCannotManage
+	}
+	if err := target.LogoutAll(); err != nil {
+		return err
+	}
+	disconnectUser(target.ID)
+	publishInvalidation(&BrokerInvalidation{Cache: invalidUser, UserID: target.ID, Disconnect: true})
+	return nil
+}
+
+// GetUsers returns a page of users for the admin api, see db.GetUsersPaginated
+func GetUsers(offset, limit int, conf ...db.GetUsersConfig) ([]*model.User, int64, error) {
+	return db.GetUsersPaginated(offset, limit, conf...)
+}
@@ -1,9 +1,12 @@
 package op
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"hash/crc32"
 	"net/url"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -14,6 +17,8 @@ import (
 	"github.com/synctv-org/synctv/internal/conf"
 	"github.com/synctv-org/synctv/internal/db"
 	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/proxy"
+	pb "github.com/synctv-org/synctv/proto"
 	"github.com/synctv-org/synctv/utils"
 	"github.com/zijiren233/gencontainer/rwmap"
 	"github.com/zijiren233/livelib/av"
@@ -31,8 +36,31 @@ type Room struct {
 	current  *current
 	initOnce utils.Once
 	hub      *Hub
+	// unix milli of the last client register or unregister
+	lastActive int64
 
 	channles rwmap.RWMap[string, *rtmps.Channel]
+	seek     seekDebouncer
+	chats    chatTail
+	// seq of the last saved playback state
+	savedSeq uint64
+	votes    ballots
+	// mutes are the times muted users can chat again
+	mutes rwmap.RWMap[uint, time.Time]
+	// repeats are the last chat message of each user, see countRepeat
+	repeats rwmap.RWMap[uint, repeatedChat]
+	// chatFilter is built from the setting on first use
+	chatFilter atomic.Pointer[roomChatFilter]
+	voice      voiceChannel
+	// movies serializes the playlist writes of the room
+	movies sync.Mutex
+	// advance serializes moving on to the next movie, see Ended
+	advance     sync.Mutex
+	lastAdvance time.Time
+	// settingLock guards the Setting of the embedded room, read it with Settings
+	settingLock sync.RWMutex
+	// settingUpdate serializes the changes of the setting, see UpdateSetting
+	settingUpdate sync.Mutex
 }
 
 func (r *Room) LazyInit() (err error) {
@@ -47,14 +75,74 @@ func (r *Room) LazyInit() (err error) {
 		}
 		for _, m := range ms {
 			if err = r.initMovie(m); err != nil {
-				log.Errorf("lazy init room %d movie %d failed: %s", r.ID, m.ID, err.Error())
+				log.Errorf("lazy init room %s movie %d failed: %s", r.ID, m.ID, err.Error())
 				DeleteMovieByID(r.ID, m.ID)
 			}
 		}
+
+		// the other instances serving the room know its state better than
+		// the last one saved
+		if !r.joinCluster() {
+			if err := r.restoreState(); err != nil {
+				log.Debugf("lazy init room %s restore state: %s", r.ID, err.Error())
+			}
+		}
+
+		if r.InLobby() {
+			go r.countdown()
+		}
+		go r.tick()
 	})
 	return
 }
 
+func (r *Room) restoreState() error {
+	s, err := db.GetRoomState(r.ID)
+	if err != nil {
+		return err
+	}
+	if s.CurrentMovieID != 0 {
+		m, err := GetMovieByID(r.ID, s.CurrentMovieID)
+		if err != nil {
+			return err
+		}
+		r.current.SetMovie(*m)
+		r.current.SetSubtitle(m.ID, s.Subtitle)
+	}
+	status := r.current.SetStatus(s.Playing, s.Seek, s.Rate, 0)
+	atomic.StoreUint64(&r.savedSeq, status.Seq)
+	return nil
+}
+
+func (r *Room) saveState() error {
+	c := r.current.Current()
+	err := db.SaveRoomState(&model.RoomState{
+		RoomID:         r.ID,
+		CurrentMovieID: c.Movie.ID,
+		Seek:           c.Status.Seek,
+		Rate:           c.Status.Rate,
+		Playing:        c.Status.Playing,
+		Subtitle:       c.Subtitle,
+	})
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint64(&r.savedSeq, c.Status.Seq)
+	return nil
+}
+
+// stateChanged reports whether the playback state moved since it was last saved
+func (r *Room) stateChanged() bool {
+	s := r.current.Status()
+	return s.Playing || s.Seq != atomic.LoadUint64(&r.savedSeq)
+}
+
+func (r *Room) idle(d time.Duration) bool {
+	return r.ClientNum() == 0 &&
+		r.channles.Len() == 0 &&
+		time.Since(time.UnixMilli(atomic.LoadInt64(&r.lastActive))) >= d
+}
+
 func (r *Room) ClientNum() int64 {
 	if r.hub == nil {
 		return 0
@@ -62,6 +150,14 @@ func (r *Room) ClientNum() int64 {
 	return r.hub.ClientNum()
 }
 
+// PeopleNum is the number of users in the room on every instance
+func (r *Room) PeopleNum() int64 {
+	if r.hub == nil {
+		return 0
+	}
+	return r.hub.PeopleNum()
+}
+
 func (r *Room) Broadcast(data Message, conf ...BroadcastConf) error {
 	if r.hub == nil {
 		return nil
@@ -84,6 +180,7 @@ func (r *Room) GetChannel(channelName string) (*rtmps.Channel, error) {
 }
 
 func (r *Room) close() {
+	proxy.RemoveRoomLimiter(r.ID)
 	if r.initOnce.Done() {
 		r.hub.Close()
 		r.channles.Range(func(_ string, c *rtmps.Channel) bool {
@@ -107,16 +204,29 @@ func (r *Room) UpdateMovie(movieId uint, movie model.BaseMovieInfo) error {
 		return err
 	}
 
+	r.movies.Lock()
+	defer r.movies.Unlock()
+
 	m, err := GetMovieByID(r.ID, movieId)
 	if err != nil {
 		return err
 	}
+	if m.Folder && !movie.Folder {
+		if c, err := r.GetChildMovies(m.ID); err != nil {
+			return err
+		} else if len(c) != 0 {
+			return ErrFolderNotEmpty
+		}
+	}
 
 	err = r.terminateMovie(m)
 	if err != nil {
 		return err
 	}
 
+	if m.Url != movie.Url {
+		m.Meta = model.MovieMeta{}
+	}
 	m.MovieInfo.BaseMovieInfo = movie
 
 	err = r.initMovie(m)
@@ -124,7 +234,13 @@ func (r *Room) UpdateMovie(movieId uint, movie model.BaseMovieInfo) error {
 		return err
 	}
 
-	return SaveMovie(m)
+	if err := SaveMovie(m); err != nil {
+		return err
+	}
+	if m.Meta == (model.MovieMeta{}) {
+		r.enqueueProbe(*m)
+	}
+	return nil
 }
 
 func (r *Room) terminateMovie(movie *model.Movie) error {
@@ -140,10 +256,15 @@ func (r *Room) terminateMovie(movie *model.Movie) error {
 
 func (r *Room) initMovie(movie *model.Movie) error {
 	switch {
+	case movie.Folder:
+		if movie.Url != "" || movie.Live || movie.Proxy || movie.RtmpSource {
+			return errors.New("folders can't have media")
+		}
+		movie.PullKey = ""
 	case movie.RtmpSource && movie.Proxy:
 		return errors.New("rtmp source and proxy can't be true at the same time")
 	case movie.Live && movie.RtmpSource:
-		if !conf.Conf.Rtmp.Enable {
+		if !conf.Conf().Rtmp.Enable {
 			return errors.New("rtmp is not enabled")
 		}
 		if movie.PullKey == "" {
@@ -155,7 +276,7 @@ func (r *Room) initMovie(movie *model.Movie) error {
 		}
 		c.InitHlsPlayer()
 	case movie.Live && movie.Proxy:
-		if !conf.Conf.Proxy.LiveProxy {
+		if !conf.Conf().Proxy.LiveProxy {
 			return errors.New("live proxy is not enabled")
 		}
 		u, err := url.Parse(movie.Url)
@@ -190,9 +311,30 @@ func (r *Room) initMovie(movie *model.Movie) error {
 					}
 				}
 			}()
+		case "rtsp", "rtsps":
+			if !proxy.Enabled() {
+				return errors.New("rtsp needs remuxing, which is disabled")
+			}
+			movie.PullKey = uuid.NewMD5(uuid.NameSpaceURL, []byte(movie.Url)).String()
+			c, loaded := r.channles.LoadOrStore(movie.PullKey, rtmps.NewChannel())
+			if loaded {
+				return errors.New("pull key already exists")
+			}
+			c.InitHlsPlayer()
+			go r.pushRemuxed(c, movie.Url, movie.Headers)
 		case "http", "https":
 			if movie.Type != "flv" {
-				return errors.New("only flv is supported")
+				if !proxy.Enabled() {
+					return errors.New("only flv is supported")
+				}
+				movie.PullKey = uuid.NewMD5(uuid.NameSpaceURL, []byte(movie.Url)).String()
+				c, loaded := r.channles.LoadOrStore(movie.PullKey, rtmps.NewChannel())
+				if loaded {
+					return errors.New("pull key already exists")
+				}
+				c.InitHlsPlayer()
+				go r.pushRemuxed(c, movie.Url, movie.Headers)
+				break
 			}
 			movie.PullKey = uuid.NewMD5(uuid.NameSpaceURL, []byte(movie.Url)).String()
 			c, loaded := r.channles.LoadOrStore(movie.PullKey, rtmps.NewChannel())
@@ -227,7 +369,7 @@ func (r *Room) initMovie(movie *model.Movie) error {
 	case !movie.Live && movie.RtmpSource:
 		return errors.New("rtmp source can't be true when movie is not live")
 	case !movie.Live && movie.Proxy:
-		if !conf.Conf.Proxy.MovieProxy {
+		if !conf.Conf().Proxy.MovieProxy {
 			return errors.New("movie proxy is not enabled")
 		}
 		u, err := url.Parse(movie.Url)
@@ -256,13 +398,66 @@ func (r *Room) initMovie(movie *model.Movie) error {
 	return nil
 }
 
+const maxRemuxBackoff = time.Minute
+
+// pushRemuxed feeds the live channel c with the stream at u remuxed to flv
+// until c or the room is closed, a failing source is retried less and less
+// often
+func (r *Room) pushRemuxed(c *rtmps.Channel, u string, headers map[string]string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.hub.exit:
+				cancel()
+				return
+			case <-ticker.C:
+				if c.Closed() {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	backoff := time.Second
+	for ctx.Err() == nil && !c.Closed() {
+		start := time.Now()
+		rc, err := proxy.RemuxFLV(ctx, u, headers)
+		if err == nil {
+			err = c.PushStart(flv.NewReader(rc))
+			rc.Close()
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Errorf("remux live %s of room %s failed: %s", u, r.ID, err.Error())
+		}
+		// a stream that played for a while starts over from the first delay
+		if time.Since(start) > maxRemuxBackoff {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxRemuxBackoff {
+			backoff = maxRemuxBackoff
+		}
+	}
+}
+
 func (r *Room) AddMovie(m model.Movie) error {
 	err := r.LazyInit()
 	if err != nil {
 		return err
 	}
 
-	m.Position = uint(time.Now().UnixMilli())
+	r.movies.Lock()
+	defer r.movies.Unlock()
 
 	m.RoomID = r.ID
 
@@ -274,18 +469,108 @@ func (r *Room) AddMovie(m model.Movie) error {
 	err = CreateMovie(&m)
 	if err != nil {
 		r.terminateMovie(&m)
+		return err
+	}
+	r.enqueueProbe(m)
+	return nil
+}
+
+// AddMovies adds the movies to the playlist in one transaction, all of them or
+// none, the error of a movie that can't be added is wrapped in a MovieError
+func (r *Room) AddMovies(movies []model.Movie) error {
+	err := r.LazyInit()
+	if err != nil {
+		return err
+	}
+
+	r.movies.Lock()
+	defer r.movies.Unlock()
+
+	ms := make([]*model.Movie, len(movies))
+	for i := range movies {
+		m := movies[i]
+		m.RoomID = r.ID
+		if err := r.initMovie(&m); err != nil {
+			for _, added := range ms[:i] {
+				r.terminateMovie(added)
+			}
+			return &MovieError{Index: i, Err: err}
+		}
+		ms[i] = &m
+	}
+	if err := CreateMovies(r.ID, ms); err != nil {
+		for _, m := range ms {
+			r.terminateMovie(m)
+		}
+		return err
 	}
-	return err
+	for _, m := range ms {
+		r.enqueueProbe(*m)
+	}
+	return nil
+}
+
+// MovieError is the error of the movie at Index of a batch
+type MovieError struct {
+	Index int
+	Err   error
+}
+
+func (e *MovieError) Error() string {
+	return fmt.Sprintf("movie %d: %s", e.Index+1, e.Err)
+}
+
+func (e *MovieError) Unwrap() error {
+	return e.Err
 }
 
 func (r *Room) HasPermission(user *model.User, permission model.Permission) bool {
-	ur, err := db.GetRoomUserRelation(r.ID, user.ID)
+	ur, err := GetRoomUserRelation(r.ID, user.ID)
 	if err != nil {
 		return false
 	}
 	return ur.HasPermission(permission)
 }
 
+func (r *Room) HasPermissions(user *model.User, permissions ...model.Permission) map[model.Permission]bool {
+	ur, err := GetRoomUserRelation(r.ID, user.ID)
+	if err != nil {
+		// a failed lookup grants none of the permissions
+		m := make(map[model.Permission]bool, len(permissions))
+		for _, p := range permissions {
+			m[p] = false
+		}
+		return m
+	}
+	return ur.HasPermissions(permissions...)
+}
+
+func (r *Room) HasAllPermissions(user *model.User, permissions ...model.Permission) bool {
+	ur, err := GetRoomUserRelation(r.ID, user.ID)
+	if err != nil {
+		return false
+	}
+	for _, p := range permissions {
+		if !ur.HasPermission(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Room) HasAnyPermission(user *model.User, permissions ...model.Permission) bool {
+	ur, err := GetRoomUserRelation(r.ID, user.ID)
+	if err != nil {
+		return false
+	}
+	for _, p := range permissions {
+		if ur.HasPermission(p) {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Room) NeedPassword() bool {
 	return len(r.HashedPassword) != 0
 }
@@ -301,29 +586,173 @@ func (r *Room) SetPassword(password string) error {
 		if err != nil {
 			return err
 		}
+	}
+	if err := db.SetRoomHashedPassword(r.ID, hashedPassword); err != nil {
+		return err
+	}
+	r.setHashedPassword(hashedPassword)
+	roomChanged(r.ID)
+	return nil
+}
+
+// setHashedPassword updates the password in memory, a new password expires the room tokens
+func (r *Room) setHashedPassword(hashedPassword []byte) {
+	if len(hashedPassword) != 0 {
 		atomic.StoreUint32(&r.version, crc32.ChecksumIEEE(hashedPassword))
 	}
 	r.HashedPassword = hashedPassword
-	return db.SetRoomHashedPassword(r.ID, hashedPassword)
+}
+
+func (r *Room) SetSetting(setting model.Setting) error {
+	return r.UpdateSetting(func(s *model.Setting) error {
+		*s = setting
+		return nil
+	})
+}
+
+// UpdateSetting changes a copy of the setting with f, then saves and applies
+// it. Changes are serialized so concurrent ones don't overwrite each other,
+// nothing is changed if f returns an error.
+func (r *Room) UpdateSetting(f func(*model.Setting) error) error {
+	r.settingUpdate.Lock()
+	defer r.settingUpdate.Unlock()
+	old := r.Settings()
+	setting := old
+	if err := f(&setting); err != nil {
+		return err
+	}
+	if err := db.ChangeRoomSetting(r.ID, setting); err != nil {
+		return err
+	}
+	if setting.MemberPermissions() != old.MemberPermissions() {
+		// the cached relations of users who are not members have the old permissions
+		defer removeRoomRelationsCache(r.ID)
+	}
+	r.setSetting(setting)
+	roomChanged(r.ID)
+	return nil
+}
+
+// Settings returns a copy of the setting of the room
+func (r *Room) Settings() model.Setting {
+	r.settingLock.RLock()
+	defer r.settingLock.RUnlock()
+	return r.Setting
+}
+
+// setSetting applies the setting in memory
+func (r *Room) setSetting(setting model.Setting) {
+	r.settingLock.Lock()
+	r.Setting = setting
+	r.settingLock.Unlock()
+	r.chatFilter.Store(nil)
+	if !setting.EnableVoice {
+		r.closeVoice()
+	}
+}
+
+// SetHidden hides or shows the room in the public room list
+func (r *Room) SetHidden(hidden bool) error {
+	return r.UpdateSetting(func(s *model.Setting) error {
+		s.Hidden = hidden
+		return nil
+	})
+}
+
+// SetTags replaces the tags of the room
+func (r *Room) SetTags(names []string) error {
+	tags, err := db.FirstOrCreateTags(names)
+	if err != nil {
+		return err
+	}
+	if err := db.SetRoomTags(r.ID, tags); err != nil {
+		return err
+	}
+	r.Tags = tags
+	roomChanged(r.ID)
+	return nil
+}
+
+func (r *Room) announcementMessage() *ElementMessage {
+	return &ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type:    pb.ElementMessageType_ANNOUNCEMENT,
+			Message: r.Settings().Announcement,
+		},
+	}
+}
+
+// SetAnnouncement saves the announcement and pushes it to the connected clients,
+// an empty announcement clears it
+func (r *Room) SetAnnouncement(announcement string) error {
+	err := r.UpdateSetting(func(s *model.Setting) error {
+		s.Announcement = announcement
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.Broadcast(r.announcementMessage())
+}
+
+// Transfer makes the member userID the creator of the room, the change is
+// recorded in the permission audit as made by actorID
+func (r *Room) Transfer(actorID, userID uint) error {
+	from := r.CreatorID
+	defer removeRoomUserRelationCache(r.ID, from)
+	defer removeRoomUserRelationCache(r.ID, userID)
+	if err := db.TransferRoom(r.ID, actorID, from, userID, r.Settings().MemberPermissions()); err != nil {
+		return err
+	}
+	r.CreatorID = userID
+	roomChanged(r.ID)
+	return nil
 }
 
 func (r *Room) SetUserRole(userID uint, role model.RoomRole) error {
+	defer removeRoomUserRelationCache(r.ID, userID)
 	return db.SetUserRole(r.ID, userID, role)
 }
 
 func (r *Room) SetUserPermission(userID uint, permission model.Permission) error {
+	defer removeRoomUserRelationCache(r.ID, userID)
 	return db.SetUserPermission(r.ID, userID, permission)
 }
 
 func (r *Room) AddUserPermission(userID uint, permission model.Permission) error {
+	defer removeRoomUserRelationCache(r.ID, userID)
 	return db.AddUserPermission(r.ID, userID, permission)
 }
 
 func (r *Room) RemoveUserPermission(userID uint, permission model.Permission) error {
+	defer removeRoomUserRelationCache(r.ID, userID)
 	return db.RemoveUserPermission(r.ID, userID, permission)
 }
 
+// ChangeUserPermission adds and removes permissions of the member userID, and
+// records the change in the permission audit as made by actorID
+func (r *Room) ChangeUserPermission(actorID, userID uint, role model.RolePreset, add, remove model.Permission) error {
+	defer removeRoomUserRelationCache(r.ID, userID)
+	return db.ChangeUserPermission(&model.PermissionAudit{
+		RoomID:   r.ID,
+		ActorID:  actorID,
+		TargetID: userID,
+		Role:     role,
+	}, add, remove)
+}
+
+// ChangeUsersPermission applies the changes of actorID in one transaction, all or none
+func (r *Room) ChangeUsersPermission(actorID uint, changes []model.PermissionChange) error {
+	defer func() {
+		for _, c := range changes {
+			removeRoomUserRelationCache(r.ID, c.UserID)
+		}
+	}()
+	return db.ChangeUsersPermission(r.ID, actorID, changes)
+}
+
 func (r *Room) DeleteUserPermission(userID uint) error {
+	defer removeRoomUserRelationCache(r.ID, userID)
 	return db.DeleteUserPermission(r.ID, userID)
 }
 
@@ -351,21 +780,43 @@ func (r *Room) GetMovieByID(id uint) (*model.Movie, error) {
 	return GetMovieByID(r.ID, id)
 }
 
+// DeleteMovieByID deletes a movie, or a folder with everything in it
 func (r *Room) DeleteMovieByID(id uint) error {
 	r.LazyInit()
-	m, err := LoadAndDeleteMovieByID(r.ID, id)
+	r.movies.Lock()
+	defer r.movies.Unlock()
+	ms, err := r.GetAllMoviesByRoomID()
 	if err != nil {
 		return err
 	}
-	return r.terminateMovie(m)
+	for _, id := range append(descendants(ms, id), id) {
+		if err := deleteSubtitles(db.LoadAndDeleteSubtitlesByMovieID(id)); err != nil {
+			return err
+		}
+		m, err := LoadAndDeleteMovieByID(r.ID, id)
+		if err != nil {
+			return err
+		}
+		if err := r.terminateMovie(m); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *Room) ClearMovies() error {
 	r.LazyInit()
+	r.movies.Lock()
+	defer r.movies.Unlock()
+	if err := deleteSubtitles(db.LoadAndDeleteSubtitlesByRoomID(r.ID)); err != nil {
+		return err
+	}
 	ms, err := db.LoadAndDeleteMoviesByRoomID(r.ID)
 	if err != nil {
 		return err
 	}
+	movieCache.Remove(r.ID)
+	moviesChanged(r.ID)
 	for _, m := range ms {
 		r.terminateMovie(m)
 	}
@@ -373,22 +824,37 @@ func (r *Room) ClearMovies() error {
 }
 
 func (r *Room) Current() *Current {
+	r.LazyInit()
 	c := r.current.Current()
 	return &c
 }
 
+// ChangeCurrentMovie plays a movie, a folder plays from its first movie
 func (r *Room) ChangeCurrentMovie(id uint) error {
 	r.LazyInit()
 	m, err := GetMovieByID(r.ID, id)
 	if err != nil {
 		return err
 	}
+	if m.Folder {
+		ms, err := r.GetAllMoviesByRoomID()
+		if err != nil {
+			return err
+		}
+		order := playOrder(ms, m.ID)
+		if len(order) == 0 {
+			return ErrEmptyFolder
+		}
+		m = order[0]
+	}
 	r.current.SetMovie(*m)
 	return nil
 }
 
 func (r *Room) SwapMoviePositions(id1, id2 uint) error {
 	r.LazyInit()
+	r.movies.Lock()
+	defer r.movies.Unlock()
 	return SwapMoviePositions(r.ID, id1, id2)
 }
 
@@ -396,20 +862,159 @@ func (r *Room) GetMovieWithPullKey(pullKey string) (*model.Movie, error) {
 	return GetMovieWithPullKey(r.ID, pullKey)
 }
 
+var (
+	ErrRoomFull       = errors.New("room is full")
+	ErrRoomNotStarted = errors.New("room has not started yet")
+	ErrNotWhitelisted = errors.New("room is whitelist only")
+)
+
+// CheckWhitelist returns ErrNotWhitelisted if the room is whitelist only
+// and the user is not a member of it, or is banned
+func (r *Room) CheckWhitelist(user *User) error {
+	if !r.Settings().WhitelistOnly {
+		return nil
+	}
+	ur, err := GetRoomUserRelation(r.ID, user.ID)
+	// an unsaved default relation has no id
+	if err != nil || ur.ID == 0 || ur.Role == model.RoomRoleBanned {
+		return ErrNotWhitelisted
+	}
+	return nil
+}
+
+const countdownInterval = 5 * time.Second
+
+// InLobby reports whether the room is scheduled and has not started yet
+func (r *Room) InLobby() bool {
+	return !r.ScheduledAt.IsZero() && time.Now().Before(r.ScheduledAt)
+}
+
+func (r *Room) countdownMessage() *ElementMessage {
+	return &ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type:        pb.ElementMessageType_COUNTDOWN,
+			ScheduledAt: r.ScheduledAt.UnixMilli(),
+			Time:        time.Now().UnixMilli(),
+		},
+	}
+}
+
+// countdown broadcasts the start time to the lobby every few seconds,
+// and once more when the room starts
+func (r *Room) countdown() {
+	ticker := time.NewTicker(countdownInterval)
+	defer ticker.Stop()
+	start := time.NewTimer(time.Until(r.ScheduledAt))
+	defer start.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.Broadcast(r.countdownMessage())
+		case <-start.C:
+			r.Broadcast(r.countdownMessage())
+			return
+		case <-r.hub.exit:
+			return
+		}
+	}
+}
+
+// CheckCapacity returns ErrRoomFull if the user can not join because the room is full,
+// the creator can always join
+func (r *Room) CheckCapacity(user *User) error {
+	if max := r.Settings().MaxClients; max > 0 && user.ID != r.CreatorID && r.PeopleNum() >= max {
+		return ErrRoomFull
+	}
+	return nil
+}
+
 func (r *Room) RegClient(user *User, conn *websocket.Conn) (*Client, error) {
+	if ShuttingDown() {
+		return nil, ErrServerShuttingDown
+	}
 	r.LazyInit()
-	return r.hub.RegClient(newClient(user, r, conn))
+	// warm up the permission cache for this session
+	GetRoomUserRelation(r.ID, user.ID)
+	c, err := r.hub.RegClient(newClient(user, r, conn), func() error {
+		return r.CheckCapacity(user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.touch()
+	r.Greet(c)
+	r.broadcastPresence(user, pb.ElementMessageType_USER_JOINED)
+	return c, nil
+}
+
+// Greet sends the room notices to c, on registration and again
+// once c negotiated the capabilities to read them
+func (r *Room) Greet(c *Client) {
+	if r.InLobby() {
+		c.Send(r.countdownMessage())
+	}
+	if r.Settings().Announcement != "" {
+		c.Send(r.announcementMessage())
+	}
+	if r.PlayMode() != model.PlayModeOrder {
+		c.Send(r.playModeMessage())
+	}
+	if r.current.Subtitle() != 0 {
+		c.Send(r.subtitleMessage())
+	}
+	if c.HasCapability(CapabilitySnapshot) {
+		c.Send(r.snapshotMessage())
+	} else if r.current.Movie().ID != 0 {
+		c.Send(r.tickMessage())
+	}
 }
 
 func (r *Room) UnregisterClient(user *User) error {
 	r.LazyInit()
-	return r.hub.UnRegClient(user)
+	r.touch()
+	if err := r.hub.UnRegClient(user); err != nil {
+		return err
+	}
+	r.LeaveVoice(user)
+	r.broadcastPresence(user, pb.ElementMessageType_USER_LEFT)
+	return nil
+}
+
+// touch records activity in memory for hibernation, and in the database for expiration
+func (r *Room) touch() {
+	now := time.Now()
+	atomic.StoreInt64(&r.lastActive, now.UnixMilli())
+	if err := db.SetRoomLastActive(r.ID, now); err != nil {
+		log.Errorf("set room %s last active failed: %s", r.ID, err.Error())
+	}
 }
 
 func (r *Room) SetStatus(playing bool, seek float64, rate float64, timeDiff float64) Status {
+	r.LazyInit()
 	return r.current.SetStatus(playing, seek, rate, timeDiff)
 }
 
+const (
+	MinRate float64 = 0.25
+	MaxRate float64 = 4
+)
+
+var ErrInvalidRate = fmt.Errorf("rate must be between %g and %g", MinRate, MaxRate)
+
+func ValidRate(rate float64) bool {
+	return rate >= MinRate && rate <= MaxRate
+}
+
+// SetRate changes the playback rate of the room, the position keeps running from the server clock
+func (r *Room) SetRate(rate float64) (Status, error) {
+	if !ValidRate(rate) {
+		return Status{}, ErrInvalidRate
+	}
+	r.LazyInit()
+	return r.current.SetRate(rate), nil
+}
+
 func (r *Room) SetSeekRate(seek float64, rate float64, timeDiff float64) Status {
+	r.LazyInit()
 	return r.current.SetSeekRate(seek, rate, timeDiff)
 }
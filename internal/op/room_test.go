@@ -0,0 +1,1148 @@
+package op_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/storage"
+	"github.com/synctv-org/synctv/internal/subtitle"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+func newTestRoom(t *testing.T, creator *op.User, name string) *op.Room {
+	t.Helper()
+	r, err := creator.CreateRoom(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := op.LoadRoom(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return room
+}
+
+func TestHasPermissions(t *testing.T) {
+	creator := newTestUser(t, "perm-creator")
+	member := newTestUser(t, "perm-member")
+	room := newTestRoom(t, creator, "perm-room")
+
+	if err := db.AddUserToRoom(member.ID, room.ID, model.RoomRoleUser, model.CanCreateMovie|model.CanRenameRoom); err != nil {
+		t.Fatal(err)
+	}
+
+	perms := []model.Permission{model.CanCreateMovie, model.CanRenameRoom, model.CanDeleteRoom}
+
+	var got map[model.Permission]bool
+	n := countQueries(func() {
+		got = member.HasPermissions(room, perms)
+	})
+	if n != 1 {
+		t.Fatalf("HasPermissions() issued %d queries, want 1", n)
+	}
+	want := map[model.Permission]bool{
+		model.CanCreateMovie: true,
+		model.CanRenameRoom:  true,
+		model.CanDeleteRoom:  false,
+	}
+	for p, w := range want {
+		if got[p] != w {
+			t.Errorf("HasPermissions()[%d] = %v, want %v", p, got[p], w)
+		}
+	}
+
+	for p, ok := range creator.HasPermissions(room, perms) {
+		if !ok {
+			t.Errorf("creator should have permission %d", p)
+		}
+	}
+
+	stranger := newTestUser(t, "perm-stranger")
+	failQueries(func() {
+		got = stranger.HasPermissions(room, perms)
+	})
+	if len(got) != len(perms) {
+		t.Errorf("HasPermissions() with a failed lookup = %v, want every permission false", got)
+	}
+	for p, ok := range got {
+		if ok {
+			t.Errorf("permission %d granted with a failed lookup", p)
+		}
+	}
+
+	if !member.HasAllPermissions(room, model.CanCreateMovie, model.CanRenameRoom) {
+		t.Error("HasAllPermissions() = false, want true")
+	}
+	if member.HasAllPermissions(room, model.CanCreateMovie, model.CanDeleteRoom) {
+		t.Error("HasAllPermissions() = true, want false")
+	}
+	if !member.HasAnyPermission(room, model.CanDeleteRoom, model.CanRenameRoom) {
+		t.Error("HasAnyPermission() = false, want true")
+	}
+	if member.HasAnyPermission(room, model.CanDeleteRoom, model.CanSetAdmin) {
+		t.Error("HasAnyPermission() = true, want false")
+	}
+}
+
+func TestPermissionCache(t *testing.T) {
+	creator := newTestUser(t, "cache-creator")
+	member := newTestUser(t, "cache-member")
+	room := newTestRoom(t, creator, "cache-room")
+
+	if err := db.AddUserToRoom(member.ID, room.ID, model.RoomRoleUser, model.DefaultPermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	if member.HasPermission(room, model.CanRenameRoom) {
+		t.Fatal("member should not be able to rename room")
+	}
+	if n := countQueries(func() {
+		member.HasPermission(room, model.CanRenameRoom)
+		member.HasPermission(room, model.CanCreateMovie)
+	}); n != 0 {
+		t.Fatalf("cached permission checks issued %d queries, want 0", n)
+	}
+
+	if err := room.AddUserPermission(member.ID, model.CanRenameRoom); err != nil {
+		t.Fatal(err)
+	}
+	if !member.HasPermission(room, model.CanRenameRoom) {
+		t.Fatal("permission change should invalidate the cache")
+	}
+
+	if err := room.SetUserPermission(member.ID, model.CanRenameRoom); err != nil {
+		t.Fatal(err)
+	}
+	if member.HasPermission(room, model.CanCreateMovie) {
+		t.Fatal("overwritten permissions should not be served from the cache")
+	}
+
+	if err := room.SetUserRole(member.ID, model.RoomRoleBanned); err != nil {
+		t.Fatal(err)
+	}
+	if member.HasPermission(room, model.CanRenameRoom) {
+		t.Fatal("banned member should lose permissions after role change")
+	}
+}
+
+func TestHibernateRoom(t *testing.T) {
+	creator := newTestUser(t, "hibernate-creator")
+	room := newTestRoom(t, creator, "hibernate-room")
+
+	if err := room.AddMovie(creator.NewMovie(model.MovieInfo{
+		BaseMovieInfo: model.BaseMovieInfo{
+			Url:  "https://example.com/movie.mp4",
+			Name: "movie",
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := room.ChangeCurrentMovie(ms[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	room.SetStatus(false, 42, 1.5, 0)
+
+	if err := op.HibernateRoom(room); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.HibernateRoom(room); err == nil {
+		t.Fatal("HibernateRoom() on an unloaded room should fail")
+	}
+
+	reloaded, err := op.GetRoomByID(room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded == room {
+		t.Fatal("hibernated room was not unloaded from memory")
+	}
+	if n := reloaded.ClientNum(); n != 0 {
+		t.Fatalf("ClientNum() = %d, want 0", n)
+	}
+	c := reloaded.Current()
+	if c.Movie.ID != ms[0].ID {
+		t.Fatalf("current movie = %d, want %d", c.Movie.ID, ms[0].ID)
+	}
+	if c.Status.Playing || c.Status.Seek != 42 || c.Status.Rate != 1.5 {
+		t.Fatalf("status = %+v, want paused at 42 with rate 1.5", c.Status)
+	}
+}
+
+func TestHibernateIdleRooms(t *testing.T) {
+	creator := newTestUser(t, "hibernate-idle-creator")
+	room := newTestRoom(t, creator, "hibernate-idle-room")
+
+	op.HibernateIdleRooms(time.Hour)
+	if r, err := op.GetRoomByID(room.ID); err != nil || r != room {
+		t.Fatal("recently active room should not be hibernated")
+	}
+
+	op.HibernateIdleRooms(0)
+	if r, err := op.GetRoomByID(room.ID); err != nil || r == room {
+		t.Fatal("idle room should be hibernated")
+	}
+}
+
+func TestMembers(t *testing.T) {
+	creator := newTestUser(t, "members-creator")
+	member := newTestUser(t, "members-member")
+	room := newTestRoom(t, creator, "members-room")
+
+	if err := room.AddMember(member.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.AddMember(member.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := room.Members()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 {
+		t.Fatalf("Members() returned %d members, want 2", len(ms))
+	}
+	roles := map[string]model.RoomRole{}
+	for _, m := range ms {
+		roles[m.Username] = m.Role
+		if m.Online {
+			t.Fatalf("member %s should be offline", m.Username)
+		}
+	}
+	if roles["members-creator"] != model.RoomRoleCreator || roles["members-member"] != model.RoomRoleUser {
+		t.Fatalf("Members() roles = %v", roles)
+	}
+}
+
+func TestTransferRoom(t *testing.T) {
+	creator := newTestUser(t, "transfer-creator")
+	member := newTestUser(t, "transfer-member")
+	outsider := newTestUser(t, "transfer-outsider")
+	room := newTestRoom(t, creator, "transfer-room")
+
+	if err := member.TransferRoom(room, member.ID); err == nil {
+		t.Fatal("member should not transfer the room")
+	}
+	if err := creator.TransferRoom(room, outsider.ID); err == nil {
+		t.Fatal("room should not be transferred to a non-member")
+	}
+
+	if err := room.AddMember(member.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.SetUserPermission(member.ID, model.AllPermissions); err != nil {
+		t.Fatal(err)
+	}
+	if err := member.TransferRoom(room, member.ID); err == nil {
+		t.Fatal("member holding every permission should not transfer the room")
+	}
+	if err := creator.TransferRoom(room, member.ID); err != nil {
+		t.Fatal(err)
+	}
+	if room.CreatorID != member.ID {
+		t.Fatalf("CreatorID = %d, want %d", room.CreatorID, member.ID)
+	}
+	rel, err := op.GetRoomUserRelation(room.ID, member.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Role != model.RoomRoleCreator {
+		t.Fatalf("new creator role = %d, want %d", rel.Role, model.RoomRoleCreator)
+	}
+	rel, err = op.GetRoomUserRelation(room.ID, creator.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Role != model.RoomRoleUser {
+		t.Fatalf("previous creator role = %d, want %d", rel.Role, model.RoomRoleUser)
+	}
+	if rel.Permissions != room.Setting.MemberPermissions() {
+		t.Fatalf("previous creator permissions = %d, want the member defaults", rel.Permissions)
+	}
+	audits, _, err := room.PermissionAudits(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audits) != 2 || audits[0].TargetID != creator.ID || audits[1].TargetID != member.ID ||
+		audits[0].ActorID != creator.ID || audits[1].After != model.AllPermissions {
+		t.Fatalf("transfer audits = %+v", audits)
+	}
+	if err := creator.TransferRoom(room, creator.ID); err == nil {
+		t.Fatal("previous creator should not transfer the room back")
+	}
+}
+
+func TestConcurrentSettingChanges(t *testing.T) {
+	creator := newTestUser(t, "setting-creator")
+	room := newTestRoom(t, creator, "setting-room")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs <- room.SetHidden(true)
+	}()
+	go func() {
+		defer wg.Done()
+		errs <- room.SetAnnouncement("both changes stay")
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := room.Settings(); !s.Hidden || s.Announcement != "both changes stay" {
+		t.Fatalf("setting = %+v, want hidden with the announcement", s)
+	}
+}
+
+func TestAddMovies(t *testing.T) {
+	creator := newTestUser(t, "import-creator")
+	room := newTestRoom(t, creator, "import-room")
+	movie := func(info model.BaseMovieInfo) model.Movie {
+		return creator.NewMovie(model.MovieInfo{BaseMovieInfo: info})
+	}
+
+	err := room.AddMovies([]model.Movie{
+		movie(model.BaseMovieInfo{Name: "first", Url: "http://example.com/first"}),
+		movie(model.BaseMovieInfo{Name: "folder", Url: "http://example.com/folder", Folder: true}),
+	})
+	var me *op.MovieError
+	if !errors.As(err, &me) || me.Index != 1 {
+		t.Fatalf("AddMovies() = %v, want an error of movie 2", err)
+	}
+	if n, err := room.GetMoviesCount(); err != nil || n != 0 {
+		t.Fatalf("movies after a failed import = %d, %v, want none", n, err)
+	}
+
+	err = room.AddMovies([]model.Movie{
+		movie(model.BaseMovieInfo{Name: "first", Url: "http://example.com/first"}),
+		movie(model.BaseMovieInfo{Name: "second", Url: "http://example.com/second"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 || ms[0].Name != "first" || ms[1].Name != "second" {
+		t.Fatalf("movies = %v, want first and second in order", ms)
+	}
+}
+
+func TestMaxClients(t *testing.T) {
+	creator := newTestUser(t, "full-creator")
+	first := newTestUser(t, "full-first")
+	second := newTestUser(t, "full-second")
+	room := newTestRoom(t, creator, "full-room")
+	room.Setting.MaxClients = 1
+
+	if _, err := room.RegClient(first, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(first)
+
+	if err := room.CheckCapacity(second); !errors.Is(err, op.ErrRoomFull) {
+		t.Fatalf("CheckCapacity() = %v, want %v", err, op.ErrRoomFull)
+	}
+	if _, err := room.RegClient(second, nil); !errors.Is(err, op.ErrRoomFull) {
+		t.Fatalf("RegClient() = %v, want %v", err, op.ErrRoomFull)
+	}
+
+	if _, err := room.RegClient(creator, nil); err != nil {
+		t.Fatalf("creator should always join: %v", err)
+	}
+	defer room.UnregisterClient(creator)
+}
+
+func TestMaxClientsConcurrent(t *testing.T) {
+	creator := newTestUser(t, "race-creator")
+	room := newTestRoom(t, creator, "race-room")
+	room.Setting.MaxClients = 1
+
+	users := make([]*op.User, 8)
+	for i := range users {
+		users[i] = newTestUser(t, fmt.Sprintf("race-user-%d", i))
+	}
+	var (
+		wg     sync.WaitGroup
+		joined atomic.Int64
+	)
+	for _, u := range users {
+		wg.Add(1)
+		go func(u *op.User) {
+			defer wg.Done()
+			if _, err := room.RegClient(u, nil); err == nil {
+				joined.Add(1)
+			} else if !errors.Is(err, op.ErrRoomFull) {
+				t.Error(err)
+			}
+		}(u)
+	}
+	wg.Wait()
+	for _, u := range users {
+		room.UnregisterClient(u)
+	}
+	if n := joined.Load(); n != 1 {
+		t.Fatalf("%d users joined a room for 1, want 1", n)
+	}
+}
+
+func TestSoftDeleteRoom(t *testing.T) {
+	creator := newTestUser(t, "soft-creator")
+	room := newTestRoom(t, creator, "soft-room")
+	purged := newTestRoom(t, creator, "soft-purged")
+
+	for _, r := range []*op.Room{room, purged} {
+		if err := op.SoftDeleteRoom(r); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := op.GetRoomByID(r.ID); err == nil {
+			t.Fatal("soft deleted room should not be loadable")
+		}
+	}
+	if err := db.DB().Unscoped().Model(&model.Room{}).Where("id = ?", purged.ID).
+		Update("deleted_at", time.Now().Add(-48*time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _, err := db.PurgeDeletedRooms(time.Now().Add(-24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("PurgeDeletedRooms() = %d, want 1", n)
+	}
+	if err := op.RestoreRoom(purged.ID); err == nil {
+		t.Fatal("purged room should not be restorable")
+	}
+
+	if err := op.RestoreRoom(room.ID); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := op.GetRoomByID(room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !creator.HasPermission(restored, model.CanDeleteRoom) {
+		t.Fatal("creator should keep permissions after restore")
+	}
+	if restored.Name != "soft-room" {
+		t.Fatalf("restored name = %q, want %q", restored.Name, "soft-room")
+	}
+
+	// the name of a deleted room is free, restoring it then keeps the
+	// name it was deleted under
+	if err := op.SoftDeleteRoom(restored); err != nil {
+		t.Fatal(err)
+	}
+	newTestRoom(t, creator, "soft-room")
+	if err := op.RestoreRoom(room.ID); err != nil {
+		t.Fatal(err)
+	}
+	restored, err = op.GetRoomByID(room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "soft-room#deleted-" + room.ID; restored.Name != want {
+		t.Fatalf("restored name = %q, want %q", restored.Name, want)
+	}
+}
+
+func TestCloneRoom(t *testing.T) {
+	creator := newTestUser(t, "clone-creator")
+	cloner := newTestUser(t, "clone-cloner")
+	src := newTestRoom(t, creator, "clone-src")
+	src.Setting.Hidden = true
+	for _, name := range []string{"first", "second"} {
+		if err := src.AddMovie(creator.NewMovie(model.MovieInfo{
+			BaseMovieInfo: model.BaseMovieInfo{Url: "https://example.com/" + name + ".mp4", Name: name},
+		})); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	bare, err := cloner.CloneRoom(src, "clone-bare", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bare.Setting.Hidden {
+		t.Fatal("setting should be copied")
+	}
+	if ms, err := bare.GetAllMoviesByRoomID(); err != nil {
+		t.Fatal(err)
+	} else if len(ms) != 0 {
+		t.Fatalf("got %d movies, want 0", len(ms))
+	}
+
+	full, err := cloner.CloneRoom(src, "clone-full", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.CreatorID != cloner.ID {
+		t.Fatalf("clone creator = %d, want %d", full.CreatorID, cloner.ID)
+	}
+	ms, err := full.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 || ms[0].Name != "first" || ms[1].Name != "second" {
+		t.Fatalf("playlist not copied in order: %+v", ms)
+	}
+	if ms[0].CreatorID != cloner.ID {
+		t.Fatal("copied movies should belong to the cloner")
+	}
+}
+
+// nextElementMessage returns the next element message sent to c, skipping pings
+func nextElementMessage(t *testing.T, c *op.Client) *op.ElementMessage {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case m := <-c.GetReadChan():
+			if em, ok := m.(*op.ElementMessage); ok {
+				return em
+			}
+		case <-timeout:
+			t.Fatal("no message received")
+		}
+	}
+}
+
+func TestAnnouncement(t *testing.T) {
+	creator := newTestUser(t, "announce-creator")
+	member := newTestUser(t, "announce-member")
+	room := newTestRoom(t, creator, "announce-room")
+
+	c, err := room.RegClient(creator, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(creator)
+	if _, _, err := c.Negotiate(op.ProtocolVersion, []string{op.CapabilityAnnouncement}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := room.SetAnnouncement("movie starts at 8"); err != nil {
+		t.Fatal(err)
+	}
+	if em := nextElementMessage(t, c); em.Type != pb.ElementMessageType_ANNOUNCEMENT || em.Message != "movie starts at 8" {
+		t.Fatalf("connected client got %v, want the announcement", em)
+	}
+
+	joiner, err := room.RegClient(member, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(member)
+	if _, _, err := joiner.Negotiate(op.ProtocolVersion, []string{op.CapabilityAnnouncement}); err != nil {
+		t.Fatal(err)
+	}
+	room.Greet(joiner)
+	if em := nextElementMessage(t, joiner); em.Type != pb.ElementMessageType_ANNOUNCEMENT || em.Message != "movie starts at 8" {
+		t.Fatalf("new joiner got %v, want the announcement", em)
+	}
+
+	r, err := db.GetRoomByID(room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Announcement != "movie starts at 8" {
+		t.Fatalf("announcement not persisted: %q", r.Announcement)
+	}
+}
+
+func TestWhitelistOnly(t *testing.T) {
+	creator := newTestUser(t, "whitelist-creator")
+	member := newTestUser(t, "whitelist-member")
+	stranger := newTestUser(t, "whitelist-stranger")
+	room := newTestRoom(t, creator, "whitelist-room")
+
+	if err := room.CheckWhitelist(stranger); err != nil {
+		t.Fatalf("open room should admit anyone: %v", err)
+	}
+
+	room.Setting.WhitelistOnly = true
+	if err := room.AddMember(member.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*op.User{creator, member} {
+		if err := room.CheckWhitelist(u); err != nil {
+			t.Fatalf("%s should be admitted: %v", u.Username, err)
+		}
+	}
+	if err := room.CheckWhitelist(stranger); !errors.Is(err, op.ErrNotWhitelisted) {
+		t.Fatalf("CheckWhitelist(stranger) = %v, want %v", err, op.ErrNotWhitelisted)
+	}
+}
+
+func TestPlaylist(t *testing.T) {
+	creator := newTestUser(t, "playlist-creator")
+	room := newTestRoom(t, creator, "playlist-room")
+	for _, name := range []string{"a", "b", "c"} {
+		if err := room.AddMovie(creator.NewMovie(model.MovieInfo{BaseMovieInfo: model.BaseMovieInfo{Name: name, Url: "http://example.com/" + name}})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := func(ms []*model.Movie) (s string) {
+		for _, m := range ms {
+			s += m.Name
+		}
+		return
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names(ms) != "abc" || ms[0].Position != 1 || ms[2].Position != 3 {
+		t.Fatalf("playlist = %s, want abc at positions 1 to 3", names(ms))
+	}
+
+	if err := room.SwapMoviePositions(ms[0].ID, ms[2].ID); err != nil {
+		t.Fatal(err)
+	}
+	cached, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.GetAllMoviesByRoomID(room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names(cached) != "cba" || names(stored) != "cba" {
+		t.Fatalf("after swap cached %s, stored %s, want cba", names(cached), names(stored))
+	}
+
+	if err := room.ClearMovies(); err != nil {
+		t.Fatal(err)
+	}
+	if ms, err := room.GetAllMoviesByRoomID(); err != nil || len(ms) != 0 {
+		t.Fatalf("after clear playlist = %d movies, %v, want empty", len(ms), err)
+	}
+}
+
+func TestPlaylistFolders(t *testing.T) {
+	creator := newTestUser(t, "folder-creator")
+	room := newTestRoom(t, creator, "folder-room")
+	for _, m := range []model.BaseMovieInfo{
+		{Name: "season", Folder: true},
+		{Name: "e1", Url: "http://example.com/e1.mp4"},
+		{Name: "e2", Url: "http://example.com/e2.mp4"},
+		{Name: "after", Url: "http://example.com/after.mp4"},
+	} {
+		if err := room.AddMovie(creator.NewMovie(model.MovieInfo{BaseMovieInfo: m})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	season, e1, e2, after := ms[0], ms[1], ms[2], ms[3]
+	for _, m := range []*model.Movie{e1, e2} {
+		if err := room.MoveMovie(m.ID, season.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := room.MoveMovie(season.ID, season.ID); !errors.Is(err, op.ErrFolderCycle) {
+		t.Fatalf("move folder into itself = %v, want ErrFolderCycle", err)
+	}
+	if err := room.MoveMovie(e1.ID, after.ID); !errors.Is(err, op.ErrNotFolder) {
+		t.Fatalf("move into a movie = %v, want ErrNotFolder", err)
+	}
+
+	top, err := room.GetChildMovies(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].ID != season.ID || top[1].ID != after.ID {
+		t.Fatalf("top level = %d movies, want season and after", len(top))
+	}
+	order, err := room.PlayOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 3 || order[0].ID != e1.ID || order[1].ID != e2.ID || order[2].ID != after.ID {
+		t.Fatalf("play order = %d movies, want e1 e2 after", len(order))
+	}
+
+	if err := room.ChangeCurrentMovie(season.ID); err != nil {
+		t.Fatal(err)
+	}
+	if id := room.Current().Movie.ID; id != e1.ID {
+		t.Fatalf("playing folder starts at %d, want e1 %d", id, e1.ID)
+	}
+
+	if err := room.DeleteMovieByID(season.ID); err != nil {
+		t.Fatal(err)
+	}
+	if ms, err := room.GetAllMoviesByRoomID(); err != nil || len(ms) != 1 || ms[0].ID != after.ID {
+		t.Fatalf("after deleting the folder playlist = %d movies, %v, want only after", len(ms), err)
+	}
+}
+
+func TestPlayMode(t *testing.T) {
+	creator := newTestUser(t, "mode-creator")
+	for i, c := range []struct {
+		mode model.PlayMode
+		// index of the movie played after the last one, -1 for none
+		next int
+	}{
+		{model.PlayModeOrder, -1},
+		{model.PlayModeRepeatAll, 0},
+		{model.PlayModeRepeatOne, 2},
+		{model.PlayModeShuffle, -2},
+	} {
+		room := newTestRoom(t, creator, fmt.Sprintf("mode-room-%d", i))
+		room.Setting.AutoNext = true
+		if err := room.SetPlayMode(c.mode); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"a", "b", "c"} {
+			if err := room.AddMovie(creator.NewMovie(model.MovieInfo{BaseMovieInfo: model.BaseMovieInfo{Name: name, Url: "http://example.com/" + name}})); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ms, err := room.GetAllMoviesByRoomID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := ms[2].ID
+		if err := room.ChangeCurrentMovie(last); err != nil {
+			t.Fatal(err)
+		}
+		advanced, err := room.Ended(last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		current := room.Current().Movie.ID
+		switch c.next {
+		case -1:
+			if advanced || current != last {
+				t.Fatalf("%s: advanced to %d, want to stay at the end", c.mode, current)
+			}
+		case -2:
+			if !advanced || current == last {
+				t.Fatalf("%s: advanced to %d, want another movie", c.mode, current)
+			}
+		default:
+			if !advanced || current != ms[c.next].ID {
+				t.Fatalf("%s: advanced to %d, want %d", c.mode, current, ms[c.next].ID)
+			}
+		}
+
+		stored, err := db.GetRoomByID(room.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Setting.PlayMode != c.mode {
+			t.Fatalf("stored play mode = %q, want %q", stored.Setting.PlayMode, c.mode)
+		}
+	}
+}
+
+func TestSetMovieMeta(t *testing.T) {
+	creator := newTestUser(t, "meta-creator")
+	room := newTestRoom(t, creator, "meta-room")
+	if err := room.AddMovie(creator.NewMovie(model.MovieInfo{BaseMovieInfo: model.BaseMovieInfo{Name: "a", Url: "http://example.com/a.mp4"}})); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := model.MovieMeta{Duration: 90.5, Width: 1920, Height: 1080, Codec: "avc1"}
+	if err := op.SetMovieMeta(room.ID, ms[0].ID, meta); err != nil {
+		t.Fatal(err)
+	}
+	if ms[0].Meta != meta {
+		t.Fatalf("cached meta = %+v, want %+v", ms[0].Meta, meta)
+	}
+	stored, err := db.GetAllMoviesByRoomID(room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored[0].Meta != meta {
+		t.Fatalf("stored meta = %+v, want %+v", stored[0].Meta, meta)
+	}
+}
+
+func TestSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	disk, err := storage.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subtitle.Init(disk)
+	defer subtitle.Init(nil)
+
+	creator := newTestUser(t, "subtitle-creator")
+	room := newTestRoom(t, creator, "subtitle-room")
+	for _, name := range []string{"a", "b"} {
+		if err := room.AddMovie(creator.NewMovie(model.MovieInfo{BaseMovieInfo: model.BaseMovieInfo{Name: name, Url: "http://example.com/" + name}})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := room.AddSubtitle(creator.ID, ms[0].ID, "a.srt", []byte("1\n00:00:01,000 --> 00:00:02,000\nhi\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Format != string(subtitle.FormatVTT) {
+		t.Fatalf("format = %s, want srt converted to vtt", s.Format)
+	}
+	if _, data, err := room.GetSubtitle(s.ID); err != nil || !strings.HasPrefix(string(data), "WEBVTT") {
+		t.Fatalf("GetSubtitle() = %q, %v, want a vtt file", data, err)
+	}
+	if _, _, err := room.GetSubtitleByKey(s.Key); err != nil {
+		t.Fatalf("GetSubtitleByKey() = %v", err)
+	}
+	if _, _, err := room.GetSubtitleByKey(strconv.FormatUint(uint64(s.ID), 10)); err == nil {
+		t.Fatal("GetSubtitleByKey() found a subtitle by its id")
+	}
+	if _, err := room.AddSubtitle(creator.ID, ms[0].ID, "a.txt", []byte("hi")); err == nil {
+		t.Fatal("AddSubtitle() of an unknown format succeeded")
+	}
+
+	if err := room.SetSubtitle(s.ID); !errors.Is(err, op.ErrSubtitleNotCurrent) {
+		t.Fatalf("SetSubtitle() of a movie not playing = %v, want %v", err, op.ErrSubtitleNotCurrent)
+	}
+	if err := room.ChangeCurrentMovie(ms[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	seq := room.Current().Status.Seq
+	if err := room.SetSubtitle(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if room.Current().Status.Seq == seq {
+		t.Fatal("SetSubtitle() didn't bump the state seq")
+	}
+	if room.Current().Subtitle != s.ID {
+		t.Fatalf("current subtitle = %d, want %d", room.Current().Subtitle, s.ID)
+	}
+	if err := room.ChangeCurrentMovie(ms[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if room.Subtitle() != 0 {
+		t.Fatalf("subtitle = %d after changing the movie, want 0", room.Subtitle())
+	}
+
+	if err := room.DeleteMovieByID(ms[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := room.GetSubtitle(s.ID); err == nil {
+		t.Fatal("subtitle of a deleted movie found")
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("%d subtitle files left after deleting the movie", len(files))
+	}
+
+	if _, err := room.AddSubtitle(creator.ID, ms[1].ID, "b.vtt", []byte("WEBVTT\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.DeleteRoom(room); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("%d subtitle files left after deleting the room", len(files))
+	}
+}
+
+func TestPresence(t *testing.T) {
+	creator := newTestUser(t, "presence-creator")
+	member := newTestUser(t, "presence-member")
+	room := newTestRoom(t, creator, "presence-room")
+
+	c, err := room.RegClient(creator, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(creator)
+	if _, _, err := c.Negotiate(op.ProtocolVersion, []string{op.CapabilityPresence}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := room.RegClient(member, nil); err != nil {
+		t.Fatal(err)
+	}
+	if em := nextElementMessage(t, c); em.Type != pb.ElementMessageType_USER_JOINED || em.Sender != member.Username {
+		t.Fatalf("got %v, want %s joined", em, member.Username)
+	}
+	if err := room.UnregisterClient(member); err != nil {
+		t.Fatal(err)
+	}
+	if em := nextElementMessage(t, c); em.Type != pb.ElementMessageType_USER_LEFT || em.Sender != member.Username {
+		t.Fatalf("got %v, want %s left", em, member.Username)
+	}
+}
+
+func TestMentions(t *testing.T) {
+	for _, tt := range []struct {
+		message, username string
+		want              bool
+	}{
+		{"hi @bob", "bob", true},
+		{"@bob, look", "bob", true},
+		{"hi @bobby", "bob", false},
+		{"hi @bob_2 and @bob", "bob", true},
+		{"mail bob@example.com", "bob", false},
+		{"hi bob", "bob", false},
+	} {
+		if got := op.Mentions(tt.message, tt.username); got != tt.want {
+			t.Errorf("Mentions(%q, %q) = %v, want %v", tt.message, tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestChatMentionsAndUnread(t *testing.T) {
+	creator := newTestUser(t, "mention-creator")
+	member := newTestUser(t, "mention-member")
+	room := newTestRoom(t, creator, "mention-room")
+
+	c, err := room.RegClient(member, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(member)
+	if _, _, err := c.Negotiate(op.ProtocolVersion, []string{op.CapabilityMention}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := room.RecordChat(creator, "hello")
+	message := "hi @" + member.Username
+	id := room.RecordChat(creator, message)
+	room.NotifyMentions(creator, message, id)
+	if em := nextElementMessage(t, c); em.Type != pb.ElementMessageType_MENTION || em.MessageId != id || em.Sender != creator.Username {
+		t.Fatalf("got %v, want a mention of message %d", em, id)
+	}
+	room.RecordChat(member, "own messages are never unread @"+member.Username)
+	// a longer name starting with the name of the member is not a mention
+	last := room.RecordChat(creator, "hi @"+member.Username+"2")
+
+	if _, unread, mentions, err := room.ChatUnread(member); err != nil || unread != 3 || mentions != 1 {
+		t.Fatalf("unread = %d, mentions = %d, %v, want 3 and 1", unread, mentions, err)
+	}
+	if err := room.MarkChatRead(member.ID, uint(first)); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.MarkChatRead(member.ID, uint(last)); err != nil {
+		t.Fatal(err)
+	}
+	// the read position never moves back
+	if err := room.MarkChatRead(member.ID, uint(first)); err != nil {
+		t.Fatal(err)
+	}
+	lastRead, unread, mentions, err := room.ChatUnread(member)
+	if err != nil || lastRead != uint(last) || unread != 0 || mentions != 0 {
+		t.Fatalf("last read = %d, unread = %d, mentions = %d, %v, want %d, 0 and 0", lastRead, unread, mentions, err, last)
+	}
+}
+
+func TestChatFilter(t *testing.T) {
+	creator := newTestUser(t, "filter-creator")
+	member := newTestUser(t, "filter-member")
+	room := newTestRoom(t, creator, "filter-room")
+
+	op.SetChatFilter(op.NewChatFilter(model.ChatFilter{BlockedWords: []string{"spam"}}))
+	defer op.SetChatFilter(nil)
+
+	if _, err := room.FilterChat(member.ID, "buy SPAM now"); !errors.Is(err, op.ErrChatFiltered) {
+		t.Fatalf("instance wide blocked word: %v, want ErrChatFiltered", err)
+	}
+
+	setting := room.Setting
+	setting.ChatFilter = model.ChatFilter{
+		BlockedWords: []string{"heck"},
+		BlockLinks:   true,
+		Action:       model.ChatFilterReplace,
+	}
+	if err := room.SetSetting(setting); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := room.FilterChat(member.ID, "what the Heck, see https://example.com"); err != nil || got != "what the ****, see [link]" {
+		t.Fatalf("got %q, %v, want the word and the link masked", got, err)
+	}
+
+	setting.ChatFilter = model.ChatFilter{
+		RepeatLimit: 2,
+		Action:      model.ChatFilterMute,
+		MuteSeconds: 60,
+	}
+	if err := room.SetSetting(setting); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := room.FilterChat(member.ID, "again"); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	if _, err := room.FilterChat(member.ID, "Again "); !errors.Is(err, op.ErrChatFiltered) {
+		t.Fatalf("third repeat: %v, want ErrChatFiltered", err)
+	}
+	var muted op.MutedError
+	if err := room.CheckMuted(member.ID); !errors.As(err, &muted) {
+		t.Fatalf("sender not muted: %v", err)
+	}
+}
+
+func TestVoice(t *testing.T) {
+	creator := newTestUser(t, "voice-creator")
+	member := newTestUser(t, "voice-member")
+	room := newTestRoom(t, creator, "voice-room")
+
+	clients := make(map[string]*op.Client, 2)
+	for _, u := range []*op.User{creator, member} {
+		c, err := room.RegClient(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer room.UnregisterClient(u)
+		if _, _, err := c.Negotiate(op.ProtocolVersion, []string{op.CapabilityVoice}); err != nil {
+			t.Fatal(err)
+		}
+		clients[u.Username] = c
+	}
+
+	if _, err := room.JoinVoice(creator); !errors.Is(err, op.ErrVoiceDisabled) {
+		t.Fatalf("join with voice disabled: %v, want ErrVoiceDisabled", err)
+	}
+	setting := room.Setting
+	setting.EnableVoice = true
+	if err := room.SetSetting(setting); err != nil {
+		t.Fatal(err)
+	}
+
+	if peers, err := room.JoinVoice(creator); err != nil || len(peers) != 0 {
+		t.Fatalf("first join = %v, %v, want no peers", peers, err)
+	}
+	// the server connects first
+	if em := nextElementMessage(t, clients[creator.Username]); em.Type != pb.ElementMessageType_VOICE_SIGNAL || em.Voice.GetKind() != "offer" || em.Voice.GetData() == "" {
+		t.Fatalf("got %v, want the offer of the server", em)
+	}
+	if em := nextVoiceEvent(t, clients[member.Username]); em.Type != pb.ElementMessageType_VOICE_JOIN || em.Sender != creator.Username {
+		t.Fatalf("got %v, want %s joined voice", em, creator.Username)
+	}
+	if peers, err := room.JoinVoice(member); err != nil || len(peers) != 1 || peers[0] != creator.Username {
+		t.Fatalf("second join = %v, %v, want the creator", peers, err)
+	}
+	if em := nextVoiceEvent(t, clients[creator.Username]); em.Type != pb.ElementMessageType_VOICE_JOIN || em.Sender != member.Username {
+		t.Fatalf("got %v, want %s joined voice", em, member.Username)
+	}
+
+	// offers only come from the server
+	if err := room.SignalVoice(member, &pb.VoiceSignal{Kind: "offer", Data: "sdp"}); !errors.Is(err, op.ErrInvalidVoiceSignal) {
+		t.Fatalf("offer of a participant: %v, want ErrInvalidVoiceSignal", err)
+	}
+	if err := room.SignalVoice(member, &pb.VoiceSignal{Kind: "candidate", Data: "{"}); !errors.Is(err, op.ErrInvalidVoiceSignal) {
+		t.Fatalf("invalid candidate: %v, want ErrInvalidVoiceSignal", err)
+	}
+
+	if err := room.SetSpeaking(member, true); err != nil {
+		t.Fatal(err)
+	}
+	if em := nextVoiceEvent(t, clients[creator.Username]); em.Type != pb.ElementMessageType_VOICE_SPEAKING || !em.Speaking {
+		t.Fatalf("got %v, want %s speaking", em, member.Username)
+	}
+
+	room.LeaveVoice(member)
+	if em := nextVoiceEvent(t, clients[creator.Username]); em.Type != pb.ElementMessageType_VOICE_LEAVE || em.Sender != member.Username {
+		t.Fatalf("got %v, want %s left voice", em, member.Username)
+	}
+	if err := room.SetSpeaking(member, true); !errors.Is(err, op.ErrNotInVoice) {
+		t.Fatalf("speaking after leaving: %v, want ErrNotInVoice", err)
+	}
+	if err := room.SignalVoice(member, &pb.VoiceSignal{Kind: "candidate", Data: "{}"}); !errors.Is(err, op.ErrNotInVoice) {
+		t.Fatalf("signal after leaving: %v, want ErrNotInVoice", err)
+	}
+	if got := room.VoiceParticipants(); len(got) != 1 || got[0] != creator.Username {
+		t.Fatalf("participants = %v, want the creator", got)
+	}
+}
+
+// nextVoiceEvent skips the signals of the server, which come as the
+// connection is being made
+func nextVoiceEvent(t *testing.T, c *op.Client) *op.ElementMessage {
+	t.Helper()
+	for {
+		if em := nextElementMessage(t, c); em.Type != pb.ElementMessageType_VOICE_SIGNAL {
+			return em
+		}
+	}
+}
+
+func TestNotifyRestart(t *testing.T) {
+	creator := newTestUser(t, "restart-creator")
+	late := newTestUser(t, "restart-late")
+	room := newTestRoom(t, creator, "restart-room")
+	c, err := room.RegClient(creator, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Negotiate(op.ProtocolVersion, []string{op.CapabilityRestart}); err != nil {
+		t.Fatal(err)
+	}
+	defer op.ResetShutdown()
+
+	closeAt := time.Now().Add(time.Minute)
+	if n := op.NotifyRestart(closeAt); n < 1 {
+		t.Fatalf("notified %d clients", n)
+	}
+	for {
+		em := nextElementMessage(t, c)
+		if em.Type == pb.ElementMessageType_SERVER_RESTARTING {
+			if em.Time != closeAt.UnixMilli() {
+				t.Errorf("close time = %d, want %d", em.Time, closeAt.UnixMilli())
+			}
+			break
+		}
+	}
+	if _, err := room.RegClient(late, nil); !errors.Is(err, op.ErrServerShuttingDown) {
+		t.Fatalf("register while shutting down = %v, want %v", err, op.ErrServerShuttingDown)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := op.WaitClients(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait with a client connected = %v", err)
+	}
+	room.UnregisterClient(creator)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := op.WaitClients(ctx); err != nil {
+		t.Fatalf("wait after the clients left = %v", err)
+	}
+}
+
+func TestValidRate(t *testing.T) {
+	for rate, want := range map[float64]bool{0.2: false, op.MinRate: true, 1.5: true, op.MaxRate: true, 4.5: false} {
+		if got := op.ValidRate(rate); got != want {
+			t.Fatalf("ValidRate(%g) = %v, want %v", rate, got, want)
+		}
+	}
+	if msg := op.ErrInvalidRate.Error(); msg != "rate must be between 0.25 and 4" {
+		t.Fatalf("ErrInvalidRate = %q", msg)
+	}
+}
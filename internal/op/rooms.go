@@ -1,16 +1,21 @@
 package op
 
 import (
+	"context"
 	"errors"
 	"hash/crc32"
 	"sync/atomic"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/synctv-org/synctv/internal/db"
 	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/tracing"
 	"github.com/zijiren233/gencontainer/rwmap"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-var roomCache rwmap.RWMap[uint, *Room]
+var roomCache rwmap.RWMap[string, *Room]
 
 func CreateRoom(name, password string, conf ...db.CreateRoomConfig) (*Room, error) {
 	r, err := db.CreateRoom(name, password, conf...)
@@ -30,9 +35,10 @@ func WithVersion(version uint32) RoomConf {
 
 func initRoom(room *model.Room, conf ...RoomConf) (*Room, error) {
 	r := &Room{
-		Room:    *room,
-		version: crc32.ChecksumIEEE(room.HashedPassword),
-		current: newCurrent(),
+		Room:       *room,
+		version:    crc32.ChecksumIEEE(room.HashedPassword),
+		current:    newCurrent(),
+		lastActive: time.Now().UnixMilli(),
 	}
 	for _, c := range conf {
 		c(r)
@@ -51,31 +57,153 @@ func LoadRoom(room *model.Room) (*Room, error) {
 func DeleteRoom(room *Room) error {
 	room.close()
 	roomCache.Delete(room.ID)
-	return db.DeleteRoomByID(room.ID)
+	return deleteRoom(room.ID)
 }
 
-func DeleteRoomByID(id uint) error {
+func DeleteRoomByID(id string) error {
 	r, ok := roomCache.LoadAndDelete(id)
 	if ok {
 		r.close()
 	}
+	return deleteRoom(id)
+}
+
+// deleteRoom hard deletes the room and then the files of its subtitles
+func deleteRoom(id string) error {
+	defer removeRoomRelationsCache(id)
+	defer roomChanged(id)
+
+	keys, err := db.GetSubtitleKeysByRoomIDs([]string{id})
+	if err != nil {
+		return err
+	}
+	if err := db.DeleteRoomByID(id); err != nil {
+		return err
+	}
+	deleteSubtitleFiles(keys)
+	return nil
+}
+
+// SoftDeleteRoom unloads the room and marks it as deleted, see RestoreRoom
+func SoftDeleteRoom(room *Room) error {
+	room.close()
+	roomCache.Delete(room.ID)
+	defer removeRoomRelationsCache(room.ID)
+	defer roomChanged(room.ID)
+	return db.SoftDeleteRoomByID(room.ID)
+}
+
+// RestoreRoom restores a soft deleted room, it is loaded again on next access
+func RestoreRoom(id string) error {
+	return db.RestoreRoom(id)
+}
+
+// HibernateRoom saves the playback state and unloads the room from memory,
+// unlike DeleteRoom the room is loaded again on next access
+func HibernateRoom(room *Room) error {
+	if room.ClientNum() != 0 {
+		return errors.New("room has clients")
+	}
+	if !roomCache.CompareAndDelete(room.ID, room) {
+		return errors.New("room not loaded")
+	}
+	// a room that was never initialized has nothing newer than the saved state
+	if room.initOnce.Done() {
+		if err := room.saveState(); err != nil {
+			roomCache.Store(room.ID, room)
+			return err
+		}
+	}
+	room.close()
+	movieCache.Remove(room.ID)
+	removeRoomRelationsCache(room.ID)
+	return nil
+}
 
-	return db.DeleteRoomByID(r.ID)
+// HibernateIdleRooms hibernates rooms without clients or live channels for at least d,
+// and returns the number of rooms hibernated
+func HibernateIdleRooms(d time.Duration) int {
+	var n int
+	roomCache.Range(func(_ string, r *Room) bool {
+		if !r.idle(d) {
+			return true
+		}
+		if err := HibernateRoom(r); err != nil {
+			log.Errorf("hibernate room %s failed: %s", r.ID, err.Error())
+			return true
+		}
+		n++
+		return true
+	})
+	return n
+}
+
+// SaveRoomStates saves the playback state of the loaded rooms that changed since
+// their last save, so playback resumes there after a restart. It returns the
+// number of rooms saved.
+func SaveRoomStates() int {
+	var n int
+	roomCache.Range(func(_ string, r *Room) bool {
+		if !r.initOnce.Done() || !r.stateChanged() {
+			return true
+		}
+		if err := r.saveState(); err != nil {
+			log.Errorf("save room %s state failed: %s", r.ID, err.Error())
+			return true
+		}
+		n++
+		return true
+	})
+	return n
 }
 
-func GetRoomByID(id uint) (*Room, error) {
+func GetRoomByID(id string) (*Room, error) {
+	return GetRoomByIDContext(context.Background(), id)
+}
+
+// GetRoomByIDContext is GetRoomByID traced as a child of the span of ctx, the
+// span tells whether the room was loaded from the database
+func GetRoomByIDContext(ctx context.Context, id string) (_ *Room, err error) {
+	ctx, span := tracing.Start(ctx, "op.GetRoomByID", attribute.String("room_id", id))
+	defer func() { tracing.End(span, err) }()
 	r2, ok := roomCache.Load(id)
+	span.SetAttributes(attribute.Bool("cached", ok))
 	if ok {
 		return r2, nil
 	}
-	r, err := db.GetRoomByID(id)
+	r, err := db.GetRoomByIDContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	return initRoom(r)
 }
 
-func HasRoom(roomID uint) bool {
+// PeopleNum returns the number of users in the room on every instance
+// without loading it into memory
+func PeopleNum(roomID string) int64 {
+	n, err := peopleNum(roomID)
+	if err != nil {
+		log.Errorf("broker: load room %s presence failed: %s", roomID, err.Error())
+	}
+	return n
+}
+
+// peopleNum counts the users of a room not running here from the presence
+// the other instances share through the broker
+func peopleNum(roomID string) (int64, error) {
+	if r, ok := roomCache.Load(roomID); ok && r.hub != nil {
+		return r.PeopleNum(), nil
+	}
+	c := clusterBroker.Load()
+	if c == nil {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+	return c.peopleNum(ctx, roomID)
+}
+
+func HasRoom(roomID string) bool {
 	_, ok := roomCache.Load(roomID)
 	if ok {
 		return true
@@ -95,7 +223,7 @@ func HasRoomByName(name string) bool {
 	return ok
 }
 
-func SetRoomPassword(roomID uint, password string) error {
+func SetRoomPassword(roomID string, password string) error {
 	r, err := GetRoomByID(roomID)
 	if err != nil {
 		return err
@@ -105,7 +233,7 @@ func SetRoomPassword(roomID uint, password string) error {
 
 func GetAllRooms() []*Room {
 	rooms := make([]*Room, roomCache.Len())
-	roomCache.Range(func(key uint, value *Room) bool {
+	roomCache.Range(func(key string, value *Room) bool {
 		rooms = append(rooms, value)
 		return true
 	})
@@ -114,7 +242,7 @@ func GetAllRooms() []*Room {
 
 func GetAllRoomsWithNoNeedPassword() []*Room {
 	rooms := make([]*Room, roomCache.Len())
-	roomCache.Range(func(key uint, value *Room) bool {
+	roomCache.Range(func(key string, value *Room) bool {
 		if !value.NeedPassword() {
 			rooms = append(rooms, value)
 		}
@@ -125,8 +253,8 @@ func GetAllRoomsWithNoNeedPassword() []*Room {
 
 func GetAllRoomsWithoutHidden() []*Room {
 	rooms := make([]*Room, 0, roomCache.Len())
-	roomCache.Range(func(key uint, value *Room) bool {
-		if !value.Setting.Hidden {
+	roomCache.Range(func(key string, value *Room) bool {
+		if !value.Settings().Hidden {
 			rooms = append(rooms, value)
 		}
 		return true
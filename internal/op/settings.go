@@ -0,0 +1,13 @@
+package op
+
+import "github.com/synctv-org/synctv/internal/settings"
+
+// SetSettings changes the instance settings, see settings.Set, the other
+// instances reload them
+func SetSettings(values map[string]string) error {
+	if err := settings.Set(values); err != nil {
+		return err
+	}
+	publishInvalidation(&BrokerInvalidation{Cache: invalidSettings})
+	return nil
+}
@@ -0,0 +1,76 @@
+package op
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+var ErrServerShuttingDown = errors.New("server is shutting down")
+
+var shuttingDown atomic.Bool
+
+// ShuttingDown reports whether NotifyRestart was called
+func ShuttingDown() bool {
+	return shuttingDown.Load()
+}
+
+// NotifyRestart refuses new clients and tells the connected ones that the
+// server restarts and closes their connections at closeAt, it returns the
+// number of notified clients
+func NotifyRestart(closeAt time.Time) int64 {
+	shuttingDown.Store(true)
+	msg := &ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type: pb.ElementMessageType_SERVER_RESTARTING,
+			Time: closeAt.UnixMilli(),
+		},
+	}
+	var n int64
+	roomCache.Range(func(_ string, r *Room) bool {
+		if c := r.ClientNum(); c > 0 {
+			if err := r.Broadcast(msg, WithSendToSelf()); err == nil {
+				n += c
+			}
+		}
+		return true
+	})
+	return n
+}
+
+// ClientsNum returns the number of clients connected to any room
+func ClientsNum() int64 {
+	var n int64
+	roomCache.Range(func(_ string, r *Room) bool {
+		n += r.ClientNum()
+		return true
+	})
+	return n
+}
+
+// WaitClients waits for every client to disconnect, it returns the error of
+// ctx if some are still connected when it is done
+func WaitClients(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for ClientsNum() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// CloseRooms closes the connections of the clients and the live channels of
+// every loaded room, the rooms stay loaded so their states can be saved
+func CloseRooms() {
+	roomCache.Range(func(_ string, r *Room) bool {
+		r.close()
+		return true
+	})
+}
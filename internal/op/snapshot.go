@@ -0,0 +1,100 @@
+package op
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+// chatTailSize is the number of recent chat messages sent in a snapshot
+const chatTailSize = 50
+
+// chatTail keeps the recent chat messages of a room in memory
+type chatTail struct {
+	lock     sync.Mutex
+	messages []*pb.ElementMessage
+}
+
+func (t *chatTail) add(msg *pb.ElementMessage) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.messages) == chatTailSize {
+		copy(t.messages, t.messages[1:])
+		t.messages = t.messages[:chatTailSize-1]
+	}
+	t.messages = append(t.messages, msg)
+}
+
+func (t *chatTail) remove(messageID uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for i, m := range t.messages {
+		if m.MessageId == messageID {
+			t.messages = append(t.messages[:i], t.messages[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *chatTail) list() []*pb.ElementMessage {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]*pb.ElementMessage(nil), t.messages...)
+}
+
+// RecordChat keeps a chat message for the snapshots of clients connecting later
+// and saves it to the chat history, it returns the id of the saved message
+func (r *Room) RecordChat(user *User, message string) uint64 {
+	msg := &pb.ElementMessage{
+		Type:         pb.ElementMessageType_CHAT_MESSAGE,
+		Sender:       user.Username,
+		SenderName:   user.ShownName(),
+		SenderAvatar: user.Avatar,
+		Message:      message,
+		Time:         time.Now().UnixMilli(),
+	}
+	if !user.IsGuest() {
+		m := &model.ChatMessage{
+			RoomID:  r.ID,
+			UserID:  user.ID,
+			Content: message,
+		}
+		if err := db.CreateChatMessage(m); err != nil {
+			log.Errorf("save room %s chat message failed: %s", r.ID, err.Error())
+		} else {
+			msg.MessageId = uint64(m.ID)
+		}
+	}
+	r.chats.add(msg)
+	return msg.MessageId
+}
+
+// ChatHistory returns up to limit messages sent before the message with id before,
+// 0 for the newest messages, oldest first
+func (r *Room) ChatHistory(before uint, limit int) ([]*model.ChatMessage, error) {
+	return db.GetChatMessages(r.ID, before, limit)
+}
+
+// snapshotMessage is the full state of the room for a client that just connected
+func (r *Room) snapshotMessage() *ElementMessage {
+	c := r.Current()
+	members := r.hub.ClientNames()
+	sort.Strings(members)
+	return &ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type:      pb.ElementMessageType_SNAPSHOT,
+			Current:   c.Proto(),
+			Seq:       c.Status.Seq,
+			PeopleNum: int64(len(members)),
+			Chats:     r.chats.list(),
+			Members:   members,
+			PlayMode:  string(r.PlayMode()),
+			Time:      time.Now().UnixMilli(),
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package op_test
+
+import (
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+func TestSnapshot(t *testing.T) {
+	creator := newTestUser(t, "snapshot-creator")
+	room := newTestRoom(t, creator, "snapshot-room")
+
+	if err := room.AddMovie(creator.NewMovie(model.MovieInfo{
+		BaseMovieInfo: model.BaseMovieInfo{
+			Url:  "https://example.com/movie.mp4",
+			Name: "movie",
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := room.ChangeCurrentMovie(ms[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 60; i++ {
+		room.RecordChat(creator, "hello")
+	}
+	room.RecordChat(creator, "last")
+
+	c, err := room.RegClient(creator, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(creator)
+	if _, _, err := c.Negotiate(op.ProtocolVersion, []string{op.CapabilitySnapshot}); err != nil {
+		t.Fatal(err)
+	}
+	room.Greet(c)
+
+	em := nextElementMessage(t, c)
+	if em.Type != pb.ElementMessageType_SNAPSHOT {
+		t.Fatalf("got %v, want a snapshot", em)
+	}
+	if em.Current.Movie.Id != uint64(ms[0].ID) || em.Current.Movie.Base.Name != "movie" {
+		t.Fatalf("snapshot movie = %v, want the current movie", em.Current.Movie)
+	}
+	if len(em.Chats) != 50 || em.Chats[len(em.Chats)-1].Message != "last" {
+		t.Fatalf("snapshot has %d chats, want the tail of 50 ending with the last one", len(em.Chats))
+	}
+	if len(em.Members) != 1 || em.Members[0] != creator.Username {
+		t.Fatalf("snapshot members = %v, want [%s]", em.Members, creator.Username)
+	}
+}
@@ -0,0 +1,174 @@
+package op
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/subtitle"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+var (
+	ErrSubtitleStorage    = errors.New("subtitles are not enabled")
+	ErrSubtitleNotCurrent = errors.New("subtitle is not a track of the current movie")
+)
+
+// AddSubtitle stores a subtitle file as a track of the movie, srt files are converted to vtt
+func (r *Room) AddSubtitle(creatorID, movieID uint, name string, data []byte) (*model.Subtitle, error) {
+	storage := subtitle.Default()
+	if storage == nil {
+		return nil, ErrSubtitleStorage
+	}
+	m, err := GetMovieByID(r.ID, movieID)
+	if err != nil {
+		return nil, err
+	}
+	if m.Folder {
+		return nil, errors.New("folders can't have subtitles")
+	}
+	format, err := subtitle.Detect(name)
+	if err != nil {
+		return nil, err
+	}
+	format, data, err = subtitle.Normalize(format, data)
+	if err != nil {
+		return nil, err
+	}
+	s := &model.Subtitle{
+		RoomID:    r.ID,
+		MovieID:   m.ID,
+		CreatorID: creatorID,
+		Name:      name,
+		Format:    string(format),
+		Key:       uuid.NewString() + "." + string(format),
+	}
+	if err := storage.Put(s.Key, data); err != nil {
+		return nil, err
+	}
+	if err := db.CreateSubtitle(s); err != nil {
+		storage.Delete(s.Key)
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *Room) GetSubtitles(movieID uint) ([]*model.Subtitle, error) {
+	if _, err := GetMovieByID(r.ID, movieID); err != nil {
+		return nil, err
+	}
+	return db.GetSubtitlesByMovieID(movieID)
+}
+
+// GetSubtitle returns a subtitle track of a movie in the room and its file
+func (r *Room) GetSubtitle(id uint) (*model.Subtitle, []byte, error) {
+	storage := subtitle.Default()
+	if storage == nil {
+		return nil, nil, ErrSubtitleStorage
+	}
+	s, err := db.GetSubtitle(r.ID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := storage.Get(s.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, data, nil
+}
+
+// GetSubtitleByKey returns a subtitle track of the room and its file by the
+// key it is stored under, which can't be guessed like its id
+func (r *Room) GetSubtitleByKey(key string) (*model.Subtitle, []byte, error) {
+	storage := subtitle.Default()
+	if storage == nil {
+		return nil, nil, ErrSubtitleStorage
+	}
+	s, err := db.GetSubtitleByKey(r.ID, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := storage.Get(s.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, data, nil
+}
+
+// DeleteSubtitle removes a subtitle track, clients showing it are told to hide it
+func (r *Room) DeleteSubtitle(id uint) error {
+	s, err := db.LoadAndDeleteSubtitle(r.ID, id)
+	if err != nil {
+		return err
+	}
+	if err := deleteSubtitles([]*model.Subtitle{s}, nil); err != nil {
+		return err
+	}
+	if r.current.Subtitle() == id && r.current.SetSubtitle(s.MovieID, 0) {
+		return r.Broadcast(r.subtitleMessage())
+	}
+	return nil
+}
+
+// deleteSubtitles removes the files of subtitle tracks deleted from the database
+func deleteSubtitles(ss []*model.Subtitle, err error) error {
+	if err != nil {
+		return err
+	}
+	storage := subtitle.Default()
+	if storage == nil {
+		return nil
+	}
+	for _, s := range ss {
+		if err := storage.Delete(s.Key); err != nil {
+			log.Errorf("room %s: delete subtitle %d file failed: %s", s.RoomID, s.ID, err.Error())
+		}
+	}
+	return nil
+}
+
+// deleteSubtitleFiles removes the subtitle files of hard deleted rooms
+func deleteSubtitleFiles(keys []string) {
+	storage := subtitle.Default()
+	if storage == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := storage.Delete(key); err != nil {
+			log.Errorf("delete subtitle file %s failed: %s", key, err.Error())
+		}
+	}
+}
+
+func (r *Room) Subtitle() uint {
+	return r.current.Subtitle()
+}
+
+// SetSubtitle shows a subtitle track of the current movie on every client, 0 hides the subtitles
+func (r *Room) SetSubtitle(id uint) error {
+	movieID := r.current.Movie().ID
+	if id != 0 {
+		s, err := db.GetSubtitle(r.ID, id)
+		if err != nil {
+			return err
+		}
+		if s.MovieID != movieID {
+			return ErrSubtitleNotCurrent
+		}
+	}
+	if !r.current.SetSubtitle(movieID, id) {
+		return ErrSubtitleNotCurrent
+	}
+	return r.Broadcast(r.subtitleMessage())
+}
+
+func (r *Room) subtitleMessage() *ElementMessage {
+	return &ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type:     pb.ElementMessageType_SUBTITLE,
+			Subtitle: uint64(r.current.Subtitle()),
+		},
+	}
+}
@@ -0,0 +1,198 @@
+package op
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/zijiren233/gencontainer/rwmap"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// revokedTokens are the ids of revoked jwts and when they expire, the
+// middleware checks every token against them
+var revokedTokens rwmap.RWMap[string, time.Time]
+
+// LoadRevokedTokens drops expired tokens from the database and loads the revocation list
+func LoadRevokedTokens() error {
+	if err := db.DeleteExpiredTokens(); err != nil {
+		return err
+	}
+	tokens, err := db.GetRevokedTokens()
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		revokedTokens.Store(t.ID, t.ExpiresAt)
+	}
+	return nil
+}
+
+// RevokeToken rejects the jwt with the id until it expires
+func RevokeToken(id string, expiresAt time.Time) error {
+	if id == "" || !expiresAt.After(time.Now()) {
+		return nil
+	}
+	if err := db.CreateRevokedToken(&model.RevokedToken{ID: id, ExpiresAt: expiresAt}); err != nil {
+		return err
+	}
+	revokedTokens.Store(id, expiresAt)
+	publishInvalidation(&BrokerInvalidation{Cache: invalidToken, Token: id, Expires: expiresAt.UnixMilli()})
+	return nil
+}
+
+func IsTokenRevoked(id string) bool {
+	expiresAt, ok := revokedTokens.Load(id)
+	if !ok {
+		return false
+	}
+	if !expiresAt.After(time.Now()) {
+		revokedTokens.Delete(id)
+		return false
+	}
+	return true
+}
+
+// sessionTokenID is the revocation list entry rejecting every token of a session
+func sessionTokenID(sessionID uint) string {
+	return "session:" + strconv.FormatUint(uint64(sessionID), 10)
+}
+
+// IsSessionRevoked reports whether the session of a token was logged out
+func IsSessionRevoked(sessionID uint) bool {
+	return IsTokenRevoked(sessionTokenID(sessionID))
+}
+
+// revokeSession rejects the user and room tokens of the session, they live
+// at most AccessExpire and Expire
+func revokeSession(sessionID uint) error {
+	ttl, err := time.ParseDuration(conf.Conf().Jwt.AccessExpire)
+	if err != nil {
+		return err
+	}
+	room, err := time.ParseDuration(conf.Conf().Jwt.Expire)
+	if err != nil {
+		return err
+	}
+	if room > ttl {
+		ttl = room
+	}
+	return RevokeToken(sessionTokenID(sessionID), time.Now().Add(ttl))
+}
+
+func hashRefreshToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func newRefreshToken() (string, time.Time, error) {
+	ttl, err := time.ParseDuration(conf.Conf().Jwt.RefreshExpire)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), time.Now().Add(ttl), nil
+}
+
+// truncate cuts s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// NewSession records a login of the user from the device and returns the
+// refresh token of the session, only its hash is kept
+func (u *User) NewSession(userAgent, ip string) (*model.UserSession, string, error) {
+	token, expiresAt, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	s := &model.UserSession{
+		UserID:      u.ID,
+		HashedToken: hashRefreshToken(token),
+		UserAgent:   truncate(userAgent, 255),
+		IP:          truncate(ip, 64),
+		LastUsedAt:  now,
+		ExpiresAt:   expiresAt,
+	}
+	if err := db.CreateUserSession(s); err != nil {
+		return nil, "", err
+	}
+	return s, token, nil
+}
+
+// UseRefreshToken returns the user and the session of a refresh token and a
+// new refresh token replacing it, the old one stops working
+func UseRefreshToken(token, userAgent, ip string) (*User, *model.UserSession, string, error) {
+	s, err := db.GetUserSessionByToken(hashRefreshToken(token))
+	if err != nil || !s.ExpiresAt.After(time.Now()) {
+		return nil, nil, "", ErrInvalidRefreshToken
+	}
+	u, err := GetUserById(s.UserID)
+	if err != nil {
+		return nil, nil, "", ErrInvalidRefreshToken
+	}
+	if err := u.CheckBanned(); err != nil {
+		return nil, nil, "", err
+	}
+	next, expiresAt, err := newRefreshToken()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	s.UserAgent = truncate(userAgent, 255)
+	s.IP = truncate(ip, 64)
+	s.LastUsedAt = time.Now()
+	s.ExpiresAt = expiresAt
+	if err := db.RotateUserSessionToken(s, hashRefreshToken(next)); err != nil {
+		return nil, nil, "", ErrInvalidRefreshToken
+	}
+	return u, s, next, nil
+}
+
+func (u *User) Sessions() ([]model.UserSession, error) {
+	return db.GetUserSessions(u.ID)
+}
+
+// DeleteSession logs out a session of the user, its refresh token and its
+// user tokens stop working
+func (u *User) DeleteSession(id uint) error {
+	if err := db.DeleteUserSession(u.ID, id); err != nil {
+		return err
+	}
+	return revokeSession(id)
+}
+
+// RevokeRefreshToken logs out the session of a refresh token of the user
+func (u *User) RevokeRefreshToken(token string) error {
+	s, err := db.GetUserSessionByToken(hashRefreshToken(token))
+	if err != nil || s.UserID != u.ID {
+		return nil
+	}
+	return u.DeleteSession(s.ID)
+}
+
+// LogoutAll invalidates every token and session of the user
+func (u *User) LogoutAll() error {
+	if err := db.RevokeUserTokens(u.ID); err != nil {
+		return err
+	}
+	updateCachedUser(u, func(u *User) {
+		u.TokenVersion++
+	})
+	userChanged(u.ID)
+	return nil
+}
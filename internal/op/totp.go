@@ -0,0 +1,252 @@
+package op
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/proxy"
+	"github.com/synctv-org/synctv/internal/totp"
+	"github.com/zijiren233/gencontainer/rwmap"
+)
+
+var (
+	ErrTwoFactorEnabled         = errors.New("two factor authentication is already enabled")
+	ErrTwoFactorDisabled        = errors.New("two factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled     = errors.New("two factor authentication is not enrolled")
+	ErrInvalidTwoFactorCode     = errors.New("invalid two factor code")
+	ErrInvalidTwoFactorToken    = errors.New("invalid or expired two factor token")
+	ErrTooManyTwoFactorAttempts = errors.New("too many two factor attempts")
+)
+
+const (
+	TwoFactorIssuer = "SyncTV"
+	// RecoveryCodeCount recovery codes are issued when two factor authentication is enabled
+	RecoveryCodeCount = 10
+
+	// a user gets twoFactorBurst code attempts, refilled one per
+	// twoFactorInterval, a valid code gives them all back
+	twoFactorBurst    = 5
+	twoFactorInterval = time.Minute
+	// twoFactorTokenTTL is how long a user has to enter the code after the first login step
+	twoFactorTokenTTL = 5 * time.Minute
+)
+
+var twoFactorLimiters rwmap.RWMap[uint, *proxy.Limiter]
+
+// EnrollTwoFactor stores a new pending secret and returns the otpauth uri of
+// it, two factor authentication is on once ConfirmTwoFactor checks a code
+func (u *User) EnrollTwoFactor() (string, error) {
+	if u.TOTPEnabled {
+		return "", ErrTwoFactorEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := db.SetUserTOTPSecret(u.ID, secret); err != nil {
+		return "", err
+	}
+	updateCachedUser(u, func(u *User) {
+		u.TOTPSecret = secret
+	})
+	userChanged(u.ID)
+	return totp.URI(TwoFactorIssuer, u.Username, secret), nil
+}
+
+// ConfirmTwoFactor enables two factor authentication when code matches the
+// pending secret and returns the recovery codes, they are only shown once
+func (u *User) ConfirmTwoFactor(code string) ([]string, error) {
+	if u.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if u.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if !u.allowTwoFactorAttempt() {
+		return nil, ErrTooManyTwoFactorAttempts
+	}
+	step, ok := totp.Validate(u.TOTPSecret, code, time.Now(), 0)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	codes, hashed, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.EnableUserTOTP(u.ID, step, hashed); err != nil {
+		return nil, err
+	}
+	twoFactorLimiters.Delete(u.ID)
+	updateCachedUser(u, func(u *User) {
+		u.TOTPEnabled = true
+		u.TOTPLastStep = step
+	})
+	userChanged(u.ID)
+	return codes, nil
+}
+
+// DisableTwoFactor turns two factor authentication off, it takes a code or a recovery code
+func (u *User) DisableTwoFactor(code string) error {
+	if !u.TOTPEnabled {
+		return ErrTwoFactorDisabled
+	}
+	if err := u.CheckTwoFactor(code); err != nil {
+		return err
+	}
+	if err := db.DisableUserTOTP(u.ID); err != nil {
+		return err
+	}
+	updateCachedUser(u, func(u *User) {
+		u.TOTPSecret = ""
+		u.TOTPEnabled = false
+		u.TOTPLastStep = 0
+	})
+	userChanged(u.ID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, it takes a code
+func (u *User) RegenerateRecoveryCodes(code string) ([]string, error) {
+	if !u.TOTPEnabled {
+		return nil, ErrTwoFactorDisabled
+	}
+	if err := u.CheckTwoFactor(code); err != nil {
+		return nil, err
+	}
+	codes, hashed, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	return codes, db.SetRecoveryCodes(u.ID, hashed)
+}
+
+// CheckTwoFactor accepts a code of the authenticator app or an unused
+// recovery code, each works only once
+func (u *User) CheckTwoFactor(code string) error {
+	if !u.TOTPEnabled {
+		return ErrTwoFactorDisabled
+	}
+	if !u.allowTwoFactorAttempt() {
+		return ErrTooManyTwoFactorAttempts
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(u.TOTPSecret, code, time.Now(), u.TOTPLastStep)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		ok, err := db.SetUserTOTPLastStep(u.ID, step)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		twoFactorLimiters.Delete(u.ID)
+		updateCachedUser(u, func(u *User) {
+			u.TOTPLastStep = step
+		})
+		return nil
+	}
+	ok, err := db.UseRecoveryCode(u.ID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	twoFactorLimiters.Delete(u.ID)
+	return nil
+}
+
+func (u *User) RecoveryCodesLeft() (int64, error) {
+	return db.CountRecoveryCodes(u.ID)
+}
+
+func (u *User) allowTwoFactorAttempt() bool {
+	l, _ := twoFactorLimiters.LoadOrStore(u.ID, proxy.NewBurstLimiter(twoFactorBurst, twoFactorInterval))
+	return l.Allow()
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns codes like "abcde-fghij" and their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashed := make([]string, RecoveryCodeCount)
+	b := make([]byte, 25*RecoveryCodeCount/4)
+	if _, err := rand.Read(b); err != nil {
+		return nil, nil, err
+	}
+	s := strings.ToLower(recoveryEncoding.EncodeToString(b))
+	for i := range codes {
+		c := s[i*10 : i*10+10]
+		codes[i] = c[:5] + "-" + c[5:]
+		hashed[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashed, nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	h := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(h[:])
+}
+
+// twoFactorTokenKey signs the tokens of the second login step, it differs
+// from the jwt secret so they never pass as login tokens
+func twoFactorTokenKey() []byte {
+	h := sha256.Sum256([]byte(conf.Conf().Jwt.Secret + "\x00two-factor"))
+	return h[:]
+}
+
+type twoFactorClaims struct {
+	UserID uint `json:"u"`
+	jwt.RegisteredClaims
+}
+
+// NewTwoFactorToken is issued in place of a login token to users with two
+// factor authentication, VerifyTwoFactorLogin trades it and a code for the user
+func NewTwoFactorToken(u *User) (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, &twoFactorClaims{
+		UserID: u.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorTokenTTL)),
+		},
+	}).SignedString(twoFactorTokenKey())
+}
+
+// VerifyTwoFactorLogin returns the user of the token when code is valid
+func VerifyTwoFactorLogin(token, code string) (*User, error) {
+	t, err := jwt.ParseWithClaims(token, &twoFactorClaims{}, func(t *jwt.Token) (any, error) {
+		return twoFactorTokenKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, ErrInvalidTwoFactorToken
+	}
+	claims, ok := t.Claims.(*twoFactorClaims)
+	if !ok || !t.Valid {
+		return nil, ErrInvalidTwoFactorToken
+	}
+	u, err := GetUserById(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidTwoFactorToken
+	}
+	if err := u.CheckBanned(); err != nil {
+		return nil, err
+	}
+	if err := u.CheckTwoFactor(code); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -1,18 +1,83 @@
 package op
 
 import (
+	"context"
 	"errors"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/synctv-org/synctv/internal/conf"
 	"github.com/synctv-org/synctv/internal/db"
 	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/settings"
+	"github.com/synctv-org/synctv/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrTermsNotAccepted   = errors.New("terms not accepted")
+	ErrTermsVersionChange = errors.New("terms version has changed")
+	ErrAccountTooNew      = errors.New("account is too new to create room")
+	ErrCreateRoomDisabled = errors.New("room creation is disabled")
+	ErrNoPermission       = errors.New("no permission")
+	ErrGrantPermission    = errors.New("can not grant permissions you do not have")
+	ErrCreatorPermission  = errors.New("the permissions of the room creator can't be changed")
+	ErrTargetPermission   = errors.New("can not change a member who has permissions you do not have")
+	ErrUserNotConnected   = errors.New("user is not connected to the room")
 )
 
 type User struct {
 	model.User
+	// guests have no permission in any room
+	guest bool
 }
 
 func (u *User) CreateRoom(name, password string, conf ...db.CreateRoomConfig) (*model.Room, error) {
-	return db.CreateRoom(name, password, append(conf, db.WithCreator(&u.User))...)
+	return u.CreateRoomContext(context.Background(), name, password, conf...)
+}
+
+// CreateRoomContext is CreateRoom traced as a child of the span of ctx
+func (u *User) CreateRoomContext(ctx context.Context, name, password string, conf ...db.CreateRoomConfig) (r *model.Room, err error) {
+	ctx, span := tracing.Start(ctx, "op.CreateRoom", attribute.Int64("user_id", int64(u.ID)))
+	defer func() { tracing.End(span, err) }()
+	if err := u.CheckTerms(); err != nil {
+		return nil, err
+	}
+	if err := u.CheckAccountAge(); err != nil {
+		return nil, err
+	}
+	if !u.IsAdmin() && settings.DisableCreateRoom.Get() {
+		return nil, ErrCreateRoomDisabled
+	}
+	return db.CreateRoomWithQuotaContext(ctx, u.MaxRooms(), name, password, append(conf, db.WithCreator(&u.User))...)
+}
+
+// CloneRoom creates a room owned by u with the settings of src,
+// and with a copy of its playlist if withMovies is true
+func (u *User) CloneRoom(src *Room, name, password string, withMovies bool) (*Room, error) {
+	conf := []db.CreateRoomConfig{db.WithSetting(src.Settings()), db.WithTags(src.Tags)}
+	if withMovies {
+		ms, err := src.GetAllMoviesByRoomID()
+		if err != nil {
+			return nil, err
+		}
+		movies := make([]model.Movie, 0, len(ms))
+		for _, m := range ms {
+			movie := u.NewMovie(model.MovieInfo{BaseMovieInfo: m.BaseMovieInfo})
+			movie.Position = m.Position
+			if movie.Live && movie.RtmpSource {
+				// the publish key of the source room must not be shared
+				movie.PullKey = uuid.NewString()
+			}
+			movies = append(movies, movie)
+		}
+		conf = append(conf, db.WithMovies(movies))
+	}
+	r, err := u.CreateRoom(name, password, conf...)
+	if err != nil {
+		return nil, err
+	}
+	return LoadRoom(r)
 }
 
 func (u *User) NewMovie(movie model.MovieInfo) model.Movie {
@@ -22,13 +87,253 @@ func (u *User) NewMovie(movie model.MovieInfo) model.Movie {
 	}
 }
 
+// CheckEditMovies returns ErrNoPermission unless u created the movies ids or has CanEditUserMovies
+func (u *User) CheckEditMovies(room *Room, ids ...uint) error {
+	return u.checkMovieCreators(room, model.CanEditUserMovies, false, ids)
+}
+
+// CheckDeleteMovies returns ErrNoPermission unless u created the movies ids
+// and everything in the folders among them, or has CanDeleteUserMovies
+func (u *User) CheckDeleteMovies(room *Room, ids ...uint) error {
+	return u.checkMovieCreators(room, model.CanDeleteUserMovies, true, ids)
+}
+
+func (u *User) checkMovieCreators(room *Room, permission model.Permission, recursive bool, ids []uint) error {
+	if u.HasPermission(room, permission) {
+		return nil
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		return err
+	}
+	creators := make(map[uint]uint, len(ms))
+	for _, m := range ms {
+		creators[m.ID] = m.CreatorID
+	}
+	for _, id := range ids {
+		checked := []uint{id}
+		if recursive {
+			checked = append(descendants(ms, id), id)
+		}
+		for _, id := range checked {
+			// unknown ids are left to fail where they are used
+			if creator, ok := creators[id]; ok && creator != u.ID {
+				return ErrNoPermission
+			}
+		}
+	}
+	return nil
+}
+
 func (u *User) HasPermission(room *Room, permission model.Permission) bool {
+	if u.guest {
+		return false
+	}
 	return room.HasPermission(&u.User, permission)
 }
 
+func (u *User) HasPermissions(room *Room, permissions []model.Permission) map[model.Permission]bool {
+	if u.guest {
+		m := make(map[model.Permission]bool, len(permissions))
+		for _, p := range permissions {
+			m[p] = false
+		}
+		return m
+	}
+	return room.HasPermissions(&u.User, permissions...)
+}
+
+func (u *User) HasAllPermissions(room *Room, permissions ...model.Permission) bool {
+	if u.guest {
+		return false
+	}
+	return room.HasAllPermissions(&u.User, permissions...)
+}
+
+func (u *User) HasAnyPermission(room *Room, permissions ...model.Permission) bool {
+	if u.guest {
+		return false
+	}
+	return room.HasAnyPermission(&u.User, permissions...)
+}
+
 func (u *User) DeleteRoom(room *Room) error {
 	if !u.HasPermission(room, model.CanDeleteRoom) {
-		return errors.New("no permission")
+		return ErrNoPermission
 	}
 	return DeleteRoom(room)
 }
+
+// TransferRoom makes the member userID the creator of the room, only the
+// creator and admins can give a room away
+func (u *User) TransferRoom(room *Room, userID uint) error {
+	if u.ID != room.CreatorID && !u.IsAdmin() {
+		return ErrNoPermission
+	}
+	if userID == room.CreatorID {
+		return errors.New("user is already the creator")
+	}
+	return room.Transfer(u.ID, userID)
+}
+
+// ChangeUserPermission grants add and revokes remove from the member userID of
+// the room, u can only grant or revoke permissions it has itself
+func (u *User) ChangeUserPermission(room *Room, userID uint, add, remove model.Permission) error {
+	return u.changeUserPermission(room, userID, "", add, remove)
+}
+
+func (u *User) changeUserPermission(room *Room, userID uint, role model.RolePreset, add, remove model.Permission) error {
+	if !u.HasPermission(room, model.CanSetUserPermission) {
+		return ErrNoPermission
+	}
+	if !u.HasPermission(room, add|remove) {
+		return ErrGrantPermission
+	}
+	if userID == room.CreatorID {
+		return ErrCreatorPermission
+	}
+	if err := u.checkTargetPermission(room, userID); err != nil {
+		return err
+	}
+	return room.ChangeUserPermission(u.ID, userID, role, add, remove)
+}
+
+// checkTargetPermission returns ErrTargetPermission unless u has every
+// permission of the member userID, so members can't change those above them
+func (u *User) checkTargetPermission(room *Room, userID uint) error {
+	ur, err := GetRoomUserRelation(room.ID, userID)
+	if err != nil {
+		return err
+	}
+	if !u.HasPermission(room, ur.Permissions) {
+		return ErrTargetPermission
+	}
+	return nil
+}
+
+// ChangeUsersPermission applies the changes to members of the room at once,
+// with the checks of ChangeUserPermission on every change
+func (u *User) ChangeUsersPermission(room *Room, changes []model.PermissionChange) error {
+	if !u.HasPermission(room, model.CanSetUserPermission) {
+		return ErrNoPermission
+	}
+	var changed model.Permission
+	for _, c := range changes {
+		if c.UserID == room.CreatorID {
+			return ErrCreatorPermission
+		}
+		if err := u.checkTargetPermission(room, c.UserID); err != nil {
+			return err
+		}
+		changed |= c.Add | c.Remove
+	}
+	if !u.HasPermission(room, changed) {
+		return ErrGrantPermission
+	}
+	return room.ChangeUsersPermission(u.ID, changes)
+}
+
+// AssignRole gives the member userID the permissions of the role preset, with
+// the checks of ChangeUserPermission on the permissions it grants and revokes
+func (u *User) AssignRole(room *Room, userID uint, role model.RolePreset) error {
+	ur, err := GetRoomUserRelation(room.ID, userID)
+	if err != nil {
+		return err
+	}
+	p := role.Permissions()
+	return u.changeUserPermission(room, userID, role, p&^ur.Permissions, ur.Permissions&^p)
+}
+
+// SetDefaultPermissions changes the permissions users get when they join the
+// room, u can only grant or revoke permissions it has itself
+func (u *User) SetDefaultPermissions(room *Room, permissions model.Permission) error {
+	if !u.HasPermission(room, model.CanSetDefaultPermission) {
+		return ErrNoPermission
+	}
+	var before model.Permission
+	err := room.UpdateSetting(func(s *model.Setting) error {
+		before = s.MemberPermissions()
+		if !u.HasPermission(room, permissions^before) {
+			return ErrGrantPermission
+		}
+		s.DefaultPermissions = &permissions
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return db.CreatePermissionAudit(&model.PermissionAudit{
+		RoomID:  room.ID,
+		ActorID: u.ID,
+		Before:  before,
+		After:   permissions,
+	})
+}
+
+// CheckAccountAge returns ErrAccountTooNew if the account is younger than the configured minimum age
+func (u *User) CheckAccountAge() error {
+	if u.IsAdmin() || conf.Conf().Room.MinAccountAge == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(conf.Conf().Room.MinAccountAge)
+	if err != nil {
+		return err
+	}
+	if d > 0 && time.Since(u.CreatedAt) < d {
+		return ErrAccountTooNew
+	}
+	return nil
+}
+
+// MaxRooms returns the number of rooms the user may create, 0 for unlimited.
+// It is the quota an admin set for the user, else max_rooms_per_user for
+// users other than admins.
+func (u *User) MaxRooms() int64 {
+	if u.RoomQuota != nil {
+		return *u.RoomQuota
+	}
+	if u.IsAdmin() {
+		return 0
+	}
+	return settings.MaxRoomsPerUser.Get()
+}
+
+// SetUserRoomQuota overrides the room quota of target on behalf of u,
+// nil restores the instance default
+func (u *User) SetUserRoomQuota(target *User, quota *int64) error {
+	if !u.CanManage(target) {
+		return ErrCannotManage
+	}
+	if err := db.SetUserRoomQuota(target.ID, quota); err != nil {
+		return err
+	}
+	target.RoomQuota = quota
+	userChanged(target.ID)
+	return nil
+}
+
+func (u *User) NeedAcceptTerms() bool {
+	return conf.Conf().Terms.Enable && !u.HasAcceptedTerms(conf.Conf().Terms.Version)
+}
+
+func (u *User) CheckTerms() error {
+	if u.NeedAcceptTerms() {
+		return ErrTermsNotAccepted
+	}
+	return nil
+}
+
+func (u *User) AcceptTerms(version string) error {
+	if version != conf.Conf().Terms.Version {
+		return ErrTermsVersionChange
+	}
+	err := db.SetUserTermsVersion(u.ID, version)
+	if err != nil {
+		return err
+	}
+	updateCachedUser(u, func(u *User) {
+		u.TermsVersion = version
+	})
+	userChanged(u.ID)
+	return nil
+}
@@ -0,0 +1,449 @@
+package op_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/provider"
+	"github.com/synctv-org/synctv/internal/storage"
+	"github.com/synctv-org/synctv/internal/subtitle"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+func TestTermsGate(t *testing.T) {
+	conf.Conf().Terms.Enable = true
+	conf.Conf().Terms.Version = "1"
+	defer func() {
+		conf.Conf().Terms = conf.DefaultTermsConfig()
+	}()
+
+	u := newTestUser(t, "terms-gate")
+
+	if !u.NeedAcceptTerms() {
+		t.Fatal("new user should need to accept terms")
+	}
+	if _, err := u.CreateRoom("terms-gate-1", ""); !errors.Is(err, op.ErrTermsNotAccepted) {
+		t.Fatalf("CreateRoom() error = %v, want %v", err, op.ErrTermsNotAccepted)
+	}
+
+	if err := u.AcceptTerms("0"); !errors.Is(err, op.ErrTermsVersionChange) {
+		t.Fatalf("AcceptTerms() with stale version error = %v, want %v", err, op.ErrTermsVersionChange)
+	}
+	if err := u.AcceptTerms("1"); err != nil {
+		t.Fatal(err)
+	}
+	// the cached user is replaced, not changed in place
+	if !u.NeedAcceptTerms() {
+		t.Fatal("accepting terms changed the cached user in place")
+	}
+	u, err := op.GetUserById(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.CreateRoom("terms-gate-1", ""); err != nil {
+		t.Fatalf("CreateRoom() after accepting terms error = %v", err)
+	}
+
+	u2, err := op.GetUserByUsername("terms-gate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u2.NeedAcceptTerms() {
+		t.Fatal("accepted terms version should be persisted")
+	}
+}
+
+func TestTermsGateVersionBump(t *testing.T) {
+	conf.Conf().Terms.Enable = true
+	conf.Conf().Terms.Version = "1"
+	defer func() {
+		conf.Conf().Terms = conf.DefaultTermsConfig()
+	}()
+
+	u := newTestUser(t, "terms-bump")
+	if err := u.AcceptTerms("1"); err != nil {
+		t.Fatal(err)
+	}
+	u, err := op.GetUserById(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.CheckTerms(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Conf().Terms.Version = "2"
+	if err := u.CheckTerms(); !errors.Is(err, op.ErrTermsNotAccepted) {
+		t.Fatalf("CheckTerms() after version bump error = %v, want %v", err, op.ErrTermsNotAccepted)
+	}
+	if _, err := u.CreateRoom("terms-bump-1", ""); !errors.Is(err, op.ErrTermsNotAccepted) {
+		t.Fatalf("CreateRoom() after version bump error = %v, want %v", err, op.ErrTermsNotAccepted)
+	}
+
+	if err := u.AcceptTerms("2"); err != nil {
+		t.Fatal(err)
+	}
+	if u, err = op.GetUserById(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.CheckTerms(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Conf().Terms.Enable = false
+	conf.Conf().Terms.Version = "3"
+	if err := u.CheckTerms(); err != nil {
+		t.Fatalf("CheckTerms() with gate disabled error = %v", err)
+	}
+}
+
+func TestMinAccountAge(t *testing.T) {
+	conf.Conf().Room.MinAccountAge = "24h"
+	defer func() {
+		conf.Conf().Room = conf.DefaultRoomConfig()
+	}()
+
+	u := newTestUser(t, "account-age-new")
+	if _, err := u.CreateRoom("account-age-new", ""); !errors.Is(err, op.ErrAccountTooNew) {
+		t.Fatalf("CreateRoom() with new account error = %v, want %v", err, op.ErrAccountTooNew)
+	}
+
+	u.CreatedAt = time.Now().Add(-25 * time.Hour)
+	if _, err := u.CreateRoom("account-age-old", ""); err != nil {
+		t.Fatalf("CreateRoom() with old account error = %v", err)
+	}
+
+	admin := newTestUser(t, "account-age-admin")
+	admin.Role = model.RoleAdmin
+	if _, err := admin.CreateRoom("account-age-admin", ""); err != nil {
+		t.Fatalf("CreateRoom() by admin error = %v", err)
+	}
+
+	conf.Conf().Room.MinAccountAge = "0"
+	if _, err := newTestUser(t, "account-age-disabled").CreateRoom("account-age-disabled", ""); err != nil {
+		t.Fatalf("CreateRoom() with check disabled error = %v", err)
+	}
+}
+
+func TestDirectMessages(t *testing.T) {
+	host := newTestUser(t, "dm-host")
+	member := newTestUser(t, "dm-member")
+	stranger := newTestUser(t, "dm-stranger")
+	room := newTestRoom(t, host, "dm-room")
+	if err := db.AddUserToRoom(member.ID, room.ID, model.RoomRoleUser, model.DefaultPermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := room.RegClient(member, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(member)
+	if _, _, err := c.Negotiate(op.ProtocolVersion, []string{op.CapabilityDirect}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := host.SendDirectMessage(member, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if em := nextElementMessage(t, c); em.Type != pb.ElementMessageType_DIRECT_MESSAGE || em.Sender != host.Username || em.MessageId != uint64(msg.ID) {
+		t.Fatalf("got %v, want the direct message %d", em, msg.ID)
+	}
+	if _, err := stranger.SendDirectMessage(member, "hi"); !errors.Is(err, op.ErrNoSharedRoom) {
+		t.Fatalf("message from a stranger: %v, want ErrNoSharedRoom", err)
+	}
+	if _, err := member.SendDirectMessage(host, "hi back"); err != nil {
+		t.Fatal(err)
+	}
+
+	unread, err := member.UnreadDirectMessages()
+	if err != nil || len(unread) != 1 || unread[host.ID] != 1 {
+		t.Fatalf("unread = %v, %v, want one from the host", unread, err)
+	}
+	if err := member.ReadDirectMessages(host.ID); err != nil {
+		t.Fatal(err)
+	}
+	if unread, err := member.UnreadDirectMessages(); err != nil || len(unread) != 0 {
+		t.Fatalf("unread after reading = %v, %v, want none", unread, err)
+	}
+
+	messages, err := host.DirectMessages(member.ID, 0, 10)
+	if err != nil || len(messages) != 2 || messages[0].Content != "hello" || messages[1].Content != "hi back" {
+		t.Fatalf("conversation = %v, %v, want both messages oldest first", messages, err)
+	}
+}
+
+func TestLinkProviders(t *testing.T) {
+	u := newTestUser(t, "link-user")
+	other := newTestUser(t, "link-other")
+	google := &provider.UserInfo{ProviderUserID: "google-link-user"}
+
+	if err := u.UnlinkProvider("github"); !errors.Is(err, op.ErrLastLoginMethod) {
+		t.Fatalf("unlink the only provider: %v, want ErrLastLoginMethod", err)
+	}
+	if err := u.LinkProvider("google", google); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.LinkProvider("google", google); err != nil {
+		t.Fatalf("linking the same account again: %v, want no-op", err)
+	}
+	if err := u.LinkProvider("google", &provider.UserInfo{ProviderUserID: "google-second"}); !errors.Is(err, op.ErrProviderAlreadyLinked) {
+		t.Fatalf("second google account: %v, want ErrProviderAlreadyLinked", err)
+	}
+	if err := other.LinkProvider("google", google); !errors.Is(err, op.ErrProviderLinkedToOther) {
+		t.Fatalf("account of another user: %v, want ErrProviderLinkedToOther", err)
+	}
+	if owner, err := op.CreateOrLoadUserWithProvider("google", google); err != nil || owner.ID != u.ID {
+		t.Fatalf("login with the linked account = %v, %v, want %d", owner, err, u.ID)
+	}
+
+	if err := u.UnlinkProvider("github"); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.UnlinkProvider("github"); !errors.Is(err, op.ErrProviderNotLinked) {
+		t.Fatalf("unlink twice: %v, want ErrProviderNotLinked", err)
+	}
+	if err := u.UnlinkProvider("google"); !errors.Is(err, op.ErrLastLoginMethod) {
+		t.Fatalf("unlink the last provider: %v, want ErrLastLoginMethod", err)
+	}
+	providers, err := u.Providers()
+	if err != nil || len(providers) != 1 || providers[0].Provider != "google" {
+		t.Fatalf("providers = %v, %v, want google", providers, err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	disk, err := storage.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.Init(disk)
+	defer storage.Init(nil)
+
+	u := newTestUser(t, "profile-user")
+	if u.ShownName() != u.Username {
+		t.Fatalf("shown name = %q, want the username", u.ShownName())
+	}
+	cached := u
+	u, err = u.UpdateProfile("Profile", "https://example.com/a.png", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ShownName() != "Profile" {
+		t.Fatalf("shown name = %q, want Profile", u.ShownName())
+	}
+	if cached.DisplayName != "" {
+		t.Fatalf("the update changed the cached user in place: %q", cached.DisplayName)
+	}
+	if got, err := op.GetUserById(u.ID); err != nil || got != u {
+		t.Fatalf("cached user = %p, %v, want the updated copy %p", got, err, u)
+	}
+	if _, err := u.UpdateProfile("Profile", op.AvatarURLPrefix+"avatar-1-other.png", "hi"); err == nil {
+		t.Fatal("set the uploaded avatar of another user")
+	}
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	if _, err := u.UploadAvatar([]byte("not an image")); !errors.Is(err, op.ErrInvalidAvatar) {
+		t.Fatalf("upload text avatar err = %v, want ErrInvalidAvatar", err)
+	}
+	if u, err = u.UploadAvatar(png); err != nil {
+		t.Fatal(err)
+	}
+	first := strings.TrimPrefix(u.Avatar, op.AvatarURLPrefix)
+	data, contentType, err := op.GetAvatar(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "image/png" || string(data) != string(png) {
+		t.Fatalf("avatar = %q %q", contentType, data)
+	}
+	if u.DisplayName != "Profile" || u.Bio != "hi" {
+		t.Fatalf("upload changed the profile: %q %q", u.DisplayName, u.Bio)
+	}
+
+	// replacing an uploaded avatar deletes it
+	if u, err = u.UploadAvatar(png); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := op.GetAvatar(first); err == nil {
+		t.Fatal("replaced avatar still stored")
+	}
+
+	room := newTestRoom(t, u, "profile-room")
+	members, err := room.Members()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].DisplayName != "Profile" || members[0].Avatar != u.Avatar {
+		t.Fatalf("members = %+v", members)
+	}
+}
+
+func TestRename(t *testing.T) {
+	conf.Conf().User.RenameCooldown = "1h"
+	defer func() {
+		conf.Conf().User.RenameCooldown = conf.DefaultUserConfig().RenameCooldown
+	}()
+
+	u := newTestUser(t, "rename-user")
+	other := newTestUser(t, "rename-other")
+
+	if _, err := u.Rename(other.Username); !errors.Is(err, db.ErrUsernameTaken) {
+		t.Fatalf("rename to a taken username err = %v, want ErrUsernameTaken", err)
+	}
+	if _, err := u.Rename(u.Username); !errors.Is(err, op.ErrUsernameUnchanged) {
+		t.Fatalf("rename to the same username err = %v", err)
+	}
+	cached := u
+	u, err := u.Rename("rename-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "rename-new" || cached.Username != "rename-user" {
+		t.Fatalf("username = %q, cached user %q, want only the copy renamed", u.Username, cached.Username)
+	}
+	if _, err := op.GetUserByUsername("rename-new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Rename("rename-again"); !errors.Is(err, op.ErrRenameCooldown) {
+		t.Fatalf("rename during the cooldown err = %v, want ErrRenameCooldown", err)
+	}
+
+	conf.Conf().User.RenameCooldown = "0"
+	if _, err := u.Rename("rename-again"); err != nil {
+		t.Fatal(err)
+	}
+	// the old name is free again and its history shows who had it
+	if _, err := other.Rename("rename-user"); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := op.UsernameChangesByName("rename-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].UserID != other.ID || changes[1].UserID != u.ID {
+		t.Fatalf("changes = %+v", changes)
+	}
+	mine, err := u.UsernameChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mine) != 2 || mine[0].OldName != "rename-new" || mine[0].NewName != "rename-again" {
+		t.Fatalf("own changes = %+v", mine)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	conf.Conf().User.DeletionDelay = "1h"
+	defer func() {
+		conf.Conf().User.DeletionDelay = conf.DefaultUserConfig().DeletionDelay
+	}()
+	dir := t.TempDir()
+	disk, err := storage.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subtitle.Init(disk)
+	defer subtitle.Init(nil)
+
+	u := newTestUser(t, "delete-user")
+	host := newTestUser(t, "delete-host")
+	own := newTestRoom(t, u, "delete-own-room")
+	other := newTestRoom(t, host, "delete-other-room")
+	if err := db.AddUserToRoom(u.ID, other.ID, model.RoomRoleUser, model.DefaultPermissions); err != nil {
+		t.Fatal(err)
+	}
+	if err := own.AddMovie(u.NewMovie(model.MovieInfo{BaseMovieInfo: model.BaseMovieInfo{Name: "own", Url: "http://example.com/own"}})); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.AddMovie(u.NewMovie(model.MovieInfo{BaseMovieInfo: model.BaseMovieInfo{Name: "shared", Url: "http://example.com/shared"}})); err != nil {
+		t.Fatal(err)
+	}
+	ownMovies, err := own.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := own.AddSubtitle(u.ID, ownMovies[0].ID, "own.vtt", []byte("WEBVTT\n")); err != nil {
+		t.Fatal(err)
+	}
+	other.RecordChat(u, "bye")
+	if _, err := u.SendDirectMessage(host, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.AddFavoriteRoom(other.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := u.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.User.ID != u.ID || len(e.Rooms) != 1 || len(e.Memberships) != 2 || len(e.Movies) != 2 ||
+		len(e.ChatMessages) != 1 || len(e.DirectMessages) != 1 || len(e.Favorites) != 1 || len(e.Providers) != 1 {
+		t.Fatalf("export = %+v", e)
+	}
+
+	at, err := u.ScheduleDeletion("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at.Before(time.Now().Add(59 * time.Minute)) {
+		t.Fatalf("deletion scheduled at %s, want in an hour", at)
+	}
+	// the cached user is replaced, not changed in place
+	if u.DeletionScheduledAt != nil {
+		t.Fatal("scheduling changed the cached user in place")
+	}
+	if u, err = op.GetUserById(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.ScheduleDeletion("", ""); !errors.Is(err, op.ErrDeletionScheduled) {
+		t.Fatalf("schedule twice err = %v", err)
+	}
+	if err := u.CancelDeletion(); err != nil {
+		t.Fatal(err)
+	}
+	if u, err = op.GetUserById(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := op.PurgeDueUsers(); err != nil || n != 0 {
+		t.Fatalf("purged %d, %v after the cancel", n, err)
+	}
+
+	conf.Conf().User.DeletionDelay = "0"
+	if _, err := u.ScheduleDeletion("", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := op.GetUserById(u.ID); err == nil {
+		t.Fatal("purged user still exists")
+	}
+	if _, err := db.GetRoomByID(own.ID); err == nil {
+		t.Fatal("room of the purged user still exists")
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("%d subtitle files left after the purge", len(files))
+	}
+	ms, err := other.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].CreatorID != host.ID {
+		t.Fatalf("movies of the other room = %+v, want the shared movie given to its host", ms)
+	}
+	chats, err := other.ChatHistory(0, 10)
+	if err != nil || len(chats) != 0 {
+		t.Fatalf("chat history = %v, %v, want the messages of the purged user deleted", chats, err)
+	}
+	if dms, err := host.DirectMessages(u.ID, 0, 10); err != nil || len(dms) != 0 {
+		t.Fatalf("direct messages = %v, %v, want none", dms, err)
+	}
+}
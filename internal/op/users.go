@@ -2,16 +2,25 @@ package op
 
 import (
 	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/bluele/gcache"
+	"github.com/synctv-org/synctv/internal/conf"
 	"github.com/synctv-org/synctv/internal/db"
 	"github.com/synctv-org/synctv/internal/model"
 	"github.com/synctv-org/synctv/internal/provider"
+	"github.com/synctv-org/synctv/utils"
 )
 
 var userCache gcache.Cache
 
+const maxUsernameLength = 32
+
+var usernameReg = regexp.MustCompile(`^[[:print:][:alnum:]\p{Han}]+$`)
+
 func GetUserById(id uint) (*User, error) {
 	i, err := userCache.Get(id)
 	if err == nil {
@@ -44,7 +53,7 @@ func GetUserByUsername(username string) (*User, error) {
 	return u2, userCache.SetWithExpire(u.ID, u2, time.Hour)
 }
 
-func CreateUser(username string, p provider.OAuth2Provider, pid uint, conf ...db.CreateUserConfig) (*User, error) {
+func CreateUser(username string, p provider.OAuth2Provider, pid string, conf ...db.CreateUserConfig) (*User, error) {
 	if username == "" {
 		return nil, errors.New("username cannot be empty")
 	}
@@ -60,7 +69,7 @@ func CreateUser(username string, p provider.OAuth2Provider, pid uint, conf ...db
 	return u2, userCache.SetWithExpire(u.ID, u2, time.Hour)
 }
 
-func CreateOrLoadUser(username string, p provider.OAuth2Provider, pid uint, conf ...db.CreateUserConfig) (*User, error) {
+func CreateOrLoadUser(username string, p provider.OAuth2Provider, pid string, conf ...db.CreateUserConfig) (*User, error) {
 	if username == "" {
 		return nil, errors.New("username cannot be empty")
 	}
@@ -76,29 +85,157 @@ func CreateOrLoadUser(username string, p provider.OAuth2Provider, pid uint, conf
 	return u2, userCache.SetWithExpire(u.ID, u2, time.Hour)
 }
 
+// CreateOrLoadUserWithProvider loads the user bound to the provider account,
+// or creates one. When the provider returns no usable username, the
+// provider's configured fallback is used, and the result is made unique.
+// If the provider is trusted to merge by verified email, a new provider
+// account is linked to the existing user with the same verified email.
+func CreateOrLoadUserWithProvider(p provider.OAuth2Provider, ui *provider.UserInfo, conf ...db.CreateUserConfig) (*User, error) {
+	verifiedEmail := trustedVerifiedEmail(p, ui)
+
+	// only a user that does not exist is created, a failed lookup must not
+	// create a second account for the provider account
+	u, err := db.GetUserByProvider(p, ui.ProviderUserID)
+	switch {
+	case err == nil:
+		if verifiedEmail != "" {
+			if err := db.SetUserProviderVerifiedEmail(p, ui.ProviderUserID, verifiedEmail); err != nil {
+				return nil, err
+			}
+		}
+		return cacheUser(u)
+	case !errors.Is(err, db.ErrUserNotFound):
+		return nil, err
+	}
+
+	if verifiedEmail != "" {
+		u, err := db.GetUserByVerifiedEmail(verifiedEmail)
+		switch {
+		case err == nil:
+			if err := db.AddUserProvider(u.ID, p, ui.ProviderUserID, verifiedEmail); err != nil {
+				return nil, err
+			}
+			return cacheUser(u)
+		case !errors.Is(err, db.ErrUserNotFound):
+			return nil, err
+		}
+		conf = append(conf, db.WithVerifiedEmail(verifiedEmail))
+	}
+
+	username, err := uniqueUsername(resolveUsername(p, ui))
+	if err != nil {
+		return nil, err
+	}
+	return CreateUser(username, p, ui.ProviderUserID, append(conf, withApproval())...)
+}
+
+// trustedVerifiedEmail returns the email usable for merging accounts, or empty
+func trustedVerifiedEmail(p provider.OAuth2Provider, ui *provider.UserInfo) string {
+	if !conf.Conf().OAuth2[p].MergeByVerifiedEmail || !ui.EmailVerified {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(ui.Email))
+}
+
+func cacheUser(u *model.User) (*User, error) {
+	u2 := &User{
+		User: *u,
+	}
+	return u2, userCache.SetWithExpire(u.ID, u2, time.Hour)
+}
+
+// updateCachedUser caches a copy of u changed by update in place of u and
+// returns it, a cached user is shared by every request of the user so it is
+// never changed in place
+func updateCachedUser(u *User, update func(u *User)) *User {
+	u2 := *u
+	update(&u2)
+	_ = userCache.SetWithExpire(u.ID, &u2, time.Hour)
+	return &u2
+}
+
+func resolveUsername(p provider.OAuth2Provider, ui *provider.UserInfo) string {
+	if validUsername(ui.Username) {
+		return ui.Username
+	}
+	fallback := conf.Conf().OAuth2[p].UsernameFallback
+	username := truncateUsername(ui.FallbackUsername(p, fallback), maxUsernameLength)
+	if validUsername(username) {
+		return username
+	}
+	return truncateUsername(ui.FallbackUsername(p, provider.UsernameFallbackProvider), maxUsernameLength)
+}
+
+func uniqueUsername(username string) (string, error) {
+	candidate := username
+	for i := 0; i < 5; i++ {
+		exists, err := db.HasUserByUsername(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		suffix := fmt.Sprintf("_%s", utils.RandString(4))
+		candidate = truncateUsername(username, maxUsernameLength-len(suffix)) + suffix
+	}
+	return "", errors.New("failed to generate unique username")
+}
+
+func validUsername(username string) bool {
+	return username != "" && len(username) <= maxUsernameLength && usernameReg.MatchString(username)
+}
+
+// truncateUsername cuts the username to n bytes without splitting a rune
+func truncateUsername(username string, n int) string {
+	if len(username) <= n {
+		return username
+	}
+	r := []rune(username)
+	for len(string(r)) > n {
+		r = r[:len(r)-1]
+	}
+	return string(r)
+}
+
 func DeleteUserByID(userID uint) error {
 	rs, err := db.GetAllRoomsByUserID(userID)
 	if err != nil {
 		return err
 	}
+	ids := make([]string, len(rs))
+	for i, r := range rs {
+		ids[i] = r.ID
+	}
+	keys, err := db.GetSubtitleKeysByRoomIDs(ids)
+	if err != nil {
+		return err
+	}
 	err = db.DeleteUserByID(userID)
 	if err != nil {
 		return err
 	}
-	userCache.Remove(userID)
+	deleteSubtitleFiles(keys)
+	removeUserCache(userID)
+	removeUserRelationsCache(userID)
 
 	for _, r := range rs {
 		r2, loaded := roomCache.LoadAndDelete(r.ID)
 		if loaded {
 			r2.close()
 		}
+		roomChanged(r.ID)
 	}
 	return nil
 }
 
 func SaveUser(u *model.User) error {
 	userCache.Remove(u.ID)
-	return db.SaveUser(u)
+	if err := db.SaveUser(u); err != nil {
+		return err
+	}
+	userChanged(u.ID)
+	return nil
 }
 
 func GetUserName(userID uint) string {
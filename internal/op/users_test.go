@@ -0,0 +1,234 @@
+package op_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/provider"
+)
+
+func setUsernameFallback(t *testing.T, f provider.UsernameFallback) {
+	t.Helper()
+	old := conf.Conf().OAuth2["github"]
+	c := old
+	c.UsernameFallback = f
+	conf.Conf().OAuth2["github"] = c
+	t.Cleanup(func() {
+		conf.Conf().OAuth2["github"] = old
+	})
+}
+
+func newUserInfo(username, email string) *provider.UserInfo {
+	return &provider.UserInfo{
+		Username:       username,
+		ProviderUserID: strconv.FormatUint(uint64(atomic.AddUint32(&providerUserID, 1)), 10),
+		Email:          email,
+	}
+}
+
+func TestUsernameFallback(t *testing.T) {
+	t.Run("email", func(t *testing.T) {
+		setUsernameFallback(t, provider.UsernameFallbackEmail)
+		u, err := op.CreateOrLoadUserWithProvider("github", newUserInfo("", "fallback-email@example.com"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Username != "fallback-email" {
+			t.Fatalf("username = %q, want %q", u.Username, "fallback-email")
+		}
+	})
+
+	t.Run("email missing", func(t *testing.T) {
+		setUsernameFallback(t, provider.UsernameFallbackEmail)
+		ui := newUserInfo("", "")
+		u, err := op.CreateOrLoadUserWithProvider("github", ui)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "github_" + ui.ProviderUserID; u.Username != want {
+			t.Fatalf("username = %q, want %q", u.Username, want)
+		}
+	})
+
+	t.Run("provider", func(t *testing.T) {
+		setUsernameFallback(t, provider.UsernameFallbackProvider)
+		ui := newUserInfo("", "fallback-provider@example.com")
+		u, err := op.CreateOrLoadUserWithProvider("github", ui)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "github_" + ui.ProviderUserID; u.Username != want {
+			t.Fatalf("username = %q, want %q", u.Username, want)
+		}
+	})
+
+	t.Run("random", func(t *testing.T) {
+		setUsernameFallback(t, provider.UsernameFallbackRandom)
+		u, err := op.CreateOrLoadUserWithProvider("github", newUserInfo("", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(u.Username, "user_") {
+			t.Fatalf("username = %q, want prefix %q", u.Username, "user_")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		setUsernameFallback(t, provider.UsernameFallbackEmail)
+		u, err := op.CreateOrLoadUserWithProvider("github", newUserInfo("bad\nname", "fallback-invalid@example.com"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Username != "fallback-invalid" {
+			t.Fatalf("username = %q, want %q", u.Username, "fallback-invalid")
+		}
+	})
+}
+
+func TestUsernameDuplicate(t *testing.T) {
+	setUsernameFallback(t, provider.UsernameFallbackEmail)
+
+	first, err := op.CreateOrLoadUserWithProvider("github", newUserInfo("duplicate", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := op.CreateOrLoadUserWithProvider("github", newUserInfo("duplicate", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == second.ID {
+		t.Fatal("different provider accounts should create different users")
+	}
+	if second.Username == first.Username {
+		t.Fatalf("duplicate username %q was not made unique", second.Username)
+	}
+	if !strings.HasPrefix(second.Username, "duplicate_") {
+		t.Fatalf("username = %q, want prefix %q", second.Username, "duplicate_")
+	}
+
+	long := strings.Repeat("a", 32)
+	if _, err := op.CreateOrLoadUserWithProvider("github", newUserInfo(long, "")); err != nil {
+		t.Fatal(err)
+	}
+	u, err := op.CreateOrLoadUserWithProvider("github", newUserInfo(long, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(u.Username) > 32 {
+		t.Fatalf("username %q exceeds 32 bytes", u.Username)
+	}
+}
+
+func TestCreateOrLoadUserWithProvider(t *testing.T) {
+	setUsernameFallback(t, provider.UsernameFallbackRandom)
+
+	ui := newUserInfo("", "")
+	first, err := op.CreateOrLoadUserWithProvider("github", ui)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := op.CreateOrLoadUserWithProvider("github", ui)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != second.ID || first.Username != second.Username {
+		t.Fatalf("second login created a new user: %d %q, want %d %q", second.ID, second.Username, first.ID, first.Username)
+	}
+
+	if _, err := db.GetUserByProvider("github", "no-such-user"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Fatalf("lookup of a missing provider account: %v, want %v", err, db.ErrUserNotFound)
+	}
+}
+
+func setMergeByVerifiedEmail(t *testing.T, p provider.OAuth2Provider, merge bool) {
+	t.Helper()
+	old, ok := conf.Conf().OAuth2[p]
+	c := old
+	c.MergeByVerifiedEmail = merge
+	conf.Conf().OAuth2[p] = c
+	t.Cleanup(func() {
+		if ok {
+			conf.Conf().OAuth2[p] = old
+		} else {
+			delete(conf.Conf().OAuth2, p)
+		}
+	})
+}
+
+func TestMergeByVerifiedEmail(t *testing.T) {
+	setMergeByVerifiedEmail(t, "github", true)
+	setMergeByVerifiedEmail(t, "gitlab", true)
+
+	gh := newUserInfo("merge-verified", "Merge-Verified@example.com")
+	gh.EmailVerified = true
+	first, err := op.CreateOrLoadUserWithProvider("github", gh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gl := newUserInfo("merge-verified-gitlab", "merge-verified@example.com")
+	gl.EmailVerified = true
+	second, err := op.CreateOrLoadUserWithProvider("gitlab", gl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID {
+		t.Fatalf("verified email was not merged: got user %d, want %d", second.ID, first.ID)
+	}
+
+	again, err := op.CreateOrLoadUserWithProvider("gitlab", gl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Fatalf("linked provider loaded user %d, want %d", again.ID, first.ID)
+	}
+}
+
+func TestNoMergeByEmail(t *testing.T) {
+	t.Run("unverified", func(t *testing.T) {
+		setMergeByVerifiedEmail(t, "github", true)
+		setMergeByVerifiedEmail(t, "gitlab", true)
+
+		gh := newUserInfo("merge-unverified", "merge-unverified@example.com")
+		gh.EmailVerified = true
+		first, err := op.CreateOrLoadUserWithProvider("github", gh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := op.CreateOrLoadUserWithProvider("gitlab", newUserInfo("merge-unverified-gitlab", "merge-unverified@example.com"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second.ID == first.ID {
+			t.Fatal("unverified email should not be merged")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		setMergeByVerifiedEmail(t, "github", true)
+		setMergeByVerifiedEmail(t, "gitlab", false)
+
+		gh := newUserInfo("merge-disabled", "merge-disabled@example.com")
+		gh.EmailVerified = true
+		first, err := op.CreateOrLoadUserWithProvider("github", gh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gl := newUserInfo("merge-disabled-gitlab", "merge-disabled@example.com")
+		gl.EmailVerified = true
+		second, err := op.CreateOrLoadUserWithProvider("gitlab", gl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second.ID == first.ID {
+			t.Fatal("email should not be merged when the provider is not trusted")
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package op
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/sfu"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+// The audio of the voice channel goes through the sfu of the server, each
+// participant only connects to the server. The server relays the signaling
+// over the websocket of the participant and tells who speaks.
+const maxVoiceSignalLength = 16 * 1024
+
+var (
+	ErrVoiceDisabled      = errors.New("voice is disabled in this room")
+	ErrVoiceFull          = errors.New("voice channel is full")
+	ErrNotInVoice         = errors.New("not in the voice channel")
+	ErrInvalidVoiceSignal = errors.New("invalid voice signal")
+)
+
+var (
+	voiceSFUOnce sync.Once
+	voiceSFU     *sfu.SFU
+	voiceSFUErr  error
+)
+
+// getVoiceSFU makes the sfu of the voice channels on first use
+func getVoiceSFU() (*sfu.SFU, error) {
+	voiceSFUOnce.Do(func() {
+		c := conf.Conf().Voice
+		voiceSFU, voiceSFUErr = sfu.New(sfu.Config{
+			ICEServers: c.ICEServers,
+			PublicIPs:  c.PublicIPs,
+			UDPPortMin: c.UDPPortMin,
+			UDPPortMax: c.UDPPortMax,
+		})
+	})
+	return voiceSFU, voiceSFUErr
+}
+
+// voiceChannel is the set of users in the voice channel of a room and
+// their connections, made when the first one joins
+type voiceChannel struct {
+	lock    sync.Mutex
+	users   map[uint]*User
+	channel *sfu.Channel
+}
+
+func (v *voiceChannel) names() []string {
+	names := make([]string, 0, len(v.users))
+	for _, u := range v.users {
+		names = append(names, u.Username)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// VoiceParticipants returns the usernames in the voice channel
+func (r *Room) VoiceParticipants() []string {
+	r.voice.lock.Lock()
+	defer r.voice.lock.Unlock()
+	return r.voice.names()
+}
+
+// JoinVoice adds a connected user to the voice channel and tells the other
+// participants, it returns the participants already there. The server then
+// sends the user an offer. The caller checks model.CanUseVoice.
+func (r *Room) JoinVoice(user *User) ([]string, error) {
+	if !r.Settings().EnableVoice {
+		return nil, ErrVoiceDisabled
+	}
+	if r.hub == nil {
+		return nil, ErrClientNotConnected
+	}
+	c, ok := r.hub.clients.Load(user.ID)
+	if !ok {
+		return nil, ErrClientNotConnected
+	}
+	r.voice.lock.Lock()
+	if _, ok := r.voice.users[user.ID]; ok {
+		r.voice.lock.Unlock()
+		return nil, nil
+	}
+	if n := conf.Conf().Voice.MaxParticipants; n > 0 && len(r.voice.users) >= n {
+		r.voice.lock.Unlock()
+		return nil, ErrVoiceFull
+	}
+	if r.voice.channel == nil {
+		s, err := getVoiceSFU()
+		if err != nil {
+			r.voice.lock.Unlock()
+			return nil, err
+		}
+		r.voice.channel = s.NewChannel()
+	}
+	peers := r.voice.names()
+	if r.voice.users == nil {
+		r.voice.users = make(map[uint]*User)
+	}
+	r.voice.users[user.ID] = user
+	channel := r.voice.channel
+	r.voice.lock.Unlock()
+
+	err := channel.Join(user.Username, func(kind, data string) error {
+		return c.Send(&ElementMessage{
+			ElementMessage: &pb.ElementMessage{
+				Type:  pb.ElementMessageType_VOICE_SIGNAL,
+				Voice: &pb.VoiceSignal{Kind: kind, Data: data},
+			},
+		})
+	}, func() {
+		r.LeaveVoice(user)
+	})
+	r.voice.lock.Lock()
+	// the channel was closed or the user left while connecting
+	_, joined := r.voice.users[user.ID]
+	if err != nil || !joined || r.voice.channel != channel {
+		delete(r.voice.users, user.ID)
+		r.voice.lock.Unlock()
+		if err == nil {
+			channel.Leave(user.Username)
+			err = ErrNotInVoice
+		}
+		return nil, err
+	}
+	r.voice.lock.Unlock()
+	r.broadcastVoice(user, pb.ElementMessageType_VOICE_JOIN, false)
+	return peers, nil
+}
+
+// LeaveVoice removes the user from the voice channel, if in it
+func (r *Room) LeaveVoice(user *User) {
+	r.voice.lock.Lock()
+	_, ok := r.voice.users[user.ID]
+	delete(r.voice.users, user.ID)
+	channel := r.voice.channel
+	r.voice.lock.Unlock()
+	if ok {
+		channel.Leave(user.Username)
+		r.broadcastVoice(user, pb.ElementMessageType_VOICE_LEAVE, false)
+	}
+}
+
+// closeVoice removes everyone from the voice channel
+func (r *Room) closeVoice() {
+	r.voice.lock.Lock()
+	users := r.voice.users
+	r.voice.users = nil
+	channel := r.voice.channel
+	r.voice.channel = nil
+	r.voice.lock.Unlock()
+	if channel != nil {
+		channel.Close()
+	}
+	for _, u := range users {
+		r.broadcastVoice(u, pb.ElementMessageType_VOICE_LEAVE, false)
+	}
+}
+
+// SignalVoice takes an answer or an ice candidate of user for the server
+func (r *Room) SignalVoice(user *User, signal *pb.VoiceSignal) error {
+	if signal == nil || len(signal.Data) > maxVoiceSignalLength {
+		return ErrInvalidVoiceSignal
+	}
+	r.voice.lock.Lock()
+	_, ok := r.voice.users[user.ID]
+	channel := r.voice.channel
+	r.voice.lock.Unlock()
+	if !ok {
+		return ErrNotInVoice
+	}
+	switch err := channel.Signal(user.Username, signal.Kind, signal.Data); {
+	case errors.Is(err, sfu.ErrNotJoined):
+		return ErrNotInVoice
+	case err != nil:
+		return ErrInvalidVoiceSignal
+	}
+	return nil
+}
+
+// SetSpeaking tells the room whether a participant speaks
+func (r *Room) SetSpeaking(user *User, speaking bool) error {
+	r.voice.lock.Lock()
+	_, ok := r.voice.users[user.ID]
+	r.voice.lock.Unlock()
+	if !ok {
+		return ErrNotInVoice
+	}
+	r.broadcastVoice(user, pb.ElementMessageType_VOICE_SPEAKING, speaking)
+	return nil
+}
+
+func (r *Room) broadcastVoice(user *User, t pb.ElementMessageType, speaking bool) {
+	r.Broadcast(&ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type:     t,
+			Sender:   user.Username,
+			Speaking: speaking,
+			Time:     time.Now().UnixMilli(),
+		},
+	}, WithSender(user.Username))
+}
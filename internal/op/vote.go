@@ -0,0 +1,125 @@
+package op
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+// Actions clients can vote for in rooms with a vote threshold
+const (
+	VotePause = "pause"
+	VotePlay  = "play"
+	VoteSkip  = "skip"
+)
+
+var (
+	ErrVotingDisabled    = errors.New("voting is disabled in this room")
+	ErrUnknownVote       = errors.New("unknown vote action")
+	ErrControlledByVotes = errors.New("playback is controlled by votes in this room")
+)
+
+// ControlledByVotes reports whether u must vote to change the playback of
+// the room, users with CanControlPlayback never do
+func (r *Room) ControlledByVotes(u *User) bool {
+	return r.Settings().VoteThreshold > 0 && !u.HasPermission(r, model.CanControlPlayback)
+}
+
+type VoteResult struct {
+	Action string
+	Votes  int64
+	Needed int64
+	Passed bool
+}
+
+// ballots are the running votes of a room by action
+type ballots struct {
+	lock    sync.Mutex
+	actions map[string]*ballot
+}
+
+type ballot struct {
+	// seq of the playback status the vote was started on,
+	// any change of the status starts the vote over
+	seq    uint64
+	voters map[uint]struct{}
+}
+
+// VotesNeeded returns the number of votes to pass an action with the connected clients
+func (r *Room) VotesNeeded() int64 {
+	clients := r.ClientNum()
+	needed := clients*r.Settings().VoteThreshold/100 + 1
+	if needed > clients {
+		needed = clients
+	}
+	if needed < 1 {
+		needed = 1
+	}
+	return needed
+}
+
+// Vote records the vote of a user for an action, voting twice counts once.
+// The action is applied when the votes reach the threshold of the room.
+func (r *Room) Vote(userID uint, action string) (*VoteResult, error) {
+	if r.Settings().VoteThreshold <= 0 {
+		return nil, ErrVotingDisabled
+	}
+	switch action {
+	case VotePause, VotePlay, VoteSkip:
+	default:
+		return nil, ErrUnknownVote
+	}
+	r.LazyInit()
+
+	r.votes.lock.Lock()
+	defer r.votes.lock.Unlock()
+	if r.votes.actions == nil {
+		r.votes.actions = make(map[string]*ballot)
+	}
+	seq := r.current.Status().Seq
+	b, ok := r.votes.actions[action]
+	if !ok || b.seq != seq {
+		b = &ballot{seq: seq, voters: make(map[uint]struct{})}
+		r.votes.actions[action] = b
+	}
+	b.voters[userID] = struct{}{}
+
+	result := &VoteResult{
+		Action: action,
+		Votes:  int64(len(b.voters)),
+		Needed: r.VotesNeeded(),
+	}
+	if result.Votes < result.Needed {
+		return result, nil
+	}
+	if err := r.applyVote(action); err != nil {
+		return nil, err
+	}
+	// the status changed, so every running vote starts over
+	r.votes.actions = nil
+	result.Passed = true
+	return result, nil
+}
+
+func (r *Room) applyVote(action string) error {
+	status := r.current.Status()
+	switch action {
+	case VotePause:
+		r.current.SetStatus(false, status.Seek, status.Rate, 0)
+	case VotePlay:
+		r.current.SetStatus(true, status.Seek, status.Rate, 0)
+	case VoteSkip:
+		// skipping leaves a repeated movie
+		mode := r.PlayMode()
+		if mode == model.PlayModeRepeatOne {
+			mode = model.PlayModeRepeatAll
+		}
+		id, err := r.nextMovieID(mode)
+		if err != nil {
+			return err
+		}
+		return r.ChangeCurrentMovie(id)
+	}
+	return nil
+}
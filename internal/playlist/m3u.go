@@ -0,0 +1,95 @@
+package playlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+const (
+	m3uHeader = "#EXTM3U"
+	m3uInfo   = "#EXTINF:"
+	// m3uOption carries http options of the next entry as read by vlc
+	m3uOption = "#EXTVLCOPT:"
+)
+
+// m3uHeaders are the vlc options mapped to request headers of a movie
+var m3uHeaders = []struct{ option, header string }{
+	{"http-referrer", "Referer"},
+	{"http-user-agent", "User-Agent"},
+}
+
+func decodeM3U(r io.Reader) ([]model.BaseMovieInfo, error) {
+	var (
+		movies []model.BaseMovieInfo
+		next   model.BaseMovieInfo
+	)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, m3uInfo):
+			// #EXTINF:<duration> [attributes],<title>
+			if i := strings.IndexByte(line, ','); i != -1 {
+				next.Name = strings.TrimSpace(line[i+1:])
+			}
+		case strings.HasPrefix(line, m3uOption):
+			k, v, ok := strings.Cut(strings.TrimPrefix(line, m3uOption), "=")
+			if !ok {
+				break
+			}
+			for _, h := range m3uHeaders {
+				if h.option == k {
+					if next.Headers == nil {
+						next.Headers = make(map[string]string)
+					}
+					next.Headers[h.header] = v
+				}
+			}
+		case strings.HasPrefix(line, "#"):
+			// other directives and comments
+		default:
+			next.Url = line
+			if next.Name == "" {
+				next.Name = nameOf(line)
+			}
+			movies = append(movies, next)
+			if len(movies) > MaxEntries {
+				return nil, ErrTooManyEntries
+			}
+			next = model.BaseMovieInfo{}
+		}
+	}
+	return movies, s.Err()
+}
+
+// nameOf names an entry without title after the last path element of its url
+func nameOf(u string) string {
+	if pu, err := url.Parse(u); err == nil && pu.Path != "" {
+		if base := path.Base(pu.Path); base != "/" && base != "." {
+			return base
+		}
+	}
+	return u
+}
+
+func encodeM3U(w io.Writer, movies []model.BaseMovieInfo) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, m3uHeader)
+	for _, m := range movies {
+		fmt.Fprintf(bw, "%s-1,%s\n", m3uInfo, strings.ReplaceAll(m.Name, "\n", " "))
+		for _, h := range m3uHeaders {
+			if v, ok := m.Headers[h.header]; ok {
+				fmt.Fprintf(bw, "%s%s=%s\n", m3uOption, h.option, v)
+			}
+		}
+		fmt.Fprintln(bw, m.Url)
+	}
+	return bw.Flush()
+}
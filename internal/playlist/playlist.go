@@ -0,0 +1,94 @@
+// Package playlist reads and writes room playlists in the formats users
+// move queues around with, JSON as served by the api and M3U/M3U8.
+package playlist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatM3U  Format = "m3u"
+)
+
+// MaxEntries is the most movies a single playlist may hold
+const MaxEntries = 1000
+
+var (
+	ErrUnknownFormat  = errors.New("unknown playlist format")
+	ErrTooManyEntries = fmt.Errorf("playlist has more than %d entries", MaxEntries)
+)
+
+// ParseFormat returns the format named by s, m3u8 is read as m3u
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "json":
+		return FormatJSON, nil
+	case "m3u", "m3u8":
+		return FormatM3U, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+// Detect guesses the format of data, a JSON array or else M3U
+func Detect(data []byte) Format {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return FormatJSON
+	}
+	return FormatM3U
+}
+
+func (f Format) ContentType() string {
+	if f == FormatM3U {
+		return "audio/x-mpegurl"
+	}
+	return "application/json"
+}
+
+// Decode reads the movies of a playlist in format f
+func Decode(r io.Reader, f Format) ([]model.BaseMovieInfo, error) {
+	var (
+		movies []model.BaseMovieInfo
+		err    error
+	)
+	switch f {
+	case FormatJSON:
+		err = json.NewDecoder(r).Decode(&movies)
+	case FormatM3U:
+		movies, err = decodeM3U(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(movies) > MaxEntries {
+		return nil, ErrTooManyEntries
+	}
+	return movies, nil
+}
+
+// Encode writes movies as a playlist in format f
+func Encode(w io.Writer, f Format, movies []model.BaseMovieInfo) error {
+	switch f {
+	case FormatJSON:
+		if movies == nil {
+			movies = []model.BaseMovieInfo{}
+		}
+		return json.NewEncoder(w).Encode(movies)
+	case FormatM3U:
+		return encodeM3U(w, movies)
+	default:
+		return ErrUnknownFormat
+	}
+}
@@ -0,0 +1,66 @@
+package playlist_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/playlist"
+)
+
+func TestDecodeM3U(t *testing.T) {
+	const m3u = `#EXTM3U
+#EXTINF:120 tvg-id="a",First
+#EXTVLCOPT:http-referrer=https://example.com/
+http://example.com/first.mp4
+
+# a comment
+http://example.com/videos/second.m3u8?token=1
+`
+	movies, err := playlist.Decode(strings.NewReader(m3u), playlist.FormatM3U)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.BaseMovieInfo{
+		{Name: "First", Url: "http://example.com/first.mp4", Headers: map[string]string{"Referer": "https://example.com/"}},
+		{Name: "second.m3u8", Url: "http://example.com/videos/second.m3u8?token=1"},
+	}
+	if !reflect.DeepEqual(movies, want) {
+		t.Fatalf("decode = %+v, want %+v", movies, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	movies := []model.BaseMovieInfo{
+		{Name: "a", Url: "http://example.com/a.mp4", Headers: map[string]string{"User-Agent": "synctv"}},
+		{Name: "b", Url: "http://example.com/b.mp4"},
+	}
+	for _, f := range []playlist.Format{playlist.FormatJSON, playlist.FormatM3U} {
+		buf := bytes.Buffer{}
+		if err := playlist.Encode(&buf, f, movies); err != nil {
+			t.Fatal(err)
+		}
+		if got := playlist.Detect(buf.Bytes()); got != f {
+			t.Fatalf("%s: detected %s", f, got)
+		}
+		decoded, err := playlist.Decode(&buf, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, movies) {
+			t.Fatalf("%s: round trip = %+v, want %+v", f, decoded, movies)
+		}
+	}
+}
+
+func TestTooManyEntries(t *testing.T) {
+	buf := strings.Builder{}
+	for i := 0; i <= playlist.MaxEntries; i++ {
+		buf.WriteString("http://example.com/a.mp4\n")
+	}
+	if _, err := playlist.Decode(strings.NewReader(buf.String()), playlist.FormatM3U); err != playlist.ErrTooManyEntries {
+		t.Fatalf("decode = %v, want ErrTooManyEntries", err)
+	}
+}
@@ -0,0 +1,165 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+const (
+	// maxMoovSize bounds the index read into memory
+	maxMoovSize = 16 << 20
+	// maxTopBoxes bounds the requests walking the top level boxes
+	maxTopBoxes = 64
+)
+
+// MP4 reads the duration, the video resolution and the codec from the moov
+// box of an mp4 file, wherever it is in the file
+func (p *Prober) MP4(ctx context.Context, url string) (model.MovieMeta, error) {
+	moov, err := findMoov(p.ReaderAt(ctx, url))
+	if err != nil {
+		return model.MovieMeta{}, err
+	}
+	return parseMoov(moov)
+}
+
+func findMoov(r io.ReaderAt) ([]byte, error) {
+	var (
+		off    int64
+		header [16]byte
+	)
+	for i := 0; i < maxTopBoxes; i++ {
+		n, err := r.ReadAt(header[:], off)
+		if n < 8 {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		size, typ := int64(binary.BigEndian.Uint32(header[:4])), string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			// the box extends to the end of the file
+			if typ != "moov" {
+				return nil, ErrNotMP4
+			}
+			size = maxMoovSize
+		case 1:
+			if n < 16 {
+				return nil, ErrNotMP4
+			}
+			size, headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		if size < headerSize || (i == 0 && typ != "ftyp") {
+			return nil, ErrNotMP4
+		}
+		if typ == "moov" {
+			if size > maxMoovSize {
+				return nil, errors.New("moov box too large")
+			}
+			moov := make([]byte, size-headerSize)
+			n, err := r.ReadAt(moov, off+headerSize)
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			return moov[:n], nil
+		}
+		off += size
+	}
+	return nil, ErrNotMP4
+}
+
+// boxes calls f with the type and payload of each box in b
+func boxes(b []byte, f func(typ string, payload []byte)) {
+	for len(b) >= 8 {
+		size, typ := uint64(binary.BigEndian.Uint32(b[:4])), string(b[4:8])
+		headerSize := uint64(8)
+		if size == 1 && len(b) >= 16 {
+			size, headerSize = binary.BigEndian.Uint64(b[8:16]), 16
+		} else if size == 0 {
+			size = uint64(len(b))
+		}
+		if size < headerSize || size > uint64(len(b)) {
+			return
+		}
+		f(typ, b[headerSize:size])
+		b = b[size:]
+	}
+}
+
+// child returns the payload of the first box of type typ in b
+func child(b []byte, typ string) (payload []byte) {
+	boxes(b, func(t string, p []byte) {
+		if payload == nil && t == typ {
+			payload = p
+		}
+	})
+	return
+}
+
+func parseMoov(moov []byte) (model.MovieMeta, error) {
+	var meta model.MovieMeta
+	mvhd := child(moov, "mvhd")
+	if len(mvhd) < 4 {
+		return meta, ErrNotMP4
+	}
+	var timescale, duration uint64
+	if mvhd[0] == 1 {
+		if len(mvhd) < 32 {
+			return meta, ErrNotMP4
+		}
+		timescale, duration = uint64(binary.BigEndian.Uint32(mvhd[20:24])), binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		if len(mvhd) < 20 {
+			return meta, ErrNotMP4
+		}
+		timescale, duration = uint64(binary.BigEndian.Uint32(mvhd[12:16])), uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale != 0 {
+		meta.Duration = float64(duration) / float64(timescale)
+	}
+
+	boxes(moov, func(typ string, trak []byte) {
+		if typ != "trak" {
+			return
+		}
+		width, height := trackSize(child(trak, "tkhd"))
+		codec := sampleEntry(child(child(child(child(trak, "mdia"), "minf"), "stbl"), "stsd"))
+		switch {
+		case width != 0 && meta.Width == 0:
+			// the first video track
+			meta.Width, meta.Height, meta.Codec = width, height, codec
+		case meta.Codec == "":
+			meta.Codec = codec
+		}
+	})
+	return meta, nil
+}
+
+// trackSize returns the presentation size of a track from its tkhd
+func trackSize(tkhd []byte) (width, height int) {
+	if len(tkhd) < 4 {
+		return 0, 0
+	}
+	off := 76
+	if tkhd[0] == 1 {
+		off = 88
+	}
+	if len(tkhd) < off+8 {
+		return 0, 0
+	}
+	// 16.16 fixed point
+	return int(binary.BigEndian.Uint32(tkhd[off:]) >> 16), int(binary.BigEndian.Uint32(tkhd[off+4:]) >> 16)
+}
+
+// sampleEntry returns the format of the first sample description in stsd, the codec
+func sampleEntry(stsd []byte) string {
+	if len(stsd) < 16 {
+		return ""
+	}
+	return string(stsd[12:16])
+}
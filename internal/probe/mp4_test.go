@@ -0,0 +1,86 @@
+package probe_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/probe"
+)
+
+func mp4Box(typ string, payload ...[]byte) []byte {
+	b := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(b)))
+	out = append(out, typ...)
+	return append(out, b...)
+}
+
+func u32(v ...uint32) []byte {
+	var b []byte
+	for _, x := range v {
+		b = binary.BigEndian.AppendUint32(b, x)
+	}
+	return b
+}
+
+func trak(width, height uint32, codec string) []byte {
+	tkhd := append(u32(0, 0, 0, 1, 0, 0, 0, 0, 0, 0), make([]byte, 36)...)
+	tkhd = append(tkhd, u32(width<<16, height<<16)...)
+	stsd := append(u32(0, 1), mp4Box(codec, make([]byte, 8))...)
+	return mp4Box("trak",
+		mp4Box("tkhd", tkhd),
+		mp4Box("mdia", mp4Box("minf", mp4Box("stbl", mp4Box("stsd", stsd)))),
+	)
+}
+
+func testMP4(moovFirst bool) []byte {
+	ftyp := mp4Box("ftyp", []byte("isom"), u32(0x200), []byte("isomiso2avc1mp41"))
+	moov := mp4Box("moov",
+		mp4Box("mvhd", u32(0, 0, 0, 1000, 90500), make([]byte, 80)),
+		trak(0, 0, "mp4a"),
+		trak(1920, 1080, "avc1"),
+	)
+	mdat := mp4Box("mdat", make([]byte, 4096))
+	if moovFirst {
+		return bytes.Join([][]byte{ftyp, moov, mdat}, nil)
+	}
+	return bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+}
+
+func TestMP4(t *testing.T) {
+	want := model.MovieMeta{Duration: 90.5, Width: 1920, Height: 1080, Codec: "avc1"}
+	for _, moovFirst := range []bool{true, false} {
+		data := testMP4(moovFirst)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Referer") != "https://example.com/" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			http.ServeContent(w, r, "movie.mp4", time.Time{}, bytes.NewReader(data))
+		}))
+		p := &probe.Prober{Headers: map[string]string{"Referer": "https://example.com/"}}
+		meta, err := p.Probe(context.Background(), s.URL)
+		s.Close()
+		if err != nil {
+			t.Fatalf("moov first %v: %v", moovFirst, err)
+		}
+		if meta != want {
+			t.Fatalf("moov first %v: meta = %+v, want %+v", moovFirst, meta, want)
+		}
+	}
+}
+
+func TestNotMP4(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "index.m3u8", time.Time{}, bytes.NewReader([]byte("#EXTM3U\n#EXT-X-VERSION:3\n")))
+	}))
+	defer s.Close()
+	if _, err := (&probe.Prober{}).Probe(context.Background(), s.URL); err != probe.ErrNotMP4 {
+		t.Fatalf("probe = %v, want ErrNotMP4", err)
+	}
+}
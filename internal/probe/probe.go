@@ -0,0 +1,90 @@
+// Package probe reads metadata of remote media without downloading it,
+// the index of MP4 files is fetched with range requests and thumbnails
+// are extracted with ffmpeg when it is installed.
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+var (
+	ErrNotMP4          = errors.New("not an mp4 file")
+	ErrRangeNotSupport = errors.New("server does not support range requests")
+)
+
+// Prober probes media with Client, Headers are sent with every request
+type Prober struct {
+	Client  *http.Client
+	Headers map[string]string
+	// FFmpeg is the ffmpeg binary for thumbnails, empty to skip them
+	FFmpeg string
+}
+
+// Probe returns the metadata of the media at url, a thumbnail
+// is only taken when the media could be probed
+func (p *Prober) Probe(ctx context.Context, url string) (model.MovieMeta, error) {
+	meta, err := p.MP4(ctx, url)
+	if err != nil {
+		return meta, err
+	}
+	if p.FFmpeg != "" {
+		// skip the intro, which is often black
+		at := meta.Duration / 10
+		if at > 10 {
+			at = 10
+		}
+		if meta.Thumbnail, err = p.Thumbnail(ctx, url, at); err != nil {
+			return meta, fmt.Errorf("thumbnail: %w", err)
+		}
+	}
+	return meta, nil
+}
+
+// ReaderAt returns the media at url as an io.ReaderAt backed by range requests
+func (p *Prober) ReaderAt(ctx context.Context, url string) io.ReaderAt {
+	return &rangeReader{ctx: ctx, p: p, url: url}
+}
+
+type rangeReader struct {
+	ctx context.Context
+	p   *Prober
+	url string
+}
+
+func (r *rangeReader) ReadAt(b []byte, off int64) (int, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range r.p.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(b))-1))
+	client := r.p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, io.EOF
+	default:
+		return 0, ErrRangeNotSupport
+	}
+	n, err := io.ReadFull(resp.Body, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
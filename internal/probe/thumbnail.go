@@ -0,0 +1,46 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// maxThumbnailSize bounds the jpeg stored with a movie
+const maxThumbnailSize = 256 << 10
+
+// Thumbnail extracts the frame at seconds into the media with ffmpeg,
+// scaled to 320 pixels wide and returned as a jpeg data url
+func (p *Prober) Thumbnail(ctx context.Context, url string, at float64) (string, error) {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if len(p.Headers) != 0 {
+		var h strings.Builder
+		for k, v := range p.Headers {
+			fmt.Fprintf(&h, "%s: %s\r\n", k, v)
+		}
+		args = append(args, "-headers", h.String())
+	}
+	args = append(args,
+		"-ss", strconv.FormatFloat(at, 'f', 3, 64),
+		"-i", url,
+		"-frames:v", "1",
+		"-vf", "scale=320:-2",
+		"-f", "image2",
+		"-c:v", "mjpeg",
+		"pipe:1",
+	)
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.FFmpeg, args...)
+	cmd.Stdout, cmd.Stderr = &out, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if out.Len() == 0 || out.Len() > maxThumbnailSize {
+		return "", fmt.Errorf("unexpected thumbnail size %d", out.Len())
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(out.Bytes()), nil
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+var discordEndpoint = oauth2.Endpoint{
+	AuthURL:   "https://discord.com/oauth2/authorize",
+	TokenURL:  "https://discord.com/api/oauth2/token",
+	AuthStyle: oauth2.AuthStyleInParams,
+}
+
+type DiscordProvider struct {
+	OAuth2Base
+}
+
+func (d *DiscordProvider) Init(opt InitOption) {
+	d.Config = oauth2.Config{
+		ClientID:     opt.ClientID,
+		ClientSecret: opt.ClientSecret,
+		RedirectURL:  opt.RedirectURL,
+		Scopes:       []string{"identify", "email"},
+		Endpoint:     discordEndpoint,
+	}
+}
+
+func (d *DiscordProvider) Provider() OAuth2Provider {
+	return "discord"
+}
+
+func (d *DiscordProvider) GetUserInfo(ctx context.Context, tk *oauth2.Token) (*UserInfo, error) {
+	ui := discordUserInfo{}
+	if err := getJSON(ctx, d.Client(ctx, tk), "https://discord.com/api/users/@me", &ui); err != nil {
+		return nil, err
+	}
+	return &UserInfo{
+		Username:       ui.Username,
+		ProviderUserID: ui.ID,
+		Email:          ui.Email,
+		EmailVerified:  ui.Verified,
+	}, nil
+}
+
+type discordUserInfo struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Verified bool   `json:"verified"`
+}
+
+func init() {
+	RegisterProvider(new(DiscordProvider))
+}
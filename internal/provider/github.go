@@ -2,7 +2,10 @@ package provider
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	json "github.com/json-iterator/go"
@@ -11,33 +14,25 @@ import (
 )
 
 type GithubProvider struct {
-	ClientID, ClientSecret string
+	OAuth2Base
 }
 
-func (p *GithubProvider) Init(ClientID, ClientSecret string) {
-	p.ClientID = ClientID
-	p.ClientSecret = ClientSecret
+func (p *GithubProvider) Init(opt InitOption) {
+	p.Config = oauth2.Config{
+		ClientID:     opt.ClientID,
+		ClientSecret: opt.ClientSecret,
+		RedirectURL:  opt.RedirectURL,
+		Scopes:       []string{"user"},
+		Endpoint:     github.Endpoint,
+	}
 }
 
 func (p *GithubProvider) Provider() OAuth2Provider {
 	return "github"
 }
 
-func (p *GithubProvider) NewConfig() *oauth2.Config {
-	return &oauth2.Config{
-		ClientID:     p.ClientID,
-		ClientSecret: p.ClientSecret,
-		Scopes:       []string{"user"},
-		Endpoint:     github.Endpoint,
-	}
-}
-
-func (p *GithubProvider) GetUserInfo(ctx context.Context, config *oauth2.Config, code string) (*UserInfo, error) {
-	oauth2Token, err := config.Exchange(ctx, code)
-	if err != nil {
-		return nil, err
-	}
-	client := config.Client(ctx, oauth2Token)
+func (p *GithubProvider) GetUserInfo(ctx context.Context, tk *oauth2.Token) (*UserInfo, error) {
+	client := p.Client(ctx, tk)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/user", nil)
 	if err != nil {
 		return nil, err
@@ -52,10 +47,48 @@ func (p *GithubProvider) GetUserInfo(ctx context.Context, config *oauth2.Config,
 	if err != nil {
 		return nil, err
 	}
-	return &UserInfo{
+	info := &UserInfo{
 		Username:       ui.Login,
-		ProviderUserID: ui.ID,
-	}, nil
+		ProviderUserID: strconv.FormatUint(uint64(ui.ID), 10),
+	}
+	info.Email, _ = ui.Email.(string)
+	if email, err := githubPrimaryEmail(ctx, client); err == nil && email.Email != "" {
+		info.Email = email.Email
+		info.EmailVerified = email.Verified
+	}
+	return info, nil
+}
+
+func githubPrimaryEmail(ctx context.Context, client *http.Client) (*githubEmail, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/user/emails", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get github emails failed: %s", resp.Status)
+	}
+	emails := []githubEmail{}
+	err = json.NewDecoder(resp.Body).Decode(&emails)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range emails {
+		if e.Primary {
+			return &e, nil
+		}
+	}
+	return nil, errors.New("github primary email not found")
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
 }
 
 type githubUserInfo struct {
@@ -107,5 +140,5 @@ type Plan struct {
 }
 
 func init() {
-	registerProvider(new(GithubProvider))
+	RegisterProvider(new(GithubProvider))
 }
@@ -9,33 +9,25 @@ import (
 )
 
 type GitlabProvider struct {
-	ClientID, ClientSecret string
+	OAuth2Base
 }
 
-func (g *GitlabProvider) Init(ClientID, ClientSecret string) {
-	g.ClientID = ClientID
-	g.ClientSecret = ClientSecret
+func (g *GitlabProvider) Init(opt InitOption) {
+	g.Config = oauth2.Config{
+		ClientID:     opt.ClientID,
+		ClientSecret: opt.ClientSecret,
+		RedirectURL:  opt.RedirectURL,
+		Scopes:       []string{"read_user"},
+		Endpoint:     gitlab.Endpoint,
+	}
 }
 
 func (g *GitlabProvider) Provider() OAuth2Provider {
 	return "gitlab"
 }
 
-func (g *GitlabProvider) NewConfig() *oauth2.Config {
-	return &oauth2.Config{
-		ClientID:     g.ClientID,
-		ClientSecret: g.ClientSecret,
-		Scopes:       []string{"read_user"},
-		Endpoint:     gitlab.Endpoint,
-	}
-}
-
-func (g *GitlabProvider) GetUserInfo(ctx context.Context, config *oauth2.Config, code string) (*UserInfo, error) {
-	oauth2Token, err := config.Exchange(ctx, code)
-	if err != nil {
-		return nil, err
-	}
-	client := config.Client(ctx, oauth2Token)
+func (g *GitlabProvider) GetUserInfo(ctx context.Context, tk *oauth2.Token) (*UserInfo, error) {
+	client := g.Client(ctx, tk)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://gitlab.com/api/v4/user", nil)
 	if err != nil {
 		return nil, err
@@ -49,5 +41,5 @@ func (g *GitlabProvider) GetUserInfo(ctx context.Context, config *oauth2.Config,
 }
 
 func init() {
-	registerProvider(new(GitlabProvider))
+	RegisterProvider(new(GitlabProvider))
 }
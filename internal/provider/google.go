@@ -2,52 +2,49 @@ package provider
 
 import (
 	"context"
-	"net/http"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
 type GoogleProvider struct {
-	ClientID, ClientSecret string
+	OAuth2Base
 }
 
-func (g *GoogleProvider) Init(ClientID, ClientSecret string) {
-	g.ClientID = ClientID
-	g.ClientSecret = ClientSecret
+func (g *GoogleProvider) Init(opt InitOption) {
+	g.Config = oauth2.Config{
+		ClientID:     opt.ClientID,
+		ClientSecret: opt.ClientSecret,
+		RedirectURL:  opt.RedirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+		Endpoint:     google.Endpoint,
+	}
 }
 
 func (g *GoogleProvider) Provider() OAuth2Provider {
 	return "google"
 }
 
-func (g *GoogleProvider) NewConfig() *oauth2.Config {
-	return &oauth2.Config{
-		ClientID:     g.ClientID,
-		ClientSecret: g.ClientSecret,
-		Scopes:       []string{"profile"},
-		Endpoint:     google.Endpoint,
+func (g *GoogleProvider) GetUserInfo(ctx context.Context, tk *oauth2.Token) (*UserInfo, error) {
+	ui := googleUserInfo{}
+	if err := getJSON(ctx, g.Client(ctx, tk), "https://www.googleapis.com/oauth2/v2/userinfo", &ui); err != nil {
+		return nil, err
 	}
+	return &UserInfo{
+		Username:       ui.Name,
+		ProviderUserID: ui.ID,
+		Email:          ui.Email,
+		EmailVerified:  ui.VerifiedEmail,
+	}, nil
 }
 
-func (g *GoogleProvider) GetUserInfo(ctx context.Context, config *oauth2.Config, code string) (*UserInfo, error) {
-	oauth2Token, err := config.Exchange(ctx, code)
-	if err != nil {
-		return nil, err
-	}
-	client := config.Client(ctx, oauth2Token)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.googleapis.com/oauth2/v2/userinfo", nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	return nil, FormatErrNotImplemented("google")
+type googleUserInfo struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	VerifiedEmail bool   `json:"verified_email"`
+	Name          string `json:"name"`
 }
 
 func init() {
-	registerProvider(new(GoogleProvider))
+	RegisterProvider(new(GoogleProvider))
 }
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider logs in with any OpenID Connect issuer. The endpoints are
+// discovered from the issuer on first use, a failed discovery is retried on
+// the next login so the server starts while the issuer is down.
+type OIDCProvider struct {
+	OAuth2Base
+	issuer string
+
+	lock        sync.Mutex
+	discovered  bool
+	userInfoURL string
+}
+
+func (o *OIDCProvider) Init(opt InitOption) {
+	o.issuer = strings.TrimSuffix(opt.Issuer, "/")
+	o.Config = oauth2.Config{
+		ClientID:     opt.ClientID,
+		ClientSecret: opt.ClientSecret,
+		RedirectURL:  opt.RedirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+func (o *OIDCProvider) Provider() OAuth2Provider {
+	return "oidc"
+}
+
+type oidcConfiguration struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+func (o *OIDCProvider) discover(ctx context.Context) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.discovered {
+		return nil
+	}
+	if o.issuer == "" {
+		return errors.New("oidc issuer is not configured")
+	}
+	c := oidcConfiguration{}
+	if err := getJSON(ctx, http.DefaultClient, o.issuer+"/.well-known/openid-configuration", &c); err != nil {
+		return err
+	}
+	if strings.TrimSuffix(c.Issuer, "/") != o.issuer {
+		return errors.New("oidc issuer mismatch: " + c.Issuer)
+	}
+	if c.AuthorizationEndpoint == "" || c.TokenEndpoint == "" || c.UserinfoEndpoint == "" {
+		return errors.New("oidc issuer is missing the authorization, token or userinfo endpoint")
+	}
+	o.Config.Endpoint = oauth2.Endpoint{
+		AuthURL:  c.AuthorizationEndpoint,
+		TokenURL: c.TokenEndpoint,
+	}
+	o.userInfoURL = c.UserinfoEndpoint
+	o.discovered = true
+	return nil
+}
+
+func (o *OIDCProvider) NewAuthURL(ctx context.Context, state string) (string, error) {
+	if err := o.discover(ctx); err != nil {
+		return "", err
+	}
+	return o.OAuth2Base.NewAuthURL(ctx, state)
+}
+
+func (o *OIDCProvider) GetToken(ctx context.Context, code string) (*oauth2.Token, error) {
+	if err := o.discover(ctx); err != nil {
+		return nil, err
+	}
+	return o.OAuth2Base.GetToken(ctx, code)
+}
+
+func (o *OIDCProvider) GetUserInfo(ctx context.Context, tk *oauth2.Token) (*UserInfo, error) {
+	if err := o.discover(ctx); err != nil {
+		return nil, err
+	}
+	ui := oidcUserInfo{}
+	if err := getJSON(ctx, o.Client(ctx, tk), o.userInfoURL, &ui); err != nil {
+		return nil, err
+	}
+	if ui.Sub == "" {
+		return nil, errors.New("oidc userinfo has no subject")
+	}
+	return &UserInfo{
+		Username:       ui.PreferredUsername,
+		ProviderUserID: ui.Sub,
+		Email:          ui.Email,
+		EmailVerified:  ui.EmailVerified,
+	}, nil
+}
+
+type oidcUserInfo struct {
+	Sub               string `json:"sub"`
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+}
+
+func init() {
+	RegisterProvider(new(OIDCProvider))
+}
@@ -3,50 +3,126 @@ package provider
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
 
+	json "github.com/json-iterator/go"
 	"golang.org/x/oauth2"
 )
 
 type OAuth2Provider string
 
 var (
+	// enabledProviders is replaced, never modified, so the maps returned by
+	// EnabledProvider can be read without the lock
+	enabledLock      sync.RWMutex
 	enabledProviders map[OAuth2Provider]ProviderInterface
 	allowedProviders = make(map[OAuth2Provider]ProviderInterface)
 )
 
 type UserInfo struct {
 	Username       string
-	ProviderUserID uint
+	ProviderUserID string
+	Email          string
+	// EmailVerified reports whether the provider has verified the email
+	EmailVerified bool
 }
 
+// InitOption configures a provider from the oauth2 config
+type InitOption struct {
+	ClientID, ClientSecret string
+	// RedirectURL is the callback registered with the provider, empty for its default
+	RedirectURL string
+	// Issuer is the url of the OpenID Connect issuer, only used by the oidc provider
+	Issuer string
+}
+
+// ProviderInterface is an OAuth2 login provider. Providers register themselves
+// with RegisterProvider from an init function, the ones listed in the oauth2
+// config are enabled at startup. InitProviders calls Init on a new zero value
+// of the registered type, so it must set up everything the provider needs.
 type ProviderInterface interface {
-	Init(ClientID, ClientSecret string)
+	Init(opt InitOption)
 	Provider() OAuth2Provider
-	NewConfig() *oauth2.Config
-	GetUserInfo(ctx context.Context, config *oauth2.Config, code string) (*UserInfo, error)
+	// NewAuthURL returns the url of the consent page of the provider
+	NewAuthURL(ctx context.Context, state string) (string, error)
+	// GetToken exchanges the code of the callback for a token
+	GetToken(ctx context.Context, code string) (*oauth2.Token, error)
+	// GetUserInfo maps the user the token belongs to
+	GetUserInfo(ctx context.Context, tk *oauth2.Token) (*UserInfo, error)
+}
+
+// OAuth2Base implements the consent page and the code exchange of
+// ProviderInterface with Config, providers embed it and set Config in Init
+type OAuth2Base struct {
+	Config oauth2.Config
+}
+
+func (b *OAuth2Base) NewAuthURL(ctx context.Context, state string) (string, error) {
+	return b.Config.AuthCodeURL(state, oauth2.AccessTypeOnline), nil
+}
+
+func (b *OAuth2Base) GetToken(ctx context.Context, code string) (*oauth2.Token, error) {
+	return b.Config.Exchange(ctx, code)
+}
+
+// Client returns a http client authorized by tk
+func (b *OAuth2Base) Client(ctx context.Context, tk *oauth2.Token) *http.Client {
+	return b.Config.Client(ctx, tk)
 }
 
-func InitProvider(p OAuth2Provider, ClientID, ClientSecret string) error {
+func InitProvider(p OAuth2Provider, opt InitOption) error {
 	pi, ok := allowedProviders[p]
 	if !ok {
 		return FormatErrNotImplemented(p)
 	}
-	pi.Init(ClientID, ClientSecret)
-	if enabledProviders == nil {
-		enabledProviders = make(map[OAuth2Provider]ProviderInterface)
+	pi.Init(opt)
+	enabledLock.Lock()
+	defer enabledLock.Unlock()
+	enabled := make(map[OAuth2Provider]ProviderInterface, len(enabledProviders)+1)
+	for k, v := range enabledProviders {
+		enabled[k] = v
 	}
-	enabledProviders[pi.Provider()] = pi
+	enabled[pi.Provider()] = pi
+	enabledProviders = enabled
 	return nil
 }
 
-func registerProvider(ps ...ProviderInterface) {
+// InitProviders enables exactly the providers of opts, with new instances so
+// the logins in progress finish with the provider they started with
+func InitProviders(opts map[OAuth2Provider]InitOption) error {
+	enabled := make(map[OAuth2Provider]ProviderInterface, len(opts))
+	for p, opt := range opts {
+		registered, ok := allowedProviders[p]
+		if !ok {
+			return FormatErrNotImplemented(p)
+		}
+		pi := reflect.New(reflect.TypeOf(registered).Elem()).Interface().(ProviderInterface)
+		pi.Init(opt)
+		enabled[p] = pi
+	}
+	enabledLock.Lock()
+	defer enabledLock.Unlock()
+	enabledProviders = enabled
+	return nil
+}
+
+// RegisterProvider makes providers available to the oauth2 config,
+// it panics if a provider with the same name is already registered
+func RegisterProvider(ps ...ProviderInterface) {
 	for _, p := range ps {
+		if _, ok := allowedProviders[p.Provider()]; ok {
+			panic(fmt.Sprintf("oauth2 provider %s registered twice", p.Provider()))
+		}
 		allowedProviders[p.Provider()] = p
 	}
 }
 
 func GetProvider(p OAuth2Provider) (ProviderInterface, error) {
+	enabledLock.RLock()
 	pi, ok := enabledProviders[p]
+	enabledLock.RUnlock()
 	if !ok {
 		return nil, FormatErrNotImplemented(p)
 	}
@@ -58,6 +134,8 @@ func AllowedProvider() map[OAuth2Provider]ProviderInterface {
 }
 
 func EnabledProvider() map[OAuth2Provider]ProviderInterface {
+	enabledLock.RLock()
+	defer enabledLock.RUnlock()
 	return enabledProviders
 }
 
@@ -66,3 +144,21 @@ type FormatErrNotImplemented string
 func (f FormatErrNotImplemented) Error() string {
 	return fmt.Sprintf("%s not implemented", string(f))
 }
+
+// getJSON decodes the json response of a GET to url into v
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s failed: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
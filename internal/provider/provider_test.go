@@ -0,0 +1,106 @@
+package provider_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/provider"
+	"golang.org/x/oauth2"
+)
+
+type fakeProvider struct {
+	provider.OAuth2Base
+}
+
+func (f *fakeProvider) Init(opt provider.InitOption) {
+	f.Config = oauth2.Config{
+		ClientID:     opt.ClientID,
+		ClientSecret: opt.ClientSecret,
+		Endpoint:     oauth2.Endpoint{AuthURL: "https://fake.example/authorize"},
+	}
+}
+
+func (f *fakeProvider) Provider() provider.OAuth2Provider {
+	return "fake"
+}
+
+func (f *fakeProvider) GetUserInfo(ctx context.Context, tk *oauth2.Token) (*provider.UserInfo, error) {
+	return &provider.UserInfo{Username: "fake"}, nil
+}
+
+func TestRegisterProvider(t *testing.T) {
+	provider.RegisterProvider(new(fakeProvider))
+	if _, err := provider.GetProvider("fake"); err == nil {
+		t.Fatal("a registered provider must not be enabled before InitProvider")
+	}
+	if err := provider.InitProvider("fake", provider.InitOption{ClientID: "id", ClientSecret: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	pi, err := provider.GetProvider("fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := pi.NewAuthURL(context.Background(), "state"); err != nil || got != "https://fake.example/authorize?access_type=online&client_id=id&response_type=code&state=state" {
+		t.Fatalf("auth url = %s, %v", got, err)
+	}
+	if err := provider.InitProvider("unknown", provider.InitOption{}); err == nil {
+		t.Fatal("enabling an unregistered provider should fail")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a provider twice should panic")
+		}
+	}()
+	provider.RegisterProvider(new(fakeProvider))
+}
+
+func TestOIDCProvider(t *testing.T) {
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":"%[1]s/authorize","token_endpoint":"%[1]s/token","userinfo_endpoint":"%[1]s/userinfo"}`, issuer)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" {
+			http.Error(w, "bad code", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"token","token_type":"Bearer"}`)
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"sub":"a1b2","preferred_username":"oidc-user","email":"oidc@example.com","email_verified":true}`)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+
+	o := new(provider.OIDCProvider)
+	o.Init(provider.InitOption{ClientID: "id", ClientSecret: "secret", Issuer: issuer + "/"})
+	ctx := context.Background()
+	url, err := o.NewAuthURL(ctx, "state")
+	if err != nil || !strings.HasPrefix(url, issuer+"/authorize?") {
+		t.Fatalf("auth url = %s, %v, want the discovered authorization endpoint", url, err)
+	}
+	tk, err := o.GetToken(ctx, "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ui, err := o.GetUserInfo(ctx, tk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := provider.UserInfo{Username: "oidc-user", ProviderUserID: "a1b2", Email: "oidc@example.com", EmailVerified: true}
+	if *ui != want {
+		t.Fatalf("user info = %+v, want %+v", *ui, want)
+	}
+}
@@ -0,0 +1,34 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/synctv-org/synctv/utils"
+)
+
+type UsernameFallback string
+
+const (
+	// use the local part of the email, and the provider id when there is no email
+	UsernameFallbackEmail UsernameFallback = "email"
+	// use `<provider>_<provider user id>`
+	UsernameFallbackProvider UsernameFallback = "provider"
+	// use a random username
+	UsernameFallbackRandom UsernameFallback = "random"
+)
+
+// FallbackUsername returns the username to use when the provider did not return a usable one.
+func (ui *UserInfo) FallbackUsername(p OAuth2Provider, f UsernameFallback) string {
+	switch f {
+	case UsernameFallbackEmail:
+		if local, _, ok := strings.Cut(ui.Email, "@"); ok && local != "" {
+			return local
+		}
+		return fmt.Sprintf("%s_%s", p, ui.ProviderUserID)
+	case UsernameFallbackRandom:
+		return fmt.Sprintf("user_%s", utils.RandString(8))
+	default:
+		return fmt.Sprintf("%s_%s", p, ui.ProviderUserID)
+	}
+}
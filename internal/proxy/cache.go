@@ -0,0 +1,296 @@
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// chunkSize is the unit media is fetched from the origin and cached in
+const chunkSize = 1 << 20
+
+var cache *DiskCache
+
+// InitCache caches proxied media in dir up to max bytes
+func InitCache(dir string, max int64) error {
+	c, err := NewDiskCache(dir, max)
+	if err != nil {
+		return err
+	}
+	cache = c
+	return nil
+}
+
+// Cache returns the media cache, nil when caching is disabled
+func Cache() *DiskCache {
+	return cache
+}
+
+// DiskCache keeps chunks of proxied media on disk and evicts the least recently used
+// when it grows over its size. Viewers of the same movie share the chunks, and a chunk
+// requested by several viewers at once is fetched from the origin only once.
+type DiskCache struct {
+	dir string
+	max int64
+
+	lock     sync.Mutex
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+	inflight map[string]*fetch
+}
+
+type cacheEntry struct {
+	name string
+	size int64
+}
+
+// fetch is a chunk being read from the origin. It runs on a context of its
+// own so the reader that started it going away does not fail the others,
+// and it is canceled once none of its readers wait for it anymore.
+type fetch struct {
+	done   chan struct{}
+	data   []byte
+	err    error
+	refs   int
+	cancel context.CancelFunc
+}
+
+// NewDiskCache opens the cache in dir, chunks left from before are kept
+func NewDiskCache(dir string, max int64) (*DiskCache, error) {
+	if max <= 0 {
+		return nil, errors.New("cache size must be positive")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &DiskCache{
+		dir:      dir,
+		max:      max,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		inflight: make(map[string]*fetch),
+	}
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(des))
+	for _, de := range des {
+		if de.IsDir() || strings.HasSuffix(de.Name(), ".tmp") {
+			continue
+		}
+		if info, err := de.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+	for _, info := range infos {
+		c.entries[info.Name()] = c.lru.PushFront(&cacheEntry{name: info.Name(), size: info.Size()})
+		c.size += info.Size()
+	}
+	c.lock.Lock()
+	c.evict()
+	c.lock.Unlock()
+	return c, nil
+}
+
+// SetMax sets the size the cache is kept under, evicting chunks if it shrinks
+func (c *DiskCache) SetMax(max int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.max = max
+	c.evict()
+}
+
+// Size returns the bytes cached
+func (c *DiskCache) Size() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.size
+}
+
+// get returns the cached chunk name, or the chunk read by load which is then
+// cached. It waits for the chunk until ctx is done, load gets the context of
+// the fetch shared by every reader of the chunk.
+func (c *DiskCache) get(ctx context.Context, name string, load func(context.Context) ([]byte, error)) ([]byte, error) {
+	c.lock.Lock()
+	if e, ok := c.entries[name]; ok {
+		c.lru.MoveToFront(e)
+		c.lock.Unlock()
+		data, err := os.ReadFile(filepath.Join(c.dir, name))
+		if err == nil {
+			return data, nil
+		}
+		c.lock.Lock()
+		c.remove(name)
+	}
+	f, ok := c.inflight[name]
+	if !ok {
+		fctx, cancel := context.WithCancel(context.Background())
+		f = &fetch{done: make(chan struct{}), cancel: cancel}
+		c.inflight[name] = f
+		go c.fetch(fctx, name, f, load)
+	}
+	f.refs++
+	c.lock.Unlock()
+
+	select {
+	case <-f.done:
+		return f.data, f.err
+	case <-ctx.Done():
+		c.lock.Lock()
+		f.refs--
+		if f.refs == 0 {
+			f.cancel()
+			// readers coming later start a new fetch
+			if c.inflight[name] == f {
+				delete(c.inflight, name)
+			}
+		}
+		c.lock.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (c *DiskCache) fetch(ctx context.Context, name string, f *fetch, load func(context.Context) ([]byte, error)) {
+	defer f.cancel()
+	f.data, f.err = load(ctx)
+	if f.err == nil {
+		f.err = c.put(name, f.data)
+	}
+	c.lock.Lock()
+	if c.inflight[name] == f {
+		delete(c.inflight, name)
+	}
+	c.lock.Unlock()
+	close(f.done)
+}
+
+func (c *DiskCache) put(name string, data []byte) error {
+	path := filepath.Join(c.dir, name)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[name] = c.lru.PushFront(&cacheEntry{name: name, size: int64(len(data))})
+	c.size += int64(len(data))
+	c.evict()
+	return nil
+}
+
+// evict removes the least recently used chunks until the cache fits, c.lock is held
+func (c *DiskCache) evict() {
+	for c.size > c.max && c.lru.Len() > 0 {
+		c.remove(c.lru.Back().Value.(*cacheEntry).name)
+	}
+}
+
+// remove drops a chunk, c.lock is held
+func (c *DiskCache) remove(name string) {
+	e, ok := c.entries[name]
+	if !ok {
+		return
+	}
+	c.lru.Remove(e)
+	delete(c.entries, name)
+	c.size -= e.Value.(*cacheEntry).size
+	os.Remove(filepath.Join(c.dir, name))
+}
+
+// Key identifies the media at url requested with headers in the cache. The
+// ETag and Last-Modified of the origin are part of it, so a changed media is
+// not served from the chunks of the old one.
+func Key(url string, headers map[string]string, etag, lastModified string) string {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	io.WriteString(h, url)
+	for _, k := range keys {
+		fmt.Fprintf(h, "\n%s: %s", k, headers[k])
+	}
+	fmt.Fprintf(h, "\n\nETag: %s\nLast-Modified: %s", etag, lastModified)
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// ReadSeeker reads the media key of length bytes through the cache until ctx
+// is done, chunks missing from it are read from the source open returns for
+// the context of the fetch
+func (c *DiskCache) ReadSeeker(ctx context.Context, key string, length int64, open func(context.Context) io.ReadSeeker) io.ReadSeeker {
+	return &cachedReadSeeker{ctx: ctx, cache: c, key: key, length: length, open: open}
+}
+
+type cachedReadSeeker struct {
+	ctx    context.Context
+	cache  *DiskCache
+	key    string
+	length int64
+	open   func(context.Context) io.ReadSeeker
+	offset int64
+}
+
+func (r *cachedReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.length {
+		return 0, io.EOF
+	}
+	idx := r.offset / chunkSize
+	data, err := r.cache.get(r.ctx, fmt.Sprintf("%s-%d", r.key, idx), func(ctx context.Context) ([]byte, error) {
+		start := idx * chunkSize
+		size := r.length - start
+		if size > chunkSize {
+			size = chunkSize
+		}
+		src := r.open(ctx)
+		if _, err := src.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(src, buf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	off := r.offset - idx*chunkSize
+	if off >= int64(len(data)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, data[off:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *cachedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.length
+	default:
+		return 0, errors.New("whence value error")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,145 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mediaProxy "github.com/synctv-org/synctv/internal/proxy"
+	"github.com/synctv-org/synctv/proxy"
+)
+
+func open(url string) func(context.Context) io.ReadSeeker {
+	return func(ctx context.Context) io.ReadSeeker {
+		return proxy.NewHttpReadSeeker(url, proxy.WithContext(ctx))
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	data := make([]byte, 5<<19) // 2.5 chunks
+	rand.New(rand.NewSource(1)).Read(data)
+	var requests int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.ServeContent(w, r, "movie.mp4", time.Time{}, bytes.NewReader(data))
+	}))
+	defer origin.Close()
+
+	dir := t.TempDir()
+	cache, err := mediaProxy.NewDiskCache(dir, 2<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := mediaProxy.Key(origin.URL, nil, "", "")
+
+	// viewers reading at the same time share the origin requests
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rs := cache.ReadSeeker(context.Background(), key, int64(len(data)), open(origin.URL))
+			got, err := io.ReadAll(rs)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("read through the cache differs from the origin")
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Fatalf("origin requests = %d, want one per chunk", n)
+	}
+
+	if size := cache.Size(); size > 2<<20 {
+		t.Fatalf("cache size = %d, want at most %d", size, 2<<20)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("cached chunks = %d, want 2 after eviction", len(files))
+	}
+
+	// a range in the cached tail is served without the origin
+	rs := cache.ReadSeeker(context.Background(), key, int64(len(data)), open(origin.URL))
+	if _, err := rs.Seek(-100, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	tail, err := io.ReadAll(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tail, data[len(data)-100:]) || atomic.LoadInt32(&requests) != 3 {
+		t.Fatalf("tail read from origin, requests = %d", atomic.LoadInt32(&requests))
+	}
+
+	// chunks survive a restart
+	reopened, err := mediaProxy.NewDiskCache(dir, 2<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Size() != cache.Size() {
+		t.Fatalf("reopened cache size = %d, want %d", reopened.Size(), cache.Size())
+	}
+}
+
+func TestDiskCacheCanceledReader(t *testing.T) {
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		http.ServeContent(w, r, "movie.mp4", time.Time{}, bytes.NewReader(data))
+	}))
+	defer origin.Close()
+
+	cache, err := mediaProxy.NewDiskCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := mediaProxy.Key(origin.URL, nil, `"v1"`, "")
+	if key == mediaProxy.Key(origin.URL, nil, `"v2"`, "") {
+		t.Fatal("media with another ETag has the same key")
+	}
+
+	// the reader starting the fetch goes away, the one waiting with it still gets the chunk
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(cache.ReadSeeker(ctx, key, int64(len(data)), open(origin.URL)))
+		first <- err
+	}()
+	<-started
+	second := make(chan []byte, 1)
+	go func() {
+		got, err := io.ReadAll(cache.ReadSeeker(context.Background(), key, int64(len(data)), open(origin.URL)))
+		if err != nil {
+			t.Error(err)
+		}
+		second <- got
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-first; err == nil {
+		t.Fatal("canceled reader should fail")
+	}
+	close(release)
+	if got := <-second; !bytes.Equal(got, data) {
+		t.Fatal("waiting reader did not get the chunk")
+	}
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	connectionRate atomic.Int64
+	roomRate       atomic.Int64
+	roomLimiters   sync.Map
+)
+
+// InitBandwidth caps the bytes per second sent to each proxied connection
+// and to all proxied connections of a room, 0 is unlimited. When called
+// again the connections already proxied keep their limits.
+func InitBandwidth(connection, room int64) {
+	connectionRate.Store(connection)
+	if roomRate.Swap(room) != room {
+		roomLimiters.Range(func(key, _ any) bool {
+			roomLimiters.Delete(key)
+			return true
+		})
+	}
+}
+
+// Limiter is a token bucket refilled rate tokens per second up to burst
+type Limiter struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter of rate bytes per second holding up to a
+// second of bytes
+func NewLimiter(rate int64) *Limiter {
+	return &Limiter{
+		rate:   float64(rate),
+		burst:  float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// NewBurstLimiter returns a limiter allowing burst events at once, then one
+// every interval
+func NewBurstLimiter(burst int, interval time.Duration) *Limiter {
+	return &Limiter{
+		rate:   float64(time.Second) / float64(interval),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (l *Limiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// reserve takes n tokens and returns how long until they are available
+func (l *Limiter) reserve(n int) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// Allow takes a token if one is available, it never waits
+func (l *Limiter) Allow() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.refill(time.Now())
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// WaitN blocks until n bytes may be sent
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	d := l.reserve(n)
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RemoveRoomLimiter drops the bandwidth limiter of the room, called when the
+// room is unloaded. Connections still proxied keep the limiter they have.
+func RemoveRoomLimiter(roomID string) {
+	roomLimiters.Delete(roomID)
+}
+
+func roomLimiter(roomID string) *Limiter {
+	if l, ok := roomLimiters.Load(roomID); ok {
+		return l.(*Limiter)
+	}
+	l, _ := roomLimiters.LoadOrStore(roomID, NewLimiter(roomRate.Load()))
+	return l.(*Limiter)
+}
+
+// LimitWriter caps the bandwidth of w, a proxied connection of the room,
+// w is returned as is when the bandwidth is unlimited
+func LimitWriter(ctx context.Context, w io.Writer, roomID string) io.Writer {
+	var limiters []*Limiter
+	if rate := connectionRate.Load(); rate > 0 {
+		limiters = append(limiters, NewLimiter(rate))
+	}
+	if roomRate.Load() > 0 {
+		limiters = append(limiters, roomLimiter(roomID))
+	}
+	if len(limiters) == 0 {
+		return w
+	}
+	return &limitedWriter{ctx: ctx, w: w, limiters: limiters}
+}
+
+type limitedWriter struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters []*Limiter
+}
+
+// maxWriteSize keeps single writes from draining a bucket far below zero
+const maxWriteSize = 32 * 1024
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		b := p
+		if len(b) > maxWriteSize {
+			b = b[:maxWriteSize]
+		}
+		for _, l := range w.limiters {
+			if err := l.WaitN(w.ctx, len(b)); err != nil {
+				return written, err
+			}
+		}
+		n, err := w.w.Write(b)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
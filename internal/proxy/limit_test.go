@@ -0,0 +1,90 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/proxy"
+)
+
+func TestLimitWriter(t *testing.T) {
+	proxy.InitBandwidth(256*1024, 0)
+	defer proxy.InitBandwidth(0, 0)
+
+	var buf bytes.Buffer
+	w := proxy.LimitWriter(context.Background(), &buf, "room")
+	start := time.Now()
+	// a second of bytes is sent at once, the rest at the rate
+	if _, err := io.Copy(w, bytes.NewReader(make([]byte, 384*1024))); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("sent 1.5s of bytes in %s", elapsed)
+	}
+	if buf.Len() != 384*1024 {
+		t.Fatalf("sent %d bytes, want %d", buf.Len(), 384*1024)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := proxy.LimitWriter(ctx, io.Discard, "room").Write(make([]byte, 512*1024)); err == nil {
+		t.Fatal("write over the rate succeeded after the connection closed")
+	}
+}
+
+func TestLimitWriterRoom(t *testing.T) {
+	proxy.InitBandwidth(0, 256*1024)
+	defer proxy.InitBandwidth(0, 0)
+
+	// connections of a room share its bandwidth
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		w := proxy.LimitWriter(context.Background(), io.Discard, "shared")
+		if _, err := w.Write(make([]byte, 128*1024)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("room sent 1.5s of bytes in %s", elapsed)
+	}
+
+	if w := proxy.LimitWriter(context.Background(), io.Discard, "other"); w == io.Discard {
+		t.Fatal("room limit not applied")
+	}
+
+	// an unloaded room starts over with a full bucket
+	proxy.RemoveRoomLimiter("shared")
+	start = time.Now()
+	if _, err := proxy.LimitWriter(context.Background(), io.Discard, "shared").Write(make([]byte, 128*1024)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("removed room limiter still applied, write took %s", elapsed)
+	}
+	proxy.InitBandwidth(0, 0)
+	if w := proxy.LimitWriter(context.Background(), io.Discard, "other"); w != io.Discard {
+		t.Fatal("unlimited writer wrapped")
+	}
+}
+
+func TestBurstLimiter(t *testing.T) {
+	l := proxy.NewBurstLimiter(3, 50*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if !l.Allow() {
+			t.Fatalf("event %d of the burst denied", i+1)
+		}
+	}
+	if l.Allow() {
+		t.Fatal("event over the burst allowed")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !l.Allow() {
+		t.Fatal("event after the interval denied")
+	}
+	if l.Allow() {
+		t.Fatal("a single interval refilled more than one event")
+	}
+}
@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"io"
+
+	"github.com/synctv-org/synctv/internal/metrics"
+)
+
+var sentBytes = metrics.NewCounter("proxy_sent_bytes_total", "Bytes sent to proxied connections.")
+
+// CountWriter counts what is written to w as sent by the proxy
+func CountWriter(w io.Writer) io.Writer {
+	return &countWriter{w: w}
+}
+
+type countWriter struct {
+	w io.Writer
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	sentBytes.Add(float64(n))
+	return n, err
+}
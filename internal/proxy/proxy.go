@@ -0,0 +1,157 @@
+// Package proxy remuxes sources browsers can't play, such as rtsp streams
+// and mkv files, into containers they can with ffmpeg. Streams are copied,
+// only audio is transcoded to aac, so remuxing is cheap.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrRemuxDisabled = errors.New("remuxing is disabled")
+	ErrRemuxBusy     = errors.New("too many movies are being remuxed, try again later")
+)
+
+var (
+	ffmpeg string
+	remux  bool
+	// slots caps the remuxes started by viewers, nil is unlimited
+	slots chan struct{}
+)
+
+// Init sets the ffmpeg binary, remuxing is enabled by enableRemux and at
+// most maxRemux movies are remuxed for viewers at once, 0 is unlimited
+func Init(path string, enableRemux bool, maxRemux int) {
+	ffmpeg, remux = path, enableRemux
+	slots = nil
+	if maxRemux > 0 {
+		slots = make(chan struct{}, maxRemux)
+	}
+}
+
+// AcquireRemux reserves a remux for a viewer, release gives it back. It
+// fails with ErrRemuxBusy when every remux is taken.
+func AcquireRemux() (release func(), err error) {
+	s := slots
+	if s == nil {
+		return func() {}, nil
+	}
+	select {
+	case s <- struct{}{}:
+		return func() { <-s }, nil
+	default:
+		return nil, ErrRemuxBusy
+	}
+}
+
+// FFmpeg returns the ffmpeg binary, empty when it is not installed
+func FFmpeg() string {
+	return ffmpeg
+}
+
+// Enabled reports whether sources can be remuxed
+func Enabled() bool {
+	return ffmpeg != "" && remux
+}
+
+// browserTypes are the containers browsers play without remuxing
+var browserTypes = map[string]struct{}{
+	"video/mp4":  {},
+	"video/webm": {},
+	"video/ogg":  {},
+}
+
+// NeedsRemux reports whether a source served with contentType has to be
+// remuxed for browsers, a missing or invalid type is served as it is
+func NeedsRemux(contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	_, ok := browserTypes[t]
+	return !ok
+}
+
+// inputArgs are the ffmpeg arguments reading the source at u from start seconds
+func inputArgs(u string, headers map[string]string, start float64) []string {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if pu, err := url.Parse(u); err == nil {
+		switch pu.Scheme {
+		case "rtsp", "rtsps":
+			args = append(args, "-rtsp_transport", "tcp")
+		case "http", "https":
+			if len(headers) != 0 {
+				var h strings.Builder
+				for k, v := range headers {
+					fmt.Fprintf(&h, "%s: %s\r\n", k, v)
+				}
+				args = append(args, "-headers", h.String())
+			}
+		}
+	}
+	if start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(start, 'f', 3, 64))
+	}
+	return append(args, "-i", u, "-c:v", "copy", "-c:a", "aac")
+}
+
+// RemuxMP4 writes the media at u from start seconds to w as fragmented mp4,
+// which plays while it is written
+func RemuxMP4(ctx context.Context, w io.Writer, u string, headers map[string]string, start float64) error {
+	if !Enabled() {
+		return ErrRemuxDisabled
+	}
+	args := append(inputArgs(u, headers, start),
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+		"-f", "mp4",
+		"pipe:1",
+	)
+	var stderr strings.Builder
+	cmd := exec.CommandContext(ctx, ffmpeg, args...)
+	cmd.Stdout, cmd.Stderr = w, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// RemuxFLV remuxes the live stream at u to flv, read from the returned reader,
+// for the live channels of rooms. Closing the reader stops ffmpeg.
+func RemuxFLV(ctx context.Context, u string, headers map[string]string) (io.ReadCloser, error) {
+	if !Enabled() {
+		return nil, ErrRemuxDisabled
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, ffmpeg, append(inputArgs(u, headers, 0), "-f", "flv", "pipe:1")...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &process{ReadCloser: stdout, cmd: cmd, cancel: cancel}, nil
+}
+
+type process struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+}
+
+func (p *process) Close() error {
+	p.cancel()
+	p.ReadCloser.Close()
+	p.cmd.Wait()
+	return nil
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestInputArgs(t *testing.T) {
+	got := inputArgs("rtsp://example.com/live", nil, 0)
+	want := []string{"-hide_banner", "-loglevel", "error", "-rtsp_transport", "tcp", "-i", "rtsp://example.com/live", "-c:v", "copy", "-c:a", "aac"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("rtsp args = %q, want %q", got, want)
+	}
+
+	got = inputArgs("https://example.com/a.mkv", map[string]string{"Referer": "https://example.com/"}, 12.5)
+	want = []string{"-hide_banner", "-loglevel", "error", "-headers", "Referer: https://example.com/\r\n", "-ss", "12.500", "-i", "https://example.com/a.mkv", "-c:v", "copy", "-c:a", "aac"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("http args = %q, want %q", got, want)
+	}
+}
+
+func TestNeedsRemux(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"video/mp4":                false,
+		"video/webm; codecs=vp9":   false,
+		"video/x-matroska":         true,
+		"video/x-flv":              true,
+		"application/octet-stream": true,
+		"":                         false,
+		"not a type":               false,
+	} {
+		if got := NeedsRemux(contentType); got != want {
+			t.Fatalf("NeedsRemux(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
+
+func TestAcquireRemux(t *testing.T) {
+	Init("ffmpeg", true, 1)
+	defer Init("", false, 0)
+	release, err := AcquireRemux()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireRemux(); err != ErrRemuxBusy {
+		t.Fatalf("second remux = %v, want ErrRemuxBusy", err)
+	}
+	release()
+	release, err = AcquireRemux()
+	if err != nil {
+		t.Fatalf("remux after release: %v", err)
+	}
+	release()
+}
+
+func TestDisabled(t *testing.T) {
+	Init("", true, 0)
+	if Enabled() {
+		t.Fatal("remuxing enabled without ffmpeg")
+	}
+	if _, err := RemuxFLV(context.Background(), "rtsp://example.com/live", nil); err != ErrRemuxDisabled {
+		t.Fatalf("RemuxFLV = %v, want ErrRemuxDisabled", err)
+	}
+}
@@ -0,0 +1,42 @@
+// Package requestid carries the id of a request in its context, so the logs
+// written while handling it, down to the database queries, can be correlated
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Field is the name of the log field holding the request id
+const Field = "request_id"
+
+type ctxKey struct{}
+
+// New returns a new random request id
+func New() string {
+	return uuid.NewString()
+}
+
+// WithID returns a copy of ctx carrying the request id
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request id of ctx, empty when it has none
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Log returns the standard logger with the request id of ctx as a field
+func Log(ctx context.Context) *log.Entry {
+	if id := FromContext(ctx); id != "" {
+		return log.WithField(Field, id)
+	}
+	return log.NewEntry(log.StandardLogger())
+}
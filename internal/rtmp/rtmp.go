@@ -20,7 +20,7 @@ type RtmpClaims struct {
 
 func AuthRtmpPublish(Authorization string) (channelName string, err error) {
 	t, err := jwt.ParseWithClaims(strings.TrimPrefix(Authorization, `Bearer `), &RtmpClaims{}, func(token *jwt.Token) (any, error) {
-		return stream.StringToBytes(conf.Conf.Jwt.Secret), nil
+		return stream.StringToBytes(conf.Conf().Jwt.Secret), nil
 	})
 	if err != nil {
 		return "", errors.New("auth failed")
@@ -39,7 +39,7 @@ func NewRtmpAuthorization(channelName string) (string, error) {
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(stream.StringToBytes(conf.Conf.Jwt.Secret))
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(stream.StringToBytes(conf.Conf().Jwt.Secret))
 }
 
 func Init(rs *rtmps.Server) {
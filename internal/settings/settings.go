@@ -0,0 +1,226 @@
+// Package settings holds the instance settings that admins change at runtime,
+// unlike the config file they are stored in the database and need no restart.
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+)
+
+// Type is the type of the value of a setting
+type Type string
+
+const (
+	TypeBool   Type = "bool"
+	TypeInt64  Type = "int64"
+	TypeString Type = "string"
+)
+
+var (
+	ErrUnknownSetting = errors.New("unknown setting")
+	ErrInvalidValue   = errors.New("invalid value")
+)
+
+// Setting is the untyped view of a Value, to list and change settings by name
+type Setting interface {
+	Name() string
+	Type() Type
+	// Interface returns the current value
+	Interface() any
+	// DefaultInterface returns the value used until the setting is changed
+	DefaultInterface() any
+	// check returns an error if s is not a valid value
+	check(s string) error
+	// set applies s and notifies the subscribers
+	set(s string) error
+}
+
+var settings = map[string]Setting{}
+
+func register(s Setting) {
+	if _, ok := settings[s.Name()]; ok {
+		panic("setting " + s.Name() + " registered twice")
+	}
+	settings[s.Name()] = s
+}
+
+// Value is a setting of type T, reading it takes no lock
+type Value[T bool | int64 | string] struct {
+	name     string
+	typ      Type
+	def      T
+	current  atomic.Pointer[T]
+	parse    func(string) (T, error)
+	validate func(T) error
+
+	mu       sync.Mutex
+	onChange []func(T)
+}
+
+func newValue[T bool | int64 | string](name string, typ Type, def T, parse func(string) (T, error), validate func(T) error) *Value[T] {
+	v := &Value[T]{
+		name:     name,
+		typ:      typ,
+		def:      def,
+		parse:    parse,
+		validate: validate,
+	}
+	register(v)
+	return v
+}
+
+func newBool(name string, def bool) *Value[bool] {
+	return newValue(name, TypeBool, def, strconv.ParseBool, nil)
+}
+
+func newInt64(name string, def int64, validate func(int64) error) *Value[int64] {
+	return newValue(name, TypeInt64, def, func(s string) (int64, error) {
+		return strconv.ParseInt(s, 10, 64)
+	}, validate)
+}
+
+func newString(name string, def string, validate func(string) error) *Value[string] {
+	return newValue(name, TypeString, def, func(s string) (string, error) {
+		return s, nil
+	}, validate)
+}
+
+func nonNegative(v int64) error {
+	if v < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+func (v *Value[T]) Name() string {
+	return v.name
+}
+
+func (v *Value[T]) Type() Type {
+	return v.typ
+}
+
+// Get returns the current value
+func (v *Value[T]) Get() T {
+	if p := v.current.Load(); p != nil {
+		return *p
+	}
+	return v.def
+}
+
+func (v *Value[T]) Interface() any {
+	return v.Get()
+}
+
+func (v *Value[T]) DefaultInterface() any {
+	return v.def
+}
+
+// OnChange calls f with the new value each time the setting changes,
+// so running subsystems can apply it
+func (v *Value[T]) OnChange(f func(T)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.onChange = append(v.onChange, f)
+}
+
+func (v *Value[T]) parseValue(s string) (T, error) {
+	t, err := v.parse(s)
+	if err == nil && v.validate != nil {
+		err = v.validate(t)
+	}
+	if err != nil {
+		return t, fmt.Errorf("%w of %s: %s", ErrInvalidValue, v.name, err.Error())
+	}
+	return t, nil
+}
+
+func (v *Value[T]) check(s string) error {
+	_, err := v.parseValue(s)
+	return err
+}
+
+func (v *Value[T]) set(s string) error {
+	t, err := v.parseValue(s)
+	if err != nil {
+		return err
+	}
+	old := v.Get()
+	v.current.Store(&t)
+	if old == t {
+		return nil
+	}
+	v.mu.Lock()
+	onChange := v.onChange
+	v.mu.Unlock()
+	for _, f := range onChange {
+		f(t)
+	}
+	return nil
+}
+
+// Get returns the setting with the name
+func Get(name string) (Setting, bool) {
+	s, ok := settings[name]
+	return s, ok
+}
+
+// List returns every setting ordered by name
+func List() []Setting {
+	list := make([]Setting, 0, len(settings))
+	for _, s := range settings {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
+
+// Init applies the values saved in the database, unknown or invalid ones
+// are logged and skipped so a downgrade does not prevent starting
+func Init() error {
+	saved, err := db.GetInstanceSettings()
+	if err != nil {
+		return err
+	}
+	for _, s := range saved {
+		setting, ok := settings[s.Name]
+		if !ok {
+			log.Warnf("unknown setting %s in database", s.Name)
+			continue
+		}
+		if err := setting.set(s.Value); err != nil {
+			log.Warnf("setting %s keeps its default: %s", s.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// Set checks the values by setting name, saves them and applies them, all of them or none
+func Set(values map[string]string) error {
+	for name, value := range values {
+		s, ok := settings[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownSetting, name)
+		}
+		if err := s.check(value); err != nil {
+			return err
+		}
+	}
+	if err := db.SaveInstanceSettings(values); err != nil {
+		return err
+	}
+	for name, value := range values {
+		// checked above
+		_ = settings[name].set(value)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package settings
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValue(t *testing.T) {
+	v := newInt64("test_value", 3, nonNegative)
+	var changes []int64
+	v.OnChange(func(n int64) {
+		changes = append(changes, n)
+	})
+
+	if v.Get() != 3 {
+		t.Fatalf("Get() = %d, want the default 3", v.Get())
+	}
+	if err := v.set("-1"); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("set(-1) = %v, want ErrInvalidValue", err)
+	}
+	if err := v.set("x"); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("set(x) = %v, want ErrInvalidValue", err)
+	}
+	for _, s := range []string{"5", "5", "3"} {
+		if err := v.set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v.Get() != 3 {
+		t.Fatalf("Get() = %d, want 3", v.Get())
+	}
+	if len(changes) != 2 || changes[0] != 5 || changes[1] != 3 {
+		t.Fatalf("changes = %v, want [5 3]", changes)
+	}
+
+	if s, ok := Get("test_value"); !ok || s.Type() != TypeInt64 || s.Interface() != int64(3) {
+		t.Fatal("setting is not registered")
+	}
+}
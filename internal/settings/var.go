@@ -0,0 +1,50 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// DisableCreateRoom stops users other than admins from creating rooms
+	DisableCreateRoom = newBool("disable_create_room", false)
+	// DisableGuest keeps visitors without an account out of every room,
+	// whatever the setting of the room
+	DisableGuest = newBool("disable_guest", false)
+	// MaxRoomsPerUser limits the rooms a user other than an admin may create,
+	// 0 for unlimited, see model.User.RoomQuota for the quota of a single user
+	MaxRoomsPerUser = newInt64("max_rooms_per_user", 0, nonNegative)
+)
+
+// Notice is shown to every visitor of the instance, empty for none
+var Notice = newString("notice", "", func(s string) error {
+	if len(s) > 1024 {
+		return errors.New("too long")
+	}
+	return nil
+})
+
+// CaptchaProviders are the names CaptchaProvider accepts
+var CaptchaProviders = []string{"hcaptcha", "recaptcha", "turnstile"}
+
+var (
+	// CaptchaProvider verifies the captcha of the endpoints enabled below,
+	// empty to disable captcha everywhere
+	CaptchaProvider = newString("captcha_provider", "", func(s string) error {
+		if s == "" {
+			return nil
+		}
+		for _, p := range CaptchaProviders {
+			if s == p {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown provider, one of %v", CaptchaProviders)
+	})
+	// CaptchaSiteKey is given to the clients to render the captcha
+	CaptchaSiteKey = newString("captcha_site_key", "", nil)
+	// CaptchaSignup requires a captcha to sign up
+	CaptchaSignup = newBool("captcha_signup", false)
+	// CaptchaCreateRoom requires a captcha to create a room
+	CaptchaCreateRoom = newBool("captcha_create_room", false)
+)
@@ -0,0 +1,356 @@
+// Package sfu forwards the audio of the participants of a voice channel to
+// each other through the server, so they only connect to the server and never
+// learn the addresses of each other.
+//
+// The server makes the offers. A participant answers them and trickles its
+// ice candidates, the server renegotiates each time a participant starts
+// sending or leaves. Each forwarded track has the id of its sender as stream id.
+package sfu
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	json "github.com/json-iterator/go"
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// The kinds of the signals between the server and a participant, the data
+// of an offer or answer is the sdp and the one of a candidate is the json of
+// a webrtc.ICECandidateInit
+const (
+	SignalOffer     = "offer"
+	SignalAnswer    = "answer"
+	SignalCandidate = "candidate"
+)
+
+var (
+	ErrInvalidSignal = errors.New("invalid voice signal")
+	ErrNotJoined     = errors.New("not in the voice channel")
+	ErrJoined        = errors.New("already in the voice channel")
+)
+
+type Config struct {
+	// ICEServers are the stun or turn urls the server gathers candidates with
+	ICEServers []string
+	// PublicIPs replace the host candidates of a server behind a 1:1 nat
+	PublicIPs []string
+	// UDPPortMin and UDPPortMax limit the media ports, zero picks any
+	UDPPortMin, UDPPortMax uint16
+}
+
+// SFU makes the connections of the voice channels
+type SFU struct {
+	api    *webrtc.API
+	config webrtc.Configuration
+}
+
+func New(c Config) (*SFU, error) {
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2, SDPFmtpLine: "minptime=10;useinbandfec=1"},
+		PayloadType:        111,
+	}, webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, err
+	}
+	i := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
+		return nil, err
+	}
+	s := webrtc.SettingEngine{}
+	if c.UDPPortMin != 0 || c.UDPPortMax != 0 {
+		if err := s.SetEphemeralUDPPortRange(c.UDPPortMin, c.UDPPortMax); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.PublicIPs) != 0 {
+		s.SetNAT1To1IPs(c.PublicIPs, webrtc.ICECandidateTypeHost)
+	}
+	var config webrtc.Configuration
+	if len(c.ICEServers) != 0 {
+		config.ICEServers = []webrtc.ICEServer{{URLs: c.ICEServers}}
+	}
+	return &SFU{
+		api:    webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithSettingEngine(s), webrtc.WithInterceptorRegistry(i)),
+		config: config,
+	}, nil
+}
+
+// Channel is a voice channel, every participant receives the audio of the others
+type Channel struct {
+	sfu    *SFU
+	lock   sync.Mutex
+	peers  map[string]*peer
+	tracks map[string]*webrtc.TrackLocalStaticRTP
+}
+
+func (s *SFU) NewChannel() *Channel {
+	return &Channel{
+		sfu:    s,
+		peers:  make(map[string]*peer),
+		tracks: make(map[string]*webrtc.TrackLocalStaticRTP),
+	}
+}
+
+type peer struct {
+	id     string
+	pc     *webrtc.PeerConnection
+	signal func(kind, data string) error
+
+	// lock serializes the negotiation, renegotiate is set when the
+	// tracks changed while an offer waits for its answer
+	lock        sync.Mutex
+	renegotiate bool
+	// senders forward the track of each other participant
+	senders map[string]*webrtc.RTPSender
+}
+
+// Join connects the participant id, signal sends the signals of the server
+// to it and closed is called when its connection fails
+func (c *Channel) Join(id string, signal func(kind, data string) error, closed func()) error {
+	pc, err := c.sfu.api.NewPeerConnection(c.sfu.config)
+	if err != nil {
+		return err
+	}
+	p := &peer{
+		id:      id,
+		pc:      pc,
+		signal:  signal,
+		senders: make(map[string]*webrtc.RTPSender),
+	}
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	}); err != nil {
+		pc.Close()
+		return err
+	}
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		b, err := json.Marshal(candidate.ToJSON())
+		if err != nil {
+			return
+		}
+		// after the offer the candidate belongs to
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if err := signal(SignalCandidate, string(b)); err != nil {
+			log.Debugf("sfu: send candidate to %s failed: %s", id, err.Error())
+		}
+	})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed {
+			closed()
+		}
+	})
+	pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		c.forward(id, remote)
+	})
+
+	c.lock.Lock()
+	if _, ok := c.peers[id]; ok {
+		c.lock.Unlock()
+		pc.Close()
+		return ErrJoined
+	}
+	for from, track := range c.tracks {
+		if err := p.addTrack(from, track); err != nil {
+			c.lock.Unlock()
+			pc.Close()
+			return err
+		}
+	}
+	c.peers[id] = p
+	c.lock.Unlock()
+
+	if err := p.negotiate(); err != nil {
+		c.Leave(id)
+		return err
+	}
+	return nil
+}
+
+// forward sends the audio of the participant from to the others until it leaves
+func (c *Channel) forward(from string, remote *webrtc.TrackRemote) {
+	track, err := webrtc.NewTrackLocalStaticRTP(remote.Codec().RTPCodecCapability, "audio", from)
+	if err != nil {
+		log.Errorf("sfu: forward the track of %s failed: %s", from, err.Error())
+		return
+	}
+	c.lock.Lock()
+	if _, ok := c.peers[from]; !ok {
+		c.lock.Unlock()
+		return
+	}
+	c.tracks[from] = track
+	peers := make([]*peer, 0, len(c.peers))
+	for id, p := range c.peers {
+		if id == from {
+			continue
+		}
+		if err := p.addTrack(from, track); err != nil {
+			log.Errorf("sfu: add the track of %s to %s failed: %s", from, id, err.Error())
+			continue
+		}
+		peers = append(peers, p)
+	}
+	c.lock.Unlock()
+	for _, p := range peers {
+		p.negotiateOrLog()
+	}
+
+	for {
+		pkt, _, err := remote.ReadRTP()
+		if err != nil {
+			return
+		}
+		if err := track.WriteRTP(pkt); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			return
+		}
+	}
+}
+
+// Leave disconnects the participant and stops forwarding its audio
+func (c *Channel) Leave(id string) {
+	c.lock.Lock()
+	p, ok := c.peers[id]
+	if !ok {
+		c.lock.Unlock()
+		return
+	}
+	delete(c.peers, id)
+	delete(c.tracks, id)
+	peers := make([]*peer, 0, len(c.peers))
+	for _, other := range c.peers {
+		if other.removeTrack(id) {
+			peers = append(peers, other)
+		}
+	}
+	c.lock.Unlock()
+	if err := p.pc.Close(); err != nil {
+		log.Debugf("sfu: close the connection of %s failed: %s", id, err.Error())
+	}
+	for _, p := range peers {
+		p.negotiateOrLog()
+	}
+}
+
+// Close disconnects every participant
+func (c *Channel) Close() {
+	c.lock.Lock()
+	peers := c.peers
+	c.peers = make(map[string]*peer)
+	c.tracks = make(map[string]*webrtc.TrackLocalStaticRTP)
+	c.lock.Unlock()
+	for _, p := range peers {
+		p.pc.Close()
+	}
+}
+
+// Signal takes an answer or a candidate of the participant id
+func (c *Channel) Signal(id, kind, data string) error {
+	c.lock.Lock()
+	p, ok := c.peers[id]
+	c.lock.Unlock()
+	if !ok {
+		return ErrNotJoined
+	}
+	switch kind {
+	case SignalAnswer:
+		return p.answer(data)
+	case SignalCandidate:
+		var candidate webrtc.ICECandidateInit
+		if err := json.UnmarshalFromString(data, &candidate); err != nil {
+			return ErrInvalidSignal
+		}
+		if err := p.pc.AddICECandidate(candidate); err != nil {
+			return ErrInvalidSignal
+		}
+		return nil
+	default:
+		return ErrInvalidSignal
+	}
+}
+
+func (p *peer) addTrack(from string, track *webrtc.TrackLocalStaticRTP) error {
+	sender, err := p.pc.AddTrack(track)
+	if err != nil {
+		return err
+	}
+	p.senders[from] = sender
+	// the interceptors need the rtcp to be read
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (p *peer) removeTrack(from string) bool {
+	sender, ok := p.senders[from]
+	if !ok {
+		return false
+	}
+	delete(p.senders, from)
+	if err := p.pc.RemoveTrack(sender); err != nil {
+		log.Debugf("sfu: remove the track of %s from %s failed: %s", from, p.id, err.Error())
+		return false
+	}
+	return true
+}
+
+// negotiate sends a new offer, or one after the pending offer is answered
+func (p *peer) negotiate() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.pc.SignalingState() != webrtc.SignalingStateStable {
+		p.renegotiate = true
+		return nil
+	}
+	return p.offer()
+}
+
+func (p *peer) negotiateOrLog() {
+	if err := p.negotiate(); err != nil {
+		log.Errorf("sfu: renegotiate with %s failed: %s", p.id, err.Error())
+	}
+}
+
+// offer must be called with the lock held
+func (p *peer) offer() error {
+	p.renegotiate = false
+	offer, err := p.pc.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+	if err := p.pc.SetLocalDescription(offer); err != nil {
+		return err
+	}
+	return p.signal(SignalOffer, offer.SDP)
+}
+
+func (p *peer) answer(sdp string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.pc.SignalingState() != webrtc.SignalingStateHaveLocalOffer {
+		return ErrInvalidSignal
+	}
+	if err := p.pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP:  sdp,
+	}); err != nil {
+		return ErrInvalidSignal
+	}
+	if p.renegotiate {
+		return p.offer()
+	}
+	return nil
+}
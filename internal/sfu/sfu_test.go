@@ -0,0 +1,160 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+
+	json "github.com/json-iterator/go"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// testClient is a browser joining the channel
+type testClient struct {
+	id     string
+	pc     *webrtc.PeerConnection
+	tracks chan string
+}
+
+func newTestClient(t *testing.T, c *Channel, id string) *testClient {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	tc := &testClient{id: id, pc: pc, tracks: make(chan string, 4)}
+	pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		tc.tracks <- remote.StreamID()
+	})
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		b, _ := json.Marshal(candidate.ToJSON())
+		go c.Signal(id, SignalCandidate, string(b))
+	})
+	signals := make(chan [2]string, 64)
+	go func() {
+		for s := range signals {
+			tc.handle(t, c, s[0], s[1])
+		}
+	}()
+	t.Cleanup(func() { close(signals) })
+	if err := c.Join(id, func(kind, data string) error {
+		signals <- [2]string{kind, data}
+		return nil
+	}, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	return tc
+}
+
+func (tc *testClient) handle(t *testing.T, c *Channel, kind, data string) {
+	switch kind {
+	case SignalOffer:
+		if err := tc.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: data}); err != nil {
+			t.Error(err)
+			return
+		}
+		answer, err := tc.pc.CreateAnswer(nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := tc.pc.SetLocalDescription(answer); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := c.Signal(tc.id, SignalAnswer, answer.SDP); err != nil {
+			t.Error(err)
+		}
+	case SignalCandidate:
+		var candidate webrtc.ICECandidateInit
+		if err := json.UnmarshalFromString(data, &candidate); err != nil {
+			t.Error(err)
+			return
+		}
+		tc.pc.AddICECandidate(candidate)
+	}
+}
+
+func TestChannel(t *testing.T) {
+	s, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.NewChannel()
+	defer c.Close()
+
+	listener := newTestClient(t, c, "listener")
+	if err := c.Join("listener", func(string, string) error { return nil }, func() {}); err != ErrJoined {
+		t.Fatalf("join twice: %v, want ErrJoined", err)
+	}
+
+	// the speaker has to send before its track is forwarded
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "speaker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	if _, err := pc.AddTrack(track); err != nil {
+		t.Fatal(err)
+	}
+	speaker := &testClient{id: "speaker", pc: pc, tracks: make(chan string, 4)}
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		b, _ := json.Marshal(candidate.ToJSON())
+		go c.Signal("speaker", SignalCandidate, string(b))
+	})
+	signals := make(chan [2]string, 64)
+	defer close(signals)
+	go func() {
+		for s := range signals {
+			speaker.handle(t, c, s[0], s[1])
+		}
+	}()
+	if err := c.Join("speaker", func(kind, data string) error {
+		signals <- [2]string{kind, data}
+		return nil
+	}, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				track.WriteSample(media.Sample{Data: []byte{0xf8, 0xff, 0xfe}, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+
+	select {
+	case id := <-listener.tracks:
+		if id != "speaker" {
+			t.Fatalf("forwarded track of %q, want the speaker", id)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the audio of the speaker was not forwarded")
+	}
+
+	if err := c.Signal("listener", SignalOffer, "sdp"); err != ErrInvalidSignal {
+		t.Fatalf("offer from a participant: %v, want ErrInvalidSignal", err)
+	}
+	c.Leave("speaker")
+	if err := c.Signal("speaker", SignalCandidate, "{}"); err != ErrNotJoined {
+		t.Fatalf("signal after leaving: %v, want ErrNotJoined", err)
+	}
+}
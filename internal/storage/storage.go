@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Storage keeps uploaded files by key, an object storage can implement it
+// to share the files between instances
+type Storage interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+var storage Storage
+
+func Init(s Storage) {
+	storage = s
+}
+
+// Default returns the storage of user uploads such as avatars, nil until Init
+func Default() Storage {
+	return storage
+}
+
+// DiskStorage keeps the files in a directory
+type DiskStorage struct {
+	dir string
+}
+
+func NewDiskStorage(dir string) (*DiskStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskStorage{dir: dir}, nil
+}
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+func (s *DiskStorage) path(key string) (string, error) {
+	if key == "" || filepath.Base(key) != key || key == "." || key == ".." {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+func (s *DiskStorage) Put(key string, data []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+func (s *DiskStorage) Get(key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (s *DiskStorage) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
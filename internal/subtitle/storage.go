@@ -0,0 +1,17 @@
+package subtitle
+
+import "github.com/synctv-org/synctv/internal/storage"
+
+// Storage keeps the subtitle files, see storage.Storage
+type Storage = storage.Storage
+
+var subtitleStorage Storage
+
+func Init(s Storage) {
+	subtitleStorage = s
+}
+
+// Default returns the storage subtitle files are kept in, nil until Init
+func Default() Storage {
+	return subtitleStorage
+}
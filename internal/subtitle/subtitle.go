@@ -0,0 +1,104 @@
+package subtitle
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format of a subtitle file, srt is converted to vtt when it is added
+type Format string
+
+const (
+	FormatSRT Format = "srt"
+	FormatVTT Format = "vtt"
+	FormatASS Format = "ass"
+)
+
+var (
+	ErrUnknownFormat = errors.New("subtitle must be a srt, vtt or ass file")
+	ErrInvalid       = errors.New("invalid subtitle file")
+)
+
+var bom = []byte("\ufeff")
+
+// Detect returns the format of the subtitle file name
+func Detect(name string) (Format, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".srt":
+		return FormatSRT, nil
+	case ".vtt":
+		return FormatVTT, nil
+	case ".ass", ".ssa":
+		return FormatASS, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatVTT:
+		return "text/vtt; charset=utf-8"
+	case FormatASS:
+		return "text/x-ssa; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Normalize checks a subtitle file and converts srt to vtt, which browsers play natively
+func Normalize(f Format, data []byte) (Format, []byte, error) {
+	data = bytes.TrimPrefix(data, bom)
+	if !utf8.Valid(data) {
+		return "", nil, errors.New("subtitle must be utf-8 encoded")
+	}
+	switch f {
+	case FormatSRT:
+		vtt, err := ToVTT(data)
+		return FormatVTT, vtt, err
+	case FormatVTT:
+		if !bytes.HasPrefix(data, []byte("WEBVTT")) {
+			return "", nil, ErrInvalid
+		}
+	case FormatASS:
+		if !bytes.Contains(data, []byte("[Script Info]")) {
+			return "", nil, ErrInvalid
+		}
+	default:
+		return "", nil, ErrUnknownFormat
+	}
+	return f, data, nil
+}
+
+// ToVTT converts a srt file to WebVTT, the cue numbers are kept as cue identifiers
+func ToVTT(srt []byte) ([]byte, error) {
+	text := strings.ReplaceAll(string(bytes.TrimPrefix(srt, bom)), "\r\n", "\n")
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	cues := 0
+	for _, block := range strings.Split(text, "\n\n") {
+		block = strings.Trim(block, "\n")
+		if block == "" {
+			continue
+		}
+		lines := strings.Split(block, "\n")
+		for i, line := range lines {
+			if !strings.Contains(line, "-->") {
+				continue
+			}
+			// srt separates milliseconds with a comma, vtt with a dot
+			lines[i] = strings.ReplaceAll(line, ",", ".")
+			cues++
+			break
+		}
+		b.WriteString(strings.Join(lines, "\n"))
+		b.WriteString("\n\n")
+	}
+	if cues == 0 {
+		return nil, ErrInvalid
+	}
+	return []byte(b.String()), nil
+}
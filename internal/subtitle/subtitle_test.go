@@ -0,0 +1,48 @@
+package subtitle_test
+
+import (
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/subtitle"
+)
+
+func TestToVTT(t *testing.T) {
+	srt := "\ufeff1\r\n00:00:01,000 --> 00:00:02,500\r\nHello, world\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nSecond\r\nline\r\n\r\n"
+	want := "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.500\nHello, world\n\n2\n00:00:03.000 --> 00:00:04.000\nSecond\nline\n\n"
+	got, err := subtitle.ToVTT([]byte(srt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("ToVTT() = %q, want %q", got, want)
+	}
+
+	if _, err := subtitle.ToVTT([]byte("not a subtitle")); err == nil {
+		t.Fatal("ToVTT() of a file without cues succeeded")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want subtitle.Format
+		err  bool
+	}{
+		{"movie.srt", "1\n00:00:01,000 --> 00:00:02,000\nhi\n", subtitle.FormatVTT, false},
+		{"movie.VTT", "WEBVTT\n\n00:01.000 --> 00:02.000\nhi\n", subtitle.FormatVTT, false},
+		{"movie.ssa", "[Script Info]\nTitle: movie\n", subtitle.FormatASS, false},
+		{"movie.vtt", "1\n00:00:01,000 --> 00:00:02,000\nhi\n", "", true},
+		{"movie.ass", "\xff\xfe", "", true},
+		{"movie.txt", "hi", "", true},
+	}
+	for _, tt := range tests {
+		f, err := subtitle.Detect(tt.name)
+		if err == nil {
+			f, _, err = subtitle.Normalize(f, []byte(tt.data))
+		}
+		if (err != nil) != tt.err || f != tt.want {
+			t.Errorf("%s: format = %q, err = %v, want %q", tt.name, f, err, tt.want)
+		}
+	}
+}
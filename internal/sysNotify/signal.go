@@ -16,9 +16,9 @@ func (s *SysNotify) Init() {
 
 func parseSysNotifyType(s os.Signal) NotifyType {
 	switch s {
-	case syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM:
+	case syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM:
 		return NotifyTypeEXIT
-	case syscall.SIGUSR1, syscall.SIGUSR2:
+	case syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2:
 		return NotifyTypeRELOAD
 	default:
 		return 0
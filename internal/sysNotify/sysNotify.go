@@ -59,11 +59,23 @@ func NewSysNotifyTask(name string, NotifyType NotifyType, task func() error) *sy
 	}
 }
 
+// runTask runs the tasks by priority, they stay queued for the next notify
 func runTask(tq *taskQueue) {
 	tq.notifyTaskLock.Lock()
 	defer tq.notifyTaskLock.Unlock()
+	type queued struct {
+		priority int
+		task     *sysNotifyTask
+	}
+	ran := make([]queued, 0, tq.notifyTaskQueue.Len())
+	defer func() {
+		for _, q := range ran {
+			tq.notifyTaskQueue.Push(q.priority, q.task)
+		}
+	}()
 	for tq.notifyTaskQueue.Len() > 0 {
-		_, task := tq.notifyTaskQueue.Pop()
+		priority, task := tq.notifyTaskQueue.Pop()
+		ran = append(ran, queued{priority, task})
 		func() {
 			defer func() {
 				if err := recover(); err != nil {
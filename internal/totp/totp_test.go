@@ -0,0 +1,61 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/totp"
+)
+
+// the sha1 test vectors of RFC 6238 appendix B, truncated to 6 digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		got, err := totp.Code(secret, totp.Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("code at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, err := totp.Code(secret, totp.Step(now.Add(-totp.Period)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, ok := totp.Validate(secret, code, now, 0)
+	if !ok || step != totp.Step(now)-1 {
+		t.Fatalf("code of the last period: %d, %v, want accepted", step, ok)
+	}
+	if _, ok := totp.Validate(secret, code, now, step); ok {
+		t.Fatal("a code was accepted twice")
+	}
+	if _, ok := totp.Validate(secret, code, now.Add(3*totp.Period), 0); ok {
+		t.Fatal("an old code was accepted")
+	}
+	if _, ok := totp.Validate(secret, "12345", now, 0); ok {
+		t.Fatal("a short code was accepted")
+	}
+
+	uri := totp.URI("SyncTV", "alice", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/SyncTV:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("uri = %s", uri)
+	}
+}
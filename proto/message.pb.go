@@ -23,19 +23,42 @@ const (
 type ElementMessageType int32
 
 const (
-	ElementMessageType_UNKNOWN        ElementMessageType = 0
-	ElementMessageType_ERROR          ElementMessageType = 1
-	ElementMessageType_CHAT_MESSAGE   ElementMessageType = 2
-	ElementMessageType_PLAY           ElementMessageType = 3
-	ElementMessageType_PAUSE          ElementMessageType = 4
-	ElementMessageType_CHECK_SEEK     ElementMessageType = 5
-	ElementMessageType_TOO_FAST       ElementMessageType = 6
-	ElementMessageType_TOO_SLOW       ElementMessageType = 7
-	ElementMessageType_CHANGE_RATE    ElementMessageType = 8
-	ElementMessageType_CHANGE_SEEK    ElementMessageType = 9
-	ElementMessageType_CHANGE_CURRENT ElementMessageType = 10
-	ElementMessageType_CHANGE_MOVIES  ElementMessageType = 11
-	ElementMessageType_CHANGE_PEOPLE  ElementMessageType = 12
+	ElementMessageType_UNKNOWN           ElementMessageType = 0
+	ElementMessageType_ERROR             ElementMessageType = 1
+	ElementMessageType_CHAT_MESSAGE      ElementMessageType = 2
+	ElementMessageType_PLAY              ElementMessageType = 3
+	ElementMessageType_PAUSE             ElementMessageType = 4
+	ElementMessageType_CHECK_SEEK        ElementMessageType = 5
+	ElementMessageType_TOO_FAST          ElementMessageType = 6
+	ElementMessageType_TOO_SLOW          ElementMessageType = 7
+	ElementMessageType_CHANGE_RATE       ElementMessageType = 8
+	ElementMessageType_CHANGE_SEEK       ElementMessageType = 9
+	ElementMessageType_CHANGE_CURRENT    ElementMessageType = 10
+	ElementMessageType_CHANGE_MOVIES     ElementMessageType = 11
+	ElementMessageType_CHANGE_PEOPLE     ElementMessageType = 12
+	ElementMessageType_COUNTDOWN         ElementMessageType = 13
+	ElementMessageType_ANNOUNCEMENT      ElementMessageType = 14
+	ElementMessageType_HELLO             ElementMessageType = 15
+	ElementMessageType_TICK              ElementMessageType = 16
+	ElementMessageType_SNAPSHOT          ElementMessageType = 17
+	ElementMessageType_PING              ElementMessageType = 18
+	ElementMessageType_PONG              ElementMessageType = 19
+	ElementMessageType_VOTE              ElementMessageType = 20
+	ElementMessageType_ENDED             ElementMessageType = 21
+	ElementMessageType_PLAY_MODE         ElementMessageType = 22
+	ElementMessageType_SUBTITLE          ElementMessageType = 23
+	ElementMessageType_DANMAKU           ElementMessageType = 24
+	ElementMessageType_CHAT_RETRACTED    ElementMessageType = 25
+	ElementMessageType_REACTION          ElementMessageType = 26
+	ElementMessageType_USER_JOINED       ElementMessageType = 27
+	ElementMessageType_USER_LEFT         ElementMessageType = 28
+	ElementMessageType_MENTION           ElementMessageType = 29
+	ElementMessageType_VOICE_JOIN        ElementMessageType = 30
+	ElementMessageType_VOICE_LEAVE       ElementMessageType = 31
+	ElementMessageType_VOICE_SIGNAL      ElementMessageType = 32
+	ElementMessageType_VOICE_SPEAKING    ElementMessageType = 33
+	ElementMessageType_DIRECT_MESSAGE    ElementMessageType = 34
+	ElementMessageType_SERVER_RESTARTING ElementMessageType = 35
 )
 
 // Enum value maps for ElementMessageType.
@@ -54,21 +77,67 @@ var (
 		10: "CHANGE_CURRENT",
 		11: "CHANGE_MOVIES",
 		12: "CHANGE_PEOPLE",
+		13: "COUNTDOWN",
+		14: "ANNOUNCEMENT",
+		15: "HELLO",
+		16: "TICK",
+		17: "SNAPSHOT",
+		18: "PING",
+		19: "PONG",
+		20: "VOTE",
+		21: "ENDED",
+		22: "PLAY_MODE",
+		23: "SUBTITLE",
+		24: "DANMAKU",
+		25: "CHAT_RETRACTED",
+		26: "REACTION",
+		27: "USER_JOINED",
+		28: "USER_LEFT",
+		29: "MENTION",
+		30: "VOICE_JOIN",
+		31: "VOICE_LEAVE",
+		32: "VOICE_SIGNAL",
+		33: "VOICE_SPEAKING",
+		34: "DIRECT_MESSAGE",
+		35: "SERVER_RESTARTING",
 	}
 	ElementMessageType_value = map[string]int32{
-		"UNKNOWN":        0,
-		"ERROR":          1,
-		"CHAT_MESSAGE":   2,
-		"PLAY":           3,
-		"PAUSE":          4,
-		"CHECK_SEEK":     5,
-		"TOO_FAST":       6,
-		"TOO_SLOW":       7,
-		"CHANGE_RATE":    8,
-		"CHANGE_SEEK":    9,
-		"CHANGE_CURRENT": 10,
-		"CHANGE_MOVIES":  11,
-		"CHANGE_PEOPLE":  12,
+		"UNKNOWN":           0,
+		"ERROR":             1,
+		"CHAT_MESSAGE":      2,
+		"PLAY":              3,
+		"PAUSE":             4,
+		"CHECK_SEEK":        5,
+		"TOO_FAST":          6,
+		"TOO_SLOW":          7,
+		"CHANGE_RATE":       8,
+		"CHANGE_SEEK":       9,
+		"CHANGE_CURRENT":    10,
+		"CHANGE_MOVIES":     11,
+		"CHANGE_PEOPLE":     12,
+		"COUNTDOWN":         13,
+		"ANNOUNCEMENT":      14,
+		"HELLO":             15,
+		"TICK":              16,
+		"SNAPSHOT":          17,
+		"PING":              18,
+		"PONG":              19,
+		"VOTE":              20,
+		"ENDED":             21,
+		"PLAY_MODE":         22,
+		"SUBTITLE":          23,
+		"DANMAKU":           24,
+		"CHAT_RETRACTED":    25,
+		"REACTION":          26,
+		"USER_JOINED":       27,
+		"USER_LEFT":         28,
+		"MENTION":           29,
+		"VOICE_JOIN":        30,
+		"VOICE_LEAVE":       31,
+		"VOICE_SIGNAL":      32,
+		"VOICE_SPEAKING":    33,
+		"DIRECT_MESSAGE":    34,
+		"SERVER_RESTARTING": 35,
 	}
 )
 
@@ -341,8 +410,9 @@ type Current struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Movie  *MovieInfo `protobuf:"bytes,1,opt,name=movie,proto3" json:"movie,omitempty"`
-	Status *Status    `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Movie    *MovieInfo `protobuf:"bytes,1,opt,name=movie,proto3" json:"movie,omitempty"`
+	Status   *Status    `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Subtitle uint64     `protobuf:"varint,3,opt,name=subtitle,proto3" json:"subtitle,omitempty"`
 }
 
 func (x *Current) Reset() {
@@ -391,25 +461,262 @@ func (x *Current) GetStatus() *Status {
 	return nil
 }
 
+func (x *Current) GetSubtitle() uint64 {
+	if x != nil {
+		return x.Subtitle
+	}
+	return 0
+}
+
+type Vote struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Action string `protobuf:"bytes,1,opt,name=action,proto3" json:"action,omitempty"`
+	Votes  int64  `protobuf:"varint,2,opt,name=votes,proto3" json:"votes,omitempty"`
+	Needed int64  `protobuf:"varint,3,opt,name=needed,proto3" json:"needed,omitempty"`
+	Passed bool   `protobuf:"varint,4,opt,name=passed,proto3" json:"passed,omitempty"`
+}
+
+func (x *Vote) Reset() {
+	*x = Vote{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_message_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Vote) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Vote) ProtoMessage() {}
+
+func (x *Vote) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Vote.ProtoReflect.Descriptor instead.
+func (*Vote) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Vote) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *Vote) GetVotes() int64 {
+	if x != nil {
+		return x.Votes
+	}
+	return 0
+}
+
+func (x *Vote) GetNeeded() int64 {
+	if x != nil {
+		return x.Needed
+	}
+	return 0
+}
+
+func (x *Vote) GetPassed() bool {
+	if x != nil {
+		return x.Passed
+	}
+	return false
+}
+
+type Danmaku struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id      uint64  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	MovieId uint64  `protobuf:"varint,2,opt,name=movieId,proto3" json:"movieId,omitempty"`
+	Time    float64 `protobuf:"fixed64,3,opt,name=time,proto3" json:"time,omitempty"`
+	Content string  `protobuf:"bytes,4,opt,name=content,proto3" json:"content,omitempty"`
+	Color   string  `protobuf:"bytes,5,opt,name=color,proto3" json:"color,omitempty"`
+}
+
+func (x *Danmaku) Reset() {
+	*x = Danmaku{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_message_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Danmaku) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Danmaku) ProtoMessage() {}
+
+func (x *Danmaku) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Danmaku.ProtoReflect.Descriptor instead.
+func (*Danmaku) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Danmaku) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Danmaku) GetMovieId() uint64 {
+	if x != nil {
+		return x.MovieId
+	}
+	return 0
+}
+
+func (x *Danmaku) GetTime() float64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+func (x *Danmaku) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *Danmaku) GetColor() string {
+	if x != nil {
+		return x.Color
+	}
+	return ""
+}
+
+type VoiceSignal struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Peer string `protobuf:"bytes,1,opt,name=peer,proto3" json:"peer,omitempty"`
+	Kind string `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	Data string `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *VoiceSignal) Reset() {
+	*x = VoiceSignal{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_message_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *VoiceSignal) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VoiceSignal) ProtoMessage() {}
+
+func (x *VoiceSignal) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VoiceSignal.ProtoReflect.Descriptor instead.
+func (*VoiceSignal) Descriptor() ([]byte, []int) {
+	return file_proto_message_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *VoiceSignal) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+func (x *VoiceSignal) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *VoiceSignal) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
 type ElementMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Type      ElementMessageType `protobuf:"varint,1,opt,name=type,proto3,enum=proto.ElementMessageType" json:"type,omitempty"`
-	Sender    string             `protobuf:"bytes,2,opt,name=sender,proto3" json:"sender,omitempty"`
-	Message   string             `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
-	Rate      float64            `protobuf:"fixed64,4,opt,name=rate,proto3" json:"rate,omitempty"`
-	Seek      float64            `protobuf:"fixed64,5,opt,name=seek,proto3" json:"seek,omitempty"`
-	Current   *Current           `protobuf:"bytes,6,opt,name=current,proto3" json:"current,omitempty"`
-	PeopleNum int64              `protobuf:"varint,7,opt,name=peopleNum,proto3" json:"peopleNum,omitempty"`
-	Time      int64              `protobuf:"varint,8,opt,name=time,proto3" json:"time,omitempty"`
+	Type         ElementMessageType `protobuf:"varint,1,opt,name=type,proto3,enum=proto.ElementMessageType" json:"type,omitempty"`
+	Sender       string             `protobuf:"bytes,2,opt,name=sender,proto3" json:"sender,omitempty"`
+	Message      string             `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Rate         float64            `protobuf:"fixed64,4,opt,name=rate,proto3" json:"rate,omitempty"`
+	Seek         float64            `protobuf:"fixed64,5,opt,name=seek,proto3" json:"seek,omitempty"`
+	Current      *Current           `protobuf:"bytes,6,opt,name=current,proto3" json:"current,omitempty"`
+	PeopleNum    int64              `protobuf:"varint,7,opt,name=peopleNum,proto3" json:"peopleNum,omitempty"`
+	Time         int64              `protobuf:"varint,8,opt,name=time,proto3" json:"time,omitempty"`
+	ScheduledAt  int64              `protobuf:"varint,9,opt,name=scheduledAt,proto3" json:"scheduledAt,omitempty"`
+	Version      uint32             `protobuf:"varint,10,opt,name=version,proto3" json:"version,omitempty"`
+	Capabilities []string           `protobuf:"bytes,11,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	Seq          uint64             `protobuf:"varint,12,opt,name=seq,proto3" json:"seq,omitempty"`
+	Chats        []*ElementMessage  `protobuf:"bytes,13,rep,name=chats,proto3" json:"chats,omitempty"`
+	Members      []string           `protobuf:"bytes,14,rep,name=members,proto3" json:"members,omitempty"`
+	Delay        int64              `protobuf:"varint,15,opt,name=delay,proto3" json:"delay,omitempty"`
+	Vote         *Vote              `protobuf:"bytes,16,opt,name=vote,proto3" json:"vote,omitempty"`
+	PlayMode     string             `protobuf:"bytes,17,opt,name=playMode,proto3" json:"playMode,omitempty"`
+	Subtitle     uint64             `protobuf:"varint,18,opt,name=subtitle,proto3" json:"subtitle,omitempty"`
+	Danmaku      *Danmaku           `protobuf:"bytes,19,opt,name=danmaku,proto3" json:"danmaku,omitempty"`
+	MessageId    uint64             `protobuf:"varint,20,opt,name=messageId,proto3" json:"messageId,omitempty"`
+	Reaction     string             `protobuf:"bytes,21,opt,name=reaction,proto3" json:"reaction,omitempty"`
+	Voice        *VoiceSignal       `protobuf:"bytes,22,opt,name=voice,proto3" json:"voice,omitempty"`
+	Speaking     bool               `protobuf:"varint,23,opt,name=speaking,proto3" json:"speaking,omitempty"`
+	SenderName   string             `protobuf:"bytes,24,opt,name=senderName,proto3" json:"senderName,omitempty"`
+	SenderAvatar string             `protobuf:"bytes,25,opt,name=senderAvatar,proto3" json:"senderAvatar,omitempty"`
 }
 
 func (x *ElementMessage) Reset() {
 	*x = ElementMessage{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_proto_message_proto_msgTypes[4]
+		mi := &file_proto_message_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -422,7 +729,7 @@ func (x *ElementMessage) String() string {
 func (*ElementMessage) ProtoMessage() {}
 
 func (x *ElementMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_message_proto_msgTypes[4]
+	mi := &file_proto_message_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -435,7 +742,7 @@ func (x *ElementMessage) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ElementMessage.ProtoReflect.Descriptor instead.
 func (*ElementMessage) Descriptor() ([]byte, []int) {
-	return file_proto_message_proto_rawDescGZIP(), []int{4}
+	return file_proto_message_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *ElementMessage) GetType() ElementMessageType {
@@ -494,6 +801,125 @@ func (x *ElementMessage) GetTime() int64 {
 	return 0
 }
 
+func (x *ElementMessage) GetScheduledAt() int64 {
+	if x != nil {
+		return x.ScheduledAt
+	}
+	return 0
+}
+
+func (x *ElementMessage) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *ElementMessage) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+func (x *ElementMessage) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ElementMessage) GetChats() []*ElementMessage {
+	if x != nil {
+		return x.Chats
+	}
+	return nil
+}
+
+func (x *ElementMessage) GetMembers() []string {
+	if x != nil {
+		return x.Members
+	}
+	return nil
+}
+
+func (x *ElementMessage) GetDelay() int64 {
+	if x != nil {
+		return x.Delay
+	}
+	return 0
+}
+
+func (x *ElementMessage) GetVote() *Vote {
+	if x != nil {
+		return x.Vote
+	}
+	return nil
+}
+
+func (x *ElementMessage) GetPlayMode() string {
+	if x != nil {
+		return x.PlayMode
+	}
+	return ""
+}
+
+func (x *ElementMessage) GetSubtitle() uint64 {
+	if x != nil {
+		return x.Subtitle
+	}
+	return 0
+}
+
+func (x *ElementMessage) GetDanmaku() *Danmaku {
+	if x != nil {
+		return x.Danmaku
+	}
+	return nil
+}
+
+func (x *ElementMessage) GetMessageId() uint64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *ElementMessage) GetReaction() string {
+	if x != nil {
+		return x.Reaction
+	}
+	return ""
+}
+
+func (x *ElementMessage) GetVoice() *VoiceSignal {
+	if x != nil {
+		return x.Voice
+	}
+	return nil
+}
+
+func (x *ElementMessage) GetSpeaking() bool {
+	if x != nil {
+		return x.Speaking
+	}
+	return false
+}
+
+func (x *ElementMessage) GetSenderName() string {
+	if x != nil {
+		return x.SenderName
+	}
+	return ""
+}
+
+func (x *ElementMessage) GetSenderAvatar() string {
+	if x != nil {
+		return x.SenderAvatar
+	}
+	return ""
+}
+
 var File_proto_message_proto protoreflect.FileDescriptor
 
 var file_proto_message_proto_rawDesc = []byte{
@@ -530,43 +956,118 @@ var file_proto_message_proto_rawDesc = []byte{
 	0x65, 0x65, 0x6b, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
 	0x01, 0x52, 0x04, 0x72, 0x61, 0x74, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x6c, 0x61, 0x79, 0x69,
 	0x6e, 0x67, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x70, 0x6c, 0x61, 0x79, 0x69, 0x6e,
-	0x67, 0x22, 0x58, 0x0a, 0x07, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x12, 0x26, 0x0a, 0x05,
+	0x67, 0x22, 0x74, 0x0a, 0x07, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x12, 0x26, 0x0a, 0x05,
 	0x6d, 0x6f, 0x76, 0x69, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x70, 0x72,
 	0x6f, 0x74, 0x6f, 0x2e, 0x4d, 0x6f, 0x76, 0x69, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x05, 0x6d,
 	0x6f, 0x76, 0x69, 0x65, 0x12, 0x25, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x02,
 	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0d, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x74, 0x61,
-	0x74, 0x75, 0x73, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x22, 0xf5, 0x01, 0x0a, 0x0e,
-	0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x2d,
-	0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x19, 0x2e, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73,
-	0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x16, 0x0a,
-	0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73,
-	0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12,
-	0x12, 0x0a, 0x04, 0x72, 0x61, 0x74, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x72,
-	0x61, 0x74, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x65, 0x6b, 0x18, 0x05, 0x20, 0x01, 0x28,
-	0x01, 0x52, 0x04, 0x73, 0x65, 0x65, 0x6b, 0x12, 0x28, 0x0a, 0x07, 0x63, 0x75, 0x72, 0x72, 0x65,
-	0x6e, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x2e, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x07, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e,
-	0x74, 0x12, 0x1c, 0x0a, 0x09, 0x70, 0x65, 0x6f, 0x70, 0x6c, 0x65, 0x4e, 0x75, 0x6d, 0x18, 0x07,
-	0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x70, 0x65, 0x6f, 0x70, 0x6c, 0x65, 0x4e, 0x75, 0x6d, 0x12,
-	0x12, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x74,
-	0x69, 0x6d, 0x65, 0x2a, 0xdb, 0x01, 0x0a, 0x12, 0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x4d,
-	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e,
-	0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x45, 0x52, 0x52, 0x4f, 0x52,
-	0x10, 0x01, 0x12, 0x10, 0x0a, 0x0c, 0x43, 0x48, 0x41, 0x54, 0x5f, 0x4d, 0x45, 0x53, 0x53, 0x41,
-	0x47, 0x45, 0x10, 0x02, 0x12, 0x08, 0x0a, 0x04, 0x50, 0x4c, 0x41, 0x59, 0x10, 0x03, 0x12, 0x09,
-	0x0a, 0x05, 0x50, 0x41, 0x55, 0x53, 0x45, 0x10, 0x04, 0x12, 0x0e, 0x0a, 0x0a, 0x43, 0x48, 0x45,
-	0x43, 0x4b, 0x5f, 0x53, 0x45, 0x45, 0x4b, 0x10, 0x05, 0x12, 0x0c, 0x0a, 0x08, 0x54, 0x4f, 0x4f,
-	0x5f, 0x46, 0x41, 0x53, 0x54, 0x10, 0x06, 0x12, 0x0c, 0x0a, 0x08, 0x54, 0x4f, 0x4f, 0x5f, 0x53,
-	0x4c, 0x4f, 0x57, 0x10, 0x07, 0x12, 0x0f, 0x0a, 0x0b, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f,
-	0x52, 0x41, 0x54, 0x45, 0x10, 0x08, 0x12, 0x0f, 0x0a, 0x0b, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45,
-	0x5f, 0x53, 0x45, 0x45, 0x4b, 0x10, 0x09, 0x12, 0x12, 0x0a, 0x0e, 0x43, 0x48, 0x41, 0x4e, 0x47,
-	0x45, 0x5f, 0x43, 0x55, 0x52, 0x52, 0x45, 0x4e, 0x54, 0x10, 0x0a, 0x12, 0x11, 0x0a, 0x0d, 0x43,
-	0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x4d, 0x4f, 0x56, 0x49, 0x45, 0x53, 0x10, 0x0b, 0x12, 0x11,
-	0x0a, 0x0d, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x50, 0x45, 0x4f, 0x50, 0x4c, 0x45, 0x10,
-	0x0c, 0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x33,
+	0x74, 0x75, 0x73, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x73,
+	0x75, 0x62, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x73,
+	0x75, 0x62, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x22, 0x64, 0x0a, 0x04, 0x56, 0x6f, 0x74, 0x65, 0x12,
+	0x16, 0x0a, 0x06, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x6f, 0x74, 0x65, 0x73,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x76, 0x6f, 0x74, 0x65, 0x73, 0x12, 0x16, 0x0a,
+	0x06, 0x6e, 0x65, 0x65, 0x64, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x6e,
+	0x65, 0x65, 0x64, 0x65, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x61, 0x73, 0x73, 0x65, 0x64, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x70, 0x61, 0x73, 0x73, 0x65, 0x64, 0x22, 0x77, 0x0a,
+	0x07, 0x44, 0x61, 0x6e, 0x6d, 0x61, 0x6b, 0x75, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x02, 0x69, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x6f, 0x76, 0x69,
+	0x65, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x6d, 0x6f, 0x76, 0x69, 0x65,
+	0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e,
+	0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74,
+	0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x6c, 0x6f, 0x72, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x63, 0x6f, 0x6c, 0x6f, 0x72, 0x22, 0x49, 0x0a, 0x0b, 0x56, 0x6f, 0x69, 0x63, 0x65, 0x53,
+	0x69, 0x67, 0x6e, 0x61, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x65, 0x65, 0x72, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x65, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x6b, 0x69, 0x6e,
+	0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x12, 0x12, 0x0a,
+	0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x64, 0x61, 0x74,
+	0x61, 0x22, 0x8b, 0x06, 0x0a, 0x0e, 0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73,
+	0x73, 0x61, 0x67, 0x65, 0x12, 0x2d, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0e, 0x32, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6c, 0x65, 0x6d, 0x65,
+	0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74,
+	0x79, 0x70, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x6d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x61, 0x74, 0x65, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x01, 0x52, 0x04, 0x72, 0x61, 0x74, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x65,
+	0x6b, 0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x73, 0x65, 0x65, 0x6b, 0x12, 0x28, 0x0a,
+	0x07, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x07,
+	0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x70, 0x65, 0x6f, 0x70, 0x6c,
+	0x65, 0x4e, 0x75, 0x6d, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x70, 0x65, 0x6f, 0x70,
+	0x6c, 0x65, 0x4e, 0x75, 0x6d, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x08, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x73, 0x63, 0x68,
+	0x65, 0x64, 0x75, 0x6c, 0x65, 0x64, 0x41, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0b,
+	0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x64, 0x41, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x76,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x76, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x22, 0x0a, 0x0c, 0x63, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c,
+	0x69, 0x74, 0x69, 0x65, 0x73, 0x18, 0x0b, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0c, 0x63, 0x61, 0x70,
+	0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71,
+	0x18, 0x0c, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x73, 0x65, 0x71, 0x12, 0x2b, 0x0a, 0x05, 0x63,
+	0x68, 0x61, 0x74, 0x73, 0x18, 0x0d, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x2e, 0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x52, 0x05, 0x63, 0x68, 0x61, 0x74, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x6d, 0x62,
+	0x65, 0x72, 0x73, 0x18, 0x0e, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x6d, 0x62, 0x65,
+	0x72, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x18, 0x0f, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x05, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x12, 0x1f, 0x0a, 0x04, 0x76, 0x6f, 0x74, 0x65,
+	0x18, 0x10, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x56,
+	0x6f, 0x74, 0x65, 0x52, 0x04, 0x76, 0x6f, 0x74, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x6c, 0x61,
+	0x79, 0x4d, 0x6f, 0x64, 0x65, 0x18, 0x11, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x70, 0x6c, 0x61,
+	0x79, 0x4d, 0x6f, 0x64, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x75, 0x62, 0x74, 0x69, 0x74, 0x6c,
+	0x65, 0x18, 0x12, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x73, 0x75, 0x62, 0x74, 0x69, 0x74, 0x6c,
+	0x65, 0x12, 0x28, 0x0a, 0x07, 0x64, 0x61, 0x6e, 0x6d, 0x61, 0x6b, 0x75, 0x18, 0x13, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x44, 0x61, 0x6e, 0x6d, 0x61,
+	0x6b, 0x75, 0x52, 0x07, 0x64, 0x61, 0x6e, 0x6d, 0x61, 0x6b, 0x75, 0x12, 0x1c, 0x0a, 0x09, 0x6d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x49, 0x64, 0x18, 0x14, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09,
+	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x61,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x15, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x61,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x28, 0x0a, 0x05, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x18, 0x16,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x56, 0x6f, 0x69,
+	0x63, 0x65, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x52, 0x05, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x12,
+	0x1a, 0x0a, 0x08, 0x73, 0x70, 0x65, 0x61, 0x6b, 0x69, 0x6e, 0x67, 0x18, 0x17, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x08, 0x73, 0x70, 0x65, 0x61, 0x6b, 0x69, 0x6e, 0x67, 0x12, 0x1e, 0x0a, 0x0a, 0x73,
+	0x65, 0x6e, 0x64, 0x65, 0x72, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x18, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0a, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x73,
+	0x65, 0x6e, 0x64, 0x65, 0x72, 0x41, 0x76, 0x61, 0x74, 0x61, 0x72, 0x18, 0x19, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0c, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x41, 0x76, 0x61, 0x74, 0x61, 0x72, 0x2a,
+	0xb3, 0x04, 0x0a, 0x12, 0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57,
+	0x4e, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x10, 0x01, 0x12, 0x10,
+	0x0a, 0x0c, 0x43, 0x48, 0x41, 0x54, 0x5f, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x10, 0x02,
+	0x12, 0x08, 0x0a, 0x04, 0x50, 0x4c, 0x41, 0x59, 0x10, 0x03, 0x12, 0x09, 0x0a, 0x05, 0x50, 0x41,
+	0x55, 0x53, 0x45, 0x10, 0x04, 0x12, 0x0e, 0x0a, 0x0a, 0x43, 0x48, 0x45, 0x43, 0x4b, 0x5f, 0x53,
+	0x45, 0x45, 0x4b, 0x10, 0x05, 0x12, 0x0c, 0x0a, 0x08, 0x54, 0x4f, 0x4f, 0x5f, 0x46, 0x41, 0x53,
+	0x54, 0x10, 0x06, 0x12, 0x0c, 0x0a, 0x08, 0x54, 0x4f, 0x4f, 0x5f, 0x53, 0x4c, 0x4f, 0x57, 0x10,
+	0x07, 0x12, 0x0f, 0x0a, 0x0b, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x52, 0x41, 0x54, 0x45,
+	0x10, 0x08, 0x12, 0x0f, 0x0a, 0x0b, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x53, 0x45, 0x45,
+	0x4b, 0x10, 0x09, 0x12, 0x12, 0x0a, 0x0e, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x43, 0x55,
+	0x52, 0x52, 0x45, 0x4e, 0x54, 0x10, 0x0a, 0x12, 0x11, 0x0a, 0x0d, 0x43, 0x48, 0x41, 0x4e, 0x47,
+	0x45, 0x5f, 0x4d, 0x4f, 0x56, 0x49, 0x45, 0x53, 0x10, 0x0b, 0x12, 0x11, 0x0a, 0x0d, 0x43, 0x48,
+	0x41, 0x4e, 0x47, 0x45, 0x5f, 0x50, 0x45, 0x4f, 0x50, 0x4c, 0x45, 0x10, 0x0c, 0x12, 0x0d, 0x0a,
+	0x09, 0x43, 0x4f, 0x55, 0x4e, 0x54, 0x44, 0x4f, 0x57, 0x4e, 0x10, 0x0d, 0x12, 0x10, 0x0a, 0x0c,
+	0x41, 0x4e, 0x4e, 0x4f, 0x55, 0x4e, 0x43, 0x45, 0x4d, 0x45, 0x4e, 0x54, 0x10, 0x0e, 0x12, 0x09,
+	0x0a, 0x05, 0x48, 0x45, 0x4c, 0x4c, 0x4f, 0x10, 0x0f, 0x12, 0x08, 0x0a, 0x04, 0x54, 0x49, 0x43,
+	0x4b, 0x10, 0x10, 0x12, 0x0c, 0x0a, 0x08, 0x53, 0x4e, 0x41, 0x50, 0x53, 0x48, 0x4f, 0x54, 0x10,
+	0x11, 0x12, 0x08, 0x0a, 0x04, 0x50, 0x49, 0x4e, 0x47, 0x10, 0x12, 0x12, 0x08, 0x0a, 0x04, 0x50,
+	0x4f, 0x4e, 0x47, 0x10, 0x13, 0x12, 0x08, 0x0a, 0x04, 0x56, 0x4f, 0x54, 0x45, 0x10, 0x14, 0x12,
+	0x09, 0x0a, 0x05, 0x45, 0x4e, 0x44, 0x45, 0x44, 0x10, 0x15, 0x12, 0x0d, 0x0a, 0x09, 0x50, 0x4c,
+	0x41, 0x59, 0x5f, 0x4d, 0x4f, 0x44, 0x45, 0x10, 0x16, 0x12, 0x0c, 0x0a, 0x08, 0x53, 0x55, 0x42,
+	0x54, 0x49, 0x54, 0x4c, 0x45, 0x10, 0x17, 0x12, 0x0b, 0x0a, 0x07, 0x44, 0x41, 0x4e, 0x4d, 0x41,
+	0x4b, 0x55, 0x10, 0x18, 0x12, 0x12, 0x0a, 0x0e, 0x43, 0x48, 0x41, 0x54, 0x5f, 0x52, 0x45, 0x54,
+	0x52, 0x41, 0x43, 0x54, 0x45, 0x44, 0x10, 0x19, 0x12, 0x0c, 0x0a, 0x08, 0x52, 0x45, 0x41, 0x43,
+	0x54, 0x49, 0x4f, 0x4e, 0x10, 0x1a, 0x12, 0x0f, 0x0a, 0x0b, 0x55, 0x53, 0x45, 0x52, 0x5f, 0x4a,
+	0x4f, 0x49, 0x4e, 0x45, 0x44, 0x10, 0x1b, 0x12, 0x0d, 0x0a, 0x09, 0x55, 0x53, 0x45, 0x52, 0x5f,
+	0x4c, 0x45, 0x46, 0x54, 0x10, 0x1c, 0x12, 0x0b, 0x0a, 0x07, 0x4d, 0x45, 0x4e, 0x54, 0x49, 0x4f,
+	0x4e, 0x10, 0x1d, 0x12, 0x0e, 0x0a, 0x0a, 0x56, 0x4f, 0x49, 0x43, 0x45, 0x5f, 0x4a, 0x4f, 0x49,
+	0x4e, 0x10, 0x1e, 0x12, 0x0f, 0x0a, 0x0b, 0x56, 0x4f, 0x49, 0x43, 0x45, 0x5f, 0x4c, 0x45, 0x41,
+	0x56, 0x45, 0x10, 0x1f, 0x12, 0x10, 0x0a, 0x0c, 0x56, 0x4f, 0x49, 0x43, 0x45, 0x5f, 0x53, 0x49,
+	0x47, 0x4e, 0x41, 0x4c, 0x10, 0x20, 0x12, 0x12, 0x0a, 0x0e, 0x56, 0x4f, 0x49, 0x43, 0x45, 0x5f,
+	0x53, 0x50, 0x45, 0x41, 0x4b, 0x49, 0x4e, 0x47, 0x10, 0x21, 0x12, 0x12, 0x0a, 0x0e, 0x44, 0x49,
+	0x52, 0x45, 0x43, 0x54, 0x5f, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x10, 0x22, 0x12, 0x15,
+	0x0a, 0x11, 0x53, 0x45, 0x52, 0x56, 0x45, 0x52, 0x5f, 0x52, 0x45, 0x53, 0x54, 0x41, 0x52, 0x54,
+	0x49, 0x4e, 0x47, 0x10, 0x23, 0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -582,28 +1083,35 @@ func file_proto_message_proto_rawDescGZIP() []byte {
 }
 
 var file_proto_message_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_proto_message_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_proto_message_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_proto_message_proto_goTypes = []interface{}{
 	(ElementMessageType)(0), // 0: proto.ElementMessageType
 	(*BaseMovieInfo)(nil),   // 1: proto.BaseMovieInfo
 	(*MovieInfo)(nil),       // 2: proto.MovieInfo
 	(*Status)(nil),          // 3: proto.Status
 	(*Current)(nil),         // 4: proto.Current
-	(*ElementMessage)(nil),  // 5: proto.ElementMessage
-	nil,                     // 6: proto.BaseMovieInfo.HeadersEntry
+	(*Vote)(nil),            // 5: proto.Vote
+	(*Danmaku)(nil),         // 6: proto.Danmaku
+	(*VoiceSignal)(nil),     // 7: proto.VoiceSignal
+	(*ElementMessage)(nil),  // 8: proto.ElementMessage
+	nil,                     // 9: proto.BaseMovieInfo.HeadersEntry
 }
 var file_proto_message_proto_depIdxs = []int32{
-	6, // 0: proto.BaseMovieInfo.headers:type_name -> proto.BaseMovieInfo.HeadersEntry
-	1, // 1: proto.MovieInfo.base:type_name -> proto.BaseMovieInfo
-	2, // 2: proto.Current.movie:type_name -> proto.MovieInfo
-	3, // 3: proto.Current.status:type_name -> proto.Status
-	0, // 4: proto.ElementMessage.type:type_name -> proto.ElementMessageType
-	4, // 5: proto.ElementMessage.current:type_name -> proto.Current
-	6, // [6:6] is the sub-list for method output_type
-	6, // [6:6] is the sub-list for method input_type
-	6, // [6:6] is the sub-list for extension type_name
-	6, // [6:6] is the sub-list for extension extendee
-	0, // [0:6] is the sub-list for field type_name
+	9,  // 0: proto.BaseMovieInfo.headers:type_name -> proto.BaseMovieInfo.HeadersEntry
+	1,  // 1: proto.MovieInfo.base:type_name -> proto.BaseMovieInfo
+	2,  // 2: proto.Current.movie:type_name -> proto.MovieInfo
+	3,  // 3: proto.Current.status:type_name -> proto.Status
+	0,  // 4: proto.ElementMessage.type:type_name -> proto.ElementMessageType
+	4,  // 5: proto.ElementMessage.current:type_name -> proto.Current
+	8,  // 6: proto.ElementMessage.chats:type_name -> proto.ElementMessage
+	5,  // 7: proto.ElementMessage.vote:type_name -> proto.Vote
+	6,  // 8: proto.ElementMessage.danmaku:type_name -> proto.Danmaku
+	7,  // 9: proto.ElementMessage.voice:type_name -> proto.VoiceSignal
+	10, // [10:10] is the sub-list for method output_type
+	10, // [10:10] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
 }
 
 func init() { file_proto_message_proto_init() }
@@ -661,6 +1169,42 @@ func file_proto_message_proto_init() {
 			}
 		}
 		file_proto_message_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Vote); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_message_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Danmaku); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_message_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VoiceSignal); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_message_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ElementMessage); i {
 			case 0:
 				return &v.state
@@ -679,7 +1223,7 @@ func file_proto_message_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_proto_message_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   6,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
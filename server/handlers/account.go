@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+// DeleteAccount schedules the deletion of the user and all its data, it can
+// be cancelled until deletionScheduledAt
+func DeleteAccount(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.DeleteAccountReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	at, err := user.ScheduleDeletion(req.Password, req.Code)
+	switch {
+	case errors.Is(err, op.ErrWrongPassword):
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, op.ErrDeleteRoot):
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, op.ErrDeletionScheduled):
+		ctx.AbortWithStatusJSON(http.StatusConflict, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, op.ErrInvalidTwoFactorCode), errors.Is(err, op.ErrTooManyTwoFactorAttempts):
+		abortTwoFactor(ctx, err)
+		return
+	case err != nil:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"deletionScheduledAt": model.Timestamp(at),
+	}))
+}
+
+func CancelDeleteAccount(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	if err := user.CancelDeletion(); err != nil {
+		if errors.Is(err, op.ErrDeletionNotScheduled) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ExportAccount downloads every record kept about the user as a json archive
+func ExportAccount(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	e, err := user.Export()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="synctv-%d.json"`, user.ID))
+	ctx.JSON(http.StatusOK, genUserExportResp(e))
+}
+
+func genUserExportResp(e *db.UserExport) *model.UserExportResp {
+	u := e.User
+	resp := &model.UserExportResp{
+		ExportedAt: time.Now().UnixMilli(),
+		Profile: model.UserExportProfile{
+			Id:            u.ID,
+			Username:      u.Username,
+			DisplayName:   u.DisplayName,
+			Avatar:        u.Avatar,
+			Bio:           u.Bio,
+			EmailVerified: u.EmailVerified,
+			Role:          u.Role,
+			TwoFactor:     u.TOTPEnabled,
+			TermsVersion:  u.TermsVersion,
+			CreatedAt:     model.Timestamp(u.CreatedAt),
+		},
+		Providers:       make([]model.UserExportProvider, len(e.Providers)),
+		Sessions:        make([]*model.SessionResp, len(e.Sessions)),
+		APIKeys:         make([]*model.APIKeyResp, len(e.APIKeys)),
+		UsernameChanges: newUsernameChangesResp(e.UsernameChanges),
+		Rooms:           make([]model.UserExportRoom, len(e.Rooms)),
+		Memberships:     make([]model.UserExportMembership, len(e.Memberships)),
+		Favorites:       make([]model.UserExportFavorite, len(e.Favorites)),
+		ChatMessages:    make([]model.UserExportChatMessage, len(e.ChatMessages)),
+		DirectMessages:  make([]*model.DirectMessageResp, len(e.DirectMessages)),
+		Danmakus:        make([]model.UserExportDanmaku, len(e.Danmakus)),
+		Movies:          make([]model.UserExportMovie, len(e.Movies)),
+		Subtitles:       make([]model.UserExportSubtitle, len(e.Subtitles)),
+	}
+	if u.Email != nil {
+		resp.Profile.Email = *u.Email
+	}
+	if u.DeletionScheduledAt != nil {
+		resp.Profile.DeletionScheduledAt = model.Timestamp(*u.DeletionScheduledAt)
+	}
+	for i, p := range e.Providers {
+		resp.Providers[i] = model.UserExportProvider{
+			Provider:       string(p.Provider),
+			ProviderUserId: p.ProviderUserID,
+			CreatedAt:      model.Timestamp(p.CreatedAt),
+		}
+	}
+	for i, s := range e.Sessions {
+		resp.Sessions[i] = genSessionResp(s)
+	}
+	for i, k := range e.APIKeys {
+		resp.APIKeys[i] = genAPIKeyResp(k)
+	}
+	for i, r := range e.Rooms {
+		resp.Rooms[i] = model.UserExportRoom{
+			Id:        r.ID,
+			Name:      r.Name,
+			Deleted:   r.DeletedAt.Valid,
+			CreatedAt: model.Timestamp(r.CreatedAt),
+		}
+	}
+	for i, r := range e.Memberships {
+		resp.Memberships[i] = model.UserExportMembership{
+			RoomId:      r.RoomID,
+			Role:        r.Role,
+			Permissions: r.Permissions,
+			JoinedAt:    model.Timestamp(r.CreatedAt),
+		}
+	}
+	for i, f := range e.Favorites {
+		resp.Favorites[i] = model.UserExportFavorite{
+			RoomId:    f.RoomID,
+			CreatedAt: model.Timestamp(f.CreatedAt),
+		}
+	}
+	for i, m := range e.ChatMessages {
+		resp.ChatMessages[i] = model.UserExportChatMessage{
+			Id:        m.ID,
+			RoomId:    m.RoomID,
+			Content:   m.Content,
+			CreatedAt: model.Timestamp(m.CreatedAt),
+		}
+	}
+	for i, m := range e.DirectMessages {
+		resp.DirectMessages[i] = genDirectMessageResp(m)
+	}
+	for i, d := range e.Danmakus {
+		resp.Danmakus[i] = model.UserExportDanmaku{
+			Id:        d.ID,
+			RoomId:    d.RoomID,
+			MovieId:   d.MovieID,
+			Time:      d.Time,
+			Content:   d.Content,
+			Color:     d.Color,
+			CreatedAt: model.Timestamp(d.CreatedAt),
+		}
+	}
+	for i, m := range e.Movies {
+		resp.Movies[i] = model.UserExportMovie{
+			Id:        m.ID,
+			RoomId:    m.RoomID,
+			Name:      m.Name,
+			Url:       m.Url,
+			CreatedAt: model.Timestamp(m.CreatedAt),
+		}
+	}
+	for i, s := range e.Subtitles {
+		resp.Subtitles[i] = model.UserExportSubtitle{
+			Id:        s.ID,
+			RoomId:    s.RoomID,
+			MovieId:   s.MovieID,
+			Name:      s.Name,
+			CreatedAt: model.Timestamp(s.CreatedAt),
+		}
+	}
+	return resp
+}
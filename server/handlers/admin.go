@@ -0,0 +1,592 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/db/backup"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/requestid"
+	"github.com/synctv-org/synctv/internal/settings"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+// AdminRestoreRoom restores a soft deleted room
+func AdminRestoreRoom(ctx *gin.Context) {
+	req := model.RoomIdReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := op.RestoreRoom(req.RoomId); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// AdminRooms lists every room, hidden ones included, filtered by the keyword
+// query. deleted=true lists the soft deleted rooms instead.
+func AdminRooms(ctx *gin.Context) {
+	page, max, err := GetPageAndMax(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if page <= 0 || max <= 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("page and max must be greater than 0"))
+		return
+	}
+
+	sortBy := db.RoomsSort(ctx.DefaultQuery("sort", string(db.RoomsSortCreatedAt)))
+	switch sortBy {
+	case db.RoomsSortCreator, db.RoomsSortCreatedAt, db.RoomsSortName, db.RoomsSortID, db.RoomsSortNeedPassword:
+	default:
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("unknown sort"))
+		return
+	}
+
+	var desc bool
+	switch ctx.DefaultQuery("order", "desc") {
+	case "asc":
+	case "desc":
+		desc = true
+	default:
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("order must be asc or desc"))
+		return
+	}
+
+	filters := []db.GetRoomsConfig{db.WithRoomsOrder(sortBy, desc)}
+	if keyword := strings.TrimSpace(ctx.Query("keyword")); keyword != "" {
+		if len(keyword) > 32 {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("keyword is too long"))
+			return
+		}
+		filters = append(filters, db.WithKeyword(keyword))
+	}
+	deleted, err := strconv.ParseBool(ctx.DefaultQuery("deleted", "false"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if deleted {
+		filters = append(filters, db.WithDeletedRooms())
+	}
+
+	rooms, total, err := db.GetRoomsPaginated(int((page-1)*max), int(max), filters...)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	list := make([]*model.AdminRoomResp, len(rooms))
+	for i, r := range genRoomListResp(rooms) {
+		list[i] = &model.AdminRoomResp{
+			RoomListResp: r,
+			Hidden:       rooms[i].Hidden,
+		}
+		if rooms[i].DeletedAt.Valid {
+			list[i].DeletedAt = model.Timestamp(rooms[i].DeletedAt.Time)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"total": total,
+		"list":  list,
+	}))
+}
+
+// adminTargetRoom decodes the room of the request, it aborts when it fails
+func adminTargetRoom(ctx *gin.Context) (*op.Room, bool) {
+	req := model.RoomIdReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return nil, false
+	}
+	room, err := op.GetRoomByID(req.RoomId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return nil, false
+	}
+	return room, true
+}
+
+// AdminDeleteRoom deletes a room whoever created it, its clients are disconnected
+func AdminDeleteRoom(ctx *gin.Context) {
+	room, ok := adminTargetRoom(ctx)
+	if !ok {
+		return
+	}
+	if err := op.DeleteRoom(room); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func adminSetRoomHidden(ctx *gin.Context, hidden bool) {
+	room, ok := adminTargetRoom(ctx)
+	if !ok {
+		return
+	}
+	if err := room.SetHidden(hidden); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// AdminHideRoom removes a room from the public room list
+func AdminHideRoom(ctx *gin.Context) {
+	adminSetRoomHidden(ctx, true)
+}
+
+func AdminShowRoom(ctx *gin.Context) {
+	adminSetRoomHidden(ctx, false)
+}
+
+// AdminClearRoomPassword removes the password of a room
+func AdminClearRoomPassword(ctx *gin.Context) {
+	room, ok := adminTargetRoom(ctx)
+	if !ok {
+		return
+	}
+	if !room.NeedPassword() {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("room has no password"))
+		return
+	}
+	if err := room.SetPassword(""); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func AdminSettings(ctx *gin.Context) {
+	list := settings.List()
+	resp := make([]*model.SettingResp, len(list))
+	for i, s := range list {
+		resp[i] = &model.SettingResp{
+			Name:    s.Name(),
+			Type:    string(s.Type()),
+			Value:   s.Interface(),
+			Default: s.DefaultInterface(),
+		}
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(resp))
+}
+
+// AdminSetSettings changes instance settings, the running instance applies them at once
+func AdminSetSettings(ctx *gin.Context) {
+	req := model.SetSettingsReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := op.SetSettings(req.Values()); err != nil {
+		if errors.Is(err, settings.ErrUnknownSetting) || errors.Is(err, settings.ErrInvalidValue) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// AdminReloadConfig reads the config file again and applies it like SIGHUP,
+// the log tells which changes need a restart
+func AdminReloadConfig(ctx *gin.Context) {
+	if err := conf.Reload(); err != nil {
+		if errors.Is(err, conf.ErrReloadUnsupported) {
+			ctx.AbortWithStatusJSON(http.StatusNotImplemented, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// AdminBackup downloads a backup of the database, see AdminRestore. Uploaded
+// files are not included. It is streamed, a failure after the first bytes
+// only ends the download early.
+func AdminBackup(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="synctv-backup-%s.zip"`, time.Now().Format("20060102-150405")))
+	ctx.Status(http.StatusOK)
+	if _, err := backup.Backup(ctx.Request.Context(), db.DB(), ctx.Writer); err != nil {
+		requestid.Log(ctx.Request.Context()).Errorf("backup failed: %v", err)
+		if !ctx.Writer.Written() {
+			ctx.Writer.Header().Del("Content-Disposition")
+			ctx.Writer.Header().Del("Content-Type")
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		}
+	}
+}
+
+// AdminRestore loads the uploaded backup file into the database, the form
+// value replace empties the database first. The rooms are unloaded and the
+// caches emptied before and after, so the running server neither writes its
+// state over the restored rows nor serves the replaced ones.
+func AdminRestore(ctx *gin.Context) {
+	fh, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	replace, _ := strconv.ParseBool(ctx.PostForm("replace"))
+	f, err := fh.Open()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	defer f.Close()
+
+	op.Reset()
+	m, err := backup.Restore(ctx.Request.Context(), db.DB(), f, fh.Size, replace)
+	op.Reset()
+	if err != nil {
+		switch {
+		case errors.Is(err, backup.ErrInvalidArchive), errors.Is(err, backup.ErrNewerSchema):
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		case errors.Is(err, backup.ErrNotEmpty):
+			ctx.AbortWithStatusJSON(http.StatusConflict, model.NewApiErrorResp(err))
+		default:
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		}
+		return
+	}
+	if err := settings.Init(); err != nil {
+		requestid.Log(ctx.Request.Context()).Errorf("reload settings failed: %v", err)
+	}
+	requestid.Log(ctx.Request.Context()).Infof("restored the backup of %s", m.CreatedAt.Format(time.RFC3339))
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(m))
+}
+
+// AdminUsernameChanges lists the renames from or to the username query,
+// to trace who used a name before
+func AdminUsernameChanges(ctx *gin.Context) {
+	username := ctx.Query("username")
+	if username == "" {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("username is empty"))
+		return
+	}
+
+	changes, err := op.UsernameChangesByName(username)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(newUsernameChangesResp(changes)))
+}
+
+func genAdminUserResp(u *dbModel.User) *model.AdminUserResp {
+	resp := &model.AdminUserResp{
+		Id:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Role:        u.Role.String(),
+		TwoFactor:   u.TOTPEnabled,
+		Pending:     u.Pending,
+		RoomQuota:   u.RoomQuota,
+		CreatedAt:   model.Timestamp(u.CreatedAt),
+	}
+	if u.Email != nil {
+		resp.Email = *u.Email
+	}
+	if u.DeletionScheduledAt != nil {
+		resp.DeletionScheduledAt = model.Timestamp(*u.DeletionScheduledAt)
+	}
+	return resp
+}
+
+// AdminUsers lists the users, filtered by the keyword and role queries
+func AdminUsers(ctx *gin.Context) {
+	page, max, err := GetPageAndMax(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if page <= 0 || max <= 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("page and max must be greater than 0"))
+		return
+	}
+
+	var filters []db.GetUsersConfig
+	if keyword := strings.TrimSpace(ctx.Query("keyword")); keyword != "" {
+		if len(keyword) > 64 {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("keyword is too long"))
+			return
+		}
+		filters = append(filters, db.WithUserKeyword(keyword))
+	}
+	if r := ctx.Query("role"); r != "" {
+		role, err := dbModel.ParseRole(r)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+			return
+		}
+		filters = append(filters, db.WithUserRole(role))
+	}
+
+	users, total, err := op.GetUsers(int((page-1)*max), int(max), filters...)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	list := make([]*model.AdminUserResp, len(users))
+	for i, u := range users {
+		list[i] = genAdminUserResp(u)
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"total": total,
+		"list":  list,
+	}))
+}
+
+// AdminLockouts lists the ips and accounts locked out for failed logins
+func AdminLockouts(ctx *gin.Context) {
+	page, max, err := GetPageAndMax(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if page <= 0 || max <= 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("page and max must be greater than 0"))
+		return
+	}
+
+	attempts, total, err := op.GetLockedLogins(int((page-1)*max), int(max))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	list := make([]*model.LoginLockResp, len(attempts))
+	for i, a := range attempts {
+		list[i] = &model.LoginLockResp{
+			Key:         a.Key,
+			Failures:    a.Failures,
+			LastFailure: model.Timestamp(a.LastFailure),
+			LockedUntil: model.Timestamp(a.LockedUntil),
+		}
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"total": total,
+		"list":  list,
+	}))
+}
+
+// AdminUnlock lifts the lockout of an ip or account
+func AdminUnlock(ctx *gin.Context) {
+	req := model.UnlockLoginReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := op.ResetLoginFailures(ctx.Request.Context(), req.Key); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// adminTargetUser decodes the user of the request, it aborts when it fails
+func adminTargetUser(ctx *gin.Context) (*op.User, bool) {
+	req := model.UserIdReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return nil, false
+	}
+	target, err := op.GetUserById(req.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return nil, false
+	}
+	return target, true
+}
+
+func abortManageUser(ctx *gin.Context, err error) {
+	if errors.Is(err, op.ErrCannotManage) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
+	ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+}
+
+// adminSetRole moves the user of the request from the role from to the role to
+func adminSetRole(ctx *gin.Context, from, to dbModel.Role) {
+	user := ctx.MustGet("user").(*op.User)
+
+	target, ok := adminTargetUser(ctx)
+	if !ok {
+		return
+	}
+	if target.Role != from {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("user is not "+from.String()))
+		return
+	}
+	if err := user.SetUserRole(target, to); err != nil {
+		abortManageUser(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// AdminBanUser bans a user, it is logged out and can't log in until unbanned
+func AdminBanUser(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	target, ok := adminTargetUser(ctx)
+	if !ok {
+		return
+	}
+	if target.IsBanned() {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("user is already banned"))
+		return
+	}
+	if err := user.SetUserRole(target, dbModel.RoleBanned); err != nil {
+		abortManageUser(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func AdminUnbanUser(ctx *gin.Context) {
+	adminSetRole(ctx, dbModel.RoleBanned, dbModel.RoleUser)
+}
+
+// AdminPromoteUser makes a user an admin, only root users can
+func AdminPromoteUser(ctx *gin.Context) {
+	adminSetRole(ctx, dbModel.RoleUser, dbModel.RoleAdmin)
+}
+
+// AdminDemoteUser makes an admin a user, only root users can
+func AdminDemoteUser(ctx *gin.Context) {
+	adminSetRole(ctx, dbModel.RoleAdmin, dbModel.RoleUser)
+}
+
+// AdminPendingUsers lists the users waiting for approval, oldest first
+func AdminPendingUsers(ctx *gin.Context) {
+	page, max, err := GetPageAndMax(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if page <= 0 || max <= 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("page and max must be greater than 0"))
+		return
+	}
+
+	users, total, err := op.GetPendingUsers(int((page-1)*max), int(max))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	list := make([]*model.AdminUserResp, len(users))
+	for i, u := range users {
+		list[i] = genAdminUserResp(u)
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"total": total,
+		"list":  list,
+	}))
+}
+
+// adminReviewUser approves or rejects the pending user of the request
+func adminReviewUser(ctx *gin.Context, approve bool) {
+	user := ctx.MustGet("user").(*op.User)
+
+	target, ok := adminTargetUser(ctx)
+	if !ok {
+		return
+	}
+	var err error
+	if approve {
+		err = user.ApproveUser(target)
+	} else {
+		err = user.RejectUser(target)
+	}
+	if errors.Is(err, op.ErrUserNotPending) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if err != nil {
+		abortManageUser(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func AdminApproveUser(ctx *gin.Context) {
+	adminReviewUser(ctx, true)
+}
+
+// AdminRejectUser deletes a pending user and all its data
+func AdminRejectUser(ctx *gin.Context) {
+	adminReviewUser(ctx, false)
+}
+
+// AdminSetRoomQuota overrides the number of rooms a user may create
+func AdminSetRoomQuota(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.SetRoomQuotaReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	target, err := op.GetUserById(req.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+	if err := user.SetUserRoomQuota(target, req.RoomQuota); err != nil {
+		abortManageUser(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// AdminLogoutUser logs a user out of every session and room
+func AdminLogoutUser(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	target, ok := adminTargetUser(ctx)
+	if !ok {
+		return
+	}
+	if err := user.ForceLogout(target); err != nil {
+		abortManageUser(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,666 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/db/backup"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/settings"
+	"github.com/synctv-org/synctv/server/middlewares"
+)
+
+// newAdminTestRouter returns a router with every route and a function to send it requests
+func newAdminTestRouter() func(method, path, token, body string) (int, map[string]any) {
+	e := gin.New()
+	Init(e)
+	return func(method, path, token, body string) (int, map[string]any) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		resp := map[string]any{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+}
+
+func newTestUserWithRole(t *testing.T, name string, role dbModel.Role) (*op.User, string) {
+	t.Helper()
+	u := newTestUser(t, name)
+	if err := u.SetRole(role); err != nil {
+		t.Fatal(err)
+	}
+	token, err := middlewares.NewAuthUserToken(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, token
+}
+
+func TestAdminUsers(t *testing.T) {
+	do := newAdminTestRouter()
+	root, rootToken := newTestUserWithRole(t, "admin-users-root", dbModel.RoleRoot)
+	_, adminToken := newTestUserWithRole(t, "admin-users-admin", dbModel.RoleAdmin)
+	member, memberToken := newTestUserWithRole(t, "admin-users-member", dbModel.RoleUser)
+	other, _ := newTestUserWithRole(t, "admin-users-other", dbModel.RoleUser)
+	target := func(u *op.User) string {
+		return `{"userId":` + strconv.Itoa(int(u.ID)) + `}`
+	}
+
+	if code, _ := do(http.MethodGet, "/api/admin/users", memberToken, ""); code != http.StatusForbidden {
+		t.Fatalf("list as a user: status = %d, want 403", code)
+	}
+	code, resp := do(http.MethodGet, "/api/admin/users?keyword=admin-users-&role=user", adminToken, "")
+	if code != http.StatusOK {
+		t.Fatalf("list: status = %d", code)
+	}
+	data := resp["data"].(map[string]any)
+	if data["total"] != float64(2) || data["list"].([]any)[0].(map[string]any)["username"] != member.Username {
+		t.Fatalf("list = %v, want the two users", data)
+	}
+
+	if code, _ := do(http.MethodPost, "/api/admin/users/ban", adminToken, target(member)); code != http.StatusNoContent {
+		t.Fatalf("ban: status = %d, want 204", code)
+	}
+	if code, _ := do(http.MethodGet, "/api/user/me", memberToken, ""); code != http.StatusUnauthorized {
+		t.Fatalf("token of a banned user: status = %d, want 401", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/users/unban", adminToken, target(member)); code != http.StatusNoContent {
+		t.Fatalf("unban: status = %d, want 204", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/users/unban", adminToken, target(member)); code != http.StatusBadRequest {
+		t.Fatalf("unban twice: status = %d, want 400", code)
+	}
+
+	// only root users make admins, and admins can't touch them
+	if code, _ := do(http.MethodPost, "/api/admin/users/promote", adminToken, target(other)); code != http.StatusForbidden {
+		t.Fatalf("promote as an admin: status = %d, want 403", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/users/promote", rootToken, target(other)); code != http.StatusNoContent {
+		t.Fatalf("promote as root: status = %d, want 204", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/users/ban", adminToken, target(other)); code != http.StatusForbidden {
+		t.Fatalf("ban an admin as an admin: status = %d, want 403", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/users/logout", adminToken, target(root)); code != http.StatusForbidden {
+		t.Fatalf("log out root as an admin: status = %d, want 403", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/users/demote", rootToken, target(other)); code != http.StatusNoContent {
+		t.Fatalf("demote as root: status = %d, want 204", code)
+	}
+
+	memberToken, err := middlewares.NewAuthUserToken(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/users/logout", adminToken, target(member)); code != http.StatusNoContent {
+		t.Fatalf("force logout: status = %d, want 204", code)
+	}
+	if code, _ := do(http.MethodGet, "/api/user/me", memberToken, ""); code != http.StatusUnauthorized {
+		t.Fatalf("token after a force logout: status = %d, want 401", code)
+	}
+}
+
+func TestAdminRooms(t *testing.T) {
+	do := newAdminTestRouter()
+	_, adminToken := newTestUserWithRole(t, "admin-rooms-admin", dbModel.RoleAdmin)
+	owner, ownerToken := newTestUserWithRole(t, "admin-rooms-owner", dbModel.RoleUser)
+	room := newTestRoom(t, owner, "admin-rooms-hidden")
+	if err := room.SetHidden(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	target := `{"roomId":"` + room.ID + `"}`
+
+	if code, _ := do(http.MethodGet, "/api/admin/rooms", ownerToken, ""); code != http.StatusForbidden {
+		t.Fatalf("list as a user: status = %d, want 403", code)
+	}
+	code, resp := do(http.MethodGet, "/api/admin/rooms?keyword=admin-rooms-", adminToken, "")
+	if code != http.StatusOK {
+		t.Fatalf("list: status = %d", code)
+	}
+	list := resp["data"].(map[string]any)["list"].([]any)
+	if len(list) != 1 {
+		t.Fatalf("list = %v, want the hidden room", list)
+	}
+	if r := list[0].(map[string]any); r["roomId"] != room.ID || r["hidden"] != true || r["needPassword"] != true || r["peopleNum"] != float64(0) {
+		t.Fatalf("room = %v", r)
+	}
+
+	if code, _ := do(http.MethodPost, "/api/admin/rooms/show", adminToken, target); code != http.StatusNoContent {
+		t.Fatalf("show: status = %d, want 204", code)
+	}
+	if room.Setting.Hidden {
+		t.Fatal("room is still hidden")
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/rooms/hide", adminToken, target); code != http.StatusNoContent {
+		t.Fatalf("hide: status = %d, want 204", code)
+	}
+	if !room.Setting.Hidden {
+		t.Fatal("room is not hidden")
+	}
+
+	if code, _ := do(http.MethodPost, "/api/admin/rooms/password/clear", adminToken, target); code != http.StatusNoContent {
+		t.Fatalf("clear password: status = %d, want 204", code)
+	}
+	if room.NeedPassword() {
+		t.Fatal("room still needs a password")
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/rooms/password/clear", adminToken, target); code != http.StatusBadRequest {
+		t.Fatalf("clear a missing password: status = %d, want 400", code)
+	}
+
+	if code, _ := do(http.MethodPost, "/api/admin/rooms/delete", adminToken, target); code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d, want 204", code)
+	}
+	if op.HasRoom(room.ID) {
+		t.Fatal("room was not deleted")
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/rooms/delete", adminToken, target); code != http.StatusNotFound {
+		t.Fatalf("delete twice: status = %d, want 404", code)
+	}
+}
+
+func TestAdminRestoreRoom(t *testing.T) {
+	do := newAdminTestRouter()
+	_, adminToken := newTestUserWithRole(t, "admin-restore-room-admin", dbModel.RoleAdmin)
+	owner := newTestUser(t, "admin-restore-room-owner")
+	room := newTestRoom(t, owner, "admin-restore-room-deleted")
+	newTestRoom(t, owner, "admin-restore-room-kept")
+	if err := op.SoftDeleteRoom(room); err != nil {
+		t.Fatal(err)
+	}
+	list := func(query string) []any {
+		t.Helper()
+		code, resp := do(http.MethodGet, "/api/admin/rooms?keyword=admin-restore-room-"+query, adminToken, "")
+		if code != http.StatusOK {
+			t.Fatalf("list %s: status = %d", query, code)
+		}
+		return resp["data"].(map[string]any)["list"].([]any)
+	}
+
+	if rooms := list(""); len(rooms) != 1 || rooms[0].(map[string]any)["roomName"] != "admin-restore-room-kept" {
+		t.Fatalf("rooms = %v, want the one not deleted", rooms)
+	}
+	rooms := list("&deleted=true")
+	if len(rooms) != 1 || rooms[0].(map[string]any)["roomId"] != room.ID || rooms[0].(map[string]any)["deletedAt"].(float64) <= 0 {
+		t.Fatalf("deleted rooms = %v, want the deleted one", rooms)
+	}
+	if code, _ := do(http.MethodGet, "/api/admin/rooms?deleted=maybe", adminToken, ""); code != http.StatusBadRequest {
+		t.Fatalf("deleted=maybe: status = %d, want 400", code)
+	}
+
+	if code, _ := do(http.MethodPost, "/api/admin/rooms/restore", adminToken, `{"roomId":"`+room.ID+`"}`); code != http.StatusNoContent {
+		t.Fatalf("restore: status = %d, want 204", code)
+	}
+	if rooms := list("&deleted=true"); len(rooms) != 0 {
+		t.Fatalf("deleted rooms after the restore = %v, want none", rooms)
+	}
+	if rooms := list(""); len(rooms) != 2 {
+		t.Fatalf("rooms after the restore = %v, want both", rooms)
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/rooms/restore", adminToken, `{"roomId":"`+room.ID+`"}`); code != http.StatusNotFound {
+		t.Fatalf("restore a room not deleted: status = %d, want 404", code)
+	}
+}
+
+func TestAdminPageSize(t *testing.T) {
+	do := newAdminTestRouter()
+	_, adminToken := newTestUserWithRole(t, "admin-page-size", dbModel.RoleAdmin)
+
+	for _, path := range []string{"/api/admin/rooms", "/api/admin/users", "/api/admin/users/pending", "/api/admin/lockouts"} {
+		code, resp := do(http.MethodGet, path+"?max=1000", adminToken, "")
+		if code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", path, code)
+		}
+		if list, _ := resp["data"].(map[string]any)["list"].([]any); len(list) > maxPageSize {
+			t.Fatalf("%s: %d items, want at most %d", path, len(list), maxPageSize)
+		}
+		if code, _ := do(http.MethodGet, path+"?max=0", adminToken, ""); code != http.StatusBadRequest {
+			t.Fatalf("%s: max=0: status = %d, want 400", path, code)
+		}
+	}
+}
+
+func TestRegistrationApproval(t *testing.T) {
+	conf.Conf().User.RequireApproval = true
+	defer func() { conf.Conf().User.RequireApproval = false }()
+
+	do := newAdminTestRouter()
+	_, adminToken := newTestUserWithRole(t, "approval-admin", dbModel.RoleAdmin)
+	signup := func(name string) (*op.User, string) {
+		u, err := op.SignupUser(name, "", "approval-password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := middlewares.NewAuthUserToken(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u, token
+	}
+	pending, pendingToken := signup("approval-pending")
+	rejected, _ := signup("approval-rejected")
+
+	code, resp := do(http.MethodGet, "/api/user/me", pendingToken, "")
+	if code != http.StatusOK || resp["data"].(map[string]any)["pending"] != true {
+		t.Fatalf("me: status = %d, resp = %v, want pending", code, resp)
+	}
+	createRoom := `{"roomName":"approval-room"}`
+	if code, _ := do(http.MethodPost, "/api/room/create", pendingToken, createRoom); code != http.StatusForbidden {
+		t.Fatalf("create room while pending: status = %d, want 403", code)
+	}
+
+	code, resp = do(http.MethodGet, "/api/admin/users/pending", adminToken, "")
+	if code != http.StatusOK {
+		t.Fatalf("pending list: status = %d", code)
+	}
+	data := resp["data"].(map[string]any)
+	if data["total"] != float64(2) || data["list"].([]any)[0].(map[string]any)["username"] != pending.Username {
+		t.Fatalf("pending list = %v, want the two new users", data)
+	}
+
+	if code, _ := do(http.MethodPost, "/api/admin/users/pending/approve", adminToken, `{"userId":`+strconv.Itoa(int(pending.ID))+`}`); code != http.StatusNoContent {
+		t.Fatalf("approve: status = %d, want 204", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/room/create", pendingToken, createRoom); code != http.StatusCreated {
+		t.Fatalf("create room once approved: status = %d, want 201", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/users/pending/approve", adminToken, `{"userId":`+strconv.Itoa(int(pending.ID))+`}`); code != http.StatusBadRequest {
+		t.Fatalf("approve twice: status = %d, want 400", code)
+	}
+
+	if code, _ := do(http.MethodPost, "/api/admin/users/pending/reject", adminToken, `{"userId":`+strconv.Itoa(int(rejected.ID))+`}`); code != http.StatusNoContent {
+		t.Fatalf("reject: status = %d, want 204", code)
+	}
+	if _, err := op.GetUserById(rejected.ID); err == nil {
+		t.Fatal("rejected user still exists")
+	}
+}
+
+func TestAdminSettings(t *testing.T) {
+	defer func() {
+		if err := settings.Set(map[string]string{"max_rooms_per_user": "0", "disable_create_room": "false"}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	do := newAdminTestRouter()
+	_, adminToken := newTestUserWithRole(t, "settings-admin", dbModel.RoleAdmin)
+	_, userToken := newTestUserWithRole(t, "settings-user", dbModel.RoleUser)
+
+	code, resp := do(http.MethodGet, "/api/admin/settings", adminToken, "")
+	if code != http.StatusOK {
+		t.Fatalf("list: status = %d", code)
+	}
+	var found bool
+	for _, s := range resp["data"].([]any) {
+		if s := s.(map[string]any); s["name"] == "max_rooms_per_user" {
+			found = s["type"] == "int64" && s["value"] == float64(0)
+		}
+	}
+	if !found {
+		t.Fatalf("list = %v, want max_rooms_per_user", resp["data"])
+	}
+
+	for _, body := range []string{`{"unknown":1}`, `{"max_rooms_per_user":-1}`, `{"disable_create_room":"maybe"}`, `{}`} {
+		if code, _ := do(http.MethodPost, "/api/admin/settings", adminToken, body); code != http.StatusBadRequest {
+			t.Fatalf("set %s: status = %d, want 400", body, code)
+		}
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/settings", userToken, `{"max_rooms_per_user":1}`); code != http.StatusForbidden {
+		t.Fatalf("set as a user: status = %d, want 403", code)
+	}
+
+	if code, _ := do(http.MethodPost, "/api/admin/settings", adminToken, `{"max_rooms_per_user":1}`); code != http.StatusNoContent {
+		t.Fatalf("set: status = %d, want 204", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/room/create", userToken, `{"roomName":"settings-room-1"}`); code != http.StatusCreated {
+		t.Fatalf("first room: status = %d, want 201", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/room/create", userToken, `{"roomName":"settings-room-2"}`); code != http.StatusForbidden {
+		t.Fatalf("room over the limit: status = %d, want 403", code)
+	}
+
+	if code, _ := do(http.MethodPost, "/api/admin/settings", adminToken, `{"max_rooms_per_user":0,"disable_create_room":true}`); code != http.StatusNoContent {
+		t.Fatalf("set: status = %d, want 204", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/room/create", userToken, `{"roomName":"settings-room-3"}`); code != http.StatusForbidden {
+		t.Fatalf("room while creation is disabled: status = %d, want 403", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/room/create", adminToken, `{"roomName":"settings-room-4"}`); code != http.StatusCreated {
+		t.Fatalf("room of an admin while creation is disabled: status = %d, want 201", code)
+	}
+}
+
+func TestRoomQuota(t *testing.T) {
+	if err := settings.Set(map[string]string{"max_rooms_per_user": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := settings.Set(map[string]string{"max_rooms_per_user": "0"}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	do := newAdminTestRouter()
+	_, adminToken := newTestUserWithRole(t, "quota-admin", dbModel.RoleAdmin)
+	user, userToken := newTestUserWithRole(t, "quota-user", dbModel.RoleUser)
+	setQuota := func(quota string) int {
+		code, _ := do(http.MethodPost, "/api/admin/users/quota", adminToken, `{"userId":`+strconv.Itoa(int(user.ID))+`,"roomQuota":`+quota+`}`)
+		return code
+	}
+	var rooms int
+	createRoom := func() int {
+		rooms++
+		code, _ := do(http.MethodPost, "/api/room/create", userToken, `{"roomName":"quota-room-`+strconv.Itoa(rooms)+`"}`)
+		return code
+	}
+
+	if code := createRoom(); code != http.StatusCreated {
+		t.Fatalf("first room: status = %d, want 201", code)
+	}
+	if code := createRoom(); code != http.StatusForbidden {
+		t.Fatalf("room over the instance quota: status = %d, want 403", code)
+	}
+
+	if code := setQuota("-1"); code != http.StatusBadRequest {
+		t.Fatalf("negative quota: status = %d, want 400", code)
+	}
+	if code := setQuota("2"); code != http.StatusNoContent {
+		t.Fatalf("set quota: status = %d, want 204", code)
+	}
+	if code := createRoom(); code != http.StatusCreated {
+		t.Fatalf("room within the user quota: status = %d, want 201", code)
+	}
+	if code := createRoom(); code != http.StatusForbidden {
+		t.Fatalf("room over the user quota: status = %d, want 403", code)
+	}
+	if code := setQuota("0"); code != http.StatusNoContent {
+		t.Fatalf("set unlimited quota: status = %d, want 204", code)
+	}
+	if code := createRoom(); code != http.StatusCreated {
+		t.Fatalf("room with an unlimited quota: status = %d, want 201", code)
+	}
+
+	if code := setQuota("null"); code != http.StatusNoContent {
+		t.Fatalf("reset quota: status = %d, want 204", code)
+	}
+	if u, err := db.GetUserByID(user.ID); err != nil || u.RoomQuota != nil {
+		t.Fatalf("quota = %v, %v, want the instance default", u.RoomQuota, err)
+	}
+	if code := createRoom(); code != http.StatusForbidden {
+		t.Fatalf("room over the instance quota again: status = %d, want 403", code)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	do := newAdminTestRouter()
+	_, adminToken := newTestUserWithRole(t, "lockout-admin", dbModel.RoleAdmin)
+	login := func(username, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(`{"username":"`+username+`","password":"`+password+`"}`))
+		req.RemoteAddr = "198.51.100.7:4000"
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		LoginUser(ctx)
+		return w
+	}
+	user, err := op.SignupUser("lockout-user", "lockout@example.com", "s3cretpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := op.LoginKeys(context.Background(), "198.51.100.7", "lockout-ghost"); len(keys) != 1 {
+		t.Fatalf("keys of an unknown account = %v, want only the ip", keys)
+	}
+
+	// the username and the email count against the same account
+	for i := int64(0); i < conf.Conf().User.LockoutThreshold; i++ {
+		name := "lockout-user"
+		if i%2 == 1 {
+			name = "lockout@example.com"
+		}
+		if w := login(name, "wrongpass"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: status = %d, want 401", i+1, w.Code)
+		}
+	}
+	w := login("lockout-user", "s3cretpass")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("locked login: status = %d, Retry-After = %q, want 429 with a delay", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	code, resp := do(http.MethodGet, "/api/admin/lockouts?page=1&max=10", adminToken, "")
+	if code != http.StatusOK {
+		t.Fatalf("list lockouts: status = %d", code)
+	}
+	keys := map[string]bool{}
+	for _, l := range resp["data"].(map[string]any)["list"].([]any) {
+		keys[l.(map[string]any)["key"].(string)] = true
+	}
+	userKey := fmt.Sprintf("ip:198.51.100.7:user:%d", user.ID)
+	if !keys[userKey] || !keys["ip:198.51.100.7"] || len(keys) != 2 {
+		t.Fatalf("lockouts = %v, want the account from the ip and the ip", keys)
+	}
+	for _, key := range []string{userKey, "ip:198.51.100.7"} {
+		if code, _ := do(http.MethodPost, "/api/admin/lockouts/unlock", adminToken, `{"key":"`+key+`"}`); code != http.StatusNoContent {
+			t.Fatalf("unlock %s: status = %d, want 204", key, code)
+		}
+	}
+	if w := login("lockout@example.com", "s3cretpass"); w.Code != http.StatusOK {
+		t.Fatalf("login after unlock: status = %d, want 200", w.Code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	conf.Conf().Metrics.Enable = true
+	conf.Conf().Metrics.Token = "metrics-token"
+	defer func() {
+		conf.Conf().Metrics = conf.DefaultMetricsConfig()
+	}()
+	e := gin.New()
+	Init(e)
+	scrape := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	if code := scrape("").Code; code != http.StatusUnauthorized {
+		t.Fatalf("scrape without token: status = %d, want 401", code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/user/me", nil)
+	req.Header.Set("Authorization", "not a token")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := scrape("metrics-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("scrape: status = %d", w.Code)
+	}
+	for _, metric := range []string{
+		`synctv_auth_failures_total{kind="token"}`,
+		"synctv_rooms_loaded",
+		"synctv_ws_messages_received_total",
+		"synctv_proxy_sent_bytes_total",
+		"synctv_db_query_duration_seconds_count",
+	} {
+		if !strings.Contains(w.Body.String(), metric) {
+			t.Errorf("metrics miss %s", metric)
+		}
+	}
+}
+
+func TestAdminDebug(t *testing.T) {
+	do := newAdminTestRouter()
+	admin, adminToken := newTestUserWithRole(t, "admin-debug-admin", dbModel.RoleAdmin)
+	_, memberToken := newTestUserWithRole(t, "admin-debug-member", dbModel.RoleUser)
+	room := newTestRoom(t, admin, "admin-debug-room")
+
+	for _, path := range []string{"/api/admin/debug/stats", "/api/admin/debug/pprof/"} {
+		if code, _ := do(http.MethodGet, path, memberToken, ""); code != http.StatusForbidden {
+			t.Errorf("member %s: status = %d, want 403", path, code)
+		}
+	}
+
+	code, resp := do(http.MethodGet, "/api/admin/debug/stats", adminToken, "")
+	if code != http.StatusOK {
+		t.Fatalf("stats: status = %d", code)
+	}
+	data := resp["data"].(map[string]any)
+	if data["goroutines"].(float64) <= 0 || data["heapAlloc"].(float64) <= 0 {
+		t.Errorf("stats = %v", data)
+	}
+	var found bool
+	for _, r := range data["rooms"].([]any) {
+		if r.(map[string]any)["roomId"] == room.ID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("stats miss the loaded room %s", room.ID)
+	}
+
+	for _, path := range []string{"/api/admin/debug/pprof/", "/api/admin/debug/pprof/heap?debug=1", "/api/admin/debug/pprof/goroutine?debug=1"} {
+		if code, _ := do(http.MethodGet, path, adminToken, ""); code != http.StatusOK {
+			t.Errorf("%s: status = %d", path, code)
+		}
+	}
+}
+
+func TestAdminReloadConfig(t *testing.T) {
+	do := newAdminTestRouter()
+	_, adminToken := newTestUserWithRole(t, "admin-reload-admin", dbModel.RoleAdmin)
+	_, memberToken := newTestUserWithRole(t, "admin-reload-member", dbModel.RoleUser)
+	running := conf.Conf()
+	defer func() {
+		conf.Set(running)
+		conf.SetLoader(nil)
+	}()
+	conf.SetLoader(func() (*conf.Config, error) {
+		c := *running
+		c.Log.Level = "warn"
+		return &c, nil
+	})
+
+	if code, _ := do(http.MethodPost, "/api/admin/reload", memberToken, ""); code != http.StatusForbidden {
+		t.Fatalf("member reload: status = %d, want 403", code)
+	}
+	if conf.Conf().Log.Level == "warn" {
+		t.Fatal("config reloaded by a member")
+	}
+	if code, _ := do(http.MethodPost, "/api/admin/reload", adminToken, ""); code != http.StatusNoContent {
+		t.Fatalf("reload: status = %d", code)
+	}
+	if conf.Conf().Log.Level != "warn" {
+		t.Fatalf("log level = %s after reload, want warn", conf.Conf().Log.Level)
+	}
+}
+
+func TestAdminBackup(t *testing.T) {
+	e := gin.New()
+	Init(e)
+	_, rootToken := newTestUserWithRole(t, "admin-backup-root", dbModel.RoleRoot)
+	_, adminToken := newTestUserWithRole(t, "admin-backup-admin", dbModel.RoleAdmin)
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/backup", nil)
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get(adminToken); w.Code != http.StatusForbidden {
+		t.Fatalf("admin backup: status = %d, want 403", w.Code)
+	}
+	w := get(rootToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("root backup: status = %d, %s", w.Code, w.Body)
+	}
+	r := bytes.NewReader(w.Body.Bytes())
+	m, err := backup.ReadManifest(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Tables["users"] < 2 {
+		t.Fatalf("backup users = %d, want the test users", m.Tables["users"])
+	}
+}
+
+func TestAdminRestore(t *testing.T) {
+	e := gin.New()
+	Init(e)
+	root, rootToken := newTestUserWithRole(t, "admin-restore-root", dbModel.RoleRoot)
+	_, adminToken := newTestUserWithRole(t, "admin-restore-admin", dbModel.RoleAdmin)
+	room := newTestRoom(t, root, "admin-restore-room")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/backup", nil)
+	req.Header.Set("Authorization", rootToken)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("backup: status = %d, %s", w.Code, w.Body)
+	}
+	archive := w.Body.Bytes()
+
+	restore := func(token string, file []byte, replace bool) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		fw, err := mw.CreateFormFile("file", "backup.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(file)
+		mw.WriteField("replace", strconv.FormatBool(replace))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/restore", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := restore(adminToken, archive, true); w.Code != http.StatusForbidden {
+		t.Fatalf("admin restore: status = %d, want 403", w.Code)
+	}
+	if w := restore(rootToken, []byte("not a zip"), true); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid archive: status = %d, want 400", w.Code)
+	}
+	if w := restore(rootToken, archive, false); w.Code != http.StatusConflict {
+		t.Fatalf("restore over users: status = %d, want 409", w.Code)
+	}
+
+	// the password set after the backup is gone, so the room loaded before
+	// the restore must not be served
+	if err := room.SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if w := restore(rootToken, archive, true); w.Code != http.StatusOK {
+		t.Fatalf("restore: status = %d, %s", w.Code, w.Body)
+	}
+	r, err := op.GetRoomByID(room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == room || r.NeedPassword() {
+		t.Fatal("the room loaded before the restore is still served")
+	}
+}
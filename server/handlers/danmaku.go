@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+// Danmaku returns the danmaku of the movie id shown from the from to the to
+// query in seconds, so clients joining late see the comments at their position
+func Danmaku(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+
+	movieID, err := strconv.ParseUint(ctx.Query("id"), 10, 64)
+	if err != nil || movieID == 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(model.ErrId))
+		return
+	}
+	from, err := strconv.ParseFloat(ctx.DefaultQuery("from", "0"), 64)
+	if err != nil || from < 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("from must be a positive number"))
+		return
+	}
+	to := math.MaxFloat64
+	if v := ctx.Query("to"); v != "" {
+		if to, err = strconv.ParseFloat(v, 64); err != nil || to < from {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("to must be a number after from"))
+			return
+		}
+	}
+
+	danmakus, err := room.GetDanmakus(uint(movieID), from, to)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	resp := make([]*model.DanmakuResp, len(danmakus))
+	for i, d := range danmakus {
+		resp[i] = &model.DanmakuResp{
+			Id:        d.ID,
+			MovieId:   d.MovieID,
+			Time:      d.Time,
+			Content:   d.Content,
+			Color:     d.Color,
+			CreatedAt: model.Timestamp(d.CreatedAt),
+		}
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"danmaku": resp,
+	}))
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+// AdminDebugStats reports the memory of the process and the load of every
+// loaded room, growing queues point at the rooms that fall behind
+func AdminDebugStats(ctx *gin.Context) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	stats := op.LoadedRoomStats()
+	rooms := make([]*model.RoomDebugStatsResp, len(stats))
+	for i, s := range stats {
+		rooms[i] = &model.RoomDebugStatsResp{
+			RoomId:         s.RoomID,
+			Clients:        s.Clients,
+			Channels:       s.Channels,
+			BroadcastQueue: s.BroadcastQueue,
+			MaxClientQueue: s.MaxClientQueue,
+		}
+	}
+	var lastGC int64
+	if m.LastGC != 0 {
+		lastGC = model.Timestamp(time.Unix(0, int64(m.LastGC)))
+	}
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(&model.DebugStatsResp{
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   m.HeapAlloc,
+		HeapInuse:   m.HeapInuse,
+		HeapObjects: m.HeapObjects,
+		Sys:         m.Sys,
+		NumGC:       m.NumGC,
+		LastGC:      lastGC,
+		Rooms:       rooms,
+	}))
+}
+
+// AdminPprof serves the profiles of net/http/pprof under the admin api, the
+// index links to them relatively so it works under any prefix
+func AdminPprof(ctx *gin.Context) {
+	switch name := ctx.Param("name"); name {
+	case "", "/":
+		pprof.Index(ctx.Writer, ctx.Request)
+	case "/cmdline":
+		pprof.Cmdline(ctx.Writer, ctx.Request)
+	case "/profile":
+		pprof.Profile(ctx.Writer, ctx.Request)
+	case "/symbol":
+		pprof.Symbol(ctx.Writer, ctx.Request)
+	case "/trace":
+		pprof.Trace(ctx.Writer, ctx.Request)
+	default:
+		pprof.Handler(name[1:]).ServeHTTP(ctx.Writer, ctx.Request)
+	}
+}
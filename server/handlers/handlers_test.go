@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	json "github.com/json-iterator/go"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/op"
+	_ "github.com/synctv-org/synctv/utils/fastJSONSerializer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	conf.Set(conf.DefaultConfig())
+	d, err := gorm.Open(sqlite.Open("file:handlers?mode=memory&cache=shared&_pragma=foreign_keys(1)"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Discard,
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.Init(d); err != nil {
+		panic(err)
+	}
+	op.Init(1024)
+	os.Exit(m.Run())
+}
+
+var providerUserID uint
+
+func newTestUser(t *testing.T, username string) *op.User {
+	t.Helper()
+	providerUserID++
+	u, err := op.CreateUser(username, "github", strconv.FormatUint(uint64(providerUserID), 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func newTestRoom(t *testing.T, creator *op.User, name string) *op.Room {
+	t.Helper()
+	r, err := creator.CreateRoom(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := op.LoadRoom(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return room
+}
+
+// serve runs h on req with the given context keys set and decodes the json response
+func serve(t *testing.T, h gin.HandlerFunc, req *http.Request, keys gin.H) map[string]any {
+	t.Helper()
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = req
+	for k, v := range keys {
+		ctx.Set(k, v)
+	}
+	h(ctx)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	resp := map[string]any{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/health"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+// Healthz answers while the process serves http, for liveness probes
+func Healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"status": "ok",
+	}))
+}
+
+// Readyz answers 503 until the database is migrated and reachable and the
+// subsystems are started, for readiness probes to hold traffic back
+func Readyz(ctx *gin.Context) {
+	c, cancel := context.WithTimeout(ctx.Request.Context(), 3*time.Second)
+	defer cancel()
+	checks, ready := health.Ready(c)
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	ctx.JSON(code, model.NewApiDataResp(gin.H{
+		"status": status,
+		"checks": checks,
+	}))
+}
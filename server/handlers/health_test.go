@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	json "github.com/json-iterator/go"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/health"
+)
+
+func TestHealth(t *testing.T) {
+	e := gin.New()
+	Init(e)
+	get := func(path string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		resp := map[string]any{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	health.Register("database", db.Ready)
+	health.SetPending("rtmp")
+	defer health.SetReady("rtmp")
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("healthz: status = %d", code)
+	}
+	code, resp := get("/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("readyz with rtmp pending: status = %d, want 503", code)
+	}
+	checks := map[string]any{}
+	for _, c := range resp["data"].(map[string]any)["checks"].([]any) {
+		c := c.(map[string]any)
+		checks[c["name"].(string)] = c["error"]
+	}
+	if checks["database"] != nil || checks["rtmp"] != health.ErrNotStarted.Error() {
+		t.Errorf("readyz checks = %v", checks)
+	}
+
+	health.SetReady("rtmp")
+	if code, _ := get("/readyz"); code != http.StatusOK {
+		t.Errorf("readyz: status = %d", code)
+	}
+}
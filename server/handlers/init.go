@@ -4,6 +4,9 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/metrics"
+	"github.com/synctv-org/synctv/internal/settings"
 	"github.com/synctv-org/synctv/public"
 	"github.com/synctv-org/synctv/server/middlewares"
 	"github.com/synctv-org/synctv/utils"
@@ -15,6 +18,13 @@ func Init(e *gin.Engine) {
 			ctx.Redirect(http.StatusMovedPermanently, "/web/")
 		})
 
+		e.GET("/healthz", Healthz)
+		e.GET("/readyz", Readyz)
+
+		if conf.Conf().Metrics.Enable {
+			e.GET("/metrics", middlewares.MetricsAuth, gin.WrapH(metrics.Handler()))
+		}
+
 		web := e.Group("/web")
 
 		web.Use(middlewares.NewDistCacheControl("/web/"))
@@ -26,10 +36,10 @@ func Init(e *gin.Engine) {
 		api := e.Group("/api")
 
 		needAuthUserApi := api.Group("")
-		needAuthUserApi.Use(middlewares.AuthUserMiddleware)
+		needAuthUserApi.Use(middlewares.AuthUserMiddleware, middlewares.UserRateLimit)
 
 		needAuthRoomApi := api.Group("")
-		needAuthRoomApi.Use(middlewares.AuthRoomMiddleware)
+		needAuthRoomApi.Use(middlewares.AuthRoomMiddleware, middlewares.UserRateLimit)
 
 		{
 			public := api.Group("/public")
@@ -38,14 +48,73 @@ func Init(e *gin.Engine) {
 		}
 
 		{
-			// TODO: admin api implement
-			// admin := api.Group("/admin")
+			admin := api.Group("/admin")
+			admin.Use(middlewares.AuthAdminMiddleware, middlewares.UserRateLimit)
+
+			admin.POST("/rooms/restore", AdminRestoreRoom)
+
+			// the path of the restore api before the room management api
+			admin.POST("/room/restore", AdminRestoreRoom)
+
+			admin.GET("/rooms", AdminRooms)
+
+			admin.POST("/rooms/delete", AdminDeleteRoom)
+
+			admin.POST("/rooms/hide", AdminHideRoom)
+
+			admin.POST("/rooms/show", AdminShowRoom)
+
+			admin.POST("/rooms/password/clear", AdminClearRoomPassword)
+
+			admin.GET("/settings", AdminSettings)
+
+			admin.GET("/lockouts", AdminLockouts)
+
+			admin.POST("/lockouts/unlock", AdminUnlock)
+
+			admin.POST("/settings", AdminSetSettings)
+
+			admin.POST("/reload", AdminReloadConfig)
+
+			admin.GET("/backup", middlewares.AuthRootMiddleware, AdminBackup)
+
+			admin.POST("/restore", middlewares.AuthRootMiddleware, AdminRestore)
+
+			admin.GET("/users", AdminUsers)
+
+			admin.GET("/users/renames", AdminUsernameChanges)
+
+			// the path of the rename history before the user management api
+			admin.GET("/user/renames", AdminUsernameChanges)
+
+			admin.GET("/users/pending", AdminPendingUsers)
+
+			admin.POST("/users/pending/approve", AdminApproveUser)
+
+			admin.POST("/users/pending/reject", AdminRejectUser)
+
+			admin.POST("/users/ban", AdminBanUser)
+
+			admin.POST("/users/unban", AdminUnbanUser)
+
+			admin.POST("/users/promote", AdminPromoteUser)
+
+			admin.POST("/users/demote", AdminDemoteUser)
+
+			admin.POST("/users/logout", AdminLogoutUser)
+
+			admin.POST("/users/quota", AdminSetRoomQuota)
+
+			admin.GET("/debug/stats", AdminDebugStats)
+
+			admin.GET("/debug/pprof/*name", AdminPprof)
 		}
 
 		{
 			room := api.Group("/room")
 			needAuthRoom := needAuthRoomApi.Group("/room")
 			needAuthUser := needAuthUserApi.Group("/room")
+			needApprovedUser := needAuthUser.Group("", middlewares.ApprovedUserMiddleware)
 
 			room.GET("/ws", NewWebSocketHandler(utils.NewWebSocketServer()))
 
@@ -53,15 +122,71 @@ func Init(e *gin.Engine) {
 
 			room.GET("/list", RoomList)
 
-			needAuthUser.POST("/create", CreateRoom)
+			room.GET("/search", SearchRoom)
+
+			room.POST("/guest", middlewares.LoginRateLimit, GuestLogin)
+
+			room.GET("/permissions", Permissions)
+
+			room.GET("/roles", RolePresets)
 
-			needAuthUser.POST("/login", LoginRoom)
+			needApprovedUser.POST("/create", middlewares.Captcha(settings.CaptchaCreateRoom), CreateRoom)
+
+			needApprovedUser.POST("/login", middlewares.LoginRateLimit, LoginRoom)
+
+			needApprovedUser.POST("/invite/join", JoinInvite)
 
 			needAuthRoom.POST("/delete", DeleteRoom)
 
+			needAuthRoom.DELETE("", DeleteRoom)
+
 			needAuthRoom.POST("/pwd", SetRoomPassword)
 
 			needAuthRoom.GET("/setting", RoomSetting)
+
+			needAuthRoom.POST("/settings", UpdateRoomSetting)
+
+			needAuthRoom.POST("/announcement", SetAnnouncement)
+
+			needAuthRoom.GET("/members", RoomMembers)
+
+			needAuthRoom.GET("/events", RoomEvents)
+
+			needAuthRoom.GET("/audit", PermissionAudit)
+
+			needAuthRoom.GET("/chat", ChatHistory)
+
+			needAuthRoom.DELETE("/chat/:id", DeleteChatMessage)
+
+			needAuthRoom.POST("/chat/read", ReadChat)
+
+			needAuthRoom.GET("/chat/unread", UnreadChat)
+
+			needAuthRoom.POST("/mute", MuteUser)
+
+			needAuthRoom.POST("/kick", KickUser)
+
+			needAuthRoom.POST("/permission", ChangeUserPermission)
+
+			needAuthRoom.POST("/permissions/batch", BatchChangeUserPermission)
+
+			needAuthRoom.POST("/role", AssignRole)
+
+			needAuthRoom.POST("/permissions/default", SetDefaultPermissions)
+
+			needAuthRoom.POST("/invite", CreateInvite)
+
+			needAuthRoom.DELETE("/invite/:id", DeleteInvite)
+
+			needAuthRoom.POST("/transfer", TransferRoom)
+
+			needAuthRoom.POST("/clone", CloneRoom)
+		}
+
+		{
+			needAuthUser := needAuthUserApi.Group("/rooms")
+
+			needAuthUser.POST("/batch", BatchRooms)
 		}
 
 		{
@@ -82,10 +207,30 @@ func Init(e *gin.Engine) {
 
 			needAuthMovie.POST("/swap", SwapMovie)
 
+			needAuthMovie.POST("/move", MoveMovie)
+
+			needAuthMovie.POST("/playmode", SetPlayMode)
+
 			needAuthMovie.POST("/delete", DelMovie)
 
 			needAuthMovie.POST("/clear", ClearMovies)
 
+			needAuthMovie.POST("/import", ImportMovies)
+
+			needAuthMovie.GET("/export", ExportMovies)
+
+			needAuthMovie.GET("/danmaku", Danmaku)
+
+			needAuthMovie.POST("/subtitle", PushSubtitle)
+
+			needAuthMovie.GET("/subtitles", Subtitles)
+
+			needAuthMovie.POST("/subtitle/delete", DelSubtitle)
+
+			movie.GET("/subtitle/:roomId/:key", ServeSubtitle)
+
+			needAuthMovie.GET("/proxyUrl", ProxyMovieURL)
+
 			movie.HEAD("/proxy/:roomId/:pullKey", ProxyMovie)
 
 			movie.GET("/proxy/:roomId/:pullKey", ProxyMovie)
@@ -100,12 +245,84 @@ func Init(e *gin.Engine) {
 		}
 
 		{
-			// user := api.Group("/user")
+			user := api.Group("/user")
 			needAuthUser := needAuthUserApi.Group("/user")
 
+			user.POST("/signup", middlewares.LoginRateLimit, middlewares.Captcha(settings.CaptchaSignup), SignupUser)
+
+			user.POST("/login", middlewares.LoginRateLimit, LoginUser)
+
+			user.POST("/verify", middlewares.LoginRateLimit, VerifyEmail)
+
+			user.POST("/reset/request", middlewares.LoginRateLimit, RequestPasswordReset)
+
+			user.POST("/reset", middlewares.LoginRateLimit, ResetPassword)
+
+			user.POST("/2fa/verify", middlewares.LoginRateLimit, VerifyTwoFactor)
+
+			user.POST("/token/refresh", RefreshToken)
+
+			user.GET("/avatar/:key", ServeAvatar)
+
 			needAuthUser.POST("/logout", LogoutUser)
 
+			needAuthUser.POST("/logout-all", LogoutAll)
+
+			needAuthUser.POST("/token/revoke", RevokeToken)
+
+			needAuthUser.GET("/sessions", Sessions)
+
+			needAuthUser.DELETE("/sessions/:id", DeleteSession)
+
+			needAuthUser.GET("/apikeys", APIKeys)
+
+			needAuthUser.POST("/apikeys", CreateAPIKey)
+
+			needAuthUser.DELETE("/apikeys/:id", DeleteAPIKey)
+
+			needAuthUser.POST("/verify/send", SendVerifyEmail)
+
+			needAuthUser.GET("/2fa", TwoFactorStatus)
+
+			needAuthUser.POST("/2fa/enable", EnableTwoFactor)
+
+			needAuthUser.POST("/2fa/confirm", ConfirmTwoFactor)
+
+			needAuthUser.POST("/2fa/disable", DisableTwoFactor)
+
+			needAuthUser.POST("/2fa/recovery", RegenerateRecoveryCodes)
+
 			needAuthUser.GET("/me", Me)
+
+			needAuthUser.GET("/profile", Profile)
+
+			needAuthUser.POST("/profile", UpdateProfile)
+
+			needAuthUser.POST("/rename", RenameUser)
+
+			needAuthUser.GET("/renames", UsernameChanges)
+
+			needAuthUser.GET("/export", ExportAccount)
+
+			needAuthUser.POST("/delete", DeleteAccount)
+
+			needAuthUser.POST("/delete/cancel", CancelDeleteAccount)
+
+			needAuthUser.POST("/terms", AcceptTerms)
+
+			needAuthUser.GET("/favorites", FavoriteRooms)
+
+			needAuthUser.POST("/favorites", AddFavoriteRoom)
+
+			needAuthUser.DELETE("/favorites", RemoveFavoriteRoom)
+
+			needAuthUser.POST("/message", SendDirectMessage)
+
+			needAuthUser.GET("/messages", DirectMessages)
+
+			needAuthUser.POST("/messages/read", ReadDirectMessages)
+
+			needAuthUser.GET("/messages/unread", UnreadDirectMessages)
 		}
 	}
 }
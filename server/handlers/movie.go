@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"path"
 	"path/filepath"
@@ -15,20 +18,30 @@ import (
 	"github.com/synctv-org/synctv/internal/conf"
 	dbModel "github.com/synctv-org/synctv/internal/model"
 	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/playlist"
+	mediaProxy "github.com/synctv-org/synctv/internal/proxy"
+	"github.com/synctv-org/synctv/internal/requestid"
 	"github.com/synctv-org/synctv/internal/rtmp"
 	pb "github.com/synctv-org/synctv/proto"
 	"github.com/synctv-org/synctv/proxy"
+	"github.com/synctv-org/synctv/server/middlewares"
 	"github.com/synctv-org/synctv/server/model"
 	"github.com/synctv-org/synctv/utils"
 	"github.com/zijiren233/livelib/protocol/hls"
 	"github.com/zijiren233/livelib/protocol/httpflv"
 )
 
+// maxPageSize caps the max query, clients used to load whole lists with a large max
+const maxPageSize = 100
+
 func GetPageAndMax(ctx *gin.Context) (int64, int64, error) {
 	max, err := strconv.ParseInt(ctx.DefaultQuery("max", "10"), 10, 64)
 	if err != nil {
 		return 0, 0, errors.New("max must be a number")
 	}
+	if max > maxPageSize {
+		max = maxPageSize
+	}
 	page, err := strconv.ParseInt(ctx.DefaultQuery("page", "1"), 10, 64)
 	if err != nil {
 		return 0, 0, errors.New("page must be a number")
@@ -45,6 +58,30 @@ func GetPageItems[T any](ctx *gin.Context, items []T) ([]T, error) {
 	return utils.GetPageItems(items, max, page), nil
 }
 
+func newMoviesResp(m *dbModel.Movie) model.MoviesResp {
+	return model.MoviesResp{
+		Id:        m.ID,
+		ParentId:  m.ParentID,
+		Base:      m.BaseMovieInfo,
+		Meta:      m.Meta,
+		PullKey:   m.PullKey,
+		Creater:   op.GetUserName(m.CreatorID),
+		CreatedAt: model.Timestamp(m.CreatedAt),
+	}
+}
+
+func newCurrentResp(c *op.Current) model.CurrentResp {
+	return model.CurrentResp{
+		Movie: c.Movie,
+		Status: model.StatusResp{
+			Seek:    c.Status.Seek,
+			Rate:    c.Status.Rate,
+			Playing: c.Status.Playing,
+		},
+		Subtitle: c.Subtitle,
+	}
+}
+
 func MovieList(ctx *gin.Context) {
 	room := ctx.MustGet("room").(*op.Room)
 	// user := ctx.MustGet("user").(*op.User)
@@ -55,30 +92,28 @@ func MovieList(ctx *gin.Context) {
 		return
 	}
 
-	m, err := room.GetMoviesByRoomIDWithPage(int(page), int(max))
+	parentID, err := strconv.ParseUint(ctx.DefaultQuery("parentId", "0"), 10, 64)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("parentId must be a number"))
+		return
+	}
+
+	ms, err := room.GetChildMovies(uint(parentID))
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
+	m := utils.GetPageItems(ms, max, page)
 
 	mresp := make([]model.MoviesResp, len(m))
 	for i, v := range m {
-		mresp[i] = model.MoviesResp{
-			Id:      v.ID,
-			Base:    m[i].BaseMovieInfo,
-			PullKey: v.PullKey,
-			Creater: op.GetUserName(v.CreatorID),
-		}
+		mresp[i] = newMoviesResp(v)
 	}
 
-	i, err := room.GetMoviesCount()
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
-		return
-	}
+	i := len(ms)
 
 	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
-		"current": room.Current(),
+		"current": newCurrentResp(room.Current()),
 		"total":   i,
 		"movies":  mresp,
 	}))
@@ -89,7 +124,7 @@ func CurrentMovie(ctx *gin.Context) {
 	// user := ctx.MustGet("user").(*op.User)
 
 	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
-		"current": room.Current(),
+		"current": newCurrentResp(room.Current()),
 	}))
 }
 
@@ -103,27 +138,25 @@ func Movies(ctx *gin.Context) {
 		return
 	}
 
-	m, err := room.GetMoviesByRoomIDWithPage(int(page), int(max))
+	parentID, err := strconv.ParseUint(ctx.DefaultQuery("parentId", "0"), 10, 64)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("parentId must be a number"))
+		return
+	}
+
+	ms, err := room.GetChildMovies(uint(parentID))
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
+	m := utils.GetPageItems(ms, max, page)
 
 	mresp := make([]model.MoviesResp, len(m))
 	for i, v := range m {
-		mresp[i] = model.MoviesResp{
-			Id:      v.ID,
-			Base:    m[i].BaseMovieInfo,
-			PullKey: v.PullKey,
-			Creater: op.GetUserName(v.CreatorID),
-		}
+		mresp[i] = newMoviesResp(v)
 	}
 
-	i, err := room.GetMoviesCount()
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
-		return
-	}
+	i := len(ms)
 
 	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
 		"total":  i,
@@ -141,6 +174,15 @@ func PushMovie(ctx *gin.Context) {
 		return
 	}
 
+	if !user.HasPermission(room, dbModel.CanCreateMovie) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(ErrPushMovie))
+		return
+	}
+	if req.RtmpSource && !user.HasPermission(room, dbModel.CanPublishLive) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(ErrPublishLive))
+		return
+	}
+
 	mi := user.NewMovie(dbModel.MovieInfo{
 		BaseMovieInfo: dbModel.BaseMovieInfo(req),
 	})
@@ -150,6 +192,7 @@ func PushMovie(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPlaylistChanged, fmt.Sprintf("add movie %s", mi.Name))
 
 	if err := room.Broadcast(&op.ElementMessage{
 		ElementMessage: &pb.ElementMessage{
@@ -164,6 +207,114 @@ func PushMovie(ctx *gin.Context) {
 	ctx.Status(http.StatusNoContent)
 }
 
+var (
+	ErrPushMovie   = errors.New("you don't have permission to push movies")
+	ErrPublishLive = errors.New("you don't have permission to publish live streams")
+)
+
+// maxPlaylistSize is the largest playlist accepted by ImportMovies
+const maxPlaylistSize = 4 << 20
+
+// ImportMovies appends the movies of a JSON or M3U playlist to the room,
+// the format is detected unless given by the format query
+func ImportMovies(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	if !user.HasPermission(room, dbModel.CanCreateMovie) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(ErrPushMovie))
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(ctx.Request.Body, maxPlaylistSize+1))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if len(data) > maxPlaylistSize {
+		ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, model.NewApiErrorStringResp("playlist too large"))
+		return
+	}
+	format := playlist.Detect(data)
+	if f := ctx.Query("format"); f != "" {
+		if format, err = playlist.ParseFormat(f); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+			return
+		}
+	}
+	movies, err := playlist.Decode(bytes.NewReader(data), format)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	for i, m := range movies {
+		req := model.PushMovieReq(m)
+		if err := req.Validate(); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp(fmt.Sprintf("movie %d: %s", i+1, err)))
+			return
+		}
+		if req.RtmpSource && !user.HasPermission(room, dbModel.CanPublishLive) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp(fmt.Sprintf("movie %d: %s", i+1, ErrPublishLive)))
+			return
+		}
+		movies[i] = dbModel.BaseMovieInfo(req)
+	}
+
+	ms := make([]dbModel.Movie, len(movies))
+	for i, m := range movies {
+		ms[i] = user.NewMovie(dbModel.MovieInfo{BaseMovieInfo: m})
+	}
+	if err := room.AddMovies(ms); err != nil {
+		var me *op.MovieError
+		if errors.As(err, &me) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	if len(ms) > 0 {
+		room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPlaylistChanged, fmt.Sprintf("import %d movies", len(ms)))
+		room.Broadcast(&op.ElementMessage{
+			ElementMessage: &pb.ElementMessage{
+				Type:   pb.ElementMessageType_CHANGE_MOVIES,
+				Sender: user.Username,
+			},
+		})
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"imported": len(ms),
+	}))
+}
+
+// ExportMovies serves the playlist of the room as a JSON or M3U download
+func ExportMovies(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	// user := ctx.MustGet("user").(*op.User)
+
+	format, err := playlist.ParseFormat(ctx.DefaultQuery("format", string(playlist.FormatJSON)))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	// folders are flattened, their movies are exported in play order
+	ms, err := room.PlayOrder()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	movies := make([]dbModel.BaseMovieInfo, len(ms))
+	for i, m := range ms {
+		movies[i] = m.BaseMovieInfo
+	}
+
+	ctx.Header("Content-Type", format.ContentType())
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="playlist.%s"`, format))
+	ctx.Status(http.StatusOK)
+	playlist.Encode(ctx.Writer, format, movies)
+}
+
 func NewPublishKey(ctx *gin.Context) {
 	room := ctx.MustGet("room").(*op.Room)
 	user := ctx.MustGet("user").(*op.User)
@@ -180,7 +331,9 @@ func NewPublishKey(ctx *gin.Context) {
 		return
 	}
 
-	if !user.HasPermission(room, dbModel.CanCreateUserPublishKey) && movie.CreatorID != user.ID {
+	// publishers get keys for their own streams, CanCreateUserPublishKey for every stream
+	if !user.HasPermission(room, dbModel.CanCreateUserPublishKey) &&
+		(movie.CreatorID != user.ID || !user.HasPermission(room, dbModel.CanPublishLive)) {
 		ctx.AbortWithStatus(http.StatusForbidden)
 		return
 	}
@@ -201,7 +354,7 @@ func NewPublishKey(ctx *gin.Context) {
 		return
 	}
 
-	host := conf.Conf.Rtmp.CustomPublishHost
+	host := conf.Conf().Rtmp.CustomPublishHost
 	if host == "" {
 		host = ctx.Request.Host
 	}
@@ -223,10 +376,15 @@ func EditMovie(ctx *gin.Context) {
 		return
 	}
 
+	if !abortMoviesPermission(ctx, user.CheckEditMovies(room, req.Id)) {
+		return
+	}
+
 	if err := room.UpdateMovie(req.Id, dbModel.BaseMovieInfo(req.PushMovieReq)); err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPlaylistChanged, fmt.Sprintf("edit movie %d", req.Id))
 
 	if err := room.Broadcast(&op.ElementMessage{
 		ElementMessage: &pb.ElementMessage{
@@ -251,6 +409,10 @@ func DelMovie(ctx *gin.Context) {
 		return
 	}
 
+	if !abortMoviesPermission(ctx, user.CheckDeleteMovies(room, req.Ids...)) {
+		return
+	}
+
 	for _, id := range req.Ids {
 		err := room.DeleteMovieByID(id)
 		if err != nil {
@@ -258,6 +420,7 @@ func DelMovie(ctx *gin.Context) {
 			return
 		}
 	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPlaylistChanged, fmt.Sprintf("delete movies %v", req.Ids))
 
 	if err := room.Broadcast(&op.ElementMessage{
 		ElementMessage: &pb.ElementMessage{
@@ -276,10 +439,16 @@ func ClearMovies(ctx *gin.Context) {
 	room := ctx.MustGet("room").(*op.Room)
 	user := ctx.MustGet("user").(*op.User)
 
+	if !user.HasPermission(room, dbModel.CanDeleteUserMovies) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to clear the playlist"))
+		return
+	}
+
 	if err := room.ClearMovies(); err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPlaylistChanged, "clear movies")
 
 	if err := room.Broadcast(&op.ElementMessage{
 		ElementMessage: &pb.ElementMessage{
@@ -304,10 +473,49 @@ func SwapMovie(ctx *gin.Context) {
 		return
 	}
 
+	if !abortMoviesPermission(ctx, user.CheckEditMovies(room, req.Id1, req.Id2)) {
+		return
+	}
+
 	if err := room.SwapMoviePositions(req.Id1, req.Id2); err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPlaylistChanged, fmt.Sprintf("swap movies %d and %d", req.Id1, req.Id2))
+
+	if err := room.Broadcast(&op.ElementMessage{
+		ElementMessage: &pb.ElementMessage{
+			Type:   pb.ElementMessageType_CHANGE_MOVIES,
+			Sender: user.Username,
+		},
+	}); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// MoveMovie moves a movie or folder into a folder of the playlist
+func MoveMovie(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.MoveMovieReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if !abortMoviesPermission(ctx, user.CheckEditMovies(room, req.Id)) {
+		return
+	}
+
+	if err := room.MoveMovie(req.Id, req.ParentId); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPlaylistChanged, fmt.Sprintf("move movie %d to folder %d", req.Id, req.ParentId))
 
 	if err := room.Broadcast(&op.ElementMessage{
 		ElementMessage: &pb.ElementMessage{
@@ -322,10 +530,59 @@ func SwapMovie(ctx *gin.Context) {
 	ctx.Status(http.StatusNoContent)
 }
 
+// abortMoviesPermission aborts with the error of a movie permission check,
+// and returns whether the check passed
+func abortMoviesPermission(ctx *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, op.ErrNoPermission) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to change the movies of others"))
+	} else {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+	}
+	return false
+}
+
+// SetPlayMode changes the order the room advances through the playlist
+func SetPlayMode(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	if !user.HasPermission(room, dbModel.CanChangeCurrentMovie) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to change the play mode"))
+		return
+	}
+
+	req := model.PlayModeReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := room.SetPlayMode(req.PlayMode); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventSettingsChanged, fmt.Sprintf("play mode %s", req.PlayMode))
+
+	ctx.Status(http.StatusNoContent)
+}
+
 func ChangeCurrentMovie(ctx *gin.Context) {
 	room := ctx.MustGet("room").(*op.Room)
 	user := ctx.MustGet("user").(*op.User)
 
+	if !user.HasPermission(room, dbModel.CanChangeCurrentMovie) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to change the current movie"))
+		return
+	}
+	// the members vote to skip instead
+	if room.ControlledByVotes(user) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(op.ErrControlledByVotes))
+		return
+	}
+
 	req := model.IdReq{}
 	if err := model.Decode(ctx, &req); err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
@@ -336,6 +593,7 @@ func ChangeCurrentMovie(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPlaylistChanged, fmt.Sprintf("change current movie to %d", req.Id))
 	if err := room.Broadcast(&op.ElementMessage{
 		ElementMessage: &pb.ElementMessage{
 			Type:    pb.ElementMessageType_CHANGE_CURRENT,
@@ -358,20 +616,31 @@ var allowedProxyMovieContentType = map[string]struct{}{
 
 const UserAgent = `Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Safari/537.36 Edg/117.0.2045.40`
 
+// proxyHeaders returns the headers the proxy requests the media of m with,
+// the headers of the movie and a browser user agent unless it has its own
+func proxyHeaders(m *dbModel.Movie) map[string]string {
+	headers := make(map[string]string, len(m.Headers)+1)
+	headers["User-Agent"] = UserAgent
+	for k, v := range m.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+	return headers
+}
+
 func ProxyMovie(ctx *gin.Context) {
 	roomId := ctx.Param("roomId")
 	if roomId == "" {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("roomId is empty"))
 		return
 	}
-	id, err := strconv.ParseUint(roomId, 10, 64)
+	room, err := op.GetRoomByID(roomId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
-	room, err := op.GetRoomByID(uint(id))
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+
+	if err := middlewares.VerifyProxyURL(ctx, room, ctx.Param("pullKey")); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
 		return
 	}
 
@@ -391,11 +660,10 @@ func ProxyMovie(ctx *gin.Context) {
 		return
 	}
 
-	r := resty.New().R()
+	limitBandwidth(ctx, room.ID)
 
-	for k, v := range m.Headers {
-		r.SetHeader(k, v)
-	}
+	headers := proxyHeaders(m)
+	r := resty.New().R().SetHeaders(headers)
 	resp, err := r.Head(m.Url)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
@@ -404,6 +672,10 @@ func ProxyMovie(ctx *gin.Context) {
 	defer resp.RawBody().Close()
 
 	if _, ok := allowedProxyMovieContentType[resp.Header().Get("Content-Type")]; !ok {
+		if mediaProxy.Enabled() && mediaProxy.NeedsRemux(resp.Header().Get("Content-Type")) {
+			remuxMovie(ctx, m, headers)
+			return
+		}
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(fmt.Errorf("this movie type support proxy: %s", resp.Header().Get("Content-Type"))))
 		return
 	}
@@ -419,12 +691,24 @@ func ProxyMovie(ctx *gin.Context) {
 		return
 	}
 
-	hrs := proxy.NewBufferedHttpReadSeeker(128*1024, m.Url,
-		proxy.WithContext(ctx),
-		proxy.WithHeaders(m.Headers),
-		proxy.WithContext(ctx),
-		proxy.WithContentLength(length),
-	)
+	var hrs io.ReadSeeker
+	if cache := mediaProxy.Cache(); cache != nil {
+		key := mediaProxy.Key(m.Url, headers, resp.Header().Get("ETag"), resp.Header().Get("Last-Modified"))
+		hrs = cache.ReadSeeker(ctx.Request.Context(), key, length, func(fctx context.Context) io.ReadSeeker {
+			return proxy.NewHttpReadSeeker(m.Url,
+				proxy.WithContext(fctx),
+				proxy.WithHeaders(headers),
+				proxy.WithContentLength(length),
+			)
+		})
+	} else {
+		hrs = proxy.NewBufferedHttpReadSeeker(128*1024, m.Url,
+			proxy.WithContext(ctx),
+			proxy.WithHeaders(headers),
+			proxy.WithContext(ctx),
+			proxy.WithContentLength(length),
+		)
+	}
 	name := resp.Header().Get("Content-Disposition")
 	if name == "" {
 		name = filepath.Base(resp.Request.RawRequest.URL.Path)
@@ -434,6 +718,86 @@ func ProxyMovie(ctx *gin.Context) {
 	http.ServeContent(ctx.Writer, ctx.Request, name, time.Now(), hrs)
 }
 
+// ProxyMovieURL returns the url the players of the request load the proxied
+// movie id from, signed so it can't be shared outside of the room for long
+func ProxyMovieURL(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+
+	movieID, err := strconv.ParseUint(ctx.Query("id"), 10, 64)
+	if err != nil || movieID == 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(model.ErrId))
+		return
+	}
+	m, err := room.GetMovieByID(uint(movieID))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+	if !m.Proxy || m.Live || m.RtmpSource {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("not support proxy"))
+		return
+	}
+
+	url, expiresAt, err := middlewares.SignProxyURL(ctx, room, m.PullKey)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(model.ProxyURLResp{
+		Url:       url,
+		ExpiresAt: model.Timestamp(expiresAt),
+	}))
+}
+
+// remuxMovie serves a movie browsers can't play as fragmented mp4,
+// which can't seek, so players seek by requesting again with the start query in seconds
+func remuxMovie(ctx *gin.Context, m *dbModel.Movie, headers map[string]string) {
+	start, err := strconv.ParseFloat(ctx.DefaultQuery("start", "0"), 64)
+	if err != nil || start < 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("start must be a positive number"))
+		return
+	}
+	if ctx.Request.Method == http.MethodHead {
+		ctx.Header("Content-Type", "video/mp4")
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Status(http.StatusOK)
+		return
+	}
+	release, err := mediaProxy.AcquireRemux()
+	if err != nil {
+		ctx.Header("Retry-After", "10")
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, model.NewApiErrorResp(err))
+		return
+	}
+	defer release()
+	ctx.Header("Content-Type", "video/mp4")
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Status(http.StatusOK)
+	if err := mediaProxy.RemuxMP4(ctx.Request.Context(), ctx.Writer, m.Url, headers, start); err != nil && ctx.Request.Context().Err() == nil {
+		requestid.Log(ctx.Request.Context()).Errorf("remux movie %d failed: %s", m.ID, err.Error())
+	}
+}
+
+// limitBandwidth caps what is sent to a proxied connection of the room at the
+// configured bandwidth, and counts it in the proxy metrics
+func limitBandwidth(ctx *gin.Context, roomID string) {
+	w := mediaProxy.LimitWriter(ctx.Request.Context(), ctx.Writer, roomID)
+	ctx.Writer = &limitedResponseWriter{ResponseWriter: ctx.Writer, w: mediaProxy.CountWriter(w)}
+}
+
+type limitedResponseWriter struct {
+	gin.ResponseWriter
+	w io.Writer
+}
+
+func (w *limitedResponseWriter) Write(b []byte) (int, error) {
+	return w.w.Write(b)
+}
+
+func (w *limitedResponseWriter) WriteString(s string) (int, error) {
+	return w.w.Write([]byte(s))
+}
+
 type FormatErrNotSupportFileType string
 
 func (e FormatErrNotSupportFileType) Error() string {
@@ -441,7 +805,7 @@ func (e FormatErrNotSupportFileType) Error() string {
 }
 
 func JoinLive(ctx *gin.Context) {
-	if !conf.Conf.Proxy.LiveProxy && !conf.Conf.Rtmp.Enable {
+	if !conf.Conf().Proxy.LiveProxy && !conf.Conf().Rtmp.Enable {
 		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("live proxy and rtmp source is not enabled"))
 		return
 	}
@@ -463,6 +827,7 @@ func JoinLive(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
 		return
 	}
+	limitBandwidth(ctx, room.ID)
 	switch fileExt {
 	case ".flv":
 		ctx.Header("Cache-Control", "no-store")
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/server/middlewares"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+// status runs h on req with the given context keys set and returns the response code
+func status(h gin.HandlerFunc, req *http.Request, keys gin.H) int {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = req
+	for k, v := range keys {
+		ctx.Set(k, v)
+	}
+	h(ctx)
+	if ctx.Writer.Written() {
+		return w.Code
+	}
+	return ctx.Writer.Status()
+}
+
+func TestGetPageAndMax(t *testing.T) {
+	for _, c := range []struct {
+		query     string
+		page, max int64
+	}{
+		{"", 1, 10},
+		{"page=3&max=20", 3, 20},
+		{"max=100", 1, 100},
+		{"max=1000", 1, 100},
+	} {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/?"+c.query, nil)
+		page, max, err := GetPageAndMax(ctx)
+		if err != nil || page != c.page || max != c.max {
+			t.Errorf("%q: page, max = %d, %d, %v, want %d, %d", c.query, page, max, err, c.page, c.max)
+		}
+	}
+}
+
+func TestPushLiveMovie(t *testing.T) {
+	enabled := conf.Conf().Rtmp.Enable
+	conf.Conf().Rtmp.Enable = true
+	defer func() { conf.Conf().Rtmp.Enable = enabled }()
+
+	creator := newTestUser(t, "live-creator")
+	member := newTestUser(t, "live-member")
+	publisher := newTestUser(t, "live-publisher")
+	room := newTestRoom(t, creator, "live-room")
+	if err := db.AddUserToRoom(member.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUserToRoom(publisher.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions|dbModel.CanPublishLive); err != nil {
+		t.Fatal(err)
+	}
+
+	push := func(u any) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/movie/push", strings.NewReader(`{"name":"stream","live":true,"rtmpSource":true}`))
+		return status(PushMovie, req, gin.H{"user": u, "room": room})
+	}
+	if code := push(member); code != http.StatusForbidden {
+		t.Fatalf("member push live = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := push(publisher); code != http.StatusNoContent {
+		t.Fatalf("publisher push live = %d, want %d", code, http.StatusNoContent)
+	}
+
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].PullKey == "" {
+		t.Fatalf("playlist = %d movies, want the live stream with a pull key", len(ms))
+	}
+	body := fmt.Sprintf(`{"id":%d}`, ms[0].ID)
+	resp := serve(t, NewPublishKey, httptest.NewRequest(http.MethodPost, "/api/movie/live/publishKey", strings.NewReader(body)), gin.H{"user": publisher, "room": room})
+	if data := resp["data"].(map[string]any); data["app"] != room.ID || data["token"] == "" {
+		t.Fatalf("publish key = %v, want a token for the room", data)
+	}
+	code := status(NewPublishKey, httptest.NewRequest(http.MethodPost, "/api/movie/live/publishKey", strings.NewReader(body)), gin.H{"user": member, "room": room})
+	if code != http.StatusForbidden {
+		t.Fatalf("member publish key = %d, want %d", code, http.StatusForbidden)
+	}
+}
+
+func TestMoviePermissions(t *testing.T) {
+	creator := newTestUser(t, "movieperm-creator")
+	member := newTestUser(t, "movieperm-member")
+	restricted := newTestUser(t, "movieperm-restricted")
+	room := newTestRoom(t, creator, "movieperm-room")
+	if err := db.AddUserToRoom(member.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUserToRoom(restricted.ID, room.ID, dbModel.RoomRoleUser, 0); err != nil {
+		t.Fatal(err)
+	}
+	call := func(h gin.HandlerFunc, u any, body string) int {
+		return status(h, httptest.NewRequest(http.MethodPost, "/api/movie", strings.NewReader(body)), gin.H{"user": u, "room": room})
+	}
+
+	if code := call(PushMovie, restricted, `{"name":"a","url":"https://example.com/a.mp4"}`); code != http.StatusForbidden {
+		t.Fatalf("push without CanCreateMovie = %d, want %d", code, http.StatusForbidden)
+	}
+	for _, u := range []any{creator, member} {
+		if code := call(PushMovie, u, `{"name":"a","url":"https://example.com/a.mp4"}`); code != http.StatusNoContent {
+			t.Fatalf("push = %d, want %d", code, http.StatusNoContent)
+		}
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 {
+		t.Fatalf("playlist = %d movies, want 2", len(ms))
+	}
+	own, others := ms[1].ID, ms[0].ID
+	if ms[0].CreatorID == member.ID {
+		own, others = others, own
+	}
+
+	edit := func(id uint) string {
+		return fmt.Sprintf(`{"id":%d,"name":"b","url":"https://example.com/b.mp4"}`, id)
+	}
+	if code := call(EditMovie, member, edit(others)); code != http.StatusForbidden {
+		t.Fatalf("edit the movie of others = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := call(EditMovie, member, edit(own)); code != http.StatusNoContent {
+		t.Fatalf("edit own movie = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := call(ClearMovies, member, ""); code != http.StatusForbidden {
+		t.Fatalf("clear without CanDeleteUserMovies = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := call(DelMovie, member, fmt.Sprintf(`{"ids":[%d,%d]}`, own, others)); code != http.StatusForbidden {
+		t.Fatalf("delete the movie of others = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := call(DelMovie, member, fmt.Sprintf(`{"ids":[%d]}`, own)); code != http.StatusNoContent {
+		t.Fatalf("delete own movie = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := call(ChangeCurrentMovie, restricted, fmt.Sprintf(`{"id":%d}`, others)); code != http.StatusForbidden {
+		t.Fatalf("change current without CanChangeCurrentMovie = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := call(DelMovie, creator, fmt.Sprintf(`{"ids":[%d]}`, others)); code != http.StatusNoContent {
+		t.Fatalf("creator delete = %d, want %d", code, http.StatusNoContent)
+	}
+}
+
+func TestProxyMovieURL(t *testing.T) {
+	expire := conf.Conf().Proxy.SignedURLExpire
+	conf.Conf().Proxy.SignedURLExpire = "6h"
+	defer func() { conf.Conf().Proxy.SignedURLExpire = expire }()
+	creator := newTestUser(t, "proxy-url-creator")
+	room := newTestRoom(t, creator, "proxy-url-room")
+	if code := status(PushMovie, httptest.NewRequest(http.MethodPost, "/api/movie/push", strings.NewReader(`{"name":"proxied","url":"http://203.0.113.1/movie.mp4","proxy":true}`)), gin.H{"user": creator, "room": room}); code != http.StatusNoContent {
+		t.Fatalf("push proxied movie: status = %d", code)
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil || len(ms) != 1 {
+		t.Fatalf("movies = %v, %v", ms, err)
+	}
+	m := ms[0]
+	token, err := middlewares.NewAuthRoomToken(nil, creator, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := gin.New()
+	Init(e)
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+	verify := func(rawURL, pullKey string) error {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, rawURL, nil)
+		return middlewares.VerifyProxyURL(ctx, room, pullKey)
+	}
+
+	w := get(fmt.Sprintf("/api/movie/proxyUrl?id=%d", m.ID), token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("proxy url: status = %d, %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data model.ProxyURLResp `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resp.Data.Url, "/api/movie/proxy/"+room.ID+"/"+m.PullKey+"?") || resp.Data.ExpiresAt <= time.Now().UnixMilli() {
+		t.Fatalf("proxy url = %+v", resp.Data)
+	}
+	if err := verify(resp.Data.Url, m.PullKey); err != nil {
+		t.Fatalf("signed url rejected: %v", err)
+	}
+	if err := verify(resp.Data.Url, "other-pull-key"); err == nil {
+		t.Fatal("signature accepted for another movie")
+	}
+	if err := verify(strings.Replace(resp.Data.Url, "e=", "e=1", 1), m.PullKey); err == nil {
+		t.Fatal("signature accepted with another expiry")
+	}
+	if code := get("/api/movie/proxy/"+room.ID+"/"+m.PullKey, "").Code; code != http.StatusForbidden {
+		t.Fatalf("unsigned proxy: status = %d, want 403", code)
+	}
+
+	// the url dies with the room token it was issued to
+	claims := &middlewares.AuthRoomClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(resp.Data.Url, m.PullKey); err == nil {
+		t.Fatal("signature accepted after the room token was revoked")
+	}
+
+	// and with every token of the user
+	token, err = middlewares.NewAuthRoomToken(nil, creator, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = get(fmt.Sprintf("/api/movie/proxyUrl?id=%d", m.ID), token)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(resp.Data.Url, m.PullKey); err != nil {
+		t.Fatalf("signed url rejected: %v", err)
+	}
+	if err := creator.LogoutAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(resp.Data.Url, m.PullKey); err == nil {
+		t.Fatal("signature accepted after the user logged out everywhere")
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+func profileResp(user *op.User) gin.H {
+	return gin.H{
+		"username":    user.Username,
+		"displayName": user.DisplayName,
+		"avatar":      user.Avatar,
+		"bio":         user.Bio,
+	}
+}
+
+func Profile(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(profileResp(user)))
+}
+
+// UpdateProfile sets the profile from a json body, or uploads the avatar
+// from the file field avatar of a multipart form
+func UpdateProfile(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	if ctx.ContentType() == gin.MIMEMultipartPOSTForm {
+		uploadAvatar(ctx, user)
+		return
+	}
+
+	req := model.ProfileReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	user, err := user.UpdateProfile(req.DisplayName, req.Avatar, req.Bio)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(profileResp(user)))
+}
+
+func uploadAvatar(ctx *gin.Context, user *op.User) {
+	fh, err := ctx.FormFile("avatar")
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	maxSize := conf.Conf().User.AvatarMaxSize << 10
+	if fh.Size > maxSize {
+		ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, model.NewApiErrorStringResp("avatar too large"))
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxSize))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	user, err = user.UploadAvatar(data)
+	if err != nil {
+		if errors.Is(err, op.ErrAvatarStorage) {
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(profileResp(user)))
+}
+
+// ServeAvatar serves an uploaded avatar, it is public so img tags can load it
+func ServeAvatar(ctx *gin.Context) {
+	data, contentType, err := op.GetAvatar(ctx.Param("key"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+	ctx.Header("Cache-Control", "public, max-age=86400")
+	ctx.Data(http.StatusOK, contentType, data)
+}
+
+func newUsernameChangesResp(changes []*dbModel.UsernameChange) []*model.UsernameChangeResp {
+	resp := make([]*model.UsernameChangeResp, len(changes))
+	for i, c := range changes {
+		resp[i] = &model.UsernameChangeResp{
+			Id:        c.ID,
+			UserId:    c.UserID,
+			OldName:   c.OldName,
+			NewName:   c.NewName,
+			CreatedAt: model.Timestamp(c.CreatedAt),
+		}
+	}
+	return resp
+}
+
+// RenameUser changes the username, at most once per rename cooldown
+func RenameUser(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.RenameUserReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	user, err := user.Rename(req.Username)
+	switch {
+	case errors.Is(err, op.ErrRenameCooldown):
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, db.ErrUsernameTaken):
+		ctx.AbortWithStatusJSON(http.StatusConflict, model.NewApiErrorResp(err))
+		return
+	case err != nil:
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	next, err := user.NextRenameAt()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"username":     user.Username,
+		"nextRenameAt": model.Timestamp(next),
+	}))
+}
+
+// UsernameChanges lists the username changes of the user
+func UsernameChanges(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	changes, err := user.UsernameChanges()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(newUsernameChangesResp(changes)))
+}
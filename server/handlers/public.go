@@ -3,21 +3,42 @@ package handlers
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/email"
+	"github.com/synctv-org/synctv/internal/settings"
 	"github.com/synctv-org/synctv/server/model"
 )
 
 func Settings(ctx *gin.Context) {
 	ctx.JSON(200, model.NewApiDataResp(gin.H{
 		"rtmp": gin.H{
-			"enable":     conf.Conf.Rtmp.Enable,
-			"rtmpPlayer": conf.Conf.Rtmp.RtmpPlayer,
+			"enable":     conf.Conf().Rtmp.Enable,
+			"rtmpPlayer": conf.Conf().Rtmp.RtmpPlayer,
 		},
 		"proxy": gin.H{
-			"movieProxy": conf.Conf.Proxy.MovieProxy,
-			"liveProxy":  conf.Conf.Proxy.LiveProxy,
+			"movieProxy": conf.Conf().Proxy.MovieProxy,
+			"liveProxy":  conf.Conf().Proxy.LiveProxy,
+		},
+		"user": gin.H{
+			"signup":              !conf.Conf().User.DisableSignup,
+			"passwordReset":       email.Enabled(),
+			"requireVerification": conf.Conf().Email.RequireVerification,
 		},
 		"room": gin.H{
-			"mustPassword": conf.Conf.Room.MustPassword,
+			"mustPassword":  conf.Conf().Room.MustPassword,
+			"createEnabled": !settings.DisableCreateRoom.Get(),
+			"guestEnabled":  !settings.DisableGuest.Get(),
+		},
+		"notice": settings.Notice.Get(),
+		"captcha": gin.H{
+			"provider":   settings.CaptchaProvider.Get(),
+			"siteKey":    settings.CaptchaSiteKey.Get(),
+			"signup":     settings.CaptchaSignup.Get(),
+			"createRoom": settings.CaptchaCreateRoom.Get(),
+		},
+		"terms": gin.H{
+			"enable":  conf.Conf().Terms.Enable,
+			"version": conf.Conf().Terms.Version,
+			"url":     conf.Conf().Terms.Url,
 		},
 	}))
 }
@@ -4,16 +4,20 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/maruel/natural"
 	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/metrics"
 	dbModel "github.com/synctv-org/synctv/internal/model"
 	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/requestid"
 	"github.com/synctv-org/synctv/server/middlewares"
 	"github.com/synctv-org/synctv/server/model"
-	"github.com/zijiren233/gencontainer/vec"
+	"github.com/synctv-org/synctv/utils"
 )
 
 var (
@@ -28,6 +32,12 @@ func (e FormatErrNotSupportPosition) Error() string {
 	return fmt.Sprintf("not support position %s", string(e))
 }
 
+// createRoomDenied reports whether err denies the user any room, rather than rejecting the request
+func createRoomDenied(err error) bool {
+	return errors.Is(err, op.ErrTermsNotAccepted) || errors.Is(err, op.ErrAccountTooNew) ||
+		errors.Is(err, op.ErrCreateRoomDisabled) || errors.Is(err, db.ErrTooManyRooms)
+}
+
 func CreateRoom(ctx *gin.Context) {
 	user := ctx.MustGet("user").(*op.User)
 	req := model.CreateRoomReq{}
@@ -36,8 +46,19 @@ func CreateRoom(ctx *gin.Context) {
 		return
 	}
 
-	r, err := user.CreateRoom(req.RoomName, req.Password, db.WithSetting(req.Setting))
+	conf := []db.CreateRoomConfig{db.WithSetting(req.Setting.Setting)}
+	if req.ScheduledAt != 0 {
+		conf = append(conf, db.WithScheduledAt(time.UnixMilli(req.ScheduledAt)))
+	}
+	if len(req.Tags) != 0 {
+		conf = append(conf, db.WithTagNames(req.Tags))
+	}
+	r, err := user.CreateRoomContext(ctx.Request.Context(), req.RoomName, req.Password, conf...)
 	if err != nil {
+		if createRoomDenied(err) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
@@ -48,7 +69,7 @@ func CreateRoom(ctx *gin.Context) {
 		return
 	}
 
-	token, err := middlewares.NewAuthRoomToken(user, room)
+	token, err := middlewares.NewAuthRoomToken(ctx, user, room)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
 		return
@@ -60,100 +81,282 @@ func CreateRoom(ctx *gin.Context) {
 	}))
 }
 
+func CloneRoom(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+	req := model.CloneRoomReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	clone, err := user.CloneRoom(room, req.RoomName, req.Password, req.WithMovies)
+	if err != nil {
+		if createRoomDenied(err) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	token, err := middlewares.NewAuthRoomToken(ctx, user, clone)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, model.NewApiDataResp(gin.H{
+		"roomId": clone.ID,
+		"token":  token,
+	}))
+}
+
 func RoomList(ctx *gin.Context) {
-	r := op.GetAllRoomsWithoutHidden()
-	resp := vec.New[*model.RoomListResp](vec.WithCmpLess[*model.RoomListResp](func(v1, v2 *model.RoomListResp) bool {
-		return v1.PeopleNum < v2.PeopleNum
-	}), vec.WithCmpEqual[*model.RoomListResp](func(v1, v2 *model.RoomListResp) bool {
-		return v1.PeopleNum == v2.PeopleNum
-	}))
-	for _, v := range r {
-		resp.Push(&model.RoomListResp{
-			RoomId:       v.ID,
-			RoomName:     v.Name,
-			PeopleNum:    v.ClientNum(),
-			NeedPassword: v.NeedPassword(),
-			Creator:      op.GetUserName(v.Room.CreatorID),
-			CreatedAt:    v.Room.CreatedAt.UnixMilli(),
-		})
-	}
-
-	switch ctx.DefaultQuery("sort", "peopleNum") {
-	case "peopleNum":
-		resp.SortStable()
-	case "creator":
-		resp.SortStableFunc(func(v1, v2 *model.RoomListResp) bool {
-			return natural.Less(v1.Creator, v2.Creator)
-		}, func(t1, t2 *model.RoomListResp) bool {
-			return t1.Creator == t2.Creator
-		})
-	case "createdAt":
-		resp.SortStableFunc(func(v1, v2 *model.RoomListResp) bool {
-			return v1.CreatedAt < v2.CreatedAt
-		}, func(t1, t2 *model.RoomListResp) bool {
-			return t1.CreatedAt == t2.CreatedAt
-		})
-	case "roomName":
-		resp.SortStableFunc(func(v1, v2 *model.RoomListResp) bool {
-			return natural.Less(v1.RoomName, v2.RoomName)
-		}, func(t1, t2 *model.RoomListResp) bool {
-			return t1.RoomName == t2.RoomName
-		})
-	case "roomId":
-		resp.SortStableFunc(func(v1, v2 *model.RoomListResp) bool {
-			return v1.RoomId < v2.RoomId
-		}, func(t1, t2 *model.RoomListResp) bool {
-			return t1.RoomId == t2.RoomId
-		})
-	case "needPassword":
-		resp.SortStableFunc(func(v1, v2 *model.RoomListResp) bool {
-			return v1.NeedPassword && !v2.NeedPassword
-		}, func(t1, t2 *model.RoomListResp) bool {
-			return t1.NeedPassword == t2.NeedPassword
-		})
+	page, max, err := GetPageAndMax(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if page <= 0 || max <= 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("page and max must be greater than 0"))
+		return
+	}
+
+	sortBy := ctx.DefaultQuery("sort", "peopleNum")
+	switch db.RoomsSort(sortBy) {
+	case "peopleNum", db.RoomsSortCreator, db.RoomsSortCreatedAt, db.RoomsSortName, db.RoomsSortID, db.RoomsSortNeedPassword:
 	default:
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("sort must be peoplenum or roomid"))
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("sort must be peopleNum, roomId, roomName, creator, createdAt or needPassword"))
 		return
 	}
 
+	var desc bool
 	switch ctx.DefaultQuery("order", "desc") {
 	case "asc":
-		// do nothing
 	case "desc":
-		resp.Reverse()
+		desc = true
 	default:
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("order must be asc or desc"))
 		return
 	}
 
-	list, err := GetPageItems(ctx, resp.Slice())
+	filters := []db.GetRoomsConfig{db.WithoutHidden()}
+	if tag := strings.ToLower(strings.TrimSpace(ctx.Query("tag"))); tag != "" {
+		filters = append(filters, db.WithTag(tag))
+	}
+
+	// favorite rooms of a signed in user are pinned before the sorted rooms
+	var pinned []*dbModel.Room
+	if user, err := middlewares.AuthUser(ctx.GetHeader("Authorization")); err == nil {
+		pinned, err = user.FavoriteRooms(filters...)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+			return
+		}
+		ids := make([]string, len(pinned))
+		for i, r := range pinned {
+			ids[i] = r.ID
+		}
+		filters = append(filters, db.WithoutRoomIDs(ids...))
+	}
+
+	offset, limit := int((page-1)*max), int(max)
+	var (
+		list  = genRoomListResp(pinned[minInt(offset, len(pinned)):minInt(offset+limit, len(pinned))])
+		rest  []*model.RoomListResp
+		total int64
+	)
+	offset, limit = maxInt(offset-len(pinned), 0), limit-len(list)
+	if sortBy == "peopleNum" {
+		rest, total, err = roomListByPeopleNum(offset, limit, desc, filters...)
+	} else {
+		var rooms []*dbModel.Room
+		rooms, total, err = db.GetRoomsPaginated(offset, limit, append(filters, db.WithRoomsOrder(db.RoomsSort(sortBy), desc))...)
+		rest = genRoomListResp(rooms)
+	}
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
 		return
 	}
+	list = append(list, rest...)
+	total += int64(len(pinned))
 
 	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
-		"total": resp.Len(),
+		"total": total,
 		"list":  list,
 	}))
 }
 
-func CheckRoom(ctx *gin.Context) {
-	id, err := strconv.Atoi(ctx.Query("roomId"))
+func SearchRoom(ctx *gin.Context) {
+	keyword := strings.TrimSpace(ctx.Query("keyword"))
+	if keyword == "" {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("keyword is required"))
+		return
+	}
+	if len(keyword) > 32 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("keyword is too long"))
+		return
+	}
+
+	page, max, err := GetPageAndMax(ctx)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
+	if page <= 0 || max <= 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("page and max must be greater than 0"))
+		return
+	}
+
+	rooms, total, err := db.GetRoomsPaginated(
+		int((page-1)*max), int(max),
+		db.WithoutHidden(), db.WithKeyword(keyword), db.WithRoomsOrder(db.RoomsSortName, false),
+	)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"total": total,
+		"list":  genRoomListResp(rooms),
+	}))
+}
+
+func genRoomListResp(rooms []*dbModel.Room) []*model.RoomListResp {
+	resp := make([]*model.RoomListResp, len(rooms))
+	for i, r := range rooms {
+		resp[i] = &model.RoomListResp{
+			RoomId:       r.ID,
+			RoomName:     r.Name,
+			PeopleNum:    op.PeopleNum(r.ID),
+			NeedPassword: len(r.HashedPassword) != 0,
+			Creator:      op.GetUserName(r.CreatorID),
+			CreatedAt:    model.Timestamp(r.CreatedAt),
+			Tags:         r.TagNames(),
+		}
+	}
+	return resp
+}
+
+// roomListByPeopleNum pages rooms ordered by people number. The number only
+// exists in memory, so the few rooms with clients are sorted here and the
+// empty rooms are paged from the database.
+func roomListByPeopleNum(offset, limit int, desc bool, filters ...db.GetRoomsConfig) ([]*model.RoomListResp, int64, error) {
+	online := []*dbModel.Room{}
+	for _, r := range op.GetAllRoomsWithoutHidden() {
+		if r.PeopleNum() > 0 {
+			online = append(online, &r.Room)
+		}
+	}
+	if len(filters) != 0 && len(online) != 0 {
+		var err error
+		if online, err = filterRooms(online, filters...); err != nil {
+			return nil, 0, err
+		}
+	}
+	sort.SliceStable(online, func(i, j int) bool {
+		ni, nj := op.PeopleNum(online[i].ID), op.PeopleNum(online[j].ID)
+		if ni != nj {
+			return ni < nj
+		}
+		if !online[i].CreatedAt.Equal(online[j].CreatedAt) {
+			return online[i].CreatedAt.Before(online[j].CreatedAt)
+		}
+		return online[i].ID < online[j].ID
+	})
+	ids := make([]string, len(online))
+	for i, r := range online {
+		ids[i] = r.ID
+	}
+
+	var rooms []*dbModel.Room
+	if desc {
+		// rooms with clients come first
+		for i := len(online) - 1 - offset; i >= 0 && len(rooms) < limit; i-- {
+			rooms = append(rooms, online[i])
+		}
+		offline, total, err := db.GetRoomsPaginated(
+			maxInt(offset-len(online), 0),
+			limit-len(rooms),
+			append(filters, db.WithoutRoomIDs(ids...), db.WithRoomsOrder(db.RoomsSortCreatedAt, true))...,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		return genRoomListResp(append(rooms, offline...)), total + int64(len(online)), nil
+	}
+
+	offline, total, err := db.GetRoomsPaginated(
+		offset, limit,
+		append(filters, db.WithoutRoomIDs(ids...), db.WithRoomsOrder(db.RoomsSortCreatedAt, false))...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	rooms = offline
+	for i := maxInt(offset-int(total), 0); i < len(online) && len(rooms) < limit; i++ {
+		rooms = append(rooms, online[i])
+	}
+	return genRoomListResp(rooms), total + int64(len(online)), nil
+}
+
+// filterRooms keeps the rooms matching filters in the database
+func filterRooms(rooms []*dbModel.Room, filters ...db.GetRoomsConfig) ([]*dbModel.Room, error) {
+	ids := make([]string, len(rooms))
+	for i, r := range rooms {
+		ids[i] = r.ID
+	}
+	matched, err := db.FilterRoomIDs(ids, filters...)
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[string]struct{}, len(matched))
+	for _, id := range matched {
+		keep[id] = struct{}{}
+	}
+	filtered := rooms[:0]
+	for _, r := range rooms {
+		if _, ok := keep[r.ID]; ok {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func CheckRoom(ctx *gin.Context) {
+	id := ctx.Query("roomId")
+	if id == "" {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(model.ErrEmptyRoomId))
+		return
+	}
 
-	r, err := op.GetRoomByID(uint(id))
+	r, err := op.GetRoomByID(id)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
 		return
 	}
 
 	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
-		"peopleNum":    r.ClientNum(),
+		"peopleNum":    r.PeopleNum(),
 		"needPassword": r.NeedPassword(),
+		"createdAt":    model.Timestamp(r.CreatedAt),
+		"scheduledAt":  model.Timestamp(r.ScheduledAt),
 	}))
 }
 
@@ -166,13 +369,46 @@ func LoginRoom(ctx *gin.Context) {
 		return
 	}
 
-	room, err := middlewares.AuthRoomWithPassword(user, req.RoomId, req.Password)
+	if err := user.CheckTerms(); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
+
+	keys := op.RoomLoginKeys(ctx.ClientIP(), req.RoomId, user.ID)
+	if wait, err := op.CheckLoginLock(ctx.Request.Context(), keys...); err != nil {
+		abortLoginLocked(ctx, wait, err)
+		return
+	}
+
+	room, err := middlewares.AuthRoomWithPassword(ctx.Request.Context(), user, req.RoomId, req.Password)
 	if err != nil {
+		if errors.Is(err, op.ErrNotWhitelisted) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		if errors.Is(err, middlewares.ErrAuthFailed) {
+			metrics.AuthFailures.WithLabelValues("room_login").Inc()
+			op.RecordLoginFailure(ctx.Request.Context(), keys...)
+		}
 		ctx.AbortWithStatusJSON(http.StatusUnauthorized, model.NewApiErrorResp(err))
 		return
 	}
+	if err := op.ResetLoginFailures(ctx.Request.Context(), keys[1:]...); err != nil {
+		requestid.Log(ctx.Request.Context()).Errorf("reset room login failures of user %d failed: %s", user.ID, err.Error())
+	}
+
+	if err := room.CheckCapacity(user); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := room.AddMember(user.ID); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventUserJoined, "")
 
-	token, err := middlewares.NewAuthRoomToken(user, room)
+	token, err := middlewares.NewAuthRoomToken(ctx, user, room)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
 		return
@@ -184,6 +420,85 @@ func LoginRoom(ctx *gin.Context) {
 	}))
 }
 
+// BatchRooms applies one action to several rooms created by the user, atomically
+func BatchRooms(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.BatchRoomReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	var err error
+	switch req.Action {
+	case model.BatchRoomDelete:
+		err = user.DeleteRooms(req.RoomIds)
+	case model.BatchRoomHide:
+		err = user.SetRoomsHidden(req.RoomIds, true)
+	case model.BatchRoomShow:
+		err = user.SetRoomsHidden(req.RoomIds, false)
+	case model.BatchRoomPassword:
+		err = user.SetRoomsPassword(req.RoomIds, req.Password)
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// GuestLogin gives a view only room token to a visitor without an account
+func GuestLogin(ctx *gin.Context) {
+	req := model.LoginRoomReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	room, err := op.GetRoomByID(req.RoomId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+	if err := room.CheckGuest(); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
+
+	keys := op.RoomGuestLoginKeys(ctx.ClientIP(), room.ID)
+	if wait, err := op.CheckLoginLock(ctx.Request.Context(), keys...); err != nil {
+		abortLoginLocked(ctx, wait, err)
+		return
+	}
+	if !room.CheckPassword(req.Password) {
+		metrics.AuthFailures.WithLabelValues("guest_login").Inc()
+		op.RecordLoginFailure(ctx.Request.Context(), keys...)
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, model.NewApiErrorResp(middlewares.ErrAuthFailed))
+		return
+	}
+	// like the other logins, a success does not reset the key of the ip
+
+	guest := op.NewGuest(op.NewGuestID(), "guest-"+utils.RandString(6))
+	if err := room.CheckCapacity(guest); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
+
+	token, err := middlewares.NewAuthRoomToken(ctx, guest, room)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"roomId":   room.ID,
+		"username": guest.Username,
+		"token":    token,
+	}))
+}
+
 func DeleteRoom(ctx *gin.Context) {
 	room := ctx.MustGet("room").(*op.Room)
 	user := ctx.MustGet("user").(*op.User)
@@ -193,7 +508,18 @@ func DeleteRoom(ctx *gin.Context) {
 		return
 	}
 
-	err := op.DeleteRoom(room)
+	// purge=false keeps the room restorable by an admin until the retention sweeper purges it
+	purge, err := strconv.ParseBool(ctx.DefaultQuery("purge", "true"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if purge {
+		err = op.DeleteRoom(room)
+	} else {
+		err = op.SoftDeleteRoom(room)
+	}
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
 		return
@@ -229,12 +555,650 @@ func SetRoomPassword(ctx *gin.Context) {
 	}))
 }
 
-func RoomSetting(ctx *gin.Context) {
+func SetAnnouncement(ctx *gin.Context) {
 	room := ctx.MustGet("room").(*op.Room)
-	// user := ctx.MustGet("user").(*op.User)
+	user := ctx.MustGet("user").(*op.User)
+
+	if !user.HasPermission(room, dbModel.CanSetAnnouncement) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to set announcement"))
+		return
+	}
+
+	req := model.AnnouncementReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := room.SetAnnouncement(req.Announcement); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventSettingsChanged, "announcement")
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func TransferRoom(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.UserIdReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.TransferRoom(room, req.UserId); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventSettingsChanged, fmt.Sprintf("transfer room to user %d", req.UserId))
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// Permissions lists the permission bits with their names
+func Permissions(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(dbModel.PermissionNames))
+}
+
+// ChangeUserPermission adds and removes permission bits of a member, and returns its new permissions
+func ChangeUserPermission(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.ChangeUserPermissionReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.ChangeUserPermission(room, req.UserId, req.Add, req.Remove); err != nil {
+		abortChangePermission(ctx, err)
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPermissionsChanged, fmt.Sprintf("change permissions of user %d, add %d, remove %d", req.UserId, req.Add, req.Remove))
+
+	memberPermissionsResp(ctx, room, req.UserId)
+}
+
+// BatchChangeUserPermission changes the permissions of several members in one
+// transaction, and returns their new permissions
+func BatchChangeUserPermission(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.BatchChangeUserPermissionReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.ChangeUsersPermission(room, req.PermissionChanges()); err != nil {
+		abortChangePermission(ctx, err)
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPermissionsChanged, fmt.Sprintf("change permissions of %d users", len(req.Changes)))
+
+	resp := make([]gin.H, len(req.Changes))
+	for i, c := range req.Changes {
+		ur, err := op.GetRoomUserRelation(room.ID, c.UserId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+			return
+		}
+		resp[i] = gin.H{
+			"userId":      c.UserId,
+			"permissions": ur.Permissions,
+		}
+	}
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(resp))
+}
+
+// RolePresets lists the role presets with their permissions
+func RolePresets(ctx *gin.Context) {
+	resp := make([]gin.H, len(dbModel.RolePresets))
+	for i, r := range dbModel.RolePresets {
+		resp[i] = gin.H{
+			"role":        r,
+			"permissions": r.Permissions(),
+		}
+	}
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(resp))
+}
+
+// AssignRole gives a member the permissions of a role preset, and returns its new permissions
+func AssignRole(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.AssignRoleReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.AssignRole(room, req.UserId, req.Role); err != nil {
+		abortChangePermission(ctx, err)
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPermissionsChanged, fmt.Sprintf("assign role %s to user %d", req.Role, req.UserId))
+
+	memberPermissionsResp(ctx, room, req.UserId)
+}
+
+// SetDefaultPermissions changes the permissions users get when they join the room
+func SetDefaultPermissions(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.SetDefaultPermissionsReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.SetDefaultPermissions(room, *req.Permissions); err != nil {
+		abortChangePermission(ctx, err)
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventSettingsChanged, fmt.Sprintf("set default permissions to %d", *req.Permissions))
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"permissions": *req.Permissions,
+		"role":        dbModel.RolePresetOf(*req.Permissions),
+	}))
+}
+
+func abortChangePermission(ctx *gin.Context, err error) {
+	if errors.Is(err, op.ErrNoPermission) || errors.Is(err, op.ErrGrantPermission) || errors.Is(err, op.ErrTargetPermission) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
+	ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+}
+
+func memberPermissionsResp(ctx *gin.Context, room *op.Room, userID uint) {
+	ur, err := op.GetRoomUserRelation(room.ID, userID)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
 
 	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
-		"hidden":       room.Setting.Hidden,
-		"needPassword": room.NeedPassword(),
+		"permissions": ur.Permissions,
 	}))
 }
+
+func RoomMembers(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+
+	members, err := room.Members()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		if members[i].Online != members[j].Online {
+			return members[i].Online
+		}
+		return members[i].Role > members[j].Role
+	})
+
+	resp := make([]*model.RoomMemberResp, len(members))
+	for i, m := range members {
+		resp[i] = &model.RoomMemberResp{
+			UserId:      m.UserID,
+			Username:    m.Username,
+			DisplayName: m.DisplayName,
+			Avatar:      m.Avatar,
+			Role:        m.Role,
+			Permissions: m.Permissions,
+			Online:      m.Online,
+			JoinedAt:    model.Timestamp(m.CreatedAt),
+		}
+	}
+
+	list, err := GetPageItems(ctx, resp)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"total": len(resp),
+		"list":  list,
+	}))
+}
+
+func RoomEvents(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	if !user.HasPermission(room, dbModel.CanViewRoomEvents) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to view room events"))
+		return
+	}
+
+	page, max, err := GetPageAndMax(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if page <= 0 || max <= 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("page and max must be greater than 0"))
+		return
+	}
+
+	events, total, err := room.Events(int((page-1)*max), int(max))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	resp := make([]*model.RoomEventResp, len(events))
+	for i, e := range events {
+		resp[i] = &model.RoomEventResp{
+			Id:        e.ID,
+			UserId:    e.UserID,
+			Username:  op.GetUserName(e.UserID),
+			Type:      e.Type,
+			Detail:    e.Detail,
+			CreatedAt: model.Timestamp(e.CreatedAt),
+		}
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"total": total,
+		"list":  resp,
+	}))
+}
+
+// PermissionAudit lists the permission changes of the room members, newest first
+func PermissionAudit(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	if !user.HasPermission(room, dbModel.CanViewRoomEvents) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to view room events"))
+		return
+	}
+
+	page, max, err := GetPageAndMax(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if page <= 0 || max <= 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("page and max must be greater than 0"))
+		return
+	}
+
+	audits, total, err := room.PermissionAudits(int((page-1)*max), int(max))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	resp := make([]*model.PermissionAuditResp, len(audits))
+	for i, a := range audits {
+		resp[i] = &model.PermissionAuditResp{
+			Id:             a.ID,
+			ActorId:        a.ActorID,
+			ActorUsername:  op.GetUserName(a.ActorID),
+			TargetId:       a.TargetID,
+			TargetUsername: op.GetUserName(a.TargetID),
+			Role:           a.Role,
+			Before:         a.Before,
+			After:          a.After,
+			CreatedAt:      model.Timestamp(a.CreatedAt),
+		}
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"total": total,
+		"list":  resp,
+	}))
+}
+
+// ChatHistory returns the chat messages sent before the message with the id in
+// the before query, the newest messages without it, oldest first
+func ChatHistory(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+
+	before, err := strconv.ParseUint(ctx.DefaultQuery("before", "0"), 10, 64)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("before must be a message id"))
+		return
+	}
+	max, err := strconv.Atoi(ctx.DefaultQuery("max", "50"))
+	if err != nil || max < 1 || max > 100 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("max must be between 1 and 100"))
+		return
+	}
+
+	messages, err := room.ChatHistory(uint(before), max)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	resp := make([]*model.ChatMessageResp, len(messages))
+	for i, m := range messages {
+		resp[i] = &model.ChatMessageResp{
+			Id:        m.ID,
+			UserId:    m.UserID,
+			Username:  op.GetUserName(m.UserID),
+			Content:   m.Content,
+			CreatedAt: model.Timestamp(m.CreatedAt),
+		}
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"list": resp,
+	}))
+}
+
+// ReadChat records that the user read the chat up to the message id, across all their devices
+func ReadChat(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.IdReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if err := room.MarkChatRead(user.ID, req.Id); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// UnreadChat returns the unread chat messages and mentions of the user
+func UnreadChat(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	lastRead, unread, mentions, err := room.ChatUnread(user)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"lastReadId": lastRead,
+		"unread":     unread,
+		"mentions":   mentions,
+	}))
+}
+
+// DeleteChatMessage deletes a chat message of the room, users may delete their own messages
+func DeleteChatMessage(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(model.ErrId))
+		return
+	}
+	msg, err := room.GetChatMessage(uint(id))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+	if msg.UserID != user.ID && !user.HasPermission(room, dbModel.CanDeleteChatMessage) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to delete chat messages"))
+		return
+	}
+	if err := room.DeleteChatMessage(msg.ID); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	if msg.UserID != user.ID {
+		room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventChatDeleted, fmt.Sprintf("delete chat message of %s", op.GetUserName(msg.UserID)))
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func MuteUser(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	if !user.HasPermission(room, dbModel.CanMuteUser) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to mute users"))
+		return
+	}
+
+	req := model.MuteUserReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := room.Mute(req.Id, time.Duration(req.Duration)*time.Second); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if req.Duration > 0 {
+		room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventUserMuted, fmt.Sprintf("mute %s for %ds", op.GetUserName(req.Id), req.Duration))
+	} else {
+		room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventUserMuted, fmt.Sprintf("unmute %s", op.GetUserName(req.Id)))
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// KickUser disconnects a user from the room, unlike a ban the user can join again
+func KickUser(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.IdReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.Kick(room, req.Id); err != nil {
+		switch {
+		case errors.Is(err, op.ErrNoPermission), errors.Is(err, op.ErrTargetPermission):
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		case errors.Is(err, op.ErrUserNotConnected):
+			ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		default:
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		}
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventUserKicked, fmt.Sprintf("kick %s", op.GetUserName(req.Id)))
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func CreateInvite(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.CreateInviteReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	invite, err := user.CreateInvite(room, req.Permissions, req.ExpireDuration(), req.MaxUses)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
+
+	token, err := middlewares.NewInviteToken(invite)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, model.NewApiDataResp(gin.H{
+		// id revokes the invite, see DeleteInvite
+		"id":        invite.ID,
+		"token":     token,
+		"expiresAt": model.Timestamp(invite.ExpiresAt),
+		"maxUses":   invite.MaxUses,
+	}))
+}
+
+// DeleteInvite revokes an invite of the room, its tokens stop working
+func DeleteInvite(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(model.ErrId))
+		return
+	}
+	if err := user.DeleteInvite(room, uint(id)); err != nil {
+		switch {
+		case errors.Is(err, db.ErrInviteNotFound):
+			ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		case errors.Is(err, op.ErrNoPermission):
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		default:
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		}
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func JoinInvite(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.JoinInviteReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.CheckTerms(); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
+
+	room, err := middlewares.AuthInvite(user, req.Token)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, model.NewApiErrorResp(err))
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventUserJoined, "invite")
+
+	token, err := middlewares.NewAuthRoomToken(ctx, user, room)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"roomId": room.ID,
+		"token":  token,
+	}))
+}
+
+func roomSettingResp(room *op.Room) gin.H {
+	setting := room.Settings()
+	return gin.H{
+		"hidden":         setting.Hidden,
+		"needPassword":   room.NeedPassword(),
+		"scheduledAt":    model.Timestamp(room.ScheduledAt),
+		"maxClients":     setting.MaxClients,
+		"chatEnabled":    !setting.DisableChat,
+		"tags":           room.TagNames(),
+		"announcement":   setting.Announcement,
+		"whitelistOnly":  setting.WhitelistOnly,
+		"allowGuest":     setting.AllowGuest,
+		"hostOnly":       setting.HostOnly,
+		"voteThreshold":  setting.VoteThreshold,
+		"autoNext":       setting.AutoNext,
+		"playMode":       room.PlayMode(),
+		"danmakuEnabled": !setting.DisableDanmaku,
+		"voiceEnabled":   setting.EnableVoice,
+		"chatFilter":     setting.ChatFilter,
+		// defaultRole is the preset with the default permissions, empty if none has them
+		"defaultPermissions": setting.MemberPermissions(),
+		"defaultRole":        dbModel.RolePresetOf(setting.MemberPermissions()),
+	}
+}
+
+func RoomSetting(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	// user := ctx.MustGet("user").(*op.User)
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(roomSettingResp(room)))
+}
+
+func UpdateRoomSetting(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	if !user.HasPermission(room, dbModel.CanChangeRoomSetting) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to change room setting"))
+		return
+	}
+
+	req := model.RoomSettingReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if req.Password != nil && !user.HasPermission(room, dbModel.CanSetRoomPassword) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to set room password"))
+		return
+	}
+	if req.DefaultRole != nil {
+		if err := user.SetDefaultPermissions(room, req.DefaultRole.Permissions()); err != nil {
+			abortChangePermission(ctx, err)
+			return
+		}
+	}
+
+	err := room.UpdateSetting(func(s *dbModel.Setting) error {
+		req.Apply(s)
+		return nil
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	if req.Tags != nil {
+		if err := room.SetTags(*req.Tags); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+			return
+		}
+	}
+
+	resp := roomSettingResp(room)
+	if req.Password != nil {
+		if err := room.SetPassword(*req.Password); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+			return
+		}
+		// changing the password invalidates the room tokens
+		token, err := middlewares.NewAuthRoomToken(ctx, user, room)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+			return
+		}
+		resp["needPassword"] = room.NeedPassword()
+		resp["token"] = token
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventSettingsChanged, "")
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(resp))
+}
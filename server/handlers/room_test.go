@@ -0,0 +1,726 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/tracing"
+	pb "github.com/synctv-org/synctv/proto"
+	"github.com/synctv-org/synctv/server/middlewares"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func searchRoomNames(t *testing.T, keyword string) []string {
+	t.Helper()
+	resp := serve(t, SearchRoom, httptest.NewRequest(http.MethodGet, "/api/room/search?max=100&keyword="+url.QueryEscape(keyword), nil), nil)
+	var names []string
+	for _, v := range resp["data"].(map[string]any)["list"].([]any) {
+		names = append(names, v.(map[string]any)["roomName"].(string))
+	}
+	return names
+}
+
+func TestSearchRoom(t *testing.T) {
+	alice := newTestUser(t, "search-alice")
+	bob := newTestUser(t, "search-bob")
+	newTestRoom(t, alice, "Search Movie Night")
+	newTestRoom(t, bob, "search_100%")
+	newTestRoom(t, bob, "search-other")
+
+	if got := searchRoomNames(t, "movie night"); len(got) != 1 || got[0] != "Search Movie Night" {
+		t.Fatalf("search by name = %v, want [Search Movie Night]", got)
+	}
+	if got := searchRoomNames(t, "search-alice"); len(got) != 1 || got[0] != "Search Movie Night" {
+		t.Fatalf("search by creator = %v, want [Search Movie Night]", got)
+	}
+	if got := searchRoomNames(t, "_100%"); len(got) != 1 || got[0] != "search_100%" {
+		t.Fatalf("search with wildcards = %v, want [search_100%%]", got)
+	}
+	if got := searchRoomNames(t, "search-bob"); len(got) != 2 {
+		t.Fatalf("search by creator = %v, want 2 rooms", got)
+	}
+}
+
+func TestUpdateRoomSetting(t *testing.T) {
+	creator := newTestUser(t, "setting-creator")
+	room := newTestRoom(t, creator, "setting-room")
+	keys := gin.H{"user": creator, "room": room}
+
+	update := func(body string) map[string]any {
+		t.Helper()
+		resp := serve(t, UpdateRoomSetting, httptest.NewRequest(http.MethodPost, "/api/room/settings", strings.NewReader(body)), keys)
+		return resp["data"].(map[string]any)
+	}
+
+	data := update(`{"hidden":true,"maxClients":5}`)
+	if data["hidden"] != true || data["maxClients"] != float64(5) || data["chatEnabled"] != true {
+		t.Fatalf("unexpected setting %v", data)
+	}
+
+	data = update(`{"chatEnabled":false}`)
+	if data["hidden"] != true || data["chatEnabled"] != false {
+		t.Fatalf("partial update changed other fields: %v", data)
+	}
+
+	r, err := db.GetRoomByID(room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Hidden || r.MaxClients != 5 || !r.DisableChat {
+		t.Fatalf("setting not persisted: %+v", r.Setting)
+	}
+
+	data = update(`{"hidden":false,"password":"secret"}`)
+	if data["hidden"] != false || data["needPassword"] != true || data["token"] == nil {
+		t.Fatalf("unexpected setting %v", data)
+	}
+}
+
+func TestRoomListTag(t *testing.T) {
+	creator := newTestUser(t, "tag-creator")
+	tagged := newTestRoom(t, creator, "tag-online")
+	offline := newTestRoom(t, creator, "tag-offline")
+	untagged := newTestRoom(t, creator, "tag-untagged")
+	for _, r := range []*op.Room{tagged, offline} {
+		if err := r.SetTags([]string{"tagtest", "anime"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// clients make the room sorted in memory when listing by people number
+	for _, r := range []*op.Room{tagged, untagged} {
+		if _, err := r.RegClient(creator, nil); err != nil {
+			t.Fatal(err)
+		}
+		defer r.UnregisterClient(creator)
+	}
+
+	for _, sort := range []string{"peopleNum", "roomName"} {
+		resp := serve(t, RoomList, httptest.NewRequest(http.MethodGet, "/api/room/list?max=100&tag=TagTest&sort="+sort, nil), nil)
+		data := resp["data"].(map[string]any)
+		var names []string
+		for _, v := range data["list"].([]any) {
+			room := v.(map[string]any)
+			names = append(names, room["roomName"].(string))
+			if tags := room["tags"].([]any); len(tags) != 2 {
+				t.Fatalf("sort %s: room %s tags = %v, want 2 tags", sort, room["roomName"], tags)
+			}
+		}
+		if data["total"] != float64(2) || len(names) != 2 {
+			t.Fatalf("sort %s: got %v (total %v), want the two tagged rooms", sort, names, data["total"])
+		}
+	}
+}
+
+func TestRoomListPaging(t *testing.T) {
+	creator := newTestUser(t, "paging-creator")
+	rooms := []*op.Room{
+		newTestRoom(t, creator, "paging-a"),
+		newTestRoom(t, creator, "paging-b"),
+		newTestRoom(t, creator, "paging-c"),
+	}
+	for _, r := range rooms {
+		if err := r.SetTags([]string{"pagingtest"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// one room with clients, so the people number pages cross from the
+	// rooms in memory to the ones in the database
+	if _, err := rooms[1].RegClient(creator, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer rooms[1].UnregisterClient(creator)
+
+	list := func(query string) ([]string, float64) {
+		t.Helper()
+		data := serve(t, RoomList, httptest.NewRequest(http.MethodGet, "/api/room/list?tag=pagingtest&"+query, nil), nil)["data"].(map[string]any)
+		var names []string
+		for _, v := range data["list"].([]any) {
+			names = append(names, v.(map[string]any)["roomName"].(string))
+		}
+		return names, data["total"].(float64)
+	}
+
+	for _, sort := range []string{"peopleNum", "roomName"} {
+		for _, order := range []string{"asc", "desc"} {
+			query := "sort=" + sort + "&order=" + order
+			all, total := list(query + "&max=1000")
+			if total != 3 || len(all) != 3 {
+				t.Fatalf("%s: max above the limit: got %v (total %v), want the three rooms", query, all, total)
+			}
+			var paged []string
+			for page, want := range []int{2, 1, 0} {
+				names, total := list(fmt.Sprintf("%s&max=2&page=%d", query, page+1))
+				if len(names) != want || total != 3 {
+					t.Fatalf("%s: page %d = %v (total %v), want %d rooms of 3", query, page+1, names, total, want)
+				}
+				paged = append(paged, names...)
+			}
+			if strings.Join(paged, ",") != strings.Join(all, ",") {
+				t.Fatalf("%s: pages = %v, want %v", query, paged, all)
+			}
+			if names, total := list(query + "&max=2&page=1000"); len(names) != 0 || total != 3 {
+				t.Fatalf("%s: page past the end = %v (total %v), want none of 3", query, names, total)
+			}
+		}
+	}
+
+	for _, query := range []string{"max=0", "page=0", "max=-1", "page=x"} {
+		if code := status(RoomList, httptest.NewRequest(http.MethodGet, "/api/room/list?"+query, nil), nil); code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want 400", query, code)
+		}
+	}
+}
+
+func TestKickUser(t *testing.T) {
+	creator := newTestUser(t, "kick-creator")
+	moderator := newTestUser(t, "kick-moderator")
+	member := newTestUser(t, "kick-member")
+	room := newTestRoom(t, creator, "kick-room")
+	for _, u := range []*op.User{moderator, member} {
+		if err := room.AddMember(u.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cli, err := room.RegClient(member, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(member)
+	kick := func(user *op.User, id uint) int {
+		return status(KickUser, httptest.NewRequest(http.MethodPost, "/api/room/kick", strings.NewReader(fmt.Sprintf(`{"id":%d}`, id))), gin.H{"user": user, "room": room})
+	}
+
+	if code := kick(moderator, member.ID); code != http.StatusForbidden {
+		t.Fatalf("kick without CanKickUser: status = %d, want 403", code)
+	}
+	if err := creator.ChangeUserPermission(room, moderator.ID, dbModel.CanKickUser, 0); err != nil {
+		t.Fatal(err)
+	}
+	if code := kick(moderator, creator.ID); code != http.StatusForbidden {
+		t.Fatalf("kick the creator: status = %d, want 403", code)
+	}
+	if code := kick(moderator, newTestUser(t, "kick-absent").ID); code != http.StatusNotFound {
+		t.Fatalf("kick a user not connected: status = %d, want 404", code)
+	}
+	if code := kick(moderator, member.ID); code != http.StatusNoContent {
+		t.Fatalf("kick: status = %d, want 204", code)
+	}
+	if !cli.Closed() {
+		t.Fatal("the kicked client is still connected")
+	}
+
+	events, _, err := room.Events(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != dbModel.RoomEventUserKicked || events[0].UserID != moderator.ID {
+		t.Fatalf("events = %+v, want the kick", events)
+	}
+}
+
+func TestGuestLoginLockout(t *testing.T) {
+	creator := newTestUser(t, "guest-lockout-creator")
+	room := newTestRoom(t, creator, "guest-lockout-room")
+	room.Setting.AllowGuest = true
+	if err := room.SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	login := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/room/guest", strings.NewReader(fmt.Sprintf(`{"roomId":%q,"password":%q}`, room.ID, password)))
+		req.RemoteAddr = "198.51.100.8:4000"
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		GuestLogin(ctx)
+		return w
+	}
+
+	for i := int64(0); i < conf.Conf().User.LockoutThreshold; i++ {
+		if w := login("wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: status = %d, want 401", i+1, w.Code)
+		}
+	}
+	w := login("secret")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("locked guest login: status = %d, Retry-After = %q, want 429 with a delay", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	if err := op.ResetLoginFailures(context.Background(), op.RoomGuestLoginKeys("198.51.100.8", room.ID)...); err != nil {
+		t.Fatal(err)
+	}
+	if w := login("secret"); w.Code != http.StatusOK {
+		t.Fatalf("guest login after unlock: status = %d, want 200", w.Code)
+	}
+}
+
+func TestGuestLogin(t *testing.T) {
+	creator := newTestUser(t, "guest-creator")
+	room := newTestRoom(t, creator, "guest-room")
+	body := fmt.Sprintf(`{"roomId":%q}`, room.ID)
+
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/api/room/guest", strings.NewReader(body))
+	GuestLogin(ctx)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d without allowGuest, want %d", w.Code, http.StatusForbidden)
+	}
+
+	room.Setting.AllowGuest = true
+	resp := serve(t, GuestLogin, httptest.NewRequest(http.MethodPost, "/api/room/guest", strings.NewReader(body)), nil)
+	token := resp["data"].(map[string]any)["token"].(string)
+
+	guest, r, err := middlewares.AuthRoom(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !guest.IsGuest() || r.ID != room.ID {
+		t.Fatalf("AuthRoom() = %+v in room %s, want a guest in room %s", guest, r.ID, room.ID)
+	}
+	if guest.HasPermission(room, dbModel.CanCreateMovie) {
+		t.Fatal("guests should have no permission")
+	}
+	if _, err := middlewares.AuthUser(token); err == nil {
+		t.Fatal("a guest token must not authenticate a user")
+	}
+
+	rec := &recorder{}
+	if err := handleElementMsg(room, guest, &pb.ElementMessage{Type: pb.ElementMessageType_PLAY}, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.broadcasted) != 0 || len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+		t.Fatalf("guest playback control: sent %v, broadcast %v, want one error frame", rec.sent, rec.broadcasted)
+	}
+
+	room.Setting.AllowGuest = false
+	if _, _, err := middlewares.AuthRoom(token); err == nil {
+		t.Fatal("guest token should stop working once guests are disallowed")
+	}
+}
+
+func TestChatModeration(t *testing.T) {
+	creator := newTestUser(t, "moderation-creator")
+	member := newTestUser(t, "moderation-member")
+	moderator := newTestUser(t, "moderation-moderator")
+	room := newTestRoom(t, creator, "moderation-room")
+	if err := db.AddUserToRoom(member.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUserToRoom(moderator.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions|dbModel.CanDeleteChatMessage|dbModel.CanMuteUser); err != nil {
+		t.Fatal(err)
+	}
+
+	chat := func(u *op.User, message string) *recorder {
+		t.Helper()
+		rec := &recorder{}
+		if err := handleElementMsg(room, u, &pb.ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE, Message: message}, rec.send, rec.broadcast); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+	rec := chat(member, "spam")
+	if len(rec.broadcasted) != 1 || rec.broadcasted[0].MessageId == 0 {
+		t.Fatalf("broadcast %v, want the chat message with its id", rec.broadcasted)
+	}
+	id := rec.broadcasted[0].MessageId
+
+	del := func(u *op.User) int {
+		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/room/chat/%d", id), nil)
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(id)}}
+		ctx.Set("room", room)
+		ctx.Set("user", u)
+		DeleteChatMessage(ctx)
+		return ctx.Writer.Status()
+	}
+	other := newTestUser(t, "moderation-other")
+	if err := db.AddUserToRoom(other.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions); err != nil {
+		t.Fatal(err)
+	}
+	if code := del(other); code != http.StatusForbidden {
+		t.Fatalf("delete by another member = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := del(moderator); code != http.StatusNoContent {
+		t.Fatalf("delete by moderator = %d, want %d", code, http.StatusNoContent)
+	}
+	if ms, _ := room.ChatHistory(0, 10); len(ms) != 0 {
+		t.Fatalf("history = %d messages after delete, want 0", len(ms))
+	}
+
+	mute := func(u *op.User, target *op.User, seconds int) int {
+		body := fmt.Sprintf(`{"id":%d,"duration":%d}`, target.ID, seconds)
+		return status(MuteUser, httptest.NewRequest(http.MethodPost, "/api/room/mute", strings.NewReader(body)), gin.H{"room": room, "user": u})
+	}
+	if code := mute(member, other, 60); code != http.StatusForbidden {
+		t.Fatalf("mute by member = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := mute(moderator, creator, 60); code != http.StatusBadRequest {
+		t.Fatalf("mute of the creator = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := mute(moderator, member, 60); code != http.StatusNoContent {
+		t.Fatalf("mute = %d, want %d", code, http.StatusNoContent)
+	}
+	if rec := chat(member, "more spam"); len(rec.broadcasted) != 0 || len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+		t.Fatalf("muted chat: sent %v, broadcast %v, want an error", rec.sent, rec.broadcasted)
+	}
+	if code := mute(moderator, member, 0); code != http.StatusNoContent {
+		t.Fatalf("unmute = %d, want %d", code, http.StatusNoContent)
+	}
+	if rec := chat(member, "sorry"); len(rec.broadcasted) != 1 {
+		t.Fatalf("unmuted chat broadcast %v, want the message", rec.broadcasted)
+	}
+}
+
+func TestChangeUserPermission(t *testing.T) {
+	creator := newTestUser(t, "permission-creator")
+	moderator := newTestUser(t, "permission-moderator")
+	member := newTestUser(t, "permission-member")
+	room := newTestRoom(t, creator, "permission-room")
+	for _, u := range []*op.User{moderator, member} {
+		if err := room.AddMember(u.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	change := func(user *op.User, body string) int {
+		return status(ChangeUserPermission, httptest.NewRequest(http.MethodPost, "/api/room/permission", strings.NewReader(body)), gin.H{"user": user, "room": room})
+	}
+	memberBody := func(add, remove dbModel.Permission) string {
+		return fmt.Sprintf(`{"userId":%d,"add":%d,"remove":%d}`, member.ID, add, remove)
+	}
+
+	resp := serve(t, ChangeUserPermission, httptest.NewRequest(http.MethodPost, "/api/room/permission", strings.NewReader(
+		fmt.Sprintf(`{"userId":%d,"add":%d}`, moderator.ID, dbModel.CanSetUserPermission|dbModel.CanMuteUser),
+	)), gin.H{"user": creator, "room": room})
+	want := dbModel.DefaultPermissions | dbModel.CanSetUserPermission | dbModel.CanMuteUser
+	if p := resp["data"].(map[string]any)["permissions"]; p != float64(want) {
+		t.Fatalf("permissions = %v, want %d", p, want)
+	}
+
+	if code := change(member, memberBody(dbModel.CanMuteUser, 0)); code != http.StatusForbidden {
+		t.Fatalf("change without permission: status = %d, want 403", code)
+	}
+	if code := change(moderator, memberBody(dbModel.CanDeleteRoom, 0)); code != http.StatusForbidden {
+		t.Fatalf("grant a permission the moderator lacks: status = %d, want 403", code)
+	}
+	if code := change(moderator, memberBody(dbModel.CanMuteUser, dbModel.CanChangeRate)); code != http.StatusOK {
+		t.Fatalf("change: status = %d, want 200", code)
+	}
+	if code := change(moderator, fmt.Sprintf(`{"userId":%d,"remove":%d}`, creator.ID, dbModel.CanMuteUser)); code != http.StatusBadRequest {
+		t.Fatalf("change the creator: status = %d, want 400", code)
+	}
+	for _, body := range []string{memberBody(0, 0), memberBody(dbModel.CanMuteUser, dbModel.CanMuteUser), memberBody(1<<31, 0)} {
+		if code := change(creator, body); code != http.StatusBadRequest {
+			t.Fatalf("change %s: status = %d, want 400", body, code)
+		}
+	}
+
+	ur, err := op.GetRoomUserRelation(room.ID, member.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := dbModel.DefaultPermissions&^dbModel.CanChangeRate | dbModel.CanMuteUser; ur.Permissions != want {
+		t.Fatalf("member permissions = %d, want %d", ur.Permissions, want)
+	}
+
+	// a member with a permission the moderator lacks is above it
+	if code := change(creator, memberBody(dbModel.CanDeleteRoom, 0)); code != http.StatusOK {
+		t.Fatalf("grant as creator: status = %d, want 200", code)
+	}
+	if code := change(moderator, memberBody(0, dbModel.CanMuteUser)); code != http.StatusForbidden {
+		t.Fatalf("change a member above the moderator: status = %d, want 403", code)
+	}
+
+	list := serve(t, Permissions, httptest.NewRequest(http.MethodGet, "/api/room/permissions", nil), nil)["data"].([]any)
+	if len(list) != len(dbModel.PermissionNames) || list[0].(map[string]any)["name"] != "renameRoom" {
+		t.Fatalf("permissions = %v", list)
+	}
+}
+
+func TestAssignRole(t *testing.T) {
+	creator := newTestUser(t, "role-creator")
+	moderator := newTestUser(t, "role-moderator")
+	member := newTestUser(t, "role-member")
+	visitor := newTestUser(t, "role-visitor")
+	room := newTestRoom(t, creator, "role-room")
+	for _, u := range []*op.User{moderator, member} {
+		if err := room.AddMember(u.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assign := func(user, target *op.User, role string) int {
+		body := fmt.Sprintf(`{"userId":%d,"role":%q}`, target.ID, role)
+		return status(AssignRole, httptest.NewRequest(http.MethodPost, "/api/room/role", strings.NewReader(body)), gin.H{"user": user, "room": room})
+	}
+	permissions := func(u *op.User) dbModel.Permission {
+		ur, err := op.GetRoomUserRelation(room.ID, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ur.Permissions
+	}
+
+	if code := assign(creator, moderator, "moderator"); code != http.StatusOK {
+		t.Fatalf("assign moderator: status = %d, want 200", code)
+	}
+	if p := permissions(moderator); p != dbModel.RolePresetModerator.Permissions() {
+		t.Fatalf("moderator permissions = %d, want %d", p, dbModel.RolePresetModerator.Permissions())
+	}
+	if code := assign(moderator, member, "restricted"); code != http.StatusForbidden {
+		t.Fatalf("assign without CanSetUserPermission: status = %d, want 403", code)
+	}
+	if err := creator.ChangeUserPermission(room, moderator.ID, dbModel.CanSetUserPermission, 0); err != nil {
+		t.Fatal(err)
+	}
+	if code := assign(moderator, member, "admin"); code != http.StatusForbidden {
+		t.Fatalf("assign admin as a moderator: status = %d, want 403", code)
+	}
+	if code := assign(moderator, member, "owner"); code != http.StatusBadRequest {
+		t.Fatalf("assign unknown role: status = %d, want 400", code)
+	}
+	if code := assign(moderator, member, "restricted"); code != http.StatusOK {
+		t.Fatalf("assign restricted: status = %d, want 200", code)
+	}
+	if p := permissions(member); p != 0 {
+		t.Fatalf("restricted permissions = %d, want 0", p)
+	}
+
+	// users who are not members yet get the default role of the room
+	if p := permissions(visitor); p != dbModel.DefaultPermissions {
+		t.Fatalf("visitor permissions = %d, want %d", p, dbModel.DefaultPermissions)
+	}
+	data := serve(t, SetDefaultPermissions, httptest.NewRequest(http.MethodPost, "/api/room/permissions/default", strings.NewReader(`{"role":"restricted"}`)), gin.H{"user": creator, "room": room})["data"].(map[string]any)
+	if data["role"] != "restricted" {
+		t.Fatalf("role = %v, want restricted", data["role"])
+	}
+	if p := permissions(visitor); p != 0 {
+		t.Fatalf("visitor permissions after the default changed = %d, want 0", p)
+	}
+	if err := room.AddMember(visitor.ID); err != nil {
+		t.Fatal(err)
+	}
+	if p := permissions(visitor); p != 0 {
+		t.Fatalf("new member permissions = %d, want 0", p)
+	}
+}
+
+func TestSetDefaultPermissions(t *testing.T) {
+	creator := newTestUser(t, "default-creator")
+	moderator := newTestUser(t, "default-moderator")
+	visitor := newTestUser(t, "default-visitor")
+	room := newTestRoom(t, creator, "default-room")
+	if err := room.AddMember(moderator.ID); err != nil {
+		t.Fatal(err)
+	}
+	set := func(user *op.User, body string) int {
+		return status(SetDefaultPermissions, httptest.NewRequest(http.MethodPost, "/api/room/permissions/default", strings.NewReader(body)), gin.H{"user": user, "room": room})
+	}
+
+	voice := fmt.Sprintf(`{"permissions":%d}`, dbModel.DefaultPermissions|dbModel.CanUseVoice)
+	if code := set(moderator, voice); code != http.StatusForbidden {
+		t.Fatalf("set without CanSetDefaultPermission: status = %d, want 403", code)
+	}
+	if err := creator.ChangeUserPermission(room, moderator.ID, dbModel.CanSetDefaultPermission, 0); err != nil {
+		t.Fatal(err)
+	}
+	if code := set(moderator, voice); code != http.StatusForbidden {
+		t.Fatalf("grant a permission the moderator lacks: status = %d, want 403", code)
+	}
+	if code := set(moderator, `{"permissions":1073741824}`); code != http.StatusBadRequest {
+		t.Fatalf("unknown permission: status = %d, want 400", code)
+	}
+	if code := set(moderator, `{"permissions":1,"role":"member"}`); code != http.StatusBadRequest {
+		t.Fatalf("permissions and role: status = %d, want 400", code)
+	}
+	if code := set(creator, voice); code != http.StatusOK {
+		t.Fatalf("set as creator: status = %d, want 200", code)
+	}
+
+	data := serve(t, RoomSetting, httptest.NewRequest(http.MethodGet, "/api/room/settings", nil), gin.H{"user": creator, "room": room})["data"].(map[string]any)
+	if data["defaultPermissions"] != float64(dbModel.DefaultPermissions|dbModel.CanUseVoice) || data["defaultRole"] != "" {
+		t.Fatalf("settings = %v", data)
+	}
+	if err := room.AddMember(visitor.ID); err != nil {
+		t.Fatal(err)
+	}
+	ur, err := op.GetRoomUserRelation(room.ID, visitor.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ur.Permissions != dbModel.DefaultPermissions|dbModel.CanUseVoice {
+		t.Fatalf("new member permissions = %d, want %d", ur.Permissions, dbModel.DefaultPermissions|dbModel.CanUseVoice)
+	}
+
+	// the settings api still takes a role preset
+	data = serve(t, UpdateRoomSetting, httptest.NewRequest(http.MethodPost, "/api/room/settings", strings.NewReader(`{"defaultRole":"restricted"}`)), gin.H{"user": creator, "room": room})["data"].(map[string]any)
+	if data["defaultRole"] != "restricted" || data["defaultPermissions"] != float64(0) {
+		t.Fatalf("settings = %v", data)
+	}
+}
+
+func TestPermissionAudit(t *testing.T) {
+	creator := newTestUser(t, "audit-creator")
+	member := newTestUser(t, "audit-member")
+	room := newTestRoom(t, creator, "audit-room")
+	if err := room.AddMember(member.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := creator.AssignRole(room, member.ID, dbModel.RolePresetModerator); err != nil {
+		t.Fatal(err)
+	}
+	if err := creator.ChangeUserPermission(room, member.ID, 0, dbModel.CanMuteUser); err != nil {
+		t.Fatal(err)
+	}
+	req := func() *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/api/room/audit?page=1&max=10", nil)
+	}
+	data := serve(t, PermissionAudit, req(), gin.H{"user": creator, "room": room})["data"].(map[string]any)
+	list := data["list"].([]any)
+	if data["total"] != float64(2) || len(list) != 2 {
+		t.Fatalf("audit = %v", data)
+	}
+	newest, oldest := list[0].(map[string]any), list[1].(map[string]any)
+	moderator := dbModel.RolePresetModerator.Permissions()
+	if newest["role"] != "" || newest["before"] != float64(moderator) || newest["after"] != float64(moderator&^dbModel.CanMuteUser) {
+		t.Fatalf("newest audit = %v", newest)
+	}
+	if oldest["role"] != "moderator" || oldest["before"] != float64(dbModel.DefaultPermissions) || oldest["after"] != float64(moderator) ||
+		oldest["actorUsername"] != "audit-creator" || oldest["targetUsername"] != "audit-member" {
+		t.Fatalf("oldest audit = %v", oldest)
+	}
+
+	other := newTestUser(t, "audit-other")
+	if err := room.AddMember(other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := status(PermissionAudit, req(), gin.H{"user": other, "room": room}); code != http.StatusForbidden {
+		t.Fatalf("audit without CanViewRoomEvents: status = %d, want 403", code)
+	}
+}
+
+func TestBatchChangeUserPermission(t *testing.T) {
+	creator := newTestUser(t, "batch-creator")
+	a := newTestUser(t, "batch-a")
+	b := newTestUser(t, "batch-b")
+	outsider := newTestUser(t, "batch-outsider")
+	room := newTestRoom(t, creator, "batch-room")
+	for _, u := range []*op.User{a, b} {
+		if err := room.AddMember(u.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch := func(user *op.User, body string) int {
+		return status(BatchChangeUserPermission, httptest.NewRequest(http.MethodPost, "/api/room/permissions/batch", strings.NewReader(body)), gin.H{"user": user, "room": room})
+	}
+	permissions := func(u *op.User) dbModel.Permission {
+		ur, err := op.GetRoomUserRelation(room.ID, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ur.Permissions
+	}
+
+	body := fmt.Sprintf(`{"changes":[{"userId":%d,"add":%d},{"userId":%d,"add":%d},{"userId":%d,"add":%d}]}`,
+		a.ID, dbModel.CanUseVoice, b.ID, dbModel.CanUseVoice, outsider.ID, dbModel.CanUseVoice)
+	if code := batch(creator, body); code != http.StatusBadRequest {
+		t.Fatalf("batch with a user who is not a member: status = %d, want 400", code)
+	}
+	if permissions(a) != dbModel.DefaultPermissions {
+		t.Fatalf("a failed batch changed the permissions of a to %d", permissions(a))
+	}
+	body = fmt.Sprintf(`{"changes":[{"userId":%d,"add":%d},{"userId":%d,"add":1}]}`, a.ID, dbModel.CanUseVoice, a.ID)
+	if code := batch(creator, body); code != http.StatusBadRequest {
+		t.Fatalf("batch with a duplicate user: status = %d, want 400", code)
+	}
+	body = fmt.Sprintf(`{"changes":[{"userId":%d,"add":%d}]}`, b.ID, dbModel.CanUseVoice)
+	if code := batch(a, body); code != http.StatusForbidden {
+		t.Fatalf("batch without CanSetUserPermission: status = %d, want 403", code)
+	}
+
+	body = fmt.Sprintf(`{"changes":[{"userId":%d,"add":%d},{"userId":%d,"remove":%d}]}`, a.ID, dbModel.CanUseVoice, b.ID, dbModel.CanChangeRate)
+	list := serve(t, BatchChangeUserPermission, httptest.NewRequest(http.MethodPost, "/api/room/permissions/batch", strings.NewReader(body)), gin.H{"user": creator, "room": room})["data"].([]any)
+	if len(list) != 2 {
+		t.Fatalf("batch response = %v", list)
+	}
+	if p := permissions(a); p != dbModel.DefaultPermissions|dbModel.CanUseVoice {
+		t.Fatalf("a permissions = %d, want %d", p, dbModel.DefaultPermissions|dbModel.CanUseVoice)
+	}
+	if p := permissions(b); p != dbModel.DefaultPermissions&^dbModel.CanChangeRate {
+		t.Fatalf("b permissions = %d, want %d", p, dbModel.DefaultPermissions&^dbModel.CanChangeRate)
+	}
+	if _, total, err := room.PermissionAudits(0, 10); err != nil || total != 2 {
+		t.Fatalf("audits = %d, %v, want 2", total, err)
+	}
+}
+
+func TestRoomTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.SetProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer tracing.SetProvider(trace.NewNoopTracerProvider())
+	e := gin.New()
+	e.Use(middlewares.RequestID, middlewares.Tracing)
+	Init(e)
+	_, creatorToken := newTestUserWithRole(t, "tracing-creator", dbModel.RoleUser)
+	_, memberToken := newTestUserWithRole(t, "tracing-member", dbModel.RoleUser)
+	do := func(path, token, body string) map[string]any {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		resp := map[string]any{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	resp := do("/api/room/create", creatorToken, `{"roomName":"tracing-room","password":"secret"}`)
+	roomID := resp["data"].(map[string]any)["roomId"].(string)
+	do("/api/room/login", memberToken, `{"roomId":"`+roomID+`","password":"secret"}`)
+
+	spans := map[string]tracetest.SpanStub{}
+	var dbParents []trace.SpanID
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+		if strings.HasPrefix(s.Name, "db.") {
+			dbParents = append(dbParents, s.Parent.SpanID())
+		}
+	}
+	childOf := func(child, parent string) {
+		t.Helper()
+		c, ok := spans[child]
+		if !ok {
+			t.Fatalf("no span %s", child)
+		}
+		if p := spans[parent]; c.Parent.SpanID() != p.SpanContext.SpanID() {
+			t.Errorf("span %s is not a child of %s", child, parent)
+		}
+	}
+	childOf("op.CreateRoom", "POST /api/room/create")
+	childOf("op.GetRoomByID", "POST /api/room/login")
+	childOf("op.CheckPassword", "POST /api/room/login")
+	var createQueries int
+	for _, p := range dbParents {
+		if p == spans["op.CreateRoom"].SpanContext.SpanID() {
+			createQueries++
+		}
+	}
+	if createQueries == 0 {
+		t.Error("the queries of op.CreateRoom have no span")
+	}
+	if s := spans["POST /api/room/login"]; s.SpanKind != trace.SpanKindServer {
+		t.Errorf("request span kind = %v", s.SpanKind)
+	}
+}
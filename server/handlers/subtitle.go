@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/subtitle"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+func newSubtitleResp(roomID string, s *dbModel.Subtitle) model.SubtitleResp {
+	return model.SubtitleResp{
+		Id:        s.ID,
+		MovieId:   s.MovieID,
+		Name:      s.Name,
+		Format:    s.Format,
+		Url:       fmt.Sprintf("/api/movie/subtitle/%s/%s", roomID, s.Key),
+		Creator:   op.GetUserName(s.CreatorID),
+		CreatedAt: model.Timestamp(s.CreatedAt),
+	}
+}
+
+// PushSubtitle adds a subtitle track to a movie from the multipart form fields movieId and file
+func PushSubtitle(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	if !user.HasPermission(room, dbModel.CanCreateMovie) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to add subtitles"))
+		return
+	}
+
+	movieID, err := strconv.ParseUint(ctx.PostForm("movieId"), 10, 64)
+	if err != nil || movieID == 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(model.ErrId))
+		return
+	}
+	fh, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	maxSize := conf.Conf().Subtitle.MaxSize << 10
+	if fh.Size > maxSize {
+		ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, model.NewApiErrorStringResp("subtitle too large"))
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxSize))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	s, err := room.AddSubtitle(user.ID, uint(movieID), fh.Filename, data)
+	if err != nil {
+		if errors.Is(err, op.ErrSubtitleStorage) {
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPlaylistChanged, fmt.Sprintf("add subtitle %s to movie %d", s.Name, s.MovieID))
+
+	ctx.JSON(http.StatusCreated, model.NewApiDataResp(newSubtitleResp(room.ID, s)))
+}
+
+// Subtitles lists the subtitle tracks of the movie id
+func Subtitles(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+
+	movieID, err := strconv.ParseUint(ctx.Query("id"), 10, 64)
+	if err != nil || movieID == 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(model.ErrId))
+		return
+	}
+	ss, err := room.GetSubtitles(uint(movieID))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	resp := make([]model.SubtitleResp, len(ss))
+	for i, s := range ss {
+		resp[i] = newSubtitleResp(room.ID, s)
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"subtitles": resp,
+		"current":   room.Subtitle(),
+	}))
+}
+
+func DelSubtitle(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.Room)
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.IdReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	s, _, err := room.GetSubtitle(req.Id)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	if s.CreatorID != user.ID && !user.HasPermission(room, dbModel.CanDeleteUserMovies) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("you don't have permission to delete this subtitle"))
+		return
+	}
+	if err := room.DeleteSubtitle(req.Id); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+	room.RecordEvent(ctx.Request.Context(), user.ID, dbModel.RoomEventPlaylistChanged, fmt.Sprintf("delete subtitle %s of movie %d", s.Name, s.MovieID))
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ServeSubtitle serves a subtitle file, it is public like the movie proxy
+// so players can load it in a track element, the random key it is stored
+// under keeps the files of other rooms from being enumerated
+func ServeSubtitle(ctx *gin.Context) {
+	room, err := op.GetRoomByID(ctx.Param("roomId"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+	s, data, err := room.GetSubtitleByKey(ctx.Param("key"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+	ctx.Header("Cache-Control", "public, max-age=86400")
+	ctx.Data(http.StatusOK, subtitle.Format(s.Format).ContentType(), data)
+}
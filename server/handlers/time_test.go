@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+)
+
+// assertMilli fails unless v is the json number for want in unix milliseconds
+func assertMilli(t *testing.T, name string, v any, want time.Time) {
+	t.Helper()
+	got, ok := v.(float64)
+	if !ok {
+		t.Fatalf("%s = %#v, want unix milli number", name, v)
+	}
+	if int64(got) != want.UnixMilli() {
+		t.Fatalf("%s = %d, want %d", name, int64(got), want.UnixMilli())
+	}
+}
+
+// assertNowMicro fails unless v is the current time in unix microseconds,
+// the unit of the time of every response
+func assertNowMicro(t *testing.T, v any) {
+	t.Helper()
+	got, ok := v.(float64)
+	if !ok {
+		t.Fatalf("time = %#v, want unix micro number", v)
+	}
+	if d := time.Since(time.UnixMicro(int64(got))); d < 0 || d > time.Minute {
+		t.Fatalf("time = %d is not the current unix micro", int64(got))
+	}
+}
+
+func TestTimestampFormat(t *testing.T) {
+	user := newTestUser(t, "timestamp-user")
+	room := newTestRoom(t, user, "timestamp-room")
+	if err := room.AddMovie(user.NewMovie(dbModel.MovieInfo{
+		BaseMovieInfo: dbModel.BaseMovieInfo{
+			Url:  "https://example.com/movie.mp4",
+			Name: "movie",
+		},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := room.ChangeCurrentMovie(ms[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	keys := gin.H{"user": user, "room": room}
+
+	t.Run("RoomList", func(t *testing.T) {
+		resp := serve(t, RoomList, httptest.NewRequest(http.MethodGet, "/api/room/list?max=100", nil), nil)
+		assertNowMicro(t, resp["time"])
+		for _, v := range resp["data"].(map[string]any)["list"].([]any) {
+			item := v.(map[string]any)
+			if item["roomId"] == room.ID {
+				assertMilli(t, "createdAt", item["createdAt"], room.CreatedAt)
+				return
+			}
+		}
+		t.Fatal("room not listed")
+	})
+
+	t.Run("CheckRoom", func(t *testing.T) {
+		resp := serve(t, CheckRoom, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/room/check?roomId=%s", room.ID), nil), nil)
+		assertNowMicro(t, resp["time"])
+		assertMilli(t, "createdAt", resp["data"].(map[string]any)["createdAt"], room.CreatedAt)
+	})
+
+	t.Run("MovieList", func(t *testing.T) {
+		resp := serve(t, MovieList, httptest.NewRequest(http.MethodGet, "/api/movie/list", nil), keys)
+		data := resp["data"].(map[string]any)
+		movie := data["movies"].([]any)[0].(map[string]any)
+		assertMilli(t, "movies[0].createdAt", movie["createdAt"], ms[0].CreatedAt)
+		current := data["current"].(map[string]any)["movie"].(map[string]any)
+		if current["ID"] != float64(ms[0].ID) || current["url"] != ms[0].Url {
+			t.Fatalf("current.movie = %v, want the stored movie", current)
+		}
+	})
+
+	t.Run("CurrentMovie", func(t *testing.T) {
+		resp := serve(t, CurrentMovie, httptest.NewRequest(http.MethodGet, "/api/movie/current", nil), keys)
+		assertNowMicro(t, resp["time"])
+		current := resp["data"].(map[string]any)["current"].(map[string]any)["movie"].(map[string]any)
+		if current["ID"] != float64(ms[0].ID) || current["url"] != ms[0].Url {
+			t.Fatalf("current.movie = %v, want the stored movie", current)
+		}
+	})
+}
@@ -1,21 +1,553 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/email"
+	"github.com/synctv-org/synctv/internal/metrics"
+	dbModel "github.com/synctv-org/synctv/internal/model"
 	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/requestid"
+	"github.com/synctv-org/synctv/server/middlewares"
 	"github.com/synctv-org/synctv/server/model"
 )
 
 func Me(ctx *gin.Context) {
 	user := ctx.MustGet("user").(*op.User)
 
+	var deletionScheduledAt int64
+	if user.DeletionScheduledAt != nil {
+		deletionScheduledAt = model.Timestamp(*user.DeletionScheduledAt)
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"username":            user.Username,
+		"displayName":         user.DisplayName,
+		"avatar":              user.Avatar,
+		"needAcceptTerms":     user.NeedAcceptTerms(),
+		"deletionScheduledAt": deletionScheduledAt,
+		"pending":             user.CheckApproved() != nil,
+	}))
+}
+
+// SignupUser creates a user with a password and logs it in
+func SignupUser(ctx *gin.Context) {
+	req := model.SignupUserReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	user, err := op.SignupUser(req.Username, req.Email, req.Password)
+	switch {
+	case errors.Is(err, op.ErrSignupDisabled):
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, db.ErrUsernameTaken), errors.Is(err, db.ErrEmailTaken):
+		ctx.AbortWithStatusJSON(http.StatusConflict, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, op.ErrInvalidUsername), errors.Is(err, op.ErrEmailRequired):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	case err != nil:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	if user.Email != nil && email.Enabled() {
+		if err := user.SendVerifyEmail(); err != nil {
+			requestid.Log(ctx.Request.Context()).Errorf("send verify email to user %d failed: %v", user.ID, err)
+		}
+	}
+	// the user logs in once the email is verified
+	if conf.Conf().Email.RequireVerification {
+		ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+			"verify": true,
+		}))
+		return
+	}
+
+	resp, err := middlewares.NewAuthUserTokens(ctx, user)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(resp))
+}
+
+// LoginUser issues the same token as an oauth2 login to a user with a password
+func LoginUser(ctx *gin.Context) {
+	req := model.LoginUserReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	keys := op.LoginKeys(ctx.Request.Context(), ctx.ClientIP(), req.Username)
+	if wait, err := op.CheckLoginLock(ctx.Request.Context(), keys...); err != nil {
+		abortLoginLocked(ctx, wait, err)
+		return
+	}
+
+	user, err := op.LoginUserContext(ctx.Request.Context(), req.Username, req.Password)
+	if errors.Is(err, op.ErrInvalidLogin) {
+		metrics.AuthFailures.WithLabelValues("login").Inc()
+		op.RecordLoginFailure(ctx.Request.Context(), keys...)
+	}
+	if errors.Is(err, op.ErrEmailNotVerified) || errors.Is(err, op.ErrUserBanned) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	} else if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, model.NewApiErrorResp(err))
+		return
+	}
+	if err := op.ResetLoginFailures(ctx.Request.Context(), keys[1:]...); err != nil {
+		requestid.Log(ctx.Request.Context()).Errorf("reset login failures of user %d failed: %s", user.ID, err.Error())
+	}
+
+	resp, err := middlewares.NewLoginResp(ctx, user)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(resp))
+}
+
+// abortLoginLocked aborts a login refused by op.CheckLoginLock, telling the
+// client how many seconds to wait
+func abortLoginLocked(ctx *gin.Context, wait time.Duration, err error) {
+	if !errors.Is(err, op.ErrLoginLocked) {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	ctx.AbortWithStatusJSON(http.StatusTooManyRequests, model.NewApiErrorResp(err))
+}
+
+// VerifyEmail verifies the email of the token sent by SignupUser or SendVerifyEmail
+func VerifyEmail(ctx *gin.Context) {
+	req := model.VerifyEmailReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := op.VerifyEmail(req.Token); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// SendVerifyEmail sends the verification email of the user again
+func SendVerifyEmail(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	err := user.SendVerifyEmail()
+	switch {
+	case errors.Is(err, email.ErrDisabled):
+		ctx.AbortWithStatusJSON(http.StatusNotImplemented, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, op.ErrNoEmail), errors.Is(err, op.ErrEmailVerified):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, op.ErrTooManyEmails):
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, email.ErrQueueFull):
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, model.NewApiErrorResp(err))
+		return
+	case err != nil:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RequestPasswordReset emails a reset link, it answers the same whether the email is registered or not
+func RequestPasswordReset(ctx *gin.Context) {
+	req := model.RequestPasswordResetReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	err := op.RequestPasswordReset(req.Email)
+	if errors.Is(err, email.ErrDisabled) {
+		ctx.AbortWithStatusJSON(http.StatusNotImplemented, model.NewApiErrorResp(err))
+		return
+	} else if errors.Is(err, op.ErrTooManyEmails) {
+		// answered like a sent email, a 429 would tell the email is registered
+		requestid.Log(ctx.Request.Context()).Warnf("reset email not sent: %v", err)
+	} else if err != nil {
+		requestid.Log(ctx.Request.Context()).Errorf("send reset email failed: %v", err)
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ResetPassword sets a new password with the token of a reset email
+func ResetPassword(ctx *gin.Context) {
+	req := model.ResetPasswordReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	err := op.ResetPassword(req.Token, req.Password)
+	if errors.Is(err, op.ErrInvalidEmailToken) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	} else if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func TwoFactorStatus(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	left, err := user.RecoveryCodesLeft()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"enabled":           user.TOTPEnabled,
+		"recoveryCodesLeft": left,
+	}))
+}
+
+// EnableTwoFactor returns the otpauth uri of a new secret, ConfirmTwoFactor turns it on
+func EnableTwoFactor(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	uri, err := user.EnrollTwoFactor()
+	if errors.Is(err, op.ErrTwoFactorEnabled) {
+		ctx.AbortWithStatusJSON(http.StatusConflict, model.NewApiErrorResp(err))
+		return
+	} else if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"uri":    uri,
+		"secret": user.TOTPSecret,
+	}))
+}
+
+func ConfirmTwoFactor(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.TwoFactorCodeReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	codes, err := user.ConfirmTwoFactor(req.Code)
+	if err != nil {
+		abortTwoFactor(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"recoveryCodes": codes,
+	}))
+}
+
+func DisableTwoFactor(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.TwoFactorCodeReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.DisableTwoFactor(req.Code); err != nil {
+		abortTwoFactor(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes, the old ones stop working
+func RegenerateRecoveryCodes(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.TwoFactorCodeReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	codes, err := user.RegenerateRecoveryCodes(req.Code)
+	if err != nil {
+		abortTwoFactor(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"recoveryCodes": codes,
+	}))
+}
+
+// VerifyTwoFactor is the second step of a login of a user with two factor authentication
+func VerifyTwoFactor(ctx *gin.Context) {
+	req := model.TwoFactorLoginReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	user, err := op.VerifyTwoFactorLogin(req.Token, req.Code)
+	if err != nil {
+		abortTwoFactor(ctx, err)
+		return
+	}
+
+	resp, err := middlewares.NewAuthUserTokens(ctx, user)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(resp))
+}
+
+func abortTwoFactor(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, op.ErrInvalidTwoFactorCode), errors.Is(err, op.ErrInvalidTwoFactorToken):
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, model.NewApiErrorResp(err))
+	case errors.Is(err, op.ErrTooManyTwoFactorAttempts):
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, model.NewApiErrorResp(err))
+	case errors.Is(err, op.ErrUserBanned):
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+	case errors.Is(err, op.ErrTwoFactorEnabled), errors.Is(err, op.ErrTwoFactorDisabled), errors.Is(err, op.ErrTwoFactorNotEnrolled):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+	}
+}
+
+// RefreshToken trades a refresh token for a new user token and a new refresh token
+func RefreshToken(ctx *gin.Context) {
+	req := model.RefreshTokenReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	user, session, refreshToken, err := op.UseRefreshToken(req.RefreshToken, ctx.Request.UserAgent(), ctx.ClientIP())
+	if errors.Is(err, op.ErrInvalidRefreshToken) {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, model.NewApiErrorResp(err))
+		return
+	} else if errors.Is(err, op.ErrUserBanned) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	} else if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	token, err := middlewares.NewAuthSessionToken(user, session.ID)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"token":        token,
+		"refreshToken": refreshToken,
+	}))
+}
+
+// RevokeToken logs out the current session, the user token of the request
+// and the refresh token of the body stop working
+func RevokeToken(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+	claims := ctx.MustGet("claims").(*middlewares.AuthClaims)
+
+	req := model.RefreshTokenReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.RevokeRefreshToken(req.RefreshToken); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+	if claims.ExpiresAt != nil {
+		if err := op.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+			return
+		}
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// LogoutAll invalidates every token of the user, on every device
+func LogoutAll(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	if err := user.LogoutAll(); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func genAPIKeyResp(k *dbModel.APIKey) *model.APIKeyResp {
+	resp := &model.APIKeyResp{
+		Id:        k.ID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Scopes:    k.Scopes,
+		CreatedAt: model.Timestamp(k.CreatedAt),
+	}
+	if k.ExpiresAt != nil {
+		resp.ExpiresAt = model.Timestamp(*k.ExpiresAt)
+	}
+	if k.LastUsedAt != nil {
+		resp.LastUsedAt = model.Timestamp(*k.LastUsedAt)
+	}
+	return resp
+}
+
+func APIKeys(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	keys, err := user.APIKeys()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	resp := make([]*model.APIKeyResp, len(keys))
+	for i := range keys {
+		resp[i] = genAPIKeyResp(&keys[i])
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"apiKeys": resp,
+		"scopes":  dbModel.APIKeyScopes,
+	}))
+}
+
+// CreateAPIKey returns a new api key, it is only shown this once
+func CreateAPIKey(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.CreateAPIKeyReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	k, key, err := user.CreateAPIKey(req.Name, req.Scopes, req.ExpireDuration())
+	if errors.Is(err, op.ErrTooManyAPIKeys) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	} else if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"apiKey": genAPIKeyResp(k),
+		"key":    key,
+	}))
+}
+
+func DeleteAPIKey(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("invalid api key id"))
+		return
+	}
+
+	if err := user.DeleteAPIKey(uint(id)); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func genSessionResp(s *dbModel.UserSession) *model.SessionResp {
+	return &model.SessionResp{
+		Id:         s.ID,
+		UserAgent:  s.UserAgent,
+		Ip:         s.IP,
+		LastUsedAt: model.Timestamp(s.LastUsedAt),
+		ExpiresAt:  model.Timestamp(s.ExpiresAt),
+		CreatedAt:  model.Timestamp(s.CreatedAt),
+	}
+}
+
+// Sessions lists the devices the user is logged in on, current is the session of the request
+func Sessions(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+	claims := ctx.MustGet("claims").(*middlewares.AuthClaims)
+
+	sessions, err := user.Sessions()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	resp := make([]*model.SessionResp, len(sessions))
+	for i := range sessions {
+		resp[i] = genSessionResp(&sessions[i])
+	}
+
 	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
-		"username": user.Username,
+		"sessions": resp,
+		"current":  claims.SessionID,
 	}))
 }
 
+// DeleteSession logs out one of the devices of the user
+func DeleteSession(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("invalid session id"))
+		return
+	}
+
+	if err := user.DeleteSession(uint(id)); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
 func LogoutUser(ctx *gin.Context) {
 	user := ctx.MustGet("user").(*op.User)
 
@@ -27,3 +559,196 @@ func LogoutUser(ctx *gin.Context) {
 
 	ctx.Status(http.StatusNoContent)
 }
+
+func AcceptTerms(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.AcceptTermsReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.AcceptTerms(req.Version); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func FavoriteRooms(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	rooms, err := user.FavoriteRooms()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"total": len(rooms),
+		"list":  genRoomListResp(rooms),
+	}))
+}
+
+func AddFavoriteRoom(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.RoomIdReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.AddFavoriteRoom(req.RoomId); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func RemoveFavoriteRoom(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	id := ctx.Query("roomId")
+	if id == "" {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(model.ErrEmptyRoomId))
+		return
+	}
+
+	if err := user.RemoveFavoriteRoom(id); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func genDirectMessageResp(m *dbModel.DirectMessage) *model.DirectMessageResp {
+	return &model.DirectMessageResp{
+		Id:          m.ID,
+		SenderId:    m.SenderID,
+		RecipientId: m.RecipientID,
+		Content:     m.Content,
+		Seen:        m.Seen,
+		CreatedAt:   model.Timestamp(m.CreatedAt),
+	}
+}
+
+// SendDirectMessage sends a private message, recipients without a connected client read it later
+func SendDirectMessage(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.DirectMessageReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	recipient, err := op.GetUserById(req.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+
+	msg, err := user.SendDirectMessage(recipient, req.Content)
+	switch {
+	case errors.Is(err, op.ErrTooManyMessages):
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, op.ErrNoSharedRoom):
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, op.ErrMessageSelf):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	case err != nil:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(genDirectMessageResp(msg)))
+}
+
+// DirectMessages returns a page of the conversation with the user userId
+func DirectMessages(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	peer, err := strconv.ParseUint(ctx.Query("userId"), 10, 64)
+	if err != nil || peer == 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(model.ErrEmptyUserId))
+		return
+	}
+	before, err := strconv.ParseUint(ctx.DefaultQuery("before", "0"), 10, 64)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("before must be a message id"))
+		return
+	}
+	max, err := strconv.Atoi(ctx.DefaultQuery("max", "50"))
+	if err != nil || max < 1 || max > 100 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("max must be between 1 and 100"))
+		return
+	}
+
+	messages, err := user.DirectMessages(uint(peer), uint(before), max)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	resp := make([]*model.DirectMessageResp, len(messages))
+	for i, m := range messages {
+		resp[i] = genDirectMessageResp(m)
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"list": resp,
+	}))
+}
+
+// ReadDirectMessages marks the messages from the user userId read
+func ReadDirectMessages(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	req := model.UserIdReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.ReadDirectMessages(req.UserId); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// UnreadDirectMessages returns the senders of unread messages and how many each sent
+func UnreadDirectMessages(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	counts, err := user.UnreadDirectMessages()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	list := make([]gin.H, 0, len(counts))
+	for id, n := range counts {
+		list = append(list, gin.H{
+			"userId":   id,
+			"username": op.GetUserName(id),
+			"unread":   n,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i]["userId"].(uint) < list[j]["userId"].(uint)
+	})
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"list": list,
+	}))
+}
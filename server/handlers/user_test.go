@@ -0,0 +1,672 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/email"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/settings"
+	"github.com/synctv-org/synctv/internal/totp"
+	"github.com/synctv-org/synctv/server/middlewares"
+)
+
+func TestRoomListFavoritesFirst(t *testing.T) {
+	creator := newTestUser(t, "fav-creator")
+	viewer := newTestUser(t, "fav-viewer")
+	newTestRoom(t, creator, "fav-first")
+	newTestRoom(t, creator, "fav-second")
+	pinned := newTestRoom(t, creator, "fav-pinned")
+	if err := viewer.AddFavoriteRoom(pinned.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := viewer.AddFavoriteRoom(pinned.ID); err != nil {
+		t.Fatalf("adding a favorite twice should be a no-op: %v", err)
+	}
+
+	token, err := middlewares.NewAuthUserToken(viewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := func(page string, token string) ([]string, float64) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/room/list?sort=roomId&order=asc&max=1&page="+page, nil)
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		data := serve(t, RoomList, req, nil)["data"].(map[string]any)
+		var names []string
+		for _, v := range data["list"].([]any) {
+			names = append(names, v.(map[string]any)["roomName"].(string))
+		}
+		return names, data["total"].(float64)
+	}
+
+	anonymous, total := list("1", "")
+	signedIn, signedInTotal := list("1", token)
+	if signedInTotal != total {
+		t.Fatalf("total = %v, want %v, a pinned room must not be counted twice", signedInTotal, total)
+	}
+	if len(signedIn) != 1 || signedIn[0] != "fav-pinned" {
+		t.Fatalf("first page = %v, want the pinned room", signedIn)
+	}
+	// the pinned room moves to the top, the others keep their order
+	want := anonymous
+	if want[0] == "fav-pinned" {
+		want, _ = list("2", "")
+	}
+	if second, _ := list("2", token); len(second) != 1 || second[0] != want[0] {
+		t.Fatalf("second page = %v, want %v", second, want)
+	}
+
+	if err := viewer.RemoveFavoriteRoom(pinned.ID); err != nil {
+		t.Fatal(err)
+	}
+	if rooms, err := viewer.FavoriteRooms(); err != nil {
+		t.Fatal(err)
+	} else if len(rooms) != 0 {
+		t.Fatalf("favorites = %d rooms after removal, want 0", len(rooms))
+	}
+}
+
+func TestSignupAndLogin(t *testing.T) {
+	post := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	}
+
+	token := serve(t, SignupUser, post(`{"username":"signup-user","password":"s3cretpass","email":"Signup@Example.com"}`), nil)["data"].(map[string]any)["token"].(string)
+	u, err := middlewares.AuthUser(token)
+	if err != nil || u.Username != "signup-user" {
+		t.Fatalf("signup token = %v, %v, want signup-user", u, err)
+	}
+
+	if code := status(SignupUser, post(`{"username":"signup-user","password":"s3cretpass"}`), nil); code != http.StatusConflict {
+		t.Fatalf("duplicate username: status = %d, want 409", code)
+	}
+	if code := status(SignupUser, post(`{"username":"signup-other","password":"s3cretpass","email":"signup@example.com"}`), nil); code != http.StatusConflict {
+		t.Fatalf("duplicate email: status = %d, want 409", code)
+	}
+	if code := status(SignupUser, post(`{"username":"signup-short","password":"short"}`), nil); code != http.StatusBadRequest {
+		t.Fatalf("short password: status = %d, want 400", code)
+	}
+
+	for _, login := range []string{"signup-user", "signup@example.com"} {
+		token := serve(t, LoginUser, post(`{"username":"`+login+`","password":"s3cretpass"}`), nil)["data"].(map[string]any)["token"].(string)
+		if u, err := middlewares.AuthUser(token); err != nil || u.Username != "signup-user" {
+			t.Fatalf("login as %s = %v, %v, want signup-user", login, u, err)
+		}
+	}
+	if code := status(LoginUser, post(`{"username":"signup-user","password":"wrongpass"}`), nil); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status = %d, want 401", code)
+	}
+	// users created by an oauth2 login have no password
+	newTestUser(t, "signup-oauth")
+	if code := status(LoginUser, post(`{"username":"signup-oauth","password":""}`), nil); code != http.StatusBadRequest {
+		t.Fatalf("empty password: status = %d, want 400", code)
+	}
+	if code := status(LoginUser, post(`{"username":"signup-oauth","password":"anything"}`), nil); code != http.StatusUnauthorized {
+		t.Fatalf("oauth2 user: status = %d, want 401", code)
+	}
+}
+
+type captureSender chan *email.Message
+
+func (c captureSender) Send(msg *email.Message) error {
+	c <- msg
+	return nil
+}
+
+func TestEmailVerifyAndReset(t *testing.T) {
+	sent := make(captureSender, 4)
+	q := email.NewQueue(sent, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+	email.Init(q)
+	defer email.Init(nil)
+	conf.Conf().Email.BaseURL = "https://synctv.example"
+	conf.Conf().Email.RequireVerification = true
+	defer func() {
+		conf.Conf().Email = conf.DefaultEmailConfig()
+	}()
+
+	post := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	}
+	tokenReg := regexp.MustCompile(`\?token=(\S+)`)
+	receive := func(to string) string {
+		t.Helper()
+		select {
+		case msg := <-sent:
+			if msg.To != to {
+				t.Fatalf("email sent to %s, want %s", msg.To, to)
+			}
+			m := tokenReg.FindStringSubmatch(msg.Body)
+			if m == nil {
+				t.Fatalf("no link in %q", msg.Body)
+			}
+			token, err := url.QueryUnescape(m[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return token
+		case <-time.After(5 * time.Second):
+			t.Fatal("no email sent")
+			return ""
+		}
+	}
+
+	if code := status(SignupUser, post(`{"username":"verify-noemail","password":"s3cretpass"}`), nil); code != http.StatusBadRequest {
+		t.Fatalf("signup without email: status = %d, want 400", code)
+	}
+	data := serve(t, SignupUser, post(`{"username":"verify-user","password":"s3cretpass","email":"verify@example.com"}`), nil)["data"].(map[string]any)
+	if _, ok := data["token"]; ok {
+		t.Fatal("signup logged in before the email was verified")
+	}
+	verifyToken := receive("verify@example.com")
+	login := post(`{"username":"verify-user","password":"s3cretpass"}`)
+	if code := status(LoginUser, login, nil); code != http.StatusForbidden {
+		t.Fatalf("unverified login: status = %d, want 403", code)
+	}
+	if code := status(VerifyEmail, post(`{"token":"`+verifyToken+`x"}`), nil); code != http.StatusBadRequest {
+		t.Fatalf("tampered token: status = %d, want 400", code)
+	}
+	if code := status(VerifyEmail, post(`{"token":"`+verifyToken+`"}`), nil); code != http.StatusNoContent {
+		t.Fatalf("verify: status = %d, want 204", code)
+	}
+	loggedIn := serve(t, LoginUser, post(`{"username":"verify-user","password":"s3cretpass"}`), nil)["data"].(map[string]any)["token"].(string)
+	// an email token never logs in
+	if _, err := middlewares.AuthUser(verifyToken); err == nil {
+		t.Fatal("the verify token was accepted as a login token")
+	}
+
+	if code := status(RequestPasswordReset, post(`{"email":"nobody@example.com"}`), nil); code != http.StatusNoContent {
+		t.Fatalf("reset of an unknown email: status = %d, want 204", code)
+	}
+	if code := status(RequestPasswordReset, post(`{"email":"Verify@Example.com"}`), nil); code != http.StatusNoContent {
+		t.Fatalf("reset request: status = %d, want 204", code)
+	}
+	resetToken := receive("verify@example.com")
+	if code := status(ResetPassword, post(`{"token":"`+verifyToken+`","password":"n3wpassword"}`), nil); code != http.StatusBadRequest {
+		t.Fatalf("reset with a verify token: status = %d, want 400", code)
+	}
+	if code := status(ResetPassword, post(`{"token":"`+resetToken+`","password":"n3wpassword"}`), nil); code != http.StatusNoContent {
+		t.Fatalf("reset: status = %d, want 204", code)
+	}
+	if code := status(ResetPassword, post(`{"token":"`+resetToken+`","password":"an0therpass"}`), nil); code != http.StatusBadRequest {
+		t.Fatalf("reset token used twice: status = %d, want 400", code)
+	}
+	if code := status(LoginUser, post(`{"username":"verify-user","password":"s3cretpass"}`), nil); code != http.StatusUnauthorized {
+		t.Fatalf("old password: status = %d, want 401", code)
+	}
+	if _, err := middlewares.AuthUser(loggedIn); err == nil {
+		t.Fatal("a token of the old password still works after the reset")
+	}
+	serve(t, LoginUser, post(`{"username":"verify@example.com","password":"n3wpassword"}`), nil)
+
+	// the signup and the reset email count against the limit of the address
+	if code := status(RequestPasswordReset, post(`{"email":"verify@example.com"}`), nil); code != http.StatusNoContent {
+		t.Fatalf("reset request: status = %d, want 204", code)
+	}
+	receive("verify@example.com")
+	if err := op.RequestPasswordReset("verify@example.com"); !errors.Is(err, op.ErrTooManyEmails) {
+		t.Fatalf("fourth email = %v, want %v", err, op.ErrTooManyEmails)
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	post := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	}
+	serve(t, SignupUser, post(`{"username":"totp-user","password":"s3cretpass"}`), nil)
+	u, err := op.GetUserByUsername("totp-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like the auth middleware, every request loads the cached user
+	keys := func() gin.H {
+		u, err := op.GetUserById(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gin.H{"user": u}
+	}
+
+	uri := serve(t, EnableTwoFactor, post(``), keys())["data"].(map[string]any)["uri"].(string)
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := parsed.Query().Get("secret")
+	if code := status(ConfirmTwoFactor, post(`{"code":"000000x"}`), keys()); code != http.StatusUnauthorized {
+		t.Fatalf("confirm with a wrong code: status = %d, want 401", code)
+	}
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recovery []string
+	for _, c := range serve(t, ConfirmTwoFactor, post(`{"code":"`+code+`"}`), keys())["data"].(map[string]any)["recoveryCodes"].([]any) {
+		recovery = append(recovery, c.(string))
+	}
+	if len(recovery) != op.RecoveryCodeCount {
+		t.Fatalf("recovery codes = %v", recovery)
+	}
+
+	data := serve(t, LoginUser, post(`{"username":"totp-user","password":"s3cretpass"}`), nil)["data"].(map[string]any)
+	if _, ok := data["token"]; ok || data["twoFactor"] != true {
+		t.Fatalf("login with two factor = %v, want the second step", data)
+	}
+	pending := data["twoFactorToken"].(string)
+	if _, err := middlewares.AuthUser(pending); err == nil {
+		t.Fatal("the two factor token was accepted as a login token")
+	}
+	if code := status(VerifyTwoFactor, post(`{"token":"`+pending+`","code":"`+code+`"}`), nil); code != http.StatusUnauthorized {
+		t.Fatalf("replayed code: status = %d, want 401", code)
+	}
+	token := serve(t, VerifyTwoFactor, post(`{"token":"`+pending+`","code":"`+strings.ToUpper(recovery[0])+`"}`), nil)["data"].(map[string]any)["token"].(string)
+	if u2, err := middlewares.AuthUser(token); err != nil || u2.ID != u.ID {
+		t.Fatalf("two factor login = %v, %v", u2, err)
+	}
+	if code := status(VerifyTwoFactor, post(`{"token":"`+pending+`","code":"`+recovery[0]+`"}`), nil); code != http.StatusUnauthorized {
+		t.Fatalf("used recovery code: status = %d, want 401", code)
+	}
+	if left := serve(t, TwoFactorStatus, httptest.NewRequest(http.MethodGet, "/", nil), keys())["data"].(map[string]any)["recoveryCodesLeft"]; left != float64(op.RecoveryCodeCount-1) {
+		t.Fatalf("recovery codes left = %v", left)
+	}
+
+	if code := status(DisableTwoFactor, post(`{"code":"`+recovery[1]+`"}`), keys()); code != http.StatusNoContent {
+		t.Fatalf("disable: status = %d, want 204", code)
+	}
+	if _, ok := serve(t, LoginUser, post(`{"username":"totp-user","password":"s3cretpass"}`), nil)["data"].(map[string]any)["token"]; !ok {
+		t.Fatal("login after disabling two factor authentication asked for a code")
+	}
+}
+
+func TestRefreshAndRevokeTokens(t *testing.T) {
+	e := gin.New()
+	e.GET("/me", middlewares.AuthUserMiddleware, Me)
+	e.POST("/revoke", middlewares.AuthUserMiddleware, RevokeToken)
+	e.POST("/logout-all", middlewares.AuthUserMiddleware, LogoutAll)
+	do := func(method, path, token, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+	post := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	}
+	login := func() (string, string) {
+		data := serve(t, LoginUser, post(`{"username":"refresh-user","password":"s3cretpass"}`), nil)["data"].(map[string]any)
+		return data["token"].(string), data["refreshToken"].(string)
+	}
+
+	serve(t, SignupUser, post(`{"username":"refresh-user","password":"s3cretpass"}`), nil)
+	token, refresh := login()
+
+	data := serve(t, RefreshToken, post(`{"refreshToken":"`+refresh+`"}`), nil)["data"].(map[string]any)
+	renewed, next := data["token"].(string), data["refreshToken"].(string)
+	if do(http.MethodGet, "/me", renewed, "") != http.StatusOK {
+		t.Fatal("the renewed token was rejected")
+	}
+	if code := status(RefreshToken, post(`{"refreshToken":"`+refresh+`"}`), nil); code != http.StatusUnauthorized {
+		t.Fatalf("refresh token used twice: status = %d, want 401", code)
+	}
+
+	second, _ := login()
+	if code := do(http.MethodPost, "/revoke", renewed, `{"refreshToken":"`+next+`"}`); code != http.StatusNoContent {
+		t.Fatalf("revoke: status = %d, want 204", code)
+	}
+	if do(http.MethodGet, "/me", renewed, "") != http.StatusUnauthorized {
+		t.Fatal("a revoked token was accepted")
+	}
+	if code := status(RefreshToken, post(`{"refreshToken":"`+next+`"}`), nil); code != http.StatusUnauthorized {
+		t.Fatalf("revoked refresh token: status = %d, want 401", code)
+	}
+	if do(http.MethodGet, "/me", token, "") != http.StatusUnauthorized {
+		t.Fatal("an older token of a revoked session was accepted")
+	}
+	if do(http.MethodGet, "/me", second, "") != http.StatusOK {
+		t.Fatal("revoking a session logged out another one")
+	}
+
+	token = second
+	other, otherRefresh := login()
+	if code := do(http.MethodPost, "/logout-all", token, ""); code != http.StatusNoContent {
+		t.Fatalf("logout all: status = %d, want 204", code)
+	}
+	for _, tk := range []string{token, other} {
+		if do(http.MethodGet, "/me", tk, "") != http.StatusUnauthorized {
+			t.Fatal("a token was accepted after logging out everywhere")
+		}
+	}
+	if code := status(RefreshToken, post(`{"refreshToken":"`+otherRefresh+`"}`), nil); code != http.StatusUnauthorized {
+		t.Fatalf("refresh after logging out everywhere: status = %d, want 401", code)
+	}
+	token, _ = login()
+	if do(http.MethodGet, "/me", token, "") != http.StatusOK {
+		t.Fatal("a new login was rejected after logging out everywhere")
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	e := gin.New()
+	Init(e)
+	owner := newTestUser(t, "apikey-owner")
+	other := newTestUser(t, "apikey-other")
+	room := newTestRoom(t, owner, "apikey-room")
+	foreign := newTestRoom(t, other, "apikey-foreign")
+
+	data := serve(t, CreateAPIKey, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"bot","scopes":["user:read","movie:read"]}`)), gin.H{"user": owner})["data"].(map[string]any)
+	key := data["key"].(string)
+	id := data["apiKey"].(map[string]any)["id"].(float64)
+	do := func(method, path, roomID string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		if roomID != "" {
+			req.Header.Set("X-Room-Id", roomID)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, c := range []struct {
+		method, path, room string
+		want               int
+	}{
+		{http.MethodGet, "/api/user/me", "", http.StatusOK},
+		{http.MethodGet, "/api/movie/list", room.ID, http.StatusOK},
+		// no scope
+		{http.MethodPost, "/api/movie/clear", room.ID, http.StatusForbidden},
+		{http.MethodGet, "/api/room/members", room.ID, http.StatusForbidden},
+		// never allowed for api keys
+		{http.MethodGet, "/api/user/apikeys", "", http.StatusForbidden},
+		{http.MethodPost, "/api/user/logout-all", "", http.StatusForbidden},
+		{http.MethodPost, "/api/room/create", "", http.StatusForbidden},
+		// rooms the user is not a member of
+		{http.MethodGet, "/api/movie/list", foreign.ID, http.StatusForbidden},
+		{http.MethodGet, "/api/movie/list", "", http.StatusBadRequest},
+	} {
+		if code := do(c.method, c.path, c.room); code != c.want {
+			t.Errorf("%s %s: status = %d, want %d", c.method, c.path, code, c.want)
+		}
+	}
+
+	keys := serve(t, APIKeys, httptest.NewRequest(http.MethodGet, "/", nil), gin.H{"user": owner})["data"].(map[string]any)["apiKeys"].([]any)
+	if len(keys) != 1 || keys[0].(map[string]any)["lastUsedAt"].(float64) <= 0 || keys[0].(map[string]any)["expiresAt"].(float64) != 0 || keys[0].(map[string]any)["hashedKey"] != nil {
+		t.Fatalf("api keys = %v", keys)
+	}
+	deleteKey := func(u *op.User) int {
+		token, err := middlewares.NewAuthUserToken(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/apikeys/"+strconv.Itoa(int(id)), nil)
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := deleteKey(other); code != http.StatusNotFound {
+		t.Fatalf("delete the key of another user: status = %d, want 404", code)
+	}
+	if code := deleteKey(owner); code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d, want 204", code)
+	}
+	if code := do(http.MethodGet, "/api/user/me", ""); code != http.StatusUnauthorized {
+		t.Fatalf("deleted key: status = %d, want 401", code)
+	}
+}
+
+func TestExportAccount(t *testing.T) {
+	u := newTestUser(t, "export-user")
+	if _, _, err := u.CreateAPIKey("bot", []dbModel.APIKeyScope{dbModel.ScopeUserRead}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := serve(t, ExportAccount, httptest.NewRequest(http.MethodGet, "/", nil), gin.H{"user": u})
+	keys := resp["apiKeys"].([]any)
+	if len(keys) != 1 {
+		t.Fatalf("api keys = %v", keys)
+	}
+	for _, field := range []string{"createdAt", "expiresAt"} {
+		if v, ok := keys[0].(map[string]any)[field].(float64); !ok || v <= 0 {
+			t.Errorf("api key %s = %v, want unix milliseconds", field, keys[0].(map[string]any)[field])
+		}
+	}
+	if keys[0].(map[string]any)["hashedKey"] != nil {
+		t.Fatal("the export leaks key hashes")
+	}
+}
+
+func TestSessions(t *testing.T) {
+	e := gin.New()
+	Init(e)
+	do := func(method, path, token string) (int, map[string]any) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		resp := map[string]any{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	login := func(userAgent string) (string, string) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username":"session-user","password":"s3cretpass"}`))
+		req.Header.Set("User-Agent", userAgent)
+		data := serve(t, LoginUser, req, nil)["data"].(map[string]any)
+		return data["token"].(string), data["refreshToken"].(string)
+	}
+	serve(t, SignupUser, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username":"session-user","password":"s3cretpass"}`)), nil)
+
+	laptop, _ := login("laptop")
+	phone, phoneRefresh := login("phone")
+
+	code, resp := do(http.MethodGet, "/api/user/sessions", laptop)
+	if code != http.StatusOK {
+		t.Fatalf("sessions: status = %d", code)
+	}
+	data := resp["data"].(map[string]any)
+	var phoneID float64
+	agents := map[string]bool{}
+	for _, s := range data["sessions"].([]any) {
+		s := s.(map[string]any)
+		agents[s["userAgent"].(string)] = true
+		if s["userAgent"] == "phone" {
+			phoneID = s["id"].(float64)
+		}
+		if s["hashedToken"] != nil {
+			t.Fatal("the session list leaks token hashes")
+		}
+		if _, ok := s["lastUsedAt"].(float64); !ok {
+			t.Fatalf("lastUsedAt = %v, want unix milliseconds", s["lastUsedAt"])
+		}
+	}
+	// the signup started a session too
+	if len(agents) < 2 || !agents["laptop"] || !agents["phone"] || data["current"] == phoneID {
+		t.Fatalf("sessions = %v", data)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/room/create", strings.NewReader(`{"roomName":"session-room"}`))
+	req.Header.Set("Authorization", phone)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated && w.Code != http.StatusOK {
+		t.Fatalf("create room: status = %d, %s", w.Code, w.Body.String())
+	}
+	created := map[string]any{}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	roomToken := created["data"].(map[string]any)["token"].(string)
+	if code, _ := do(http.MethodGet, "/api/user/me", roomToken); code != http.StatusUnauthorized {
+		t.Fatalf("room token used as a user token: status = %d, want 401", code)
+	}
+	if code, _ := do(http.MethodGet, "/api/room/setting", roomToken); code != http.StatusOK {
+		t.Fatalf("room token: status = %d, want 200", code)
+	}
+
+	other := newTestUser(t, "session-other")
+	otherToken, err := middlewares.NewAuthUserToken(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/user/sessions/" + strconv.Itoa(int(phoneID))
+	if code, _ := do(http.MethodDelete, path, otherToken); code != http.StatusNotFound {
+		t.Fatalf("delete the session of another user: status = %d, want 404", code)
+	}
+	if code, _ := do(http.MethodDelete, path, laptop); code != http.StatusNoContent {
+		t.Fatalf("delete session: status = %d, want 204", code)
+	}
+	if code, _ := do(http.MethodGet, "/api/user/me", phone); code != http.StatusUnauthorized {
+		t.Fatalf("token of a deleted session: status = %d, want 401", code)
+	}
+	if code, _ := do(http.MethodGet, "/api/room/setting", roomToken); code != http.StatusUnauthorized {
+		t.Fatalf("room token of a deleted session: status = %d, want 401", code)
+	}
+	if code := status(RefreshToken, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"refreshToken":"`+phoneRefresh+`"}`)), nil); code != http.StatusUnauthorized {
+		t.Fatalf("refresh token of a deleted session: status = %d, want 401", code)
+	}
+	if code, _ := do(http.MethodGet, "/api/user/me", laptop); code != http.StatusOK {
+		t.Fatalf("other session: status = %d, want 200", code)
+	}
+}
+
+func TestInstanceRoles(t *testing.T) {
+	e := gin.New()
+	Init(e)
+	do := func(method, path, token string) (int, map[string]any) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		resp := map[string]any{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	serve(t, SignupUser, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username":"role-user","password":"s3cretpass"}`)), nil)
+	user, err := op.GetUserByUsername("role-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := middlewares.NewAuthUserToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _ := do(http.MethodGet, "/api/admin/users/renames?username=x", token); code != http.StatusForbidden {
+		t.Fatalf("admin api as a user: status = %d, want 403", code)
+	}
+	if err := user.SetRole(dbModel.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/api/admin/users/renames", "/api/admin/user/renames"} {
+		if code, _ := do(http.MethodGet, path+"?username=x", token); code != http.StatusOK {
+			t.Fatalf("%s as an admin: status = %d, want 200", path, code)
+		}
+	}
+
+	if err := user.SetRole(dbModel.RoleBanned); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := do(http.MethodGet, "/api/user/me", token); code != http.StatusUnauthorized {
+		t.Fatalf("token issued before the ban: status = %d, want 401", code)
+	}
+	user, err = op.GetUserById(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err = middlewares.NewAuthUserToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, resp := do(http.MethodGet, "/api/user/me", token)
+	if code != http.StatusForbidden || resp["error"] != op.ErrUserBanned.Error() {
+		t.Fatalf("banned user: status = %d, resp = %v, want 403 user is banned", code, resp)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username":"role-user","password":"s3cretpass"}`))
+	if code := status(LoginUser, req, nil); code != http.StatusForbidden {
+		t.Fatalf("banned login: status = %d, want 403", code)
+	}
+
+	if err := user.SetRole(dbModel.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username":"role-user","password":"s3cretpass"}`))
+	if code := status(LoginUser, req, nil); code != http.StatusOK {
+		t.Fatalf("unbanned login: status = %d, want 200", code)
+	}
+}
+
+func TestCaptcha(t *testing.T) {
+	verify := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("secret") == "captcha-secret" && r.PostFormValue("response") == "solved" {
+			_, _ = w.Write([]byte(`{"success":true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+	}))
+	defer verify.Close()
+	old := middlewares.CaptchaVerifiers["hcaptcha"]
+	middlewares.CaptchaVerifiers["hcaptcha"] = &middlewares.SiteVerifier{URL: verify.URL}
+	defer func() {
+		middlewares.CaptchaVerifiers["hcaptcha"] = old
+		if err := settings.Set(map[string]string{"captcha_provider": "", "captcha_signup": "false"}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	e := gin.New()
+	Init(e)
+	signup := func(username, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/signup", strings.NewReader(`{"username":"`+username+`","password":"s3cretpass"}`))
+		if token != "" {
+			req.Header.Set(middlewares.CaptchaHeader, token)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if err := settings.Set(map[string]string{"captcha_provider": "unknown"}); err == nil {
+		t.Fatal("unknown captcha provider accepted")
+	}
+	// enabled for the endpoint but no provider yet
+	if err := settings.Set(map[string]string{"captcha_signup": "true"}); err != nil {
+		t.Fatal(err)
+	}
+	if code := signup("captcha-none", ""); code != http.StatusOK {
+		t.Fatalf("signup without provider: status = %d, want 200", code)
+	}
+	if err := settings.Set(map[string]string{"captcha_secret": "captcha-secret"}); err == nil {
+		t.Fatal("captcha secret accepted as a setting")
+	}
+	conf.Conf().Captcha.Secret = "captcha-secret"
+	defer func() {
+		conf.Conf().Captcha = conf.DefaultCaptchaConfig()
+	}()
+	if err := settings.Set(map[string]string{"captcha_provider": "hcaptcha"}); err != nil {
+		t.Fatal(err)
+	}
+	if code := signup("captcha-missing", ""); code != http.StatusBadRequest {
+		t.Fatalf("signup without captcha: status = %d, want 400", code)
+	}
+	if code := signup("captcha-wrong", "robot"); code != http.StatusForbidden {
+		t.Fatalf("signup with a failed captcha: status = %d, want 403", code)
+	}
+	if code := signup("captcha-solved", "solved"); code != http.StatusOK {
+		t.Fatalf("signup with a solved captcha: status = %d, want 200", code)
+	}
+}
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"time"
@@ -9,6 +12,8 @@ import (
 	"github.com/gorilla/websocket"
 	json "github.com/json-iterator/go"
 	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/metrics"
+	dbModel "github.com/synctv-org/synctv/internal/model"
 	"github.com/synctv-org/synctv/internal/op"
 	pb "github.com/synctv-org/synctv/proto"
 	"github.com/synctv-org/synctv/server/middlewares"
@@ -17,14 +22,17 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-const maxInterval = 10
-
 func NewWebSocketHandler(wss *utils.WebSocket) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		token := ctx.GetHeader("Sec-WebSocket-Protocol")
 		user, room, err := middlewares.AuthRoom(token)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, model.NewApiErrorResp(err))
+			ctx.AbortWithStatusJSON(middlewares.AuthErrorStatus(err), model.NewApiErrorResp(err))
+			return
+		}
+
+		if err := room.CheckCapacity(user); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
 			return
 		}
 
@@ -80,16 +88,35 @@ func handleWriterMessage(c *op.Client) error {
 	return nil
 }
 
+var wsMessages = metrics.NewCounter("ws_messages_received_total", "Messages received from websocket clients.")
+
 func handleReaderMessage(c *op.Client) error {
 	defer c.Close()
-	var msg pb.ElementMessage
 	for {
+		// a fresh message each time, so a missing field never reuses the previous message's value
+		var msg pb.ElementMessage
 		t, rd, err := c.NextReader()
 		if err != nil {
 			log.Debugf("ws: room %s user %s get next reader error: %v", c.Room().Name, c.User().Username, err)
 			return err
 		}
 		log.Debugf("ws: room %s user %s receive message type: %d", c.Room().Name, c.User().Username, t)
+		wsMessages.Inc()
+		if err := c.AllowMessage(); err != nil {
+			if err := c.Send(&op.ElementMessage{
+				ElementMessage: &pb.ElementMessage{
+					Type:    pb.ElementMessageType_ERROR,
+					Message: err.Error(),
+				},
+			}); err != nil {
+				return err
+			}
+			if errors.Is(err, op.ErrMessageFlood) {
+				log.Warnf("ws: room %s user %s disconnected for flooding", c.Room().Name, c.User().Username)
+				return err
+			}
+			continue
+		}
 		switch t {
 		case websocket.CloseMessage:
 			log.Debugf("ws: room %s user %s receive close message", c.Room().Name, c.User().Username)
@@ -141,23 +168,42 @@ func handleReaderMessage(c *op.Client) error {
 			continue
 		}
 		log.Debugf("ws: receive room %s user %s message: %+v", c.Room().Name, c.User().Username, msg.String())
+		var (
+			sendFunc      send
+			broadcastFunc broadcast
+		)
 		switch t {
 		case websocket.BinaryMessage:
-			err = handleElementMsg(c.Room(), &msg, func(em *pb.ElementMessage) error {
+			sendFunc = func(em *pb.ElementMessage) error {
 				em.Sender = c.User().Username
 				return c.Send(&op.ElementMessage{ElementMessage: em})
-			}, func(em *pb.ElementMessage, bc ...op.BroadcastConf) error {
+			}
+			broadcastFunc = func(em *pb.ElementMessage, bc ...op.BroadcastConf) error {
 				em.Sender = c.User().Username
 				return c.Broadcast(&op.ElementMessage{ElementMessage: em}, bc...)
-			})
+			}
 		case websocket.TextMessage:
-			err = handleElementMsg(c.Room(), &msg, func(em *pb.ElementMessage) error {
+			sendFunc = func(em *pb.ElementMessage) error {
 				em.Sender = c.User().Username
 				return c.Send(&op.ElementJsonMessage{ElementMessage: em})
-			}, func(em *pb.ElementMessage, bc ...op.BroadcastConf) error {
+			}
+			broadcastFunc = func(em *pb.ElementMessage, bc ...op.BroadcastConf) error {
 				em.Sender = c.User().Username
 				return c.Broadcast(&op.ElementJsonMessage{ElementMessage: em}, bc...)
+			}
+		}
+		switch msg.Type {
+		case pb.ElementMessageType_HELLO:
+			err = handleHello(c, &msg, sendFunc)
+		case pb.ElementMessageType_PING:
+			err = sendFunc(&pb.ElementMessage{
+				Type: pb.ElementMessageType_PONG,
+				Time: msg.Time,
 			})
+		case pb.ElementMessageType_PONG:
+			c.UpdateRTT(msg.Time)
+		default:
+			err = handleElementMsg(c.Room(), c.User(), &msg, sendFunc, broadcastFunc)
 		}
 		if err != nil {
 			log.Errorf("ws: room %s user %s handle message error: %v", c.Room().Name, c.User().Username, err)
@@ -170,7 +216,113 @@ type send func(*pb.ElementMessage) error
 
 type broadcast func(*pb.ElementMessage, ...op.BroadcastConf) error
 
-func handleElementMsg(r *op.Room, msg *pb.ElementMessage, send send, broadcast broadcast) error {
+// elementMsgHandler handles one client-sent element message type from u,
+// timeDiff is the clamped transmission delay in seconds
+type elementMsgHandler func(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error
+
+// elementMsgHandlers is the set of message types a client may send,
+// anything else is answered with an error frame
+var elementMsgHandlers = map[pb.ElementMessageType]elementMsgHandler{
+	pb.ElementMessageType_CHAT_MESSAGE:   handleChatMessage,
+	pb.ElementMessageType_PLAY:           lockedInLobby(canChangeStatus(hostOnly(byVote(handlePlay)))),
+	pb.ElementMessageType_PAUSE:          lockedInLobby(canChangeStatus(hostOnly(byVote(handlePause)))),
+	pb.ElementMessageType_CHANGE_RATE:    lockedInLobby(hostOnly(byVote(handleChangeRate))),
+	pb.ElementMessageType_CHANGE_SEEK:    lockedInLobby(canChangeStatus(hostOnly(byVote(handleChangeSeek)))),
+	pb.ElementMessageType_CHECK_SEEK:     handleCheckSeek,
+	pb.ElementMessageType_VOTE:           lockedInLobby(handleVote),
+	pb.ElementMessageType_ENDED:          lockedInLobby(canChangeCurrent(hostOnly(byVote(handleEnded)))),
+	pb.ElementMessageType_SUBTITLE:       lockedInLobby(canChangeStatus(hostOnly(handleSubtitle))),
+	pb.ElementMessageType_DANMAKU:        handleDanmaku,
+	pb.ElementMessageType_REACTION:       handleReaction,
+	pb.ElementMessageType_VOICE_JOIN:     handleVoiceJoin,
+	pb.ElementMessageType_VOICE_LEAVE:    handleVoiceLeave,
+	pb.ElementMessageType_VOICE_SIGNAL:   handleVoiceSignal,
+	pb.ElementMessageType_VOICE_SPEAKING: handleVoiceSpeaking,
+}
+
+// lockedInLobby rejects playback control until a scheduled room starts
+func lockedInLobby(h elementMsgHandler) elementMsgHandler {
+	return func(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+		if r.InLobby() {
+			return send(&pb.ElementMessage{
+				Type:    pb.ElementMessageType_ERROR,
+				Message: op.ErrRoomNotStarted.Error(),
+			})
+		}
+		return h(r, u, msg, timeDiff, send, broadcast)
+	}
+}
+
+// canChangeStatus rejects playback control from users with neither
+// CanChangeMovieStatus nor CanControlPlayback
+func canChangeStatus(h elementMsgHandler) elementMsgHandler {
+	return func(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+		if !u.HasAnyPermission(r, dbModel.CanChangeMovieStatus, dbModel.CanControlPlayback) {
+			return send(&pb.ElementMessage{
+				Type:    pb.ElementMessageType_ERROR,
+				Message: "no permission to control playback",
+			})
+		}
+		return h(r, u, msg, timeDiff, send, broadcast)
+	}
+}
+
+// canChangeCurrent rejects changes of the current movie from users without CanChangeCurrentMovie
+func canChangeCurrent(h elementMsgHandler) elementMsgHandler {
+	return func(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+		if !u.HasPermission(r, dbModel.CanChangeCurrentMovie) {
+			return send(&pb.ElementMessage{
+				Type:    pb.ElementMessageType_ERROR,
+				Message: "no permission to change the current movie",
+			})
+		}
+		return h(r, u, msg, timeDiff, send, broadcast)
+	}
+}
+
+// hostOnly rejects playback control in host only rooms from users without CanControlPlayback
+func hostOnly(h elementMsgHandler) elementMsgHandler {
+	return func(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+		if r.Settings().HostOnly && !u.HasPermission(r, dbModel.CanControlPlayback) {
+			return send(&pb.ElementMessage{
+				Type:    pb.ElementMessageType_ERROR,
+				Message: "only the host can control playback",
+			})
+		}
+		return h(r, u, msg, timeDiff, send, broadcast)
+	}
+}
+
+// byVote rejects playback changes in rooms controlled by votes from users
+// without CanControlPlayback, see op.Room.ControlledByVotes
+func byVote(h elementMsgHandler) elementMsgHandler {
+	return func(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+		if r.ControlledByVotes(u) {
+			return send(&pb.ElementMessage{
+				Type:    pb.ElementMessageType_ERROR,
+				Message: op.ErrControlledByVotes.Error(),
+			})
+		}
+		return h(r, u, msg, timeDiff, send, broadcast)
+	}
+}
+
+func handleElementMsg(r *op.Room, u *op.User, msg *pb.ElementMessage, send send, broadcast broadcast) error {
+	h, ok := elementMsgHandlers[msg.Type]
+	if !ok {
+		log.Debugf("ws: receive unknown element message type: %d", msg.Type)
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: fmt.Sprintf("unknown message type: %d", msg.Type),
+		})
+	}
+	// guests can only keep their own player in sync
+	if u != nil && u.IsGuest() && msg.Type != pb.ElementMessageType_CHECK_SEEK {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: "guests can only watch",
+		})
+	}
 	var timeDiff float64
 	if msg.Time != 0 {
 		timeDiff = time.Since(time.UnixMilli(msg.Time)).Seconds()
@@ -182,68 +334,325 @@ func handleElementMsg(r *op.Room, msg *pb.ElementMessage, send send, broadcast b
 	} else if timeDiff > 1.5 {
 		timeDiff = 1.5
 	}
-	switch msg.Type {
-	case pb.ElementMessageType_CHAT_MESSAGE:
-		if len(msg.Message) > 4096 {
-			send(&pb.ElementMessage{
-				Type:    pb.ElementMessageType_ERROR,
-				Message: "message too long",
-			})
-			return nil
-		}
-		broadcast(&pb.ElementMessage{
-			Type:    pb.ElementMessageType_CHAT_MESSAGE,
-			Message: msg.Message,
-		}, op.WithSendToSelf())
-	case pb.ElementMessageType_PLAY:
-		status := r.SetStatus(true, msg.Seek, msg.Rate, timeDiff)
-		broadcast(&pb.ElementMessage{
-			Type: pb.ElementMessageType_PLAY,
-			Seek: status.Seek,
-			Rate: status.Rate,
+	return h(r, u, msg, timeDiff, send, broadcast)
+}
+
+// handleHello negotiates the protocol of the connection, see op.ProtocolVersion.
+// The answer is a HELLO with the version and capabilities in use,
+// followed by the room notices the client can now read.
+func handleHello(c *op.Client, msg *pb.ElementMessage, send send) error {
+	version, capabilities, err := c.Negotiate(msg.Version, msg.Capabilities)
+	if err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
 		})
-	case pb.ElementMessageType_PAUSE:
-		status := r.SetStatus(false, msg.Seek, msg.Rate, timeDiff)
-		broadcast(&pb.ElementMessage{
-			Type: pb.ElementMessageType_PAUSE,
-			Seek: status.Seek,
-			Rate: status.Rate,
+	}
+	if err := send(&pb.ElementMessage{
+		Type:         pb.ElementMessageType_HELLO,
+		Version:      version,
+		Capabilities: capabilities,
+	}); err != nil {
+		return err
+	}
+	c.Room().Greet(c)
+	return nil
+}
+
+func handleChatMessage(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	if r.Settings().DisableChat {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: op.ErrChatDisabled.Error(),
 		})
-	case pb.ElementMessageType_CHANGE_RATE:
-		status := r.SetSeekRate(msg.Seek, msg.Rate, timeDiff)
-		broadcast(&pb.ElementMessage{
-			Type: pb.ElementMessageType_CHANGE_RATE,
-			Seek: status.Seek,
-			Rate: status.Rate,
+	}
+	if len(msg.Message) > 4096 {
+		send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: "message too long",
 		})
-	case pb.ElementMessageType_CHANGE_SEEK:
-		status := r.SetSeekRate(msg.Seek, msg.Rate, timeDiff)
+		return nil
+	}
+	if err := r.CheckMuted(u.ID); err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+	}
+	message, err := r.FilterChat(u.ID, msg.Message)
+	if err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+	}
+	id := r.RecordChat(u, message)
+	broadcast(&pb.ElementMessage{
+		Type:         pb.ElementMessageType_CHAT_MESSAGE,
+		Message:      message,
+		MessageId:    id,
+		SenderName:   u.ShownName(),
+		SenderAvatar: u.Avatar,
+	}, op.WithSendToSelf())
+	r.NotifyMentions(u, message, id)
+	return nil
+}
+
+// handleDanmaku saves a danmaku at the playback position the sender reports and shows it to everyone
+func handleDanmaku(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	if msg.Danmaku == nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: "danmaku is empty",
+		})
+	}
+	if err := r.CheckMuted(u.ID); err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+	}
+	d, err := r.SendDanmaku(u.ID, msg.Danmaku.Content, msg.Danmaku.Color, msg.Danmaku.Time)
+	if err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+	}
+	broadcast(&pb.ElementMessage{
+		Type:    pb.ElementMessageType_DANMAKU,
+		Danmaku: op.DanmakuProto(d),
+	}, op.WithSendToSelf())
+	return nil
+}
+
+// handleReaction shows a reaction to everyone, reactions are not saved
+func handleReaction(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	err := r.CheckMuted(u.ID)
+	if err == nil {
+		err = r.React(u.ID, msg.Reaction)
+	}
+	if err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+	}
+	broadcast(&pb.ElementMessage{
+		Type:     pb.ElementMessageType_REACTION,
+		Reaction: msg.Reaction,
+		Time:     time.Now().UnixMilli(),
+	}, op.WithSendToSelf())
+	return nil
+}
+
+// handleVoiceJoin adds the sender to the voice channel and answers with the
+// participants already there, the offer of the server follows
+func handleVoiceJoin(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	if !u.HasPermission(r, dbModel.CanUseVoice) {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: "no permission to use voice",
+		})
+	}
+	peers, err := r.JoinVoice(u)
+	if err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+	}
+	return send(&pb.ElementMessage{
+		Type:    pb.ElementMessageType_VOICE_JOIN,
+		Sender:  u.Username,
+		Members: peers,
+	})
+}
+
+func handleVoiceLeave(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	r.LeaveVoice(u)
+	return nil
+}
+
+func handleVoiceSignal(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	if err := r.SignalVoice(u, msg.Voice); err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+	}
+	return nil
+}
+
+func handleVoiceSpeaking(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	if err := r.SetSpeaking(u, msg.Speaking); err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+	}
+	return nil
+}
+
+// rateOf returns the rate sent with a playback event, users without
+// CanChangeRate and invalid rates keep the current rate of the room
+func rateOf(r *op.Room, u *op.User, rate float64) float64 {
+	if !op.ValidRate(rate) || !u.HasPermission(r, dbModel.CanChangeRate) {
+		return r.Current().Status.Rate
+	}
+	return rate
+}
+
+func handlePlay(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	status := r.SetStatus(true, msg.Seek, rateOf(r, u, msg.Rate), timeDiff)
+	broadcast(&pb.ElementMessage{
+		Type: pb.ElementMessageType_PLAY,
+		Seek: status.Seek,
+		Rate: status.Rate,
+		Seq:  status.Seq,
+	})
+	return nil
+}
+
+func handlePause(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	status := r.SetStatus(false, msg.Seek, rateOf(r, u, msg.Rate), timeDiff)
+	broadcast(&pb.ElementMessage{
+		Type: pb.ElementMessageType_PAUSE,
+		Seek: status.Seek,
+		Rate: status.Rate,
+		Seq:  status.Seq,
+	})
+	return nil
+}
+
+func handleChangeRate(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	if !u.HasPermission(r, dbModel.CanChangeRate) {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: "no permission to change rate",
+		})
+	}
+	status, err := r.SetRate(msg.Rate)
+	if err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+	}
+	broadcast(&pb.ElementMessage{
+		Type: pb.ElementMessageType_CHANGE_RATE,
+		Seek: status.Seek,
+		Rate: status.Rate,
+		Seq:  status.Seq,
+	})
+	return nil
+}
+
+// handleSubtitle switches the subtitle track of the current movie, every client follows
+func handleSubtitle(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	if err := r.SetSubtitle(uint(msg.Subtitle)); err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+	}
+	return nil
+}
+
+func handleChangeSeek(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	// a burst of seeks is broadcast once with its final position, to the
+	// seekers too, so everyone settles on the last writer
+	r.Seek(msg.Seek, rateOf(r, u, msg.Rate), timeDiff, func(status op.Status) {
+		r.RecordEvent(context.Background(), u.ID, dbModel.RoomEventPlaybackSeeked, fmt.Sprintf("seek to %.2f", status.Seek))
 		broadcast(&pb.ElementMessage{
 			Type: pb.ElementMessageType_CHANGE_SEEK,
 			Seek: status.Seek,
 			Rate: status.Rate,
+			Seq:  status.Seq,
+		}, op.WithSendToSelf())
+	})
+	return nil
+}
+
+func handleCheckSeek(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	status, drift := r.Drift(msg.Seek, timeDiff)
+	// only the drifting client is corrected, the others are left alone
+	typ := pb.ElementMessageType_CHECK_SEEK
+	if drift > op.MaxDrift {
+		typ = pb.ElementMessageType_TOO_FAST
+	} else if drift < -op.MaxDrift {
+		typ = pb.ElementMessageType_TOO_SLOW
+	}
+	return send(&pb.ElementMessage{
+		Type: typ,
+		Seek: status.Seek,
+		Rate: status.Rate,
+		Seq:  status.Seq,
+	})
+}
+
+// handleVote counts the vote of u and broadcasts the tally,
+// a passed vote is followed by the resulting playback change
+func handleVote(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	result, err := r.Vote(u.ID, msg.GetVote().GetAction())
+	if err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
 		})
-	case pb.ElementMessageType_CHECK_SEEK:
-		status := r.Current().Status
-		if status.Seek+maxInterval < msg.Seek+timeDiff {
-			send(&pb.ElementMessage{
-				Type: pb.ElementMessageType_TOO_FAST,
-				Seek: status.Seek,
-				Rate: status.Rate,
-			})
-		} else if status.Seek-maxInterval > msg.Seek+timeDiff {
-			send(&pb.ElementMessage{
-				Type: pb.ElementMessageType_TOO_SLOW,
-				Seek: status.Seek,
-				Rate: status.Rate,
-			})
-		} else {
-			send(&pb.ElementMessage{
-				Type: pb.ElementMessageType_CHECK_SEEK,
-				Seek: status.Seek,
-				Rate: status.Rate,
-			})
+	}
+	broadcast(&pb.ElementMessage{
+		Type: pb.ElementMessageType_VOTE,
+		Vote: &pb.Vote{
+			Action: result.Action,
+			Votes:  result.Votes,
+			Needed: result.Needed,
+			Passed: result.Passed,
+		},
+	}, op.WithSendToSelf())
+	if !result.Passed {
+		return nil
+	}
+	current := r.Current()
+	switch result.Action {
+	case op.VotePause, op.VotePlay:
+		t := pb.ElementMessageType_PLAY
+		if result.Action == op.VotePause {
+			t = pb.ElementMessageType_PAUSE
 		}
+		broadcast(&pb.ElementMessage{
+			Type: t,
+			Seek: current.Status.Seek,
+			Rate: current.Status.Rate,
+			Seq:  current.Status.Seq,
+		}, op.WithSendToSelf())
+	case op.VoteSkip:
+		r.RecordEvent(context.Background(), u.ID, dbModel.RoomEventPlaylistChanged, fmt.Sprintf("vote to skip to movie %d", current.Movie.ID))
+		broadcast(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_CHANGE_CURRENT,
+			Current: current.Proto(),
+		}, op.WithSendToSelf())
+	}
+	return nil
+}
+
+// handleEnded advances rooms with autoNext when the current movie ended
+func handleEnded(r *op.Room, u *op.User, msg *pb.ElementMessage, timeDiff float64, send send, broadcast broadcast) error {
+	advanced, err := r.Ended(uint(msg.GetCurrent().GetMovie().GetId()))
+	if err != nil {
+		return send(&pb.ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+	}
+	if !advanced {
+		return nil
 	}
+	current := r.Current()
+	r.RecordEvent(context.Background(), u.ID, dbModel.RoomEventPlaylistChanged, fmt.Sprintf("auto next to movie %d", current.Movie.ID))
+	broadcast(&pb.ElementMessage{
+		Type:    pb.ElementMessageType_CHANGE_CURRENT,
+		Current: current.Proto(),
+	}, op.WithSendToSelf())
 	return nil
 }
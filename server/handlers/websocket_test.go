@@ -0,0 +1,525 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/db"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	pb "github.com/synctv-org/synctv/proto"
+)
+
+type recorder struct {
+	lock              sync.Mutex
+	sent, broadcasted []*pb.ElementMessage
+}
+
+func (r *recorder) send(em *pb.ElementMessage) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.sent = append(r.sent, em)
+	return nil
+}
+
+func (r *recorder) broadcast(em *pb.ElementMessage, _ ...op.BroadcastConf) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.broadcasted = append(r.broadcasted, em)
+	return nil
+}
+
+func (r *recorder) broadcasts() []*pb.ElementMessage {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*pb.ElementMessage(nil), r.broadcasted...)
+}
+
+func TestHandleElementMsgKnown(t *testing.T) {
+	creator := newTestUser(t, "known-creator")
+	room := newTestRoom(t, creator, "known-room")
+	rec := &recorder{}
+	err := handleElementMsg(room, creator, &pb.ElementMessage{
+		Type:    pb.ElementMessageType_CHAT_MESSAGE,
+		Message: "hello",
+	}, rec.send, rec.broadcast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.sent) != 0 {
+		t.Fatalf("sent %d messages, want 0", len(rec.sent))
+	}
+	if len(rec.broadcasted) != 1 {
+		t.Fatalf("broadcast %d messages, want 1", len(rec.broadcasted))
+	}
+	if em := rec.broadcasted[0]; em.Type != pb.ElementMessageType_CHAT_MESSAGE || em.Message != "hello" {
+		t.Fatalf("broadcast %v, want chat message %q", em, "hello")
+	}
+}
+
+func TestHandleElementMsgUnknown(t *testing.T) {
+	for _, typ := range []pb.ElementMessageType{
+		pb.ElementMessageType_UNKNOWN,
+		pb.ElementMessageType_TOO_FAST,
+		pb.ElementMessageType(999),
+	} {
+		rec := &recorder{}
+		err := handleElementMsg(nil, nil, &pb.ElementMessage{Type: typ}, rec.send, rec.broadcast)
+		if err != nil {
+			t.Fatalf("type %d: %v", typ, err)
+		}
+		if len(rec.broadcasted) != 0 {
+			t.Fatalf("type %d: broadcast %d messages, want 0", typ, len(rec.broadcasted))
+		}
+		if len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+			t.Fatalf("type %d: sent %v, want one error frame", typ, rec.sent)
+		}
+	}
+}
+
+func TestHandleElementMsgLobby(t *testing.T) {
+	creator := newTestUser(t, "lobby-creator")
+	room := newTestRoom(t, creator, "lobby-room")
+	room.ScheduledAt = time.Now().Add(time.Hour)
+
+	rec := &recorder{}
+	if err := handleElementMsg(room, creator, &pb.ElementMessage{Type: pb.ElementMessageType_PLAY, Rate: 1}, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.broadcasted) != 0 {
+		t.Fatalf("broadcast %d messages in lobby, want 0", len(rec.broadcasted))
+	}
+	if len(rec.sent) != 1 || rec.sent[0].Message != op.ErrRoomNotStarted.Error() {
+		t.Fatalf("sent %v, want room not started error", rec.sent)
+	}
+
+	room.ScheduledAt = time.Now().Add(-time.Second)
+	rec = &recorder{}
+	if err := handleElementMsg(room, creator, &pb.ElementMessage{Type: pb.ElementMessageType_PLAY, Rate: 1}, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.broadcasted) != 1 || rec.broadcasted[0].Type != pb.ElementMessageType_PLAY {
+		t.Fatalf("broadcast %v, want play after start", rec.broadcasted)
+	}
+}
+
+func TestHandleElementMsgChatDisabled(t *testing.T) {
+	creator := newTestUser(t, "nochat-creator")
+	room := newTestRoom(t, creator, "nochat-room")
+	room.Setting.DisableChat = true
+
+	rec := &recorder{}
+	if err := handleElementMsg(room, creator, &pb.ElementMessage{
+		Type:    pb.ElementMessageType_CHAT_MESSAGE,
+		Message: "hello",
+	}, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.broadcasted) != 0 {
+		t.Fatalf("broadcast %d messages with chat disabled, want 0", len(rec.broadcasted))
+	}
+	if len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+		t.Fatalf("sent %v, want one error frame", rec.sent)
+	}
+}
+
+func TestHandleElementMsgRate(t *testing.T) {
+	creator := newTestUser(t, "rate-creator")
+	member := newTestUser(t, "rate-member")
+	room := newTestRoom(t, creator, "rate-room")
+	if err := db.AddUserToRoom(member.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions&^dbModel.CanChangeRate); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{}
+	if err := handleElementMsg(room, creator, &pb.ElementMessage{Type: pb.ElementMessageType_CHANGE_RATE, Rate: 1.5}, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.broadcasted) != 1 || rec.broadcasted[0].Rate != 1.5 {
+		t.Fatalf("broadcast %v, want rate 1.5", rec.broadcasted)
+	}
+
+	for _, c := range []struct {
+		user *op.User
+		rate float64
+	}{
+		{creator, 10},
+		{member, 1.25},
+	} {
+		rec = &recorder{}
+		if err := handleElementMsg(room, c.user, &pb.ElementMessage{Type: pb.ElementMessageType_CHANGE_RATE, Rate: c.rate}, rec.send, rec.broadcast); err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.broadcasted) != 0 || len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+			t.Fatalf("%s rate %g: sent %v, broadcast %v, want one error frame", c.user.Username, c.rate, rec.sent, rec.broadcasted)
+		}
+	}
+
+	// playback events of users without the permission keep the room rate
+	rec = &recorder{}
+	if err := handleElementMsg(room, member, &pb.ElementMessage{Type: pb.ElementMessageType_PLAY, Rate: 2}, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.broadcasted) != 1 || rec.broadcasted[0].Rate != 1.5 {
+		t.Fatalf("broadcast %v, want play at rate 1.5", rec.broadcasted)
+	}
+}
+
+func TestHandleElementMsgSeekDebounce(t *testing.T) {
+	creator := newTestUser(t, "seek-creator")
+	member := newTestUser(t, "seek-member")
+	room := newTestRoom(t, creator, "seek-room")
+	if err := db.AddUserToRoom(member.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions); err != nil {
+		t.Fatal(err)
+	}
+	before := room.Current().Status.Seq
+
+	rec := &recorder{}
+	for _, seek := range []struct {
+		user *op.User
+		seek float64
+	}{
+		{creator, 10},
+		{member, 20},
+		{creator, 30},
+	} {
+		if err := handleElementMsg(room, seek.user, &pb.ElementMessage{Type: pb.ElementMessageType_CHANGE_SEEK, Seek: seek.seek, Rate: 1}, rec.send, rec.broadcast); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bs := rec.broadcasts(); len(bs) != 0 {
+		t.Fatalf("broadcast %v during the burst, want nothing yet", bs)
+	}
+
+	time.Sleep(time.Second)
+	bs := rec.broadcasts()
+	if len(bs) != 1 {
+		t.Fatalf("broadcast %d messages after the burst, want 1", len(bs))
+	}
+	if bs[0].Type != pb.ElementMessageType_CHANGE_SEEK || bs[0].Seek < 30 {
+		t.Fatalf("broadcast %v, want the last seek to 30", bs[0])
+	}
+	if bs[0].Seq != before+3 {
+		t.Fatalf("seq = %d, want %d", bs[0].Seq, before+3)
+	}
+}
+
+func TestHandleElementMsgHostOnly(t *testing.T) {
+	creator := newTestUser(t, "host-creator")
+	member := newTestUser(t, "host-member")
+	host := newTestUser(t, "host-host")
+	room := newTestRoom(t, creator, "host-room")
+	room.Setting.HostOnly = true
+	if err := db.AddUserToRoom(member.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUserToRoom(host.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions|dbModel.CanControlPlayback); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{}
+	if err := handleElementMsg(room, member, &pb.ElementMessage{Type: pb.ElementMessageType_PAUSE, Rate: 1}, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.broadcasted) != 0 || len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+		t.Fatalf("member: sent %v, broadcast %v, want one error frame", rec.sent, rec.broadcasted)
+	}
+
+	for _, u := range []*op.User{creator, host} {
+		rec = &recorder{}
+		if err := handleElementMsg(room, u, &pb.ElementMessage{Type: pb.ElementMessageType_PAUSE, Rate: 1}, rec.send, rec.broadcast); err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.broadcasted) != 1 || rec.broadcasted[0].Type != pb.ElementMessageType_PAUSE {
+			t.Fatalf("%s: broadcast %v, want pause", u.Username, rec.broadcasted)
+		}
+	}
+}
+
+func TestHandleElementMsgDrift(t *testing.T) {
+	creator := newTestUser(t, "drift-creator")
+	room := newTestRoom(t, creator, "drift-room")
+	room.SetStatus(false, 100, 1, 0)
+
+	for _, c := range []struct {
+		seek float64
+		want pb.ElementMessageType
+	}{
+		{101, pb.ElementMessageType_CHECK_SEEK},
+		{99, pb.ElementMessageType_CHECK_SEEK},
+		{100 + op.MaxDrift + 1, pb.ElementMessageType_TOO_FAST},
+		{100 - op.MaxDrift - 1, pb.ElementMessageType_TOO_SLOW},
+	} {
+		rec := &recorder{}
+		if err := handleElementMsg(room, creator, &pb.ElementMessage{Type: pb.ElementMessageType_CHECK_SEEK, Seek: c.seek}, rec.send, rec.broadcast); err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.broadcasted) != 0 {
+			t.Fatalf("seek %g: broadcast %v, want a correction to the client only", c.seek, rec.broadcasted)
+		}
+		if len(rec.sent) != 1 || rec.sent[0].Type != c.want || rec.sent[0].Seek != 100 {
+			t.Fatalf("seek %g: sent %v, want %s at 100", c.seek, rec.sent, c.want)
+		}
+	}
+}
+
+func TestHandleElementMsgVote(t *testing.T) {
+	creator := newTestUser(t, "vote-creator")
+	member := newTestUser(t, "vote-member")
+	room := newTestRoom(t, creator, "vote-room")
+	room.Setting.VoteThreshold = 50
+	if err := db.AddUserToRoom(member.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*op.User{creator, member} {
+		if _, err := room.RegClient(u, nil); err != nil {
+			t.Fatal(err)
+		}
+		defer room.UnregisterClient(u)
+	}
+	room.SetStatus(true, 10, 1, 0)
+
+	rec := &recorder{}
+	if err := handleElementMsg(room, member, &pb.ElementMessage{Type: pb.ElementMessageType_PAUSE, Rate: 1}, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.broadcasted) != 0 || len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+		t.Fatalf("member pause: sent %v, broadcast %v, want one error frame", rec.sent, rec.broadcasted)
+	}
+	for _, msg := range []*pb.ElementMessage{
+		{Type: pb.ElementMessageType_CHANGE_SEEK, Seek: 50, Rate: 1},
+		{Type: pb.ElementMessageType_CHANGE_RATE, Rate: 2},
+	} {
+		rec = &recorder{}
+		if err := handleElementMsg(room, member, msg, rec.send, rec.broadcast); err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.broadcasted) != 0 || len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+			t.Fatalf("member %s: sent %v, broadcast %v, want one error frame", msg.Type, rec.sent, rec.broadcasted)
+		}
+	}
+	if s := room.Current().Status; s.Seek >= 50 || s.Rate != 1 {
+		t.Fatalf("member changed the playback of a voting room: %+v", s)
+	}
+
+	vote := &pb.ElementMessage{Type: pb.ElementMessageType_VOTE, Vote: &pb.Vote{Action: op.VotePause}}
+	for i := 0; i < 2; i++ {
+		rec = &recorder{}
+		if err := handleElementMsg(room, member, vote, rec.send, rec.broadcast); err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.broadcasted) != 1 || rec.broadcasted[0].Vote.GetVotes() != 1 || rec.broadcasted[0].Vote.GetNeeded() != 2 {
+			t.Fatalf("member vote %d: broadcast %v, want a tally of 1/2", i, rec.broadcasted)
+		}
+	}
+	if !room.Current().Status.Playing {
+		t.Fatal("room paused before the vote passed")
+	}
+
+	rec = &recorder{}
+	if err := handleElementMsg(room, creator, vote, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.broadcasted) != 2 || !rec.broadcasted[0].Vote.GetPassed() || rec.broadcasted[1].Type != pb.ElementMessageType_PAUSE {
+		t.Fatalf("passing vote: broadcast %v, want the tally and a pause", rec.broadcasted)
+	}
+	if room.Current().Status.Playing {
+		t.Fatal("room still playing after the vote passed")
+	}
+
+	rec = &recorder{}
+	if err := handleElementMsg(room, member, &pb.ElementMessage{Type: pb.ElementMessageType_VOTE, Vote: &pb.Vote{Action: op.VoteSkip}}, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	rec = &recorder{}
+	if err := handleElementMsg(room, creator, &pb.ElementMessage{Type: pb.ElementMessageType_VOTE, Vote: &pb.Vote{Action: op.VoteSkip}}, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+		t.Fatalf("skip without a next movie: sent %v, want an error frame", rec.sent)
+	}
+}
+
+func TestHandleElementMsgEnded(t *testing.T) {
+	creator := newTestUser(t, "ended-creator")
+	room := newTestRoom(t, creator, "ended-room")
+	room.Setting.AutoNext = true
+	for _, name := range []string{"first", "second"} {
+		if err := room.AddMovie(creator.NewMovie(dbModel.MovieInfo{BaseMovieInfo: dbModel.BaseMovieInfo{Name: name, Url: "http://example.com/" + name}})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := room.ChangeCurrentMovie(ms[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	ended := &pb.ElementMessage{
+		Type:    pb.ElementMessageType_ENDED,
+		Current: &pb.Current{Movie: &pb.MovieInfo{Id: uint64(ms[0].ID)}},
+	}
+
+	// a member who can't change the current movie can't skip it
+	member := newTestUser(t, "ended-member")
+	if err := db.AddUserToRoom(member.ID, room.ID, dbModel.RoomRoleUser, dbModel.DefaultPermissions&^dbModel.CanChangeCurrentMovie); err != nil {
+		t.Fatal(err)
+	}
+	rec := &recorder{}
+	if err := handleElementMsg(room, member, ended, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.broadcasted) != 0 || len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+		t.Fatalf("member ended: sent %v, broadcast %v, want one error frame", rec.sent, rec.broadcasted)
+	}
+
+	// the end of a movie of known duration is only taken near its end
+	if err := op.SetMovieMeta(room.ID, ms[0].ID, dbModel.MovieMeta{Duration: 100}); err != nil {
+		t.Fatal(err)
+	}
+	room.SetStatus(false, 10, 1, 0)
+	rec = &recorder{}
+	if err := handleElementMsg(room, creator, ended, rec.send, rec.broadcast); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.broadcasted) != 0 || len(rec.sent) != 1 || rec.sent[0].Message != op.ErrMovieNotEnded.Error() {
+		t.Fatalf("early ended: sent %v, broadcast %v, want %v", rec.sent, rec.broadcasted, op.ErrMovieNotEnded)
+	}
+	if id := room.Current().Movie.ID; id != ms[0].ID {
+		t.Fatalf("current movie = %d after early ended, want %d", id, ms[0].ID)
+	}
+
+	room.SetStatus(false, 98, 1, 0)
+	rec = &recorder{}
+	for i := 0; i < 3; i++ {
+		if err := handleElementMsg(room, creator, ended, rec.send, rec.broadcast); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(rec.sent) != 0 || len(rec.broadcasted) != 1 || rec.broadcasted[0].Type != pb.ElementMessageType_CHANGE_CURRENT {
+		t.Fatalf("sent %v, broadcast %v, want a single change of current", rec.sent, rec.broadcasted)
+	}
+	if id := room.Current().Movie.ID; id != ms[1].ID {
+		t.Fatalf("current movie = %d, want the second movie %d", id, ms[1].ID)
+	}
+}
+
+func TestHandleElementMsgDanmaku(t *testing.T) {
+	creator := newTestUser(t, "danmaku-creator")
+	room := newTestRoom(t, creator, "danmaku-room")
+	if err := room.AddMovie(creator.NewMovie(dbModel.MovieInfo{BaseMovieInfo: dbModel.BaseMovieInfo{Name: "movie", Url: "http://example.com/movie"}})); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := room.GetAllMoviesByRoomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	danmaku := func(content string, at float64) *recorder {
+		t.Helper()
+		rec := &recorder{}
+		msg := &pb.ElementMessage{
+			Type:    pb.ElementMessageType_DANMAKU,
+			Danmaku: &pb.Danmaku{Content: content, Time: at, Color: "#ffffff"},
+		}
+		if err := handleElementMsg(room, creator, msg, rec.send, rec.broadcast); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	if rec := danmaku("before", 1); len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+		t.Fatalf("danmaku without a movie playing: sent %v, want an error", rec.sent)
+	}
+	if err := room.ChangeCurrentMovie(ms[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if rec := danmaku("unconnected", 1); len(rec.broadcasted) != 0 {
+		t.Fatalf("danmaku without a connection broadcast %v", rec.broadcasted)
+	}
+	if _, err := room.RegClient(creator, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(creator)
+	for _, at := range []float64{30, 10, 20} {
+		rec := danmaku("hello", at)
+		if len(rec.broadcasted) != 1 || rec.broadcasted[0].Danmaku.Time != at {
+			t.Fatalf("broadcast %v, want the danmaku at %v", rec.broadcasted, at)
+		}
+	}
+	if rec := danmaku("over the limit", 40); len(rec.broadcasted) != 0 {
+		t.Fatalf("danmaku over the burst broadcast %v", rec.broadcasted)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/movie/danmaku?id=%d&from=15", ms[0].ID), nil)
+	list := serve(t, Danmaku, req, gin.H{"room": room, "user": creator})["data"].(map[string]any)["danmaku"].([]any)
+	if len(list) != 2 || list[0].(map[string]any)["time"] != 20.0 || list[1].(map[string]any)["time"] != 30.0 {
+		t.Fatalf("danmaku from 15s = %v, want the ones at 20s and 30s in order", list)
+	}
+	if _, ok := list[0].(map[string]any)["createdAt"].(float64); !ok {
+		t.Fatalf("createdAt = %v, want unix milliseconds", list[0].(map[string]any)["createdAt"])
+	}
+
+	time.Sleep(time.Second)
+	op.SetChatFilter(op.NewChatFilter(dbModel.ChatFilter{BlockedWords: []string{"spam"}}))
+	defer op.SetChatFilter(nil)
+	if rec := danmaku("spam", 40); len(rec.broadcasted) != 0 {
+		t.Fatalf("broadcast %v blocked by the chat filter", rec.broadcasted)
+	}
+
+	setting := room.Settings()
+	setting.DisableChat = true
+	if err := room.SetSetting(setting); err != nil {
+		t.Fatal(err)
+	}
+	if rec := danmaku("no chat", 40); len(rec.broadcasted) != 0 {
+		t.Fatalf("broadcast %v with chat disabled", rec.broadcasted)
+	}
+	setting.DisableChat = false
+	setting.DisableDanmaku = true
+	if err := room.SetSetting(setting); err != nil {
+		t.Fatal(err)
+	}
+	if rec := danmaku("disabled", 40); len(rec.broadcasted) != 0 {
+		t.Fatalf("broadcast %v with danmaku disabled", rec.broadcasted)
+	}
+}
+
+func TestHandleElementMsgReaction(t *testing.T) {
+	creator := newTestUser(t, "reaction-creator")
+	room := newTestRoom(t, creator, "reaction-room")
+
+	react := func(reaction string) *recorder {
+		t.Helper()
+		rec := &recorder{}
+		if err := handleElementMsg(room, creator, &pb.ElementMessage{Type: pb.ElementMessageType_REACTION, Reaction: reaction}, rec.send, rec.broadcast); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+	if rec := react("👍"); len(rec.broadcasted) != 0 {
+		t.Fatalf("reaction without a connection broadcast %v", rec.broadcasted)
+	}
+
+	if _, err := room.RegClient(creator, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer room.UnregisterClient(creator)
+	if rec := react("not an emoji"); len(rec.sent) != 1 || rec.sent[0].Type != pb.ElementMessageType_ERROR {
+		t.Fatalf("unknown reaction: sent %v, want an error", rec.sent)
+	}
+	broadcasted := 0
+	for i := 0; i < 10; i++ {
+		broadcasted += len(react("😂").broadcasted)
+	}
+	if broadcasted != 5 {
+		t.Fatalf("broadcast %d of 10 reactions in a burst, want 5", broadcasted)
+	}
+}
@@ -0,0 +1,101 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/metrics"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+var (
+	ErrAPIKeyScope      = errors.New("api key has no scope for this request")
+	ErrAPIKeyNotMember  = errors.New("api keys can only use rooms the user is a member of")
+	ErrAPIKeyNoRoom     = errors.New("api key requests need the X-Room-Id header")
+	errAPIKeyNotAllowed = errors.New("api keys can't make this request")
+)
+
+// apiKeyToken returns the api key of the request, if it is authenticated with one
+func apiKeyToken(ctx *gin.Context) (string, bool) {
+	token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	return token, op.IsAPIKey(token)
+}
+
+// apiKeyScope returns the scope a request needs when it is made with an api
+// key. Requests not listed here, like managing the account or the keys
+// themselves, can't be made with api keys at all.
+func apiKeyScope(ctx *gin.Context) (dbModel.APIKeyScope, bool) {
+	path := ctx.FullPath()
+	read := ctx.Request.Method == http.MethodGet || ctx.Request.Method == http.MethodHead
+	switch {
+	case path == "/api/user/me", path == "/api/user/favorites":
+		if read {
+			return dbModel.ScopeUserRead, true
+		}
+	case strings.HasPrefix(path, "/api/movie/live/"):
+		// publish keys stay with logged in users
+	case strings.HasPrefix(path, "/api/movie/"):
+		if read {
+			return dbModel.ScopeMovieRead, true
+		}
+		return dbModel.ScopeMovieWrite, true
+	case strings.HasPrefix(path, "/api/room/"):
+		if read {
+			return dbModel.ScopeRoomRead, true
+		}
+	}
+	return "", false
+}
+
+// authAPIKey authenticates the request with the api key and checks its
+// scope, the status is the one to answer on error
+func authAPIKey(ctx *gin.Context, key string) (*op.User, *dbModel.APIKey, int, error) {
+	scope, ok := apiKeyScope(ctx)
+	if !ok {
+		return nil, nil, http.StatusForbidden, errAPIKeyNotAllowed
+	}
+	user, k, err := op.AuthAPIKey(key)
+	if err != nil {
+		metrics.AuthFailures.WithLabelValues("api_key").Inc()
+		return nil, nil, AuthErrorStatus(err), err
+	}
+	if !k.HasScope(scope) {
+		return nil, nil, http.StatusForbidden, ErrAPIKeyScope
+	}
+	return user, k, http.StatusOK, nil
+}
+
+// authRoomAPIKey is AuthRoomMiddleware for api keys, the room comes from the
+// X-Room-Id header and the user must already be a member of it
+func authRoomAPIKey(ctx *gin.Context, key string) {
+	user, k, status, err := authAPIKey(ctx, key)
+	if err != nil {
+		ctx.AbortWithStatusJSON(status, model.NewApiErrorResp(err))
+		return
+	}
+	roomID := ctx.GetHeader("X-Room-Id")
+	if roomID == "" {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(ErrAPIKeyNoRoom))
+		return
+	}
+	room, err := op.GetRoomByID(roomID)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+	ur, err := op.GetRoomUserRelation(room.ID, user.ID)
+	// an unsaved default relation has no id
+	if err != nil || ur.ID == 0 || ur.Role == dbModel.RoomRoleBanned {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(ErrAPIKeyNotMember))
+		return
+	}
+
+	ctx.Set("user", user)
+	ctx.Set("room", room)
+	ctx.Set("apikey", k)
+	ctx.Next()
+}
@@ -1,37 +1,83 @@
 package middlewares
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/metrics"
+	dbModel "github.com/synctv-org/synctv/internal/model"
 	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/tracing"
 	"github.com/synctv-org/synctv/server/model"
+	"github.com/synctv-org/synctv/utils"
 	"github.com/zijiren233/stream"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
 	ErrAuthFailed  = errors.New("auth failed")
 	ErrAuthExpired = errors.New("auth expired")
+	ErrAuthRevoked = errors.New("auth revoked")
 )
 
 type AuthClaims struct {
 	UserId uint `json:"u"`
+	// TokenVersion must match the version of the user, see op.User.LogoutAll
+	TokenVersion uint32 `json:"tv,omitempty"`
+	// SessionID is the session the token was issued to, zero for tokens outside of sessions
+	SessionID uint `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
 type AuthRoomClaims struct {
 	AuthClaims
-	RoomId  uint   `json:"r"`
+	RoomId  string `json:"r"`
 	Version uint32 `json:"rv"`
+	// Guest is the username of a guest, who has no stored user
+	Guest string `json:"g,omitempty"`
+}
+
+// UnmarshalJSON also takes the numeric room id of the tokens issued before
+// room ids were strings, those rooms kept their id as a decimal string
+func (c *AuthRoomClaims) UnmarshalJSON(data []byte) error {
+	type claims AuthRoomClaims
+	aux := struct {
+		*claims
+		RoomId legacyRoomID `json:"r"`
+	}{claims: (*claims)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	c.RoomId = string(aux.RoomId)
+	return nil
+}
+
+// legacyRoomID is a room id claim given as a string or a number
+type legacyRoomID string
+
+func (id *legacyRoomID) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		return json.Unmarshal(data, (*string)(id))
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*id = legacyRoomID(n)
+	return nil
 }
 
 func authRoom(Authorization string) (*AuthRoomClaims, error) {
 	t, err := jwt.ParseWithClaims(strings.TrimPrefix(Authorization, `Bearer `), &AuthRoomClaims{}, func(token *jwt.Token) (any, error) {
-		return stream.StringToBytes(conf.Conf.Jwt.Secret), nil
+		return stream.StringToBytes(conf.Conf().Jwt.Secret), nil
 	})
 	if err != nil {
 		return nil, ErrAuthFailed
@@ -40,106 +86,213 @@ func authRoom(Authorization string) (*AuthRoomClaims, error) {
 	if !ok || !t.Valid {
 		return nil, ErrAuthFailed
 	}
+	if op.IsTokenRevoked(claims.ID) || (claims.SessionID != 0 && op.IsSessionRevoked(claims.SessionID)) {
+		return nil, ErrAuthRevoked
+	}
 	return claims, nil
 }
 
+// authUser only accepts user tokens, room tokens are signed with the same
+// secret but live longer and are decoded as room claims to reject them
 func authUser(Authorization string) (*AuthClaims, error) {
-	t, err := jwt.ParseWithClaims(strings.TrimPrefix(Authorization, `Bearer `), &AuthClaims{}, func(token *jwt.Token) (any, error) {
-		return stream.StringToBytes(conf.Conf.Jwt.Secret), nil
-	})
+	claims, err := authRoom(Authorization)
 	if err != nil {
-		return nil, ErrAuthFailed
+		return nil, err
 	}
-	claims, ok := t.Claims.(*AuthClaims)
-	if !ok || !t.Valid {
+	if claims.RoomId != "" {
 		return nil, ErrAuthFailed
 	}
-	return claims, nil
+	return &claims.AuthClaims, nil
 }
 
 func AuthRoom(Authorization string) (*op.User, *op.Room, error) {
+	u, r, _, err := authRoomWithClaims(Authorization)
+	return u, r, err
+}
+
+func authRoomWithClaims(Authorization string) (*op.User, *op.Room, *AuthRoomClaims, error) {
 	claims, err := authRoom(Authorization)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	if claims.RoomId == 0 {
-		return nil, nil, ErrAuthFailed
+	if claims.RoomId == "" {
+		return nil, nil, nil, ErrAuthFailed
 	}
 
 	if claims.UserId == 0 {
-		return nil, nil, ErrAuthFailed
+		return nil, nil, nil, ErrAuthFailed
 	}
 
-	u, err := op.GetUserById(claims.UserId)
-	if err != nil {
-		return nil, nil, err
+	var u *op.User
+	if claims.Guest != "" {
+		u = op.NewGuest(claims.UserId, claims.Guest)
+	} else {
+		u, err = op.GetUserById(claims.UserId)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if u.TokenVersion != claims.TokenVersion {
+			return nil, nil, nil, ErrAuthRevoked
+		}
+		if err := u.CheckBanned(); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := u.CheckApproved(); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
 	r, err := op.GetRoomByID(claims.RoomId)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	if !r.CheckVersion(claims.Version) {
-		return nil, nil, ErrAuthExpired
+		return nil, nil, nil, ErrAuthExpired
+	}
+	if u.IsGuest() {
+		if err := r.CheckGuest(); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
-	return u, r, nil
+	return u, r, claims, nil
 }
 
-func AuthRoomWithPassword(u *op.User, roomId uint, password string) (*op.Room, error) {
-	r, err := op.GetRoomByID(roomId)
+// AuthRoomWithPassword loads the room in ctx and checks that u may join it
+// with password, the bcrypt check gets its own span since it is slow on purpose
+func AuthRoomWithPassword(ctx context.Context, u *op.User, roomId string, password string) (*op.Room, error) {
+	r, err := op.GetRoomByIDContext(ctx, roomId)
 	if err != nil {
 		return nil, err
 	}
-	if !r.CheckPassword(password) {
+	if err := r.CheckWhitelist(u); err != nil {
+		return nil, err
+	}
+	_, span := tracing.Start(ctx, "op.CheckPassword", attribute.String("room_id", roomId))
+	ok := r.CheckPassword(password)
+	span.SetAttributes(attribute.Bool("ok", ok))
+	span.End()
+	if !ok {
 		return nil, ErrAuthFailed
 	}
 	return r, nil
 }
 
 func AuthUser(Authorization string) (*op.User, error) {
+	u, _, err := authUserWithClaims(Authorization)
+	return u, err
+}
+
+func authUserWithClaims(Authorization string) (*op.User, *AuthClaims, error) {
 	claims, err := authUser(Authorization)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if claims.UserId == 0 {
-		return nil, ErrAuthFailed
+		return nil, nil, ErrAuthFailed
 	}
 
 	u, err := op.GetUserById(claims.UserId)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if u.TokenVersion != claims.TokenVersion {
+		return nil, nil, ErrAuthRevoked
+	}
+	if err := u.CheckBanned(); err != nil {
+		return nil, nil, err
 	}
 
-	return u, nil
+	return u, claims, nil
 }
 
 func NewAuthUserToken(user *op.User) (string, error) {
-	t, err := time.ParseDuration(conf.Conf.Jwt.Expire)
+	return NewAuthSessionToken(user, 0)
+}
+
+// NewAuthSessionToken returns a user token of the session, it stops working
+// when the session is logged out
+func NewAuthSessionToken(user *op.User, sessionID uint) (string, error) {
+	t, err := time.ParseDuration(conf.Conf().Jwt.AccessExpire)
 	if err != nil {
 		return "", err
 	}
 	claims := &AuthClaims{
-		UserId: user.ID,
+		UserId:       user.ID,
+		TokenVersion: user.TokenVersion,
+		SessionID:    sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        utils.RandString(16),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(t)),
 		},
 	}
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(stream.StringToBytes(conf.Conf.Jwt.Secret))
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(stream.StringToBytes(conf.Conf().Jwt.Secret))
 }
 
-func NewAuthRoomToken(user *op.User, room *op.Room) (string, error) {
-	t, err := time.ParseDuration(conf.Conf.Jwt.Expire)
+// NewAuthUserTokens starts a session for the device of the request and returns
+// a short lived user token and the refresh token that renews it
+func NewAuthUserTokens(ctx *gin.Context, user *op.User) (gin.H, error) {
+	session, refreshToken, err := user.NewSession(ctx.Request.UserAgent(), ctx.ClientIP())
+	if err != nil {
+		return nil, err
+	}
+	token, err := NewAuthSessionToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":        token,
+		"refreshToken": refreshToken,
+	}, nil
+}
+
+// NewLoginResp returns the response data of a login. Users with two factor
+// authentication get a token for the second login step instead of a login token.
+func NewLoginResp(ctx *gin.Context, user *op.User) (gin.H, error) {
+	if user.TOTPEnabled {
+		token, err := op.NewTwoFactorToken(user)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"twoFactor":      true,
+			"twoFactorToken": token,
+		}, nil
+	}
+	return NewAuthUserTokens(ctx, user)
+}
+
+// sessionID is the session of the token the request was authenticated with
+func sessionID(ctx *gin.Context) uint {
+	if ctx == nil {
+		return 0
+	}
+	if c, ok := ctx.Get("claims"); ok {
+		return c.(*AuthClaims).SessionID
+	}
+	if c, ok := ctx.Get("roomClaims"); ok {
+		return c.(*AuthRoomClaims).SessionID
+	}
+	return 0
+}
+
+// NewAuthRoomToken returns a room token of user, it belongs to the session
+// of the request so logging the session out ends it too
+func NewAuthRoomToken(ctx *gin.Context, user *op.User, room *op.Room) (string, error) {
+	t, err := time.ParseDuration(conf.Conf().Jwt.Expire)
 	if err != nil {
 		return "", err
 	}
 	claims := &AuthRoomClaims{
 		AuthClaims: AuthClaims{
-			UserId: user.ID,
+			UserId:       user.ID,
+			TokenVersion: user.TokenVersion,
+			SessionID:    sessionID(ctx),
 			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        utils.RandString(16),
 				NotBefore: jwt.NewNumericDate(time.Now()),
 				ExpiresAt: jwt.NewNumericDate(time.Now().Add(t)),
 			},
@@ -147,28 +300,106 @@ func NewAuthRoomToken(user *op.User, room *op.Room) (string, error) {
 		RoomId:  room.ID,
 		Version: room.Version(),
 	}
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(stream.StringToBytes(conf.Conf.Jwt.Secret))
+	if user.IsGuest() {
+		claims.Guest = user.Username
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(stream.StringToBytes(conf.Conf().Jwt.Secret))
 }
 
 func AuthRoomMiddleware(ctx *gin.Context) {
-	user, room, err := AuthRoom(ctx.GetHeader("Authorization"))
+	if key, ok := apiKeyToken(ctx); ok {
+		authRoomAPIKey(ctx, key)
+		return
+	}
+	user, room, claims, err := authRoomWithClaims(ctx.GetHeader("Authorization"))
 	if err != nil {
-		ctx.AbortWithStatusJSON(401, model.NewApiErrorResp(err))
+		metrics.AuthFailures.WithLabelValues("token").Inc()
+		ctx.AbortWithStatusJSON(AuthErrorStatus(err), model.NewApiErrorResp(err))
+		return
+	}
+	// guests can only read
+	if user.IsGuest() && ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead {
+		ctx.AbortWithStatusJSON(403, model.NewApiErrorStringResp("guests can only watch"))
 		return
 	}
 
 	ctx.Set("user", user)
 	ctx.Set("room", room)
+	ctx.Set("roomClaims", claims)
 	ctx.Next()
 }
 
 func AuthUserMiddleware(ctx *gin.Context) {
-	user, err := AuthUser(ctx.GetHeader("Authorization"))
+	if key, ok := apiKeyToken(ctx); ok {
+		user, k, status, err := authAPIKey(ctx, key)
+		if err != nil {
+			ctx.AbortWithStatusJSON(status, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.Set("user", user)
+		ctx.Set("apikey", k)
+		ctx.Next()
+		return
+	}
+	user, claims, err := authUserWithClaims(ctx.GetHeader("Authorization"))
 	if err != nil {
-		ctx.AbortWithStatusJSON(401, model.NewApiErrorResp(err))
+		metrics.AuthFailures.WithLabelValues("token").Inc()
+		ctx.AbortWithStatusJSON(AuthErrorStatus(err), model.NewApiErrorResp(err))
 		return
 	}
 
 	ctx.Set("user", user)
+	ctx.Set("claims", claims)
+	ctx.Next()
+}
+
+// ApprovedUserMiddleware follows AuthUserMiddleware on the routes to create
+// or join rooms, which users waiting for approval can't use
+func ApprovedUserMiddleware(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+	if err := user.CheckApproved(); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
 	ctx.Next()
 }
+
+// AuthErrorStatus is the status to answer a failed authentication with,
+// banned and pending users are known but forbidden
+func AuthErrorStatus(err error) int {
+	if errors.Is(err, op.ErrUserBanned) || errors.Is(err, op.ErrUserPending) {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
+
+// AuthRoleMiddleware only lets users with at least the instance role through,
+// admins must have two factor authentication when it is required
+func AuthRoleMiddleware(role dbModel.Role) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, claims, err := authUserWithClaims(ctx.GetHeader("Authorization"))
+		if err != nil {
+			metrics.AuthFailures.WithLabelValues("token").Inc()
+			ctx.AbortWithStatusJSON(AuthErrorStatus(err), model.NewApiErrorResp(err))
+			return
+		}
+		if user.Role < role {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp(role.String()+" required"))
+			return
+		}
+		if conf.Conf().User.AdminRequireTwoFactor && user.IsAdmin() && !user.TOTPEnabled {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("admins must enable two factor authentication"))
+			return
+		}
+
+		ctx.Set("user", user)
+		ctx.Set("claims", claims)
+		ctx.Next()
+	}
+}
+
+// AuthAdminMiddleware guards the admin api, root users are admins too
+var AuthAdminMiddleware = AuthRoleMiddleware(dbModel.RoleAdmin)
+
+// AuthRootMiddleware guards the actions only root users can take, like granting the admin role
+var AuthRootMiddleware = AuthRoleMiddleware(dbModel.RoleRoot)
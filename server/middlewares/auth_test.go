@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/zijiren233/stream"
+)
+
+func TestLegacyRoomIDClaim(t *testing.T) {
+	conf.Set(conf.DefaultConfig())
+	conf.Conf().Jwt.Secret = "secret"
+	sign := func(claims jwt.MapClaims) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(stream.StringToBytes(conf.Conf().Jwt.Secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	for _, r := range []any{42, "42"} {
+		claims, err := authRoom(sign(jwt.MapClaims{"u": 1, "r": r, "rv": 1}))
+		if err != nil {
+			t.Fatalf("room id %#v: %v", r, err)
+		}
+		if claims.RoomId != "42" || claims.UserId != 1 || claims.Version != 1 {
+			t.Fatalf("room id %#v: claims = %+v", r, claims)
+		}
+		invite, err := authInvite(sign(jwt.MapClaims{"i": 3, "r": r}))
+		if err != nil {
+			t.Fatalf("invite room id %#v: %v", r, err)
+		}
+		if invite.RoomId != "42" || invite.InviteId != 3 {
+			t.Fatalf("invite room id %#v: claims = %+v", r, invite)
+		}
+	}
+	if _, err := authRoom(sign(jwt.MapClaims{"u": 1, "r": true})); err == nil {
+		t.Fatal("a room id that is neither a string nor a number was accepted")
+	}
+}
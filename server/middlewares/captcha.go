@@ -0,0 +1,114 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	json "github.com/json-iterator/go"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/requestid"
+	"github.com/synctv-org/synctv/internal/settings"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+// CaptchaHeader carries the captcha token solved by the client
+const CaptchaHeader = "X-Captcha-Token"
+
+var (
+	ErrCaptchaRequired = errors.New("captcha required")
+	ErrCaptchaFailed   = errors.New("captcha verification failed")
+)
+
+// CaptchaVerifier checks a captcha token with its provider
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, secret, token, ip string) error
+}
+
+// CaptchaVerifiers are the verifiers by provider name, see settings.CaptchaProvider
+var CaptchaVerifiers = map[string]CaptchaVerifier{
+	"hcaptcha":  &SiteVerifier{URL: "https://api.hcaptcha.com/siteverify"},
+	"recaptcha": &SiteVerifier{URL: "https://www.google.com/recaptcha/api/siteverify"},
+	"turnstile": &SiteVerifier{URL: "https://challenges.cloudflare.com/turnstile/v0/siteverify"},
+}
+
+// SiteVerifier posts the token to a siteverify endpoint, the api shared by
+// hCaptcha, reCAPTCHA and Turnstile
+type SiteVerifier struct {
+	URL    string
+	Client *http.Client
+}
+
+var captchaClient = &http.Client{Timeout: 10 * time.Second}
+
+func (v *SiteVerifier) Verify(ctx context.Context, secret, token, ip string) error {
+	form := url.Values{
+		"secret":   {secret},
+		"response": {token},
+	}
+	if ip != "" {
+		form.Set("remoteip", ip)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := v.Client
+	if client == nil {
+		client = captchaClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("siteverify: unexpected status %d", resp.StatusCode)
+	}
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %v", ErrCaptchaFailed, result.ErrorCodes)
+	}
+	return nil
+}
+
+// Captcha requires a solved captcha in CaptchaHeader while the provider is
+// set and enabled is true, admins change both at runtime
+func Captcha(enabled *settings.Value[bool]) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		provider := settings.CaptchaProvider.Get()
+		if provider == "" || !enabled.Get() {
+			return
+		}
+		verifier, ok := CaptchaVerifiers[provider]
+		if !ok {
+			requestid.Log(ctx.Request.Context()).Errorf("captcha: no verifier for provider %s", provider)
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorStringResp("captcha unavailable"))
+			return
+		}
+		token := ctx.GetHeader(CaptchaHeader)
+		if token == "" {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(ErrCaptchaRequired))
+			return
+		}
+		if err := verifier.Verify(ctx.Request.Context(), conf.Conf().Captcha.Secret, token, ctx.ClientIP()); err != nil {
+			if !errors.Is(err, ErrCaptchaFailed) {
+				requestid.Log(ctx.Request.Context()).Errorf("captcha: %v", err)
+			}
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(ErrCaptchaFailed))
+			return
+		}
+	}
+}
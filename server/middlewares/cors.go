@@ -1,14 +1,57 @@
 package middlewares
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
 )
 
-func NewCors() gin.HandlerFunc {
-	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
-	config.AllowHeaders = []string{"*"}
-	config.AllowMethods = []string{"*"}
-	return cors.New(config)
+// NewCors allows the origins of the config to call the api, without any the
+// browsers keep the api to the pages of the instance
+func NewCors() (gin.HandlerFunc, error) {
+	c := conf.Conf().Cors
+	if len(c.AllowOrigins) == 0 {
+		return func(ctx *gin.Context) {}, nil
+	}
+	maxAge, err := time.ParseDuration(c.MaxAge)
+	if err != nil {
+		return nil, err
+	}
+	config := cors.Config{
+		AllowMethods: []string{
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+			http.MethodHead,
+			http.MethodOptions,
+		},
+		AllowHeaders: []string{
+			"Origin",
+			"Content-Type",
+			"Authorization",
+			"X-Room-Id",
+			CaptchaHeader,
+		},
+		ExposeHeaders:    []string{RequestIDHeader, "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
+		AllowCredentials: c.AllowCredentials,
+		AllowWildcard:    true,
+		MaxAge:           maxAge,
+	}
+	for _, origin := range c.AllowOrigins {
+		if origin == "*" {
+			config.AllowAllOrigins = true
+			config.AllowCredentials = false
+			return cors.New(config), nil
+		}
+	}
+	config.AllowOrigins = c.AllowOrigins
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return cors.New(config), nil
 }
@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+)
+
+func TestCors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conf.Set(conf.DefaultConfig())
+	newRouter := func(origins []string, credentials bool) *gin.Engine {
+		t.Helper()
+		conf.Conf().Cors.AllowOrigins = origins
+		conf.Conf().Cors.AllowCredentials = credentials
+		cors, err := NewCors()
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := gin.New()
+		e.Use(cors)
+		e.GET("/api", func(ctx *gin.Context) {
+			ctx.Status(http.StatusNoContent)
+		})
+		return e
+	}
+	get := func(e *gin.Engine, origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://synctv.example/api", nil)
+		req.Header.Set("Origin", origin)
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	e := newRouter([]string{"https://app.example", "https://*.friends.example"}, true)
+	for _, c := range []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example", true},
+		{"https://watch.friends.example", true},
+		{"http://app.example", false},
+		{"https://evil.example", false},
+		{"https://app.example.evil.example", false},
+	} {
+		w := get(e, c.origin)
+		got := w.Header().Get("Access-Control-Allow-Origin")
+		if c.allowed && (w.Code != http.StatusNoContent || got != c.origin || w.Header().Get("Access-Control-Allow-Credentials") != "true") {
+			t.Errorf("%s: status = %d, headers = %v, want it allowed with credentials", c.origin, w.Code, w.Header())
+		}
+		if !c.allowed && (w.Code != http.StatusForbidden || got != "") {
+			t.Errorf("%s: status = %d, allowed origin = %q, want 403", c.origin, w.Code, got)
+		}
+	}
+
+	// any origin never gets the credentials
+	e = newRouter([]string{"*"}, true)
+	w := get(e, "https://any.example")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("*: status = %d, headers = %v, want any origin without credentials", w.Code, w.Header())
+	}
+
+	// without origins the browsers keep the api to the pages of the instance
+	e = newRouter(nil, false)
+	w = get(e, "https://any.example")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("no origins: status = %d, headers = %v, want no cors headers", w.Code, w.Header())
+	}
+}
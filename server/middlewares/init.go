@@ -1,33 +1,43 @@
 package middlewares
 
 import (
-	"time"
-
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"github.com/synctv-org/synctv/internal/conf"
-	limiter "github.com/ulule/limiter/v3"
 )
 
 func Init(e *gin.Engine) {
-	w := log.StandardLogger().Writer()
-	e.
-		Use(gin.LoggerWithWriter(w), gin.RecoveryWithWriter(w)).
-		Use(NewCors())
-	if conf.Conf.RateLimit.Enable {
-		d, err := time.ParseDuration(conf.Conf.RateLimit.Period)
-		if err != nil {
-			log.Fatal(err)
-		}
-		options := []limiter.Option{
-			limiter.WithTrustForwardHeader(conf.Conf.RateLimit.TrustForwardHeader),
+	if err := SetClientIP(e); err != nil {
+		log.Fatal(err)
+	}
+	e.Use(RequestID, Tracing, Logger, gin.RecoveryWithWriter(log.StandardLogger().Writer()))
+	ipFilter, err := NewIPFilter(conf.Conf().Server.AllowIPs, conf.Conf().Server.DenyIPs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if ipFilter != nil {
+		e.Use(ipFilter)
+	}
+	cors, err := NewCors()
+	if err != nil {
+		log.Fatalf("cors: %v", err)
+	}
+	e.Use(cors)
+	if err := initRateLimit(conf.Conf().RateLimit); err != nil {
+		log.Fatal(err)
+	}
+	conf.OnReload("rate_limit", func(old, new *conf.Config) error {
+		if new.RateLimit == old.RateLimit {
+			return nil
 		}
-		if conf.Conf.RateLimit.TrustedClientIPHeader != "" {
-			options = append(options, limiter.WithClientIPHeader(conf.Conf.RateLimit.TrustedClientIPHeader))
+		if err := initRateLimit(new.RateLimit); err != nil {
+			new.RateLimit = old.RateLimit
+			return err
 		}
-		e.Use(NewLimiter(d, conf.Conf.RateLimit.Limit, options...))
-	}
-	if conf.Conf.Server.Quic && conf.Conf.Server.CertPath != "" && conf.Conf.Server.KeyPath != "" {
+		return nil
+	})
+	e.Use(IPRateLimit)
+	if conf.Conf().Server.Quic && conf.Conf().Server.CertPath != "" && conf.Conf().Server.KeyPath != "" {
 		e.Use(NewQuic())
 	}
 }
@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/zijiren233/stream"
+)
+
+type InviteClaims struct {
+	InviteId uint   `json:"i"`
+	RoomId   string `json:"r"`
+	jwt.RegisteredClaims
+}
+
+// UnmarshalJSON also takes the numeric room id of the invites issued before
+// room ids were strings, see AuthRoomClaims.UnmarshalJSON
+func (c *InviteClaims) UnmarshalJSON(data []byte) error {
+	type claims InviteClaims
+	aux := struct {
+		*claims
+		RoomId legacyRoomID `json:"r"`
+	}{claims: (*claims)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	c.RoomId = string(aux.RoomId)
+	return nil
+}
+
+func NewInviteToken(invite *model.RoomInvite) (string, error) {
+	claims := &InviteClaims{
+		InviteId: invite.ID,
+		RoomId:   invite.RoomID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			NotBefore: jwt.NewNumericDate(invite.CreatedAt),
+			ExpiresAt: jwt.NewNumericDate(invite.ExpiresAt),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(stream.StringToBytes(conf.Conf().Jwt.Secret))
+}
+
+func authInvite(token string) (*InviteClaims, error) {
+	t, err := jwt.ParseWithClaims(strings.TrimPrefix(token, `Bearer `), &InviteClaims{}, func(token *jwt.Token) (any, error) {
+		return stream.StringToBytes(conf.Conf().Jwt.Secret), nil
+	})
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	claims, ok := t.Claims.(*InviteClaims)
+	if !ok || !t.Valid || claims.InviteId == 0 {
+		return nil, ErrAuthFailed
+	}
+	return claims, nil
+}
+
+// AuthInvite validates the invite token and joins the user to the invited room,
+// the expiry and use count are checked against the stored invite
+func AuthInvite(u *op.User, token string) (*op.Room, error) {
+	claims, err := authInvite(token)
+	if err != nil {
+		return nil, err
+	}
+	return u.JoinWithInvite(claims.InviteId)
+}
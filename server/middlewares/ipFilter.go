@@ -0,0 +1,99 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+var ErrIPDenied = errors.New("your ip is not allowed to access this server")
+
+// parseIPNets parses ips and cidrs, an ip is a network of itself
+func parseIPNets(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %s", s)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewIPFilter refuses the clients in deny, and the ones not in allow unless
+// it is empty, it runs after SetClientIP so the client behind a proxy is checked
+func NewIPFilter(allow, deny []string) (gin.HandlerFunc, error) {
+	allowNets, err := parseIPNets(allow)
+	if err != nil {
+		return nil, fmt.Errorf("allow ips: %w", err)
+	}
+	denyNets, err := parseIPNets(deny)
+	if err != nil {
+		return nil, fmt.Errorf("deny ips: %w", err)
+	}
+	if len(allowNets) == 0 && len(denyNets) == 0 {
+		return nil, nil
+	}
+	return func(ctx *gin.Context) {
+		ip := net.ParseIP(ctx.ClientIP())
+		if ip == nil ||
+			containsIP(denyNets, ip) ||
+			(len(allowNets) != 0 && !containsIP(allowNets, ip)) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(ErrIPDenied))
+			return
+		}
+	}, nil
+}
+
+// SetClientIP makes gin read the client ip from the forward headers only for
+// the requests of the trusted proxies, gin trusts every proxy by default
+func SetClientIP(e *gin.Engine) error {
+	c := conf.Conf().Server
+	proxies := c.TrustedProxies
+	rl := conf.Conf().RateLimit
+	if len(proxies) == 0 && rl.TrustForwardHeader {
+		log.Warn("rate_limit.trust_forward_header is deprecated and trusts the forward headers of anyone, set server.trusted_proxies instead")
+		proxies = []string{"0.0.0.0/0", "::/0"}
+	}
+	if err := e.SetTrustedProxies(proxies); err != nil {
+		return fmt.Errorf("trusted proxies: %w", err)
+	}
+	e.RemoteIPHeaders = c.RemoteIPHeaders
+	if rl.TrustedClientIPHeader != "" {
+		log.Warn("rate_limit.trusted_client_ip_header is deprecated, set server.trusted_proxies instead")
+		e.TrustedPlatform = rl.TrustedClientIPHeader
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+)
+
+func TestIPFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conf.Set(conf.DefaultConfig())
+	conf.Conf().Server.TrustedProxies = []string{"10.0.0.1"}
+
+	e := gin.New()
+	if err := SetClientIP(e); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := NewIPFilter([]string{"192.0.2.0/24", "2001:db8::1"}, []string{"192.0.2.66"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Use(filter)
+	e.GET("/", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, ctx.ClientIP())
+	})
+	get := func(remote, forwarded string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	for _, c := range []struct {
+		remote, forwarded string
+		code              int
+		ip                string
+	}{
+		{"192.0.2.5:1000", "", http.StatusOK, "192.0.2.5"},
+		{"[2001:db8::1]:1000", "", http.StatusOK, "2001:db8::1"},
+		{"192.0.2.66:1000", "", http.StatusForbidden, ""},
+		{"198.51.100.1:1000", "", http.StatusForbidden, ""},
+		// the header of an untrusted client is ignored
+		{"198.51.100.1:1000", "192.0.2.5", http.StatusForbidden, ""},
+		// the trusted proxy forwards the real client
+		{"10.0.0.1:1000", "192.0.2.5", http.StatusOK, "192.0.2.5"},
+		{"10.0.0.1:1000", "192.0.2.66", http.StatusForbidden, ""},
+	} {
+		code, ip := get(c.remote, c.forwarded)
+		if code != c.code || (code == http.StatusOK && ip != c.ip) {
+			t.Errorf("%s forwarding %q: %d %s, want %d %s", c.remote, c.forwarded, code, ip, c.code, c.ip)
+		}
+	}
+
+	if _, err := NewIPFilter([]string{"not an ip"}, nil); err == nil {
+		t.Fatal("invalid ip accepted")
+	}
+}
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/server/model"
+)
+
+// MetricsAuth lets scrapers through with the token of the config, or anyone
+// when it has none
+func MetricsAuth(ctx *gin.Context) {
+	token := conf.Conf().Metrics.Token
+	if token == "" {
+		return
+	}
+	got := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, model.NewApiErrorResp(ErrAuthFailed))
+		return
+	}
+}
@@ -1,22 +1,199 @@
 package middlewares
 
 import (
+	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	libredis "github.com/redis/go-redis/v9"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/requestid"
 	"github.com/synctv-org/synctv/server/model"
 	limiter "github.com/ulule/limiter/v3"
 	mgin "github.com/ulule/limiter/v3/drivers/middleware/gin"
 	"github.com/ulule/limiter/v3/drivers/store/memory"
+	"github.com/ulule/limiter/v3/drivers/store/redis"
 )
 
-func NewLimiter(Period time.Duration, Limit int64, options ...limiter.Option) gin.HandlerFunc {
-	limit := limiter.New(memory.NewStore(), limiter.Rate{
-		Period: Period,
-		Limit:  Limit,
+// rateLimiters are the limiters of the rate limit config, swapped as a
+// whole when it is reloaded
+type rateLimiters struct {
+	// ip, login and user are nil when disabled
+	ip, login, user gin.HandlerFunc
+	redis           *libredis.Client
+}
+
+var limiters atomic.Pointer[rateLimiters]
+
+// memoryStores are the memory stores of the limiters by name, a reload
+// keeps them so the counts carry over instead of piling up new stores
+var (
+	memoryStoresLock sync.Mutex
+	memoryStores     = map[string]limiter.Store{}
+)
+
+// LimitKey returns the key of the request in a limiter
+type LimitKey func(ctx *gin.Context, l *limiter.Limiter) string
+
+// IPLimitKey is the client ip, read from the headers of the trusted proxies
+func IPLimitKey(ctx *gin.Context, l *limiter.Limiter) string {
+	return ctx.ClientIP()
+}
+
+// UserLimitKey is the id of the signed in user, or the client ip for guests
+func UserLimitKey(ctx *gin.Context, l *limiter.Limiter) string {
+	if u, ok := ctx.Get("user"); ok {
+		if user := u.(*op.User); !user.IsGuest() {
+			return fmt.Sprint(user.ID)
+		}
+	}
+	return "guest:" + ctx.ClientIP()
+}
+
+func NewLimiter(store limiter.Store, period time.Duration, limit int64, key LimitKey, options ...limiter.Option) gin.HandlerFunc {
+	l := limiter.New(store, limiter.Rate{
+		Period: period,
+		Limit:  limit,
 	}, options...)
-	return mgin.NewMiddleware(limit, mgin.WithLimitReachedHandler(func(c *gin.Context) {
-		c.JSON(http.StatusTooManyRequests, model.NewApiErrorStringResp("too many requests"))
-	}))
+	return mgin.NewMiddleware(l,
+		mgin.WithKeyGetter(func(ctx *gin.Context) string {
+			return key(ctx, l)
+		}),
+		mgin.WithLimitReachedHandler(func(c *gin.Context) {
+			c.JSON(http.StatusTooManyRequests, model.NewApiErrorStringResp("too many requests"))
+		}),
+		mgin.WithErrorHandler(func(c *gin.Context, err error) {
+			requestid.Log(c.Request.Context()).Errorf("rate limit: %v", err)
+			c.JSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		}),
+	)
+}
+
+// IPRateLimit limits every request of each ip
+func IPRateLimit(ctx *gin.Context) {
+	if l := limiters.Load(); l != nil && l.ip != nil {
+		l.ip(ctx)
+	}
+}
+
+// LoginRateLimit limits the requests of each ip to the endpoints checking
+// credentials, which are more attractive to brute force than the others
+func LoginRateLimit(ctx *gin.Context) {
+	if l := limiters.Load(); l != nil && l.login != nil {
+		l.login(ctx)
+	}
+}
+
+// UserRateLimit limits the requests of each signed in user, it runs after the
+// auth middlewares so it knows the user
+func UserRateLimit(ctx *gin.Context) {
+	if l := limiters.Load(); l != nil && l.user != nil {
+		l.user(ctx)
+	}
+}
+
+// newLimitStore returns the store of the limiter named prefix, in redis when
+// configured so the limits hold across instances
+func newLimitStore(client *libredis.Client, prefix string) (limiter.Store, error) {
+	options := limiter.StoreOptions{
+		Prefix:          "synctv:limit:" + prefix,
+		CleanUpInterval: limiter.DefaultCleanUpInterval,
+	}
+	if client != nil {
+		return redis.NewStoreWithOptions(client, options)
+	}
+	memoryStoresLock.Lock()
+	defer memoryStoresLock.Unlock()
+	store, ok := memoryStores[prefix]
+	if !ok {
+		store = memory.NewStoreWithOptions(options)
+		memoryStores[prefix] = store
+	}
+	return store, nil
+}
+
+// dropMemoryStores forgets the memory stores not used by l, they are
+// released once the requests still using them are done
+func dropMemoryStores(l *rateLimiters) {
+	memoryStoresLock.Lock()
+	defer memoryStoresLock.Unlock()
+	for name := range memoryStores {
+		if l.redis != nil || !l.uses(name) {
+			delete(memoryStores, name)
+		}
+	}
+}
+
+// initRateLimit sets the limiters of c, the previous ones keep serving the
+// requests that already use them. The memory limits keep their counts.
+func initRateLimit(c conf.RateLimitConfig) error {
+	l := &rateLimiters{}
+	if !c.Enable {
+		swapRateLimiters(l)
+		dropMemoryStores(l)
+		return nil
+	}
+	if c.Redis != "" {
+		opt, err := libredis.ParseURL(c.Redis)
+		if err != nil {
+			return fmt.Errorf("rate limit redis: %w", err)
+		}
+		l.redis = libredis.NewClient(opt)
+	}
+
+	newLimiter := func(name, period string, limit int64, key LimitKey) (gin.HandlerFunc, error) {
+		if limit <= 0 {
+			return nil, nil
+		}
+		d, err := time.ParseDuration(period)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %s period: %w", name, err)
+		}
+		store, err := newLimitStore(l.redis, name)
+		if err != nil {
+			return nil, err
+		}
+		return NewLimiter(store, d, limit, key), nil
+	}
+
+	var err error
+	if l.ip, err = newLimiter("ip", c.Period, c.Limit, IPLimitKey); err == nil {
+		if l.login, err = newLimiter("login", c.LoginPeriod, c.LoginLimit, IPLimitKey); err == nil {
+			l.user, err = newLimiter("user", c.UserPeriod, c.UserLimit, UserLimitKey)
+		}
+	}
+	if err != nil {
+		if l.redis != nil {
+			l.redis.Close()
+		}
+		return err
+	}
+	swapRateLimiters(l)
+	dropMemoryStores(l)
+	return nil
+}
+
+func (l *rateLimiters) uses(name string) bool {
+	switch name {
+	case "ip":
+		return l.ip != nil
+	case "login":
+		return l.login != nil
+	case "user":
+		return l.user != nil
+	}
+	return false
+}
+
+func swapRateLimiters(l *rateLimiters) {
+	if old := limiters.Swap(l); old != nil && old.redis != nil {
+		// once the requests using it are done
+		time.AfterFunc(time.Minute, func() {
+			old.redis.Close()
+		})
+	}
 }
@@ -0,0 +1,139 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"gorm.io/gorm"
+)
+
+func TestRateLimitRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := conf.DefaultRateLimitConfig()
+	c.Enable = true
+	c.Limit = 4
+	c.LoginLimit = 1
+	c.UserLimit = 2
+	if err := initRateLimit(c); err != nil {
+		t.Fatal(err)
+	}
+	defer initRateLimit(conf.DefaultRateLimitConfig())
+
+	users := map[string]*op.User{
+		"alice": {User: model.User{Model: gorm.Model{ID: 1}}},
+		"bob":   {User: model.User{Model: gorm.Model{ID: 2}}},
+		"guest": op.NewGuest(op.NewGuestID(), "guest"),
+	}
+	e := gin.New()
+	e.Use(IPRateLimit)
+	ok := func(ctx *gin.Context) {
+		ctx.Status(http.StatusNoContent)
+	}
+	e.POST("/login", LoginRateLimit, ok)
+	e.GET("/me", func(ctx *gin.Context) {
+		if u, ok := users[ctx.Query("user")]; ok {
+			ctx.Set("user", u)
+		}
+	}, UserRateLimit, ok)
+	do := func(method, path, ip string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, r := range []struct {
+		method, path, ip string
+		want             int
+	}{
+		// the login limit is per ip and only on the login routes
+		{http.MethodPost, "/login", "192.0.2.1", http.StatusNoContent},
+		{http.MethodPost, "/login", "192.0.2.1", http.StatusTooManyRequests},
+		{http.MethodPost, "/login", "192.0.2.2", http.StatusNoContent},
+		// the user limit is per user, whatever the ip
+		{http.MethodGet, "/me?user=alice", "192.0.2.3", http.StatusNoContent},
+		{http.MethodGet, "/me?user=alice", "192.0.2.4", http.StatusNoContent},
+		{http.MethodGet, "/me?user=alice", "192.0.2.5", http.StatusTooManyRequests},
+		{http.MethodGet, "/me?user=bob", "192.0.2.3", http.StatusNoContent},
+		// guests are limited by ip
+		{http.MethodGet, "/me?user=guest", "192.0.2.6", http.StatusNoContent},
+		{http.MethodGet, "/me?user=guest", "192.0.2.6", http.StatusNoContent},
+		{http.MethodGet, "/me?user=guest", "192.0.2.6", http.StatusTooManyRequests},
+		{http.MethodGet, "/me?user=guest", "192.0.2.7", http.StatusNoContent},
+		// the ip limit counts every request of the ip, 192.0.2.3 made two
+		{http.MethodGet, "/me", "192.0.2.3", http.StatusNoContent},
+		{http.MethodGet, "/me", "192.0.2.3", http.StatusNoContent},
+		{http.MethodGet, "/me", "192.0.2.3", http.StatusTooManyRequests},
+	} {
+		if code := do(r.method, r.path, r.ip); code != r.want {
+			t.Fatalf("%s %s from %s: status = %d, want %d", r.method, r.path, r.ip, code, r.want)
+		}
+	}
+
+	// a reload disabling a limit lifts it, the others keep their counts
+	c.LoginLimit = 0
+	if err := initRateLimit(c); err != nil {
+		t.Fatal(err)
+	}
+	if code := do(http.MethodPost, "/login", "192.0.2.1"); code != http.StatusNoContent {
+		t.Fatalf("login after disabling its limit: status = %d, want 204", code)
+	}
+	if _, ok := memoryStores["login"]; ok {
+		t.Fatal("the memory store of the disabled login limit was kept")
+	}
+	if code := do(http.MethodGet, "/me?user=alice", "192.0.2.8"); code != http.StatusTooManyRequests {
+		t.Fatalf("user limit after the reload: status = %d, want the count kept", code)
+	}
+}
+
+func TestRateLimitReload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := conf.DefaultRateLimitConfig()
+	c.Enable = true
+	c.LoginLimit = 2
+	defer initRateLimit(conf.DefaultRateLimitConfig())
+
+	e := gin.New()
+	e.POST("/login", LoginRateLimit, func(ctx *gin.Context) {
+		ctx.Status(http.StatusNoContent)
+	})
+	login := func() int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if err := initRateLimit(c); err != nil {
+		t.Fatal(err)
+	}
+	store := memoryStores["login"]
+	login()
+	if err := initRateLimit(c); err != nil {
+		t.Fatal(err)
+	}
+	if memoryStores["login"] != store {
+		t.Fatal("the reload replaced the memory store")
+	}
+	if code := login(); code != http.StatusNoContent {
+		t.Fatalf("second login: status = %d, want 204", code)
+	}
+	if code := login(); code != http.StatusTooManyRequests {
+		t.Fatalf("third login: status = %d, want the count kept over the reload", code)
+	}
+
+	c.Enable = false
+	if err := initRateLimit(c); err != nil {
+		t.Fatal(err)
+	}
+	if len(memoryStores) != 0 {
+		t.Fatalf("%d memory stores kept after disabling the limits", len(memoryStores))
+	}
+}
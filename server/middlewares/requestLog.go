@@ -0,0 +1,70 @@
+package middlewares
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/requestid"
+)
+
+// RequestIDHeader carries the request id in both directions, a valid id sent
+// by a proxy in front of the server is kept so their logs match
+const RequestIDHeader = "X-Request-Id"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID gives every request an id, stored in the context of the request
+// and returned in RequestIDHeader for support to find the logs of a request
+func RequestID(ctx *gin.Context) {
+	id := ctx.GetHeader(RequestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = requestid.New()
+	}
+	ctx.Request = ctx.Request.WithContext(requestid.WithID(ctx.Request.Context(), id))
+	ctx.Set("requestID", id)
+	ctx.Header(RequestIDHeader, id)
+	ctx.Next()
+}
+
+// probePaths are polled by orchestrators, their successes are only logged
+// at debug level to keep them from flooding the logs
+var probePaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// Logger logs each request as structured fields after it is handled, the
+// query is left out since it can carry tokens
+func Logger(ctx *gin.Context) {
+	start := time.Now()
+	ctx.Next()
+
+	fields := log.Fields{
+		"status":     ctx.Writer.Status(),
+		"method":     ctx.Request.Method,
+		"path":       ctx.Request.URL.Path,
+		"latency_ms": time.Since(start).Milliseconds(),
+		"client_ip":  ctx.ClientIP(),
+		"size":       ctx.Writer.Size(),
+	}
+	if u, ok := ctx.Get("user"); ok {
+		fields["user_id"] = u.(*op.User).ID
+	}
+	if len(ctx.Errors) != 0 {
+		fields["errors"] = ctx.Errors.String()
+	}
+	entry := requestid.Log(ctx.Request.Context()).WithFields(fields)
+	switch status := ctx.Writer.Status(); {
+	case status >= 500:
+		entry.Error("request")
+	case status >= 400:
+		entry.Warn("request")
+	case probePaths[ctx.Request.URL.Path]:
+		entry.Debug("request")
+	default:
+		entry.Info("request")
+	}
+}
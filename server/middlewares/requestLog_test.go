@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/synctv-org/synctv/internal/requestid"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := test.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+
+	e := gin.New()
+	e.Use(RequestID, Logger)
+	var handled string
+	e.GET("/", func(ctx *gin.Context) {
+		handled = requestid.FromContext(ctx.Request.Context())
+		ctx.Status(http.StatusNoContent)
+	})
+	get := func(id string) string {
+		hook.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/?token=secret", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		got := w.Header().Get(RequestIDHeader)
+		if got == "" || got != handled {
+			t.Fatalf("response id %q, context id %q, want the same id", got, handled)
+		}
+		entry := hook.LastEntry()
+		if entry == nil || entry.Data[requestid.Field] != got || entry.Data["path"] != "/" || entry.Data["status"] != http.StatusNoContent {
+			t.Fatalf("log entry = %+v", entry)
+		}
+		return got
+	}
+
+	if id := get(""); id == get("") {
+		t.Fatal("two requests got the same id")
+	}
+	if id := get("proxy-id.1"); id != "proxy-id.1" {
+		t.Fatalf("id = %q, want the id of the proxy", id)
+	}
+	if id := get("bad id\nwith newline"); id == "bad id\nwith newline" {
+		t.Fatal("invalid id kept")
+	}
+}
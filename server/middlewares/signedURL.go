@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/op"
+)
+
+var ErrInvalidSignature = errors.New("invalid or expired signature")
+
+// signedURLExpire is the lifetime of signed proxy urls, zero when they are disabled
+func signedURLExpire() (time.Duration, error) {
+	if conf.Conf().Proxy.SignedURLExpire == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(conf.Conf().Proxy.SignedURLExpire)
+}
+
+// proxySignature signs the movie of the room for the room token tokenID of
+// the session until expires. The room version and the token version of the
+// user are signed too, so changing the password or logging out ends it.
+func proxySignature(room *op.Room, pullKey, tokenID string, userID, sessionID uint, tokenVersion uint32, expires int64) string {
+	mac := hmac.New(sha256.New, []byte("proxy:"+conf.Conf().Jwt.Secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d\n%d\n%d\n%d\n%d", room.ID, pullKey, tokenID, userID, sessionID, tokenVersion, room.Version(), expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignProxyURL returns the proxy url of the movie for the request, it stops
+// working when it expires or when the room token of the request does, the
+// time is zero when urls are not signed. Requests made with api keys have
+// no token, their urls only expire.
+func SignProxyURL(ctx *gin.Context, room *op.Room, pullKey string) (string, time.Time, error) {
+	path := fmt.Sprintf("/api/movie/proxy/%s/%s", url.PathEscape(room.ID), url.PathEscape(pullKey))
+	ttl, err := signedURLExpire()
+	if err != nil || ttl <= 0 {
+		return path, time.Time{}, err
+	}
+	expiresAt := time.Now().Add(ttl)
+	var (
+		tokenID      string
+		userID       uint
+		sessionID    uint
+		tokenVersion uint32
+	)
+	if c, ok := ctx.Get("roomClaims"); ok {
+		claims := c.(*AuthRoomClaims)
+		tokenID = claims.ID
+		sessionID = claims.SessionID
+		if claims.ExpiresAt != nil && claims.ExpiresAt.Before(expiresAt) {
+			expiresAt = claims.ExpiresAt.Time
+		}
+	}
+	// guests have no stored user to log out
+	if u, ok := ctx.Get("user"); ok && !u.(*op.User).IsGuest() {
+		userID = u.(*op.User).ID
+		tokenVersion = u.(*op.User).TokenVersion
+	}
+	expires := expiresAt.Unix()
+	query := url.Values{
+		"e":   {strconv.FormatInt(expires, 10)},
+		"t":   {tokenID},
+		"u":   {strconv.FormatUint(uint64(userID), 10)},
+		"sid": {strconv.FormatUint(uint64(sessionID), 10)},
+		"s":   {proxySignature(room, pullKey, tokenID, userID, sessionID, tokenVersion, expires)},
+	}
+	return path + "?" + query.Encode(), time.Unix(expires, 0), nil
+}
+
+// VerifyProxyURL returns ErrInvalidSignature unless the request has a valid
+// signature from SignProxyURL, or signing is disabled
+func VerifyProxyURL(ctx *gin.Context, room *op.Room, pullKey string) error {
+	ttl, err := signedURLExpire()
+	if err != nil || ttl <= 0 {
+		return err
+	}
+	expires, err := strconv.ParseInt(ctx.Query("e"), 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return ErrInvalidSignature
+	}
+	userID, err := strconv.ParseUint(ctx.Query("u"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	sessionID, err := strconv.ParseUint(ctx.Query("sid"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	var tokenVersion uint32
+	if userID != 0 {
+		u, err := op.GetUserById(uint(userID))
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		tokenVersion = u.TokenVersion
+	}
+	tokenID := ctx.Query("t")
+	if !hmac.Equal([]byte(ctx.Query("s")), []byte(proxySignature(room, pullKey, tokenID, uint(userID), uint(sessionID), tokenVersion, expires))) {
+		return ErrInvalidSignature
+	}
+	if tokenID != "" && op.IsTokenRevoked(tokenID) {
+		return ErrInvalidSignature
+	}
+	if sessionID != 0 && op.IsSessionRevoked(uint(sessionID)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/requestid"
+	"github.com/synctv-org/synctv/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for each request, child of the trace of the
+// client if it sent one, it runs after RequestID so both can be matched
+func Tracing(ctx *gin.Context) {
+	reqCtx := otel.GetTextMapPropagator().Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+	route := ctx.FullPath()
+	name := ctx.Request.Method + " " + route
+	if route == "" {
+		name = ctx.Request.Method
+	}
+	reqCtx, span := tracing.StartKind(reqCtx, name, trace.SpanKindServer,
+		attribute.String("http.method", ctx.Request.Method),
+		attribute.String("http.route", route),
+		attribute.String("request_id", requestid.FromContext(reqCtx)),
+	)
+	defer span.End()
+	ctx.Request = ctx.Request.WithContext(reqCtx)
+	ctx.Next()
+
+	status := ctx.Writer.Status()
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if u, ok := ctx.Get("user"); ok {
+		span.SetAttributes(attribute.Int64("user_id", int64(u.(*op.User).ID)))
+	}
+	if status >= 500 {
+		span.SetStatus(codes.Error, ctx.Errors.String())
+	}
+}
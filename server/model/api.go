@@ -5,6 +5,8 @@ import (
 )
 
 type ApiResp struct {
+	// Time is the server time in unix microseconds, unlike the other
+	// timestamps, since clients already sync their clock with it
 	Time  int64  `json:"time"`
 	Error string `json:"error,omitempty"`
 	Data  any    `json:"data,omitempty"`
@@ -0,0 +1,22 @@
+package model
+
+type DebugStatsResp struct {
+	Goroutines int `json:"goroutines"`
+	// HeapAlloc and HeapInuse are in bytes
+	HeapAlloc   uint64                `json:"heapAlloc"`
+	HeapInuse   uint64                `json:"heapInuse"`
+	HeapObjects uint64                `json:"heapObjects"`
+	Sys         uint64                `json:"sys"`
+	NumGC       uint32                `json:"numGC"`
+	LastGC      int64                 `json:"lastGC"`
+	Rooms       []*RoomDebugStatsResp `json:"rooms"`
+}
+
+type RoomDebugStatsResp struct {
+	RoomId         string `json:"roomId"`
+	Clients        int64  `json:"clients"`
+	Channels       int64  `json:"channels"`
+	BroadcastQueue int    `json:"broadcastQueue"`
+	// MaxClientQueue is the longest send queue of the clients of the room
+	MaxClientQueue int `json:"maxClientQueue"`
+}
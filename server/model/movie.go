@@ -2,6 +2,9 @@ package model
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	json "github.com/json-iterator/go"
@@ -13,10 +16,15 @@ var (
 	ErrEmptyName   = errors.New("empty name")
 	ErrNameTooLong = errors.New("name too long")
 	ErrTypeTooLong = errors.New("type too long")
+	ErrFolderMedia = errors.New("folders can't have media")
+
+	ErrTooManyHeaders = fmt.Errorf("a movie can have at most %d headers", maxMovieHeaders)
 
 	ErrId = errors.New("id must be greater than 0")
 
 	ErrEmptyIds = errors.New("empty ids")
+
+	ErrInvalidPlayMode = errors.New("play mode must be order, shuffle, repeat-one or repeat-all")
 )
 
 type PushMovieReq model.BaseMovieInfo
@@ -40,9 +48,69 @@ func (p *PushMovieReq) Validate() error {
 		return ErrTypeTooLong
 	}
 
+	if p.Folder && (p.Url != "" || p.Live || p.Proxy || p.RtmpSource) {
+		return ErrFolderMedia
+	}
+
+	headers, err := normalizeHeaders(p.Headers)
+	if err != nil {
+		return err
+	}
+	p.Headers = headers
+
 	return nil
 }
 
+const maxMovieHeaders = 32
+
+// reservedHeaders are set by the proxy for each request and can't be overridden by a movie
+var reservedHeaders = map[string]struct{}{
+	"Host":              {},
+	"Connection":        {},
+	"Content-Length":    {},
+	"Transfer-Encoding": {},
+	"Range":             {},
+}
+
+// normalizeHeaders canonicalizes the header names of a movie and rejects
+// headers that can't be sent, such as values with line breaks
+func normalizeHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	if len(headers) > maxMovieHeaders {
+		return nil, ErrTooManyHeaders
+	}
+	n := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if !validHeaderName(k) {
+			return nil, fmt.Errorf("invalid header name %q", k)
+		}
+		k = http.CanonicalHeaderKey(k)
+		if _, ok := reservedHeaders[k]; ok {
+			return nil, fmt.Errorf("header %s can't be set", k)
+		}
+		if strings.ContainsAny(v, "\r\n\x00") || len(v) > 8192 {
+			return nil, fmt.Errorf("invalid value of header %s", k)
+		}
+		n[k] = v
+	}
+	return n, nil
+}
+
+// validHeaderName reports whether name is an http token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c >= 0x7f || c <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return true
+}
+
 type IdReq struct {
 	Id uint `json:"id"`
 }
@@ -108,9 +176,83 @@ func (s *SwapMovieReq) Validate() error {
 	return nil
 }
 
+// MoveMovieReq moves a movie into a folder, ParentId 0 moves it to the top level
+type MoveMovieReq struct {
+	Id       uint `json:"id"`
+	ParentId uint `json:"parentId"`
+}
+
+func (m *MoveMovieReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(m)
+}
+
+func (m *MoveMovieReq) Validate() error {
+	if m.Id <= 0 {
+		return ErrId
+	}
+	return nil
+}
+
+type PlayModeReq struct {
+	PlayMode model.PlayMode `json:"playMode"`
+}
+
+func (p *PlayModeReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(p)
+}
+
+func (p *PlayModeReq) Validate() error {
+	if !p.PlayMode.Valid() {
+		return ErrInvalidPlayMode
+	}
+	return nil
+}
+
 type MoviesResp struct {
-	Id      uint                `json:"id"`
-	Base    model.BaseMovieInfo `json:"base"`
-	PullKey string              `json:"pullKey"`
-	Creater string              `json:"creater"`
+	Id        uint                `json:"id"`
+	ParentId  uint                `json:"parentId"`
+	Base      model.BaseMovieInfo `json:"base"`
+	Meta      model.MovieMeta     `json:"meta"`
+	PullKey   string              `json:"pullKey"`
+	Creater   string              `json:"creater"`
+	CreatedAt int64               `json:"createdAt"`
+}
+
+// ProxyURLResp is the url of a proxied movie, ExpiresAt is 0 when it does not expire
+type ProxyURLResp struct {
+	Url       string `json:"url"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+type StatusResp struct {
+	Seek    float64 `json:"seek"`
+	Rate    float64 `json:"rate"`
+	Playing bool    `json:"playing"`
+}
+
+// CurrentResp keeps the shape the current movie had when it was the
+// encoded op.Current, clients read its movie as the stored movie
+type CurrentResp struct {
+	Movie    model.Movie `json:"movie"`
+	Status   StatusResp  `json:"status"`
+	Subtitle uint        `json:"subtitle"`
+}
+
+type SubtitleResp struct {
+	Id        uint   `json:"id"`
+	MovieId   uint   `json:"movieId"`
+	Name      string `json:"name"`
+	Format    string `json:"format"`
+	Url       string `json:"url"`
+	Creator   string `json:"creator"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type DanmakuResp struct {
+	Id        uint    `json:"id"`
+	MovieId   uint    `json:"movieId"`
+	Time      float64 `json:"time"`
+	Content   string  `json:"content"`
+	Color     string  `json:"color"`
+	CreatedAt int64   `json:"createdAt"`
 }
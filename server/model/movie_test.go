@@ -0,0 +1,37 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPushMovieHeaders(t *testing.T) {
+	req := PushMovieReq{Name: "a", Url: "http://example.com/a.mp4", Headers: map[string]string{
+		"referer":    "https://example.com/",
+		"user-agent": "synctv",
+		"Cookie":     "session=1",
+	}}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Referer":    "https://example.com/",
+		"User-Agent": "synctv",
+		"Cookie":     "session=1",
+	}
+	if !reflect.DeepEqual(req.Headers, want) {
+		t.Fatalf("headers = %v, want %v", req.Headers, want)
+	}
+
+	for _, headers := range []map[string]string{
+		{"Referer": "a\r\nHost: evil"},
+		{"Bad Name": "a"},
+		{"host": "example.com"},
+		{"Range": "bytes=0-"},
+	} {
+		req := PushMovieReq{Name: "a", Headers: headers}
+		if err := req.Validate(); err == nil {
+			t.Fatalf("headers %q accepted", headers)
+		}
+	}
+}
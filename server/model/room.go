@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
 	json "github.com/json-iterator/go"
 	"github.com/synctv-org/synctv/internal/conf"
@@ -20,6 +22,18 @@ var (
 	ErrPasswordTooLong        = errors.New("password too long")
 	ErrPasswordHasInvalidChar = errors.New("password has invalid char")
 
+	ErrEmptyRoomId          = errors.New("empty room id")
+	ErrScheduledAtInPast    = errors.New("scheduled time is in the past")
+	ErrInvalidMaxClients    = errors.New("max clients can't be negative")
+	ErrInvalidVoteThreshold = errors.New("vote threshold must be between 0 and 100")
+	ErrInvalidChatFilter    = errors.New("invalid chat filter")
+	ErrInvalidRolePreset    = errors.New("role must be admin, moderator, member or restricted")
+	ErrUnknownPermission    = errors.New("unknown permission")
+
+	ErrTooManyTags       = errors.New("too many tags")
+	ErrTagTooLong        = errors.New("tag too long")
+	ErrTagHasInvalidChar = errors.New("tag has invalid char")
+
 	ErrEmptyUserId            = errors.New("empty user id")
 	ErrEmptyUsername          = errors.New("empty username")
 	ErrUsernameTooLong        = errors.New("username too long")
@@ -30,18 +44,58 @@ var (
 	alnumReg         = regexp.MustCompile(`^[[:alnum:]]+$`)
 	alnumPrintReg    = regexp.MustCompile(`^[[:print:][:alnum:]]+$`)
 	alnumPrintHanReg = regexp.MustCompile(`^[[:print:][:alnum:]\p{Han}]+$`)
+	tagReg           = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
 )
 
+const maxTags = 10
+
+// NormalizeTags lowercases and deduplicates tags, and validates them
+func NormalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxTags {
+		return nil, ErrTooManyTags
+	}
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if len(t) > 32 {
+			return nil, ErrTagTooLong
+		}
+		if !tagReg.MatchString(t) {
+			return nil, ErrTagHasInvalidChar
+		}
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		normalized = append(normalized, t)
+	}
+	return normalized, nil
+}
+
 type FormatEmptyPasswordError string
 
 func (f FormatEmptyPasswordError) Error() string {
 	return fmt.Sprintf("%s password empty", string(f))
 }
 
+// CreateRoomSetting is the setting of a new room, DefaultRole is a
+// shorthand for the DefaultPermissions of a preset
+type CreateRoomSetting struct {
+	model.Setting
+	DefaultRole model.RolePreset `json:"defaultRole"`
+}
+
 type CreateRoomReq struct {
-	RoomName string        `json:"roomName"`
-	Password string        `json:"password"`
-	Setting  model.Setting `json:"setting"`
+	RoomName string            `json:"roomName"`
+	Password string            `json:"password"`
+	Setting  CreateRoomSetting `json:"setting"`
+	// ScheduledAt is the unix milli start time, 0 starts the room immediately
+	ScheduledAt int64    `json:"scheduledAt"`
+	Tags        []string `json:"tags"`
 }
 
 func (c *CreateRoomReq) Decode(ctx *gin.Context) error {
@@ -63,24 +117,130 @@ func (c *CreateRoomReq) Validate() error {
 		} else if !alnumPrintReg.MatchString(c.Password) {
 			return ErrPasswordHasInvalidChar
 		}
-	} else if conf.Conf.Room.MustPassword {
+	} else if conf.Conf().Room.MustPassword {
 		return FormatEmptyPasswordError("room")
 	}
 
+	if c.ScheduledAt != 0 && time.UnixMilli(c.ScheduledAt).Before(time.Now()) {
+		return ErrScheduledAtInPast
+	}
+
+	if c.Setting.DefaultRole != "" {
+		if c.Setting.DefaultPermissions != nil {
+			return errors.New("default permissions and default role can't be set together")
+		}
+		if !c.Setting.DefaultRole.Valid() {
+			return ErrInvalidRolePreset
+		}
+		p := c.Setting.DefaultRole.Permissions()
+		c.Setting.DefaultPermissions = &p
+	}
+	if c.Setting.DefaultPermissions != nil && !c.Setting.DefaultPermissions.Valid() {
+		return ErrUnknownPermission
+	}
+
+	var err error
+	if c.Tags, err = NormalizeTags(c.Tags); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+type CloneRoomReq struct {
+	RoomName string `json:"roomName"`
+	Password string `json:"password"`
+	// WithMovies also copies the playlist
+	WithMovies bool `json:"withMovies"`
+}
+
+func (c *CloneRoomReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(c)
+}
+
+func (c *CloneRoomReq) Validate() error {
+	return (&CreateRoomReq{RoomName: c.RoomName, Password: c.Password}).Validate()
+}
+
 type RoomListResp struct {
-	RoomId       uint   `json:"roomId"`
-	RoomName     string `json:"roomName"`
-	PeopleNum    int64  `json:"peopleNum"`
-	NeedPassword bool   `json:"needPassword"`
-	Creator      string `json:"creator"`
-	CreatedAt    int64  `json:"createdAt"`
+	RoomId       string   `json:"roomId"`
+	RoomName     string   `json:"roomName"`
+	PeopleNum    int64    `json:"peopleNum"`
+	NeedPassword bool     `json:"needPassword"`
+	Creator      string   `json:"creator"`
+	CreatedAt    int64    `json:"createdAt"`
+	Tags         []string `json:"tags"`
+}
+
+type AdminRoomResp struct {
+	*RoomListResp
+	Hidden bool `json:"hidden"`
+	// DeletedAt is when the room was soft deleted, 0 for the others
+	DeletedAt int64 `json:"deletedAt"`
+}
+
+type RoomMemberResp struct {
+	UserId      uint             `json:"userId"`
+	Username    string           `json:"username"`
+	DisplayName string           `json:"displayName"`
+	Avatar      string           `json:"avatar"`
+	Role        model.RoomRole   `json:"role"`
+	Permissions model.Permission `json:"permissions"`
+	Online      bool             `json:"online"`
+	JoinedAt    int64            `json:"joinedAt"`
+}
+
+type RoomEventResp struct {
+	Id        uint                `json:"id"`
+	UserId    uint                `json:"userId"`
+	Username  string              `json:"username"`
+	Type      model.RoomEventType `json:"type"`
+	Detail    string              `json:"detail"`
+	CreatedAt int64               `json:"createdAt"`
+}
+
+type PermissionAuditResp struct {
+	Id             uint             `json:"id"`
+	ActorId        uint             `json:"actorId"`
+	ActorUsername  string           `json:"actorUsername"`
+	TargetId       uint             `json:"targetId"`
+	TargetUsername string           `json:"targetUsername"`
+	Role           model.RolePreset `json:"role"`
+	Before         model.Permission `json:"before"`
+	After          model.Permission `json:"after"`
+	CreatedAt      int64            `json:"createdAt"`
+}
+
+type ChatMessageResp struct {
+	Id        uint   `json:"id"`
+	UserId    uint   `json:"userId"`
+	Username  string `json:"username"`
+	Content   string `json:"content"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// MuteUserReq mutes the user Id for Duration seconds, 0 unmutes
+type MuteUserReq struct {
+	Id       uint  `json:"id"`
+	Duration int64 `json:"duration"`
+}
+
+func (m *MuteUserReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(m)
+}
+
+func (m *MuteUserReq) Validate() error {
+	if m.Id == 0 {
+		return ErrId
+	}
+	if m.Duration < 0 {
+		return errors.New("duration must not be negative")
+	}
+	return nil
 }
 
 type LoginRoomReq struct {
-	RoomId   uint   `json:"roomId"`
+	RoomId   string `json:"roomId"`
 	Password string `json:"password"`
 }
 
@@ -89,7 +249,7 @@ func (l *LoginRoomReq) Decode(ctx *gin.Context) error {
 }
 
 func (l *LoginRoomReq) Validate() error {
-	if l.RoomId == 0 {
+	if l.RoomId == "" {
 		return ErrEmptyRoomName
 	}
 
@@ -113,6 +273,197 @@ func (s *SetRoomPasswordReq) Validate() error {
 	return nil
 }
 
+// RoomSettingReq is a partial update, omitted fields are left unchanged
+type RoomSettingReq struct {
+	Hidden      *bool  `json:"hidden"`
+	MaxClients  *int64 `json:"maxClients"`
+	ChatEnabled *bool  `json:"chatEnabled"`
+	// WhitelistOnly restricts joining to the room members, see the invites
+	WhitelistOnly *bool `json:"whitelistOnly"`
+	// AllowGuest lets visitors without an account get a view only token
+	AllowGuest *bool `json:"allowGuest"`
+	// HostOnly limits playback control to users with the permission
+	HostOnly *bool `json:"hostOnly"`
+	// VoteThreshold is the percentage of clients that must vote to pause,
+	// play or skip, 0 disables voting
+	VoteThreshold *int64 `json:"voteThreshold"`
+	// AutoNext plays the next movie when clients report the current one ended
+	AutoNext *bool `json:"autoNext"`
+	// DanmakuEnabled accepts new danmaku
+	DanmakuEnabled *bool `json:"danmakuEnabled"`
+	// VoiceEnabled opens the voice channel to users with CanUseVoice
+	VoiceEnabled *bool `json:"voiceEnabled"`
+	// DefaultRole gives the permissions of the preset to new members, like
+	// POST /api/room/permissions/default
+	DefaultRole *model.RolePreset `json:"defaultRole"`
+	// ChatFilter replaces the chat filter of the room
+	ChatFilter *model.ChatFilter `json:"chatFilter"`
+	// Password replaces the room password, an empty password removes it
+	Password *string `json:"password"`
+	// Tags replaces the room tags
+	Tags *[]string `json:"tags"`
+}
+
+func (r *RoomSettingReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(r)
+}
+
+func (r *RoomSettingReq) Validate() error {
+	if r.MaxClients != nil && *r.MaxClients < 0 {
+		return ErrInvalidMaxClients
+	}
+	if r.VoteThreshold != nil && (*r.VoteThreshold < 0 || *r.VoteThreshold > 100) {
+		return ErrInvalidVoteThreshold
+	}
+	if r.Password != nil {
+		if *r.Password == "" {
+			if conf.Conf().Room.MustPassword {
+				return FormatEmptyPasswordError("room")
+			}
+		} else if err := (&SetRoomPasswordReq{Password: *r.Password}).Validate(); err != nil {
+			return err
+		}
+	}
+	if r.DefaultRole != nil && !r.DefaultRole.Valid() {
+		return ErrInvalidRolePreset
+	}
+	if r.ChatFilter != nil {
+		if err := validateChatFilter(r.ChatFilter); err != nil {
+			return err
+		}
+	}
+	if r.Tags != nil {
+		tags, err := NormalizeTags(*r.Tags)
+		if err != nil {
+			return err
+		}
+		r.Tags = &tags
+	}
+	return nil
+}
+
+// Apply copies the given fields to setting
+func (r *RoomSettingReq) Apply(setting *model.Setting) {
+	if r.Hidden != nil {
+		setting.Hidden = *r.Hidden
+	}
+	if r.MaxClients != nil {
+		setting.MaxClients = *r.MaxClients
+	}
+	if r.ChatEnabled != nil {
+		setting.DisableChat = !*r.ChatEnabled
+	}
+	if r.WhitelistOnly != nil {
+		setting.WhitelistOnly = *r.WhitelistOnly
+	}
+	if r.AllowGuest != nil {
+		setting.AllowGuest = *r.AllowGuest
+	}
+	if r.HostOnly != nil {
+		setting.HostOnly = *r.HostOnly
+	}
+	if r.VoteThreshold != nil {
+		setting.VoteThreshold = *r.VoteThreshold
+	}
+	if r.AutoNext != nil {
+		setting.AutoNext = *r.AutoNext
+	}
+	if r.DanmakuEnabled != nil {
+		setting.DisableDanmaku = !*r.DanmakuEnabled
+	}
+	if r.VoiceEnabled != nil {
+		setting.EnableVoice = *r.VoiceEnabled
+	}
+	if r.ChatFilter != nil {
+		setting.ChatFilter = *r.ChatFilter
+	}
+}
+
+const (
+	maxBlockedWords      = 500
+	maxBlockedWordLength = 64
+)
+
+func validateChatFilter(f *model.ChatFilter) error {
+	if f.Action != "" && !f.Action.Valid() {
+		return fmt.Errorf("%w: unknown action %s", ErrInvalidChatFilter, f.Action)
+	}
+	if f.RepeatLimit < 0 || f.MuteSeconds < 0 {
+		return fmt.Errorf("%w: negative limit", ErrInvalidChatFilter)
+	}
+	if len(f.BlockedWords) > maxBlockedWords {
+		return fmt.Errorf("%w: too many blocked words", ErrInvalidChatFilter)
+	}
+	for _, w := range f.BlockedWords {
+		if len(w) > maxBlockedWordLength {
+			return fmt.Errorf("%w: blocked word too long", ErrInvalidChatFilter)
+		}
+	}
+	return nil
+}
+
+const maxAnnouncementLength = 1024
+
+type AnnouncementReq struct {
+	Announcement string `json:"announcement"`
+}
+
+func (a *AnnouncementReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(a)
+}
+
+func (a *AnnouncementReq) Validate() error {
+	if len(a.Announcement) > maxAnnouncementLength {
+		return errors.New("announcement too long")
+	}
+	return nil
+}
+
+type BatchRoomAction string
+
+const (
+	BatchRoomDelete   BatchRoomAction = "delete"
+	BatchRoomHide     BatchRoomAction = "hide"
+	BatchRoomShow     BatchRoomAction = "show"
+	BatchRoomPassword BatchRoomAction = "password"
+)
+
+const maxBatchRooms = 100
+
+type BatchRoomReq struct {
+	RoomIds []string        `json:"roomIds"`
+	Action  BatchRoomAction `json:"action"`
+	// Password is used by the password action, empty removes the password
+	Password string `json:"password"`
+}
+
+func (b *BatchRoomReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(b)
+}
+
+func (b *BatchRoomReq) Validate() error {
+	if len(b.RoomIds) == 0 {
+		return ErrEmptyRoomId
+	}
+	if len(b.RoomIds) > maxBatchRooms {
+		return fmt.Errorf("at most %d rooms at once", maxBatchRooms)
+	}
+	switch b.Action {
+	case BatchRoomDelete, BatchRoomHide, BatchRoomShow:
+	case BatchRoomPassword:
+		if b.Password == "" {
+			if conf.Conf().Room.MustPassword {
+				return FormatEmptyPasswordError("room")
+			}
+		} else if err := (&SetRoomPasswordReq{Password: b.Password}).Validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown action: %s", b.Action)
+	}
+	return nil
+}
+
 type UserIdReq struct {
 	UserId uint `json:"userId"`
 }
@@ -127,3 +478,191 @@ func (u *UserIdReq) Validate() error {
 	}
 	return nil
 }
+
+type RoomIdReq struct {
+	RoomId string `json:"roomId"`
+}
+
+func (r *RoomIdReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(r)
+}
+
+func (r *RoomIdReq) Validate() error {
+	if r.RoomId == "" {
+		return ErrEmptyRoomId
+	}
+	return nil
+}
+
+// ChangeUserPermissionReq grants and revokes single permission bits of a member,
+// the bits in neither mask are left as they are
+type ChangeUserPermissionReq struct {
+	UserId uint             `json:"userId"`
+	Add    model.Permission `json:"add"`
+	Remove model.Permission `json:"remove"`
+}
+
+func (c *ChangeUserPermissionReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(c)
+}
+
+func (c *ChangeUserPermissionReq) Validate() error {
+	if c.UserId == 0 {
+		return ErrEmptyUserId
+	}
+	if c.Add == 0 && c.Remove == 0 {
+		return errors.New("no permission to change")
+	}
+	if c.Add&c.Remove != 0 {
+		return errors.New("a permission can't be both added and removed")
+	}
+	if !(c.Add | c.Remove).Valid() {
+		return ErrUnknownPermission
+	}
+	return nil
+}
+
+const maxBatchPermissionChanges = 100
+
+// BatchChangeUserPermissionReq applies several ChangeUserPermissionReq at once
+type BatchChangeUserPermissionReq struct {
+	Changes []ChangeUserPermissionReq `json:"changes"`
+}
+
+func (b *BatchChangeUserPermissionReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(b)
+}
+
+func (b *BatchChangeUserPermissionReq) Validate() error {
+	if len(b.Changes) == 0 {
+		return errors.New("no permission to change")
+	}
+	if len(b.Changes) > maxBatchPermissionChanges {
+		return fmt.Errorf("at most %d members can be changed at once", maxBatchPermissionChanges)
+	}
+	seen := make(map[uint]struct{}, len(b.Changes))
+	for i := range b.Changes {
+		c := &b.Changes[i]
+		if err := c.Validate(); err != nil {
+			return err
+		}
+		if _, ok := seen[c.UserId]; ok {
+			return fmt.Errorf("user %d is changed twice", c.UserId)
+		}
+		seen[c.UserId] = struct{}{}
+	}
+	return nil
+}
+
+// PermissionChanges returns the changes of the request
+func (b *BatchChangeUserPermissionReq) PermissionChanges() []model.PermissionChange {
+	changes := make([]model.PermissionChange, len(b.Changes))
+	for i, c := range b.Changes {
+		changes[i] = model.PermissionChange{
+			UserID: c.UserId,
+			Add:    c.Add,
+			Remove: c.Remove,
+		}
+	}
+	return changes
+}
+
+type AssignRoleReq struct {
+	UserId uint             `json:"userId"`
+	Role   model.RolePreset `json:"role"`
+}
+
+func (a *AssignRoleReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(a)
+}
+
+func (a *AssignRoleReq) Validate() error {
+	if a.UserId == 0 {
+		return ErrEmptyUserId
+	}
+	if !a.Role.Valid() {
+		return ErrInvalidRolePreset
+	}
+	return nil
+}
+
+// SetDefaultPermissionsReq sets the permissions of new members to Permissions,
+// or to the permissions of Role
+type SetDefaultPermissionsReq struct {
+	Permissions *model.Permission `json:"permissions"`
+	Role        model.RolePreset  `json:"role"`
+}
+
+func (s *SetDefaultPermissionsReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(s)
+}
+
+func (s *SetDefaultPermissionsReq) Validate() error {
+	if s.Role != "" {
+		if s.Permissions != nil {
+			return errors.New("permissions and role can't be set together")
+		}
+		if !s.Role.Valid() {
+			return ErrInvalidRolePreset
+		}
+		p := s.Role.Permissions()
+		s.Permissions = &p
+		return nil
+	}
+	if s.Permissions == nil {
+		return errors.New("permissions or role is required")
+	}
+	if !s.Permissions.Valid() {
+		return ErrUnknownPermission
+	}
+	return nil
+}
+
+const maxInviteExpire = 30 * 24 * time.Hour
+
+type CreateInviteReq struct {
+	Permissions model.Permission `json:"permissions"`
+	// Expire is a duration such as 24h, defaults to 24h
+	Expire  string `json:"expire"`
+	MaxUses uint   `json:"maxUses"`
+
+	expire time.Duration
+}
+
+func (c *CreateInviteReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(c)
+}
+
+func (c *CreateInviteReq) Validate() error {
+	if c.Expire == "" {
+		c.Expire = "24h"
+	}
+	d, err := time.ParseDuration(c.Expire)
+	if err != nil {
+		return err
+	}
+	if d <= 0 || d > maxInviteExpire {
+		return errors.New("expire must be between 0 and 720h")
+	}
+	c.expire = d
+	return nil
+}
+
+func (c *CreateInviteReq) ExpireDuration() time.Duration {
+	return c.expire
+}
+
+type JoinInviteReq struct {
+	Token string `json:"token"`
+}
+
+func (j *JoinInviteReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(j)
+}
+
+func (j *JoinInviteReq) Validate() error {
+	if j.Token == "" {
+		return errors.New("empty token")
+	}
+	return nil
+}
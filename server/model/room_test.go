@@ -0,0 +1,55 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got, err := NormalizeTags([]string{" Anime ", "anime", "", "sci-fi", "动画"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"anime", "sci-fi", "动画"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("NormalizeTags() = %v, want %v", got, want)
+	}
+
+	for _, c := range []struct {
+		tags []string
+		err  error
+	}{
+		{[]string{"a b"}, ErrTagHasInvalidChar},
+		{[]string{strings.Repeat("a", 33)}, ErrTagTooLong},
+		{strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","), ErrTooManyTags},
+	} {
+		if _, err := NormalizeTags(c.tags); !errors.Is(err, c.err) {
+			t.Fatalf("NormalizeTags(%v) error = %v, want %v", c.tags, err, c.err)
+		}
+	}
+}
+
+func TestCreateRoomDefaultRole(t *testing.T) {
+	req := CreateRoomReq{}
+	if err := json.Unmarshal([]byte(`{"roomName":"room","password":"pw","setting":{"hidden":true,"defaultRole":"moderator"}}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !req.Setting.Hidden || req.Setting.MemberPermissions() != model.RolePresetModerator.Permissions() {
+		t.Fatalf("setting = %+v, want hidden with the moderator permissions", req.Setting.Setting)
+	}
+
+	req = CreateRoomReq{}
+	if err := json.Unmarshal([]byte(`{"roomName":"room","password":"pw","setting":{"defaultRole":"owner"}}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Validate(); !errors.Is(err, ErrInvalidRolePreset) {
+		t.Fatalf("Validate() error = %v, want %v", err, ErrInvalidRolePreset)
+	}
+}
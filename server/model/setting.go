@@ -0,0 +1,44 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	json "github.com/json-iterator/go"
+)
+
+// SetSettingsReq changes instance settings by name, each value is a json
+// value of the type of its setting
+type SetSettingsReq map[string]json.RawMessage
+
+func (s *SetSettingsReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(s)
+}
+
+func (s *SetSettingsReq) Validate() error {
+	if len(*s) == 0 {
+		return errors.New("no setting to change")
+	}
+	return nil
+}
+
+// Values returns the values in the text form stored by the settings package
+func (s SetSettingsReq) Values() map[string]string {
+	values := make(map[string]string, len(s))
+	for name, raw := range s {
+		var str string
+		if err := json.Unmarshal(raw, &str); err == nil {
+			values[name] = str
+		} else {
+			values[name] = string(raw)
+		}
+	}
+	return values
+}
+
+type SettingResp struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Value   any    `json:"value"`
+	Default any    `json:"default"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Timestamp formats t as unix milliseconds, which is the format of every
+// timestamp in api responses but the time of ApiResp. The zero time is
+// formatted as 0.
+func Timestamp(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
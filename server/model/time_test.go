@@ -0,0 +1,16 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestamp(t *testing.T) {
+	if got := Timestamp(time.Time{}); got != 0 {
+		t.Fatalf("Timestamp(zero) = %d, want 0", got)
+	}
+	now := time.Now()
+	if got := Timestamp(now); got != now.UnixMilli() {
+		t.Fatalf("Timestamp(now) = %d, want %d", got, now.UnixMilli())
+	}
+}
@@ -2,9 +2,16 @@ package model
 
 import (
 	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	json "github.com/json-iterator/go"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/model"
 )
 
 type SetUserPasswordReq struct {
@@ -26,6 +33,7 @@ func (s *SetUserPasswordReq) Validate() error {
 	return nil
 }
 
+// LoginUserReq logs in with a password, Username may also be the email of the user
 type LoginUserReq struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -38,7 +46,7 @@ func (l *LoginUserReq) Decode(ctx *gin.Context) error {
 func (l *LoginUserReq) Validate() error {
 	if l.Username == "" {
 		return errors.New("username is empty")
-	} else if len(l.Username) > 32 {
+	} else if len(l.Username) > maxEmailLength {
 		return ErrUsernameTooLong
 	}
 
@@ -50,9 +58,13 @@ func (l *LoginUserReq) Validate() error {
 	return nil
 }
 
+const maxEmailLength = 191
+
 type SignupUserReq struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Email is optional, it must not belong to another user
+	Email string `json:"email"`
 }
 
 func (s *SignupUserReq) Decode(ctx *gin.Context) error {
@@ -68,12 +80,475 @@ func (s *SignupUserReq) Validate() error {
 		return ErrUsernameHasInvalidChar
 	}
 
-	if s.Password == "" {
+	if err := validateNewPassword(s.Password); err != nil {
+		return err
+	}
+
+	if s.Email != "" {
+		s.Email = strings.ToLower(strings.TrimSpace(s.Email))
+		if err := validateEmail(s.Email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateNewPassword checks a password the user chooses, passwords of logins are only checked for length
+func validateNewPassword(password string) error {
+	if password == "" {
 		return FormatEmptyPasswordError("user")
-	} else if len(s.Password) > 32 {
+	} else if len(password) < conf.Conf().User.MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", conf.Conf().User.MinPasswordLength)
+	} else if len(password) > 32 {
 		return ErrPasswordTooLong
-	} else if !alnumPrintReg.MatchString(s.Password) {
+	} else if !alnumPrintReg.MatchString(password) {
 		return ErrPasswordHasInvalidChar
 	}
 	return nil
 }
+
+func validateEmail(email string) error {
+	if len(email) > maxEmailLength {
+		return errors.New("email too long")
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return errors.New("invalid email")
+	}
+	return nil
+}
+
+type VerifyEmailReq struct {
+	Token string `json:"token"`
+}
+
+func (v *VerifyEmailReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(v)
+}
+
+func (v *VerifyEmailReq) Validate() error {
+	if v.Token == "" {
+		return errors.New("token is empty")
+	}
+	return nil
+}
+
+type RequestPasswordResetReq struct {
+	Email string `json:"email"`
+}
+
+func (r *RequestPasswordResetReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(r)
+}
+
+func (r *RequestPasswordResetReq) Validate() error {
+	r.Email = strings.ToLower(strings.TrimSpace(r.Email))
+	if r.Email == "" {
+		return errors.New("email is empty")
+	}
+	return validateEmail(r.Email)
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (r *ResetPasswordReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(r)
+}
+
+func (r *ResetPasswordReq) Validate() error {
+	if r.Token == "" {
+		return errors.New("token is empty")
+	}
+	return validateNewPassword(r.Password)
+}
+
+type AcceptTermsReq struct {
+	Version string `json:"version"`
+}
+
+func (a *AcceptTermsReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(a)
+}
+
+func (a *AcceptTermsReq) Validate() error {
+	if a.Version == "" {
+		return errors.New("terms version is empty")
+	}
+	return nil
+}
+
+const maxDirectMessageLength = 4096
+
+type DirectMessageReq struct {
+	UserId  uint   `json:"userId"`
+	Content string `json:"content"`
+}
+
+func (d *DirectMessageReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(d)
+}
+
+func (d *DirectMessageReq) Validate() error {
+	if d.UserId == 0 {
+		return ErrEmptyUserId
+	}
+	if d.Content == "" {
+		return errors.New("message is empty")
+	} else if len(d.Content) > maxDirectMessageLength {
+		return errors.New("message too long")
+	}
+	return nil
+}
+
+type DirectMessageResp struct {
+	Id          uint   `json:"id"`
+	SenderId    uint   `json:"senderId"`
+	RecipientId uint   `json:"recipientId"`
+	Content     string `json:"content"`
+	Seen        bool   `json:"seen"`
+	CreatedAt   int64  `json:"createdAt"`
+}
+
+type TwoFactorCodeReq struct {
+	Code string `json:"code"`
+}
+
+func (t *TwoFactorCodeReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(t)
+}
+
+func (t *TwoFactorCodeReq) Validate() error {
+	if t.Code == "" {
+		return errors.New("code is empty")
+	} else if len(t.Code) > 32 {
+		return errors.New("code too long")
+	}
+	return nil
+}
+
+// TwoFactorLoginReq is the second step of a login, Token comes from the first step
+type TwoFactorLoginReq struct {
+	Token string `json:"token"`
+	TwoFactorCodeReq
+}
+
+func (t *TwoFactorLoginReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(t)
+}
+
+func (t *TwoFactorLoginReq) Validate() error {
+	if t.Token == "" {
+		return errors.New("token is empty")
+	}
+	return t.TwoFactorCodeReq.Validate()
+}
+
+type RefreshTokenReq struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (r *RefreshTokenReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(r)
+}
+
+func (r *RefreshTokenReq) Validate() error {
+	if r.RefreshToken == "" {
+		return errors.New("refresh token is empty")
+	} else if len(r.RefreshToken) > 64 {
+		return errors.New("refresh token too long")
+	}
+	return nil
+}
+
+type CreateAPIKeyReq struct {
+	Name   string              `json:"name"`
+	Scopes []model.APIKeyScope `json:"scopes"`
+	// Expire is a duration such as 720h, keys without one never expire
+	Expire string `json:"expire"`
+
+	expire time.Duration
+}
+
+func (c *CreateAPIKeyReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(c)
+}
+
+func (c *CreateAPIKeyReq) Validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return errors.New("name is empty")
+	} else if len(c.Name) > 64 {
+		return errors.New("name too long")
+	}
+	if len(c.Scopes) == 0 {
+		return errors.New("scopes are empty")
+	}
+	for _, s := range c.Scopes {
+		if !s.Valid() {
+			return fmt.Errorf("unknown scope: %s", s)
+		}
+	}
+	if c.Expire != "" {
+		d, err := time.ParseDuration(c.Expire)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return errors.New("expire must be positive")
+		}
+		c.expire = d
+	}
+	return nil
+}
+
+func (c *CreateAPIKeyReq) ExpireDuration() time.Duration {
+	return c.expire
+}
+
+type SessionResp struct {
+	Id         uint   `json:"id"`
+	UserAgent  string `json:"userAgent"`
+	Ip         string `json:"ip"`
+	LastUsedAt int64  `json:"lastUsedAt"`
+	ExpiresAt  int64  `json:"expiresAt"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+type APIKeyResp struct {
+	Id     uint                `json:"id"`
+	Name   string              `json:"name"`
+	Prefix string              `json:"prefix"`
+	Scopes []model.APIKeyScope `json:"scopes"`
+	// ExpiresAt is 0 for keys that never expire, LastUsedAt for keys never used
+	ExpiresAt  int64 `json:"expiresAt"`
+	LastUsedAt int64 `json:"lastUsedAt"`
+	CreatedAt  int64 `json:"createdAt"`
+}
+
+type RenameUserReq struct {
+	Username string `json:"username"`
+}
+
+func (r *RenameUserReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(r)
+}
+
+func (r *RenameUserReq) Validate() error {
+	if r.Username == "" {
+		return errors.New("username is empty")
+	} else if len(r.Username) > 32 {
+		return ErrUsernameTooLong
+	} else if !alnumPrintHanReg.MatchString(r.Username) {
+		return ErrUsernameHasInvalidChar
+	}
+	return nil
+}
+
+type UsernameChangeResp struct {
+	Id        uint   `json:"id"`
+	UserId    uint   `json:"userId"`
+	OldName   string `json:"oldName"`
+	NewName   string `json:"newName"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type ProfileReq struct {
+	DisplayName string `json:"displayName"`
+	Avatar      string `json:"avatar"`
+	Bio         string `json:"bio"`
+}
+
+func (p *ProfileReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(p)
+}
+
+func (p *ProfileReq) Validate() error {
+	p.DisplayName = strings.TrimSpace(p.DisplayName)
+	if len(p.DisplayName) > 64 {
+		return errors.New("display name too long")
+	}
+	if len(p.Bio) > 512 {
+		return errors.New("bio too long")
+	}
+	if len(p.Avatar) > 512 {
+		return errors.New("avatar url too long")
+	}
+	// uploaded avatars keep their path, other avatars must be http urls
+	if p.Avatar != "" && !strings.HasPrefix(p.Avatar, "/api/user/avatar/") {
+		u, err := url.Parse(p.Avatar)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("invalid avatar url")
+		}
+	}
+	return nil
+}
+
+// DeleteAccountReq confirms the deletion with the password of users who have
+// one, and a code when two factor authentication is on
+type DeleteAccountReq struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func (d *DeleteAccountReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(d)
+}
+
+func (d *DeleteAccountReq) Validate() error {
+	if len(d.Password) > 32 {
+		return ErrPasswordTooLong
+	}
+	return nil
+}
+
+// UserExportResp is the archive of the data of a user, secrets such as
+// password hashes, tokens and two factor secrets are left out
+type UserExportResp struct {
+	ExportedAt      int64                   `json:"exportedAt"`
+	Profile         UserExportProfile       `json:"profile"`
+	Providers       []UserExportProvider    `json:"providers"`
+	Sessions        []*SessionResp          `json:"sessions"`
+	APIKeys         []*APIKeyResp           `json:"apiKeys"`
+	UsernameChanges []*UsernameChangeResp   `json:"usernameChanges"`
+	Rooms           []UserExportRoom        `json:"rooms"`
+	Memberships     []UserExportMembership  `json:"memberships"`
+	Favorites       []UserExportFavorite    `json:"favorites"`
+	ChatMessages    []UserExportChatMessage `json:"chatMessages"`
+	DirectMessages  []*DirectMessageResp    `json:"directMessages"`
+	Danmakus        []UserExportDanmaku     `json:"danmakus"`
+	Movies          []UserExportMovie       `json:"movies"`
+	Subtitles       []UserExportSubtitle    `json:"subtitles"`
+}
+
+type UserExportProfile struct {
+	Id                  uint       `json:"id"`
+	Username            string     `json:"username"`
+	DisplayName         string     `json:"displayName"`
+	Avatar              string     `json:"avatar"`
+	Bio                 string     `json:"bio"`
+	Email               string     `json:"email"`
+	EmailVerified       bool       `json:"emailVerified"`
+	Role                model.Role `json:"role"`
+	TwoFactor           bool       `json:"twoFactor"`
+	TermsVersion        string     `json:"termsVersion"`
+	DeletionScheduledAt int64      `json:"deletionScheduledAt"`
+	CreatedAt           int64      `json:"createdAt"`
+}
+
+type UserExportProvider struct {
+	Provider       string `json:"provider"`
+	ProviderUserId string `json:"providerUserId"`
+	CreatedAt      int64  `json:"createdAt"`
+}
+
+type UserExportRoom struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Deleted   bool   `json:"deleted"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type UserExportMembership struct {
+	RoomId      string           `json:"roomId"`
+	Role        model.RoomRole   `json:"role"`
+	Permissions model.Permission `json:"permissions"`
+	JoinedAt    int64            `json:"joinedAt"`
+}
+
+type UserExportFavorite struct {
+	RoomId    string `json:"roomId"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type UserExportChatMessage struct {
+	Id        uint   `json:"id"`
+	RoomId    string `json:"roomId"`
+	Content   string `json:"content"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type UserExportDanmaku struct {
+	Id        uint    `json:"id"`
+	RoomId    string  `json:"roomId"`
+	MovieId   uint    `json:"movieId"`
+	Time      float64 `json:"time"`
+	Content   string  `json:"content"`
+	Color     string  `json:"color"`
+	CreatedAt int64   `json:"createdAt"`
+}
+
+type UserExportMovie struct {
+	Id        uint   `json:"id"`
+	RoomId    string `json:"roomId"`
+	Name      string `json:"name"`
+	Url       string `json:"url"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type UserExportSubtitle struct {
+	Id        uint   `json:"id"`
+	RoomId    string `json:"roomId"`
+	MovieId   uint   `json:"movieId"`
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type AdminUserResp struct {
+	Id          uint   `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email"`
+	Role        string `json:"role"`
+	TwoFactor   bool   `json:"twoFactor"`
+	Pending     bool   `json:"pending"`
+	// RoomQuota is null when the user has the instance default
+	RoomQuota           *int64 `json:"roomQuota"`
+	DeletionScheduledAt int64  `json:"deletionScheduledAt"`
+	CreatedAt           int64  `json:"createdAt"`
+}
+
+type SetRoomQuotaReq struct {
+	UserId uint `json:"userId"`
+	// RoomQuota is the number of rooms the user may create, 0 for unlimited,
+	// null restores the instance default
+	RoomQuota *int64 `json:"roomQuota"`
+}
+
+func (r *SetRoomQuotaReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(r)
+}
+
+func (r *SetRoomQuotaReq) Validate() error {
+	if r.UserId == 0 {
+		return ErrEmptyUserId
+	}
+	if r.RoomQuota != nil && *r.RoomQuota < 0 {
+		return errors.New("room quota must not be negative")
+	}
+	return nil
+}
+
+type LoginLockResp struct {
+	Key         string `json:"key"`
+	Failures    int64  `json:"failures"`
+	LastFailure int64  `json:"lastFailure"`
+	LockedUntil int64  `json:"lockedUntil"`
+}
+
+// UnlockLoginReq forgets the failed logins of Key, such as ip:1.2.3.4 or user:alice
+type UnlockLoginReq struct {
+	Key string `json:"key"`
+}
+
+func (r *UnlockLoginReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(r)
+}
+
+func (r *UnlockLoginReq) Validate() error {
+	if r.Key == "" {
+		return errors.New("key is required")
+	}
+	return nil
+}
@@ -1,7 +1,10 @@
 package auth
 
 import (
+	"crypto/subtle"
+	"errors"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -10,9 +13,101 @@ import (
 	"github.com/synctv-org/synctv/server/middlewares"
 	"github.com/synctv-org/synctv/server/model"
 	"github.com/synctv-org/synctv/utils"
-	"golang.org/x/oauth2"
 )
 
+// stateCookie binds a state to the browser that started the login or link,
+// so a callback with the code of someone else can neither log the browser in
+// nor link that account to the user of the browser
+const (
+	stateCookie     = "synctv_oauth2_state"
+	stateExpire     = time.Minute * 5
+	stateCookiePath = "/oauth2"
+)
+
+// newAuthURL returns the consent page of the provider with a new state bound
+// to it, linkUserID is the user linking the account or zero for a login
+func newAuthURL(ctx *gin.Context, pi Provider, linkUserID uint) (string, error) {
+	state := utils.RandString(16)
+	states.Store(state, pendingAuth{provider: pi.Provider(), linkUserID: linkUserID}, stateExpire)
+	setStateCookie(ctx, state, int(stateExpire/time.Second))
+	return pi.NewAuthURL(ctx, state)
+}
+
+// setStateCookie sets the state cookie, a negative maxAge deletes it, it is
+// lax so the redirect back from the provider carries it
+func setStateCookie(ctx *gin.Context, state string, maxAge int) {
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(stateCookie, state, maxAge, stateCookiePath, "", ctx.Request.TLS != nil, true)
+}
+
+// exchange trades the code of a callback for the provider account, the status is the one to answer on error
+func exchange(ctx *gin.Context, p provider.OAuth2Provider, code, state string) (*pendingAuth, *provider.UserInfo, int, error) {
+	cookie, err := ctx.Cookie(stateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		return nil, nil, http.StatusForbidden, errInvalidState
+	}
+	setStateCookie(ctx, "", -1)
+
+	pending, loaded := states.LoadAndDelete(cookie)
+	if !loaded || pending.provider != p {
+		return nil, nil, http.StatusForbidden, errInvalidState
+	}
+
+	pi, err := provider.GetProvider(p)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, err
+	}
+
+	tk, err := pi.GetToken(ctx, code)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, err
+	}
+
+	ui, err := pi.GetUserInfo(ctx, tk)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, err
+	}
+	return &pending, ui, http.StatusOK, nil
+}
+
+// callback logs in with the provider account of the callback, or links it
+// when the state was issued for a link, in which case the user is nil
+func callback(ctx *gin.Context, p provider.OAuth2Provider, code, state string) (*op.User, int, error) {
+	pending, ui, status, err := exchange(ctx, p, code, state)
+	if err != nil {
+		return nil, status, err
+	}
+
+	if pending.linkUserID != 0 {
+		status, err := link(pending.linkUserID, p, ui)
+		return nil, status, err
+	}
+
+	user, err := op.CreateOrLoadUserWithProvider(p, ui)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if err := user.CheckBanned(); err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	return user, http.StatusOK, nil
+}
+
+func link(userID uint, p provider.OAuth2Provider, ui *provider.UserInfo) (int, error) {
+	user, err := op.GetUserById(userID)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	err = user.LinkProvider(p, ui)
+	switch {
+	case errors.Is(err, op.ErrProviderLinkedToOther), errors.Is(err, op.ErrProviderAlreadyLinked):
+		return http.StatusConflict, err
+	case err != nil:
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
 // /oauth2/login/:type
 func OAuth2(ctx *gin.Context) {
 	p := provider.OAuth2Provider(ctx.Param("type"))
@@ -23,10 +118,13 @@ func OAuth2(ctx *gin.Context) {
 		return
 	}
 
-	state := utils.RandString(16)
-	states.Store(state, struct{}{}, time.Minute*5)
+	url, err := newAuthURL(ctx, pi, 0)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, model.NewApiErrorResp(err))
+		return
+	}
 
-	RenderRedirect(ctx, pi.NewConfig().AuthCodeURL(state, oauth2.AccessTypeOnline))
+	RenderRedirect(ctx, url)
 }
 
 func OAuth2Api(ctx *gin.Context) {
@@ -35,13 +133,17 @@ func OAuth2Api(ctx *gin.Context) {
 	pi, err := provider.GetProvider(p)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
 	}
 
-	state := utils.RandString(16)
-	states.Store(state, struct{}{}, time.Minute*5)
+	url, err := newAuthURL(ctx, pi, 0)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, model.NewApiErrorResp(err))
+		return
+	}
 
 	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
-		"url": pi.NewConfig().AuthCodeURL(state, oauth2.AccessTypeOnline),
+		"url": url,
 	}))
 }
 
@@ -57,40 +159,38 @@ func OAuth2Callback(ctx *gin.Context) {
 
 	state := ctx.Query("state")
 	if state == "" {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("invalid oauth2 state"))
-		return
-	}
-
-	_, loaded := states.LoadAndDelete(state)
-	if !loaded {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("invalid oauth2 state"))
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(errInvalidState))
 		return
 	}
 
-	pi, err := provider.GetProvider(p)
+	user, status, err := callback(ctx, p, code, state)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		ctx.AbortWithStatusJSON(status, model.NewApiErrorResp(err))
+		return
 	}
-
-	ui, err := pi.GetUserInfo(ctx, pi.NewConfig(), code)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+	if user == nil {
+		RenderRedirect(ctx, "/web/user/accounts")
 		return
 	}
 
-	user, err := op.CreateOrLoadUser(ui.Username, p, ui.ProviderUserID)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+	// the web page asks for the code and finishes the login
+	if user.TOTPEnabled {
+		token, err := op.NewTwoFactorToken(user)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+			return
+		}
+		RenderRedirect(ctx, "/web/user/2fa?token="+url.QueryEscape(token))
 		return
 	}
 
-	token, err := middlewares.NewAuthUserToken(user)
+	tokens, err := middlewares.NewAuthUserTokens(ctx, user)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
 		return
 	}
 
-	RenderToken(ctx, "/web/", token)
+	RenderToken(ctx, "/web/", tokens["token"].(string), tokens["refreshToken"].(string))
 }
 
 // /oauth2/callback/:type
@@ -103,36 +203,90 @@ func OAuth2CallbackApi(ctx *gin.Context) {
 		return
 	}
 
-	_, loaded := states.LoadAndDelete(req.State)
-	if !loaded {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("invalid oauth2 state"))
+	user, status, err := callback(ctx, p, req.Code, req.State)
+	if err != nil {
+		ctx.AbortWithStatusJSON(status, model.NewApiErrorResp(err))
+		return
+	}
+	if user == nil {
+		ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+			"linked": true,
+		}))
 		return
 	}
 
-	pi, err := provider.GetProvider(p)
+	resp, err := middlewares.NewLoginResp(ctx, user)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
 	}
 
-	ui, err := pi.GetUserInfo(ctx, pi.NewConfig(), req.Code)
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(resp))
+}
+
+// /oauth2/link/:type returns the consent page that links the provider account to the user
+func OAuth2LinkApi(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+	p := provider.OAuth2Provider(ctx.Param("type"))
+
+	pi, err := provider.GetProvider(p)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
 
-	user, err := op.CreateOrLoadUser(ui.Username, p, ui.ProviderUserID)
+	url, err := newAuthURL(ctx, pi, user.ID)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, model.NewApiErrorResp(err))
 		return
 	}
 
-	token, err := middlewares.NewAuthUserToken(user)
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"url": url,
+	}))
+}
+
+// /oauth2/providers lists the provider accounts of the user
+func OAuth2Providers(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+
+	providers, err := user.Providers()
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
 		return
 	}
 
+	list := make([]gin.H, len(providers))
+	for i, up := range providers {
+		list[i] = gin.H{
+			"provider": up.Provider,
+			"linkedAt": model.Timestamp(up.CreatedAt),
+			"hasEmail": up.VerifiedEmail != "",
+		}
+	}
 	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
-		"token": token,
+		"providers":   list,
+		"hasPassword": len(user.HashedPassword) != 0,
 	}))
 }
+
+// /oauth2/unlink/:type
+func OAuth2Unlink(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.User)
+	p := provider.OAuth2Provider(ctx.Param("type"))
+
+	err := user.UnlinkProvider(p)
+	switch {
+	case errors.Is(err, op.ErrProviderNotLinked):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	case errors.Is(err, op.ErrLastLoginMethod):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	case err != nil:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
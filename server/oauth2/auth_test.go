@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/provider"
+	"golang.org/x/oauth2"
+)
+
+type fakeProvider struct {
+	provider.OAuth2Base
+}
+
+func (f *fakeProvider) Init(opt provider.InitOption) {
+	f.Config = oauth2.Config{
+		ClientID: opt.ClientID,
+		Endpoint: oauth2.Endpoint{AuthURL: "https://fake.example/authorize"},
+	}
+}
+
+func (f *fakeProvider) Provider() provider.OAuth2Provider {
+	return "fake"
+}
+
+// GetToken fails, the tests only check the callbacks get past the state
+func (f *fakeProvider) GetToken(ctx context.Context, code string) (*oauth2.Token, error) {
+	return nil, errors.New("fake provider has no token")
+}
+
+func (f *fakeProvider) GetUserInfo(ctx context.Context, tk *oauth2.Token) (*provider.UserInfo, error) {
+	return nil, errors.New("fake provider has no user")
+}
+
+func TestStateCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider.RegisterProvider(new(fakeProvider))
+	if err := provider.InitProvider("fake", provider.InitOption{ClientID: "id"}); err != nil {
+		t.Fatal(err)
+	}
+	e := gin.New()
+	Init(e)
+
+	login := func() (string, *http.Cookie) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/oauth2/login/fake", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("login: status = %d, %s", w.Code, w.Body.String())
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != stateCookie {
+			t.Fatalf("login cookies = %v, want the state cookie", cookies)
+		}
+		c := cookies[0]
+		if !c.HttpOnly || c.SameSite != http.SameSiteLaxMode || c.Path != stateCookiePath {
+			t.Fatalf("state cookie = %+v, want it http only, lax and on %s", c, stateCookiePath)
+		}
+		resp := struct {
+			Data struct {
+				Url string `json:"url"`
+			} `json:"data"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(resp.Data.Url)
+		if err != nil || u.Host != "fake.example" {
+			t.Fatalf("consent page = %q, %v", resp.Data.Url, err)
+		}
+		return u.Query().Get("state"), c
+	}
+	callback := func(p, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/oauth2/callback/"+p, strings.NewReader(`{"code":"code","state":"`+state+`"}`))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	state, cookie := login()
+	if state != cookie.Value {
+		t.Fatalf("state = %q, cookie = %q, want the same", state, cookie.Value)
+	}
+	if w := callback("fake", state, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("callback without the cookie: status = %d, want 403", w.Code)
+	}
+	other, otherCookie := login()
+	if w := callback("fake", state, otherCookie); w.Code != http.StatusForbidden {
+		t.Fatalf("callback with the cookie of another login: status = %d, want 403", w.Code)
+	}
+	if w := callback("github", other, otherCookie); w.Code != http.StatusForbidden {
+		t.Fatalf("callback of another provider: status = %d, want 403", w.Code)
+	}
+
+	// the state is good, the exchange with the provider fails
+	w := callback("fake", state, cookie)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("callback: status = %d, want 400 from the provider", w.Code)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != stateCookie || cookies[0].MaxAge >= 0 {
+		t.Fatalf("callback cookies = %v, want the state cookie deleted", cookies)
+	}
+	if w := callback("fake", state, cookie); w.Code != http.StatusForbidden {
+		t.Fatalf("state used twice: status = %d, want 403", w.Code)
+	}
+}
@@ -1,6 +1,9 @@
 package auth
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/server/middlewares"
+)
 
 func Init(e *gin.Engine) {
 	{
@@ -15,5 +18,14 @@ func Init(e *gin.Engine) {
 		auth.GET("/callback/:type", OAuth2Callback)
 
 		auth.POST("/callback/:type", OAuth2CallbackApi)
+
+		needAuthUser := auth.Group("")
+		needAuthUser.Use(middlewares.AuthUserMiddleware)
+
+		needAuthUser.GET("/providers", OAuth2Providers)
+
+		needAuthUser.POST("/link/:type", OAuth2LinkApi)
+
+		needAuthUser.POST("/unlink/:type", OAuth2Unlink)
 	}
 }
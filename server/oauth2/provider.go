@@ -0,0 +1,16 @@
+package auth
+
+import (
+	"github.com/synctv-org/synctv/internal/provider"
+)
+
+// Provider is an OAuth2 login provider: its consent page, the exchange of the
+// callback code for a token and the mapping of the token to a user. A package
+// adds a provider by calling Register from its init function, the provider is
+// then enabled by listing its name in the oauth2 config.
+type Provider = provider.ProviderInterface
+
+// Register makes providers available to the oauth2 config, see provider.RegisterProvider
+func Register(ps ...Provider) {
+	provider.RegisterProvider(ps...)
+}
@@ -2,10 +2,12 @@ package auth
 
 import (
 	"embed"
+	"errors"
 	"html/template"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/provider"
 	synccache "github.com/synctv-org/synctv/utils/syncCache"
 )
 
@@ -15,21 +17,33 @@ var temp embed.FS
 var (
 	redirectTemplate *template.Template
 	tokenTemplate    *template.Template
-	states           *synccache.SyncCache[string, struct{}]
+	// states are the pending logins and links, the state cookie ties them to
+	// the browser that started them
+	states *synccache.SyncCache[string, pendingAuth]
 )
 
+// pendingAuth is what a state was issued for, it is only looked up once the
+// state cookie matched
+type pendingAuth struct {
+	provider provider.OAuth2Provider
+	// linkUserID is the user that started the link, zero for logins
+	linkUserID uint
+}
+
+var errInvalidState = errors.New("invalid oauth2 state")
+
 func RenderRedirect(ctx *gin.Context, url string) error {
 	ctx.Header("Content-Type", "text/html; charset=utf-8")
 	return redirectTemplate.Execute(ctx.Writer, url)
 }
 
-func RenderToken(ctx *gin.Context, url, token string) error {
+func RenderToken(ctx *gin.Context, url, token, refreshToken string) error {
 	ctx.Header("Content-Type", "text/html; charset=utf-8")
-	return tokenTemplate.Execute(ctx.Writer, map[string]string{"Url": url, "Token": token})
+	return tokenTemplate.Execute(ctx.Writer, map[string]string{"Url": url, "Token": token, "RefreshToken": refreshToken})
 }
 
 func init() {
 	redirectTemplate = template.Must(template.ParseFS(temp, "templates/redirect.html"))
 	tokenTemplate = template.Must(template.ParseFS(temp, "templates/token.html"))
-	states = synccache.NewSyncCache[string, struct{}](time.Minute * 10)
+	states = synccache.NewSyncCache[string, pendingAuth](time.Minute * 10)
 }